@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"log"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/samber/lo"
 	"github.com/tychoish/fun/srv"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -60,16 +62,41 @@ func runProgram(logger *zap.Logger) (err error) {
 	orca := srv.GetOrchestrator(ctx)
 	defer func() { err = orca.Service().Wait() }()
 
-	if err := orca.Add(srv.HTTP("scheduler-pprof", time.Second, util.MakePPROF("0.0.0.0:7777"))); err != nil {
+	pprofServer, err := util.MakePPROF(lo.FromPtrOr(conf.PPROF, util.DefaultPPROFConfig()))
+	if err != nil {
+		return fmt.Errorf("failed to set up pprof server: %w", err)
+	}
+	if err := orca.Add(srv.HTTP("scheduler-pprof", time.Second, pprofServer)); err != nil {
 		return err
 	}
+	if conf.Profiling != nil {
+		if err := orca.Add(util.ProfilePusher(logger, *conf.Profiling)); err != nil {
+			return err
+		}
+	}
 
 	// The normal scheduler outputs to klog, and there isn't *really* a way to stop that. So to make
 	// everything fit nicely, we'll redirect it to zap as well.
 	redirectKlog(logger.Named("klog"))
 
+	// The constructor is called once for each scheduler profile that enables the plugin. All
+	// profiles must share the same state, so only the first call actually creates the plugin.
+	var enforcerLock sync.Mutex
+	var enforcer *plugin.AutoscaleEnforcer
 	constructor := func(_ctx context.Context, obj runtime.Object, h framework.Handle) (framework.Plugin, error) {
-		return plugin.NewAutoscaleEnforcerPlugin(ctx, logger, h, conf)
+		enforcerLock.Lock()
+		defer enforcerLock.Unlock()
+
+		if enforcer != nil {
+			return enforcer.ForProfile(h), nil
+		}
+
+		var err error
+		enforcer, err = plugin.NewAutoscaleEnforcerPlugin(ctx, logger, h, conf)
+		if err != nil {
+			return nil, err
+		}
+		return enforcer, nil
 	}
 
 	command := app.NewSchedulerCommand(app.WithPlugin(plugin.PluginName, constructor))
@@ -6,6 +6,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/samber/lo"
 	"github.com/tychoish/fun/srv"
 	"go.uber.org/zap"
 
@@ -36,7 +37,7 @@ func main() {
 	if err != nil {
 		logger.Panic("Failed to read config", zap.Error(err))
 	}
-	logger.Info("Got config", zap.Any("config", config))
+	logger.Info("Got config", zap.Any("config", config.Redacted()))
 
 	kubeConfig, err := rest.InClusterConfig()
 	if err != nil {
@@ -75,9 +76,18 @@ func main() {
 		logger.Info("Main loop returned without issue. Exiting.")
 	}()
 
-	if err := srv.GetOrchestrator(ctx).Add(srv.HTTP("agent-pprof", time.Second, util.MakePPROF("0.0.0.0:7777"))); err != nil {
+	pprofServer, err := util.MakePPROF(lo.FromPtrOr(config.PPROF, util.DefaultPPROFConfig()))
+	if err != nil {
+		logger.Panic("Failed to set up pprof server", zap.Error(err))
+	}
+	if err := srv.GetOrchestrator(ctx).Add(srv.HTTP("agent-pprof", time.Second, pprofServer)); err != nil {
 		logger.Panic("Failed to add pprof service", zap.Error(err))
 	}
+	if config.Profiling != nil {
+		if err := srv.GetOrchestrator(ctx).Add(util.ProfilePusher(logger, *config.Profiling)); err != nil {
+			logger.Panic("Failed to add profile pusher service", zap.Error(err))
+		}
+	}
 
 	if err = runner.Run(logger, ctx); err != nil {
 		logger.Panic("Main loop failed", zap.Error(err))
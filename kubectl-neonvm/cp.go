@@ -0,0 +1,82 @@
+package main
+
+// 'kubectl neonvm cp' copies single files to or from the guest, via the runner's /file endpoint
+// and the QEMU guest agent.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// splitRemotePath splits an argument of the form VM:PATH, returning ok=false if the argument is a
+// local path.
+func splitRemotePath(arg string) (vmName string, path string, ok bool) {
+	vmName, path, ok = strings.Cut(arg, ":")
+	if !ok || vmName == "" || strings.Contains(vmName, "/") {
+		return "", "", false
+	}
+	return vmName, path, true
+}
+
+func runCopy(ctx context.Context, c *client, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("%w: expected source and destination", errUsage)
+	}
+	src, dst := args[0], args[1]
+
+	srcVM, srcPath, srcRemote := splitRemotePath(src)
+	dstVM, dstPath, dstRemote := splitRemotePath(dst)
+	switch {
+	case srcRemote && !dstRemote:
+		return copyFromGuest(ctx, c, srcVM, srcPath, dst)
+	case !srcRemote && dstRemote:
+		return copyToGuest(ctx, c, src, dstVM, dstPath)
+	default:
+		return fmt.Errorf("%w: exactly one of source and destination must be VM:PATH", errUsage)
+	}
+}
+
+// guestFilePath returns the path of the runner's /file endpoint for the path in the guest.
+func guestFilePath(guestPath string) string {
+	return "/file?" + url.Values{"path": []string{guestPath}}.Encode()
+}
+
+func copyFromGuest(ctx context.Context, c *client, vmName string, guestPath string, localPath string) error {
+	var out io.Writer = os.Stdout
+	if localPath != "-" {
+		f, err := os.Create(localPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	// The runner aborts the response if reading fails partway, which shows up as an error here.
+	if err := c.runnerGuestRequest(ctx, vmName, http.MethodGet, guestFilePath(guestPath), nil, out); err != nil {
+		return fmt.Errorf("failed to copy %s from guest: %w", guestPath, err)
+	}
+	return nil
+}
+
+func copyToGuest(ctx context.Context, c *client, localPath string, vmName string, guestPath string) error {
+	var in io.Reader = os.Stdin
+	if localPath != "-" {
+		f, err := os.Open(localPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	if err := c.runnerGuestRequest(ctx, vmName, http.MethodPut, guestFilePath(guestPath), in, io.Discard); err != nil {
+		return fmt.Errorf("failed to copy %s to guest: %w", localPath, err)
+	}
+	return nil
+}
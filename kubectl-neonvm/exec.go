@@ -0,0 +1,88 @@
+package main
+
+// 'kubectl neonvm exec' runs a command in the guest, via the runner's /exec endpoint and the QEMU
+// guest agent.
+//
+// The endpoint is reached through pods/exec in the runner container (see api.RunnerGuestSocket),
+// so this needs different permissions from 'kubectl neonvm port-forward'.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+// exitCodeError is returned by commands that should exit with a particular code, without printing
+// an error.
+type exitCodeError struct {
+	code int
+}
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("exit code %d", e.code)
+}
+
+func runExec(ctx context.Context, c *client, args []string) error {
+	flags := flag.NewFlagSet("exec", flag.ContinueOnError)
+	stdin := flags.Bool("i", false, "Pass stdin to the command")
+	timeout := flags.Duration("timeout", 60*time.Second, "How long to wait for the command to exit, at most 10m")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
+	args = flags.Args()
+	if len(args) < 2 {
+		return fmt.Errorf("%w: expected VM name and command", errUsage)
+	}
+	vmName, command := args[0], args[1:]
+	if command[0] == "--" {
+		command = command[1:]
+	}
+	if len(command) == 0 {
+		return fmt.Errorf("%w: expected command", errUsage)
+	}
+
+	req := api.GuestExecRequest{
+		Command:        command,
+		Stdin:          nil,
+		TimeoutSeconds: uint(timeout.Seconds()),
+	}
+	if *stdin {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read stdin: %w", err)
+		}
+		req.Stdin = input
+	}
+
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	var resp bytes.Buffer
+	if err := c.runnerGuestRequest(ctx, vmName, http.MethodPost, "/exec", bytes.NewReader(reqJSON), &resp); err != nil {
+		return err
+	}
+	var result api.GuestExecResult
+	if err := json.Unmarshal(resp.Bytes(), &result); err != nil {
+		return fmt.Errorf("failed to decode response from runner: %w", err)
+	}
+
+	_, _ = os.Stdout.Write(result.Stdout)
+	_, _ = os.Stderr.Write(result.Stderr)
+	if result.Signal != 0 {
+		fmt.Fprintf(os.Stderr, "command terminated by signal %d\n", result.Signal)
+		return exitCodeError{code: 128 + result.Signal}
+	}
+	if result.ExitCode != 0 {
+		return exitCodeError{code: result.ExitCode}
+	}
+	return nil
+}
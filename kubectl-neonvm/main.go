@@ -0,0 +1,272 @@
+// kubectl-neonvm is a kubectl plugin for working with NeonVM virtual machines, without needing to
+// know about their runner pods:
+//
+//	kubectl neonvm port-forward [-n NAMESPACE] VM [LOCAL_PORT:]REMOTE_PORT...
+//	kubectl neonvm exec [-n NAMESPACE] VM -- COMMAND [ARGS...]
+//	kubectl neonvm cp [-n NAMESPACE] VM:PATH LOCAL_PATH
+//
+// port-forward needs the pods/portforward permission on the VM's pod; exec and cp need pods/exec.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	neonvm "github.com/neondatabase/autoscaling/neonvm/client/clientset/versioned"
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, c *client, args []string) error
+}
+
+var commands = map[string]command{
+	"cp": {
+		usage: "cp VM:PATH LOCAL_PATH | cp LOCAL_PATH VM:PATH",
+		run:   runCopy,
+	},
+	"exec": {
+		usage: "exec [-i] [-timeout DURATION] VM -- COMMAND [ARGS...]",
+		run:   runExec,
+	},
+	"port-forward": {
+		usage: "port-forward VM [LOCAL_PORT:]REMOTE_PORT...",
+		run:   runPortForward,
+	},
+}
+
+func main() {
+	flags := flag.NewFlagSet("kubectl-neonvm", flag.ExitOnError)
+	kubeconfig := flags.String("kubeconfig", "", "Path to the kubeconfig file to use")
+	namespace := flags.String("n", "", "Namespace of the VM. Defaults to the namespace of the current context")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: kubectl neonvm [-kubeconfig PATH] [-n NAMESPACE] COMMAND ARGS...\n\nCommands:\n")
+		var names []string
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(flags.Output(), "  %s\n", commands[name].usage)
+		}
+		fmt.Fprintf(flags.Output(), "\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(os.Args[1:]) // ExitOnError
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flags.Arg(0))
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	c, err := newClient(*kubeconfig, *namespace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := cmd.run(ctx, c, flags.Args()[1:]); err != nil {
+		var exitErr exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+type client struct {
+	config     *rest.Config
+	kubeClient kubernetes.Interface
+	vmClient   neonvm.Interface
+	namespace  string
+}
+
+func newClient(kubeconfig string, namespace string) (*client, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{})
+
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	if namespace == "" {
+		namespace, _, err = clientConfig.Namespace()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get namespace from kubeconfig: %w", err)
+		}
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	vmClient, err := neonvm.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create NeonVM client: %w", err)
+	}
+
+	return &client{
+		config:     config,
+		kubeClient: kubeClient,
+		vmClient:   vmClient,
+		namespace:  namespace,
+	}, nil
+}
+
+// runningVM fetches the VM, returning an error if it isn't running.
+//
+// The VM is fetched on every call, so that callers follow the VM to its new pod after a live
+// migration.
+func (c *client) runningVM(ctx context.Context, vmName string) (*vmv1.VirtualMachine, error) {
+	vm, err := c.vmClient.NeonvmV1().VirtualMachines(c.namespace).Get(ctx, vmName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VM: %w", err)
+	}
+	if vm.Status.Phase != vmv1.VmRunning || vm.Status.PodName == "" {
+		return nil, fmt.Errorf("VM %s is not running (phase %q)", vmName, vm.Status.Phase)
+	}
+	return vm, nil
+}
+
+// runnerDebugTunnel opens a port-forward to the debug port of the VM's runner, returning the base
+// URL to reach it on, and a function to close the port-forward.
+//
+// The runner only serves /port_forward on localhost in the pod, so this is the only way to reach
+// it.
+func (c *client) runnerDebugTunnel(ctx context.Context, vmName string) (baseURL string, closeTunnel func(), _ error) {
+	vm, err := c.runningVM(ctx, vmName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(c.config)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create port-forward transport: %w", err)
+	}
+	req := c.kubeClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(c.namespace).
+		Name(vm.Status.PodName).
+		SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	stop := make(chan struct{})
+	ready := make(chan struct{})
+	ports := []string{fmt.Sprintf("0:%d", api.RunnerDebugPort)}
+	fw, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, ports, stop, ready, io.Discard, os.Stderr)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create port-forward: %w", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- fw.ForwardPorts()
+	}()
+	select {
+	case <-ready:
+	case err := <-errChan:
+		return "", nil, fmt.Errorf("failed to port-forward to runner: %w", err)
+	case <-ctx.Done():
+		close(stop)
+		return "", nil, ctx.Err()
+	}
+
+	forwarded, err := fw.GetPorts()
+	if err != nil || len(forwarded) != 1 {
+		close(stop)
+		return "", nil, fmt.Errorf("failed to get forwarded port: %w", err)
+	}
+	return fmt.Sprintf("http://127.0.0.1:%d", forwarded[0].Local), func() { close(stop) }, nil
+}
+
+// runnerGuestRequest sends a request to the endpoint at path on the runner's guest socket (see
+// api.RunnerGuestSocket), writing the response body to out.
+//
+// The socket is only reachable from inside the runner container, so this runs the runner's
+// guest-request command there, through the pods/exec subresource. body may be nil, if the request
+// doesn't have one.
+func (c *client) runnerGuestRequest(
+	ctx context.Context,
+	vmName string,
+	method string,
+	path string,
+	body io.Reader,
+	out io.Writer,
+) error {
+	vm, err := c.runningVM(ctx, vmName)
+	if err != nil {
+		return err
+	}
+
+	req := c.kubeClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(c.namespace).
+		Name(vm.Status.PodName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: runnerContainerName,
+			Command:   []string{"runner", api.RunnerGuestRequestCommand, method, path},
+			Stdin:     body != nil,
+			Stdout:    true,
+			Stderr:    true,
+			TTY:       false,
+		}, scheme.ParameterCodec)
+	executor, err := remotecommand.NewSPDYExecutor(c.config, http.MethodPost, req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create exec transport: %w", err)
+	}
+
+	var stderr bytes.Buffer
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:             body,
+		Stdout:            out,
+		Stderr:            &stderr,
+		Tty:               false,
+		TerminalSizeQueue: nil,
+	})
+	if err != nil {
+		// guest-request writes the reason it failed to stderr
+		if msg := bytes.TrimSpace(stderr.Bytes()); len(msg) != 0 {
+			return fmt.Errorf("%s", msg)
+		}
+		return fmt.Errorf("failed to run request in runner container: %w", err)
+	}
+	return nil
+}
+
+// runnerContainerName is the name of the container running the runner in VM pods.
+const runnerContainerName = "neonvm-runner"
+
+var errUsage = errors.New("invalid arguments")
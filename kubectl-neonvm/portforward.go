@@ -0,0 +1,137 @@
+package main
+
+// 'kubectl neonvm port-forward' forwards local ports to ports in the guest, via the runner's
+// /port_forward websocket endpoint.
+//
+// Each connection gets its own port-forward to the runner pod, so that new connections go to the
+// VM's new pod after a live migration.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"nhooyr.io/websocket"
+)
+
+type portMapping struct {
+	local  int
+	remote int
+}
+
+func parsePortMapping(arg string) (portMapping, error) {
+	local, remote, found := strings.Cut(arg, ":")
+	if !found {
+		remote = local
+	}
+	localPort, err := strconv.ParseUint(local, 10, 16)
+	if err != nil {
+		return portMapping{}, fmt.Errorf("invalid local port %q", local)
+	}
+	remotePort, err := strconv.ParseUint(remote, 10, 16)
+	if err != nil || remotePort == 0 {
+		return portMapping{}, fmt.Errorf("invalid remote port %q", remote)
+	}
+	return portMapping{local: int(localPort), remote: int(remotePort)}, nil
+}
+
+func runPortForward(ctx context.Context, c *client, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("%w: expected VM name and at least one port", errUsage)
+	}
+	vmName := args[0]
+
+	var mappings []portMapping
+	for _, arg := range args[1:] {
+		m, err := parsePortMapping(arg)
+		if err != nil {
+			return err
+		}
+		mappings = append(mappings, m)
+	}
+
+	var listeners []net.Listener
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	for _, m := range mappings {
+		l, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(m.local)))
+		if err != nil {
+			return fmt.Errorf("failed to listen on port %d: %w", m.local, err)
+		}
+		listeners = append(listeners, l)
+		fmt.Printf("Forwarding from %s -> %d\n", l.Addr(), m.remote)
+	}
+
+	var wg sync.WaitGroup
+	for i, l := range listeners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			acceptLoop(ctx, c, vmName, l, mappings[i].remote)
+		}()
+	}
+
+	<-ctx.Done()
+	for _, l := range listeners {
+		l.Close()
+	}
+	wg.Wait()
+	return nil
+}
+
+func acceptLoop(ctx context.Context, c *client, vmName string, l net.Listener, remotePort int) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				fmt.Printf("error accepting connection: %s\n", err)
+			}
+			return
+		}
+		go func() {
+			defer conn.Close()
+			if err := forwardConn(ctx, c, vmName, conn, remotePort); err != nil {
+				fmt.Printf("error forwarding connection to port %d: %s\n", remotePort, err)
+			}
+		}()
+	}
+}
+
+func forwardConn(ctx context.Context, c *client, vmName string, conn net.Conn, remotePort int) error {
+	baseURL, closeTunnel, err := c.runnerDebugTunnel(ctx, vmName)
+	if err != nil {
+		return err
+	}
+	defer closeTunnel()
+
+	u := baseURL + "/port_forward?" + url.Values{"port": []string{strconv.Itoa(remotePort)}}.Encode()
+	ws, _, err := websocket.Dial(ctx, u, nil) //nolint:bodyclose // the response body is owned by the websocket
+	if err != nil {
+		return fmt.Errorf("failed to connect to runner: %w", err)
+	}
+	defer ws.Close(websocket.StatusInternalError, "") //nolint:errcheck // nothing to do with error when deferred
+
+	wsConn := websocket.NetConn(ctx, ws, websocket.MessageBinary)
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(wsConn, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(conn, wsConn)
+		done <- struct{}{}
+	}()
+	<-done
+
+	ws.Close(websocket.StatusNormalClosure, "") //nolint:errcheck // connection is done either way
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tychoish/fun/srv"
+)
+
+// debugAuthConfig is the authentication required by the pprof and debug servers.
+//
+// If nothing is set, the servers are open to anyone who can reach them. This is the only auth for
+// the controller's pprof server; util.PPROFConfig's basic auth isn't used, so that both servers are
+// always secured the same way.
+type debugAuthConfig struct {
+	// TokenFile is the path to a file containing the bearer token that requests must have in their
+	// Authorization header
+	TokenFile string
+
+	// TLSCertFile and TLSKeyFile are the server's certificate and key. If set, the servers use
+	// HTTPS.
+	TLSCertFile string
+	TLSKeyFile  string
+	// ClientCAFile is the CA bundle that client certificates must be signed by. If set, clients
+	// must present a valid certificate. Requires TLSCertFile and TLSKeyFile.
+	ClientCAFile string
+}
+
+func (c debugAuthConfig) useTLS() bool {
+	return c.TLSCertFile != ""
+}
+
+// secure wraps the server's handler to check the bearer token, and sets up its TLS config,
+// according to the auth config.
+func (c debugAuthConfig) secure(server *http.Server) error {
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("TLS certificate and key must be set together")
+	}
+	if c.ClientCAFile != "" && !c.useTLS() {
+		return errors.New("client CA requires a TLS certificate and key")
+	}
+
+	if c.TokenFile != "" {
+		content, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read token file: %w", err)
+		}
+		token := strings.TrimSpace(string(content))
+		if token == "" {
+			return fmt.Errorf("token file %q is empty", c.TokenFile)
+		}
+		server.Handler = requireBearerToken(token, server.Handler)
+	}
+
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA file %q", c.ClientCAFile)
+		}
+		server.TLSConfig = &tls.Config{ //nolint:exhaustruct // only the client auth is customized
+			MinVersion: tls.VersionTLS12,
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  pool,
+		}
+	}
+
+	return nil
+}
+
+func requireBearerToken(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c debugAuthConfig) listenAndServe(server *http.Server) error {
+	if c.useTLS() {
+		return server.ListenAndServeTLS(c.TLSCertFile, c.TLSKeyFile)
+	}
+	return server.ListenAndServe()
+}
+
+// debugService is like srv.HTTP, but serves with the auth config.
+func debugService(name string, server *http.Server, auth debugAuthConfig) *srv.Service {
+	return &srv.Service{
+		Name: name,
+		Run: func(ctx context.Context) error {
+			if server.BaseContext == nil {
+				server.BaseContext = func(net.Listener) context.Context { return ctx }
+			}
+
+			if err := auth.listenAndServe(server); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		},
+		Shutdown: func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			return server.Shutdown(ctx)
+		},
+		Cleanup: nil,
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+func TestRequireBearerToken(t *testing.T) {
+	handler := requireBearerToken("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	cases := []struct {
+		name          string
+		authorization string
+		expected      int
+	}{
+		{"NoHeader", "", http.StatusUnauthorized},
+		{"WrongToken", "Bearer wrong", http.StatusUnauthorized},
+		{"TokenPrefix", "Bearer secre", http.StatusUnauthorized},
+		{"MissingScheme", "secret", http.StatusUnauthorized},
+		{"BasicAuth", "Basic c2VjcmV0", http.StatusUnauthorized},
+		{"ValidToken", "Bearer secret", http.StatusOK},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if c.authorization != "" {
+				req.Header.Set("Authorization", c.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, c.expected, rec.Code)
+			if c.expected == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestDebugAuthSecure(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	tokenFile := writeFile("token", "secret\n")
+	emptyTokenFile := writeFile("empty-token", " \n")
+	invalidCAFile := writeFile("invalid-ca.pem", "not a certificate")
+
+	// Any valid certificate will do for the client CA
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer tlsServer.Close()
+	caFile := writeFile("ca.pem", string(pem.EncodeToMemory(&pem.Block{
+		Type:    "CERTIFICATE",
+		Headers: nil,
+		Bytes:   tlsServer.Certificate().Raw,
+	})))
+
+	t.Run("Invalid", func(t *testing.T) {
+		cases := []struct {
+			name     string
+			config   debugAuthConfig
+			expected string
+		}{
+			{
+				name:     "CertWithoutKey",
+				config:   debugAuthConfig{TokenFile: "", TLSCertFile: "tls.crt", TLSKeyFile: "", ClientCAFile: ""},
+				expected: "TLS certificate and key must be set together",
+			},
+			{
+				name:     "KeyWithoutCert",
+				config:   debugAuthConfig{TokenFile: "", TLSCertFile: "", TLSKeyFile: "tls.key", ClientCAFile: ""},
+				expected: "TLS certificate and key must be set together",
+			},
+			{
+				name:     "ClientCAWithoutTLS",
+				config:   debugAuthConfig{TokenFile: "", TLSCertFile: "", TLSKeyFile: "", ClientCAFile: caFile},
+				expected: "client CA requires a TLS certificate and key",
+			},
+			{
+				name:     "MissingTokenFile",
+				config:   debugAuthConfig{TokenFile: filepath.Join(dir, "missing"), TLSCertFile: "", TLSKeyFile: "", ClientCAFile: ""},
+				expected: "failed to read token file",
+			},
+			{
+				name:     "EmptyTokenFile",
+				config:   debugAuthConfig{TokenFile: emptyTokenFile, TLSCertFile: "", TLSKeyFile: "", ClientCAFile: ""},
+				expected: "is empty",
+			},
+			{
+				name: "InvalidClientCA",
+				config: debugAuthConfig{
+					TokenFile: "", TLSCertFile: "tls.crt", TLSKeyFile: "tls.key", ClientCAFile: invalidCAFile,
+				},
+				expected: "no certificates found in client CA file",
+			},
+		}
+
+		for _, c := range cases {
+			t.Run(c.name, func(t *testing.T) {
+				server := &http.Server{Handler: http.NotFoundHandler()}
+				assert.ErrorContains(t, c.config.secure(server), c.expected)
+			})
+		}
+	})
+
+	t.Run("NoAuth", func(t *testing.T) {
+		handler := http.NotFoundHandler()
+		server := &http.Server{Handler: handler}
+		config := debugAuthConfig{TokenFile: "", TLSCertFile: "", TLSKeyFile: "", ClientCAFile: ""}
+		require.NoError(t, config.secure(server))
+		assert.Nil(t, server.TLSConfig)
+		assert.False(t, config.useTLS())
+	})
+
+	t.Run("ClientCA", func(t *testing.T) {
+		server := &http.Server{Handler: http.NotFoundHandler()}
+		config := debugAuthConfig{TokenFile: "", TLSCertFile: "tls.crt", TLSKeyFile: "tls.key", ClientCAFile: caFile}
+		require.NoError(t, config.secure(server))
+		require.NotNil(t, server.TLSConfig)
+		assert.NotNil(t, server.TLSConfig.ClientCAs)
+		assert.True(t, config.useTLS())
+	})
+
+	// The pprof server is secured the same way as the debug server
+	t.Run("PPROFToken", func(t *testing.T) {
+		server, err := util.MakePPROF(util.DefaultPPROFConfig())
+		require.NoError(t, err)
+		config := debugAuthConfig{TokenFile: tokenFile, TLSCertFile: "", TLSKeyFile: "", ClientCAFile: ""}
+		require.NoError(t, config.secure(server))
+
+		ts := httptest.NewServer(server.Handler)
+		defer ts.Close()
+
+		get := func(authorization string) int {
+			req, err := http.NewRequest("GET", ts.URL+"/debug/pprof/", nil)
+			require.NoError(t, err)
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		assert.Equal(t, http.StatusUnauthorized, get(""))
+		assert.Equal(t, http.StatusUnauthorized, get("Bearer wrong"))
+		// The trailing newline in the token file isn't part of the token
+		assert.Equal(t, http.StatusOK, get("Bearer secret"))
+	})
+}
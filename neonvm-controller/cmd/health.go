@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+// addReadyzChecks adds the checks that the controller must pass to be considered ready: that the
+// API server is reachable, the webhook server is serving, and the informer caches are synced.
+func addReadyzChecks(mgr manager.Manager) error {
+	clientset, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return fmt.Errorf("failed to create clientset: %w", err)
+	}
+	apiCheck := util.APIServerHealthCheck(clientset)
+
+	checks := map[string]healthz.Checker{
+		apiCheck.Name: func(req *http.Request) error {
+			return apiCheck.Check(req.Context())
+		},
+		"webhook": mgr.GetWebhookServer().StartedChecker(),
+		"informer-caches": func(req *http.Request) error {
+			ctx, cancel := context.WithTimeout(req.Context(), time.Second)
+			defer cancel()
+			if !mgr.GetCache().WaitForCacheSync(ctx) {
+				return errors.New("informer caches are not synced")
+			}
+			return nil
+		},
+	}
+	for name, check := range checks {
+		if err := mgr.AddReadyzCheck(name, check); err != nil {
+			return fmt.Errorf("failed to add %s check: %w", name, err)
+		}
+	}
+	return nil
+}
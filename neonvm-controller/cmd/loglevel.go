@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Components with separately adjustable log levels
+const (
+	componentController = "controller"
+	componentWebhook    = "webhook"
+	componentQMP        = "qmp"
+)
+
+var logComponents = []string{componentController, componentWebhook, componentQMP}
+
+// componentOf returns the component that a logger belongs to, based on its name.
+//
+// Loggers from controller-runtime's webhook server are named "admission", "webhook", or
+// "conversion-webhook", and our QMP logs are named "qmp". Everything else is the controller.
+func componentOf(loggerName string) string {
+	for _, part := range strings.Split(loggerName, ".") {
+		switch part {
+		case "admission", "webhook", "conversion-webhook":
+			return componentWebhook
+		case "qmp":
+			return componentQMP
+		}
+	}
+	return componentController
+}
+
+// logLevels stores the log level of each component, which can be changed at runtime via the debug
+// server.
+type logLevels struct {
+	levels map[string]zap.AtomicLevel
+}
+
+// parseLogLevels parses the value of the -log-level flag, which is a comma-separated list of
+// either plain levels (e.g. "info"), which apply to all components, or component=level pairs (e.g.
+// "qmp=debug"). Later entries take precedence.
+func parseLogLevels(flagValue string) (*logLevels, error) {
+	l := &logLevels{levels: make(map[string]zap.AtomicLevel)}
+	for _, c := range logComponents {
+		l.levels[c] = zap.NewAtomicLevelAt(zap.InfoLevel)
+	}
+
+	for _, entry := range strings.Split(flagValue, ",") {
+		component, level, hasComponent := strings.Cut(strings.TrimSpace(entry), "=")
+		if !hasComponent {
+			level = component
+			component = ""
+		}
+		if err := l.set(component, level); err != nil {
+			return nil, fmt.Errorf("invalid log level %q: %w", entry, err)
+		}
+	}
+	return l, nil
+}
+
+// set sets the level of the component, or of all components if component is empty.
+func (l *logLevels) set(component string, level string) error {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	if component == "" {
+		for _, c := range logComponents {
+			l.levels[c].SetLevel(lvl)
+		}
+		return nil
+	}
+
+	atomic, ok := l.levels[component]
+	if !ok {
+		return fmt.Errorf("unknown component %q, must be one of %v", component, logComponents)
+	}
+	atomic.SetLevel(lvl)
+	return nil
+}
+
+func (l *logLevels) current() map[string]string {
+	levels := make(map[string]string)
+	for c, lvl := range l.levels {
+		levels[c] = lvl.Level().String()
+	}
+	return levels
+}
+
+// wrapCore returns a zap option making the logger filter log entries by their component's level.
+//
+// The base logger must be built with the lowest possible level, so that it doesn't filter out
+// anything itself.
+func (l *logLevels) wrapCore() zap.Option {
+	return zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return componentCore{Core: core, levels: l}
+	})
+}
+
+// lowestLogLevel is the level the base logger must be built with, for use with logLevels.
+const lowestLogLevel = zapcore.Level(math.MinInt8)
+
+type componentCore struct {
+	zapcore.Core
+	levels *logLevels
+}
+
+func (c componentCore) Enabled(lvl zapcore.Level) bool {
+	// We don't know the logger's name here, so this must be true if any component could log it.
+	return slices.ContainsFunc(logComponents, func(component string) bool {
+		return c.levels.levels[component].Enabled(lvl)
+	})
+}
+
+func (c componentCore) With(fields []zapcore.Field) zapcore.Core {
+	return componentCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c componentCore) Check(entry zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levels.levels[componentOf(entry.LoggerName)].Enabled(entry.Level) {
+		return ce
+	}
+	return c.Core.Check(entry, ce)
+}
+
+type setLogLevelRequest struct {
+	// Component is the component to set the level of. All components if empty.
+	Component string `json:"component"`
+	Level     string `json:"level"`
+}
+
+// ServeHTTP implements the /log-level endpoint. GET returns the level of each component, and PUT
+// with a setLogLevelRequest body changes one of them.
+func (l *logLevels) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req setLogLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("failed to parse request body: %s", err)))
+			return
+		}
+		if err := l.set(req.Component, req.Level); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(fmt.Sprintf("failed to set log level: %s", err)))
+			return
+		}
+		setupLog.Info("Changed log level", "component", req.Component, "level", req.Level)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		_, _ = w.Write([]byte(fmt.Sprintf("request method must be %s or %s", http.MethodGet, http.MethodPut)))
+		return
+	}
+
+	responseBody, err := json.Marshal(l.current())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(fmt.Sprintf("failed to marshal JSON response: %s", err)))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(responseBody)
+}
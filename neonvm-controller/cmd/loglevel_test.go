@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestParseLogLevels(t *testing.T) {
+	cases := []struct {
+		flag     string
+		expected map[string]string
+	}{
+		{
+			flag:     "info",
+			expected: map[string]string{"controller": "info", "webhook": "info", "qmp": "info"},
+		},
+		{
+			flag:     "debug",
+			expected: map[string]string{"controller": "debug", "webhook": "debug", "qmp": "debug"},
+		},
+		{
+			flag:     "info,qmp=debug",
+			expected: map[string]string{"controller": "info", "webhook": "info", "qmp": "debug"},
+		},
+		{
+			flag:     " webhook=warn , qmp=debug ",
+			expected: map[string]string{"controller": "info", "webhook": "warn", "qmp": "debug"},
+		},
+		// Later entries take precedence
+		{
+			flag:     "qmp=debug,error",
+			expected: map[string]string{"controller": "error", "webhook": "error", "qmp": "error"},
+		},
+		{
+			flag:     "error,qmp=debug,qmp=warn",
+			expected: map[string]string{"controller": "error", "webhook": "error", "qmp": "warn"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.flag, func(t *testing.T) {
+			levels, err := parseLogLevels(c.flag)
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, levels.current())
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := parseLogLevels("info,qmp=loud")
+		assert.ErrorContains(t, err, `invalid log level "qmp=loud"`)
+
+		_, err = parseLogLevels("scheduler=debug")
+		assert.ErrorContains(t, err, `unknown component "scheduler"`)
+	})
+}
+
+func TestComponentOf(t *testing.T) {
+	cases := []struct {
+		loggerName string
+		expected   string
+	}{
+		{"", componentController},
+		{"setup", componentController},
+		{"controller-runtime.source", componentController},
+		// controller-runtime's webhook server and handlers
+		{"admission", componentWebhook},
+		{"controller-runtime.webhook", componentWebhook},
+		{"controller-runtime.webhook.webhooks", componentWebhook},
+		{"conversion-webhook", componentWebhook},
+		// our QMP logs, which may be under a named logger
+		{"qmp", componentQMP},
+		{"virtualmachine.qmp", componentQMP},
+		// only whole parts of the name count
+		{"qmpx", componentController},
+		{"webhooks", componentController},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, componentOf(c.loggerName), "logger %q", c.loggerName)
+	}
+}
+
+// newObservedLogger returns a logger built like the controller's, and the entries that get past its
+// log levels.
+func newObservedLogger(t *testing.T, flag string) (*logLevels, logr.Logger, *observer.ObservedLogs) {
+	levels, err := parseLogLevels(flag)
+	require.NoError(t, err)
+
+	core, logs := observer.New(lowestLogLevel)
+	return levels, zapr.NewLogger(zap.New(core, levels.wrapCore())), logs
+}
+
+// logEachComponent logs a message at debug and info level with a logger named as each component's
+// loggers are.
+func logEachComponent(logger logr.Logger) {
+	for _, l := range []logr.Logger{
+		logger,
+		logger.WithName("qmp"),       // pkg/neonvm/controllers
+		logger.WithName("admission"), // controller-runtime's admission webhooks
+		logger.WithName("controller-runtime").WithName("webhook"),
+	} {
+		l.V(1).Info("debug")
+		l.Info("info")
+	}
+}
+
+// loggedEntries returns the logged entries as "<logger name>: <message>", and clears them.
+func loggedEntries(logs *observer.ObservedLogs) []string {
+	var entries []string
+	for _, e := range logs.TakeAll() {
+		entries = append(entries, e.LoggerName+": "+e.Message)
+	}
+	return entries
+}
+
+func TestComponentCore(t *testing.T) {
+	t.Run("Info", func(t *testing.T) {
+		_, logger, logs := newObservedLogger(t, "info")
+		logEachComponent(logger)
+		assert.Equal(t, []string{
+			": info",
+			"qmp: info",
+			"admission: info",
+			"controller-runtime.webhook: info",
+		}, loggedEntries(logs))
+	})
+
+	t.Run("QMPDebug", func(t *testing.T) {
+		_, logger, logs := newObservedLogger(t, "info,qmp=debug")
+		logEachComponent(logger)
+		assert.Equal(t, []string{
+			": info",
+			"qmp: debug",
+			"qmp: info",
+			"admission: info",
+			"controller-runtime.webhook: info",
+		}, loggedEntries(logs))
+	})
+
+	t.Run("WebhookDebug", func(t *testing.T) {
+		_, logger, logs := newObservedLogger(t, "webhook=debug")
+		logEachComponent(logger)
+		assert.Equal(t, []string{
+			": info",
+			"qmp: info",
+			"admission: debug",
+			"admission: info",
+			"controller-runtime.webhook: debug",
+			"controller-runtime.webhook: info",
+		}, loggedEntries(logs))
+	})
+
+	t.Run("ControllerError", func(t *testing.T) {
+		_, logger, logs := newObservedLogger(t, "controller=error")
+		logEachComponent(logger)
+		logger.Error(nil, "error")
+		assert.Equal(t, []string{
+			"qmp: info",
+			"admission: info",
+			"controller-runtime.webhook: info",
+			": error",
+		}, loggedEntries(logs))
+	})
+
+	// Fields added to a logger don't remove the filtering
+	t.Run("WithValues", func(t *testing.T) {
+		_, logger, logs := newObservedLogger(t, "info,qmp=debug")
+		logEachComponent(logger.WithValues("key", "value"))
+		assert.Len(t, loggedEntries(logs), 5)
+	})
+}
+
+func TestLogLevelsServeHTTP(t *testing.T) {
+	levels, logger, logs := newObservedLogger(t, "info")
+
+	call := func(method string, body string) (int, string) {
+		rec := httptest.NewRecorder()
+		levels.ServeHTTP(rec, httptest.NewRequest(method, "/log-level", strings.NewReader(body)))
+		return rec.Code, rec.Body.String()
+	}
+	current := func(body string) map[string]string {
+		var levels map[string]string
+		require.NoError(t, json.Unmarshal([]byte(body), &levels))
+		return levels
+	}
+
+	code, body := call("GET", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]string{"controller": "info", "webhook": "info", "qmp": "info"}, current(body))
+
+	logger.WithName("qmp").V(1).Info("debug")
+	assert.Empty(t, loggedEntries(logs))
+
+	// Changing a component's level applies to existing loggers
+	code, body = call("PUT", `{"component":"qmp","level":"debug"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]string{"controller": "info", "webhook": "info", "qmp": "debug"}, current(body))
+
+	logEachComponent(logger)
+	assert.Equal(t, []string{
+		": info",
+		"qmp: debug",
+		"qmp: info",
+		"admission: info",
+		"controller-runtime.webhook: info",
+	}, loggedEntries(logs))
+
+	// Without a component, all are changed
+	code, body = call("PUT", `{"level":"error"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]string{"controller": "error", "webhook": "error", "qmp": "error"}, current(body))
+
+	logEachComponent(logger)
+	assert.Empty(t, loggedEntries(logs))
+
+	t.Run("Invalid", func(t *testing.T) {
+		code, body := call("PUT", `not json`)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Contains(t, body, "failed to parse request body")
+
+		code, body = call("PUT", `{"component":"scheduler","level":"debug"}`)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Contains(t, body, `unknown component "scheduler"`)
+
+		code, body = call("PUT", `{"component":"qmp","level":"loud"}`)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Contains(t, body, "failed to set log level")
+
+		code, _ = call("POST", `{"level":"debug"}`)
+		assert.Equal(t, http.StatusMethodNotAllowed, code)
+
+		// None of the invalid requests changed anything
+		_, body = call("GET", "")
+		assert.Equal(t, map[string]string{"controller": "error", "webhook": "error", "qmp": "error"}, current(body))
+	})
+}
@@ -40,6 +40,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -50,6 +51,7 @@ import (
 	"k8s.io/klog/v2"
 
 	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
 	"github.com/neondatabase/autoscaling/pkg/neonvm/controllers"
 	"github.com/neondatabase/autoscaling/pkg/neonvm/ipam"
 	"github.com/neondatabase/autoscaling/pkg/util"
@@ -60,6 +62,10 @@ var (
 	setupLog = ctrl.Log.WithName("setup")
 )
 
+// defaultKernelArgsDenylist is the default for -kernel-args-denylist: the kernel parameters that
+// neonvm-runner sets itself, or that the guest's init depends on.
+const defaultKernelArgsDenylist = "init,rdinit,root,rootfstype,ro,rw,panic,console,loglevel,hostname,ip,acpi,maxcpus,clocksource,zswap.*,memhp_*,memory_hotplug.*,neonvm.*"
+
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
@@ -68,7 +74,13 @@ func init() {
 	//+kubebuilder:scaffold:scheme
 }
 
-func run(mgr manager.Manager) error {
+func run(
+	mgr manager.Manager,
+	zapLogger *zap.Logger,
+	pprofConfig util.PPROFConfig,
+	debugAuth debugAuthConfig,
+	profiling *util.ProfilingConfig,
+) error {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 	ctx = srv.SetShutdownSignal(ctx)
@@ -80,9 +92,21 @@ func run(mgr manager.Manager) error {
 		setupLog.Info("main loop returned, exiting")
 	}()
 
-	if err := orca.Add(srv.HTTP("pprof", time.Second, util.MakePPROF("0.0.0.0:7777"))); err != nil {
+	pprofServer, err := util.MakePPROF(pprofConfig)
+	if err != nil {
+		return fmt.Errorf("failed to set up pprof server: %w", err)
+	}
+	if err := debugAuth.secure(pprofServer); err != nil {
+		return fmt.Errorf("failed to set up pprof auth: %w", err)
+	}
+	if err := orca.Add(debugService("pprof", pprofServer, debugAuth)); err != nil {
 		return fmt.Errorf("failed to add pprof service: %w", err)
 	}
+	if profiling != nil {
+		if err := orca.Add(util.ProfilePusher(zapLogger, *profiling)); err != nil {
+			return fmt.Errorf("failed to add profile pusher service: %w", err)
+		}
+	}
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctx); err != nil {
@@ -97,20 +121,64 @@ func main() {
 	var enableLeaderElection bool
 	var probeAddr string
 	var concurrencyLimit int
+	var ipamMigrateLegacyAllocations bool
 	var skipUpdateValidationFor map[types.NamespacedName]struct{}
 	var disableRunnerCgroup bool
 	var defaultCpuScalingMode vmv1.CpuScalingMode
+	var defaultRuntimeClassName string
 	var qemuDiskCacheSettings string
 	var memhpAutoMovableRatio string
 	var failurePendingPeriod time.Duration
 	var failingRefreshInterval time.Duration
+	var slowReconcileThreshold time.Duration
+	var qmpRetryRateLimit util.RateLimitConfig
 	var atMostOnePod bool
+	var enableImagePrePull bool
+	var restartMaxUnavailable int
+	var restartRolloutInterval time.Duration
+	podDriftPolicy := controllers.PodDriftPolicyReport
+	var propagatedLabels []string
+	var propagatedAnnotations []string
+	var haAntiAffinityLabel string
+	haAntiAffinityTopologyKeys := []string{"kubernetes.io/hostname"}
+	var haAntiAffinityRequired bool
+	var nestedVirtNodeLabel string
+	var cpuFeatureNodeLabelPrefix string
+	virtioMemBlockSize := resource.MustParse("8Mi")
+	var oomMemoryBumpSlots uint
+	var oomMemoryBumpDuration time.Duration
+	var imageRollbackDeadline time.Duration
+	var nodeTuningProfileDir string
+	var qemuExtraArgsAllowlist []string
+	var kernelArgsAllowlist []string
+	var kernelArgsDenylist []string
+	var resumePoolDir string
+	migrationMaxBandwidth := resource.MustParse("1Gi")
+	var migrationMaxDowntime time.Duration
+	var migrationCPUModelLabel string
+	var schedulerPluginAddr string
+	var computeUnitResource *api.Resources
+	var otlpTracesEndpoint string
+	pprofConfig := util.DefaultPPROFConfig()
+	var debugAddr string
+	var debugAuth debugAuthConfig
+	var logLevel string
+	profiling := util.ProfilingConfig{
+		ServerURL:             "",
+		ApplicationName:       "",
+		Tags:                  nil,
+		UploadIntervalSeconds: 0,
+		CPUSampleRate:         0,
+	}
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.IntVar(&concurrencyLimit, "concurrency-limit", 1, "Maximum number of concurrent reconcile operations")
+	flag.BoolVar(&ipamMigrateLegacyAllocations, "ipam-migrate-legacy-allocations", false,
+		"Migrate IP allocations stored in IPPools by older versions of the controller to IPAllocation objects. "+
+			"This is one-way: older versions can't see the migrated allocations, so must not be rolled back to afterwards")
 	flag.Func(
 		"skip-update-validation-for",
 		"Comma-separated list of object names to skip webhook validation, like 'foo' or 'default/bar'",
@@ -138,6 +206,7 @@ func main() {
 		},
 	)
 	flag.Func("default-cpu-scaling-mode", "Set default cpu scaling mode to use for new VMs", defaultCpuScalingMode.FlagFunc)
+	flag.StringVar(&defaultRuntimeClassName, "default-runtime-class-name", "", "Set default RuntimeClass to use for runner pods of VMs that don't set one")
 	flag.BoolVar(&disableRunnerCgroup, "disable-runner-cgroup", false, "Disable creation of a cgroup in neonvm-runner for fractional CPU limiting")
 	flag.StringVar(&qemuDiskCacheSettings, "qemu-disk-cache-settings", "cache=none", "Set neonvm-runner's QEMU disk cache settings")
 	flag.StringVar(&memhpAutoMovableRatio, "memhp-auto-movable-ratio", "301", "For virtio-mem, set VM kernel's memory_hotplug.auto_movable_ratio")
@@ -145,21 +214,245 @@ func main() {
 		"the period for the propagation of reconciliation failures to the observability instruments")
 	flag.DurationVar(&failingRefreshInterval, "failing-refresh-interval", 1*time.Minute,
 		"the interval between consecutive updates of metrics and logs, related to failing reconciliations")
+	flag.DurationVar(&slowReconcileThreshold, "slow-reconcile-threshold", 10*time.Second,
+		"reconciles taking longer than this are logged with a breakdown of where the time went. 0 disables this")
+	flag.Float64Var(&qmpRetryRateLimit.Rate, "qmp-retry-rate-limit", 0,
+		"Maximum rate, per second and per controller, of retrying reconciles that failed because QMP was unreachable. 0 disables this")
+	flag.UintVar(&qmpRetryRateLimit.Burst, "qmp-retry-burst", 10,
+		"Number of retries after QMP was unreachable allowed at once before qmp-retry-rate-limit applies")
 	flag.BoolVar(&atMostOnePod, "at-most-one-pod", false,
 		"If true, the controller will ensure that at most one pod is running at a time. "+
 			"Otherwise, the outdated pod might be left to terminate, while the new one is already running.")
+	flag.BoolVar(&enableImagePrePull, "enable-image-prepull", false,
+		"If true, run the controller that pre-pulls the images from VirtualMachineImage objects to nodes")
+	flag.IntVar(&restartMaxUnavailable, "restart-max-unavailable", 0,
+		"Maximum number of VMs restarted at once to apply spec changes that require a restart. "+
+			"If 0, those VMs are only marked RestartPending, and not restarted")
+	flag.DurationVar(&restartRolloutInterval, "restart-rollout-interval", 30*time.Second,
+		"How often to check for RestartPending VMs that can be restarted")
+	flag.Func("pod-drift-policy",
+		"What to do with VMs whose runner pod differs from what would be created now: 'report' (default), "+
+			"or 'recreate' to restart them with the restart rollout",
+		podDriftPolicy.FlagFunc)
+	propagatedKeysFlag := func(name string, keys *[]string) {
+		flag.Func(
+			name,
+			"Comma-separated list of keys to copy from VMs to their runner pods and keep in sync, where entries ending in '*' "+
+				"match by prefix. Keys in the neon.tech domains are always included. If not set, all are copied",
+			func(value string) error {
+				*keys = []string{}
+				if value == "" {
+					return nil
+				}
+				*keys = append(*keys, strings.Split(value, ",")...)
+				return nil
+			},
+		)
+	}
+	propagatedKeysFlag("propagated-labels", &propagatedLabels)
+	propagatedKeysFlag("propagated-annotations", &propagatedAnnotations)
+	flag.StringVar(&haAntiAffinityLabel, "ha-anti-affinity-label", "",
+		"VM label whose value identifies replicas of the same compute, e.g. a tenant or endpoint ID. "+
+			"Runner pods of VMs with the same value get anti-affinity to each other, and the label is always propagated to them. "+
+			"Disabled if empty")
+	flag.Func(
+		"ha-anti-affinity-topology-keys",
+		"Comma-separated list of node labels to spread replicas across, for -ha-anti-affinity-label. "+
+			"Defaults to 'kubernetes.io/hostname'",
+		func(value string) error {
+			haAntiAffinityTopologyKeys = nil
+			for _, key := range strings.Split(value, ",") {
+				if key == "" {
+					return errors.New("topology keys must not be empty")
+				}
+				haAntiAffinityTopologyKeys = append(haAntiAffinityTopologyKeys, key)
+			}
+			return nil
+		},
+	)
+	flag.BoolVar(&haAntiAffinityRequired, "ha-anti-affinity-required", false,
+		"If true, the anti-affinity from -ha-anti-affinity-label is required for scheduling, rather than only preferred")
+	flag.StringVar(&nestedVirtNodeLabel, "nested-virtualization-node-label", "vm.neon.tech/nested-virtualization",
+		"Node label that marks nodes supporting nested virtualization, with the value 'true'. "+
+			"VMs with .spec.guest.nestedVirtualization are only scheduled onto these nodes. Not checked if empty")
+	flag.StringVar(&cpuFeatureNodeLabelPrefix, "cpu-feature-node-label-prefix", "feature.node.kubernetes.io/cpu-cpuid.",
+		"Prefix of node labels that mark nodes supporting a CPU feature, with the value 'true', followed by the feature in upper case. "+
+			"VMs with .spec.guest.cpuFeatures.enable are only scheduled onto nodes with all of them. Not checked if empty")
+	flag.Func(
+		"virtio-mem-block-size",
+		"Default virtio-mem block size for VMs that don't set .spec.guest.virtioMemBlockSize (default 8Mi)",
+		func(value string) error {
+			q, err := resource.ParseQuantity(value)
+			if err != nil {
+				return err
+			}
+			if err := vmv1.ValidateVirtioMemBlockSize(q); err != nil {
+				return err
+			}
+			virtioMemBlockSize = q
+			return nil
+		},
+	)
+	flag.UintVar(&oomMemoryBumpSlots, "oom-memory-bump-slots", 0,
+		"Number of memory slots to temporarily raise the minimum memory of OOM-killed VMs by, above their memory at the time. Disabled if zero")
+	flag.DurationVar(&oomMemoryBumpDuration, "oom-memory-bump-duration", time.Hour,
+		"How long the minimum memory stays raised after a VM was OOM-killed, for -oom-memory-bump-slots")
+	flag.DurationVar(&imageRollbackDeadline, "image-rollback-deadline", 10*time.Minute,
+		"How long VMs with .spec.guest.rootDisk.fallbackImage have to become ready after their root disk image changes, before they're rolled back. Disabled if zero")
+	flag.StringVar(&nodeTuningProfileDir, "node-tuning-profile-dir", "",
+		"Directory on each node that may contain a hypervisor tuning profile for neonvm-runner. Disabled if empty")
+	flag.Func(
+		"qemu-extra-args-allowlist",
+		"Comma-separated list of QEMU flags that VMs may set in .spec.guest.extraArgs, like '-d' or '-trace*'",
+		func(value string) error {
+			qemuExtraArgsAllowlist = nil
+			if value == "" {
+				return nil
+			}
+			for _, entry := range strings.Split(value, ",") {
+				if !strings.HasPrefix(entry, "-") {
+					return fmt.Errorf("entry %q must start with '-'", entry)
+				}
+				qemuExtraArgsAllowlist = append(qemuExtraArgsAllowlist, entry)
+			}
+			return nil
+		},
+	)
+	flag.Func(
+		"kernel-args-allowlist",
+		"Comma-separated list of kernel parameters that VMs may set in .spec.guest.kernelArgs, like 'transparent_hugepage' or 'mitigations*'. All parameters are allowed if empty, except those on -kernel-args-denylist",
+		func(value string) error {
+			kernelArgsAllowlist = splitKernelArgsList(value)
+			return nil
+		},
+	)
+	kernelArgsDenylist = splitKernelArgsList(defaultKernelArgsDenylist)
+	flag.Func(
+		"kernel-args-denylist",
+		fmt.Sprintf("Comma-separated list of kernel parameters that VMs may not set in .spec.guest.kernelArgs (default %q)", defaultKernelArgsDenylist),
+		func(value string) error {
+			kernelArgsDenylist = splitKernelArgsList(value)
+			return nil
+		},
+	)
+	flag.StringVar(&resumePoolDir, "resume-pool-dir", "",
+		"Directory on each node to keep memory images for resume pools in. Disabled if empty")
+	flag.Func(
+		"migration-max-bandwidth",
+		"Default maximum bandwidth for live migrations, in bytes per second (default 1Gi)",
+		func(value string) error {
+			q, err := resource.ParseQuantity(value)
+			if err != nil {
+				return err
+			}
+			migrationMaxBandwidth = q
+			return nil
+		},
+	)
+	flag.DurationVar(&migrationMaxDowntime, "migration-max-downtime", 300*time.Millisecond,
+		"Default maximum time a VM may be paused for at the end of a live migration")
+	flag.StringVar(&migrationCPUModelLabel, "migration-cpu-model-label", "feature.node.kubernetes.io/cpu-model.id",
+		"Node label with the node's CPU model. Migrations are restricted to nodes with the same CPU model. Disabled if empty")
+	flag.StringVar(&schedulerPluginAddr, "scheduler-plugin-addr", "",
+		"Base URL of the scheduler plugin, to check for capacity before migrations. Disabled if empty")
+	flag.Func(
+		"compute-unit-resource",
+		"Size of a compute unit, like '250m,1Gi', to request the neon.tech/compute-unit extended resource for runner pods. Disabled if empty",
+		func(value string) error {
+			computeUnitResource = nil
+			if value == "" {
+				return nil
+			}
+			cu, err := api.ParseResources(value)
+			if err != nil {
+				return err
+			}
+			if err := cu.ValidateNonZero(); err != nil {
+				return err
+			}
+			computeUnitResource = &cu
+			return nil
+		},
+	)
+	flag.Func(
+		"compute-unit-file",
+		"JSON file with the size of a compute unit, like '{\"vCPUs\": 0.25, \"mem\": \"1Gi\"}'. Alternative to -compute-unit-resource, for sharing the definition with other components",
+		func(path string) error {
+			computeUnitResource = nil
+			if path == "" {
+				return nil
+			}
+			cu, err := api.ReadComputeUnitFile(path)
+			if err != nil {
+				return err
+			}
+			computeUnitResource = &cu
+			return nil
+		},
+	)
+	flag.StringVar(&otlpTracesEndpoint, "otlp-traces-endpoint", "",
+		"OTLP gRPC endpoint to export reconcile traces to, e.g. http://otel-collector:4317. Disabled if empty")
+	flag.StringVar(&pprofConfig.Addr, "pprof-addr", util.DefaultPPROFAddr, "The address the pprof endpoint binds to.")
+	flag.BoolVar(&pprofConfig.EnableWallClockProfile, "pprof-enable-wall-clock-profile", false,
+		"Serve a wall-clock profile of all goroutines, on- and off-CPU, at /debug/fgprof on the pprof endpoint")
+	flag.StringVar(&debugAddr, "debug-addr", "0.0.0.0:7778", "The address the debug state endpoint binds to.")
+	flag.StringVar(&debugAuth.TokenFile, "debug-token-file", "",
+		"File with a bearer token required for the pprof and debug endpoints. Disabled if empty")
+	flag.StringVar(&debugAuth.TLSCertFile, "debug-tls-cert-file", "",
+		"TLS certificate for the pprof and debug endpoints. Plain HTTP is used if empty")
+	flag.StringVar(&debugAuth.TLSKeyFile, "debug-tls-key-file", "",
+		"TLS key for the pprof and debug endpoints")
+	flag.StringVar(&debugAuth.ClientCAFile, "debug-client-ca-file", "",
+		"CA bundle to verify client certificates for the pprof and debug endpoints against. Client certificates are not required if empty")
+	flag.IntVar(&pprofConfig.MutexProfileFraction, "mutex-profile-fraction", 0,
+		"Report 1 in this many mutex contention events in the mutex profile. Disabled if 0")
+	flag.IntVar(&pprofConfig.BlockProfileRate, "block-profile-rate", 0,
+		"Sample one blocking event per this many nanoseconds blocked in the block profile. Disabled if 0")
+	flag.StringVar(&profiling.ServerURL, "profiling-server-url", "",
+		"Base URL of a Pyroscope-compatible server to continuously push profiles to. Disabled if empty")
+	flag.StringVar(&profiling.ApplicationName, "profiling-app-name", "neonvm-controller",
+		"Application name to push profiles under")
+	flag.UintVar(&profiling.UploadIntervalSeconds, "profiling-upload-interval-seconds", 15,
+		"Duration, in seconds, of each pushed profile")
+	flag.IntVar(&profiling.CPUSampleRate, "profiling-cpu-sample-rate", 0,
+		"Frequency, in Hz, of CPU profile samples for pushed profiles. Go's default of 100 is used if 0")
+	flag.StringVar(&logLevel, "log-level", "info",
+		"Log level, either for all components (e.g. 'info'), or per component (e.g. 'info,qmp=debug'). "+
+			"Components are controller, webhook, and qmp. Can be changed at runtime via the debug server's /log-level endpoint")
 	flag.Parse()
 
+	logLevels, err := parseLogLevels(logLevel)
+	if err != nil {
+		panic(err)
+	}
+
 	logConfig := zap.NewProductionConfig()
 	logConfig.Sampling = nil // Disabling sampling; it's enabled by default for zap's production configs.
-	logConfig.Level.SetLevel(zap.InfoLevel)
+	// Filtering is done per component by logLevels.
+	logConfig.Level.SetLevel(lowestLogLevel)
 	logConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	logger := zapr.NewLogger(zap.Must(logConfig.Build(zap.AddStacktrace(zapcore.PanicLevel))))
+	zapLogger := zap.Must(logConfig.Build(zap.AddStacktrace(zapcore.PanicLevel), logLevels.wrapCore()))
+	logger := zapr.NewLogger(zapLogger)
 
 	ctrl.SetLogger(logger)
 	// define klog settings (used in LeaderElector)
 	klog.SetLogger(logger.V(2))
 
+	if otlpTracesEndpoint != "" {
+		shutdownTracing, err := setupTracing(context.Background(), otlpTracesEndpoint)
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			panic(err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdownTracing(ctx); err != nil {
+				setupLog.Error(err, "failed to flush traces")
+			}
+		}()
+	}
+
 	// tune k8s client for manager
 	cfg := ctrl.GetConfigOrDie()
 	cfg.QPS = 1000
@@ -197,9 +490,49 @@ func main() {
 		MemhpAutoMovableRatio:   memhpAutoMovableRatio,
 		FailurePendingPeriod:    failurePendingPeriod,
 		FailingRefreshInterval:  failingRefreshInterval,
+		SlowReconcileThreshold:  slowReconcileThreshold,
+		QMPRetryRateLimit:       qmpRetryRateLimit,
 		AtMostOnePod:            atMostOnePod,
 		DefaultCPUScalingMode:   defaultCpuScalingMode,
+		DefaultRuntimeClassName: defaultRuntimeClassName,
+		NodeTuningProfileDir:    nodeTuningProfileDir,
+		QEMUExtraArgsAllowlist:  qemuExtraArgsAllowlist,
+		KernelArgsAllowlist:     kernelArgsAllowlist,
+		KernelArgsDenylist:      kernelArgsDenylist,
+		ResumePoolDir:           resumePoolDir,
+		MigrationMaxBandwidth:   migrationMaxBandwidth,
+		MigrationMaxDowntime:    migrationMaxDowntime,
+		MigrationCPUModelLabel:  migrationCPUModelLabel,
+		SchedulerPluginAddr:     schedulerPluginAddr,
+		ComputeUnitResource:     computeUnitResource,
 		NADConfig:               controllers.GetNADConfig(),
+		PodDriftPolicy:          podDriftPolicy,
+		PropagatedLabels:        propagatedLabels,
+		PropagatedAnnotations:   propagatedAnnotations,
+		HAAntiAffinity:          nil,
+		NestedVirtNodeLabel:     nestedVirtNodeLabel,
+		CPUFeatureLabelPrefix:   cpuFeatureNodeLabelPrefix,
+		VirtioMemBlockSize:      virtioMemBlockSize,
+		OOMMemoryBump:           nil,
+		ImageRollback:           nil,
+	}
+	if haAntiAffinityLabel != "" {
+		rc.HAAntiAffinity = &controllers.HAAntiAffinityConfig{
+			Label:        haAntiAffinityLabel,
+			TopologyKeys: haAntiAffinityTopologyKeys,
+			Required:     haAntiAffinityRequired,
+		}
+	}
+	if oomMemoryBumpSlots != 0 {
+		rc.OOMMemoryBump = &controllers.OOMMemoryBumpConfig{
+			Slots:    int32(oomMemoryBumpSlots),
+			Duration: oomMemoryBumpDuration,
+		}
+	}
+	if imageRollbackDeadline != 0 {
+		rc.ImageRollback = &controllers.ImageRollbackConfig{
+			Deadline: imageRollbackDeadline,
+		}
 	}
 
 	ipam, err := ipam.New(ipam.IPAMParams{
@@ -210,6 +543,8 @@ func main() {
 		// at IPAM mutex.
 		ConcurrencyLimit: max(1, concurrencyLimit/4),
 
+		MigrateLegacyAllocations: ipamMigrateLegacyAllocations,
+
 		MetricsReg: metrics.Registry,
 	})
 	if err != nil {
@@ -219,7 +554,7 @@ func main() {
 	defer ipam.Close()
 
 	vmReconciler := &controllers.VMReconciler{
-		Client:   mgr.GetClient(),
+		Client:   controllers.WithTracing(mgr.GetClient()),
 		Scheme:   mgr.GetScheme(),
 		Recorder: mgr.GetEventRecorderFor("virtualmachine-controller"),
 		Config:   rc,
@@ -234,6 +569,7 @@ func main() {
 	vmWebhook := &controllers.VMWebhook{
 		Recorder: mgr.GetEventRecorderFor("virtualmachine-webhook"),
 		Config:   rc,
+		Client:   mgr.GetClient(),
 	}
 	if err := vmWebhook.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create webhook", "webhook", "VirtualMachine")
@@ -241,7 +577,7 @@ func main() {
 	}
 
 	migrationReconciler := &controllers.VirtualMachineMigrationReconciler{
-		Client:   mgr.GetClient(),
+		Client:   controllers.WithTracing(mgr.GetClient()),
 		Scheme:   mgr.GetScheme(),
 		Recorder: mgr.GetEventRecorderFor("virtualmachinemigration-controller"),
 		Config:   rc,
@@ -260,18 +596,82 @@ func main() {
 		setupLog.Error(err, "unable to create webhook", "webhook", "VirtualMachine")
 		panic(err)
 	}
+	scalingPolicyWebhook := &controllers.ScalingPolicyWebhook{
+		Recorder: mgr.GetEventRecorderFor("scalingpolicy-webhook"),
+		Config:   rc,
+	}
+	if err := scalingPolicyWebhook.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "ScalingPolicy")
+		panic(err)
+	}
+	vmClassWebhook := &controllers.VMClassWebhook{
+		Recorder: mgr.GetEventRecorderFor("virtualmachineclass-webhook"),
+		Config:   rc,
+	}
+	if err := vmClassWebhook.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "VirtualMachineClass")
+		panic(err)
+	}
+	poolReconciler := &controllers.VirtualMachinePoolReconciler{
+		Client:   controllers.WithTracing(mgr.GetClient()),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("virtualmachinepool-controller"),
+		Config:   rc,
+		Metrics:  reconcilerMetrics,
+	}
+	poolReconcilerMetrics, err := poolReconciler.SetupWithManager(mgr)
+	if err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "VirtualMachinePool")
+		panic(err)
+	}
+	poolWebhook := &controllers.VMPoolWebhook{
+		Recorder: mgr.GetEventRecorderFor("virtualmachinepool-webhook"),
+		Config:   rc,
+	}
+	if err := poolWebhook.SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create webhook", "webhook", "VirtualMachinePool")
+		panic(err)
+	}
+	reconcilers := []controllers.ReconcilerWithMetrics{vmReconcilerMetrics, migrationReconcilerMetrics, poolReconcilerMetrics}
+	if enableImagePrePull {
+		imageReconciler := &controllers.VirtualMachineImageReconciler{
+			Client:   controllers.WithTracing(mgr.GetClient()),
+			Scheme:   mgr.GetScheme(),
+			Recorder: mgr.GetEventRecorderFor("virtualmachineimage-controller"),
+			Config:   rc,
+			Metrics:  reconcilerMetrics,
+		}
+		imageReconcilerMetrics, err := imageReconciler.SetupWithManager(mgr)
+		if err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "VirtualMachineImage")
+			panic(err)
+		}
+		reconcilers = append(reconcilers, imageReconcilerMetrics)
+	}
+	if restartMaxUnavailable > 0 {
+		restartRollout := &controllers.RestartRollout{
+			Client:         mgr.GetClient(),
+			Recorder:       mgr.GetEventRecorderFor("virtualmachine-restart-rollout"),
+			MaxUnavailable: restartMaxUnavailable,
+			Interval:       restartRolloutInterval,
+		}
+		if err := mgr.Add(restartRollout); err != nil {
+			setupLog.Error(err, "unable to set up restart rollout")
+			panic(err)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		panic(err)
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
+	if err := addReadyzChecks(mgr); err != nil {
 		setupLog.Error(err, "unable to set up ready check")
 		panic(err)
 	}
 
-	dbgSrv := debugServerFunc(vmReconcilerMetrics, migrationReconcilerMetrics)
+	dbgSrv := debugServerFunc(debugAddr, debugAuth, logLevels, reconcilers...)
 	if err := mgr.Add(dbgSrv); err != nil {
 		setupLog.Error(err, "unable to set up debug server")
 		panic(err)
@@ -282,16 +682,47 @@ func main() {
 		panic(err)
 	}
 
+	var profilingConfig *util.ProfilingConfig
+	if profiling.ServerURL != "" {
+		profilingConfig = &profiling
+	}
+
 	// NOTE: THE CONTROLLER MUST IMMEDIATELY EXIT AFTER RUNNING THE MANAGER.
-	if err := run(mgr); err != nil {
+	if err := run(mgr, zapLogger, pprofConfig, debugAuth, profilingConfig); err != nil {
 		setupLog.Error(err, "run manager error")
 		panic(err)
 	}
 }
 
-func debugServerFunc(reconcilers ...controllers.ReconcilerWithMetrics) manager.RunnableFunc {
+// splitKernelArgsList parses the value of -kernel-args-allowlist or -kernel-args-denylist
+func splitKernelArgsList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func writeJSONResponse(w http.ResponseWriter, response any) {
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(fmt.Sprintf("failed to marshal JSON response: %s", err)))
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(responseBody)
+}
+
+func debugServerFunc(
+	addr string,
+	auth debugAuthConfig,
+	logLevels *logLevels,
+	reconcilers ...controllers.ReconcilerWithMetrics,
+) manager.RunnableFunc {
 	return manager.RunnableFunc(func(ctx context.Context) error {
 		mux := http.NewServeMux()
+		mux.Handle("/log-level", logLevels)
 		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 			defer r.Body.Close()
 
@@ -301,26 +732,49 @@ func debugServerFunc(reconcilers ...controllers.ReconcilerWithMetrics) manager.R
 				return
 			}
 
+			filter, err := controllers.ParseSnapshotFilter(r.URL.Query())
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(err.Error()))
+				return
+			}
+
 			response := make([]controllers.ReconcileSnapshot, 0, len(reconcilers))
 			for _, r := range reconcilers {
-				response = append(response, r.Snapshot())
+				response = append(response, r.Snapshot(filter))
+			}
+			writeJSONResponse(w, response)
+		})
+		mux.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+			defer r.Body.Close()
+
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				_, _ = w.Write([]byte(fmt.Sprintf("request method must be %s", http.MethodGet)))
+				return
 			}
 
-			responseBody, err := json.Marshal(&response)
+			key, err := controllers.ParseObjectKey(r.URL.Query())
 			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				_, _ = w.Write([]byte(fmt.Sprintf("failed to marshal JSON response: %s", err)))
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(err.Error()))
 				return
 			}
 
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write(responseBody)
+			response := make([]controllers.ObjectHistory, 0, len(reconcilers))
+			for _, r := range reconcilers {
+				response = append(response, r.History(key))
+			}
+			writeJSONResponse(w, response)
 		})
 
 		server := &http.Server{
-			Addr:    "0.0.0.0:7778",
+			Addr:    addr,
 			Handler: mux,
 		}
+		if err := auth.secure(server); err != nil {
+			return fmt.Errorf("failed to set up debug server auth: %w", err)
+		}
 		ctx, cancel := context.WithCancel(ctx)
 		defer cancel()
 
@@ -329,6 +783,6 @@ func debugServerFunc(reconcilers ...controllers.ReconcilerWithMetrics) manager.R
 			_ = server.Shutdown(context.TODO())
 		}()
 
-		return server.ListenAndServe()
+		return auth.listenAndServe(server)
 	})
 }
@@ -0,0 +1,147 @@
+package main
+
+// Metrics for memory returned to the host via virtio-balloon free page reporting.
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/go-qemu/qmp"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+type FreePageReportingMetrics struct {
+	GuestMemoryBytes     prometheus.Gauge
+	HostMemoryBytes      prometheus.Gauge
+	ReclaimedMemoryBytes prometheus.Gauge
+	Errors               prometheus.Counter
+
+	qemu *qemuProcess
+}
+
+func NewFreePageReportingMetrics(reg *prometheus.Registry, qemu *qemuProcess) *FreePageReportingMetrics {
+	return &FreePageReportingMetrics{
+		GuestMemoryBytes: util.RegisterMetric(reg, prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "runner_vm_guest_memory_bytes",
+				Help: "Amount of memory currently plugged into the VM, as seen by the guest",
+			},
+		)),
+		HostMemoryBytes: util.RegisterMetric(reg, prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "runner_vm_host_memory_bytes",
+				Help: "Resident memory of the QEMU process on the host",
+			},
+		)),
+		ReclaimedMemoryBytes: util.RegisterMetric(reg, prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "runner_vm_reclaimed_memory_bytes",
+				Help: "Amount of guest memory that is not backed by host memory, e.g. because it was returned via free page reporting",
+			},
+		)),
+		Errors: util.RegisterMetric(reg, prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "runner_vm_memory_fetch_errors_total",
+				Help: "Number of errors while fetching free page reporting data",
+			},
+		)),
+		qemu: qemu,
+	}
+}
+
+func (m *FreePageReportingMetrics) update(logger *zap.Logger) {
+	guest, err := getGuestMemorySize()
+	if err != nil {
+		logger.Error("getting guest memory size failed", zap.Error(err))
+		m.Errors.Inc()
+		return
+	}
+
+	pid, err := m.qemu.pid()
+	if err != nil {
+		logger.Error("getting QEMU PID failed", zap.Error(err))
+		m.Errors.Inc()
+		return
+	}
+	host, err := getQEMUResidentMemory(pid)
+	if err != nil {
+		logger.Error("getting QEMU resident memory failed", zap.Error(err))
+		m.Errors.Inc()
+		return
+	}
+
+	m.GuestMemoryBytes.Set(float64(guest))
+	m.HostMemoryBytes.Set(float64(host))
+	m.ReclaimedMemoryBytes.Set(float64(util.SaturatingSub(guest, host)))
+}
+
+// getGuestMemorySize returns the total memory of the guest, including memory plugged via
+// virtio-mem.
+func getGuestMemorySize() (uint64, error) {
+	mon, err := qmp.NewSocketMonitor("unix", qmpUnixSocketForSigtermHandler, 2*time.Second)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to QEMU monitor: %w", err)
+	}
+	if err := mon.Connect(); err != nil {
+		return 0, fmt.Errorf("failed to start monitor connection: %w", err)
+	}
+	defer mon.Disconnect() //nolint:errcheck // nothing to do with error when deferred. TODO: log it?
+
+	raw, err := mon.Run([]byte(`{"execute": "query-memory-size-summary"}`))
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute query-memory-size-summary: %w", err)
+	}
+
+	var result struct {
+		Return struct {
+			BaseMemory    uint64 `json:"base-memory"`
+			PluggedMemory uint64 `json:"plugged-memory"`
+		} `json:"return"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal QMP response: %w", err)
+	}
+
+	return result.Return.BaseMemory + result.Return.PluggedMemory, nil
+}
+
+// getQEMUResidentMemory returns the resident memory of the QEMU process, as reported by
+// /proc/<pid>/status.
+func getQEMUResidentMemory(pid int) (uint64, error) {
+	return readVmRSS(fmt.Sprintf("/proc/%d/status", pid))
+}
+
+func readVmRSS(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// The line looks like 'VmRSS:    123456 kB'
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[0] != "VmRSS:" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse VmRSS in %s: %w", path, err)
+		}
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, fmt.Errorf("VmRSS not found in %s", path)
+}
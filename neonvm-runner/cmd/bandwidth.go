@@ -0,0 +1,75 @@
+package main
+
+// Bandwidth limits for the VM's default network, enforced with tc on the tap device.
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// networkLimitsLock serializes changes to the tc configuration, which are not atomic.
+var networkLimitsLock sync.Mutex
+
+// setNetworkLimits applies the limits to the default network tap device, removing any limit that
+// is not set.
+//
+// Traffic sent by the VM is *received* by the tap device on the host, so the VM's egress is
+// limited by policing ingress on the tap. The VM's ingress is shaped by the tap's root qdisc.
+func setNetworkLimits(logger *zap.Logger, limits vmv1.NetworkLimits) error {
+	networkLimitsLock.Lock()
+	defer networkLimitsLock.Unlock()
+
+	if limits.IngressLimit != nil {
+		rate, burst := rateAndBurst(limits.IngressLimit)
+		logger.Info("Setting network ingress limit", zap.String("rate", rate))
+		err := runTC("qdisc", "replace", "dev", defaultNetworkTapName, "root",
+			"tbf", "rate", rate, "burst", burst, "latency", "50ms")
+		if err != nil {
+			return fmt.Errorf("failed to set ingress limit: %w", err)
+		}
+	} else {
+		// The qdisc may not exist, in which case there's nothing to remove.
+		_ = runTC("qdisc", "del", "dev", defaultNetworkTapName, "root")
+	}
+
+	if limits.EgressLimit != nil {
+		rate, burst := rateAndBurst(limits.EgressLimit)
+		logger.Info("Setting network egress limit", zap.String("rate", rate))
+		if err := runTC("qdisc", "replace", "dev", defaultNetworkTapName, "handle", "ffff:", "ingress"); err != nil {
+			return fmt.Errorf("failed to add ingress qdisc: %w", err)
+		}
+		err := runTC("filter", "replace", "dev", defaultNetworkTapName, "parent", "ffff:",
+			"protocol", "all", "prio", "1", "handle", "1", "matchall",
+			"action", "police", "rate", rate, "burst", burst, "drop")
+		if err != nil {
+			return fmt.Errorf("failed to set egress limit: %w", err)
+		}
+	} else {
+		_ = runTC("qdisc", "del", "dev", defaultNetworkTapName, "ingress")
+	}
+
+	return nil
+}
+
+// rateAndBurst returns the tc arguments for the rate limit in bits per second, with a burst of
+// 10ms worth of traffic (but at least 64KiB, so that full-sized packets always fit).
+func rateAndBurst(limit *resource.Quantity) (rate string, burst string) {
+	bitsPerSecond := limit.Value()
+	burstBytes := max(bitsPerSecond/8/100, 64*1024)
+	return fmt.Sprintf("%dbit", bitsPerSecond), fmt.Sprintf("%d", burstBytes)
+}
+
+func runTC(args ...string) error {
+	out, err := exec.Command("tc", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("tc %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
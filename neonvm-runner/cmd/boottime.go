@@ -0,0 +1,200 @@
+package main
+
+// Measuring how long the guest takes to boot, split into phases, so that regressions in boot time
+// are visible in metrics.
+//
+// We can't see the kernel or init starting from the host, so once the guest agent is up, we ask
+// the guest how long ago they started (according to its own monotonic clock) and work backwards.
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+const (
+	// vmMonitorPort is the port that vm-monitor listens on in the guest, which the autoscaler-agent
+	// connects to. Once it's accepting connections, we consider the VM booted.
+	vmMonitorPort = 10301
+
+	bootPollInterval = 100 * time.Millisecond
+	// bootMeasureTimeout is how long we wait for each stage of the boot before giving up on
+	// measuring it, e.g. because the guest doesn't run vm-monitor.
+	bootMeasureTimeout = 10 * time.Minute
+
+	// guestClockTicks is the unit of process start times in /proc/<pid>/stat, which is fixed at 100
+	// per second for userspace.
+	guestClockTicks = 100
+)
+
+type BootMetrics struct {
+	PhaseSeconds *prometheus.GaugeVec
+	TotalSeconds prometheus.Gauge
+}
+
+func NewBootMetrics(reg *prometheus.Registry) *BootMetrics {
+	return &BootMetrics{
+		PhaseSeconds: util.RegisterMetric(reg, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "runner_vm_boot_phase_seconds",
+				Help: "Duration of each phase of the VM's boot: firmware (QEMU start to kernel start), kernel (to init start), and init (to vm-monitor ready)",
+			},
+			[]string{"phase"},
+		)),
+		TotalSeconds: util.RegisterMetric(reg, prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "runner_vm_boot_seconds",
+				Help: "Time from QEMU starting until vm-monitor in the guest was ready",
+			},
+		)),
+	}
+}
+
+// measureBoot records the duration of each phase of the guest's boot, given the time that QEMU
+// was started, and sets guestReady once vm-monitor is ready.
+//
+// Phases are recorded as they complete, so if the guest never runs vm-monitor, the earlier phases
+// are still available.
+func measureBoot(
+	ctx context.Context,
+	logger *zap.Logger,
+	wg *sync.WaitGroup,
+	metrics *BootMetrics,
+	guestReady *atomic.Bool,
+	qemuStart time.Time,
+) {
+	defer wg.Done()
+	logger = logger.Named("boot-time")
+
+	var kernelStart, initStart time.Time
+	err := pollUntil(ctx, func() bool {
+		var err error
+		kernelStart, initStart, err = guestBootTimes(ctx)
+		return err == nil
+	})
+	if err != nil {
+		logger.Warn("could not get boot times from the guest", zap.Error(err))
+		return
+	}
+
+	// The guest's clock measures from slightly after QEMU considers the kernel started, so clamp
+	// to avoid negative durations.
+	kernelStart = maxTime(kernelStart, qemuStart)
+	initStart = maxTime(initStart, kernelStart)
+	metrics.PhaseSeconds.WithLabelValues("firmware").Set(kernelStart.Sub(qemuStart).Seconds())
+	metrics.PhaseSeconds.WithLabelValues("kernel").Set(initStart.Sub(kernelStart).Seconds())
+
+	var ready time.Time
+	err = pollUntil(ctx, func() bool {
+		if err := checkVMMonitor(); err != nil {
+			return false
+		}
+		ready = time.Now()
+		return true
+	})
+	if err != nil {
+		logger.Warn("vm-monitor did not become ready", zap.Error(err))
+	}
+
+	fields := []zap.Field{
+		zap.Duration("firmware", kernelStart.Sub(qemuStart)),
+		zap.Duration("kernel", initStart.Sub(kernelStart)),
+	}
+	if !ready.IsZero() {
+		guestReady.Store(true)
+		metrics.PhaseSeconds.WithLabelValues("init").Set(ready.Sub(initStart).Seconds())
+		metrics.TotalSeconds.Set(ready.Sub(qemuStart).Seconds())
+		fields = append(fields, zap.Duration("init", ready.Sub(initStart)), zap.Duration("total", ready.Sub(qemuStart)))
+	}
+	logger.Info("VM boot times", fields...)
+}
+
+// pollUntil calls done until it returns true, or bootMeasureTimeout passes.
+func pollUntil(ctx context.Context, done func() bool) error {
+	ctx, cancel := context.WithTimeout(ctx, bootMeasureTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(bootPollInterval)
+	defer ticker.Stop()
+	for {
+		if done() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// guestBootTimes returns when the guest's kernel and init started, according to the guest.
+func guestBootTimes(ctx context.Context) (kernelStart time.Time, initStart time.Time, _ error) {
+	var uptime bytes.Buffer
+	if err := readGuestFile(ctx, "/proc/uptime", &uptime); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	now := time.Now()
+
+	var initStat bytes.Buffer
+	if err := readGuestFile(ctx, "/proc/1/stat", &initStat); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	// /proc/uptime is "<uptime> <idle>", in seconds
+	fields := strings.Fields(uptime.String())
+	if len(fields) == 0 {
+		return time.Time{}, time.Time{}, errors.New("empty /proc/uptime")
+	}
+	uptimeSeconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid /proc/uptime: %w", err)
+	}
+	kernelStart = now.Add(-time.Duration(uptimeSeconds * float64(time.Second)))
+
+	// The process start time is the 22nd field of /proc/<pid>/stat. The second field is the
+	// command name in parentheses, which may contain spaces, so count from after it.
+	stat := initStat.String()
+	fields = strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 20 {
+		return time.Time{}, time.Time{}, errors.New("truncated /proc/1/stat")
+	}
+	startTicks, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start time in /proc/1/stat: %w", err)
+	}
+	initStart = kernelStart.Add(time.Duration(startTicks) * time.Second / guestClockTicks)
+
+	return kernelStart, initStart, nil
+}
+
+func checkVMMonitor() error {
+	_, vmIP, _, err := calcIPs(defaultNetworkCIDR)
+	if err != nil {
+		return fmt.Errorf("could not calculate VM IP address: %w", err)
+	}
+	conn, err := net.DialTimeout("tcp", fmt.Sprintf("%s:%d", vmIP, vmMonitorPort), time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,383 @@
+package main
+
+// Encryption of empty disks with LUKS, via QEMU's qcow2 encryption, using keys from Secrets.
+//
+// The controller mounts each disk's key at /vm/keys/<disk>/key. When the Secret changes, we rotate
+// the key without restarting the VM, by re-encrypting the disk: a new image is created, encrypted
+// with the new key (and so with a new volume key too), and the disk is mirrored into it with a
+// block job while the guest keeps using it. Once the mirror is in sync, QEMU switches the disk to
+// the new image, and the old one is removed.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+const (
+	diskKeysPath = "/vm/keys"
+
+	diskKeyRotationInterval = 30 * time.Second
+	// diskJobTimeout is how long we wait for a block job re-encrypting a disk, after which it's
+	// cancelled. Mirroring copies all of the disk's data, so this is generous.
+	diskJobTimeout = time.Hour
+	// diskJobCancelTimeout is how long we wait for a block job to finish after cancelling it
+	diskJobCancelTimeout = time.Minute
+)
+
+// diskKeyPath returns the path of the file with the encryption key for the disk
+func diskKeyPath(diskName string) string {
+	return fmt.Sprintf("%s/%s/key", diskKeysPath, diskName)
+}
+
+// diskKeyDataDir returns the directory that the disk's key is written into by the atomicwriter
+// utility, like other secrets.
+func diskKeyDataDir(diskName string) string {
+	return fmt.Sprintf("%s/%s/..data", diskKeysPath, diskName)
+}
+
+// diskKeySecretID returns the ID of the QEMU secret object for a generation of the disk's key
+//
+// Generation 0 is the key the disk was created with, and each rotation increments it.
+func diskKeySecretID(diskName string, generation int) string {
+	return fmt.Sprintf("%s-key%d", diskName, generation)
+}
+
+// encryptedDiskNodeName returns the name of the qcow2 block node for a generation of the disk's
+// image, which is where the encryption happens
+func encryptedDiskNodeName(diskName string, generation int) string {
+	if generation == 0 {
+		return fmt.Sprintf("%s-qcow2", diskName)
+	}
+	return fmt.Sprintf("%s-qcow2-%d", diskName, generation)
+}
+
+// encryptedDiskFileNodeName returns the name of the file block node under the qcow2 node for a
+// generation of the disk's image. Generation 0 is created by -drive, which names it itself.
+func encryptedDiskFileNodeName(diskName string, generation int) string {
+	return fmt.Sprintf("%s-file-%d", diskName, generation)
+}
+
+// encryptedDiskPath returns the path of the image file for a generation of the disk. Generation 0
+// is the image created by setupVMDisks.
+func encryptedDiskPath(diskName string, generation int) string {
+	if generation == 0 {
+		return fmt.Sprintf("%s/%s.qcow2", mountedDiskPath, diskName)
+	}
+	return fmt.Sprintf("%s/%s.%d.qcow2", mountedDiskPath, diskName, generation)
+}
+
+// encryptedDriveArgs returns the QEMU args to load the key for the encrypted disk, and the extra
+// drive options to use it.
+func encryptedDriveArgs(diskName string) (objectArgs []string, driveOptions string) {
+	secretID := diskKeySecretID(diskName, 0)
+	objectArgs = []string{"-object", fmt.Sprintf("secret,id=%s,file=%s", secretID, diskKeyPath(diskName))}
+	driveOptions = fmt.Sprintf(",format=qcow2,node-name=%s,encrypt.key-secret=%s", encryptedDiskNodeName(diskName, 0), secretID)
+	return objectArgs, driveOptions
+}
+
+// rotateDiskKeys watches the keys of the VM's encrypted disks, and when one changes, re-encrypts
+// the disk with the new key.
+func rotateDiskKeys(ctx context.Context, logger *zap.Logger, wg *sync.WaitGroup, vmSpec *vmv1.VirtualMachineSpec) {
+	defer wg.Done()
+	logger = logger.Named("disk-key-rotation")
+
+	type diskKey struct {
+		disk       *vmv1.EmptyDiskSource
+		name       string
+		generation int
+		checksum   string
+	}
+	var keys []*diskKey
+	for _, disk := range vmSpec.Disks {
+		if disk.EmptyDisk == nil || disk.EmptyDisk.Encryption == nil {
+			continue
+		}
+		checksum, err := util.ChecksumFlatDir(diskKeyDataDir(disk.Name))
+		if err != nil {
+			logger.Error("failed to get key checksum, key rotation is disabled for the disk",
+				zap.String("diskName", disk.Name), zap.Error(err))
+			continue
+		}
+		keys = append(keys, &diskKey{disk: disk.EmptyDisk, name: disk.Name, generation: 0, checksum: checksum})
+	}
+
+	if len(keys) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(diskKeyRotationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, key := range keys {
+				checksum, err := util.ChecksumFlatDir(diskKeyDataDir(key.name))
+				if err != nil {
+					logger.Error("failed to get key checksum", zap.String("diskName", key.name), zap.Error(err))
+					continue
+				}
+				if checksum == key.checksum {
+					continue
+				}
+
+				logger.Info("disk key changed, re-encrypting", zap.String("diskName", key.name), zap.Int("generation", key.generation))
+				switched, err := reencryptDisk(ctx, key.name, key.disk, key.generation)
+				if switched {
+					// Even if cleaning up the old image failed, the disk is now using the new one,
+					// so we must not try to switch to it again.
+					key.generation += 1
+					key.checksum = checksum
+				}
+				if err != nil {
+					// If the disk wasn't switched, this is retried on the next tick.
+					logger.Error("failed to re-encrypt disk", zap.String("diskName", key.name), zap.Bool("switched", switched), zap.Error(err))
+					continue
+				}
+				logger.Info("re-encrypted disk", zap.String("diskName", key.name), zap.Int("generation", key.generation))
+			}
+		}
+	}
+}
+
+// reencryptDisk re-encrypts the disk with the current contents of its key file, given the
+// generation of the image it's currently using.
+//
+// The new image is created next to the current one, so while the disk is being mirrored, the node
+// needs enough free space for a second copy of its data.
+//
+// Returns whether the disk was switched to the new image, which may be true even if there's an
+// error, in which case the old image may not have been removed.
+func reencryptDisk(ctx context.Context, diskName string, disk *vmv1.EmptyDiskSource, generation int) (switched bool, _ error) {
+	oldNode := encryptedDiskNodeName(diskName, generation)
+	oldID := diskKeySecretID(diskName, generation)
+	newNode := encryptedDiskNodeName(diskName, generation+1)
+	newFileNode := encryptedDiskFileNodeName(diskName, generation+1)
+	newPath := encryptedDiskPath(diskName, generation+1)
+	newID := diskKeySecretID(diskName, generation+1)
+
+	current, err := queryBlockNode(oldNode)
+	if err != nil {
+		return false, err
+	}
+
+	// QEMU reads the file when the secret is created, so this is the key at the time of rotation.
+	err = runQMPCommand("object-add", map[string]any{
+		"qom-type": "secret",
+		"id":       newID,
+		"file":     diskKeyPath(diskName),
+	}, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to load new key: %w", err)
+	}
+
+	// Remove whatever of the new image was set up, if the disk isn't switched to it.
+	var cleanupNew []func()
+	defer func() {
+		if switched {
+			return
+		}
+		for _, cleanup := range lo.Reverse(cleanupNew) {
+			cleanup()
+		}
+	}()
+	cleanupNew = append(cleanupNew, func() {
+		_ = runQMPCommand("object-del", map[string]any{"id": newID}, nil)
+	})
+
+	// The new image is set up like setupVMDisks does, other than being created by QEMU
+	nodeOptions := map[string]any{
+		"cache": map[string]any{"direct": current.Cache.Direct, "no-flush": current.Cache.NoFlush},
+	}
+	if disk.DiscardPassthrough() {
+		nodeOptions["discard"] = "unmap"
+	}
+	if mode := disk.DetectZeroes; mode != nil {
+		nodeOptions["detect-zeroes"] = *mode
+	}
+
+	err = runDiskJob(ctx, fmt.Sprintf("%s-create-file", diskName), "blockdev-create", map[string]any{
+		"options": map[string]any{"driver": "file", "filename": newPath, "size": 0},
+	})
+	cleanupNew = append(cleanupNew, func() {
+		_ = os.Remove(newPath)
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to create new image file: %w", err)
+	}
+
+	err = runQMPCommand("blockdev-add", lo.Assign(nodeOptions, map[string]any{
+		"driver":    "file",
+		"node-name": newFileNode,
+		"filename":  newPath,
+	}), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to open new image file: %w", err)
+	}
+	cleanupNew = append(cleanupNew, func() {
+		_ = runQMPCommand("blockdev-del", map[string]any{"node-name": newFileNode}, nil)
+	})
+
+	err = runDiskJob(ctx, fmt.Sprintf("%s-create", diskName), "blockdev-create", map[string]any{
+		"options": map[string]any{
+			"driver":         "qcow2",
+			"file":           newFileNode,
+			"size":           current.Image.VirtualSize,
+			"cluster-size":   2 * 1024 * 1024,
+			"lazy-refcounts": true,
+			"encrypt":        map[string]any{"format": "luks", "key-secret": newID},
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to create new image: %w", err)
+	}
+
+	err = runQMPCommand("blockdev-add", lo.Assign(nodeOptions, map[string]any{
+		"driver":    "qcow2",
+		"node-name": newNode,
+		"file":      newFileNode,
+		"encrypt":   map[string]any{"format": "luks", "key-secret": newID},
+	}), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to open new image: %w", err)
+	}
+	cleanupNew = append(cleanupNew, func() {
+		_ = runQMPCommand("blockdev-del", map[string]any{"node-name": newNode}, nil)
+	})
+
+	// Once the mirror is in sync, completing the job switches the disk to the new image.
+	err = runDiskJob(ctx, fmt.Sprintf("%s-reencrypt", diskName), "blockdev-mirror", map[string]any{
+		"device": oldNode,
+		"target": newNode,
+		"sync":   "full",
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to mirror disk to new image: %w", err)
+	}
+
+	// The old image from -drive is closed by QEMU when the disk switches, but the ones we added
+	// must be removed explicitly.
+	if generation != 0 {
+		if err := runQMPCommand("blockdev-del", map[string]any{"node-name": oldNode}, nil); err != nil {
+			return true, fmt.Errorf("failed to close old image: %w", err)
+		}
+		oldFileNode := encryptedDiskFileNodeName(diskName, generation)
+		if err := runQMPCommand("blockdev-del", map[string]any{"node-name": oldFileNode}, nil); err != nil {
+			return true, fmt.Errorf("failed to close old image file: %w", err)
+		}
+	}
+	if err := runQMPCommand("object-del", map[string]any{"id": oldID}, nil); err != nil {
+		return true, fmt.Errorf("failed to delete old key: %w", err)
+	}
+	if err := os.Remove(encryptedDiskPath(diskName, generation)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return true, fmt.Errorf("failed to remove old image: %w", err)
+	}
+	return true, nil
+}
+
+// runDiskJob starts a block job with the command, and waits for it to finish, completing it once
+// it's ready.
+//
+// The job isn't dismissed automatically, so that we can see whether it failed. If it takes too
+// long, or the context is cancelled, the job is cancelled.
+func runDiskJob(ctx context.Context, jobID string, command string, arguments map[string]any) error {
+	arguments["job-id"] = jobID
+	if command != "blockdev-create" {
+		// blockdev-create jobs are never dismissed automatically
+		arguments["auto-dismiss"] = false
+	}
+	if err := runQMPCommand(command, arguments, nil); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(diskJobTimeout)
+	var cancelDeadline time.Time
+	completing := false
+	for {
+		var jobs []blockJobInfo
+		if err := runQMPCommand("query-jobs", nil, &jobs); err != nil {
+			return err
+		}
+		job, ok := lo.Find(jobs, func(job blockJobInfo) bool {
+			return job.ID == jobID
+		})
+		if !ok {
+			return fmt.Errorf("job %s not found", jobID)
+		}
+
+		switch {
+		case job.Status == "concluded":
+			if err := runQMPCommand("job-dismiss", map[string]any{"id": jobID}, nil); err != nil {
+				return fmt.Errorf("failed to dismiss job %s: %w", jobID, err)
+			}
+			if job.Error != "" {
+				return fmt.Errorf("job %s failed: %s", jobID, job.Error)
+			}
+			if !cancelDeadline.IsZero() {
+				// A ready mirror job that's cancelled concludes without error, but doesn't switch.
+				return fmt.Errorf("job %s was cancelled", jobID)
+			}
+			return nil
+		case !cancelDeadline.IsZero():
+			if time.Now().After(cancelDeadline) {
+				return fmt.Errorf("timed out waiting for job %s to be cancelled", jobID)
+			}
+		case ctx.Err() != nil || time.Now().After(deadline):
+			if err := runQMPCommand("job-cancel", map[string]any{"id": jobID}, nil); err != nil {
+				return fmt.Errorf("failed to cancel job %s: %w", jobID, err)
+			}
+			cancelDeadline = time.Now().Add(diskJobCancelTimeout)
+		case job.Status == "ready" && !completing:
+			if err := runQMPCommand("job-complete", map[string]any{"id": jobID}, nil); err != nil {
+				return fmt.Errorf("failed to complete job %s: %w", jobID, err)
+			}
+			completing = true
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+type blockJobInfo struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	// Error is set if the job concluded with an error
+	Error string `json:"error"`
+}
+
+type blockNodeInfo struct {
+	NodeName string `json:"node-name"`
+	Cache    struct {
+		Direct  bool `json:"direct"`
+		NoFlush bool `json:"no-flush"`
+	} `json:"cache"`
+	Image struct {
+		VirtualSize int64 `json:"virtual-size"`
+	} `json:"image"`
+}
+
+// queryBlockNode returns the info of the block node
+func queryBlockNode(nodeName string) (*blockNodeInfo, error) {
+	var nodes []blockNodeInfo
+	if err := runQMPCommand("query-named-block-nodes", map[string]any{"flat": true}, &nodes); err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		if node.NodeName == nodeName {
+			return &node, nil
+		}
+	}
+	return nil, fmt.Errorf("block node %s not found", nodeName)
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// fakeBlockLayer is the part of QEMU that re-encrypting a disk uses: its block nodes, secrets, and
+// block jobs. Jobs conclude immediately, other than mirror jobs, which are ready until completed.
+type fakeBlockLayer struct {
+	t *testing.T
+	// node is the block node the disk is currently using
+	node string
+	// mirrorError, if set, is the error that mirror jobs fail with
+	mirrorError string
+
+	mu       sync.Mutex
+	jobs     []blockJobInfo
+	commands []fakeQMPCommand
+}
+
+func (b *fakeBlockLayer) handle(cmd fakeQMPCommand) any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.commands = append(b.commands, cmd)
+
+	var args struct {
+		ID    string `json:"id"`
+		JobID string `json:"job-id"`
+	}
+	if len(cmd.Arguments) != 0 {
+		require.NoError(b.t, json.Unmarshal(cmd.Arguments, &args))
+	}
+
+	switch cmd.Execute {
+	case "query-named-block-nodes":
+		nodes := []blockNodeInfo{}
+		if b.node != "" {
+			var node blockNodeInfo
+			node.NodeName = b.node
+			node.Cache.Direct = true
+			node.Image.VirtualSize = 1 << 30
+			nodes = append(nodes, node)
+		}
+		return map[string]any{"return": nodes}
+	case "blockdev-create":
+		b.jobs = append(b.jobs, blockJobInfo{ID: args.JobID, Status: "concluded", Error: ""})
+	case "blockdev-mirror":
+		if b.mirrorError != "" {
+			b.jobs = append(b.jobs, blockJobInfo{ID: args.JobID, Status: "concluded", Error: b.mirrorError})
+		} else {
+			b.jobs = append(b.jobs, blockJobInfo{ID: args.JobID, Status: "ready", Error: ""})
+		}
+	case "job-complete":
+		for i := range b.jobs {
+			if b.jobs[i].ID == args.ID {
+				b.jobs[i].Status = "concluded"
+			}
+		}
+	case "job-dismiss":
+		b.jobs = lo.Reject(b.jobs, func(job blockJobInfo, _ int) bool { return job.ID == args.ID })
+	case "query-jobs":
+		return map[string]any{"return": b.jobs}
+	}
+	return map[string]any{"return": map[string]any{}}
+}
+
+// received returns the names of the commands received, other than queries
+func (b *fakeBlockLayer) received() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var names []string
+	for _, cmd := range b.commands {
+		if cmd.Execute != "query-jobs" && cmd.Execute != "query-named-block-nodes" {
+			names = append(names, cmd.Execute)
+		}
+	}
+	return names
+}
+
+// arguments returns the arguments of each command with the name
+func (b *fakeBlockLayer) arguments(command string) []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var args []map[string]any
+	for _, cmd := range b.commands {
+		if cmd.Execute == command {
+			var a map[string]any
+			require.NoError(b.t, json.Unmarshal(cmd.Arguments, &a))
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+func startFakeBlockLayer(t *testing.T, node string, mirrorError string) *fakeBlockLayer {
+	//nolint:exhaustruct // the rest are set as commands are received
+	b := &fakeBlockLayer{t: t, node: node, mirrorError: mirrorError}
+	startFakeQMPWith(t, b.handle)
+	return b
+}
+
+func TestReencryptDisk(t *testing.T) {
+	//nolint:exhaustruct // only the options used for the new image
+	disk := &vmv1.EmptyDiskSource{
+		Discard:      true,
+		DetectZeroes: lo.ToPtr(vmv1.DetectZeroesUnmap),
+	}
+
+	t.Run("FirstRotation", func(t *testing.T) {
+		qemu := startFakeBlockLayer(t, "data-qcow2", "")
+
+		switched, err := reencryptDisk(context.Background(), "data", disk, 0)
+		require.NoError(t, err)
+		assert.True(t, switched)
+
+		assert.Equal(t, []string{
+			"object-add",
+			"blockdev-create", "job-dismiss", "blockdev-add",
+			"blockdev-create", "job-dismiss", "blockdev-add",
+			"blockdev-mirror", "job-complete", "job-dismiss",
+			// the old image from -drive is closed by QEMU itself
+			"object-del",
+		}, qemu.received())
+
+		assert.Equal(t, []map[string]any{
+			{"qom-type": "secret", "id": "data-key1", "file": "/vm/keys/data/key"},
+		}, qemu.arguments("object-add"))
+		assert.Equal(t, []map[string]any{
+			{
+				"job-id":  "data-create-file",
+				"options": map[string]any{"driver": "file", "filename": "/vm/images/data.1.qcow2", "size": 0.0},
+			},
+			{
+				"job-id": "data-create",
+				"options": map[string]any{
+					"driver":         "qcow2",
+					"file":           "data-file-1",
+					"size":           float64(1 << 30),
+					"cluster-size":   float64(2 * 1024 * 1024),
+					"lazy-refcounts": true,
+					"encrypt":        map[string]any{"format": "luks", "key-secret": "data-key1"},
+				},
+			},
+		}, qemu.arguments("blockdev-create"))
+
+		// Both new nodes are set up like the disk's current ones
+		cache := map[string]any{"direct": true, "no-flush": false}
+		assert.Equal(t, []map[string]any{
+			{
+				"driver":        "file",
+				"node-name":     "data-file-1",
+				"filename":      "/vm/images/data.1.qcow2",
+				"cache":         cache,
+				"discard":       "unmap",
+				"detect-zeroes": "unmap",
+			},
+			{
+				"driver":        "qcow2",
+				"node-name":     "data-qcow2-1",
+				"file":          "data-file-1",
+				"encrypt":       map[string]any{"format": "luks", "key-secret": "data-key1"},
+				"cache":         cache,
+				"discard":       "unmap",
+				"detect-zeroes": "unmap",
+			},
+		}, qemu.arguments("blockdev-add"))
+
+		assert.Equal(t, []map[string]any{
+			{"job-id": "data-reencrypt", "auto-dismiss": false, "device": "data-qcow2", "target": "data-qcow2-1", "sync": "full"},
+		}, qemu.arguments("blockdev-mirror"))
+		assert.Equal(t, []map[string]any{{"id": "data-reencrypt"}}, qemu.arguments("job-complete"))
+		assert.Equal(t, []map[string]any{{"id": "data-key0"}}, qemu.arguments("object-del"))
+	})
+
+	t.Run("LaterRotation", func(t *testing.T) {
+		qemu := startFakeBlockLayer(t, "data-qcow2-1", "")
+
+		switched, err := reencryptDisk(context.Background(), "data", disk, 1)
+		require.NoError(t, err)
+		assert.True(t, switched)
+
+		// The old image was added by us, so we must close it
+		assert.Equal(t, []string{
+			"object-add",
+			"blockdev-create", "job-dismiss", "blockdev-add",
+			"blockdev-create", "job-dismiss", "blockdev-add",
+			"blockdev-mirror", "job-complete", "job-dismiss",
+			"blockdev-del", "blockdev-del", "object-del",
+		}, qemu.received())
+		assert.Equal(t, []map[string]any{
+			{"job-id": "data-reencrypt", "auto-dismiss": false, "device": "data-qcow2-1", "target": "data-qcow2-2", "sync": "full"},
+		}, qemu.arguments("blockdev-mirror"))
+		assert.Equal(t, []map[string]any{{"node-name": "data-qcow2-1"}, {"node-name": "data-file-1"}}, qemu.arguments("blockdev-del"))
+		assert.Equal(t, []map[string]any{{"id": "data-key1"}}, qemu.arguments("object-del"))
+	})
+
+	t.Run("MirrorFailed", func(t *testing.T) {
+		qemu := startFakeBlockLayer(t, "data-qcow2", "Input/output error")
+
+		switched, err := reencryptDisk(context.Background(), "data", disk, 0)
+		assert.ErrorContains(t, err, "failed to mirror disk to new image: job data-reencrypt failed: Input/output error")
+		assert.False(t, switched)
+
+		// The new image is removed, and the disk keeps its current key
+		assert.Equal(t, []string{
+			"object-add",
+			"blockdev-create", "job-dismiss", "blockdev-add",
+			"blockdev-create", "job-dismiss", "blockdev-add",
+			"blockdev-mirror", "job-dismiss",
+			"blockdev-del", "blockdev-del", "object-del",
+		}, qemu.received())
+		assert.Equal(t, []map[string]any{{"node-name": "data-qcow2-1"}, {"node-name": "data-file-1"}}, qemu.arguments("blockdev-del"))
+		assert.Equal(t, []map[string]any{{"id": "data-key1"}}, qemu.arguments("object-del"))
+	})
+
+	t.Run("NodeNotFound", func(t *testing.T) {
+		qemu := startFakeBlockLayer(t, "", "")
+
+		switched, err := reencryptDisk(context.Background(), "data", disk, 0)
+		assert.ErrorContains(t, err, "block node data-qcow2 not found")
+		assert.False(t, switched)
+		assert.Empty(t, qemu.received())
+	})
+
+}
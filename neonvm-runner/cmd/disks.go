@@ -13,6 +13,7 @@ import (
 
 	"github.com/alessio/shellescape"
 	"github.com/kdomanski/iso9660"
+	"github.com/samber/lo"
 	"go.uber.org/zap"
 
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -34,6 +35,7 @@ const (
 // setupVMDisks creates the disks for the VM and returns the appropriate QEMU args
 func setupVMDisks(
 	logger *zap.Logger,
+	bus virtioBus,
 	diskCacheSettings string,
 	enableSSH bool,
 	swapSize *resource.Quantity,
@@ -41,15 +43,15 @@ func setupVMDisks(
 ) ([]string, error) {
 	var qemuCmd []string
 
-	qemuCmd = append(qemuCmd, "-drive", fmt.Sprintf("id=rootdisk,file=%s,if=virtio,media=disk,index=0,%s", rootDiskPath, diskCacheSettings))
-	qemuCmd = append(qemuCmd, "-drive", fmt.Sprintf("id=runtime,file=%s,if=virtio,media=cdrom,readonly=on,cache=none", runtimeDiskPath))
+	qemuCmd = append(qemuCmd, virtioDriveArgs(bus, "rootdisk", rootDiskPath, fmt.Sprintf("media=disk,index=0,%s", diskCacheSettings))...)
+	qemuCmd = append(qemuCmd, virtioDriveArgs(bus, "runtime", runtimeDiskPath, "media=cdrom,readonly=on,cache=none")...)
 
 	if enableSSH {
 		name := "ssh-authorized-keys"
 		if err := createISO9660FromPath(logger, name, sshAuthorizedKeysDiskPath, sshAuthorizedKeysMountPoint); err != nil {
 			return nil, fmt.Errorf("Failed to create ISO9660 image: %w", err)
 		}
-		qemuCmd = append(qemuCmd, "-drive", fmt.Sprintf("id=%s,file=%s,if=virtio,media=cdrom,cache=none", name, sshAuthorizedKeysDiskPath))
+		qemuCmd = append(qemuCmd, virtioDriveArgs(bus, name, sshAuthorizedKeysDiskPath, "media=cdrom,cache=none")...)
 	}
 
 	if swapSize != nil {
@@ -58,7 +60,7 @@ func setupVMDisks(
 		if err := createSwap(dPath, swapSize); err != nil {
 			return nil, fmt.Errorf("Failed to create swap disk: %w", err)
 		}
-		qemuCmd = append(qemuCmd, "-drive", fmt.Sprintf("id=%s,file=%s,if=virtio,media=disk,%s,discard=unmap", swapName, dPath, diskCacheSettings))
+		qemuCmd = append(qemuCmd, virtioDriveArgs(bus, swapName, dPath, fmt.Sprintf("media=disk,%s,discard=unmap", diskCacheSettings))...)
 	}
 
 	for _, disk := range extraDisks {
@@ -66,14 +68,27 @@ func setupVMDisks(
 		case disk.EmptyDisk != nil:
 			logger.Info("creating QCOW2 image with empty ext4 filesystem", zap.String("diskName", disk.Name))
 			dPath := fmt.Sprintf("%s/%s.qcow2", mountedDiskPath, disk.Name)
-			if err := createQCOW2(disk.Name, dPath, &disk.EmptyDisk.Size, nil); err != nil {
+			var keyPath *string
+			if disk.EmptyDisk.Encryption != nil {
+				keyPath = lo.ToPtr(diskKeyPath(disk.Name))
+			}
+			if err := createQCOW2(disk.Name, dPath, &disk.EmptyDisk.Size, nil, keyPath); err != nil {
 				return nil, fmt.Errorf("Failed to create QCOW2 image: %w", err)
 			}
 			discard := ""
-			if disk.EmptyDisk.Discard {
+			if disk.EmptyDisk.DiscardPassthrough() {
 				discard = ",discard=unmap"
 			}
-			qemuCmd = append(qemuCmd, "-drive", fmt.Sprintf("id=%s,file=%s,if=virtio,media=disk,%s%s", disk.Name, dPath, diskCacheSettings, discard))
+			if mode := disk.EmptyDisk.DetectZeroes; mode != nil {
+				discard += fmt.Sprintf(",detect-zeroes=%s", *mode)
+			}
+			encryption := ""
+			if keyPath != nil {
+				objectArgs, driveOptions := encryptedDriveArgs(disk.Name)
+				qemuCmd = append(qemuCmd, objectArgs...)
+				encryption = driveOptions
+			}
+			qemuCmd = append(qemuCmd, virtioDriveArgs(bus, disk.Name, dPath, fmt.Sprintf("media=disk,%s%s%s", diskCacheSettings, discard, encryption))...)
 		case disk.ConfigMap != nil || disk.Secret != nil:
 			dPath := fmt.Sprintf("%s/%s.iso", mountedDiskPath, disk.Name)
 			mnt := fmt.Sprintf("/vm/mounts%s", disk.MountPath)
@@ -81,7 +96,7 @@ func setupVMDisks(
 			if err := createISO9660FromPath(logger, disk.Name, dPath, mnt); err != nil {
 				return nil, fmt.Errorf("Failed to create ISO9660 image: %w", err)
 			}
-			qemuCmd = append(qemuCmd, "-drive", fmt.Sprintf("id=%s,file=%s,if=virtio,media=cdrom,cache=none", disk.Name, dPath))
+			qemuCmd = append(qemuCmd, virtioDriveArgs(bus, disk.Name, dPath, "media=cdrom,cache=none")...)
 		default:
 			// do nothing
 		}
@@ -90,6 +105,24 @@ func setupVMDisks(
 	return qemuCmd, nil
 }
 
+// virtioDriveArgs returns the QEMU args to attach the file as a virtio disk, with the extra drive
+// options.
+//
+// On PCI, we let QEMU create the virtio-blk device for the drive, so that existing VMs keep the
+// same devices (which matters for live migration). QEMU can only do that for PCI, so on MMIO, the
+// device is added separately.
+func virtioDriveArgs(bus virtioBus, id string, file string, options string) []string {
+	switch bus {
+	case virtioBusMMIO:
+		return []string{
+			"-drive", fmt.Sprintf("id=%s,file=%s,if=none,%s", id, file, options),
+			"-device", fmt.Sprintf("%s,drive=%s", bus.device("virtio-blk"), id),
+		}
+	default:
+		return []string{"-drive", fmt.Sprintf("id=%s,file=%s,if=virtio,%s", id, file, options)}
+	}
+}
+
 func resizeRootDisk(logger *zap.Logger, vmSpec *vmv1.VirtualMachineSpec) error {
 	// resize rootDisk image of size specified and new size more than current
 	type QemuImgOutputPartial struct {
@@ -130,6 +163,7 @@ func createISO9660runtime(
 	enableSSH bool,
 	swapSize *resource.Quantity,
 	shmsize *resource.Quantity,
+	hostname string,
 ) error {
 	writer, err := iso9660.NewWriter()
 	if err != nil {
@@ -144,6 +178,14 @@ func createISO9660runtime(
 		}
 	}
 
+	// only used by VMs resumed from a memory image, which booted with a different hostname.
+	if len(hostname) != 0 {
+		err = writer.AddFile(bytes.NewReader([]byte(hostname)), "hostname")
+		if err != nil {
+			return err
+		}
+	}
+
 	if len(command) != 0 {
 		err = writer.AddFile(bytes.NewReader([]byte(shellescape.QuoteCommand(command))), "command.sh")
 		if err != nil {
@@ -340,7 +382,10 @@ func createSwap(diskPath string, swapSize *resource.Quantity) error {
 	return nil
 }
 
-func createQCOW2(diskName string, diskPath string, diskSize *resource.Quantity, contentPath *string) error {
+// createQCOW2 creates a QCOW2 image with an ext4 filesystem, either empty with the size or with the
+// contents of the directory. If keyPath is not nil, the image is encrypted with LUKS, using the key
+// in that file.
+func createQCOW2(diskName string, diskPath string, diskSize *resource.Quantity, contentPath *string, keyPath *string) error {
 	ext4blocksMin := int64(64)
 	ext4blockSize := int64(4096)
 	ext4blockCount := int64(0)
@@ -380,7 +425,18 @@ func createQCOW2(diskName string, diskPath string, diskSize *resource.Quantity,
 		return err
 	}
 
-	if err := execFg(qemuImgBin, "convert", "-q", "-f", "raw", "-O", "qcow2", "-o", "cluster_size=2M,lazy_refcounts=on", "ext4.raw", diskPath); err != nil {
+	convertArgs := []string{"convert", "-q", "-f", "raw", "-O", "qcow2"}
+	if keyPath != nil {
+		convertArgs = append(
+			convertArgs,
+			"--object", fmt.Sprintf("secret,id=sec0,file=%s", *keyPath),
+			"-o", "cluster_size=2M,lazy_refcounts=on,encrypt.format=luks,encrypt.key-secret=sec0",
+		)
+	} else {
+		convertArgs = append(convertArgs, "-o", "cluster_size=2M,lazy_refcounts=on")
+	}
+	convertArgs = append(convertArgs, "ext4.raw", diskPath)
+	if err := execFg(qemuImgBin, convertArgs...); err != nil {
 		return err
 	}
 
@@ -0,0 +1,75 @@
+package main
+
+// Selection of the firmware that boots the guest, from .spec.guest.firmware.
+
+import (
+	"fmt"
+	"os"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+const (
+	// QEMU_EFI used only by runner running on the arm architecture
+	armEFIPath = "/vm/QEMU_EFI_ARM.fd"
+	// qboot is shipped with QEMU, so it's found in QEMU's data directory.
+	qbootPath = "qboot.rom"
+
+	// OVMF images are provided by the ovmf package in the runner image.
+	ovmfCodePath         = "/usr/share/OVMF/OVMF_CODE.fd"
+	ovmfVarsTemplatePath = "/usr/share/OVMF/OVMF_VARS.fd"
+	// Secure boot needs OVMF built with SMM support, and variables with the keys enrolled. These
+	// are not in the default runner image, so the webhook rejects secureBoot until they are.
+	ovmfSecureBootCodePath         = "/usr/share/OVMF/OVMF_CODE.secboot.fd"
+	ovmfSecureBootVarsTemplatePath = "/usr/share/OVMF/OVMF_VARS.secboot.fd"
+
+	// ovmfVarsPath is the VM's own copy of the UEFI variables, which the firmware may write to.
+	ovmfVarsPath = "/vm/OVMF_VARS.fd"
+)
+
+// firmwareArgs returns the QEMU args for the VM's firmware, along with any extra options needed
+// for -machine.
+func firmwareArgs(architecture string, firmware *vmv1.Firmware) (args []string, machineOptions string, _ error) {
+	if architecture == architectureArm64 {
+		// arm64 always uses UEFI, which is checked by the webhook. We need custom firmware to have
+		// ACPI working.
+		return []string{"-bios", armEFIPath}, "", nil
+	}
+
+	var fwType vmv1.FirmwareType
+	if firmware != nil {
+		fwType = firmware.Type
+	}
+
+	switch fwType {
+	case "", vmv1.FirmwareTypeSeaBIOS:
+		// SeaBIOS is QEMU's default
+		return nil, "", nil
+	case vmv1.FirmwareTypeQboot:
+		return []string{"-bios", qbootPath}, "", nil
+	case vmv1.FirmwareTypeOVMF:
+		codePath, varsTemplatePath := ovmfCodePath, ovmfVarsTemplatePath
+		if firmware.SecureBoot {
+			codePath, varsTemplatePath = ovmfSecureBootCodePath, ovmfSecureBootVarsTemplatePath
+		}
+		if _, err := os.Stat(codePath); err != nil {
+			return nil, "", fmt.Errorf("OVMF firmware is not available: %w", err)
+		}
+		if err := copyFile(varsTemplatePath, ovmfVarsPath); err != nil {
+			return nil, "", fmt.Errorf("failed to create UEFI variables: %w", err)
+		}
+
+		args = []string{
+			"-drive", fmt.Sprintf("if=pflash,format=raw,unit=0,readonly=on,file=%s", codePath),
+			"-drive", fmt.Sprintf("if=pflash,format=raw,unit=1,file=%s", ovmfVarsPath),
+		}
+		if firmware.SecureBoot {
+			// Secure boot relies on SMM to stop the guest from modifying the variables itself.
+			args = append(args, "-global", "driver=cfi.pflash01,property=secure,value=on")
+			machineOptions = ",smm=on"
+		}
+		return args, machineOptions, nil
+	default:
+		return nil, "", fmt.Errorf("unknown firmware type %q", fwType)
+	}
+}
@@ -0,0 +1,472 @@
+package main
+
+// Running commands and accessing files in the guest via the QEMU guest agent (qemu-ga), which the
+// guest runs on the org.qemu.guest_agent.0 virtio serial port.
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+const (
+	defaultGuestExecTimeout = 60 * time.Second
+	// maxGuestExecTimeout is the longest that a command may run for. Longer-running commands should
+	// be started in the background by the guest's own tooling instead.
+	maxGuestExecTimeout = 10 * time.Minute
+	// guestExecPollInterval is how often we check whether a command has exited. The guest agent is
+	// only locked while checking, so that other requests can use it in between.
+	guestExecPollInterval = 500 * time.Millisecond
+)
+
+// guestAgentLock serializes access to the guest agent, which only handles one client at a time.
+var guestAgentLock sync.Mutex
+
+type guestAgentConn struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+}
+
+type guestAgentResponse struct {
+	Return json.RawMessage `json:"return"`
+	Error  *struct {
+		Class string `json:"class"`
+		Desc  string `json:"desc"`
+	} `json:"error"`
+}
+
+// connectGuestAgent connects to the guest agent, and synchronizes with it so that any stale
+// responses from previous clients are discarded.
+func connectGuestAgent() (*guestAgentConn, error) {
+	conn, err := net.DialTimeout("unix", guestAgentSocket, 2*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to guest agent: %w", err)
+	}
+	c := &guestAgentConn{conn: conn, scanner: bufio.NewScanner(conn)}
+	// guest-exec-status output can be large
+	c.scanner.Buffer(nil, 64*1024*1024)
+
+	id := rand.Int63()
+	var syncID int64
+	err = c.run("guest-sync", map[string]any{"id": id}, &syncID)
+	// Any leftover responses from a previous client come first, so skip them.
+	for tries := 0; (err != nil || syncID != id) && tries < 10; tries++ {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, os.ErrDeadlineExceeded) {
+			break
+		}
+		err = c.read(&syncID)
+	}
+	if err == nil && syncID != id {
+		err = errors.New("no matching guest-sync response")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to sync with guest agent: %w", err)
+	}
+	return c, nil
+}
+
+func (c *guestAgentConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *guestAgentConn) run(command string, arguments any, result any) error {
+	if err := c.send(command, arguments); err != nil {
+		return err
+	}
+	return c.read(result)
+}
+
+func (c *guestAgentConn) send(command string, arguments any) error {
+	req, err := json.Marshal(map[string]any{"execute": command, "arguments": arguments})
+	if err != nil {
+		return err
+	}
+	_ = c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.conn.Write(append(req, '\n')); err != nil {
+		return fmt.Errorf("failed to send %s: %w", command, err)
+	}
+	return nil
+}
+
+func (c *guestAgentConn) read(result any) error {
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return err
+		}
+		return io.ErrUnexpectedEOF
+	}
+	var resp guestAgentResponse
+	if err := json.Unmarshal(c.scanner.Bytes(), &resp); err != nil {
+		return fmt.Errorf("failed to unmarshal guest agent response: %w", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("guest agent error %s: %s", resp.Error.Class, resp.Error.Desc)
+	}
+	return json.Unmarshal(resp.Return, result)
+}
+
+// guestSetTime sets the guest's system clock, and its hardware clock from that.
+func guestSetTime(now time.Time) error {
+	guestAgentLock.Lock()
+	defer guestAgentLock.Unlock()
+
+	c, err := connectGuestAgent()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	var ignored json.RawMessage
+	return c.run("guest-set-time", map[string]any{"time": now.UnixNano()}, &ignored)
+}
+
+var errGuestAgentBusy = errors.New("guest agent is busy")
+
+// guestShutdown asks the guest to power off via the guest agent.
+//
+// The guest agent may be busy running a long command, so this doesn't wait for it.
+func guestShutdown() error {
+	if !guestAgentLock.TryLock() {
+		return errGuestAgentBusy
+	}
+	defer guestAgentLock.Unlock()
+
+	c, err := connectGuestAgent()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.send("guest-shutdown", map[string]any{"mode": "powerdown"}); err != nil {
+		return err
+	}
+	// guest-shutdown doesn't respond on success, so we can only check for an immediate error.
+	_ = c.conn.SetReadDeadline(time.Now().Add(time.Second))
+	var ignored json.RawMessage
+	err = c.read(&ignored)
+	if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+	return nil
+}
+
+// guestFstrimTimeout is how long we wait for guest-fstrim, which can take a while on large
+// filesystems.
+const guestFstrimTimeout = 5 * time.Minute
+
+type guestFstrimResult struct {
+	Path    string `json:"path"`
+	Trimmed int64  `json:"trimmed"`
+	Error   string `json:"error"`
+}
+
+// guestFstrim trims every mounted filesystem in the guest, returning the result for each.
+//
+// The guest agent is locked until the trim is done, so in the meantime, graceful shutdown falls
+// back to ACPI.
+func guestFstrim() ([]guestFstrimResult, error) {
+	var result struct {
+		Paths []guestFstrimResult `json:"paths"`
+	}
+	err := withGuestAgent(func(c *guestAgentConn) error {
+		if err := c.send("guest-fstrim", map[string]any{}); err != nil {
+			return err
+		}
+		_ = c.conn.SetReadDeadline(time.Now().Add(guestFstrimTimeout))
+		return c.read(&result)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Paths, nil
+}
+
+var errGuestExecTimeout = errors.New("timed out waiting for command to exit")
+
+// withGuestAgent runs f with a new connection to the guest agent, holding guestAgentLock.
+func withGuestAgent(f func(c *guestAgentConn) error) error {
+	guestAgentLock.Lock()
+	defer guestAgentLock.Unlock()
+
+	c, err := connectGuestAgent()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return f(c)
+}
+
+// guestExecTimeout returns how long to wait for the command in the request to exit, or an error if
+// the request's timeout is too long.
+func guestExecTimeout(req api.GuestExecRequest) (time.Duration, error) {
+	if req.TimeoutSeconds == 0 {
+		return defaultGuestExecTimeout, nil
+	}
+	timeout := time.Duration(req.TimeoutSeconds) * time.Second
+	if timeout > maxGuestExecTimeout {
+		return 0, fmt.Errorf("timeout %s is longer than the maximum of %s", timeout, maxGuestExecTimeout)
+	}
+	return timeout, nil
+}
+
+// guestExec runs the command in the guest and waits for it to exit, or until the timeout or the
+// context is done.
+//
+// The guest agent is locked only while starting the command and checking its status, so that long
+// commands don't block other uses of the guest agent, like graceful shutdown.
+func guestExec(ctx context.Context, req api.GuestExecRequest, timeout time.Duration) (*api.GuestExecResult, error) {
+	args := map[string]any{
+		"path":           req.Command[0],
+		"arg":            req.Command[1:],
+		"capture-output": true,
+	}
+	if len(req.Stdin) != 0 {
+		args["input-data"] = req.Stdin // base64-encoded by encoding/json
+	}
+	var started struct {
+		PID int `json:"pid"`
+	}
+	err := withGuestAgent(func(c *guestAgentConn) error {
+		return c.run("guest-exec", args, &started)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var status struct {
+			Exited   bool   `json:"exited"`
+			ExitCode int    `json:"exitcode"`
+			Signal   int    `json:"signal"`
+			OutData  []byte `json:"out-data"`
+			ErrData  []byte `json:"err-data"`
+		}
+		err = withGuestAgent(func(c *guestAgentConn) error {
+			return c.run("guest-exec-status", map[string]any{"pid": started.PID}, &status)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if status.Exited {
+			return &api.GuestExecResult{
+				ExitCode: status.ExitCode,
+				Stdout:   status.OutData,
+				Stderr:   status.ErrData,
+				Signal:   status.Signal,
+			}, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, errGuestExecTimeout
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(guestExecPollInterval):
+		}
+	}
+}
+
+func handleGuestExec(logger *zap.Logger, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		logger.Error("unexpected method", zap.String("method", r.Method))
+		w.WriteHeader(400)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.Error("could not read body", zap.Error(err))
+		w.WriteHeader(400)
+		return
+	}
+
+	var parsed api.GuestExecRequest
+	if err = json.Unmarshal(body, &parsed); err != nil {
+		logger.Error("could not parse body", zap.Error(err))
+		w.WriteHeader(400)
+		return
+	}
+	if len(parsed.Command) == 0 {
+		logger.Error("empty command")
+		w.WriteHeader(400)
+		return
+	}
+	timeout, err := guestExecTimeout(parsed)
+	if err != nil {
+		logger.Error("invalid timeout", zap.Error(err))
+		w.WriteHeader(400)
+		return
+	}
+
+	logger.Info("running command in guest", zap.Strings("command", parsed.Command), zap.Duration("timeout", timeout))
+	result, err := guestExec(r.Context(), parsed, timeout)
+	if err != nil {
+		logger.Error("could not run command in guest", zap.Error(err))
+		if errors.Is(err, errGuestExecTimeout) {
+			w.WriteHeader(504)
+		} else {
+			w.WriteHeader(500)
+		}
+		return
+	}
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("could not marshal result", zap.Error(err))
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_, _ = w.Write(resultJSON)
+}
+
+const (
+	// guestFileChunkSize is the amount of data read from or written to guest files per guest agent
+	// command. The guest agent is only locked for each chunk, not the whole transfer.
+	guestFileChunkSize = 1024 * 1024
+	// guestFileTransferTimeout is the longest that reading or writing a file in the guest may take.
+	guestFileTransferTimeout = 10 * time.Minute
+)
+
+// openGuestFile opens the file in the guest, returning its guest agent handle.
+//
+// Handles are not tied to the connection that opened them, so they can be used across calls to
+// withGuestAgent.
+func openGuestFile(path string, mode string) (int, error) {
+	var handle int
+	err := withGuestAgent(func(c *guestAgentConn) error {
+		return c.run("guest-file-open", map[string]any{"path": path, "mode": mode}, &handle)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return handle, nil
+}
+
+func closeGuestFile(handle int) error {
+	return withGuestAgent(func(c *guestAgentConn) error {
+		var result struct{}
+		return c.run("guest-file-close", map[string]any{"handle": handle}, &result)
+	})
+}
+
+// readGuestFile copies the contents of the file in the guest to w, until the context is done.
+func readGuestFile(ctx context.Context, path string, w io.Writer) error {
+	handle, err := openGuestFile(path, "r")
+	if err != nil {
+		return err
+	}
+	defer closeGuestFile(handle) //nolint:errcheck // nothing to do with error when deferred
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var chunk struct {
+			Buf []byte `json:"buf-b64"`
+			EOF bool   `json:"eof"`
+		}
+		err := withGuestAgent(func(c *guestAgentConn) error {
+			return c.run("guest-file-read", map[string]any{"handle": handle, "count": guestFileChunkSize}, &chunk)
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk.Buf); err != nil {
+			return err
+		}
+		if chunk.EOF || len(chunk.Buf) == 0 {
+			return nil
+		}
+	}
+}
+
+// writeGuestFile replaces the contents of the file in the guest with the data from r, until the
+// context is done.
+func writeGuestFile(ctx context.Context, path string, r io.Reader) error {
+	handle, err := openGuestFile(path, "w")
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, guestFileChunkSize)
+	for {
+		if err := ctx.Err(); err != nil {
+			_ = closeGuestFile(handle)
+			return err
+		}
+		n, readErr := io.ReadFull(r, buf)
+		if n != 0 {
+			err := withGuestAgent(func(c *guestAgentConn) error {
+				var written struct {
+					Count int `json:"count"`
+				}
+				return c.run("guest-file-write", map[string]any{"handle": handle, "buf-b64": buf[:n]}, &written)
+			})
+			if err != nil {
+				_ = closeGuestFile(handle)
+				return err
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		} else if readErr != nil {
+			_ = closeGuestFile(handle)
+			return readErr
+		}
+	}
+	return closeGuestFile(handle)
+}
+
+// handleGuestFile reads (GET) or writes (PUT) the file in the guest given by the 'path' query
+// parameter.
+func handleGuestFile(logger *zap.Logger, w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		logger.Error("missing path")
+		w.WriteHeader(400)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), guestFileTransferTimeout)
+	defer cancel()
+
+	switch r.Method {
+	case "GET":
+		logger.Info("reading file from guest", zap.String("path", path))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if err := readGuestFile(ctx, path, w); err != nil {
+			logger.Error("could not read file from guest", zap.String("path", path), zap.Error(err))
+			// Abort the response, so that the client doesn't mistake partial contents for the
+			// whole file. If nothing was written yet, this is still reported as an error.
+			panic(http.ErrAbortHandler)
+		}
+	case "PUT":
+		logger.Info("writing file to guest", zap.String("path", path))
+		if err := writeGuestFile(ctx, path, r.Body); err != nil {
+			logger.Error("could not write file to guest", zap.String("path", path), zap.Error(err))
+			w.WriteHeader(500)
+			return
+		}
+		w.WriteHeader(200)
+	default:
+		logger.Error("unexpected method", zap.String("method", r.Method))
+		w.WriteHeader(400)
+	}
+}
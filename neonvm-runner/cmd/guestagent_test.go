@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeGuestAgentCommand struct {
+	Execute   string          `json:"execute"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// fakeGuestAgent records the commands it receives, other than guest-sync.
+type fakeGuestAgent struct {
+	mu       sync.Mutex
+	commands []fakeGuestAgentCommand
+}
+
+func (a *fakeGuestAgent) received() []fakeGuestAgentCommand {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]fakeGuestAgentCommand{}, a.commands...)
+}
+
+// startFakeGuestAgent replaces the guest agent socket with one that answers guest-sync itself, and
+// every other command with the value returned by handle.
+func startFakeGuestAgent(t *testing.T, handle func(cmd fakeGuestAgentCommand) any) *fakeGuestAgent {
+	// Unix socket paths are limited in length, so t.TempDir() may be too long.
+	dir, err := os.MkdirTemp("", "qga")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "qga.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	oldSocket := guestAgentSocket
+	guestAgentSocket = socket
+	t.Cleanup(func() { guestAgentSocket = oldSocket })
+
+	//nolint:exhaustruct // the commands are added as they're received
+	agent := &fakeGuestAgent{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.serve(conn, handle)
+		}
+	}()
+	return agent
+}
+
+func (a *fakeGuestAgent) serve(conn net.Conn, handle func(cmd fakeGuestAgentCommand) any) {
+	defer conn.Close()
+
+	enc := json.NewEncoder(conn)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var cmd fakeGuestAgentCommand
+		if err := json.Unmarshal(scanner.Bytes(), &cmd); err != nil {
+			return
+		}
+
+		var resp any
+		if cmd.Execute == "guest-sync" {
+			var args struct {
+				ID int64 `json:"id"`
+			}
+			_ = json.Unmarshal(cmd.Arguments, &args)
+			resp = map[string]any{"return": args.ID}
+		} else {
+			a.mu.Lock()
+			a.commands = append(a.commands, cmd)
+			a.mu.Unlock()
+			resp = handle(cmd)
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+func guestAgentOK(cmd fakeGuestAgentCommand) any {
+	return map[string]any{"return": map[string]any{}}
+}
+
+func guestAgentError(cmd fakeGuestAgentCommand) any {
+	return map[string]any{"error": map[string]any{"class": "GenericError", "desc": "not allowed"}}
+}
+
+// setTimeArgument returns the time that a guest-set-time command sets the guest's clock to.
+func setTimeArgument(t *testing.T, cmd fakeGuestAgentCommand) time.Time {
+	require.Equal(t, "guest-set-time", cmd.Execute)
+	var args struct {
+		Time int64 `json:"time"`
+	}
+	require.NoError(t, json.Unmarshal(cmd.Arguments, &args))
+	return time.Unix(0, args.Time)
+}
+
+func TestGuestSetTime(t *testing.T) {
+	agent := startFakeGuestAgent(t, guestAgentOK)
+
+	now := time.Now()
+	require.NoError(t, guestSetTime(now))
+
+	commands := agent.received()
+	require.Len(t, commands, 1)
+	assert.Equal(t, now.UnixNano(), setTimeArgument(t, commands[0]).UnixNano())
+
+	t.Run("GuestAgentError", func(t *testing.T) {
+		startFakeGuestAgent(t, guestAgentError)
+		assert.ErrorContains(t, guestSetTime(now), "guest agent error GenericError: not allowed")
+	})
+
+	t.Run("NoGuestAgent", func(t *testing.T) {
+		oldSocket := guestAgentSocket
+		guestAgentSocket = filepath.Join(t.TempDir(), "missing.sock")
+		t.Cleanup(func() { guestAgentSocket = oldSocket })
+		assert.ErrorContains(t, guestSetTime(now), "failed to connect to guest agent")
+	})
+}
+
+func TestHandleClockSync(t *testing.T) {
+	logger := zap.NewNop()
+	call := func(method string) int {
+		rec := httptest.NewRecorder()
+		handleClockSync(logger, rec, httptest.NewRequest(method, "/clock_sync", nil))
+		return rec.Code
+	}
+
+	t.Run("SetsGuestTime", func(t *testing.T) {
+		agent := startFakeGuestAgent(t, guestAgentOK)
+
+		before := time.Now()
+		assert.Equal(t, http.StatusOK, call("POST"))
+		after := time.Now()
+
+		// The guest's clock is set from the host's, at the time of the request
+		commands := agent.received()
+		require.Len(t, commands, 1)
+		set := setTimeArgument(t, commands[0])
+		assert.False(t, set.Before(before.Truncate(0)), "guest time %s is before the request", set)
+		assert.False(t, set.After(after.Truncate(0)), "guest time %s is after the request", set)
+	})
+
+	t.Run("WrongMethod", func(t *testing.T) {
+		agent := startFakeGuestAgent(t, guestAgentOK)
+		assert.Equal(t, http.StatusBadRequest, call("GET"))
+		assert.Empty(t, agent.received())
+	})
+
+	t.Run("GuestAgentError", func(t *testing.T) {
+		startFakeGuestAgent(t, guestAgentError)
+		assert.Equal(t, http.StatusInternalServerError, call("POST"))
+	})
+}
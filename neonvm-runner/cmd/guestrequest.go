@@ -0,0 +1,66 @@
+package main
+
+// Implementation of 'runner guest-request', which kubectl-neonvm runs in the runner container to
+// reach the endpoints on api.RunnerGuestSocket. See api.RunnerGuestRequestCommand for more.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+// runGuestRequest sends the request given by args (METHOD PATH) to api.RunnerGuestSocket, returning
+// the exit code for the command.
+func runGuestRequest(args []string) int {
+	if len(args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: runner %s METHOD PATH\n", api.RunnerGuestRequestCommand)
+		return 2
+	}
+	method, path := args[0], args[1]
+
+	var body io.Reader
+	if method == http.MethodPost || method == http.MethodPut {
+		body = os.Stdin
+	}
+	req, err := http.NewRequest(method, "http://runner"+path, body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid request: %s\n", err)
+		return 1
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := http.Client{
+		Transport: &http.Transport{ //nolint:exhaustruct // only the dialer is changed
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", api.RunnerGuestSocket)
+			},
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "request to runner failed: %s\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		respBody, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "runner responded with status %s: %s\n", resp.Status, bytes.TrimSpace(respBody))
+		return 1
+	}
+	// The runner aborts the response if it fails partway, which shows up as an error here.
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read response from runner: %s\n", err)
+		return 1
+	}
+	return 0
+}
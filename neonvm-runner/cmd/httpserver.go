@@ -6,7 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -30,7 +33,11 @@ func listenForHTTPRequests(
 	port int32,
 	callbacks cpuServerCallbacks,
 	wg *sync.WaitGroup,
+	reg *prometheus.Registry,
 	networkMonitoring bool,
+	freePageReporting bool,
+	qemu *qemuProcess,
+	guestMetrics *vmv1.GuestMetrics,
 ) {
 	defer wg.Done()
 	mux := http.NewServeMux()
@@ -43,6 +50,18 @@ func listenForHTTPRequests(
 	mux.HandleFunc("/cpu_current", func(w http.ResponseWriter, r *http.Request) {
 		handleCPUCurrent(cpuCurrentLogger, w, r, callbacks.get)
 	})
+	networkLimitsLogger := loggerHandlers.Named("network_limits")
+	mux.HandleFunc("/network_limits", func(w http.ResponseWriter, r *http.Request) {
+		handleNetworkLimitsChange(networkLimitsLogger, w, r)
+	})
+	clockSyncLogger := loggerHandlers.Named("clock_sync")
+	mux.HandleFunc("/clock_sync", func(w http.ResponseWriter, r *http.Request) {
+		handleClockSync(clockSyncLogger, w, r)
+	})
+	shutdownStageLogger := loggerHandlers.Named("shutdown_stage")
+	mux.HandleFunc("/shutdown_stage", func(w http.ResponseWriter, r *http.Request) {
+		handleShutdownStage(shutdownStageLogger, w, r)
+	})
 	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
 		if callbacks.ready(logger) {
 			w.WriteHeader(200)
@@ -50,25 +69,80 @@ func listenForHTTPRequests(
 			w.WriteHeader(500)
 		}
 	})
+	var netMetrics *NetworkMonitoringMetrics
 	if networkMonitoring {
-		reg := prometheus.NewRegistry()
-		metrics := NewMonitoringMetrics(reg)
-		mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
-			metrics.update(logger)
-			h := promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
-			h.ServeHTTP(w, r)
+		netMetrics = NewMonitoringMetrics(reg)
+	}
+	var memMetrics *FreePageReportingMetrics
+	if freePageReporting {
+		memMetrics = NewFreePageReportingMetrics(reg, qemu)
+	}
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if netMetrics != nil {
+			netMetrics.update(logger)
+		}
+		if memMetrics != nil {
+			memMetrics.update(logger)
+		}
+		h := promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
+		h.ServeHTTP(w, r)
+	})
+	if guestMetrics != nil {
+		guestMetricsLogger := loggerHandlers.Named("guest_metrics")
+		mux.HandleFunc("/guest_metrics", func(w http.ResponseWriter, r *http.Request) {
+			handleGuestMetrics(guestMetricsLogger, w, r, guestMetrics)
 		})
 	}
 	server := http.Server{
-		Addr:              fmt.Sprintf("0.0.0.0:%d", port),
+		Addr:              fmt.Sprintf(":%d", port),
 		Handler:           mux,
 		ReadTimeout:       5 * time.Second,
 		ReadHeaderTimeout: 5 * time.Second,
 		WriteTimeout:      5 * time.Second,
 	}
-	errChan := make(chan error)
+
+	// The debug endpoints give direct access to the guest, so they're only served on localhost,
+	// where they can't be reached by other pods. There's no read or write timeout because requests
+	// can be long-lived, and the handlers set their own limits.
+	debugMux := http.NewServeMux()
+	portForwardLogger := loggerHandlers.Named("port_forward")
+	debugMux.HandleFunc("/port_forward", func(w http.ResponseWriter, r *http.Request) {
+		handlePortForward(portForwardLogger, w, r)
+	})
+	debugServer := http.Server{
+		Addr:              fmt.Sprintf("127.0.0.1:%d", api.RunnerDebugPort),
+		Handler:           debugMux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	// Running commands in the guest is served separately, on a unix socket that can only be reached
+	// from inside the container, so that it needs pods/exec rather than pods/portforward.
+	guestMux := http.NewServeMux()
+	execLogger := loggerHandlers.Named("exec")
+	guestMux.HandleFunc("/exec", func(w http.ResponseWriter, r *http.Request) {
+		handleGuestExec(execLogger, w, r)
+	})
+	fileLogger := loggerHandlers.Named("file")
+	guestMux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		handleGuestFile(fileLogger, w, r)
+	})
+	guestServer := http.Server{
+		Handler:           guestMux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	guestListener, err := listenGuestSocket()
+	if err != nil {
+		logger.Fatal("failed to listen on guest socket", zap.Error(err))
+	}
+
+	errChan := make(chan error, 3)
+	for _, s := range []*http.Server{&server, &debugServer} {
+		go func() {
+			errChan <- s.ListenAndServe()
+		}()
+	}
 	go func() {
-		errChan <- server.ListenAndServe()
+		errChan <- guestServer.Serve(guestListener)
 	}()
 	select {
 	case err := <-errChan:
@@ -79,10 +153,24 @@ func listenForHTTPRequests(
 		}
 	case <-ctx.Done():
 		err := server.Shutdown(context.Background())
-		logger.Info("shut down http server", zap.Error(err))
+		debugErr := debugServer.Shutdown(context.Background())
+		guestErr := guestServer.Shutdown(context.Background())
+		logger.Info("shut down http servers", zap.Error(errors.Join(err, debugErr, guestErr)))
 	}
 }
 
+// listenGuestSocket listens on api.RunnerGuestSocket, removing any stale socket left over from a
+// previous run of the container.
+func listenGuestSocket() (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(api.RunnerGuestSocket), 0o700); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(api.RunnerGuestSocket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	return net.Listen("unix", api.RunnerGuestSocket)
+}
+
 func handleCPUChange(
 	logger *zap.Logger,
 	w http.ResponseWriter,
@@ -120,6 +208,120 @@ func handleCPUChange(
 	w.WriteHeader(200)
 }
 
+// handleGuestMetrics proxies a scrape of the metrics endpoint in the guest.
+func handleGuestMetrics(logger *zap.Logger, w http.ResponseWriter, r *http.Request, guestMetrics *vmv1.GuestMetrics) {
+	if r.Method != "GET" {
+		logger.Error("unexpected method", zap.String("method", r.Method))
+		w.WriteHeader(400)
+		return
+	}
+
+	addr, err := guestAddr(int(guestMetrics.Port))
+	if err != nil {
+		logger.Error("could not get guest address", zap.Error(err))
+		w.WriteHeader(500)
+		return
+	}
+	path := guestMetrics.Path
+	if path == "" {
+		path = "/metrics"
+	}
+
+	// stay within the server's 5s write timeout
+	ctx, cancel := context.WithTimeout(r.Context(), 4*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s", addr, path), nil)
+	if err != nil {
+		logger.Error("could not create request", zap.Error(err))
+		w.WriteHeader(500)
+		return
+	}
+	// pass through content negotiation, e.g. for the protobuf or OpenMetrics formats
+	if accept := r.Header.Get("Accept"); accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.Error("could not get metrics from guest", zap.Error(err))
+		w.WriteHeader(502)
+		return
+	}
+	defer resp.Body.Close()
+
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		logger.Error("could not copy metrics from guest", zap.Error(err))
+	}
+}
+
+func handleNetworkLimitsChange(logger *zap.Logger, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		logger.Error("unexpected method", zap.String("method", r.Method))
+		w.WriteHeader(400)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		logger.Error("could not read body", zap.Error(err))
+		w.WriteHeader(400)
+		return
+	}
+
+	var parsed api.NetworkLimitsChange
+	if err = json.Unmarshal(body, &parsed); err != nil {
+		logger.Error("could not parse body", zap.Error(err))
+		w.WriteHeader(400)
+		return
+	}
+
+	if err := setNetworkLimits(logger, parsed.Limits); err != nil {
+		logger.Error("could not set network limits", zap.Error(err))
+		w.WriteHeader(500)
+		return
+	}
+
+	w.WriteHeader(200)
+}
+
+func handleClockSync(logger *zap.Logger, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		logger.Error("unexpected method", zap.String("method", r.Method))
+		w.WriteHeader(400)
+		return
+	}
+
+	if err := guestSetTime(time.Now()); err != nil {
+		logger.Error("failed to set guest time", zap.Error(err))
+		w.WriteHeader(500)
+		return
+	}
+
+	logger.Info("Set guest time from host")
+	w.WriteHeader(200)
+}
+
+func handleShutdownStage(logger *zap.Logger, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		logger.Error("unexpected method", zap.String("method", r.Method))
+		w.WriteHeader(400)
+		return
+	}
+
+	body, err := json.Marshal(api.RunnerShutdownStatus{Stage: getShutdownStage()})
+	if err != nil {
+		logger.Error("could not marshal body", zap.Error(err))
+		w.WriteHeader(500)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	w.Write(body) //nolint:errcheck // Not much to do with the error here. TODO: log it?
+}
+
 func handleCPUCurrent(
 	logger *zap.Logger,
 	w http.ResponseWriter,
@@ -14,22 +14,21 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
-	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
-	"syscall"
 	"time"
 
-	"github.com/digitalocean/go-qemu/qmp"
-	"github.com/jpillora/backoff"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/samber/lo"
 	"go.uber.org/zap"
 
 	"k8s.io/apimachinery/pkg/api/resource"
 
 	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
 	"github.com/neondatabase/autoscaling/pkg/util"
 	"github.com/neondatabase/autoscaling/pkg/util/taskgroup"
 )
@@ -43,9 +42,15 @@ const (
 	architectureAmd64 = "amd64"
 	defaultKernelPath = "/vm/kernel/vmlinuz"
 
+	logSerialSocket    = "/vm/log.sock"
+	bufferedReaderSize = 4096
+)
+
+// The sockets that the runner uses to control QEMU and the guest. They're variables only so that
+// tests can replace them.
+var (
 	qmpUnixSocketForSigtermHandler = "/vm/qmp-sigterm.sock"
-	logSerialSocket                = "/vm/log.sock"
-	bufferedReaderSize             = 4096
+	guestAgentSocket               = "/vm/qga.sock"
 )
 
 func checkKVM() bool {
@@ -58,6 +63,35 @@ func checkKVM() bool {
 	return mode&os.ModeCharDevice == os.ModeCharDevice
 }
 
+// nestedVirtualizationFeature returns the CPU feature that exposes hardware virtualization to the
+// guest -- "vmx" on Intel, or "svm" on AMD -- checking that KVM on the host allows nesting.
+func nestedVirtualizationFeature() (string, error) {
+	if !checkKVM() {
+		return "", errors.New("/dev/kvm is not available")
+	}
+
+	modules := []struct {
+		module  string
+		feature string
+	}{
+		{"kvm_intel", "vmx"},
+		{"kvm_amd", "svm"},
+	}
+	for _, m := range modules {
+		nested, err := os.ReadFile(fmt.Sprintf("/sys/module/%s/parameters/nested", m.module))
+		if err != nil {
+			continue // module not loaded
+		}
+		switch strings.TrimSpace(string(nested)) {
+		case "Y", "1":
+			return m.feature, nil
+		default:
+			return "", fmt.Errorf("nesting is disabled in the %s module", m.module)
+		}
+	}
+	return "", errors.New("neither kvm_intel nor kvm_amd is loaded")
+}
+
 func checkDevTun() bool {
 	info, err := os.Stat("/dev/net/tun")
 	if err != nil {
@@ -108,8 +142,20 @@ type Config struct {
 	autoMovableRatio string
 	// cpuScalingMode is a mode to use for CPU scaling. Validated in newConfig.
 	cpuScalingMode vmv1.CpuScalingMode
+	// nodeTuningProfile is the path to the node's tuning profile. The file may not exist.
+	nodeTuningProfile string
 	// System CPU architecture. Set automatically equal to runtime.GOARCH.
 	architecture string
+	// saveMemoryImage is the path to save a memory image to, for a resume pool template.
+	saveMemoryImage string
+	// resumeMemoryImage is the path of a memory image to resume from, if it's on this node.
+	resumeMemoryImage string
+	// memoryImageMaxAge is the age after which memory images in the resume pool directory are
+	// removed.
+	memoryImageMaxAge time.Duration
+	// waitForVMMonitor is whether the runner only reports ready once vm-monitor in the guest is, so
+	// the controller can tell from the pod's status whether a new root disk image booted.
+	waitForVMMonitor bool
 }
 
 func newConfig(logger *zap.Logger) *Config {
@@ -122,7 +168,12 @@ func newConfig(logger *zap.Logger) *Config {
 		diskCacheSettings:    "cache=none",
 		autoMovableRatio:     "",
 		cpuScalingMode:       "",
+		nodeTuningProfile:    "",
 		architecture:         runtime.GOARCH,
+		saveMemoryImage:      "",
+		resumeMemoryImage:    "",
+		memoryImageMaxAge:    0,
+		waitForVMMonitor:     false,
 	}
 	flag.StringVar(&cfg.vmSpecDump, "vmspec", cfg.vmSpecDump,
 		"Base64 encoded VirtualMachine json specification")
@@ -140,6 +191,16 @@ func newConfig(logger *zap.Logger) *Config {
 	flag.StringVar(&cfg.autoMovableRatio, "memhp-auto-movable-ratio",
 		cfg.autoMovableRatio, "Set value of kernel's memory_hotplug.auto_movable_ratio [virtio-mem only]")
 	flag.Func("cpu-scaling-mode", "Set CPU scaling mode", cfg.cpuScalingMode.FlagFunc)
+	flag.StringVar(&cfg.nodeTuningProfile, "node-tuning-profile",
+		cfg.nodeTuningProfile, "Path to the node's hypervisor tuning profile, if any")
+	flag.StringVar(&cfg.saveMemoryImage, "save-memory-image",
+		cfg.saveMemoryImage, "Save a memory image of the booted VM to this path, and exit")
+	flag.StringVar(&cfg.resumeMemoryImage, "resume-memory-image",
+		cfg.resumeMemoryImage, "Resume the VM from the memory image at this path, if it exists")
+	flag.DurationVar(&cfg.memoryImageMaxAge, "resume-pool-max-age",
+		cfg.memoryImageMaxAge, "Remove memory images older than this from the resume pool directory")
+	flag.BoolVar(&cfg.waitForVMMonitor, "wait-for-vm-monitor",
+		cfg.waitForVMMonitor, "Only report ready once vm-monitor in the guest is ready")
 	flag.Parse()
 
 	if cfg.autoMovableRatio == "" {
@@ -148,11 +209,33 @@ func newConfig(logger *zap.Logger) *Config {
 	if cfg.cpuScalingMode == "" {
 		logger.Fatal("missing required flag '-cpu-scaling-mode'")
 	}
+	if cfg.cpuScalingMode == vmv1.CpuScalingModeCgroup && cfg.skipCgroupManagement {
+		logger.Fatal("cpu scaling mode " + string(vmv1.CpuScalingModeCgroup) + " requires cgroup management")
+	}
+	if cfg.saveMemoryImage != "" && cfg.resumeMemoryImage != "" {
+		logger.Fatal("flags '-save-memory-image' and '-resume-memory-image' are mutually exclusive")
+	}
 
 	return cfg
 }
 
+// cgroupOvercommitFactor returns the factor by which the QEMU cgroup's CPU limit should exceed the
+// VM's CPU usage.
+//
+// With cgroup-based scaling, the cgroup limit *is* the VM's CPU allocation, so no overcommit is
+// applied.
+func (cfg *Config) cgroupOvercommitFactor() vmv1.MilliCPU {
+	if cfg.cpuScalingMode == vmv1.CpuScalingModeCgroup {
+		return 1
+	}
+	return cpuLimitOvercommitFactor
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == api.RunnerGuestRequestCommand {
+		os.Exit(runGuestRequest(os.Args[2:]))
+	}
+
 	logger := zap.Must(zap.NewProduction()).Named("neonvm-runner")
 
 	if err := run(logger); err != nil {
@@ -163,6 +246,14 @@ func main() {
 func run(logger *zap.Logger) error {
 	cfg := newConfig(logger)
 
+	tuning, err := loadNodeTuningProfile(cfg.nodeTuningProfile)
+	if err != nil {
+		return err
+	}
+	if err := tuning.applyToProcess(logger); err != nil {
+		return err
+	}
+
 	vmSpecJson, err := base64.StdEncoding.DecodeString(cfg.vmSpecDump)
 	if err != nil {
 		return fmt.Errorf("failed to decode VirtualMachine Spec dump: %w", err)
@@ -206,6 +297,9 @@ func run(logger *zap.Logger) error {
 	if vmSpec.Guest.Settings != nil {
 		sysctl = append(sysctl, vmSpec.Guest.Settings.Sysctl...)
 		swapSize = vmSpec.Guest.Settings.Swap
+		if swapSize != nil && vmSpec.Guest.Settings.Swappiness != nil {
+			sysctl = append(sysctl, fmt.Sprintf("vm.swappiness=%d", *vmSpec.Guest.Settings.Swappiness))
+		}
 
 		// By default, Linux sets the size of /dev/shm to 1/2 of the physical memory.  If
 		// swap is configured, we want to set /dev/shm higher, because we can autoscale
@@ -218,6 +312,21 @@ func run(logger *zap.Logger) error {
 		}
 	}
 
+	// Claim the memory image before anything touches the root disk, because resuming replaces it.
+	// At most one of these is set, so either way this is the node's resume pool directory.
+	for _, image := range []string{cfg.saveMemoryImage, cfg.resumeMemoryImage} {
+		if image != "" && cfg.memoryImageMaxAge != 0 {
+			removeStaleMemoryImages(logger, filepath.Dir(image), cfg.memoryImageMaxAge)
+		}
+	}
+	var resumeImage string
+	if cfg.resumeMemoryImage != "" {
+		resumeImage, err = claimMemoryImage(logger, cfg.resumeMemoryImage)
+		if err != nil {
+			logger.Warn("Could not resume from memory image, booting as usual", zap.Error(err))
+		}
+	}
+
 	tg := taskgroup.NewGroup(logger)
 	tg.Go("init-script", func(logger *zap.Logger) error {
 		return runInitScript(logger, vmSpec.InitScript)
@@ -254,6 +363,7 @@ func run(logger *zap.Logger) error {
 			enableSSH,
 			swapSize,
 			shmSize,
+			hostname,
 		)
 	})
 
@@ -265,7 +375,7 @@ func run(logger *zap.Logger) error {
 
 	tg.Go("qemu-cmd", func(logger *zap.Logger) error {
 		var err error
-		qemuCmd, err = buildQEMUCmd(cfg, logger, vmSpec, &vmStatus, enableSSH, swapSize, hostname)
+		qemuCmd, err = buildQEMUCmd(cfg, logger, vmSpec, &vmStatus, tuning, enableSSH, swapSize, hostname, resumeImage)
 		return err
 	})
 
@@ -273,7 +383,12 @@ func run(logger *zap.Logger) error {
 		return err
 	}
 
-	err = runQEMU(cfg, logger, vmSpec, qemuCmd)
+	// the tap device exists now that the networks are set up, so we can apply limits to it.
+	if err := setNetworkLimits(logger, vmSpec.Network.GetLimits()); err != nil {
+		return err
+	}
+
+	err = runQEMU(cfg, logger, vmSpec, qemuCmd, resumeImage)
 	if err != nil {
 		return fmt.Errorf("failed to run QEMU: %w", err)
 	}
@@ -286,39 +401,53 @@ func buildQEMUCmd(
 	logger *zap.Logger,
 	vmSpec *vmv1.VirtualMachineSpec,
 	vmStatus *vmv1.VirtualMachineStatus,
+	tuning *nodeTuningProfile,
 	enableSSH bool,
 	swapSize *resource.Quantity,
 	hostname string,
+	resumeImage string,
 ) ([]string, error) {
+	bus := getVirtioBus(vmSpec.MachineType)
+
+	fwArgs, fwMachineOptions, err := firmwareArgs(cfg.architecture, vmSpec.Guest.Firmware)
+	if err != nil {
+		return nil, err
+	}
+
 	// prepare qemu command line
 	qemuCmd := []string{
 		"-runas", "qemu",
-		"-machine", getMachineType(cfg.architecture),
+		"-machine", getMachineType(cfg.architecture, vmSpec.MachineType) + fwMachineOptions + tuning.machineOptions(),
 		"-nographic",
 		"-no-reboot",
 		"-nodefaults",
-		"-only-migratable",
 		"-audiodev", "none,id=noaudio",
 		"-serial", "pty",
 		"-msg", "timestamp=on",
-		"-qmp", fmt.Sprintf("tcp:0.0.0.0:%d,server,wait=off", vmSpec.QMP),
-		"-qmp", fmt.Sprintf("tcp:0.0.0.0:%d,server,wait=off", vmSpec.QMPManual),
+		"-qmp", fmt.Sprintf("tcp:%s:%d,server,wait=off", anyHost(), vmSpec.QMP),
+		"-qmp", fmt.Sprintf("tcp:%s:%d,server,wait=off", anyHost(), vmSpec.QMPManual),
 		"-qmp", fmt.Sprintf("unix:%s,server,wait=off", qmpUnixSocketForSigtermHandler),
-		"-device", "virtio-serial",
+		"-device", bus.device("virtio-serial"),
 		"-chardev", fmt.Sprintf("socket,path=%s,server=on,wait=off,id=log", logSerialSocket),
 		"-device", "virtserialport,chardev=log,name=tech.neon.log.0",
+		"-chardev", fmt.Sprintf("socket,path=%s,server=on,wait=off,id=qga0", guestAgentSocket),
+		"-device", "virtserialport,chardev=qga0,name=org.qemu.guest_agent.0",
+	}
+	// resumed VMs must have exactly the same devices as the template they were saved from
+	if cfg.saveMemoryImage != "" || cfg.resumeMemoryImage != "" {
+		qemuCmd = append(qemuCmd, resumePortArgs(cfg.architecture)...)
 	}
 
-	qemuDiskArgs, err := setupVMDisks(logger, cfg.diskCacheSettings, enableSSH, swapSize, vmSpec.Disks)
+	qemuDiskArgs, err := setupVMDisks(logger, bus, cfg.diskCacheSettings, enableSSH, swapSize, vmSpec.Disks)
 	if err != nil {
 		return nil, err
 	}
 	qemuCmd = append(qemuCmd, qemuDiskArgs...)
 
+	qemuCmd = append(qemuCmd, fwArgs...)
+
 	switch cfg.architecture {
 	case architectureArm64:
-		// add custom firmware to have ACPI working
-		qemuCmd = append(qemuCmd, "-bios", "/vm/QEMU_EFI_ARM.fd")
 		// arm virt has only one UART, setup virtio-serial to add more /dev/hvcX
 		qemuCmd = append(qemuCmd,
 			"-chardev", "stdio,id=virtio-console",
@@ -339,15 +468,43 @@ func buildQEMUCmd(
 	} else {
 		logger.Warn("not using KVM acceleration")
 	}
-	qemuCmd = append(qemuCmd, "-cpu", "max")
+	// Without an explicit model, pass through everything the host supports. That's the fastest,
+	// but only allows migrating between hosts with the same CPU.
+	cpuModel := []string{"max"}
+	if features := vmSpec.Guest.CPUFeatures; features != nil {
+		cpuModel = []string{features.BaseModel}
+	}
+	if vmSpec.Guest.NestedVirtualization != nil && *vmSpec.Guest.NestedVirtualization {
+		feature, err := nestedVirtualizationFeature()
+		if err != nil {
+			return nil, fmt.Errorf("nested virtualization is not available: %w", err)
+		}
+		logger.Info("enabling nested virtualization", zap.String("feature", feature))
+		cpuModel = append(cpuModel, "+"+feature)
+	}
+	if features := vmSpec.Guest.CPUFeatures; features != nil {
+		for _, f := range features.Enable {
+			cpuModel = append(cpuModel, "+"+f)
+		}
+		for _, f := range features.Disable {
+			cpuModel = append(cpuModel, "-"+f)
+		}
+		// Make QEMU fail if the host doesn't support all the features of the model or that we
+		// asked for, rather than silently starting without them -- otherwise the VM may not be
+		// able to migrate back.
+		cpuModel = append(cpuModel, "enforce")
+	}
+	qemuCmd = append(qemuCmd, "-cpu", strings.Join(cpuModel, ","))
+	qemuCmd = append(qemuCmd, tuning.qemuArgs()...)
 
 	// cpu scaling details
 	maxCPUs := vmSpec.Guest.CPUs.Max.RoundedUp()
 	minCPUs := vmSpec.Guest.CPUs.Min.RoundedUp()
 
 	switch cfg.cpuScalingMode {
-	case vmv1.CpuScalingModeSysfs:
-		// Boot with all CPUs plugged, we will online them on-demand
+	case vmv1.CpuScalingModeSysfs, vmv1.CpuScalingModeCgroup:
+		// Boot with all CPUs plugged. For sysfs, we will online them on-demand. For cgroup, they
+		// all stay online and only the cgroup limit changes.
 		qemuCmd = append(qemuCmd, "-smp", fmt.Sprintf(
 			"cpus=%d,maxcpus=%d,sockets=1,cores=%d,threads=1",
 			maxCPUs,
@@ -384,15 +541,47 @@ func buildQEMUCmd(
 	//   property 'size' of memory-backend-ram doesn't take value '0'
 	if virtioMemSize != 0 {
 		qemuCmd = append(qemuCmd, "-object", fmt.Sprintf("memory-backend-ram,id=vmem0,size=%db", virtioMemSize))
-		qemuCmd = append(qemuCmd, "-device", "virtio-mem-pci,id=vm0,memdev=vmem0,block-size=8M,requested-size=0")
+		qemuCmd = append(qemuCmd, "-device", fmt.Sprintf("virtio-mem-pci,id=vm0,memdev=vmem0,block-size=%db,requested-size=0", vmSpec.Guest.VirtioMemBlockSizeBytes()))
+	}
+
+	// free page reporting lets the guest hand back memory it isn't using, without us needing to
+	// actively inflate the balloon.
+	if vmSpec.EnableFreePageReporting != nil && *vmSpec.EnableFreePageReporting {
+		qemuCmd = append(qemuCmd, "-device", bus.device("virtio-balloon")+",id=balloon0,free-page-reporting=on")
 	}
 
-	qemuNetArgs, err := setupVMNetworks(logger, vmSpec.Guest.Ports, vmSpec.ExtraNetwork)
+	// virtio-rng gives the guest entropy from the host, so that it doesn't have to wait for its own
+	// after booting.
+	if entropy := vmSpec.Entropy; entropy != nil && (entropy.Enabled == nil || *entropy.Enabled) {
+		source := entropy.Source
+		if source == "" {
+			source = vmv1.EntropySourceURandom
+		}
+		qemuCmd = append(qemuCmd, "-object", fmt.Sprintf("rng-random,id=rng0,filename=%s", source))
+		qemuCmd = append(qemuCmd, "-device", bus.device("virtio-rng")+",rng=rng0")
+	}
+
+	// the guest's side of the watchdog is added by makeKernelCmdline
+	watchdogQEMUArgs, _ := watchdogArgs(vmSpec.Watchdog)
+	qemuCmd = append(qemuCmd, watchdogQEMUArgs...)
+
+	qemuNetArgs, err := setupVMNetworks(logger, bus, vmSpec.Guest.Ports, vmSpec.ExtraNetwork, vmSpec.Network.GetDNS(), vmSpec.Network.GetMTU(), tuning.vhostNet())
 	if err != nil {
 		return nil, err
 	}
 	qemuCmd = append(qemuCmd, qemuNetArgs...)
 
+	if vmSpec.SRIOVNetwork != nil {
+		sriovArgs, err := setupSRIOVNetwork(logger, vmSpec.SRIOVNetwork)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up SR-IOV network: %w", err)
+		}
+		qemuCmd = append(qemuCmd, sriovArgs...)
+	} else {
+		// VFIO devices are not migratable, so we can only make this check without them.
+		qemuCmd = append(qemuCmd, "-only-migratable")
+	}
+
 	// kernel details
 	qemuCmd = append(
 		qemuCmd,
@@ -402,7 +591,15 @@ func buildQEMUCmd(
 
 	// should runner receive migration ?
 	if os.Getenv("RECEIVE_MIGRATION") == "true" {
-		qemuCmd = append(qemuCmd, "-incoming", fmt.Sprintf("tcp:0:%d", vmv1.MigrationPort))
+		qemuCmd = append(qemuCmd, "-incoming", fmt.Sprintf("tcp:%s:%d", anyHost(), vmv1.MigrationPort))
+	} else if resumeImage != "" {
+		qemuCmd = append(qemuCmd, "-incoming", fmt.Sprintf("exec:cat %s", resumeImage))
+	}
+
+	// extra args were checked against the controller's allowlist when the VM was created.
+	if len(vmSpec.Guest.ExtraArgs) != 0 {
+		logger.Info("Adding extra QEMU arguments", zap.Strings("args", vmSpec.Guest.ExtraArgs))
+		qemuCmd = append(qemuCmd, vmSpec.Guest.ExtraArgs...)
 	}
 
 	return qemuCmd, nil
@@ -428,6 +625,27 @@ func makeKernelCmdline(cfg *Config, logger *zap.Logger, vmSpec *vmv1.VirtualMach
 		cmdlineParts = append(cmdlineParts, fmt.Sprintf("hostname=%s", hostname))
 	}
 
+	if settings := vmSpec.Guest.Settings; settings != nil && settings.Swap != nil && settings.Zswap != nil {
+		if *settings.Zswap {
+			cmdlineParts = append(cmdlineParts, "zswap.enabled=1")
+		} else {
+			cmdlineParts = append(cmdlineParts, "zswap.enabled=0")
+		}
+	}
+
+	if vmSpec.Guest.Settings.GetClockSync() == vmv1.ClockSyncKVMClock {
+		// neonvm.clock_sync is read by the guest's init, to skip running chrony.
+		cmdlineParts = append(cmdlineParts, "clocksource=kvm-clock", "neonvm.clock_sync=kvm-clock")
+	}
+
+	// neonvm.watchdog is read by the guest's init, to start petting the watchdog.
+	_, watchdogKernelArgs := watchdogArgs(vmSpec.Watchdog)
+	cmdlineParts = append(cmdlineParts, watchdogKernelArgs...)
+
+	if cfg.saveMemoryImage != "" {
+		cmdlineParts = append(cmdlineParts, resumeTemplateKernelArg)
+	}
+
 	if cfg.appendKernelCmdline != "" {
 		cmdlineParts = append(cmdlineParts, cfg.appendKernelCmdline)
 	}
@@ -448,14 +666,51 @@ func makeKernelCmdline(cfg *Config, logger *zap.Logger, vmSpec *vmv1.VirtualMach
 		logger.Fatal("unsupported architecture", zap.String("architecture", cfg.architecture))
 	}
 
+	// The VM's own arguments go last, so that they take precedence.
+	if len(vmSpec.Guest.KernelArgs) != 0 {
+		logger.Info("Adding extra kernel arguments", zap.Strings("args", vmSpec.Guest.KernelArgs))
+		cmdlineParts = append(cmdlineParts, vmSpec.Guest.KernelArgs...)
+	}
+
 	return strings.Join(cmdlineParts, " ")
 }
 
+// qemuProcess is the QEMU process started by runQEMU, for the parts of the runner that need to
+// know its PID before it exits.
+//
+// With cgroup management, QEMU is started by cgexec, which execs it, so the process we start is
+// always QEMU itself.
+type qemuProcess struct {
+	process atomic.Pointer[os.Process]
+}
+
+// pid returns the PID of the QEMU process.
+func (q *qemuProcess) pid() (int, error) {
+	p := q.process.Load()
+	if p == nil {
+		return 0, errors.New("QEMU has not been started")
+	}
+	return p.Pid, nil
+}
+
+// kill sends SIGKILL to the QEMU process.
+func (q *qemuProcess) kill() error {
+	p := q.process.Load()
+	if p == nil {
+		return errors.New("QEMU has not been started")
+	}
+	if err := p.Kill(); err != nil {
+		return fmt.Errorf("failed to kill pid %d: %w", p.Pid, err)
+	}
+	return nil
+}
+
 func runQEMU(
 	cfg *Config,
 	logger *zap.Logger,
 	vmSpec *vmv1.VirtualMachineSpec,
 	qemuCmd []string,
+	resumeImage string,
 ) error {
 	selfPodName, ok := os.LookupEnv("K8S_POD_NAME")
 	if !ok {
@@ -466,7 +721,7 @@ func runQEMU(
 
 	if !cfg.skipCgroupManagement {
 		var err error
-		cgroupPath, err = setupQEMUCgroup(logger, selfPodName, vmSpec.Guest.CPUs.Use)
+		cgroupPath, err = setupQEMUCgroup(logger, selfPodName, vmSpec.Guest.CPUs.Use, cfg.cgroupOvercommitFactor())
 		if err != nil {
 			return err
 		}
@@ -474,9 +729,11 @@ func runQEMU(
 
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := sync.WaitGroup{}
+	//nolint:exhaustruct // the process is set once it's started
+	qemu := &qemuProcess{}
 
 	wg.Add(1)
-	go terminateQemuOnSigterm(ctx, logger, &wg)
+	go shutdownQEMUOnSigterm(ctx, logger, &wg, gracePeriod(vmSpec), qemu.kill)
 	var callbacks cpuServerCallbacks
 	// lastValue is used to store last fractional CPU request
 	// we need to store the value as is because we can't convert it back from MilliCPU
@@ -484,6 +741,8 @@ func runQEMU(
 	// this will eventually be dropped in favor of real fractional CPU scaling based on the cgroups
 	lastValue := &atomic.Uint32{}
 	lastValue.Store(uint32(vmSpec.Guest.CPUs.Min))
+	// guestReady is set by measureBoot once vm-monitor in the guest is ready
+	guestReady := &atomic.Bool{}
 
 	callbacks = cpuServerCallbacks{
 		get: func(logger *zap.Logger) (*vmv1.MilliCPU, error) {
@@ -491,16 +750,44 @@ func runQEMU(
 		},
 		set: func(logger *zap.Logger, cpu vmv1.MilliCPU) error {
 			if cfg.cpuScalingMode == vmv1.CpuScalingModeSysfs {
+				// With sysfs scaling, the guest offlines vCPUs itself, and we only deflate QEMU's
+				// cgroup on the host. Order the two steps so that the guest never has more online
+				// vCPUs than the cgroup allows for: when scaling down, offline first; when scaling
+				// up, grow the cgroup first.
+				scalingUp := cpu > vmv1.MilliCPU(lastValue.Load())
+				if scalingUp && !cfg.skipCgroupManagement {
+					if err := setCgroupLimit(logger, cpu, cfg.cgroupOvercommitFactor(), cgroupPath); err != nil {
+						logger.Error("setting QEMU cgroup limit failed", zap.Any("cpu", cpu), zap.Error(err))
+						return err
+					}
+				}
 				err := setNeonvmDaemonCPU(cpu)
 				if err != nil {
 					logger.Error("setting CPU through NeonVM Daemon failed", zap.Any("cpu", cpu), zap.Error(err))
 					return err
 				}
+				if !scalingUp && !cfg.skipCgroupManagement {
+					if err := setCgroupLimit(logger, cpu, cfg.cgroupOvercommitFactor(), cgroupPath); err != nil {
+						logger.Error("setting QEMU cgroup limit failed", zap.Any("cpu", cpu), zap.Error(err))
+						return err
+					}
+				}
+			}
+			if cfg.cpuScalingMode == vmv1.CpuScalingModeCgroup {
+				// vCPUs stay fixed; the (possibly fractional) allocation is enforced only by the
+				// cgroup. newConfig guarantees cgroup management is enabled in this mode.
+				if err := setCgroupLimit(logger, cpu, cfg.cgroupOvercommitFactor(), cgroupPath); err != nil {
+					logger.Error("setting QEMU cgroup limit failed", zap.Any("cpu", cpu), zap.Error(err))
+					return err
+				}
 			}
 			lastValue.Store(uint32(cpu))
 			return nil
 		},
 		ready: func(logger *zap.Logger) bool {
+			if cfg.waitForVMMonitor && !guestReady.Load() {
+				return false
+			}
 			switch cfg.cpuScalingMode {
 			case vmv1.CpuScalingModeSysfs:
 				// check if the NeonVM Daemon is ready to accept requests
@@ -510,8 +797,8 @@ func runQEMU(
 					return false
 				}
 				return true
-			case vmv1.CpuScalingModeQMP:
-				// no readiness check for QMP mode
+			case vmv1.CpuScalingModeQMP, vmv1.CpuScalingModeCgroup:
+				// no readiness check for QMP or cgroup mode
 				return true
 			default:
 				// explicit panic for unknown CPU scaling mode
@@ -523,11 +810,32 @@ func runQEMU(
 
 	wg.Add(1)
 	monitoring := vmSpec.EnableNetworkMonitoring != nil && *vmSpec.EnableNetworkMonitoring
-	go listenForHTTPRequests(ctx, logger, vmSpec.RunnerPort, callbacks, &wg, monitoring)
+	freePageReporting := vmSpec.EnableFreePageReporting != nil && *vmSpec.EnableFreePageReporting
+	// metrics are always served, for the boot times. Other metrics are only added if enabled.
+	reg := prometheus.NewRegistry()
+	bootMetrics := NewBootMetrics(reg)
+	go listenForHTTPRequests(ctx, logger, vmSpec.RunnerPort, callbacks, &wg, reg, monitoring, freePageReporting, qemu, vmSpec.GuestMetrics)
 	wg.Add(1)
 	go forwardLogs(ctx, logger, &wg)
 	wg.Add(1)
 	go monitorFiles(ctx, logger, &wg, vmSpec)
+	wg.Add(1)
+	go rotateDiskKeys(ctx, logger, &wg, vmSpec)
+	wg.Add(1)
+	go trimDisks(ctx, logger, &wg, vmSpec)
+	if resumeImage != "" {
+		wg.Add(1)
+		go finishResume(ctx, logger, &wg, resumeImage)
+	}
+	// saving the memory image quits QEMU, so its result is collected after QEMU exits
+	saveResult := make(chan error, 1)
+	if cfg.saveMemoryImage != "" {
+		go func() {
+			saveResult <- saveMemoryImage(ctx, logger, cfg.saveMemoryImage)
+		}()
+	} else {
+		saveResult <- nil
+	}
 
 	qemuBin := getQemuBinaryName(cfg.architecture)
 	var bin string
@@ -540,11 +848,38 @@ func runQEMU(
 		cmd = qemuCmd
 	}
 
+	// Boot times are meaningless if the VM is resumed from a migration or memory image, because the
+	// guest has already booted.
+	if os.Getenv("RECEIVE_MIGRATION") != "true" && resumeImage == "" {
+		wg.Add(1)
+		go measureBoot(ctx, logger, &wg, bootMetrics, guestReady, time.Now())
+	} else {
+		guestReady.Store(true)
+	}
+
+	// The memory cgroup's count of OOM kills is for the container's whole lifetime, so we need to
+	// know what it was before QEMU started, to tell if QEMU was OOM-killed.
+	oomKillsBefore, err := oomKillCount(logger)
+	if err != nil {
+		logger.Warn("Couldn't read memory cgroup's OOM kill count before starting QEMU", zap.Error(err))
+	}
+
 	logger.Info(fmt.Sprintf("calling %s", bin), zap.Strings("args", cmd))
-	err := execFg(bin, cmd...)
+	qemuExec := exec.Command(bin, cmd...)
+	qemuExec.Stdout = os.Stdout
+	qemuExec.Stderr = os.Stderr
+	err = qemuExec.Start()
+	if err == nil {
+		qemu.process.Store(qemuExec.Process)
+		err = qemuExec.Wait()
+	}
 	if err != nil {
 		msg := "QEMU exited with error" // TODO: technically this might not be accurate. This can also happen if it fails to start.
 		logger.Error(msg, zap.Error(err))
+		if qemuOOMKilled(logger, err, oomKillsBefore) {
+			logger.Error("QEMU was OOM-killed")
+			writeTerminationMessage(logger, oomTerminationMessage(logger))
+		}
 		err = fmt.Errorf("%s: %w", msg, err)
 	} else {
 		logger.Info("QEMU exited without error")
@@ -553,6 +888,10 @@ func runQEMU(
 	cancel()
 	wg.Wait()
 
+	if saveErr := <-saveResult; err == nil && saveErr != nil {
+		err = fmt.Errorf("failed to save memory image: %w", saveErr)
+	}
+
 	return err
 }
 
@@ -567,7 +906,12 @@ func getQemuBinaryName(architecture string) string {
 	}
 }
 
-func getMachineType(architecture string) string {
+func getMachineType(architecture string, machineType *vmv1.MachineType) string {
+	if machineType != nil && *machineType == vmv1.MachineTypeMicroVM {
+		// microvm is x86-only, which is checked by the webhook
+		return "microvm"
+	}
+
 	switch architecture {
 	case architectureArm64:
 		// virt is the most up to date and generic ARM machine architecture
@@ -580,6 +924,33 @@ func getMachineType(architecture string) string {
 	}
 }
 
+// virtioBus is how virtio devices are attached to the guest, which depends on the machine type
+type virtioBus string
+
+const (
+	virtioBusPCI virtioBus = "pci"
+	// microvm has no PCI bus, so its devices are attached over virtio-mmio instead
+	virtioBusMMIO virtioBus = "mmio"
+)
+
+func getVirtioBus(machineType *vmv1.MachineType) virtioBus {
+	if machineType != nil && *machineType == vmv1.MachineTypeMicroVM {
+		return virtioBusMMIO
+	}
+	return virtioBusPCI
+}
+
+// device returns the name of the QEMU device for the virtio device on the bus, e.g.
+// "virtio-net-pci" or "virtio-net-device" for "virtio-net".
+func (b virtioBus) device(name string) string {
+	switch b {
+	case virtioBusMMIO:
+		return name + "-device"
+	default:
+		return name + "-pci"
+	}
+}
+
 func printWithNewline(slice []byte) error {
 	if len(slice) == 0 {
 		return nil
@@ -628,12 +999,13 @@ func forwardLogs(ctx context.Context, logger *zap.Logger, wg *sync.WaitGroup) {
 	var conn net.Conn
 	var reader *bufio.Reader
 
-	b := &backoff.Backoff{
-		Min:    100 * time.Millisecond,
-		Max:    delay,
-		Factor: 2,
-		Jitter: true,
+	b := util.Backoff{
+		Initial:    100 * time.Millisecond,
+		Max:        delay,
+		Multiplier: 2,
+		Jitter:     0.5,
 	}
+	retries := 0
 
 	// Wait a bit to reduce the chance we attempt dialing before
 	// QEMU is started
@@ -655,7 +1027,6 @@ func forwardLogs(ctx context.Context, logger *zap.Logger, wg *sync.WaitGroup) {
 				reader = bufio.NewReaderSize(conn, bufferedReaderSize)
 			}
 
-			b.Attempt()
 			err := conn.SetReadDeadline(time.Now().Add(delay))
 			if err != nil {
 				logger.Error("failed to set read deadline", zap.Error(err))
@@ -666,7 +1037,7 @@ func forwardLogs(ctx context.Context, logger *zap.Logger, wg *sync.WaitGroup) {
 			err = drainLogsReader(reader, logger)
 			if errors.Is(err, os.ErrDeadlineExceeded) {
 				// We've hit the deadline, meaning the reading session was successful.
-				b.Reset()
+				retries = 0
 				return
 			}
 
@@ -675,6 +1046,9 @@ func forwardLogs(ctx context.Context, logger *zap.Logger, wg *sync.WaitGroup) {
 			}
 		}()
 
+		wait := b.Delay(retries)
+		retries += 1
+
 		select {
 		case <-ctx.Done():
 			if conn != nil {
@@ -684,7 +1058,7 @@ func forwardLogs(ctx context.Context, logger *zap.Logger, wg *sync.WaitGroup) {
 				_ = drainLogsReader(reader, logger)
 			}
 			return
-		case <-time.After(b.Duration()):
+		case <-time.After(wait):
 		}
 	}
 }
@@ -718,25 +1092,24 @@ func monitorFiles(ctx context.Context, logger *zap.Logger, wg *sync.WaitGroup, v
 	// Faster loop for the initial upload.
 	// The VM might need the secrets in order for postgres to actually start up,
 	// so it's important we sync them as soon as the daemon is available.
-	for {
-		success := true
+	err := util.Retry(ctx, util.RetryConfig{
+		Backoff:     util.Backoff{Initial: time.Second, Max: 0, Multiplier: 0, Jitter: 0},
+		MaxAttempts: 0,
+		ShouldRetry: nil,
+		OnRetry:     nil,
+	}, func() error {
+		var errs []error
 		for _, hostpath := range secretsOrd {
 			guestpath := secrets[hostpath]
 			if err := sendFilesToNeonvmDaemon(ctx, hostpath, guestpath); err != nil {
-				success = false
 				logger.Error("failed to upload file to vm guest", zap.Error(err))
+				errs = append(errs, err)
 			}
 		}
-		if success {
-			break
-		}
-
-		select {
-		case <-time.After(1 * time.Second):
-			continue
-		case <-ctx.Done():
-			return
-		}
+		return errors.Join(errs...)
+	})
+	if err != nil {
+		return // context was canceled
 	}
 
 	// For the entire duration the VM is alive, periodically check whether any of the watched disks
@@ -776,44 +1149,6 @@ func monitorFiles(ctx context.Context, logger *zap.Logger, wg *sync.WaitGroup, v
 	}
 }
 
-func terminateQemuOnSigterm(ctx context.Context, logger *zap.Logger, wg *sync.WaitGroup) {
-	logger = logger.Named("terminate-qemu-on-sigterm")
-
-	defer wg.Done()
-	logger.Info("watching OS signals")
-	c := make(chan os.Signal, 1) // we need to reserve to buffer size 1, so the notifier are not blocked
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-	select {
-	case <-c:
-	case <-ctx.Done():
-		logger.Info("context canceled, not going to powerdown QEMU because it's already finished")
-		return
-	}
-
-	logger.Info("got signal, sending powerdown command to QEMU")
-
-	mon, err := qmp.NewSocketMonitor("unix", qmpUnixSocketForSigtermHandler, 2*time.Second)
-	if err != nil {
-		logger.Error("failed to connect to QEMU monitor", zap.Error(err))
-		return
-	}
-
-	if err := mon.Connect(); err != nil {
-		logger.Error("failed to start monitor connection", zap.Error(err))
-		return
-	}
-	defer mon.Disconnect() //nolint:errcheck // nothing to do with error when deferred. TODO: log it?
-
-	qmpcmd := []byte(`{"execute": "system_powerdown"}`)
-	_, err = mon.Run(qmpcmd)
-	if err != nil {
-		logger.Error("failed to execute system_powerdown command", zap.Error(err))
-		return
-	}
-
-	logger.Info("system_powerdown command sent to QEMU")
-}
-
 //lint:ignore U1000 the function is not in use right now, but it's good to have for the future
 func execBg(name string, arg ...string) error {
 	cmd := exec.Command(name, arg...)
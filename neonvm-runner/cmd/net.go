@@ -13,6 +13,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/vishvananda/netlink"
 	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
 
 	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
 	"github.com/neondatabase/autoscaling/pkg/util"
@@ -22,6 +23,9 @@ const (
 	defaultNetworkBridgeName = "br-def"
 	defaultNetworkTapName    = "tap-def"
 	defaultNetworkCIDR       = "169.254.254.252/30"
+	// defaultNetworkIPv6CIDR is the ULA prefix used for the guest's IPv6 address, when the pod has
+	// IPv6 connectivity. The guest configures its address with SLAAC.
+	defaultNetworkIPv6CIDR = "fd00:a9fe:fefc::/64"
 
 	overlayNetworkBridgeName = "br-overlay"
 	overlayNetworkTapName    = "tap-overlay"
@@ -30,7 +34,15 @@ const (
 )
 
 // setupVMNetworks creates the networks for the VM and returns the appropriate QMEU args
-func setupVMNetworks(logger *zap.Logger, ports []vmv1.Port, extraNetwork *vmv1.ExtraNetwork) ([]string, error) {
+func setupVMNetworks(
+	logger *zap.Logger,
+	bus virtioBus,
+	ports []vmv1.Port,
+	extraNetwork *vmv1.ExtraNetwork,
+	dnsConfig *vmv1.GuestDNSConfig,
+	mtu *int32,
+	vhost bool,
+) ([]string, error) {
 	// Create network tap devices.
 	//
 	// It is important to enable multiqueue support for virtio-net-pci devices as we seen them choking on
@@ -41,27 +53,46 @@ func setupVMNetworks(logger *zap.Logger, ports []vmv1.Port, extraNetwork *vmv1.E
 
 	var qemuCmd []string
 
+	// The MTU is set on the bridge and tap, and also given to the guest's virtio-net driver with
+	// host_mtu so that the guest doesn't rely on DHCP to get it right.
+	mtuDefault, err := defaultNetworkMTU(mtu)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get default network MTU: %w", err)
+	}
+
 	// default (pod) net details
-	macDefault, err := defaultNetwork(logger, defaultNetworkCIDR, ports)
+	macDefault, err := defaultNetwork(logger, defaultNetworkCIDR, ports, dnsConfig, mtuDefault)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to set up default network: %w", err)
 	}
-	qemuCmd = append(qemuCmd, "-netdev", fmt.Sprintf("tap,id=default,ifname=%s,queues=4,script=no,downscript=no,vhost=on", defaultNetworkTapName))
-	qemuCmd = append(qemuCmd, "-device", fmt.Sprintf("virtio-net-pci,mq=on,vectors=10,netdev=default,mac=%s", macDefault.String()))
+	qemuCmd = append(qemuCmd, "-netdev", fmt.Sprintf("tap,id=default,ifname=%s,queues=4,script=no,downscript=no,vhost=%s", defaultNetworkTapName, onOff(vhost)))
+	qemuCmd = append(qemuCmd, "-device", fmt.Sprintf("%s,netdev=default,mac=%s,host_mtu=%d", virtioNetDevice(bus), macDefault.String(), mtuDefault))
 
 	// overlay (multus) net details
 	if extraNetwork != nil && extraNetwork.Enable {
-		macOverlay, err := overlayNetwork(extraNetwork.Interface)
+		macOverlay, mtuOverlay, err := overlayNetwork(extraNetwork.Interface)
 		if err != nil {
 			return nil, fmt.Errorf("Failed to set up overlay network: %w", err)
 		}
-		qemuCmd = append(qemuCmd, "-netdev", fmt.Sprintf("tap,id=overlay,ifname=%s,queues=4,script=no,downscript=no,vhost=on", overlayNetworkTapName))
-		qemuCmd = append(qemuCmd, "-device", fmt.Sprintf("virtio-net-pci,mq=on,vectors=10,netdev=overlay,mac=%s", macOverlay.String()))
+		qemuCmd = append(qemuCmd, "-netdev", fmt.Sprintf("tap,id=overlay,ifname=%s,queues=4,script=no,downscript=no,vhost=%s", overlayNetworkTapName, onOff(vhost)))
+		qemuCmd = append(qemuCmd, "-device", fmt.Sprintf("%s,netdev=overlay,mac=%s,host_mtu=%d", virtioNetDevice(bus), macOverlay.String(), mtuOverlay))
 	}
 
 	return qemuCmd, nil
 }
 
+// virtioNetDevice returns the QEMU device, with multiqueue options, for a virtio-net NIC on the bus.
+//
+// MSI-X vectors are specific to PCI, so virtio-mmio devices share a single interrupt.
+func virtioNetDevice(bus virtioBus) string {
+	switch bus {
+	case virtioBusMMIO:
+		return bus.device("virtio-net") + ",mq=on"
+	default:
+		return bus.device("virtio-net") + ",mq=on,vectors=10"
+	}
+}
+
 func calcIPs(cidr string) (net.IP, net.IP, net.IPMask, error) {
 	_, ipv4Net, err := net.ParseCIDR(cidr)
 	if err != nil {
@@ -79,7 +110,21 @@ func calcIPs(cidr string) (net.IP, net.IP, net.IPMask, error) {
 	return ip1, ip2, mask, nil
 }
 
-func defaultNetwork(logger *zap.Logger, cidr string, ports []vmv1.Port) (mac.MAC, error) {
+// defaultNetworkMTU returns the MTU to use for the default network: the one from the spec if set,
+// otherwise the MTU of the pod's own interface, so that e.g. overlay networks with reduced MTU
+// don't cause fragmentation inside the guest.
+func defaultNetworkMTU(mtu *int32) (int, error) {
+	if mtu != nil {
+		return int(*mtu), nil
+	}
+	link, err := netlink.LinkByName("eth0")
+	if err != nil {
+		return 0, err
+	}
+	return link.Attrs().MTU, nil
+}
+
+func defaultNetwork(logger *zap.Logger, cidr string, ports []vmv1.Port, dnsConfig *vmv1.GuestDNSConfig, mtu int) (mac.MAC, error) {
 	// gerenare random MAC for default Guest interface
 	mac, err := mac.GenerateRandMAC()
 	if err != nil {
@@ -88,10 +133,11 @@ func defaultNetwork(logger *zap.Logger, cidr string, ports []vmv1.Port) (mac.MAC
 	}
 
 	// create an configure linux bridge
-	logger.Info("setup bridge interface", zap.String("name", defaultNetworkBridgeName))
+	logger.Info("setup bridge interface", zap.String("name", defaultNetworkBridgeName), zap.Int("mtu", mtu))
 	bridge := &netlink.Bridge{
 		LinkAttrs: netlink.LinkAttrs{
 			Name: defaultNetworkBridgeName,
+			MTU:  mtu,
 		},
 	}
 	if err := netlink.LinkAdd(bridge); err != nil {
@@ -118,6 +164,39 @@ func defaultNetwork(logger *zap.Logger, cidr string, ports []vmv1.Port) (mac.MAC
 		return nil, err
 	}
 
+	// dual-stack pods also give the guest an IPv6 address, NATed in the same way as IPv4.
+	podHasIPv6, err := hasGlobalIPv6("eth0")
+	if err != nil {
+		logger.Error("could not check for IPv6 on pod interface", zap.Error(err))
+		return nil, err
+	}
+	var ipPod6, ipVm6 net.IP
+	var prefix6 *net.IPNet
+	if podHasIPv6 {
+		_, prefix6, err = net.ParseCIDR(defaultNetworkIPv6CIDR)
+		if err != nil {
+			logger.Fatal("could not parse IPv6 prefix", zap.Error(err))
+			return nil, err
+		}
+		ipPod6 = append(net.IP{}, prefix6.IP...)
+		ipPod6[15] = 1
+		ipVm6 = eui64Addr(prefix6.IP, mac)
+
+		logger.Info("setup IPv6 on bridge interface", zap.String("address", ipPod6.String()))
+		bridgeAddr6 := &netlink.Addr{
+			IPNet: &net.IPNet{
+				IP:   ipPod6,
+				Mask: prefix6.Mask,
+			},
+			// Don't wait for duplicate address detection; nothing else is on this link.
+			Flags: unix.IFA_F_NODAD,
+		}
+		if err := netlink.AddrAdd(bridge, bridgeAddr6); err != nil {
+			logger.Error("could not add IPv6 address to bridge", zap.Error(err))
+			return nil, err
+		}
+	}
+
 	// create an configure TAP interface
 	if !checkDevTun() {
 		logger.Info("create /dev/net/tun")
@@ -144,6 +223,10 @@ func defaultNetwork(logger *zap.Logger, cidr string, ports []vmv1.Port) (mac.MAC
 		logger.Error("could not add tap device", zap.Error(err))
 		return nil, err
 	}
+	if err := netlink.LinkSetMTU(tap, mtu); err != nil {
+		logger.Error("could not set tap device MTU", zap.Error(err))
+		return nil, err
+	}
 	if err := netlink.LinkSetMaster(tap, bridge); err != nil {
 		logger.Error("could not set up tap as master", zap.Error(err))
 		return nil, err
@@ -159,6 +242,12 @@ func defaultNetwork(logger *zap.Logger, cidr string, ports []vmv1.Port) (mac.MAC
 		logger.Error("could not setup masquerading for outgoing traffic", zap.Error(err))
 		return nil, err
 	}
+	if podHasIPv6 {
+		if err := execFg("ip6tables", "-t", "nat", "-A", "POSTROUTING", "-o", "eth0", "-j", "MASQUERADE"); err != nil {
+			logger.Error("could not setup IPv6 masquerading for outgoing traffic", zap.Error(err))
+			return nil, err
+		}
+	}
 
 	// pass incoming traffic to .Guest.Spec.Ports into VM
 	var iptablesArgs []string
@@ -173,6 +262,17 @@ func defaultNetwork(logger *zap.Logger, cidr string, ports []vmv1.Port) (mac.MAC
 			logger.Error("could not set up DNAT rule for incoming traffic", zap.Error(err))
 			return nil, err
 		}
+		if podHasIPv6 {
+			iptablesArgs = []string{
+				"-t", "nat", "-A", "PREROUTING",
+				"-i", "eth0", "-p", fmt.Sprint(port.Protocol), "--dport", fmt.Sprint(port.Port),
+				"-j", "DNAT", "--to", net.JoinHostPort(ipVm6.String(), fmt.Sprint(port.Port)),
+			}
+			if err := execFg("ip6tables", iptablesArgs...); err != nil {
+				logger.Error("could not set up IPv6 DNAT rule for incoming traffic", zap.Error(err))
+				return nil, err
+			}
+		}
 		logger.Debug(fmt.Sprintf("setup DNAT rule for traffic originating from localhost to port %d", port.Port))
 		iptablesArgs = []string{
 			"-t", "nat", "-A", "OUTPUT",
@@ -184,6 +284,18 @@ func defaultNetwork(logger *zap.Logger, cidr string, ports []vmv1.Port) (mac.MAC
 			logger.Error("could not set up DNAT rule for traffic from localhost", zap.Error(err))
 			return nil, err
 		}
+		if podHasIPv6 {
+			iptablesArgs = []string{
+				"-t", "nat", "-A", "OUTPUT",
+				"-m", "addrtype", "--src-type", "LOCAL", "--dst-type", "LOCAL",
+				"-p", fmt.Sprint(port.Protocol), "--dport", fmt.Sprint(port.Port),
+				"-j", "DNAT", "--to-destination", net.JoinHostPort(ipVm6.String(), fmt.Sprint(port.Port)),
+			}
+			if err := execFg("ip6tables", iptablesArgs...); err != nil {
+				logger.Error("could not set up IPv6 DNAT rule for traffic from localhost", zap.Error(err))
+				return nil, err
+			}
+		}
 		logger.Debug(fmt.Sprintf("setup ACCEPT rule for traffic originating from localhost to port %d", port.Port))
 		iptablesArgs = []string{
 			"-A", "OUTPUT",
@@ -195,6 +307,18 @@ func defaultNetwork(logger *zap.Logger, cidr string, ports []vmv1.Port) (mac.MAC
 			logger.Error("could not set up ACCEPT rule for traffic from localhost", zap.Error(err))
 			return nil, err
 		}
+		if podHasIPv6 {
+			iptablesArgs = []string{
+				"-A", "OUTPUT",
+				"-s", "::1", "-d", ipVm6.String(),
+				"-p", fmt.Sprint(port.Protocol), "--dport", fmt.Sprint(port.Port),
+				"-j", "ACCEPT",
+			}
+			if err := execFg("ip6tables", iptablesArgs...); err != nil {
+				logger.Error("could not set up IPv6 ACCEPT rule for traffic from localhost", zap.Error(err))
+				return nil, err
+			}
+		}
 	}
 	logger.Debug("setup MASQUERADE rule for traffic originating from localhost")
 	iptablesArgs = []string{
@@ -206,15 +330,18 @@ func defaultNetwork(logger *zap.Logger, cidr string, ports []vmv1.Port) (mac.MAC
 		logger.Error("could not set up MASQUERADE rule for traffic from localhost", zap.Error(err))
 		return nil, err
 	}
+	if podHasIPv6 {
+		if err := execFg("ip6tables", iptablesArgs...); err != nil {
+			logger.Error("could not set up IPv6 MASQUERADE rule for traffic from localhost", zap.Error(err))
+			return nil, err
+		}
+	}
 
-	// get dns details from /etc/resolv.conf
-	resolvConf, err := resolvconf.Get()
+	nameservers, searches, err := guestDNS(dnsConfig)
 	if err != nil {
 		logger.Error("could not get DNS details", zap.Error(err))
 		return nil, err
 	}
-	dns := resolvconf.GetNameservers(resolvConf.Content, types.IP)[0]
-	dnsSearch := strings.Join(resolvconf.GetSearchDomains(resolvConf.Content), ",")
 
 	// prepare dnsmask command line (instead of config file)
 	logger.Info("run dnsmasq for interface", zap.String("name", defaultNetworkBridgeName))
@@ -233,10 +360,36 @@ func defaultNetwork(logger *zap.Logger, cidr string, ports []vmv1.Port) (mac.MAC
 		fmt.Sprintf("--dhcp-range=%s,static,%d.%d.%d.%d", ipVm.String(), mask[0], mask[1], mask[2], mask[3]),
 		fmt.Sprintf("--dhcp-host=%s,%s,infinite", mac.String(), ipVm.String()),
 		fmt.Sprintf("--dhcp-option=option:router,%s", ipPod.String()),
-		fmt.Sprintf("--dhcp-option=option:dns-server,%s", dns),
-		fmt.Sprintf("--dhcp-option=option:domain-search,%s", dnsSearch),
+		fmt.Sprintf("--dhcp-option=option:mtu,%d", mtu),
 		fmt.Sprintf("--shared-network=%s,%s", defaultNetworkBridgeName, ipVm.String()),
 	}
+	// DHCPv4 can only carry IPv4 nameservers; any IPv6 nameservers are advertised with RAs instead.
+	var nameservers4, nameservers6 []string
+	for _, ns := range nameservers {
+		if ip := net.ParseIP(ns); ip != nil && ip.To4() == nil {
+			nameservers6 = append(nameservers6, fmt.Sprintf("[%s]", ns))
+		} else {
+			nameservers4 = append(nameservers4, ns)
+		}
+	}
+	if len(nameservers4) != 0 {
+		dnsMaskCmd = append(dnsMaskCmd, fmt.Sprintf("--dhcp-option=option:dns-server,%s", strings.Join(nameservers4, ",")))
+	}
+	if len(searches) != 0 {
+		dnsMaskCmd = append(dnsMaskCmd, fmt.Sprintf("--dhcp-option=option:domain-search,%s", strings.Join(searches, ",")))
+	}
+	if podHasIPv6 {
+		dnsMaskCmd = append(dnsMaskCmd,
+			"--enable-ra",
+			fmt.Sprintf("--dhcp-range=%s,ra-only,64", prefix6.IP.String()),
+		)
+		if len(nameservers6) != 0 {
+			dnsMaskCmd = append(dnsMaskCmd, fmt.Sprintf("--dhcp-option=option6:dns-server,%s", strings.Join(nameservers6, ",")))
+		}
+		if len(searches) != 0 {
+			dnsMaskCmd = append(dnsMaskCmd, fmt.Sprintf("--dhcp-option=option6:domain-search,%s", strings.Join(searches, ",")))
+		}
+	}
 
 	// run dnsmasq for default Guest interface
 	if err := execFg("dnsmasq", dnsMaskCmd...); err != nil {
@@ -253,6 +406,9 @@ func defaultNetwork(logger *zap.Logger, cidr string, ports []vmv1.Port) (mac.MAC
 	}
 	defer f.Close()
 	record := fmt.Sprintf("%v guest-vm\n", ipVm)
+	if podHasIPv6 {
+		record += fmt.Sprintf("%v guest-vm\n", ipVm6)
+	}
 	if _, err := f.WriteString(record); err != nil {
 		return nil, err
 	}
@@ -260,27 +416,101 @@ func defaultNetwork(logger *zap.Logger, cidr string, ports []vmv1.Port) (mac.MAC
 	return mac, nil
 }
 
-func overlayNetwork(iface string) (mac.MAC, error) {
+// hasGlobalIPv6 returns whether the interface has a globally routable IPv6 address, i.e. whether
+// the pod is dual-stack (or IPv6-only).
+func hasGlobalIPv6(iface string) (bool, error) {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return false, err
+	}
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_V6)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range addrs {
+		if a.IP.IsGlobalUnicast() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// eui64Addr returns the address in the /64 prefix that the guest will pick with SLAAC, given its
+// MAC address.
+func eui64Addr(prefix net.IP, mac mac.MAC) net.IP {
+	ip := append(net.IP{}, prefix.To16()...)
+	ip[8] = mac[0] ^ 0x02
+	ip[9] = mac[1]
+	ip[10] = mac[2]
+	ip[11] = 0xff
+	ip[12] = 0xfe
+	ip[13] = mac[3]
+	ip[14] = mac[4]
+	ip[15] = mac[5]
+	return ip
+}
+
+// anyHost returns the host to listen on for connections to the pod over any IP family.
+func anyHost() string {
+	if podHasIPv6, err := hasGlobalIPv6("eth0"); err == nil && podHasIPv6 {
+		return "[::]"
+	}
+	return "0.0.0.0"
+}
+
+// guestDNS returns the nameservers and search domains to give to the guest, taking any that aren't
+// set in dnsConfig from the runner pod's /etc/resolv.conf.
+func guestDNS(dnsConfig *vmv1.GuestDNSConfig) (nameservers []string, searches []string, _ error) {
+	if dnsConfig != nil {
+		nameservers = dnsConfig.Nameservers
+		searches = dnsConfig.Searches
+	}
+	if len(nameservers) != 0 && len(searches) != 0 {
+		return nameservers, searches, nil
+	}
+
+	resolvConf, err := resolvconf.Get()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(nameservers) == 0 {
+		nameservers = resolvconf.GetNameservers(resolvConf.Content, types.IP)
+	}
+	if len(searches) == 0 {
+		searches = resolvconf.GetSearchDomains(resolvConf.Content)
+	}
+	return nameservers, searches, nil
+}
+
+func overlayNetwork(iface string) (mac.MAC, int, error) {
 	// gerenare random MAC for overlay Guest interface
 	mac, err := mac.GenerateRandMAC()
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	// the guest's overlay interface has the same MTU as the pod's
+	overlayLink, err := netlink.LinkByName(iface)
+	if err != nil {
+		return nil, 0, err
 	}
+	mtu := overlayLink.Attrs().MTU
 
 	// create and configure linux bridge
 	bridge := &netlink.Bridge{
 		LinkAttrs: netlink.LinkAttrs{
 			Name: overlayNetworkBridgeName,
+			MTU:  mtu,
 			Protinfo: &netlink.Protinfo{
 				Learning: false,
 			},
 		},
 	}
 	if err := netlink.LinkAdd(bridge); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if err := netlink.LinkSetUp(bridge); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	// create an configure TAP interface
@@ -292,39 +522,38 @@ func overlayNetwork(iface string) (mac.MAC, error) {
 		Flags: netlink.TUNTAP_MULTI_QUEUE_DEFAULTS,
 	}
 	if err := netlink.LinkAdd(tap); err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	if err := netlink.LinkSetMTU(tap, mtu); err != nil {
+		return nil, 0, err
 	}
 	if err := netlink.LinkSetMaster(tap, bridge); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	if err := netlink.LinkSetUp(tap); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	// add overlay interface to bridge as well
-	overlayLink, err := netlink.LinkByName(iface)
-	if err != nil {
-		return nil, err
-	}
 	// firsly delete IP address(es) (it it exist) from overlay interface
 	overlayAddrs, err := netlink.AddrList(overlayLink, netlink.FAMILY_V4)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	for _, a := range overlayAddrs {
 		ip := a.IPNet
 		if ip != nil {
 			if err := netlink.AddrDel(overlayLink, &a); err != nil {
-				return nil, err
+				return nil, 0, err
 			}
 		}
 	}
 	// and now add overlay link to bridge
 	if err := netlink.LinkSetMaster(overlayLink, bridge); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return mac, nil
+	return mac, mtu, nil
 }
 
 type NetworkMonitoringMetrics struct {
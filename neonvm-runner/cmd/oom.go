@@ -0,0 +1,147 @@
+package main
+
+// Detection of QEMU being OOM-killed, so that the controller can tell it apart from other crashes.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/containerd/cgroups/v3"
+	"go.uber.org/zap"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// terminationMessagePath is where the kubelet reads the container's termination message from, by
+// default.
+const terminationMessagePath = "/dev/termination-log"
+
+// qemuOOMKilled returns whether QEMU exited with err because it was OOM-killed.
+//
+// The OOM killer sends SIGKILL, so we check for that, and then confirm with the runner container's
+// memory cgroup that an OOM kill happened since QEMU started. The cgroup's count of OOM kills is
+// cumulative, so killsBefore must be the count from oomKillCount before starting QEMU.
+func qemuOOMKilled(logger *zap.Logger, err error, killsBefore int64) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() || status.Signal() != syscall.SIGKILL {
+		return false
+	}
+
+	kills, err := oomKillCount(logger)
+	if err != nil {
+		logger.Warn("QEMU was killed, but couldn't check memory cgroup for OOM", zap.Error(err))
+		return false
+	}
+	return kills > killsBefore
+}
+
+// oomKillCount returns the number of OOM kills in the runner container's memory cgroup so far.
+func oomKillCount(logger *zap.Logger) (int64, error) {
+	memCgroup, err := memoryCgroupPath(logger)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't determine memory cgroup: %w", err)
+	}
+
+	var eventsFile string
+	if cgroups.Mode() == cgroups.Unified {
+		eventsFile = "memory.events"
+	} else {
+		eventsFile = "memory.oom_control"
+	}
+	return readCgroupStat(filepath.Join(memCgroup, eventsFile), "oom_kill")
+}
+
+// oomTerminationMessage returns the termination message for when QEMU was OOM-killed, with
+// whatever memory stats are available for the runner container.
+func oomTerminationMessage(logger *zap.Logger) vmv1.RunnerTerminationMessage {
+	msg := vmv1.RunnerTerminationMessage{
+		Reason:      vmv1.RunnerTerminationReasonOOMKilled,
+		MemoryPeak:  nil,
+		MemoryLimit: nil,
+	}
+
+	memCgroup, err := memoryCgroupPath(logger)
+	if err != nil {
+		logger.Warn("Couldn't determine memory cgroup for OOM memory stats", zap.Error(err))
+		return msg
+	}
+
+	var peakFile, limitFile string
+	if cgroups.Mode() == cgroups.Unified {
+		peakFile, limitFile = "memory.peak", "memory.max"
+	} else {
+		peakFile, limitFile = "memory.max_usage_in_bytes", "memory.limit_in_bytes"
+	}
+	// memory.peak isn't available on older kernels, and there may not be a limit at all ("max"),
+	// so we just leave out whatever we can't read.
+	if peak, err := readCgroupValue(filepath.Join(memCgroup, peakFile)); err == nil {
+		msg.MemoryPeak = resource.NewQuantity(peak, resource.BinarySI)
+	}
+	if limit, err := readCgroupValue(filepath.Join(memCgroup, limitFile)); err == nil {
+		msg.MemoryLimit = resource.NewQuantity(limit, resource.BinarySI)
+	}
+
+	return msg
+}
+
+// writeTerminationMessage writes msg as the termination message of the runner container, so that
+// the controller can find out why the runner exited.
+func writeTerminationMessage(logger *zap.Logger, msg vmv1.RunnerTerminationMessage) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logger.Error("Failed to marshal termination message", zap.Error(err))
+		return
+	}
+	if err := os.WriteFile(terminationMessagePath, data, 0o644); err != nil {
+		logger.Error("Failed to write termination message", zap.Error(err))
+	}
+}
+
+// memoryCgroupPath returns the path of the runner container's memory cgroup.
+func memoryCgroupPath(logger *zap.Logger) (string, error) {
+	selfCgroupPath, err := getSelfCgroupPath(logger)
+	if err != nil {
+		return "", err
+	}
+	if cgroups.Mode() == cgroups.Unified {
+		return filepath.Join(cgroupMountPoint, selfCgroupPath), nil
+	}
+	return filepath.Join(cgroupMountPoint, "memory", selfCgroupPath), nil
+}
+
+// readCgroupStat reads the value for key from a cgroup file with lines of the form "<key> <value>".
+func readCgroupStat(path string, key string) (int64, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == key {
+			return strconv.ParseInt(fields[1], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("key %q not found in %s", key, path)
+}
+
+// readCgroupValue reads a cgroup file containing a single integer value.
+func readCgroupValue(path string) (int64, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(contents)), 10, 64)
+}
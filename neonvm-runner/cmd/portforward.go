@@ -0,0 +1,76 @@
+package main
+
+// Forwarding connections from the runner's debug HTTP server to ports in the guest, so that clients
+// with a port-forward to the runner pod can reach arbitrary guest ports.
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"nhooyr.io/websocket"
+)
+
+// guestAddr returns the address of the port on the guest's default network interface.
+func guestAddr(port int) (string, error) {
+	_, ipVm, _, err := calcIPs(defaultNetworkCIDR)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ipVm.String(), strconv.Itoa(port)), nil
+}
+
+// handlePortForward upgrades the request to a websocket and forwards binary messages to and from a
+// TCP connection to the guest port given by the 'port' query parameter.
+func handlePortForward(logger *zap.Logger, w http.ResponseWriter, r *http.Request) {
+	port, err := strconv.Atoi(r.URL.Query().Get("port"))
+	if err != nil || port <= 0 || port > 65535 {
+		logger.Error("invalid port", zap.String("port", r.URL.Query().Get("port")))
+		w.WriteHeader(400)
+		return
+	}
+	addr, err := guestAddr(port)
+	if err != nil {
+		logger.Error("could not get guest address", zap.Error(err))
+		w.WriteHeader(500)
+		return
+	}
+
+	guestConn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		logger.Error("could not connect to guest", zap.String("addr", addr), zap.Error(err))
+		w.WriteHeader(502)
+		return
+	}
+	defer guestConn.Close()
+
+	c, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		logger.Error("could not accept websocket", zap.Error(err))
+		return
+	}
+	defer c.Close(websocket.StatusInternalError, "") //nolint:errcheck // nothing to do with error when deferred
+
+	logger.Info("forwarding connection to guest", zap.String("addr", addr))
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	wsConn := websocket.NetConn(ctx, c, websocket.MessageBinary)
+
+	// Copy in both directions until either side is done.
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(guestConn, wsConn)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(wsConn, guestConn)
+		done <- struct{}{}
+	}()
+	<-done
+
+	c.Close(websocket.StatusNormalClosure, "") //nolint:errcheck // connection is done either way
+}
@@ -0,0 +1,263 @@
+package main
+
+// Saving and resuming memory images of pre-booted guests, for resume pools.
+//
+// A template runner boots the guest with 'neonvm.resume_template=1', which makes the guest's init
+// wait on the resume port before reading any per-VM configuration. Once the guest is waiting, the
+// runner saves its memory (via migration to a file) and root disk next to each other, and exits.
+//
+// A runner resuming from the image first claims it by renaming it, so that no other runner on the
+// node can use it too, then restores it with '-incoming'. Once the guest is running, the runner
+// tells it to continue booting, which it does with this VM's runtime disk.
+//
+// Every VM resumed from an image starts with the same memory, including the state of the guest's
+// random number generator. On x86, QEMU's vmgenid device gets a new ID each time the image is
+// resumed, which makes the guest kernel reseed before init generates anything unique to the VM,
+// like its SSH host keys.
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+const (
+	resumePortSocket = "/vm/resume.sock"
+
+	// the guest waits for this kernel argument, in vminit
+	resumeTemplateKernelArg = "neonvm.resume_template=1"
+
+	memoryImageRootDiskSuffix = ".rootdisk"
+	memoryImageClaimedSuffix  = ".claimed"
+
+	// resumeTemplateReadyTimeout is how long to wait for the guest to be ready to save, which
+	// includes booting the kernel.
+	resumeTemplateReadyTimeout = 5 * time.Minute
+)
+
+func resumePortArgs(architecture string) []string {
+	args := []string{
+		"-chardev", fmt.Sprintf("socket,path=%s,server=on,wait=off,id=resume0", resumePortSocket),
+		"-device", "virtserialport,chardev=resume0,name=tech.neon.resume.0",
+	}
+	if architecture == architectureAmd64 {
+		// 'auto' generates a new ID every time QEMU starts, including when resuming the image.
+		args = append(args, "-device", "vmgenid,guid=auto")
+	}
+	return args
+}
+
+// removeStaleMemoryImages removes images in dir that are older than maxAge, including any left
+// behind by runners that failed to save or resume them.
+func removeStaleMemoryImages(logger *zap.Logger, dir string, maxAge time.Duration) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logger.Warn("failed to list memory images", zap.Error(err))
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		logger.Info("Removing stale memory image", zap.String("path", path))
+		if err := os.Remove(path); err != nil {
+			logger.Warn("failed to remove stale memory image", zap.String("path", path), zap.Error(err))
+		}
+	}
+}
+
+// claimMemoryImage claims the memory image at path, replacing the VM's root disk with the one
+// saved alongside it. It returns the path of the claimed image.
+func claimMemoryImage(logger *zap.Logger, path string) (string, error) {
+	claimed := path + memoryImageClaimedSuffix
+	// This fails if the image doesn't exist, e.g. because we're on a different node, or another
+	// runner claimed it first.
+	if err := os.Rename(path, claimed); err != nil {
+		return "", fmt.Errorf("failed to claim memory image: %w", err)
+	}
+
+	rootDisk := path + memoryImageRootDiskSuffix
+	logger.Info("Replacing root disk with the one from the memory image", zap.String("path", rootDisk))
+	err := copyFile(rootDisk, rootDiskPath)
+	_ = os.Remove(rootDisk)
+	if err != nil {
+		_ = os.Remove(claimed)
+		return "", fmt.Errorf("failed to copy root disk from memory image: %w", err)
+	}
+
+	return claimed, nil
+}
+
+// copyFile overwrites dst with the contents of src, keeping dst's ownership and permissions.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// saveMemoryImage waits for the guest to be ready, then saves its memory and root disk to path
+// and quits QEMU.
+func saveMemoryImage(ctx context.Context, logger *zap.Logger, path string) error {
+	logger = logger.Named("save-memory-image")
+
+	err := func() error {
+		if err := waitForResumeTemplate(ctx, logger); err != nil {
+			return err
+		}
+
+		logger.Info("Guest is ready, saving memory image", zap.String("path", path))
+		if err := runQMPCommand("stop", nil, nil); err != nil {
+			return err
+		}
+		tmpPath := path + ".tmp"
+		err := runQMPCommand("migrate", map[string]any{"uri": fmt.Sprintf("exec:cat > %s", tmpPath)}, nil)
+		if err != nil {
+			return err
+		}
+		if err := waitForMigration(ctx); err != nil {
+			_ = os.Remove(tmpPath)
+			return err
+		}
+
+		// QEMU flushes the disks when the guest is stopped, so the root disk is consistent with
+		// the memory image. The memory image is renamed last, so that it's only claimed once
+		// the root disk is in place.
+		if err := copyFile(rootDiskPath, path+memoryImageRootDiskSuffix); err != nil {
+			_ = os.Remove(tmpPath)
+			return fmt.Errorf("failed to save root disk: %w", err)
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			return fmt.Errorf("failed to rename memory image: %w", err)
+		}
+
+		logger.Info("Saved memory image", zap.String("path", path))
+		return nil
+	}()
+
+	// There's nothing left for QEMU to do either way
+	if err := runQMPCommand("quit", nil, nil); err != nil {
+		logger.Warn("failed to quit QEMU", zap.Error(err))
+	}
+	return err
+}
+
+// waitForResumeTemplate waits for the guest to report through the resume port that it's
+// waiting to be resumed.
+func waitForResumeTemplate(ctx context.Context, logger *zap.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, resumeTemplateReadyTimeout)
+	defer cancel()
+
+	for {
+		conn, err := net.Dial("unix", resumePortSocket)
+		if err == nil {
+			// The guest repeatedly sends "ready" until it's resumed, so we can't miss it.
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			conn.Close()
+			if err == nil && strings.TrimSpace(line) == "ready" {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for guest to be ready to save: %w", context.Cause(ctx))
+		case <-time.After(time.Second):
+			logger.Info("Waiting for guest to be ready to save")
+		}
+	}
+}
+
+// waitForMigration waits for an outgoing migration (i.e. saving to a memory image) to complete.
+func waitForMigration(ctx context.Context) error {
+	for {
+		var info struct {
+			Status string `json:"status"`
+		}
+		if err := runQMPCommand("query-migrate", nil, &info); err != nil {
+			return err
+		}
+		switch info.Status {
+		case "completed":
+			return nil
+		case "failed", "cancelled":
+			return fmt.Errorf("saving memory image %s", info.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.New("QEMU exited while saving memory image")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// finishResume waits for QEMU to restore the memory image, and then tells the guest to continue
+// booting.
+func finishResume(ctx context.Context, logger *zap.Logger, wg *sync.WaitGroup, claimedPath string) {
+	defer wg.Done()
+	logger = logger.Named("finish-resume")
+
+	err := util.Retry(ctx, util.RetryConfig{
+		Backoff:     util.Backoff{Initial: 100 * time.Millisecond, Max: 0, Multiplier: 0, Jitter: 0},
+		MaxAttempts: 0,
+		ShouldRetry: nil,
+		OnRetry:     nil,
+	}, func() error {
+		var status struct {
+			Status string `json:"status"`
+		}
+		if err := runQMPCommand("query-status", nil, &status); err != nil {
+			return err
+		} else if status.Status != "running" {
+			return fmt.Errorf("QEMU status is %q", status.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		return // context was canceled
+	}
+
+	// QEMU has read all of the image by now
+	if err := os.Remove(claimedPath); err != nil {
+		logger.Warn("failed to remove claimed memory image", zap.Error(err))
+	}
+
+	conn, err := net.Dial("unix", resumePortSocket)
+	if err != nil {
+		logger.Error("failed to connect to resume port", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("resume\n")); err != nil {
+		logger.Error("failed to tell guest to resume", zap.Error(err))
+		return
+	}
+	logger.Info("Resumed guest from memory image")
+}
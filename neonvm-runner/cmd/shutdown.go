@@ -0,0 +1,151 @@
+package main
+
+// Graceful shutdown of the guest when the runner pod is deleted, escalating from asking the guest
+// to power off, to asking QEMU to quit, to killing QEMU.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/digitalocean/go-qemu/qmp"
+	"go.uber.org/zap"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+const (
+	// defaultGracePeriod is used if the VM doesn't set terminationGracePeriodSeconds, matching the
+	// CRD's default.
+	defaultGracePeriod = 5 * time.Second
+
+	// qemuQuitTimeout is how long to wait for QEMU to exit after 'quit', before killing it.
+	//
+	// This must fit in vmv1.ShutdownEscalationSeconds, along with the time to kill QEMU.
+	qemuQuitTimeout = 5 * time.Second
+)
+
+// currentShutdownStage is the stage of the shutdown sequence, reported on /shutdown_stage.
+var currentShutdownStage atomic.Value // vmv1.ShutdownStage
+
+func getShutdownStage() vmv1.ShutdownStage {
+	stage, _ := currentShutdownStage.Load().(vmv1.ShutdownStage)
+	return stage
+}
+
+func setShutdownStage(logger *zap.Logger, stage vmv1.ShutdownStage) {
+	logger.Info("Entering shutdown stage", zap.String("stage", string(stage)))
+	currentShutdownStage.Store(stage)
+}
+
+func gracePeriod(vmSpec *vmv1.VirtualMachineSpec) time.Duration {
+	if vmSpec.TerminationGracePeriodSeconds == nil {
+		return defaultGracePeriod
+	}
+	return time.Duration(*vmSpec.TerminationGracePeriodSeconds) * time.Second
+}
+
+// shutdownQEMUOnSigterm waits for SIGTERM and then shuts down the guest with shutdownQEMU, killing
+// QEMU with kill if it doesn't exit in time. ctx is expected to be canceled once QEMU exits.
+func shutdownQEMUOnSigterm(ctx context.Context, logger *zap.Logger, wg *sync.WaitGroup, gracePeriod time.Duration, kill func() error) {
+	logger = logger.Named("shutdown-qemu-on-sigterm")
+
+	defer wg.Done()
+	logger.Info("watching OS signals")
+	c := make(chan os.Signal, 1) // we need to reserve to buffer size 1, so the notifier are not blocked
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-c:
+	case <-ctx.Done():
+		logger.Info("context canceled, not going to shut down QEMU because it's already finished")
+		return
+	}
+
+	logger.Info("got signal, shutting down QEMU", zap.Duration("gracePeriod", gracePeriod))
+	shutdownQEMU(ctx, logger, gracePeriod, qemuQuitTimeout, kill)
+}
+
+// shutdownQEMU shuts down the guest, escalating at each stage if QEMU has not exited in time: the
+// guest is asked to power off for up to gracePeriod, then QEMU is asked to quit for up to
+// quitTimeout, and then QEMU is killed with kill.
+//
+// ctx is expected to be canceled once QEMU exits.
+func shutdownQEMU(ctx context.Context, logger *zap.Logger, gracePeriod, quitTimeout time.Duration, kill func() error) {
+	setShutdownStage(logger, vmv1.ShutdownStagePowerdown)
+	if err := guestShutdown(); err != nil {
+		logger.Warn("failed to shut down guest via guest agent, falling back to ACPI powerdown", zap.Error(err))
+		if err := runQMPCommand("system_powerdown", nil, nil); err != nil {
+			logger.Error("failed to execute system_powerdown command", zap.Error(err))
+		}
+	}
+	if waitForExit(ctx, gracePeriod) {
+		return
+	}
+
+	setShutdownStage(logger, vmv1.ShutdownStageQuit)
+	if err := runQMPCommand("quit", nil, nil); err != nil {
+		logger.Error("failed to execute quit command", zap.Error(err))
+	}
+	if waitForExit(ctx, quitTimeout) {
+		return
+	}
+
+	setShutdownStage(logger, vmv1.ShutdownStageKill)
+	if err := kill(); err != nil {
+		logger.Error("failed to kill QEMU", zap.Error(err))
+	}
+}
+
+// waitForExit returns whether ctx was canceled, i.e. QEMU exited, before the timeout.
+func waitForExit(ctx context.Context, timeout time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// runQMPCommand runs the command on the QEMU monitor, unmarshaling its return value into result,
+// if non-nil.
+func runQMPCommand(command string, arguments any, result any) error {
+	mon, err := qmp.NewSocketMonitor("unix", qmpUnixSocketForSigtermHandler, 2*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to QEMU monitor: %w", err)
+	}
+	if err := mon.Connect(); err != nil {
+		return fmt.Errorf("failed to start monitor connection: %w", err)
+	}
+	defer mon.Disconnect() //nolint:errcheck // nothing to do with error when deferred. TODO: log it?
+
+	req := map[string]any{"execute": command}
+	if arguments != nil {
+		req["arguments"] = arguments
+	}
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	raw, err := mon.Run(reqJSON)
+	if err != nil {
+		return fmt.Errorf("failed to execute %s: %w", command, err)
+	}
+	if result == nil {
+		return nil
+	}
+
+	var resp struct {
+		Return json.RawMessage `json:"return"`
+	}
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return fmt.Errorf("failed to unmarshal %s response: %w", command, err)
+	}
+	return json.Unmarshal(resp.Return, result)
+}
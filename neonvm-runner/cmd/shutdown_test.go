@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+type fakeQMPCommand struct {
+	Execute   string          `json:"execute"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+// fakeQMP records the commands it receives, other than the capabilities handshake.
+type fakeQMP struct {
+	mu       sync.Mutex
+	commands []string
+}
+
+func (q *fakeQMP) received() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string{}, q.commands...)
+}
+
+// startFakeQMP replaces the QMP socket with one that answers every command successfully, after
+// calling handle with its name.
+func startFakeQMP(t *testing.T, handle func(command string)) *fakeQMP {
+	return startFakeQMPWith(t, func(cmd fakeQMPCommand) any {
+		handle(cmd.Execute)
+		return map[string]any{"return": map[string]any{}}
+	})
+}
+
+// startFakeQMPWith is like startFakeQMP, but answers each command with the value returned by
+// handle.
+func startFakeQMPWith(t *testing.T, handle func(cmd fakeQMPCommand) any) *fakeQMP {
+	dir, err := os.MkdirTemp("", "qmp")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "qmp.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	oldSocket := qmpUnixSocketForSigtermHandler
+	qmpUnixSocketForSigtermHandler = socket
+	t.Cleanup(func() { qmpUnixSocketForSigtermHandler = oldSocket })
+
+	//nolint:exhaustruct // the commands are added as they're received
+	q := &fakeQMP{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go q.serve(conn, handle)
+		}
+	}()
+	return q
+}
+
+func (q *fakeQMP) serve(conn net.Conn, handle func(cmd fakeQMPCommand) any) {
+	defer conn.Close()
+
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+	greeting := map[string]any{
+		"QMP": map[string]any{
+			"version":      map[string]any{"qemu": map[string]int{"major": 9, "minor": 0, "micro": 0}, "package": ""},
+			"capabilities": []string{},
+		},
+	}
+	if err := enc.Encode(greeting); err != nil {
+		return
+	}
+	for {
+		var cmd fakeQMPCommand
+		if err := dec.Decode(&cmd); err != nil {
+			return
+		}
+		var resp any = map[string]any{"return": map[string]any{}}
+		if cmd.Execute != "qmp_capabilities" {
+			q.mu.Lock()
+			q.commands = append(q.commands, cmd.Execute)
+			q.mu.Unlock()
+			resp = handle(cmd)
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+func TestShutdownQEMU(t *testing.T) {
+	const (
+		gracePeriod = 200 * time.Millisecond
+		quitTimeout = 200 * time.Millisecond
+	)
+
+	cases := []struct {
+		name string
+		// whether the guest agent is running
+		guestAgent bool
+		// the command after which QEMU exits, if any
+		exitAfter     string
+		expectedQMP   []string
+		expectedStage vmv1.ShutdownStage
+		expectKill    bool
+	}{
+		{
+			name:          "GuestPowersOff",
+			guestAgent:    true,
+			exitAfter:     "guest-shutdown",
+			expectedQMP:   []string{},
+			expectedStage: vmv1.ShutdownStagePowerdown,
+			expectKill:    false,
+		},
+		{
+			name:          "ACPIPowerdown",
+			guestAgent:    false,
+			exitAfter:     "system_powerdown",
+			expectedQMP:   []string{"system_powerdown"},
+			expectedStage: vmv1.ShutdownStagePowerdown,
+			expectKill:    false,
+		},
+		{
+			name:          "Quit",
+			guestAgent:    true,
+			exitAfter:     "quit",
+			expectedQMP:   []string{"quit"},
+			expectedStage: vmv1.ShutdownStageQuit,
+			expectKill:    false,
+		},
+		{
+			name:          "Kill",
+			guestAgent:    false,
+			exitAfter:     "",
+			expectedQMP:   []string{"system_powerdown", "quit"},
+			expectedStage: vmv1.ShutdownStageKill,
+			expectKill:    true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			currentShutdownStage.Store(vmv1.ShutdownStage(""))
+			ctx, exit := context.WithCancel(context.Background())
+			defer exit()
+
+			qmp := startFakeQMP(t, func(command string) {
+				if command == c.exitAfter {
+					exit()
+				}
+			})
+			if c.guestAgent {
+				startFakeGuestAgent(t, func(cmd fakeGuestAgentCommand) any {
+					assert.Equal(t, "guest-shutdown", cmd.Execute)
+					if cmd.Execute == c.exitAfter {
+						exit()
+					}
+					return guestAgentOK(cmd)
+				})
+			} else {
+				oldSocket := guestAgentSocket
+				guestAgentSocket = filepath.Join(t.TempDir(), "missing.sock")
+				t.Cleanup(func() { guestAgentSocket = oldSocket })
+			}
+
+			var killed atomic.Int32
+			kill := func() error {
+				killed.Add(1)
+				exit()
+				return nil
+			}
+
+			shutdownQEMU(ctx, zap.NewNop(), gracePeriod, quitTimeout, kill)
+
+			assert.Equal(t, c.expectedQMP, qmp.received())
+			assert.Equal(t, c.expectedStage, getShutdownStage())
+			if c.expectKill {
+				assert.Equal(t, int32(1), killed.Load())
+			} else {
+				assert.Zero(t, killed.Load())
+			}
+		})
+	}
+
+	t.Run("KillFailed", func(t *testing.T) {
+		currentShutdownStage.Store(vmv1.ShutdownStage(""))
+		startFakeQMP(t, func(string) {})
+
+		// Nothing else to do, but it shouldn't hang
+		shutdownQEMU(context.Background(), zap.NewNop(), gracePeriod, quitTimeout, func() error {
+			return errors.New("no such process")
+		})
+		assert.Equal(t, vmv1.ShutdownStageKill, getShutdownStage())
+	})
+}
+
+func TestQEMUProcess(t *testing.T) {
+	//nolint:exhaustruct // the process is set once it's started
+	qemu := &qemuProcess{}
+	_, err := qemu.pid()
+	assert.ErrorContains(t, err, "QEMU has not been started")
+	assert.ErrorContains(t, qemu.kill(), "QEMU has not been started")
+
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, cmd.Start())
+	qemu.process.Store(cmd.Process)
+
+	pid, err := qemu.pid()
+	require.NoError(t, err)
+	assert.Equal(t, cmd.Process.Pid, pid)
+
+	require.NoError(t, qemu.kill())
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, cmd.Wait(), &exitErr)
+	assert.Equal(t, "signal: killed", exitErr.Error())
+
+	// Once it's exited, there's nothing to kill
+	assert.Error(t, qemu.kill())
+}
+
+func TestShutdownQEMUOnSigtermAfterExit(t *testing.T) {
+	currentShutdownStage.Store(vmv1.ShutdownStage(""))
+
+	// If QEMU has already exited, there's nothing to shut down
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	shutdownQEMUOnSigterm(ctx, zap.NewNop(), &wg, time.Second, func() error {
+		t.Error("QEMU shouldn't be killed")
+		return nil
+	})
+	wg.Wait()
+
+	assert.Empty(t, getShutdownStage())
+}
+
+func TestHandleShutdownStage(t *testing.T) {
+	get := func() (int, api.RunnerShutdownStatus) {
+		rec := httptest.NewRecorder()
+		handleShutdownStage(zap.NewNop(), rec, httptest.NewRequest("GET", "/shutdown_stage", nil))
+		var status api.RunnerShutdownStatus
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+		}
+		return rec.Code, status
+	}
+
+	currentShutdownStage.Store(vmv1.ShutdownStage(""))
+	code, status := get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, api.RunnerShutdownStatus{Stage: ""}, status)
+
+	setShutdownStage(zap.NewNop(), vmv1.ShutdownStageQuit)
+	code, status = get()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, api.RunnerShutdownStatus{Stage: vmv1.ShutdownStageQuit}, status)
+	currentShutdownStage.Store(vmv1.ShutdownStage(""))
+
+	rec := httptest.NewRecorder()
+	handleShutdownStage(zap.NewNop(), rec, httptest.NewRequest("POST", "/shutdown_stage", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestGracePeriod(t *testing.T) {
+	//nolint:exhaustruct // only the grace period is used
+	spec := &vmv1.VirtualMachineSpec{}
+	assert.Equal(t, defaultGracePeriod, gracePeriod(spec))
+
+	seconds := int64(20)
+	spec.TerminationGracePeriodSeconds = &seconds
+	assert.Equal(t, 20*time.Second, gracePeriod(spec))
+}
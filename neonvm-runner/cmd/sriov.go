@@ -0,0 +1,47 @@
+package main
+
+// SR-IOV virtual functions passed through to the guest with VFIO.
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// sriovDeviceAddrs returns the PCI addresses of the VFs allocated to the pod by the SR-IOV device
+// plugin, which it passes via the PCIDEVICE_<resource name> environment variable.
+func sriovDeviceAddrs(sriov *vmv1.SRIOVNetwork) ([]string, error) {
+	envName := "PCIDEVICE_" + strings.ToUpper(strings.NewReplacer("/", "_", ".", "_", "-", "_").Replace(sriov.ResourceName))
+	value := os.Getenv(envName)
+	if value == "" {
+		return nil, fmt.Errorf("no SR-IOV device allocated for resource %q (%s is not set)", sriov.ResourceName, envName)
+	}
+	return strings.Split(value, ","), nil
+}
+
+// setupSRIOVNetwork returns the QEMU args to pass the pod's VFs through to the guest.
+func setupSRIOVNetwork(logger *zap.Logger, sriov *vmv1.SRIOVNetwork) ([]string, error) {
+	addrs, err := sriovDeviceAddrs(sriov)
+	if err != nil {
+		return nil, err
+	}
+
+	// VFIO pins all of guest memory, which needs an unlimited memlock limit. This is inherited by
+	// QEMU.
+	limit := unix.Rlimit{Cur: unix.RLIM_INFINITY, Max: unix.RLIM_INFINITY}
+	if err := unix.Setrlimit(unix.RLIMIT_MEMLOCK, &limit); err != nil {
+		return nil, fmt.Errorf("failed to raise memlock limit: %w", err)
+	}
+
+	var qemuCmd []string
+	for i, addr := range addrs {
+		logger.Info("passing through SR-IOV device", zap.String("address", addr))
+		qemuCmd = append(qemuCmd, "-device", fmt.Sprintf("vfio-pci,host=%s,id=sriov%d", addr, i))
+	}
+	return qemuCmd, nil
+}
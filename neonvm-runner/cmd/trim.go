@@ -0,0 +1,70 @@
+package main
+
+// Periodically trimming the filesystems of empty disks with .trimInterval set, via the guest agent,
+// so that space freed in the guest is released on the node.
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// trimDisks runs fstrim in the guest at the shortest trim interval of the VM's disks, until the
+// context is canceled.
+//
+// guest-fstrim trims every mounted filesystem in the guest, so the disks can't be trimmed
+// separately.
+func trimDisks(ctx context.Context, logger *zap.Logger, wg *sync.WaitGroup, vmSpec *vmv1.VirtualMachineSpec) {
+	defer wg.Done()
+	logger = logger.Named("fstrim")
+
+	var interval time.Duration
+	var mountPaths []string
+	for _, disk := range vmSpec.Disks {
+		if disk.EmptyDisk == nil || disk.EmptyDisk.TrimInterval == nil || disk.MountPath == "" {
+			continue
+		}
+		if d := disk.EmptyDisk.TrimInterval.Duration; interval == 0 || d < interval {
+			interval = d
+		}
+		mountPaths = append(mountPaths, disk.MountPath)
+	}
+	if len(mountPaths) == 0 {
+		return
+	}
+
+	// The first trim is after one interval, because the filesystems start out empty.
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			results, err := guestFstrim()
+			if err != nil {
+				logger.Warn("failed to trim filesystems in the guest", zap.Error(err))
+				continue
+			}
+			for _, r := range results {
+				// Other filesystems may not support discards, so only their errors are expected.
+				if !slices.Contains(mountPaths, r.Path) {
+					continue
+				}
+				if r.Error != "" {
+					logger.Warn("failed to trim filesystem in the guest", zap.String("path", r.Path), zap.String("error", r.Error))
+				} else {
+					logger.Info("trimmed filesystem in the guest", zap.String("path", r.Path), zap.Int64("trimmed", r.Trimmed))
+				}
+			}
+			logger.Info("fstrim finished", zap.Duration("duration", time.Since(start)))
+		}
+	}
+}
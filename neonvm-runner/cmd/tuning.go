@@ -0,0 +1,110 @@
+package main
+
+// Per-node hypervisor tuning, provided by the node that the runner is scheduled onto.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// thpPolicyDefault leaves transparent hugepages as configured on the host.
+	thpPolicyDefault = "default"
+	// thpPolicyNever disables transparent hugepages for QEMU, regardless of the host setting.
+	thpPolicyNever = "never"
+)
+
+// nodeTuningProfile is the set of hypervisor settings that operators may tune per node pool, read
+// from a JSON file on the host. All fields are optional; unset fields keep the default behavior.
+type nodeTuningProfile struct {
+	// KSM sets whether guest memory is marked as mergeable by kernel same-page merging, via QEMU's
+	// '-machine mem-merge'. This has no effect unless KSM is also enabled on the host.
+	KSM *bool `json:"ksm,omitempty"`
+
+	// MemLock sets whether QEMU should lock all guest memory, via '-overcommit mem-lock'.
+	MemLock *bool `json:"memLock,omitempty"`
+
+	// TransparentHugepages is the THP policy for QEMU; one of "default" or "never".
+	TransparentHugepages *string `json:"transparentHugepages,omitempty"`
+
+	// VhostNet sets whether network devices use in-kernel vhost worker threads. Defaults to true.
+	VhostNet *bool `json:"vhostNet,omitempty"`
+}
+
+// loadNodeTuningProfile reads the tuning profile at path, returning an empty profile if path is
+// empty or the file does not exist.
+func loadNodeTuningProfile(path string) (*nodeTuningProfile, error) {
+	var profile nodeTuningProfile
+	if path == "" {
+		return &profile, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &profile, nil
+		}
+		return nil, fmt.Errorf("failed to read node tuning profile: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&profile); err != nil {
+		return nil, fmt.Errorf("failed to decode node tuning profile: %w", err)
+	}
+
+	if thp := profile.TransparentHugepages; thp != nil && *thp != thpPolicyDefault && *thp != thpPolicyNever {
+		return nil, fmt.Errorf("invalid transparentHugepages policy %q, must be %q or %q", *thp, thpPolicyDefault, thpPolicyNever)
+	}
+
+	return &profile, nil
+}
+
+func (p *nodeTuningProfile) vhostNet() bool {
+	return p.VhostNet == nil || *p.VhostNet
+}
+
+// machineOptions returns the extra options to append to the '-machine' argument.
+func (p *nodeTuningProfile) machineOptions() string {
+	if p.KSM == nil {
+		return ""
+	}
+	return fmt.Sprintf(",mem-merge=%s", onOff(*p.KSM))
+}
+
+// qemuArgs returns the extra QEMU arguments from the profile, other than those already covered
+// by machineOptions.
+func (p *nodeTuningProfile) qemuArgs() []string {
+	if p.MemLock == nil {
+		return nil
+	}
+	return []string{"-overcommit", fmt.Sprintf("mem-lock=%s", onOff(*p.MemLock))}
+}
+
+// applyToProcess applies the settings from the profile that are inherited by QEMU from the
+// runner process.
+func (p *nodeTuningProfile) applyToProcess(logger *zap.Logger) error {
+	if p.TransparentHugepages != nil && *p.TransparentHugepages == thpPolicyNever {
+		logger.Info("Disabling transparent hugepages")
+		// PR_SET_THP_DISABLE is inherited by child processes and preserved across execve, so
+		// this also applies to QEMU.
+		if err := unix.Prctl(unix.PR_SET_THP_DISABLE, 1, 0, 0, 0); err != nil {
+			return fmt.Errorf("failed to disable transparent hugepages: %w", err)
+		}
+	}
+	return nil
+}
+
+func onOff(value bool) string {
+	if value {
+		return "on"
+	}
+	return "off"
+}
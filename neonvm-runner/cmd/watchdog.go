@@ -0,0 +1,35 @@
+package main
+
+// Handling for the VM's watchdog device (.spec.watchdog)
+
+import (
+	"fmt"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// watchdogKernelArg tells the guest's init to keep the watchdog alive, with vm-builder's
+// start-watchdog.sh.
+const watchdogKernelArg = "neonvm.watchdog=on"
+
+// watchdogArgs returns the QEMU and kernel arguments for the VM's watchdog, or nil if it doesn't
+// have one.
+//
+// The watchdog is only started once the guest opens it, so the device is useless without the
+// kernel argument, and they must always be added together. After the guest starts it, QEMU takes
+// the watchdog's action if the guest stops petting it.
+func watchdogArgs(watchdog *vmv1.Watchdog) (qemuArgs []string, kernelArgs []string) {
+	if watchdog == nil {
+		return nil, nil
+	}
+
+	action := watchdog.Action
+	if action == "" {
+		action = vmv1.WatchdogActionReset
+	}
+	qemuArgs = []string{
+		"-device", "i6300esb,id=watchdog0",
+		"-action", fmt.Sprintf("watchdog=%s", action),
+	}
+	return qemuArgs, []string{watchdogKernelArg}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+func TestWatchdogArgs(t *testing.T) {
+	qemuArgs, kernelArgs := watchdogArgs(nil)
+	assert.Nil(t, qemuArgs)
+	assert.Nil(t, kernelArgs)
+
+	qemuArgs, kernelArgs = watchdogArgs(&vmv1.Watchdog{Action: ""})
+	assert.Equal(t, []string{"-device", "i6300esb,id=watchdog0", "-action", "watchdog=reset"}, qemuArgs)
+	assert.Equal(t, []string{watchdogKernelArg}, kernelArgs)
+
+	qemuArgs, kernelArgs = watchdogArgs(&vmv1.Watchdog{Action: vmv1.WatchdogActionPoweroff})
+	assert.Equal(t, []string{"-device", "i6300esb,id=watchdog0", "-action", "watchdog=poweroff"}, qemuArgs)
+	assert.Equal(t, []string{watchdogKernelArg}, kernelArgs)
+}
+
+func TestWatchdogKernelCmdline(t *testing.T) {
+	//nolint:exhaustruct // only the fields used by makeKernelCmdline
+	cfg := &Config{architecture: architectureAmd64, autoMovableRatio: "301"}
+	//nolint:exhaustruct // only the fields used by makeKernelCmdline
+	vmSpec := &vmv1.VirtualMachineSpec{}
+	status := &vmv1.VirtualMachineStatus{} //nolint:exhaustruct // not used without extra network
+
+	cmdline := strings.Fields(makeKernelCmdline(cfg, zap.NewNop(), vmSpec, status, ""))
+	assert.NotContains(t, cmdline, watchdogKernelArg)
+
+	vmSpec.Watchdog = &vmv1.Watchdog{Action: vmv1.WatchdogActionReset}
+	cmdline = strings.Fields(makeKernelCmdline(cfg, zap.NewNop(), vmSpec, status, ""))
+	assert.Contains(t, cmdline, watchdogKernelArg)
+}
+
+// The guest only starts petting the watchdog if vm-builder's init runs start-watchdog.sh, which
+// must check for the same kernel argument.
+func TestWatchdogGuestSetup(t *testing.T) {
+	script, err := os.ReadFile("../../vm-builder/files/start-watchdog.sh")
+	require.NoError(t, err)
+	assert.Contains(t, string(script), "'"+watchdogKernelArg+"'")
+	assert.Contains(t, string(script), "/dev/watchdog")
+
+	inittab, err := os.ReadFile("../../vm-builder/files/inittab")
+	require.NoError(t, err)
+	assert.Contains(t, string(inittab), "::respawn:/neonvm/bin/start-watchdog\n")
+}
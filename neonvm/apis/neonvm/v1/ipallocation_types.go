@@ -0,0 +1,55 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// IPAllocationPoolLabel is the label on each IPAllocation with the name of the IPPool it was
+// allocated from, so that a pool's allocations can be listed.
+const IPAllocationPoolLabel = "vm.neon.tech/ippool"
+
+// IPAllocationSpec defines the desired state of IPAllocation
+type IPAllocationSpec struct {
+	// Pool is the name of the IPPool the IP was allocated from
+	Pool string `json:"pool"`
+	// IP is the allocated IP address, within the pool's range
+	IP string `json:"ip"`
+	// Owner is the VM that the IP is allocated to, as "namespace/name"
+	Owner string `json:"owner"`
+	// PodRef is the pod that the IP is allocated for, as "namespace/name", if any
+	// +optional
+	PodRef string `json:"podRef,omitempty"`
+}
+
+//+genclient
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:singular=ipallocation
+//+kubebuilder:printcolumn:name="IP",type=string,JSONPath=`.spec.ip`
+//+kubebuilder:printcolumn:name="Owner",type=string,JSONPath=`.spec.owner`
+//+kubebuilder:printcolumn:name="Pool",type=string,JSONPath=`.spec.pool`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// IPAllocation is the Schema for the ipallocations API
+//
+// Each IPAllocation records a single IP from an IPPool that's allocated to a VM. The name is
+// derived from the pool and the IP's offset within it, so the API server guarantees that the same
+// IP can't be allocated twice.
+type IPAllocation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec IPAllocationSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// IPAllocationList contains a list of IPAllocation
+type IPAllocationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IPAllocation `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IPAllocation{}, &IPAllocationList{}) //nolint:exhaustruct // just being used to provide the types
+}
@@ -10,12 +10,16 @@ type IPPoolSpec struct {
 	Range string `json:"range"`
 	// Allocations is the set of allocated IPs for the given range. Its` indices are a direct mapping to the
 	// IP with the same index/offset for the pool's range.
-	Allocations map[string]IPAllocation `json:"allocations"`
+	//
+	// Deprecated: Allocations are now stored as separate IPAllocation objects. Any remaining entries
+	// here are converted into IPAllocations by the controller the next time it uses the pool.
+	// +optional
+	Allocations map[string]IPPoolAllocation `json:"allocations,omitempty"`
 }
 
-// IPAllocation represents metadata about the pod/container owner of a specific IP
+// IPPoolAllocation represents metadata about the pod/container owner of a specific IP
 // coped from Whereabout CNI as their allocation functions used
-type IPAllocation struct {
+type IPPoolAllocation struct {
 	ContainerID string `json:"id"`
 	PodRef      string `json:"podref,omitempty"`
 }
@@ -89,6 +89,25 @@ func VirtualMachineOvercommitFromPod(pod *corev1.Pod) (*OvercommitSettings, erro
 	return extractFromAnnotation[OvercommitSettings](pod, VirtualMachineOvercommitAnnotation)
 }
 
+// VirtualMachineCPUClassFromPod returns the CPUClass of the virtual machine, as encoded by the
+// helper label on the pod.
+//
+// If the label is not present, which may be true for pods created by older versions of the
+// controller, this function returns CPUClassShared.
+func VirtualMachineCPUClassFromPod(pod *corev1.Pod) (CPUClass, error) {
+	value, ok := pod.Labels[VirtualMachineCPUClassLabel]
+	if !ok {
+		return CPUClassShared, nil
+	}
+
+	switch class := CPUClass(value); class {
+	case CPUClassShared, CPUClassDedicated:
+		return class, nil
+	default:
+		return "", fmt.Errorf("unknown value for %s label: %q", VirtualMachineCPUClassLabel, value)
+	}
+}
+
 func extractFromAnnotation[T any](pod *corev1.Pod, annotation string) (*T, error) {
 	jsonString, ok := pod.Annotations[annotation]
 	if !ok {
@@ -0,0 +1,124 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ScalingPolicySpec defines the desired state of ScalingPolicy
+//
+// All fields are optional. Any field that is left out falls back on the autoscaler-agent's global
+// default, and VM-specific settings (in the "autoscaling.neon.tech/config" annotation) take
+// precedence over the policy.
+type ScalingPolicySpec struct {
+	// TargetUtilization sets the desired utilization of the VM's resources
+	// +optional
+	TargetUtilization *ScalingPolicyTargetUtilization `json:"targetUtilization,omitempty"`
+
+	// StepLimits sets the maximum change in compute units for a single scaling decision
+	// +optional
+	StepLimits *ScalingPolicyStepLimits `json:"stepLimits,omitempty"`
+
+	// Stabilization sets how long to wait before acting on a lower goal
+	// +optional
+	Stabilization *ScalingPolicyStabilization `json:"stabilization,omitempty"`
+
+	// Schedules sets time windows during which the VM must be kept at or above some number of
+	// compute units.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Schedules []ScalingPolicySchedule `json:"schedules,omitempty"`
+}
+
+type ScalingPolicyTargetUtilization struct {
+	// LoadAveragePercent is the desired load average, as a percentage of current CPU.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=199
+	// +optional
+	LoadAveragePercent *int32 `json:"loadAveragePercent,omitempty"`
+	// MemoryUsagePercent is the maximum percentage of total memory that postgres allocations
+	// must fit into.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=99
+	// +optional
+	MemoryUsagePercent *int32 `json:"memoryUsagePercent,omitempty"`
+	// MemoryTotalPercent is the maximum percentage of total memory that postgres allocations plus
+	// the LFC must fit into.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=99
+	// +optional
+	MemoryTotalPercent *int32 `json:"memoryTotalPercent,omitempty"`
+}
+
+type ScalingPolicyStepLimits struct {
+	// MaxUpscaleCU is the maximum number of compute units to add in a single scaling decision.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxUpscaleCU *int32 `json:"maxUpscaleCU,omitempty"`
+	// MaxDownscaleCU is the maximum number of compute units to remove in a single scaling
+	// decision.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxDownscaleCU *int32 `json:"maxDownscaleCU,omitempty"`
+}
+
+type ScalingPolicyStabilization struct {
+	// DownscaleWindowSeconds is the duration over which the highest goal is used, so that the VM
+	// is only downscaled once its goal has stayed lower for the whole window.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	DownscaleWindowSeconds *int32 `json:"downscaleWindowSeconds,omitempty"`
+}
+
+// ScalingPolicySchedule is a recurring time window, in UTC, during which the VM must be kept at or
+// above MinCU.
+//
+// If EndTime is before StartTime, the window wraps around past midnight and Days refers to the day
+// that the window starts on.
+type ScalingPolicySchedule struct {
+	Name string `json:"name"`
+	// Days lists the days of the week on which the schedule applies. If empty, the schedule
+	// applies every day.
+	// +optional
+	Days []ScheduleDay `json:"days,omitempty"`
+	// StartTime is the UTC time of day at which the window starts, formatted as "HH:MM".
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	StartTime string `json:"startTime"`
+	// EndTime is the UTC time of day at which the window ends, formatted as "HH:MM".
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	EndTime string `json:"endTime"`
+	// MinCU is the minimum number of compute units during the window.
+	// +kubebuilder:validation:Minimum=0
+	MinCU int32 `json:"minCU"`
+}
+
+// +kubebuilder:validation:Enum=Mon;Tue;Wed;Thu;Fri;Sat;Sun
+type ScheduleDay string
+
+//+genclient
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:singular=scalingpolicy
+
+// ScalingPolicy is the Schema for the scalingpolicies API
+//
+// VMs reference a ScalingPolicy in the same namespace with the
+// "autoscaling.neon.tech/scaling-policy" annotation.
+type ScalingPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ScalingPolicySpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ScalingPolicyList contains a list of ScalingPolicy
+type ScalingPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ScalingPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ScalingPolicy{}, &ScalingPolicyList{}) //nolint:exhaustruct // just being used to provide the types
+}
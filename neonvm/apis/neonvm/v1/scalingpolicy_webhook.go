@@ -0,0 +1,157 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+//+kubebuilder:webhook:path=/validate-vm-neon-tech-v1-scalingpolicy,mutating=false,failurePolicy=fail,sideEffects=None,groups=vm.neon.tech,resources=scalingpolicies,verbs=create;update,versions=v1,name=vscalingpolicy.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &ScalingPolicy{}
+
+// ValidateCreate implements webhook.Validator
+//
+// The controller wraps this logic so it can inject extra control in the webhook.
+func (r *ScalingPolicy) ValidateCreate() (admission.Warnings, error) {
+	return nil, r.Spec.validate()
+}
+
+// ValidateUpdate implements webhook.Validator
+//
+// The controller wraps this logic so it can inject extra control in the webhook.
+func (r *ScalingPolicy) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	// Policies are meant to be changed centrally, so any valid update is allowed.
+	return nil, r.Spec.validate()
+}
+
+// ValidateDelete implements webhook.Validator
+//
+// The controller wraps this logic so it can inject extra control in the webhook.
+func (r *ScalingPolicy) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (s *ScalingPolicySpec) validate() error {
+	if s.StepLimits != nil {
+		if s.StepLimits.MaxUpscaleCU != nil && *s.StepLimits.MaxUpscaleCU < 1 {
+			return errors.New(".spec.stepLimits.maxUpscaleCU must be at least 1")
+		}
+		if s.StepLimits.MaxDownscaleCU != nil && *s.StepLimits.MaxDownscaleCU < 1 {
+			return errors.New(".spec.stepLimits.maxDownscaleCU must be at least 1")
+		}
+	}
+	if s.Stabilization != nil {
+		if w := s.Stabilization.DownscaleWindowSeconds; w != nil && *w < 0 {
+			return errors.New(".spec.stabilization.downscaleWindowSeconds must not be negative")
+		}
+	}
+
+	var names []string
+	for i, schedule := range s.Schedules {
+		if slices.Contains(names, schedule.Name) {
+			return fmt.Errorf(".spec.schedules[%d].name: duplicate schedule name %q", i, schedule.Name)
+		}
+		names = append(names, schedule.Name)
+
+		if err := schedule.Validate(); err != nil {
+			return fmt.Errorf(".spec.schedules[%d]%w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks that the schedule is well-formed. Errors are prefixed with the path to the
+// offending field within the schedule, e.g. ".startTime: ...".
+func (s ScalingPolicySchedule) Validate() error {
+	if s.Name == "" {
+		return errors.New(".name: must not be empty")
+	}
+
+	var days []ScheduleDay
+	for _, d := range s.Days {
+		if _, ok := scheduleWeekdays[d]; !ok {
+			return fmt.Errorf(".days: unknown day %q", d)
+		}
+		if slices.Contains(days, d) {
+			return fmt.Errorf(".days: duplicate day %q", d)
+		}
+		days = append(days, d)
+	}
+
+	start, err := ParseScheduleTime(s.StartTime)
+	if err != nil {
+		return fmt.Errorf(".startTime: %w", err)
+	}
+	end, err := ParseScheduleTime(s.EndTime)
+	if err != nil {
+		return fmt.Errorf(".endTime: %w", err)
+	}
+	if start == end {
+		return errors.New(".endTime: must not be equal to .startTime")
+	}
+
+	if s.MinCU < 0 {
+		return errors.New(".minCU: must not be negative")
+	}
+
+	return nil
+}
+
+var scheduleWeekdays = map[ScheduleDay]time.Weekday{
+	"Sun": time.Sunday,
+	"Mon": time.Monday,
+	"Tue": time.Tuesday,
+	"Wed": time.Wednesday,
+	"Thu": time.Thursday,
+	"Fri": time.Friday,
+	"Sat": time.Saturday,
+}
+
+// ParseScheduleTime parses an "HH:MM" time of day, returning the duration since midnight.
+func ParseScheduleTime(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// ActiveAt returns whether the schedule's window includes t, interpreted in UTC.
+//
+// The schedule must be valid; malformed times are treated as never active.
+func (s ScalingPolicySchedule) ActiveAt(t time.Time) bool {
+	start, err := ParseScheduleTime(s.StartTime)
+	if err != nil {
+		return false
+	}
+	end, err := ParseScheduleTime(s.EndTime)
+	if err != nil {
+		return false
+	}
+
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	sinceMidnight := t.Sub(midnight)
+
+	onDay := func(day time.Weekday) bool {
+		return len(s.Days) == 0 || slices.ContainsFunc(s.Days, func(d ScheduleDay) bool {
+			return scheduleWeekdays[d] == day
+		})
+	}
+
+	if start < end {
+		return onDay(t.Weekday()) && start <= sinceMidnight && sinceMidnight < end
+	}
+
+	// The window wraps around midnight, so it may have started either today or yesterday.
+	yesterday := (t.Weekday() + 6) % 7
+	return (onDay(t.Weekday()) && start <= sinceMidnight) || (onDay(yesterday) && sinceMidnight < end)
+}
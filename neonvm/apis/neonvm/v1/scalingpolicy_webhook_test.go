@@ -0,0 +1,63 @@
+package v1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tychoish/fun/assert"
+)
+
+func TestScalingPolicyValidate(t *testing.T) {
+	schedule := func(name, start, end string) ScalingPolicySchedule {
+		return ScalingPolicySchedule{Name: name, Days: nil, StartTime: start, EndTime: end, MinCU: 1}
+	}
+	policy := func(schedules ...ScalingPolicySchedule) *ScalingPolicy {
+		p := &ScalingPolicy{}
+		p.Spec.Schedules = schedules
+		return p
+	}
+
+	_, err := policy(schedule("a", "09:00", "17:00"), schedule("b", "22:00", "02:00")).ValidateCreate()
+	assert.NotError(t, err)
+
+	_, err = policy(schedule("a", "09:00", "17:00"), schedule("a", "18:00", "19:00")).ValidateCreate()
+	assert.Error(t, err)
+
+	_, err = policy(schedule("a", "09:00", "09:00")).ValidateCreate()
+	assert.Error(t, err)
+
+	_, err = policy(schedule("a", "9am", "17:00")).ValidateCreate()
+	assert.Error(t, err)
+}
+
+func TestScalingPolicyScheduleActiveAt(t *testing.T) {
+	// 2024-01-01 was a Monday.
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2024, time.January, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	daytime := ScalingPolicySchedule{
+		Name:      "daytime",
+		Days:      []ScheduleDay{"Mon"},
+		StartTime: "09:00",
+		EndTime:   "17:00",
+		MinCU:     1,
+	}
+	assert.True(t, !daytime.ActiveAt(monday(8, 59)))
+	assert.True(t, daytime.ActiveAt(monday(9, 0)))
+	assert.True(t, !daytime.ActiveAt(monday(17, 0)))
+	assert.True(t, !daytime.ActiveAt(monday(12, 0).Add(24*time.Hour)))
+
+	// Sunday night into Monday morning
+	overnight := ScalingPolicySchedule{
+		Name:      "overnight",
+		Days:      []ScheduleDay{"Sun"},
+		StartTime: "22:00",
+		EndTime:   "02:00",
+		MinCU:     1,
+	}
+	assert.True(t, overnight.ActiveAt(monday(1, 0)))
+	assert.True(t, !overnight.ActiveAt(monday(3, 0)))
+	assert.True(t, !overnight.ActiveAt(monday(23, 0)))
+	assert.True(t, overnight.ActiveAt(monday(23, 0).Add(-24*time.Hour)))
+}
@@ -19,7 +19,9 @@ package v1
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"slices"
+	"strconv"
 	"time"
 
 	"go.uber.org/zap/zapcore"
@@ -41,6 +43,16 @@ const (
 	// Label that determines the version of runner pod. May be missing on older runners
 	RunnerPodVersionLabel string = "vm.neon.tech/runner-version"
 
+	// VirtualMachineCPUClassLabel is the label assigned to each NeonVM Pod, providing the CPUClass
+	// of the VM running in it. May be missing on older runners, in which case the VM should be
+	// treated as CPUClassShared.
+	VirtualMachineCPUClassLabel string = "vm.neon.tech/cpu-class"
+
+	// ResumePoolLabel is the label assigned to runner Pods that create memory images for a resume
+	// pool, instead of running a VM. The value identifies the pool, so that only VMs with a
+	// matching spec resume from the images.
+	ResumePoolLabel string = "vm.neon.tech/resume-pool"
+
 	// VirtualMachineUsageAnnotation is the annotation added to each runner Pod, mirroring
 	// information about the resource allocations of the VM running in the pod.
 	//
@@ -58,6 +70,19 @@ const (
 	//
 	// The value of this annotation is always a JSON-encoded OvercommitSettings.
 	VirtualMachineOvercommitAnnotation string = "vm.neon.tech/overcommit"
+
+	// RunnerPodBootConfigAnnotation is the annotation added to each runner Pod, giving a hash of
+	// the parts of the VM's spec that only take effect when the guest boots, like the kernel
+	// command line. May be missing on older runners.
+	//
+	// When the VM's spec no longer matches, the VM is marked RestartPending.
+	RunnerPodBootConfigAnnotation string = "vm.neon.tech/boot-config-hash"
+
+	// VirtualMachineRestartRequestedAnnotation is the annotation set on VMs that are
+	// RestartPending once they are allowed to restart, by the controller's restart rollout. The
+	// value is the name of the runner pod that should be restarted, so that the annotation has no
+	// effect once that pod is gone.
+	VirtualMachineRestartRequestedAnnotation string = "vm.neon.tech/restart-requested"
 )
 
 // VirtualMachineUsage provides information about a VM's current usage. This is the type of the
@@ -67,6 +92,21 @@ type VirtualMachineUsage struct {
 	Memory *resource.Quantity `json:"memory"`
 }
 
+// RunnerTerminationMessage provides information about why the runner exited. This is the type of
+// the JSON-encoded data that the runner writes as the termination message of its container.
+type RunnerTerminationMessage struct {
+	// Reason is a CamelCase reason for the exit, e.g. RunnerTerminationReasonOOMKilled.
+	Reason string `json:"reason"`
+	// MemoryPeak is the peak memory usage of the runner container, if it's known.
+	MemoryPeak *resource.Quantity `json:"memoryPeak,omitempty"`
+	// MemoryLimit is the memory limit of the runner container, if it has one.
+	MemoryLimit *resource.Quantity `json:"memoryLimit,omitempty"`
+}
+
+// RunnerTerminationReasonOOMKilled is the RunnerTerminationMessage reason used when QEMU was
+// killed by the kernel because the runner container ran out of memory.
+const RunnerTerminationReasonOOMKilled = "OOMKilled"
+
 // VirtualMachineResources provides information about a VM's resource allocations.
 type VirtualMachineResources struct {
 	CPUs           CPUs              `json:"cpus"`
@@ -107,6 +147,22 @@ type VirtualMachineSpec struct {
 	ServiceAccountName string                      `json:"serviceAccountName,omitempty"`
 	PodResources       corev1.ResourceRequirements `json:"podResources,omitempty"`
 
+	// RuntimeClassName is the name of the RuntimeClass to use for the runner pod. If not set, the
+	// controller's default is used, if there is one.
+	//
+	// Any pod overhead from the RuntimeClass is reserved by the scheduler plugin in addition to
+	// the VM's resources.
+	// +optional
+	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
+
+	// EphemeralStorage sets the runner pod's ephemeral-storage request and limit, for what
+	// neonvm-runner keeps on the node's disk: the VM's root disk, QEMU's temporary files and
+	// logs, and live migration data.
+	//
+	// The sizes of the VM's swap and empty disks are added to both automatically.
+	// +optional
+	EphemeralStorage *EphemeralStorage `json:"ephemeralStorage,omitempty"`
+
 	// +kubebuilder:default:=Always
 	// +optional
 	RestartPolicy RestartPolicy `json:"restartPolicy"`
@@ -134,6 +190,16 @@ type VirtualMachineSpec struct {
 	// +optional
 	ExtraNetwork *ExtraNetwork `json:"extraNetwork,omitempty"`
 
+	// SRIOVNetwork attaches an SR-IOV virtual function to the guest with VFIO passthrough.
+	//
+	// VMs with an SR-IOV network cannot be live-migrated.
+	// +optional
+	SRIOVNetwork *SRIOVNetwork `json:"sriovNetwork,omitempty"`
+
+	// Network sets options for the VM's default (pod) network.
+	// +optional
+	Network *NetworkSettings `json:"network,omitempty"`
+
 	// +optional
 	ServiceLinks *bool `json:"service_links,omitempty"`
 
@@ -168,15 +234,127 @@ type VirtualMachineSpec struct {
 	// +optional
 	TargetRevision *RevisionWithTime `json:"targetRevision,omitempty"`
 
-	// Controls how CPU scaling is performed, either hotplug new CPUs with QMP, or enable them in sysfs.
+	// Controls how CPU scaling is performed, either hotplug new CPUs with QMP, enable them in sysfs,
+	// or keep all CPUs enabled and only adjust the cgroup CPU limit.
 	// +kubebuilder:default:=QmpScaling
 	// +optional
 	CpuScalingMode *CpuScalingMode `json:"cpuScalingMode,omitempty"`
 
+	// CPUClass determines how the VM's CPU is allocated on the node. Shared VMs may be
+	// overcommitted and compete for CPU via cgroup weights; dedicated VMs have their full
+	// .spec.guest.cpus.max reserved as guaranteed CPU requests on the runner pod, so they can be
+	// pinned by the kubelet's static CPU manager.
+	//
+	// Defaults to the VM's class, or shared.
+	// +optional
+	CPUClass *CPUClass `json:"cpuClass,omitempty"`
+
+	// ClassName is the name of the VirtualMachineClass that provides defaults for this VM.
+	//
+	// The class's bounds and CPU class are applied when the VM is created, and its other settings
+	// whenever a new runner pod is created for the VM. Cannot be changed after creation.
+	// +optional
+	ClassName string `json:"className,omitempty"`
+
 	// Enable network monitoring on the VM
 	// +kubebuilder:default:=false
 	// +optional
 	EnableNetworkMonitoring *bool `json:"enableNetworkMonitoring,omitempty"`
+
+	// Enable free page reporting on a virtio-balloon device, so that memory freed inside the guest
+	// is returned to the host.
+	// +kubebuilder:default:=false
+	// +optional
+	EnableFreePageReporting *bool `json:"enableFreePageReporting,omitempty"`
+
+	// Entropy configures the virtio-rng device that provides the guest with entropy from the host,
+	// so that freshly booted guests don't have to wait for enough entropy -- e.g. before accepting
+	// TLS connections. If not set, the controller sets it to the default (enabled, backed by
+	// /dev/urandom) before the VM is first started.
+	// +optional
+	Entropy *Entropy `json:"entropy,omitempty"`
+
+	// GuestMetrics makes the runner proxy a Prometheus metrics endpoint from inside the guest (e.g.
+	// node_exporter) on its own port, and annotates the runner pod so that it gets scraped.
+	// +optional
+	GuestMetrics *GuestMetrics `json:"guestMetrics,omitempty"`
+
+	// Watchdog, if not nil, adds an i6300esb watchdog device to the guest, which the guest's init
+	// keeps petting. If the guest stops responding -- e.g. because its kernel panicked -- QEMU takes
+	// the watchdog's action, so that the VM recovers by itself.
+	// +optional
+	Watchdog *Watchdog `json:"watchdog,omitempty"`
+
+	// MachineType is the QEMU machine type for the VM. If not set, the standard machine for the
+	// architecture is used.
+	//
+	// microvm has no PCI bus, so it boots faster and has less memory overhead, at the cost of not
+	// supporting hotplug: VMs using it must have .spec.guest.memorySlots.min equal to max, must not
+	// use QmpScaling, and cannot have a watchdog or SR-IOV network. It is only supported on amd64.
+	// Changes take effect the next time the VM restarts, and the VM can't be live migrated until
+	// then.
+	// +optional
+	MachineType *MachineType `json:"machineType,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=standard;microvm
+type MachineType string
+
+const (
+	// MachineTypeStandard is q35 on amd64, and virt on arm64.
+	MachineTypeStandard MachineType = "standard"
+	// MachineTypeMicroVM is QEMU's minimal microvm machine, with virtio devices attached over MMIO
+	// instead of PCI.
+	MachineTypeMicroVM MachineType = "microvm"
+)
+
+type Watchdog struct {
+	// Action is what QEMU does when the watchdog expires.
+	// +kubebuilder:default:=reset
+	// +optional
+	Action WatchdogAction `json:"action,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=reset;poweroff
+type WatchdogAction string
+
+const (
+	// WatchdogActionReset resets the guest, as if it was rebooted, within the same runner pod.
+	WatchdogActionReset WatchdogAction = "reset"
+	// WatchdogActionPoweroff stops the guest, so that the runner pod exits and the VM's
+	// restartPolicy is applied.
+	WatchdogActionPoweroff WatchdogAction = "poweroff"
+)
+
+type Entropy struct {
+	// Enabled sets whether the guest has a virtio-rng device. Disabling it may be required where
+	// the guest's randomness must not come from the host.
+	// +kubebuilder:default:=true
+	// +optional
+	Enabled *bool `json:"enabled,omitempty"`
+	// Source is the file in the runner container that the device reads from.
+	// +kubebuilder:default:=/dev/urandom
+	// +optional
+	Source EntropySource `json:"source,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=/dev/urandom;/dev/random
+type EntropySource string
+
+const (
+	EntropySourceURandom EntropySource = "/dev/urandom"
+	EntropySourceRandom  EntropySource = "/dev/random"
+)
+
+type GuestMetrics struct {
+	// Port is the port in the guest that serves the metrics.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+	// Path is the HTTP path of the metrics in the guest.
+	// +kubebuilder:default:="/metrics"
+	// +optional
+	Path string `json:"path,omitempty"`
 }
 
 type TLSProvisioning struct {
@@ -233,7 +411,7 @@ const (
 	CPUArchitectureARM64 CPUArchitecture = "arm64"
 )
 
-// +kubebuilder:validation:Enum=QmpScaling;SysfsScaling
+// +kubebuilder:validation:Enum=QmpScaling;SysfsScaling;CgroupScaling
 type CpuScalingMode string
 
 // FlagFunc is a parsing function to be used with flag.Func
@@ -241,6 +419,7 @@ func (p *CpuScalingMode) FlagFunc(value string) error {
 	possibleValues := []string{
 		string(CpuScalingModeQMP),
 		string(CpuScalingModeSysfs),
+		string(CpuScalingModeCgroup),
 	}
 
 	if !slices.Contains(possibleValues, value) {
@@ -259,6 +438,27 @@ const (
 	// CpuScalingModeSysfs is the value of the VirtualMachineSpec.CpuScalingMode field that
 	// indicates that the VM should use the CPU sysfs state interface to scale CPUs.
 	CpuScalingModeSysfs CpuScalingMode = "SysfsScaling"
+
+	// CpuScalingModeCgroup is the value of the VirtualMachineSpec.CpuScalingMode field that
+	// indicates that the VM should keep all vCPUs online, and scale only by adjusting the runner's
+	// cgroup cpu.max to the (possibly fractional) amount of CPU requested.
+	//
+	// Unlike the other modes, the cgroup limit is set exactly to the requested value, which allows
+	// compute units smaller than 1 vCPU.
+	CpuScalingModeCgroup CpuScalingMode = "CgroupScaling"
+)
+
+// +kubebuilder:validation:Enum=shared;dedicated
+type CPUClass string
+
+const (
+	// CPUClassShared is the value of the VirtualMachineSpec.CPUClass field that indicates that the
+	// VM's CPU is shared with other VMs on the node, and may be overcommitted.
+	CPUClassShared CPUClass = "shared"
+
+	// CPUClassDedicated is the value of the VirtualMachineSpec.CPUClass field that indicates that
+	// the VM's CPU is reserved exclusively for it, as whole cores with guaranteed pod requests.
+	CPUClassDedicated CPUClass = "dedicated"
 )
 
 // +kubebuilder:validation:Enum=Always;OnFailure;Never
@@ -276,16 +476,39 @@ type Guest struct {
 	// Set the maximum MOVABLE:KERNEL memory ratio in %.
 	// Kernel default is 301%.
 	// See https://docs.kernel.org/admin-guide/mm/memory-hotplug.html
+	//
+	// If set, this overrides the controller's global default for this VM. Must be an integer
+	// between 0 and 6300.
+	// +kubebuilder:validation:Pattern=^[0-9]+$
 	// +optional
 	MemhpAutoMovableRatio *string `json:"memhpAutoMovableRatio,omitempty"`
 	// +optional
 	AppendKernelCmdline *string `json:"appendKernelCmdline,omitempty"`
+	// Extra arguments to append to the guest kernel command line, each of the form 'name' or
+	// 'name=value', e.g. 'transparent_hugepage=never'.
+	//
+	// Each argument must be allowed by the controller's '--kernel-args-allowlist' and
+	// '--kernel-args-denylist'; VMs with arguments that aren't allowed are rejected. The total
+	// length of the arguments may be at most 1024 bytes.
+	// Changes take effect the next time the VM restarts.
+	// +optional
+	KernelArgs []string `json:"kernelArgs,omitempty"`
 
 	// +optional
 	CPUs CPUs `json:"cpus"`
+	// Defaults to the VM's class, or 1Gi.
 	// +optional
-	// +kubebuilder:default:="1Gi"
 	MemorySlotSize resource.Quantity `json:"memorySlotSize"`
+	// VirtioMemBlockSize is the block size of the VM's virtio-mem device, which is the granularity
+	// that memory is plugged and unplugged in. Smaller blocks let small VMs release memory in finer
+	// steps; larger blocks mean fewer hotplug operations when scaling large VMs.
+	//
+	// Must be a power of two, at least 2Mi, and evenly divide .spec.guest.memorySlotSize. If not
+	// set, the controller sets its default before the VM is first started. VMs started before this
+	// was set use 8Mi.
+	// Can only be set once.
+	// +optional
+	VirtioMemBlockSize *resource.Quantity `json:"virtioMemBlockSize,omitempty"`
 	// +optional
 	MemorySlots MemorySlots `json:"memorySlots"`
 	// +optional
@@ -309,19 +532,229 @@ type Guest struct {
 	// Cannot be updated.
 	// +optional
 	Settings *GuestSettings `json:"settings,omitempty"`
+
+	// NestedVirtualization, if true, exposes hardware virtualization (VMX or SVM) in the guest's
+	// CPU, so that the guest can run its own KVM-accelerated VMs. Requires .spec.enableAcceleration.
+	//
+	// Runner pods of these VMs are restricted to nodes that the controller knows support it.
+	// Cannot be updated.
+	// +kubebuilder:default:=false
+	// +optional
+	NestedVirtualization *bool `json:"nestedVirtualization,omitempty"`
+
+	// CPUFeatures sets a named model for the guest's CPU, and adds or removes individual features
+	// from it, e.g. to keep VMs migratable between nodes of different CPU generations.
+	// Cannot be updated.
+	// +optional
+	CPUFeatures *CPUFeatures `json:"cpuFeatures,omitempty"`
+
+	// Firmware selects the firmware that boots the VM. If not set, SeaBIOS is used on amd64, and
+	// UEFI on arm64.
+	// Cannot be updated.
+	// +optional
+	Firmware *Firmware `json:"firmware,omitempty"`
+
+	// Extra arguments to append to the QEMU command line, e.g. '-d guest_errors'.
+	//
+	// Each flag must be allowed by the controller's '--qemu-extra-args-allowlist'; VMs with flags
+	// that are not on the allowlist are rejected.
+	// Cannot be updated.
+	// +optional
+	ExtraArgs []string `json:"extraArgs,omitempty"`
 }
 
+// virtioMemBlockSizeBytes is the virtio-mem block size for VMs that don't set
+// .spec.guest.virtioMemBlockSize.
 const virtioMemBlockSizeBytes = 8 * 1024 * 1024 // 8 MiB
 
+// minVirtioMemBlockSizeBytes is the smallest block size that QEMU supports, which is the size
+// of a transparent huge page.
+const minVirtioMemBlockSizeBytes = 2 * 1024 * 1024 // 2 MiB
+
 // ValidateMemorySize returns an error iff the memory settings are invalid for use with virtio-mem
 // (the backing memory provider that we use)
 func (g Guest) ValidateMemorySize() error {
-	if g.MemorySlotSize.Value()%virtioMemBlockSizeBytes != 0 {
-		return fmt.Errorf("memorySlotSize invalid for use with virtio-mem: must be a multiple of 8Mi")
+	if g.VirtioMemBlockSize == nil {
+		if g.MemorySlotSize.Value()%virtioMemBlockSizeBytes != 0 {
+			return fmt.Errorf("memorySlotSize invalid for use with virtio-mem: must be a multiple of 8Mi")
+		}
+		return nil
+	}
+
+	if err := ValidateVirtioMemBlockSize(*g.VirtioMemBlockSize); err != nil {
+		return fmt.Errorf("virtioMemBlockSize: %w", err)
+	}
+	if g.MemorySlotSize.Value()%g.VirtioMemBlockSize.Value() != 0 {
+		return fmt.Errorf("memorySlotSize invalid for use with virtio-mem: must be a multiple of virtioMemBlockSize (%v)", g.VirtioMemBlockSize)
+	}
+	return nil
+}
+
+// ValidateVirtioMemBlockSize returns an error iff the size cannot be used as a virtio-mem block
+// size.
+func ValidateVirtioMemBlockSize(size resource.Quantity) error {
+	bytes := size.Value()
+	if bytes < minVirtioMemBlockSizeBytes || bytes&(bytes-1) != 0 {
+		return fmt.Errorf("%v must be a power of two, and at least 2Mi", &size)
+	}
+	return nil
+}
+
+// VirtioMemBlockSizeBytes returns the block size of the VM's virtio-mem device, in bytes.
+func (g Guest) VirtioMemBlockSizeBytes() int64 {
+	if g.VirtioMemBlockSize == nil {
+		return virtioMemBlockSizeBytes
+	}
+	return g.VirtioMemBlockSize.Value()
+}
+
+// maxMemhpAutoMovableRatio is the largest value we allow for .spec.guest.memhpAutoMovableRatio.
+//
+// The kernel docs mention that ratios up to 63:1 have been observed to work (with huge pages
+// disabled), so anything above that is almost certainly a mistake.
+const maxMemhpAutoMovableRatio = 6300
+
+// ValidateMemhpAutoMovableRatio returns an error iff the per-VM override for the kernel's
+// memory_hotplug.auto_movable_ratio is set and is not an integer percentage within the allowed
+// bounds.
+func (g Guest) ValidateMemhpAutoMovableRatio() error {
+	if g.MemhpAutoMovableRatio == nil {
+		return nil
+	}
+	return validateMemhpAutoMovableRatio(*g.MemhpAutoMovableRatio)
+}
+
+func validateMemhpAutoMovableRatio(value string) error {
+	ratio, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return fmt.Errorf("memhpAutoMovableRatio (%q) must be a non-negative integer", value)
+	}
+	if ratio > maxMemhpAutoMovableRatio {
+		return fmt.Errorf("memhpAutoMovableRatio (%d) should be less than or equal to %d", ratio, maxMemhpAutoMovableRatio)
 	}
 	return nil
 }
 
+// CPUFeatures gives the guest's CPU model, with features to expose to or hide from the guest on
+// top of it.
+//
+// Feature names are the ones used by QEMU, e.g. 'avx512f', or 'hle' and 'rtm' for TSX.
+type CPUFeatures struct {
+	// BaseModel is the QEMU CPU model the guest's CPU is based on, e.g. 'Skylake-Server-v4',
+	// instead of passing through all of the host's features. The VM fails to start on hosts that
+	// don't support all of the model's features.
+	BaseModel string `json:"baseModel"`
+	// Enable is the list of features that must be available in the guest, in addition to the
+	// base model's. Runner pods are only scheduled onto nodes labeled as supporting them (see the
+	// controller's '--cpu-feature-node-label-prefix'), and the VM fails to start on hosts that
+	// don't.
+	// +optional
+	Enable []string `json:"enable,omitempty"`
+	// Disable is the list of features that are hidden from the guest, even if the host supports
+	// them.
+	// +optional
+	Disable []string `json:"disable,omitempty"`
+}
+
+var (
+	cpuFeatureNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+	cpuModelNameRegexp   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+)
+
+type Firmware struct {
+	// Type is the firmware to boot the VM with.
+	// +optional
+	Type FirmwareType `json:"type,omitempty"`
+	// SecureBoot enables UEFI secure boot. It is only supported with the 'ovmf' firmware on amd64,
+	// and requires the guest kernel to be signed with a key that the firmware trusts.
+	//
+	// The runner image does not include OVMF built for secure boot yet, so this is currently
+	// rejected by the webhook.
+	// +optional
+	SecureBoot bool `json:"secureBoot,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=seabios;qboot;ovmf
+type FirmwareType string
+
+const (
+	// FirmwareTypeSeaBIOS is QEMU's default BIOS on amd64.
+	FirmwareTypeSeaBIOS FirmwareType = "seabios"
+	// FirmwareTypeQboot is a minimal BIOS that only supports direct kernel boot, which is the
+	// fastest to start. Only supported on amd64.
+	FirmwareTypeQboot FirmwareType = "qboot"
+	// FirmwareTypeOVMF is UEFI firmware.
+	FirmwareTypeOVMF FirmwareType = "ovmf"
+)
+
+// kernelArgRegexp matches a single kernel command line argument. Quoted values are not supported,
+// so that each argument is exactly one word on the command line.
+var kernelArgRegexp = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*(=[^\s"]*)?$`)
+
+// maxKernelArgsLength is the maximum total length of .spec.guest.kernelArgs, joined with spaces.
+//
+// The kernel truncates its command line at COMMAND_LINE_SIZE (2048 bytes on x86), so this leaves
+// room for the arguments that neonvm-runner adds itself.
+const maxKernelArgsLength = 1024
+
+// ValidateKernelArgs returns an error iff .spec.guest.kernelArgs has malformed arguments, or is
+// too long in total.
+//
+// Whether the arguments are allowed is checked separately, by the controller.
+func (g Guest) ValidateKernelArgs() error {
+	length := 0
+	for i, arg := range g.KernelArgs {
+		if !kernelArgRegexp.MatchString(arg) {
+			return fmt.Errorf("kernelArgs: invalid argument %q", arg)
+		}
+		if i != 0 {
+			length += 1 // separating space
+		}
+		length += len(arg)
+	}
+	if length > maxKernelArgsLength {
+		return fmt.Errorf("kernelArgs: total length %d is greater than the maximum of %d", length, maxKernelArgsLength)
+	}
+	return nil
+}
+
+// ValidateCPUFeatures returns an error iff .spec.guest.cpuFeatures has an invalid base model, or
+// invalid or conflicting feature names.
+func (g Guest) ValidateCPUFeatures() error {
+	if g.CPUFeatures == nil {
+		return nil
+	}
+
+	if !cpuModelNameRegexp.MatchString(g.CPUFeatures.BaseModel) {
+		return fmt.Errorf("cpuFeatures.baseModel: invalid CPU model name %q", g.CPUFeatures.BaseModel)
+	} else if g.CPUFeatures.BaseModel == "max" || g.CPUFeatures.BaseModel == "host" {
+		return fmt.Errorf("cpuFeatures.baseModel: must be a named CPU model, not %q", g.CPUFeatures.BaseModel)
+	}
+
+	seen := make(map[string]string)
+	check := func(list string, features []string) error {
+		for _, f := range features {
+			if !cpuFeatureNameRegexp.MatchString(f) {
+				return fmt.Errorf("cpuFeatures.%s: invalid feature name %q", list, f)
+			}
+			// hardware virtualization is checked separately, with nestedVirtualization
+			if f == "vmx" || f == "svm" {
+				return fmt.Errorf("cpuFeatures.%s: feature %q must be set with nestedVirtualization instead", list, f)
+			}
+			if other, ok := seen[f]; ok {
+				return fmt.Errorf("cpuFeatures.%s: feature %q is already in cpuFeatures.%s", list, f, other)
+			}
+			seen[f] = list
+		}
+		return nil
+	}
+
+	if err := check("enable", g.CPUFeatures.Enable); err != nil {
+		return err
+	}
+	return check("disable", g.CPUFeatures.Disable)
+}
+
 // Flag is a bitmask of flags. The meaning is up to the user.
 //
 // Used in Revision below.
@@ -391,8 +824,70 @@ type GuestSettings struct {
 	//
 	// +optional
 	Swap *resource.Quantity `json:"swap,omitempty"`
+
+	// Swappiness sets vm.swappiness inside the guest. Only has an effect when Swap is set.
+	//
+	// If not set, the guest kernel default is used.
+	//
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=200
+	Swappiness *int32 `json:"swappiness,omitempty"`
+
+	// Zswap enables the guest kernel's compressed swap cache, via the 'zswap.enabled' kernel
+	// argument. Only has an effect when Swap is set.
+	//
+	// +optional
+	Zswap *bool `json:"zswap,omitempty"`
+
+	// Clock sets how the guest keeps its clock in sync with the host.
+	//
+	// +optional
+	Clock *ClockSettings `json:"clock,omitempty"`
+}
+
+// GetClockSync returns the guest's clock sync method, defaulting to ClockSyncPTP.
+func (s *GuestSettings) GetClockSync() ClockSync {
+	if s == nil || s.Clock == nil || s.Clock.Sync == "" {
+		return ClockSyncPTP
+	}
+	return s.Clock.Sync
+}
+
+// ResyncClockAfterMigration returns whether the guest's clock should be set from the host's once
+// a live migration completes, defaulting to true.
+func (s *GuestSettings) ResyncClockAfterMigration() bool {
+	if s == nil || s.Clock == nil || s.Clock.ResyncAfterMigration == nil {
+		return true
+	}
+	return *s.Clock.ResyncAfterMigration
+}
+
+type ClockSettings struct {
+	// Sync is the method the guest uses to keep its clock in sync with the host.
+	//
+	// With "ptp" (the default), chrony disciplines the guest clock using the host's clock via
+	// the ptp_kvm device. With "kvm-clock", the guest relies on the kvm-clock clocksource alone,
+	// without chrony. "kvm-clock" is only supported on amd64.
+	//
+	// +optional
+	Sync ClockSync `json:"sync,omitempty"`
+
+	// ResyncAfterMigration sets whether the guest's clock is set from the host's via the guest
+	// agent once a live migration completes. Defaults to true.
+	//
+	// +optional
+	ResyncAfterMigration *bool `json:"resyncAfterMigration,omitempty"`
 }
 
+// +kubebuilder:validation:Enum=ptp;kvm-clock
+type ClockSync string
+
+const (
+	ClockSyncPTP      ClockSync = "ptp"
+	ClockSyncKVMClock ClockSync = "kvm-clock"
+)
+
 type CPUs struct {
 	Min MilliCPU `json:"min"`
 	Max MilliCPU `json:"max"`
@@ -485,7 +980,18 @@ type MemorySlots struct {
 }
 
 type RootDisk struct {
+	// Image is the container image with the VM's root disk. Changes take effect the next time the
+	// VM restarts.
 	Image string `json:"image"`
+	// FallbackImage, if set, is a previous known-good image. If the guest doesn't become ready
+	// within the controller's deadline after .image changes, the VM is rolled back to this image,
+	// and its RolledBack condition is set until .image changes again.
+	//
+	// The guest is ready once vm-monitor accepts connections. Until then, VMs with a new image stay
+	// in the Pending phase.
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	FallbackImage *string `json:"fallbackImage,omitempty"`
 	// +optional
 	Size resource.Quantity `json:"size,omitempty"`
 	// +optional
@@ -566,18 +1072,82 @@ type DiskSource struct {
 
 type EmptyDiskSource struct {
 	Size resource.Quantity `json:"size"`
-	// Discard enables the "discard" mount option for the filesystem
+	// Discard enables the "discard" mount option for the filesystem, and passes discards through
+	// to the disk on the node, so that space freed in the filesystem is released there too.
 	Discard bool `json:"discard,omitempty"`
+	// DetectZeroes sets whether QEMU detects writes of zeroes to the disk, to store them more
+	// efficiently. With 'unmap', zeroed blocks are discarded, which requires Discard or
+	// TrimInterval to be set.
+	// +optional
+	DetectZeroes *DetectZeroesMode `json:"detectZeroes,omitempty"`
+	// TrimInterval, if set, periodically runs fstrim on the filesystem in the guest. Like Discard,
+	// this releases freed space on the node, but in batches, without the overhead of the "discard"
+	// mount option on every delete.
+	//
+	// fstrim is run via the guest agent, which trims all of the guest's filesystems at once, so if
+	// several disks set this, the shortest interval applies to all of them.
+	// +optional
+	TrimInterval *metav1.Duration `json:"trimInterval,omitempty"`
 	// EnableQuotas enables the "prjquota" mount option for the ext4 filesystem.
 	// More info here:
 	// https://docs.redhat.com/en/documentation/red_hat_enterprise_linux/9/html/managing_file_systems/limiting-storage-space-usage-on-ext4-with-quotas_managing-file-systems
 	EnableQuotas bool `json:"enableQuotas,omitempty"`
+	// Encryption, if set, encrypts the disk on the node with a key from a Secret.
+	// +optional
+	Encryption *DiskEncryption `json:"encryption,omitempty"`
+}
+
+// DiscardPassthrough returns whether discards in the guest are passed through to the disk on the
+// node.
+func (d *EmptyDiskSource) DiscardPassthrough() bool {
+	return d.Discard || d.TrimInterval != nil
+}
+
+// +kubebuilder:validation:Enum=off;on;unmap
+type DetectZeroesMode string
+
+const (
+	// DetectZeroesOff writes zeroes to the disk as-is. This is QEMU's default.
+	DetectZeroesOff DetectZeroesMode = "off"
+	// DetectZeroesOn stores zeroed blocks without allocating space for them, where possible.
+	DetectZeroesOn DetectZeroesMode = "on"
+	// DetectZeroesUnmap discards zeroed blocks, releasing their space on the node.
+	DetectZeroesUnmap DetectZeroesMode = "unmap"
+)
+
+// DiskEncryption configures encrypting a disk at rest, with QEMU's LUKS encryption for qcow2. The
+// guest only ever sees the decrypted disk.
+type DiskEncryption struct {
+	// SecretKeyRef selects the key in a Secret in the VM's namespace to encrypt the disk with. It
+	// must not be optional.
+	//
+	// The key can be rotated by updating the Secret: the runner then re-encrypts the disk with the
+	// new key, while the VM keeps running, by mirroring it into a new image and switching to that
+	// once it's in sync. The new image has a new volume key, so nothing on the node can be
+	// decrypted with the old key afterwards. While this runs, the node needs enough free space for
+	// a second copy of the disk's data.
+	SecretKeyRef corev1.SecretKeySelector `json:"secretKeyRef"`
+}
+
+// EncryptionKeyVolumeName returns the name of the runner pod's volume with the encryption key for
+// the disk.
+func EncryptionKeyVolumeName(diskName string) string {
+	return diskName + "-key"
 }
 
 type TmpfsDiskSource struct {
 	Size resource.Quantity `json:"size"`
 }
 
+type EphemeralStorage struct {
+	// Request is the amount of the node's disk reserved for the runner pod.
+	// +optional
+	Request *resource.Quantity `json:"request,omitempty"`
+	// Limit is the amount of the node's disk that the runner pod may use before it's evicted.
+	// +optional
+	Limit *resource.Quantity `json:"limit,omitempty"`
+}
+
 type ExtraNetwork struct {
 	// Enable extra network interface
 	// +kubebuilder:default:=false
@@ -590,6 +1160,110 @@ type ExtraNetwork struct {
 	// Multus Network name specified in network-attachments-definition.
 	// +optional
 	MultusNetwork string `json:"multusNetwork,omitempty"`
+	// StaticIP requests a specific IP address for the interface, which must be within one of the
+	// IPAM ranges but may be outside of its range_start/range_end. If not set, an IP is allocated
+	// from the range. Either way, the IP is kept for the lifetime of the VM.
+	// +optional
+	StaticIP string `json:"staticIP,omitempty"`
+}
+
+type SRIOVNetwork struct {
+	// ResourceName is the extended resource advertised by the SR-IOV device plugin for the pool
+	// of virtual functions, e.g. "intel.com/sriov_netdevice". The VFs must be bound to vfio-pci.
+	ResourceName string `json:"resourceName"`
+	// Multus Network name specified in network-attachments-definition, for the SR-IOV CNI to
+	// configure the VF (e.g. its VLAN or MAC address).
+	// +optional
+	MultusNetwork string `json:"multusNetwork,omitempty"`
+}
+
+type NetworkSettings struct {
+	// Limits on the bandwidth of the VM's default network. These may be changed while the VM is
+	// running.
+	NetworkLimits `json:",inline"`
+
+	// DNS overrides the DNS configuration given to the guest via DHCP. If not set, the guest
+	// inherits the DNS configuration of the runner pod, as determined by its DNS policy.
+	// +optional
+	DNS *GuestDNSConfig `json:"dns,omitempty"`
+
+	// MTU sets the MTU of the VM's default network interface. If not set, the MTU of the runner
+	// pod's network interface is used.
+	// +kubebuilder:validation:Minimum:=1280
+	// +kubebuilder:validation:Maximum:=65520
+	// +optional
+	MTU *int32 `json:"mtu,omitempty"`
+}
+
+type GuestDNSConfig struct {
+	// Nameservers is the list of DNS server IP addresses for the guest. If empty, the runner
+	// pod's nameservers are used.
+	// +optional
+	Nameservers []string `json:"nameservers,omitempty"`
+
+	// Searches is the list of DNS search domains for the guest. If empty, the runner pod's search
+	// domains are used.
+	// +optional
+	Searches []string `json:"searches,omitempty"`
+}
+
+// GetLimits returns the network limits from the settings, or no limits if they are nil.
+func (s *NetworkSettings) GetLimits() NetworkLimits {
+	if s == nil {
+		return NetworkLimits{EgressLimit: nil, IngressLimit: nil}
+	}
+	return s.NetworkLimits
+}
+
+// GetDNS returns the guest DNS configuration from the settings, or nil if it should be inherited
+// from the runner pod.
+func (s *NetworkSettings) GetDNS() *GuestDNSConfig {
+	if s == nil {
+		return nil
+	}
+	return s.DNS
+}
+
+// GetMTU returns the MTU from the settings, or nil if it should be inherited from the runner pod.
+func (s *NetworkSettings) GetMTU() *int32 {
+	if s == nil {
+		return nil
+	}
+	return s.MTU
+}
+
+type NetworkLimits struct {
+	// EgressLimit is the maximum rate of traffic sent by the VM, in bits per second.
+	// +optional
+	EgressLimit *resource.Quantity `json:"egressLimit,omitempty"`
+
+	// IngressLimit is the maximum rate of traffic received by the VM, in bits per second.
+	// +optional
+	IngressLimit *resource.Quantity `json:"ingressLimit,omitempty"`
+}
+
+// MemoryBump is a temporary increase to a VM's minimum memory, set by the controller after the VM
+// was OOM-killed, so that it isn't immediately scaled back down to where it ran out of memory.
+type MemoryBump struct {
+	// MinSlots is the temporary minimum number of memory slots, in place of
+	// .spec.guest.memorySlots.min. It is never more than .spec.guest.memorySlots.max.
+	MinSlots int32 `json:"minSlots"`
+
+	// ExpiresAt is the time after which the controller removes the bump.
+	ExpiresAt metav1.Time `json:"expiresAt"`
+}
+
+// RootDiskStatus tracks the root disk image of a VM's runner pod, so that the controller can roll
+// back to .spec.guest.rootDisk.fallbackImage if a new image doesn't boot.
+type RootDiskStatus struct {
+	// Image is the root disk image that the VM's current runner pod was started with.
+	Image string `json:"image"`
+	// Ready is whether the guest has become ready with the image.
+	Ready bool `json:"ready"`
+	// RolledBackFrom, if not empty, is the .spec.guest.rootDisk.image that didn't become ready in
+	// time, so the VM was rolled back to .spec.guest.rootDisk.fallbackImage instead.
+	// +optional
+	RolledBackFrom string `json:"rolledBackFrom,omitempty"`
 }
 
 // VirtualMachineStatus defines the observed state of VirtualMachine
@@ -615,6 +1289,10 @@ type VirtualMachineStatus struct {
 	PodName string `json:"podName,omitempty"`
 	// +optional
 	PodIP string `json:"podIP,omitempty"`
+	// PodIPs are all of the runner pod's IP addresses, e.g. both the IPv4 and IPv6 addresses in
+	// dual-stack clusters. The first entry is always equal to PodIP.
+	// +optional
+	PodIPs []string `json:"podIPs,omitempty"`
 	// +optional
 	ExtraNetIP string `json:"extraNetIP,omitempty"`
 	// +optional
@@ -625,6 +1303,20 @@ type VirtualMachineStatus struct {
 	CPUs *MilliCPU `json:"cpus,omitempty"`
 	// +optional
 	MemorySize *resource.Quantity `json:"memorySize,omitempty"`
+	// MemoryBump, if not nil, raises the VM's minimum memory for a while after it was OOM-killed.
+	// The autoscaler-agent treats it as the lower bound for memory until it is removed.
+	// +optional
+	MemoryBump *MemoryBump `json:"memoryBump,omitempty"`
+	// RootDisk is the state of the VM's root disk image, for rolling back to the fallback image.
+	// +optional
+	RootDisk *RootDiskStatus `json:"rootDisk,omitempty"`
+	// NetworkLimits are the network limits last applied by the runner.
+	// +optional
+	NetworkLimits *NetworkLimits `json:"networkLimits,omitempty"`
+	// ShutdownStage is how far the runner has escalated the guest's shutdown, while the VM is
+	// being deleted.
+	// +optional
+	ShutdownStage ShutdownStage `json:"shutdownStage,omitempty"`
 	// +optional
 	SSHSecretName string `json:"sshSecretName,omitempty"`
 	// +optional
@@ -659,6 +1351,26 @@ const (
 	VmScaling VmPhase = "Scaling"
 )
 
+// ShutdownStage is a stage of the runner's shutdown sequence for the guest. Each stage escalates
+// from the previous one if the guest has not stopped in time.
+type ShutdownStage string
+
+const (
+	// ShutdownStagePowerdown means that the guest was asked to power off, via the guest agent or
+	// ACPI. The runner waits for up to the VM's terminationGracePeriodSeconds at this stage.
+	ShutdownStagePowerdown ShutdownStage = "Powerdown"
+	// ShutdownStageQuit means that the guest did not power off in time, so QEMU was asked to quit
+	// via QMP.
+	ShutdownStageQuit ShutdownStage = "Quit"
+	// ShutdownStageKill means that QEMU did not quit in time, and was killed.
+	ShutdownStageKill ShutdownStage = "Kill"
+)
+
+// ShutdownEscalationSeconds is the time that runner pods are given on top of the VM's
+// terminationGracePeriodSeconds, so that the runner can escalate the shutdown itself before the
+// kubelet kills the whole pod.
+const ShutdownEscalationSeconds int64 = 10
+
 // IsAlive returns whether the guest in the VM is expected to be running
 func (p VmPhase) IsAlive() bool {
 	switch p {
@@ -697,6 +1409,7 @@ type VirtualMachine struct {
 func (vm *VirtualMachine) Cleanup() {
 	vm.Status.PodName = ""
 	vm.Status.PodIP = ""
+	vm.Status.PodIPs = nil
 	vm.Status.Node = ""
 	vm.Status.CPUs = nil
 	vm.Status.MemorySize = nil
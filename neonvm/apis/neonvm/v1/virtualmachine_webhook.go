@@ -19,13 +19,18 @@ package v1
 import (
 	"errors"
 	"fmt"
+	"net"
 	"reflect"
 	"slices"
+	"strings"
+	"time"
 
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 //+kubebuilder:webhook:path=/mutate-vm-neon-tech-v1-virtualmachine,mutating=true,failurePolicy=fail,sideEffects=None,groups=vm.neon.tech,resources=virtualmachines,verbs=create;update,versions=v1,name=mvirtualmachine.kb.io,admissionReviewVersions=v1
@@ -36,43 +41,126 @@ var _ webhook.Defaulter = &VirtualMachine{}
 //
 // The controller wraps this logic so it can inject extra control in the webhook.
 func (r *VirtualMachine) Default() {
-	// Nothing to do.
+	// These defaults are applied here instead of in the CRD so that the VM's class, which is
+	// applied before this by the controller's webhook wrapper, can override them.
+	if r.Spec.Guest.MemorySlotSize.IsZero() {
+		r.Spec.Guest.MemorySlotSize = resource.MustParse("1Gi")
+	}
+	if r.Spec.CPUClass == nil {
+		class := CPUClassShared
+		r.Spec.CPUClass = &class
+	}
 }
 
 //+kubebuilder:webhook:path=/validate-vm-neon-tech-v1-virtualmachine,mutating=false,failurePolicy=fail,sideEffects=None,groups=vm.neon.tech,resources=virtualmachines,verbs=create;update,versions=v1,name=vvirtualmachine.kb.io,admissionReviewVersions=v1
 
 var _ webhook.Validator = &VirtualMachine{}
 
+// minTrimInterval is the lowest allowed .spec.disks[].emptyDisk.trimInterval, so that fstrim doesn't
+// run back-to-back on large filesystems.
+const minTrimInterval = time.Minute
+
 // ValidateCreate implements webhook.Validator
 //
 // The controller wraps this logic so it can inject extra control.
 func (r *VirtualMachine) ValidateCreate() (admission.Warnings, error) {
-	// validate .spec.guest.cpus.use and .spec.guest.cpus.max
-	if r.Spec.Guest.CPUs.Use < r.Spec.Guest.CPUs.Min {
-		return nil, fmt.Errorf(".spec.guest.cpus.use (%v) should be greater than or equal to the .spec.guest.cpus.min (%v)",
-			r.Spec.Guest.CPUs.Use,
-			r.Spec.Guest.CPUs.Min)
+	// NB: bounds for .spec.guest.cpus and .spec.guest.memorySlots are validated by the
+	// controller's webhook wrapper, which shares that validation with the autoscaling components.
+
+	if err := r.Spec.Guest.ValidateMemorySize(); err != nil {
+		return nil, fmt.Errorf(".spec.guest: %w", err)
 	}
-	if r.Spec.Guest.CPUs.Use > r.Spec.Guest.CPUs.Max {
-		return nil, fmt.Errorf(".spec.guest.cpus.use (%v) should be less than or equal to the .spec.guest.cpus.max (%v)",
-			r.Spec.Guest.CPUs.Use,
-			r.Spec.Guest.CPUs.Max)
+
+	if err := r.Spec.Guest.ValidateMemhpAutoMovableRatio(); err != nil {
+		return nil, fmt.Errorf(".spec.guest: %w", err)
 	}
 
-	if err := r.Spec.Guest.ValidateMemorySize(); err != nil {
+	// validate .spec.guest.settings swap options
+	if settings := r.Spec.Guest.Settings; settings != nil {
+		if settings.Swappiness != nil {
+			if *settings.Swappiness < 0 || *settings.Swappiness > 200 {
+				return nil, fmt.Errorf(".spec.guest.settings.swappiness (%d) should be between 0 and 200", *settings.Swappiness)
+			}
+			if settings.Swap == nil {
+				return nil, errors.New(".spec.guest.settings.swappiness requires .spec.guest.settings.swap to be set")
+			}
+		}
+		if settings.Zswap != nil && *settings.Zswap && settings.Swap == nil {
+			return nil, errors.New(".spec.guest.settings.zswap requires .spec.guest.settings.swap to be set")
+		}
+	}
+
+	if es := r.Spec.EphemeralStorage; es != nil && es.Request != nil && es.Limit != nil {
+		if es.Request.Cmp(*es.Limit) > 0 {
+			return nil, fmt.Errorf(".spec.ephemeralStorage.request (%s) must not be greater than .spec.ephemeralStorage.limit (%s)",
+				es.Request, es.Limit)
+		}
+	}
+
+	// kvm-clock is specific to x86
+	if r.Spec.Guest.Settings.GetClockSync() == ClockSyncKVMClock &&
+		r.Spec.TargetArchitecture != nil && *r.Spec.TargetArchitecture == CPUArchitectureARM64 {
+		return nil, errors.New(".spec.guest.settings.clock.sync \"kvm-clock\" is not supported on arm64")
+	}
+
+	if err := r.Spec.validateCPUClass(); err != nil {
+		return nil, err
+	}
+
+	if err := r.Spec.validateMachineType(); err != nil {
+		return nil, err
+	}
+
+	if err := r.Spec.validateFirmware(); err != nil {
+		return nil, err
+	}
+
+	if err := r.Spec.Guest.ValidateCPUFeatures(); err != nil {
 		return nil, fmt.Errorf(".spec.guest: %w", err)
 	}
 
-	// validate .spec.guest.memorySlots.use and .spec.guest.memorySlots.max
-	if r.Spec.Guest.MemorySlots.Use < r.Spec.Guest.MemorySlots.Min {
-		return nil, fmt.Errorf(".spec.guest.memorySlots.use (%d) should be greater than or equal to the .spec.guest.memorySlots.min (%d)",
-			r.Spec.Guest.MemorySlots.Use,
-			r.Spec.Guest.MemorySlots.Min)
+	if err := r.Spec.Guest.ValidateKernelArgs(); err != nil {
+		return nil, fmt.Errorf(".spec.guest: %w", err)
 	}
-	if r.Spec.Guest.MemorySlots.Use > r.Spec.Guest.MemorySlots.Max {
-		return nil, fmt.Errorf(".spec.guest.memorySlots.use (%d) should be less than or equal to the .spec.guest.memorySlots.max (%d)",
-			r.Spec.Guest.MemorySlots.Use,
-			r.Spec.Guest.MemorySlots.Max)
+
+	// nested virtualization needs KVM on the host, and is only supported on x86
+	if r.Spec.Guest.NestedVirtualization != nil && *r.Spec.Guest.NestedVirtualization {
+		if r.Spec.EnableAcceleration != nil && !*r.Spec.EnableAcceleration {
+			return nil, errors.New(".spec.guest.nestedVirtualization requires .spec.enableAcceleration")
+		}
+		if r.Spec.TargetArchitecture != nil && *r.Spec.TargetArchitecture == CPUArchitectureARM64 {
+			return nil, errors.New(".spec.guest.nestedVirtualization is not supported on arm64")
+		}
+	}
+
+	if err := r.Spec.Network.GetLimits().validate(); err != nil {
+		return nil, fmt.Errorf(".spec.network: %w", err)
+	}
+
+	// validate .spec.network.dns.nameservers
+	if dns := r.Spec.Network.GetDNS(); dns != nil {
+		for _, ns := range dns.Nameservers {
+			if net.ParseIP(ns) == nil {
+				return nil, fmt.Errorf(".spec.network.dns.nameservers: '%s' is not a valid IP address", ns)
+			}
+		}
+	}
+
+	// validate .spec.extraNetwork.staticIP
+	if extraNet := r.Spec.ExtraNetwork; extraNet != nil && extraNet.StaticIP != "" {
+		if ip := net.ParseIP(extraNet.StaticIP); ip == nil || ip.To4() == nil {
+			return nil, fmt.Errorf(".spec.extraNetwork.staticIP '%s' is not a valid IPv4 address", extraNet.StaticIP)
+		}
+		if !extraNet.Enable {
+			return nil, errors.New(".spec.extraNetwork.staticIP requires .spec.extraNetwork.enable")
+		}
+	}
+
+	// validate .spec.sriovNetwork
+	if sriov := r.Spec.SRIOVNetwork; sriov != nil {
+		if errs := validation.IsQualifiedName(sriov.ResourceName); len(errs) != 0 || !strings.Contains(sriov.ResourceName, "/") {
+			return nil, fmt.Errorf(".spec.sriovNetwork.resourceName '%s' is not a valid extended resource name", sriov.ResourceName)
+		}
 	}
 
 	// validate .spec.disk names
@@ -86,6 +174,7 @@ func (r *VirtualMachine) ValidateCreate() (admission.Warnings, error) {
 		"ssh-publickey",
 		"ssh-authorized-keys",
 		"tls",
+		"node-tuning",
 	}
 	for _, disk := range r.Spec.Disks {
 		if slices.Contains(reservedDiskNames, disk.Name) {
@@ -96,6 +185,40 @@ func (r *VirtualMachine) ValidateCreate() (admission.Warnings, error) {
 		}
 	}
 
+	// validate .spec.disks[].emptyDisk.encryption
+	for _, disk := range r.Spec.Disks {
+		if disk.EmptyDisk == nil || disk.EmptyDisk.Encryption == nil {
+			continue
+		}
+		ref := disk.EmptyDisk.Encryption.SecretKeyRef
+		if ref.Name == "" || ref.Key == "" {
+			return nil, fmt.Errorf("disk '%s': .emptyDisk.encryption.secretKeyRef must set both name and key", disk.Name)
+		}
+		// without the key, the runner can't create the disk
+		if ref.Optional != nil && *ref.Optional {
+			return nil, fmt.Errorf("disk '%s': .emptyDisk.encryption.secretKeyRef must not be optional", disk.Name)
+		}
+		// the key is mounted into the runner pod with its own volume
+		keyVolume := EncryptionKeyVolumeName(disk.Name)
+		if slices.ContainsFunc(r.Spec.Disks, func(d Disk) bool { return d.Name == keyVolume }) {
+			return nil, fmt.Errorf("disk name '%s' is reserved for the encryption key of disk '%s'", keyVolume, disk.Name)
+		}
+	}
+
+	// validate .spec.disks[].emptyDisk.detectZeroes and .trimInterval
+	for _, disk := range r.Spec.Disks {
+		if disk.EmptyDisk == nil {
+			continue
+		}
+		if disk.EmptyDisk.TrimInterval != nil && disk.EmptyDisk.TrimInterval.Duration < minTrimInterval {
+			return nil, fmt.Errorf("disk '%s': .emptyDisk.trimInterval must be at least %s", disk.Name, minTrimInterval)
+		}
+		mode := disk.EmptyDisk.DetectZeroes
+		if mode != nil && *mode == DetectZeroesUnmap && !disk.EmptyDisk.DiscardPassthrough() {
+			return nil, fmt.Errorf("disk '%s': .emptyDisk.detectZeroes 'unmap' requires .emptyDisk.discard or .emptyDisk.trimInterval", disk.Name)
+		}
+	}
+
 	// validate .spec.guest.ports[].name
 	for _, port := range r.Spec.Guest.Ports {
 		if len(port.Name) != 0 && port.Name == "qmp" {
@@ -122,18 +245,43 @@ func (r *VirtualMachine) ValidateUpdate(old runtime.Object) (admission.Warnings,
 		{".spec.guest.memorySlots.min", func(v *VirtualMachine) any { return v.Spec.Guest.MemorySlots.Min }},
 		{".spec.guest.memorySlots.max", func(v *VirtualMachine) any { return v.Spec.Guest.MemorySlots.Max }},
 		{".spec.guest.ports", func(v *VirtualMachine) any { return v.Spec.Guest.Ports }},
-		{".spec.guest.rootDisk", func(v *VirtualMachine) any { return v.Spec.Guest.RootDisk }},
+		// nb: .spec.guest.rootDisk.image and .fallbackImage are allowed to change, and take
+		// effect when the VM restarts.
+		{".spec.guest.rootDisk.size", func(v *VirtualMachine) any { return v.Spec.Guest.RootDisk.Size }},
+		{".spec.guest.rootDisk.imagePullPolicy", func(v *VirtualMachine) any { return v.Spec.Guest.RootDisk.ImagePullPolicy }},
+		{".spec.guest.rootDisk.execute", func(v *VirtualMachine) any { return v.Spec.Guest.RootDisk.Execute }},
 		{".spec.guest.command", func(v *VirtualMachine) any { return v.Spec.Guest.Command }},
 		{".spec.guest.args", func(v *VirtualMachine) any { return v.Spec.Guest.Args }},
 		{".spec.guest.env", func(v *VirtualMachine) any { return v.Spec.Guest.Env }},
 		{".spec.guest.settings", func(v *VirtualMachine) any { return v.Spec.Guest.Settings }},
+		{".spec.guest.nestedVirtualization", func(v *VirtualMachine) any { return v.Spec.Guest.NestedVirtualization }},
+		{".spec.guest.cpuFeatures", func(v *VirtualMachine) any { return v.Spec.Guest.CPUFeatures }},
+		{".spec.guest.firmware", func(v *VirtualMachine) any { return v.Spec.Guest.Firmware }},
+		{".spec.guest.extraArgs", func(v *VirtualMachine) any { return v.Spec.Guest.ExtraArgs }},
 		{".spec.disks", func(v *VirtualMachine) any { return v.Spec.Disks }},
 		{".spec.podResources", func(v *VirtualMachine) any { return v.Spec.PodResources }},
+		{".spec.runtimeClassName", func(v *VirtualMachine) any { return v.Spec.RuntimeClassName }},
+		{".spec.ephemeralStorage", func(v *VirtualMachine) any { return v.Spec.EphemeralStorage }},
 		{".spec.enableAcceleration", func(v *VirtualMachine) any { return v.Spec.EnableAcceleration }},
 		{".spec.enableSSH", func(v *VirtualMachine) any { return v.Spec.EnableSSH }},
 		// nb: we don't check overcommit here, so that it's allowed to be mutable.
 		{".spec.initScript", func(v *VirtualMachine) any { return v.Spec.InitScript }},
 		{".spec.enableNetworkMonitoring", func(v *VirtualMachine) any { return v.Spec.EnableNetworkMonitoring }},
+		{".spec.enableFreePageReporting", func(v *VirtualMachine) any { return v.Spec.EnableFreePageReporting }},
+		{".spec.guestMetrics", func(v *VirtualMachine) any { return v.Spec.GuestMetrics }},
+		{".spec.watchdog", func(v *VirtualMachine) any { return v.Spec.Watchdog }},
+		// nb: .spec.machineType is allowed to change, and takes effect when the VM restarts.
+		{".spec.className", func(v *VirtualMachine) any { return v.Spec.ClassName }},
+		// nb: the rest of .spec.network is allowed to change.
+		{".spec.network.dns", func(v *VirtualMachine) any { return v.Spec.Network.GetDNS() }},
+		{".spec.network.mtu", func(v *VirtualMachine) any { return v.Spec.Network.GetMTU() }},
+		{".spec.sriovNetwork", func(v *VirtualMachine) any { return v.Spec.SRIOVNetwork }},
+		{".spec.extraNetwork.staticIP", func(v *VirtualMachine) any {
+			if v.Spec.ExtraNetwork == nil {
+				return ""
+			}
+			return v.Spec.ExtraNetwork.StaticIP
+		}},
 	}
 
 	for _, info := range immutableFields {
@@ -148,6 +296,9 @@ func (r *VirtualMachine) ValidateUpdate(old runtime.Object) (admission.Warnings,
 	}{
 		{".spec.cpuScalingMode", func(v *VirtualMachine) any { return v.Spec.CpuScalingMode }},
 		{".spec.targetArchitecture", func(v *VirtualMachine) any { return v.Spec.TargetArchitecture }},
+		{".spec.cpuClass", func(v *VirtualMachine) any { return v.Spec.CPUClass }},
+		{".spec.entropy", func(v *VirtualMachine) any { return v.Spec.Entropy }},
+		{".spec.guest.virtioMemBlockSize", func(v *VirtualMachine) any { return v.Spec.Guest.VirtioMemBlockSize }},
 	}
 
 	for _, info := range fieldsAllowedToChangeFromNilOnly {
@@ -158,33 +309,140 @@ func (r *VirtualMachine) ValidateUpdate(old runtime.Object) (admission.Warnings,
 		}
 	}
 
-	// validate .spec.guest.cpu.use
-	if r.Spec.Guest.CPUs.Use < r.Spec.Guest.CPUs.Min {
-		return nil, fmt.Errorf(".cpus.use (%v) should be greater than or equal to the .cpus.min (%v)",
-			r.Spec.Guest.CPUs.Use,
-			r.Spec.Guest.CPUs.Min)
+	if err := r.validatePoolClaim(before); err != nil {
+		return nil, err
+	}
+
+	// NB: bounds for .spec.guest.cpus and .spec.guest.memorySlots are validated by the
+	// controller's webhook wrapper, which shares that validation with the autoscaling components.
+
+	// validate .spec.guest.virtioMemBlockSize, which may have been set
+	if err := r.Spec.Guest.ValidateMemorySize(); err != nil {
+		return nil, fmt.Errorf(".spec.guest: %w", err)
+	}
+
+	// validate .spec.guest.memhpAutoMovableRatio
+	if err := r.Spec.Guest.ValidateMemhpAutoMovableRatio(); err != nil {
+		return nil, fmt.Errorf(".spec.guest: %w", err)
+	}
+
+	// validate .spec.guest.kernelArgs
+	if err := r.Spec.Guest.ValidateKernelArgs(); err != nil {
+		return nil, fmt.Errorf(".spec.guest: %w", err)
+	}
+
+	// validate .spec.cpuClass against .spec.overcommit, which may have changed
+	if err := r.Spec.validateCPUClass(); err != nil {
+		return nil, err
 	}
-	if r.Spec.Guest.CPUs.Use > r.Spec.Guest.CPUs.Max {
-		return nil, fmt.Errorf(".cpus.use (%v) should be less than or equal to the .cpus.max (%v)",
-			r.Spec.Guest.CPUs.Use,
-			r.Spec.Guest.CPUs.Max)
+
+	if err := r.Spec.validateMachineType(); err != nil {
+		return nil, err
 	}
 
-	// validate .spec.guest.memorySlots.use
-	if r.Spec.Guest.MemorySlots.Use < r.Spec.Guest.MemorySlots.Min {
-		return nil, fmt.Errorf(".memorySlots.use (%d) should be greater than or equal to the .memorySlots.min (%d)",
-			r.Spec.Guest.MemorySlots.Use,
-			r.Spec.Guest.MemorySlots.Min)
+	if err := r.Spec.validateFirmware(); err != nil {
+		return nil, err
 	}
-	if r.Spec.Guest.MemorySlots.Use > r.Spec.Guest.MemorySlots.Max {
-		return nil, fmt.Errorf(".memorySlots.use (%d) should be less than or equal to the .memorySlots.max (%d)",
-			r.Spec.Guest.MemorySlots.Use,
-			r.Spec.Guest.MemorySlots.Max)
+
+	// validate .spec.network, which is allowed to change
+	if err := r.Spec.Network.GetLimits().validate(); err != nil {
+		return nil, fmt.Errorf(".spec.network: %w", err)
 	}
 
 	return nil, nil
 }
 
+// validatePoolClaim checks that a VM is only claimed from its pool once it's running, because
+// whoever claims it expects a VM that's ready to use.
+//
+// The phase is checked from before the update, because the status can't be changed along with the
+// labels.
+func (r *VirtualMachine) validatePoolClaim(before *VirtualMachine) error {
+	_, inPool := before.Labels[VirtualMachinePoolLabel]
+	_, wasClaimed := before.Labels[VirtualMachinePoolClaimLabel]
+	_, claimed := r.Labels[VirtualMachinePoolClaimLabel]
+	if inPool && claimed && !wasClaimed && before.Status.Phase != VmRunning {
+		return fmt.Errorf("VM can only be claimed from its pool once it's %s, but its phase is %q", VmRunning, before.Status.Phase)
+	}
+	return nil
+}
+
+// validateCPUClass checks that CPU overcommit is not used with a dedicated CPU class, because
+// dedicated CPUs are, by definition, never shared with other VMs.
+func (spec *VirtualMachineSpec) validateCPUClass() error {
+	if spec.CPUClass == nil || *spec.CPUClass != CPUClassDedicated {
+		return nil
+	}
+	if spec.Overcommit != nil && spec.Overcommit.CPU != nil {
+		return errors.New(".spec.overcommit.cpu is not allowed with .spec.cpuClass of 'dedicated'")
+	}
+	return nil
+}
+
+// validateMachineType checks that a VM using the microvm machine type doesn't use anything that
+// needs hotplug or PCI, which microvm doesn't have.
+func (spec *VirtualMachineSpec) validateMachineType() error {
+	if spec.MachineType == nil || *spec.MachineType != MachineTypeMicroVM {
+		return nil
+	}
+	if spec.TargetArchitecture != nil && *spec.TargetArchitecture == CPUArchitectureARM64 {
+		return errors.New(".spec.machineType of 'microvm' is not supported on arm64")
+	}
+	if spec.Guest.MemorySlots.Min != spec.Guest.MemorySlots.Max {
+		return errors.New(".spec.machineType of 'microvm' requires .spec.guest.memorySlots.min to equal max, because memory can't be hotplugged")
+	}
+	// nb: the API server sets the default of QmpScaling, so nil should not happen here.
+	if spec.CpuScalingMode == nil || *spec.CpuScalingMode == CpuScalingModeQMP {
+		return errors.New(".spec.cpuScalingMode of 'QmpScaling' is not supported with .spec.machineType of 'microvm', because CPUs can't be hotplugged")
+	}
+	if spec.Watchdog != nil {
+		return errors.New(".spec.watchdog is not supported with .spec.machineType of 'microvm'")
+	}
+	if spec.SRIOVNetwork != nil {
+		return errors.New(".spec.sriovNetwork is not supported with .spec.machineType of 'microvm'")
+	}
+	return nil
+}
+
+// validateFirmware checks that the firmware is supported with the VM's architecture and machine
+// type.
+func (spec *VirtualMachineSpec) validateFirmware() error {
+	fw := spec.Guest.Firmware
+	if fw == nil {
+		return nil
+	}
+	if fw.SecureBoot && fw.Type != FirmwareTypeOVMF {
+		return errors.New(".spec.guest.firmware.secureBoot requires .spec.guest.firmware.type of 'ovmf'")
+	}
+	if spec.TargetArchitecture != nil && *spec.TargetArchitecture == CPUArchitectureARM64 {
+		if fw.Type != "" && fw.Type != FirmwareTypeOVMF {
+			return fmt.Errorf(".spec.guest.firmware.type of '%s' is not supported on arm64", fw.Type)
+		}
+		if fw.SecureBoot {
+			return errors.New(".spec.guest.firmware.secureBoot is not supported on arm64")
+		}
+	}
+	// UEFI needs flash devices, which microvm doesn't have
+	if spec.MachineType != nil && *spec.MachineType == MachineTypeMicroVM && fw.Type == FirmwareTypeOVMF {
+		return errors.New(".spec.guest.firmware.type of 'ovmf' is not supported with .spec.machineType of 'microvm'")
+	}
+	// The runner image doesn't ship OVMF built for secure boot, so the VM would fail to start
+	if fw.SecureBoot {
+		return errors.New(".spec.guest.firmware.secureBoot is not supported by the runner image yet")
+	}
+	return nil
+}
+
+func (l NetworkLimits) validate() error {
+	if l.EgressLimit != nil && l.EgressLimit.Sign() <= 0 {
+		return fmt.Errorf("egressLimit (%v) should be greater than zero", l.EgressLimit)
+	}
+	if l.IngressLimit != nil && l.IngressLimit.Sign() <= 0 {
+		return fmt.Errorf("ingressLimit (%v) should be greater than zero", l.IngressLimit)
+	}
+	return nil
+}
+
 // ValidateDelete implements webhook.Validator
 //
 // The controller wraps this logic so it can inject extra control in the webhook.
@@ -1,10 +1,16 @@
 package v1
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/samber/lo"
 	"github.com/tychoish/fun/assert"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestFieldsAllowedToChangeFromNilOnly(t *testing.T) {
@@ -72,3 +78,424 @@ func TestFieldsAllowedToChangeFromNilOnly(t *testing.T) {
 		}
 	})
 }
+
+func TestValidateMemhpAutoMovableRatio(t *testing.T) {
+	cases := []struct {
+		value *string
+		valid bool
+	}{
+		{value: nil, valid: true},
+		{value: lo.ToPtr("0"), valid: true},
+		{value: lo.ToPtr("301"), valid: true},
+		{value: lo.ToPtr("6300"), valid: true},
+		{value: lo.ToPtr("6301"), valid: false},
+		{value: lo.ToPtr("-1"), valid: false},
+		{value: lo.ToPtr("1.5"), valid: false},
+		{value: lo.ToPtr(""), valid: false},
+	}
+
+	for _, c := range cases {
+		guest := Guest{MemhpAutoMovableRatio: c.value}
+		err := guest.ValidateMemhpAutoMovableRatio()
+		if c.valid {
+			assert.NotError(t, err)
+		} else {
+			assert.Error(t, err)
+		}
+	}
+}
+
+func TestValidateEphemeralStorage(t *testing.T) {
+	vm := func(request, limit string) *VirtualMachine {
+		vm := &VirtualMachine{}
+		vm.Spec.Guest.CPUs = CPUs{Min: 250, Max: 1000, Use: 250}
+		vm.Spec.Guest.MemorySlots = MemorySlots{Min: 1, Max: 4, Use: 1}
+		vm.Spec.Guest.MemorySlotSize = resource.MustParse("1Gi")
+		vm.Spec.EphemeralStorage = &EphemeralStorage{
+			Request: lo.ToPtr(resource.MustParse(request)),
+			Limit:   lo.ToPtr(resource.MustParse(limit)),
+		}
+		return vm
+	}
+
+	_, err := vm("1Gi", "2Gi").ValidateCreate()
+	assert.NotError(t, err)
+	_, err = vm("2Gi", "2Gi").ValidateCreate()
+	assert.NotError(t, err)
+	_, err = vm("3Gi", "2Gi").ValidateCreate()
+	assert.Error(t, err)
+
+	// Can't be changed after creation
+	updated := vm("1Gi", "4Gi")
+	_, err = updated.ValidateUpdate(vm("1Gi", "2Gi"))
+	assert.Error(t, err)
+}
+
+func TestValidateNestedVirtualization(t *testing.T) {
+	vm := func(acceleration bool, arch CPUArchitecture) *VirtualMachine {
+		vm := &VirtualMachine{}
+		vm.Spec.Guest.CPUs = CPUs{Min: 250, Max: 1000, Use: 250}
+		vm.Spec.Guest.MemorySlots = MemorySlots{Min: 1, Max: 4, Use: 1}
+		vm.Spec.Guest.MemorySlotSize = resource.MustParse("1Gi")
+		vm.Spec.Guest.NestedVirtualization = lo.ToPtr(true)
+		vm.Spec.EnableAcceleration = lo.ToPtr(acceleration)
+		vm.Spec.TargetArchitecture = lo.ToPtr(arch)
+		return vm
+	}
+
+	_, err := vm(true, CPUArchitectureAMD64).ValidateCreate()
+	assert.NotError(t, err)
+	_, err = vm(false, CPUArchitectureAMD64).ValidateCreate()
+	assert.Error(t, err)
+	_, err = vm(true, CPUArchitectureARM64).ValidateCreate()
+	assert.Error(t, err)
+
+	// Can't be changed after creation
+	updated := vm(true, CPUArchitectureAMD64)
+	updated.Spec.Guest.NestedVirtualization = lo.ToPtr(false)
+	_, err = updated.ValidateUpdate(vm(true, CPUArchitectureAMD64))
+	assert.Error(t, err)
+}
+
+func TestValidateCPUFeatures(t *testing.T) {
+	cases := []struct {
+		features *CPUFeatures
+		valid    bool
+	}{
+		{features: nil, valid: true},
+		{features: &CPUFeatures{BaseModel: "Skylake-Server", Enable: []string{"avx512f"}, Disable: []string{"hle", "rtm"}}, valid: true},
+		{features: &CPUFeatures{BaseModel: "Skylake-Server", Enable: []string{"sse4.2", "lahf-lm"}, Disable: nil}, valid: true},
+		{features: &CPUFeatures{BaseModel: "Skylake-Server", Enable: []string{"AVX512F"}, Disable: nil}, valid: false},
+		{features: &CPUFeatures{BaseModel: "Skylake-Server", Enable: []string{"avx,pmu=on"}, Disable: nil}, valid: false},
+		{features: &CPUFeatures{BaseModel: "Skylake-Server", Enable: []string{""}, Disable: nil}, valid: false},
+		{features: &CPUFeatures{BaseModel: "Skylake-Server", Enable: []string{"avx2"}, Disable: []string{"avx2"}}, valid: false},
+		{features: &CPUFeatures{BaseModel: "Skylake-Server", Enable: nil, Disable: []string{"hle", "hle"}}, valid: false},
+		{features: &CPUFeatures{BaseModel: "Skylake-Server", Enable: []string{"vmx"}, Disable: nil}, valid: false},
+		{features: &CPUFeatures{BaseModel: "EPYC-Milan-v2", Enable: nil, Disable: nil}, valid: true},
+		{features: &CPUFeatures{BaseModel: "", Enable: []string{"avx2"}, Disable: nil}, valid: false},
+		{features: &CPUFeatures{BaseModel: "max", Enable: nil, Disable: nil}, valid: false},
+		{features: &CPUFeatures{BaseModel: "host", Enable: nil, Disable: nil}, valid: false},
+		{features: &CPUFeatures{BaseModel: "Skylake-Server,+avx2", Enable: nil, Disable: nil}, valid: false},
+	}
+
+	for _, c := range cases {
+		guest := Guest{CPUFeatures: c.features}
+		err := guest.ValidateCPUFeatures()
+		if c.valid {
+			assert.NotError(t, err)
+		} else {
+			assert.Error(t, err)
+		}
+	}
+}
+
+func TestValidateMachineType(t *testing.T) {
+	vm := func(modify func(*VirtualMachine)) *VirtualMachine {
+		vm := &VirtualMachine{}
+		vm.Spec.Guest.CPUs = CPUs{Min: 250, Max: 1000, Use: 250}
+		vm.Spec.Guest.MemorySlots = MemorySlots{Min: 2, Max: 2, Use: 2}
+		vm.Spec.Guest.MemorySlotSize = resource.MustParse("1Gi")
+		vm.Spec.CpuScalingMode = lo.ToPtr(CpuScalingModeSysfs)
+		vm.Spec.MachineType = lo.ToPtr(MachineTypeMicroVM)
+		modify(vm)
+		return vm
+	}
+
+	cases := []struct {
+		name   string
+		modify func(*VirtualMachine)
+		valid  bool
+	}{
+		{"microvm", func(vm *VirtualMachine) {}, true},
+		{"standard with hotplug", func(vm *VirtualMachine) {
+			vm.Spec.MachineType = lo.ToPtr(MachineTypeStandard)
+			vm.Spec.Guest.MemorySlots = MemorySlots{Min: 1, Max: 4, Use: 1}
+			vm.Spec.CpuScalingMode = lo.ToPtr(CpuScalingModeQMP)
+		}, true},
+		{"memory hotplug", func(vm *VirtualMachine) {
+			vm.Spec.Guest.MemorySlots = MemorySlots{Min: 1, Max: 4, Use: 1}
+		}, false},
+		{"QMP CPU scaling", func(vm *VirtualMachine) {
+			vm.Spec.CpuScalingMode = lo.ToPtr(CpuScalingModeQMP)
+		}, false},
+		{"arm64", func(vm *VirtualMachine) {
+			vm.Spec.TargetArchitecture = lo.ToPtr(CPUArchitectureARM64)
+		}, false},
+		{"watchdog", func(vm *VirtualMachine) {
+			vm.Spec.Watchdog = &Watchdog{Action: WatchdogActionReset}
+		}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := vm(c.modify).ValidateCreate()
+			if c.valid {
+				assert.NotError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	// Can be changed after creation (taking effect on restart), but the new machine type must still
+	// be valid for the VM
+	standard := vm(func(vm *VirtualMachine) {
+		vm.Spec.MachineType = lo.ToPtr(MachineTypeStandard)
+	})
+	_, err := standard.ValidateUpdate(vm(func(vm *VirtualMachine) {}))
+	assert.NotError(t, err)
+	_, err = vm(func(vm *VirtualMachine) {}).ValidateUpdate(standard)
+	assert.NotError(t, err)
+
+	withWatchdog := func(vm *VirtualMachine) {
+		vm.Spec.Watchdog = &Watchdog{Action: WatchdogActionReset}
+	}
+	_, err = vm(withWatchdog).ValidateUpdate(vm(func(vm *VirtualMachine) {
+		withWatchdog(vm)
+		vm.Spec.MachineType = lo.ToPtr(MachineTypeStandard)
+	}))
+	assert.Error(t, err)
+}
+
+func TestValidateFirmware(t *testing.T) {
+	cases := []struct {
+		name        string
+		firmware    *Firmware
+		arch        CPUArchitecture
+		machineType MachineType
+		valid       bool
+	}{
+		{"default", nil, CPUArchitectureAMD64, MachineTypeStandard, true},
+		{"qboot", &Firmware{Type: FirmwareTypeQboot, SecureBoot: false}, CPUArchitectureAMD64, MachineTypeStandard, true},
+		{"secure boot", &Firmware{Type: FirmwareTypeOVMF, SecureBoot: true}, CPUArchitectureAMD64, MachineTypeStandard, false},
+		{"secure boot without ovmf", &Firmware{Type: FirmwareTypeSeaBIOS, SecureBoot: true}, CPUArchitectureAMD64, MachineTypeStandard, false},
+		{"arm64 uefi", &Firmware{Type: FirmwareTypeOVMF, SecureBoot: false}, CPUArchitectureARM64, MachineTypeStandard, true},
+		{"arm64 bios", &Firmware{Type: FirmwareTypeSeaBIOS, SecureBoot: false}, CPUArchitectureARM64, MachineTypeStandard, false},
+		{"arm64 secure boot", &Firmware{Type: FirmwareTypeOVMF, SecureBoot: true}, CPUArchitectureARM64, MachineTypeStandard, false},
+		{"microvm qboot", &Firmware{Type: FirmwareTypeQboot, SecureBoot: false}, CPUArchitectureAMD64, MachineTypeMicroVM, true},
+		{"microvm uefi", &Firmware{Type: FirmwareTypeOVMF, SecureBoot: false}, CPUArchitectureAMD64, MachineTypeMicroVM, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			spec := VirtualMachineSpec{}
+			spec.Guest.Firmware = c.firmware
+			spec.TargetArchitecture = lo.ToPtr(c.arch)
+			spec.MachineType = lo.ToPtr(c.machineType)
+			err := spec.validateFirmware()
+			if c.valid {
+				assert.NotError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateMemorySize(t *testing.T) {
+	cases := []struct {
+		name      string
+		slotSize  string
+		blockSize *string
+		valid     bool
+	}{
+		{"legacy block size", "1Gi", nil, true},
+		{"legacy block size, slot too small", "4Mi", nil, false},
+		{"small block size", "4Mi", lo.ToPtr("2Mi"), true},
+		{"large block size", "1Gi", lo.ToPtr("128Mi"), true},
+		{"block size too small", "1Gi", lo.ToPtr("1Mi"), false},
+		{"block size not a power of two", "768Mi", lo.ToPtr("12Mi"), false},
+		{"slot not a multiple of block size", "40Mi", lo.ToPtr("16Mi"), false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			guest := Guest{}
+			guest.MemorySlotSize = resource.MustParse(c.slotSize)
+			if c.blockSize != nil {
+				guest.VirtioMemBlockSize = lo.ToPtr(resource.MustParse(*c.blockSize))
+			}
+			err := guest.ValidateMemorySize()
+			if c.valid {
+				assert.NotError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateKernelArgs(t *testing.T) {
+	cases := []struct {
+		name  string
+		args  []string
+		valid bool
+	}{
+		{"empty", nil, true},
+		{"name only", []string{"nokaslr"}, true},
+		{"name and value", []string{"transparent_hugepage=never", "mitigations=off"}, true},
+		{"dotted name", []string{"zswap.max_pool_percent=20"}, true},
+		{"empty value", []string{"quiet="}, true},
+		{"empty argument", []string{""}, false},
+		{"whitespace", []string{"foo=bar baz"}, false},
+		{"quoted", []string{`foo="bar baz"`}, false},
+		{"init separator", []string{"--"}, false},
+		{"maximum length", []string{strings.Repeat("a", 511), strings.Repeat("b", 512)}, true},
+		{"too long", []string{strings.Repeat("a", 512), strings.Repeat("b", 512)}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			guest := Guest{}
+			guest.KernelArgs = c.args
+			err := guest.ValidateKernelArgs()
+			if c.valid {
+				assert.NotError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateDiskEncryption(t *testing.T) {
+	vm := func(disks ...Disk) *VirtualMachine {
+		vm := &VirtualMachine{}
+		vm.Spec.Guest.CPUs = CPUs{Min: 250, Max: 1000, Use: 250}
+		vm.Spec.Guest.MemorySlots = MemorySlots{Min: 1, Max: 4, Use: 1}
+		vm.Spec.Guest.MemorySlotSize = resource.MustParse("1Gi")
+		vm.Spec.Disks = disks
+		return vm
+	}
+	encrypted := func(name string, ref corev1.SecretKeySelector) Disk {
+		return Disk{
+			Name:      name,
+			MountPath: "/" + name,
+			DiskSource: DiskSource{
+				EmptyDisk: &EmptyDiskSource{
+					Size:       resource.MustParse("1Gi"),
+					Encryption: &DiskEncryption{SecretKeyRef: ref},
+				},
+			},
+		}
+	}
+	ref := corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "keys"},
+		Key:                  "data",
+	}
+
+	_, err := vm(encrypted("data", ref)).ValidateCreate()
+	assert.NotError(t, err)
+
+	// Must reference a key in a secret
+	_, err = vm(encrypted("data", corev1.SecretKeySelector{LocalObjectReference: ref.LocalObjectReference})).ValidateCreate()
+	assert.Error(t, err)
+	_, err = vm(encrypted("data", corev1.SecretKeySelector{Key: "data"})).ValidateCreate()
+	assert.Error(t, err)
+
+	// ... that must exist
+	optional := ref
+	optional.Optional = lo.ToPtr(true)
+	_, err = vm(encrypted("data", optional)).ValidateCreate()
+	assert.Error(t, err)
+	optional.Optional = lo.ToPtr(false)
+	_, err = vm(encrypted("data", optional)).ValidateCreate()
+	assert.NotError(t, err)
+
+	// Other disks can't use the name of the key's volume
+	_, err = vm(encrypted("data", ref), encrypted("data-key", ref)).ValidateCreate()
+	assert.Error(t, err)
+}
+
+func TestValidateDiskDiscard(t *testing.T) {
+	vm := func(disk EmptyDiskSource) *VirtualMachine {
+		vm := &VirtualMachine{}
+		vm.Spec.Guest.CPUs = CPUs{Min: 250, Max: 1000, Use: 250}
+		vm.Spec.Guest.MemorySlots = MemorySlots{Min: 1, Max: 4, Use: 1}
+		vm.Spec.Guest.MemorySlotSize = resource.MustParse("1Gi")
+		disk.Size = resource.MustParse("1Gi")
+		vm.Spec.Disks = []Disk{{
+			Name:       "data",
+			MountPath:  "/data",
+			DiskSource: DiskSource{EmptyDisk: &disk},
+		}}
+		return vm
+	}
+	hourly := &metav1.Duration{Duration: time.Hour}
+
+	_, err := vm(EmptyDiskSource{TrimInterval: hourly}).ValidateCreate()
+	assert.NotError(t, err)
+	_, err = vm(EmptyDiskSource{TrimInterval: &metav1.Duration{Duration: time.Second}}).ValidateCreate()
+	assert.Error(t, err)
+
+	// Discarding zeroes requires passing discards through
+	_, err = vm(EmptyDiskSource{DetectZeroes: lo.ToPtr(DetectZeroesOn)}).ValidateCreate()
+	assert.NotError(t, err)
+	_, err = vm(EmptyDiskSource{DetectZeroes: lo.ToPtr(DetectZeroesUnmap)}).ValidateCreate()
+	assert.Error(t, err)
+	_, err = vm(EmptyDiskSource{DetectZeroes: lo.ToPtr(DetectZeroesUnmap), Discard: true}).ValidateCreate()
+	assert.NotError(t, err)
+	_, err = vm(EmptyDiskSource{DetectZeroes: lo.ToPtr(DetectZeroesUnmap), TrimInterval: hourly}).ValidateCreate()
+	assert.NotError(t, err)
+}
+
+func TestValidateClockSync(t *testing.T) {
+	vm := func(sync ClockSync, arch *CPUArchitecture) *VirtualMachine {
+		vm := &VirtualMachine{}
+		vm.Spec.Guest.CPUs = CPUs{Min: 250, Max: 1000, Use: 250}
+		vm.Spec.Guest.MemorySlots = MemorySlots{Min: 1, Max: 4, Use: 1}
+		vm.Spec.Guest.MemorySlotSize = resource.MustParse("1Gi")
+		vm.Spec.Guest.Settings = &GuestSettings{Clock: &ClockSettings{Sync: sync}}
+		vm.Spec.TargetArchitecture = arch
+		return vm
+	}
+
+	_, err := vm(ClockSyncKVMClock, lo.ToPtr(CPUArchitectureAMD64)).ValidateCreate()
+	assert.NotError(t, err)
+	// VMs without an architecture are amd64
+	_, err = vm(ClockSyncKVMClock, nil).ValidateCreate()
+	assert.NotError(t, err)
+	_, err = vm(ClockSyncPTP, lo.ToPtr(CPUArchitectureARM64)).ValidateCreate()
+	assert.NotError(t, err)
+	// The default is ptp, which is fine on arm64 too
+	_, err = vm("", lo.ToPtr(CPUArchitectureARM64)).ValidateCreate()
+	assert.NotError(t, err)
+
+	// kvm-clock is x86-only
+	_, err = vm(ClockSyncKVMClock, lo.ToPtr(CPUArchitectureARM64)).ValidateCreate()
+	assert.Error(t, err)
+	assert.Substring(t, err.Error(), `"kvm-clock" is not supported on arm64`)
+}
+
+func TestValidatePoolClaim(t *testing.T) {
+	vm := func(phase VmPhase, labels map[string]string) *VirtualMachine {
+		vm := &VirtualMachine{}
+		vm.Labels = labels
+		vm.Spec.Guest.CPUs = CPUs{Min: 250, Max: 1000, Use: 250}
+		vm.Spec.Guest.MemorySlots = MemorySlots{Min: 1, Max: 4, Use: 1}
+		vm.Spec.Guest.MemorySlotSize = resource.MustParse("1Gi")
+		vm.Status.Phase = phase
+		return vm
+	}
+	inPool := map[string]string{VirtualMachinePoolLabel: "pool"}
+	claimed := map[string]string{VirtualMachinePoolLabel: "pool", VirtualMachinePoolClaimLabel: "me"}
+
+	_, err := vm(VmRunning, claimed).ValidateUpdate(vm(VmRunning, inPool))
+	assert.NotError(t, err)
+
+	// VMs that aren't running yet can't be claimed
+	for _, phase := range []VmPhase{"", VmPending, VmPreMigrating, VmFailed} {
+		_, err = vm(phase, claimed).ValidateUpdate(vm(phase, inPool))
+		assert.Error(t, err)
+	}
+	_, err = vm("", claimed).ValidateUpdate(vm(VmPending, inPool))
+	assert.Substring(t, err.Error(), `once it's Running, but its phase is "Pending"`)
+
+	// Only new claims are checked, so other updates to claimed VMs are allowed
+	_, err = vm(VmFailed, claimed).ValidateUpdate(vm(VmFailed, claimed))
+	assert.NotError(t, err)
+
+	// The label means nothing on VMs that aren't in a pool
+	_, err = vm(VmPending, map[string]string{VirtualMachinePoolClaimLabel: "me"}).ValidateUpdate(vm(VmPending, nil))
+	assert.NotError(t, err)
+}
@@ -0,0 +1,92 @@
+package v1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VirtualMachineClassSpec defines the desired state of VirtualMachineClass
+//
+// All fields are optional. Fields that are set on the VM itself take precedence over its class.
+type VirtualMachineClassSpec struct {
+	// Bounds sets the size of a compute unit and the range of compute units for VMs of this class.
+	//
+	// Bounds are only applied when the VM is created, and only if it doesn't set any of
+	// .spec.guest.cpus, .spec.guest.memorySlots, or .spec.guest.memorySlotSize. Changing them
+	// only affects VMs created afterwards.
+	// +optional
+	Bounds *VirtualMachineClassBounds `json:"bounds,omitempty"`
+
+	// Memory sets options for the VM's memory provider, virtio-mem.
+	// +optional
+	Memory *VirtualMachineClassMemory `json:"memory,omitempty"`
+
+	// DiskCacheSettings sets the values of the 'cache.*' settings used for QEMU disks, overriding
+	// the controller's '-qemu-disk-cache-settings' flag, e.g. "cache=none".
+	//
+	// This is applied whenever a new runner pod is created for the VM, so changes take effect
+	// on the VM's next restart or migration.
+	// +kubebuilder:validation:Pattern=`^[a-z.-]+=[a-z0-9]+(,[a-z.-]+=[a-z0-9]+)*$`
+	// +optional
+	DiskCacheSettings *string `json:"diskCacheSettings,omitempty"`
+
+	// CPUClass is the default .spec.cpuClass for VMs of this class, which determines how they're
+	// scheduled and how their CPU is allocated on the node.
+	// +optional
+	CPUClass *CPUClass `json:"cpuClass,omitempty"`
+}
+
+type VirtualMachineClassBounds struct {
+	// CPUPerCU is the amount of CPU in one compute unit.
+	CPUPerCU MilliCPU `json:"cpuPerCU"`
+	// MemorySlotSize is the size of each memory slot.
+	MemorySlotSize resource.Quantity `json:"memorySlotSize"`
+	// MemorySlotsPerCU is the number of memory slots in one compute unit.
+	// +kubebuilder:validation:Minimum=1
+	MemorySlotsPerCU int32 `json:"memorySlotsPerCU"`
+	// MinCU is the minimum number of compute units for the VM, which it also starts with.
+	// +kubebuilder:validation:Minimum=1
+	MinCU int32 `json:"minCU"`
+	// MaxCU is the maximum number of compute units for the VM.
+	// +kubebuilder:validation:Minimum=1
+	MaxCU int32 `json:"maxCU"`
+}
+
+type VirtualMachineClassMemory struct {
+	// MemhpAutoMovableRatio sets the maximum MOVABLE:KERNEL memory ratio in %, overriding the
+	// controller's global default. VMs that set .spec.guest.memhpAutoMovableRatio take precedence.
+	//
+	// Like DiskCacheSettings, this is applied whenever a new runner pod is created for the VM.
+	// +kubebuilder:validation:Pattern=^[0-9]+$
+	// +optional
+	MemhpAutoMovableRatio *string `json:"memhpAutoMovableRatio,omitempty"`
+}
+
+//+genclient
+//+genclient:nonNamespaced
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster,singular=virtualmachineclass,shortName=vmclass
+
+// VirtualMachineClass is the Schema for the virtualmachineclasses API
+//
+// VMs reference a VirtualMachineClass with .spec.className, so that their sizing and runtime
+// settings can be managed centrally.
+type VirtualMachineClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec VirtualMachineClassSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VirtualMachineClassList contains a list of VirtualMachineClass
+type VirtualMachineClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VirtualMachineClass `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VirtualMachineClass{}, &VirtualMachineClassList{}) //nolint:exhaustruct // just being used to provide the types
+}
@@ -0,0 +1,122 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+//+kubebuilder:webhook:path=/validate-vm-neon-tech-v1-virtualmachineclass,mutating=false,failurePolicy=fail,sideEffects=None,groups=vm.neon.tech,resources=virtualmachineclasses,verbs=create;update,versions=v1,name=vvirtualmachineclass.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &VirtualMachineClass{}
+
+// ValidateCreate implements webhook.Validator
+//
+// The controller wraps this logic so it can inject extra control in the webhook.
+func (r *VirtualMachineClass) ValidateCreate() (admission.Warnings, error) {
+	return nil, r.Spec.validate()
+}
+
+// ValidateUpdate implements webhook.Validator
+//
+// The controller wraps this logic so it can inject extra control in the webhook.
+func (r *VirtualMachineClass) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	// Classes are meant to be changed centrally, so any valid update is allowed. Existing VMs keep
+	// the bounds they were created with.
+	return nil, r.Spec.validate()
+}
+
+// ValidateDelete implements webhook.Validator
+//
+// The controller wraps this logic so it can inject extra control in the webhook.
+func (r *VirtualMachineClass) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+// maxMemorySlots is the maximum for each of .spec.guest.memorySlots, matching the CRD validation.
+const maxMemorySlots = 512
+
+func (s *VirtualMachineClassSpec) validate() error {
+	if b := s.Bounds; b != nil {
+		if b.CPUPerCU <= 0 {
+			return errors.New(".spec.bounds.cpuPerCU must be positive")
+		}
+		if b.MemorySlotSize.Value() <= 0 {
+			return errors.New(".spec.bounds.memorySlotSize must be positive")
+		}
+		if b.MemorySlotSize.Value()%virtioMemBlockSizeBytes != 0 {
+			return errors.New(".spec.bounds.memorySlotSize invalid for use with virtio-mem: must be a multiple of 8Mi")
+		}
+		if b.MemorySlotsPerCU < 1 {
+			return errors.New(".spec.bounds.memorySlotsPerCU must be at least 1")
+		}
+		if b.MinCU < 1 {
+			return errors.New(".spec.bounds.minCU must be at least 1")
+		}
+		if b.MaxCU < b.MinCU {
+			return fmt.Errorf(".spec.bounds.maxCU (%d) must not be less than .spec.bounds.minCU (%d)", b.MaxCU, b.MinCU)
+		}
+		if int64(b.MaxCU)*int64(b.MemorySlotsPerCU) > maxMemorySlots {
+			return fmt.Errorf(".spec.bounds: maxCU * memorySlotsPerCU must not exceed %d memory slots", maxMemorySlots)
+		}
+	}
+
+	if s.Memory != nil && s.Memory.MemhpAutoMovableRatio != nil {
+		if err := validateMemhpAutoMovableRatio(*s.Memory.MemhpAutoMovableRatio); err != nil {
+			return fmt.Errorf(".spec.memory.%w", err)
+		}
+	}
+
+	if s.DiskCacheSettings != nil && *s.DiskCacheSettings == "" {
+		return errors.New(".spec.diskCacheSettings must not be empty")
+	}
+
+	return nil
+}
+
+// ApplyDefaults sets the fields of the VM's spec that it left to the class.
+//
+// The class's bounds are only applied if the VM doesn't set any of its own.
+func (s *VirtualMachineClassSpec) ApplyDefaults(spec *VirtualMachineSpec) {
+	guest := &spec.Guest
+	if b := s.Bounds; b != nil && guest.CPUs == (CPUs{}) && guest.MemorySlots == (MemorySlots{}) && guest.MemorySlotSize.IsZero() {
+		guest.CPUs = CPUs{
+			Min: b.CPUPerCU * MilliCPU(b.MinCU),
+			Max: b.CPUPerCU * MilliCPU(b.MaxCU),
+			Use: b.CPUPerCU * MilliCPU(b.MinCU),
+		}
+		guest.MemorySlotSize = b.MemorySlotSize.DeepCopy()
+		guest.MemorySlots = MemorySlots{
+			Min: b.MemorySlotsPerCU * b.MinCU,
+			Max: b.MemorySlotsPerCU * b.MaxCU,
+			Use: b.MemorySlotsPerCU * b.MinCU,
+		}
+	}
+
+	if s.CPUClass != nil && spec.CPUClass == nil {
+		class := *s.CPUClass
+		spec.CPUClass = &class
+	}
+}
+
+// GetDiskCacheSettings returns the QEMU disk cache settings for VMs of this class, or def if the
+// class doesn't set them. s may be nil.
+func (s *VirtualMachineClassSpec) GetDiskCacheSettings(def string) string {
+	if s != nil && s.DiskCacheSettings != nil {
+		return *s.DiskCacheSettings
+	}
+	return def
+}
+
+// GetMemhpAutoMovableRatio returns the memory_hotplug.auto_movable_ratio for VMs of this class,
+// or def if the class doesn't set it. s may be nil.
+func (s *VirtualMachineClassSpec) GetMemhpAutoMovableRatio(def string) string {
+	if s != nil && s.Memory != nil && s.Memory.MemhpAutoMovableRatio != nil {
+		return *s.Memory.MemhpAutoMovableRatio
+	}
+	return def
+}
@@ -0,0 +1,88 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/tychoish/fun/assert"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func testClassBounds() *VirtualMachineClassBounds {
+	return &VirtualMachineClassBounds{
+		CPUPerCU:         250,
+		MemorySlotSize:   resource.MustParse("1Gi"),
+		MemorySlotsPerCU: 1,
+		MinCU:            1,
+		MaxCU:            16,
+	}
+}
+
+func TestVirtualMachineClassValidate(t *testing.T) {
+	class := func(modify func(*VirtualMachineClassSpec)) *VirtualMachineClass {
+		c := &VirtualMachineClass{}
+		c.Spec.Bounds = testClassBounds()
+		modify(&c.Spec)
+		return c
+	}
+
+	_, err := class(func(*VirtualMachineClassSpec) {}).ValidateCreate()
+	assert.NotError(t, err)
+
+	_, err = class(func(s *VirtualMachineClassSpec) { s.Bounds = nil }).ValidateCreate()
+	assert.NotError(t, err)
+
+	_, err = class(func(s *VirtualMachineClassSpec) { s.Bounds.MaxCU = 0 }).ValidateCreate()
+	assert.Error(t, err)
+
+	_, err = class(func(s *VirtualMachineClassSpec) { s.Bounds.CPUPerCU = 0 }).ValidateCreate()
+	assert.Error(t, err)
+
+	_, err = class(func(s *VirtualMachineClassSpec) { s.Bounds.MemorySlotSize = resource.MustParse("1M") }).ValidateCreate()
+	assert.Error(t, err)
+
+	_, err = class(func(s *VirtualMachineClassSpec) { s.Bounds.MemorySlotsPerCU = 64 }).ValidateCreate()
+	assert.Error(t, err)
+
+	_, err = class(func(s *VirtualMachineClassSpec) {
+		s.Memory = &VirtualMachineClassMemory{MemhpAutoMovableRatio: lo.ToPtr("10000")}
+	}).ValidateCreate()
+	assert.Error(t, err)
+
+	_, err = class(func(s *VirtualMachineClassSpec) { s.DiskCacheSettings = lo.ToPtr("") }).ValidateCreate()
+	assert.Error(t, err)
+}
+
+func TestVirtualMachineClassApplyDefaults(t *testing.T) {
+	class := VirtualMachineClassSpec{
+		Bounds:            testClassBounds(),
+		Memory:            nil,
+		DiskCacheSettings: nil,
+		CPUClass:          lo.ToPtr(CPUClassDedicated),
+	}
+
+	t.Run("unset bounds are filled in", func(t *testing.T) {
+		vm := &VirtualMachine{}
+		class.ApplyDefaults(&vm.Spec)
+		vm.Default()
+
+		assert.Equal(t, vm.Spec.Guest.CPUs, CPUs{Min: 250, Max: 4000, Use: 250})
+		assert.Equal(t, vm.Spec.Guest.MemorySlots, MemorySlots{Min: 1, Max: 16, Use: 1})
+		assert.Equal(t, vm.Spec.Guest.MemorySlotSize.Value(), int64(1<<30))
+		assert.Equal(t, *vm.Spec.CPUClass, CPUClassDedicated)
+	})
+
+	t.Run("VM settings take precedence", func(t *testing.T) {
+		vm := &VirtualMachine{}
+		vm.Spec.Guest.CPUs = CPUs{Min: 1000, Max: 1000, Use: 1000}
+		vm.Spec.CPUClass = lo.ToPtr(CPUClassShared)
+		class.ApplyDefaults(&vm.Spec)
+		vm.Default()
+
+		assert.Equal(t, vm.Spec.Guest.CPUs, CPUs{Min: 1000, Max: 1000, Use: 1000})
+		assert.Equal(t, vm.Spec.Guest.MemorySlots, MemorySlots{Min: 0, Max: 0, Use: 0})
+		assert.Equal(t, vm.Spec.Guest.MemorySlotSize.Value(), int64(1<<30))
+		assert.Equal(t, *vm.Spec.CPUClass, CPUClassShared)
+	})
+}
@@ -0,0 +1,78 @@
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VirtualMachineImageLabel is the label on the pre-pull DaemonSet and its pods, giving the name of
+// the VirtualMachineImage they were created for.
+const VirtualMachineImageLabel = "vm.neon.tech/image"
+
+// VirtualMachineImageSpec defines the desired state of VirtualMachineImage
+type VirtualMachineImageSpec struct {
+	// Image is the guest rootfs image to pre-pull, as would be set in a VM's
+	// .spec.guest.rootDisk.image.
+	// +kubebuilder:validation:MinLength=1
+	Image string `json:"image"`
+
+	// NodeSelector restricts the nodes that the image is pulled to. If empty, the image is
+	// pulled to all nodes that pods can be scheduled on.
+	// +optional
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+
+	// Tolerations allow pulling the image to tainted nodes, like the ones reserved for VMs.
+	// +optional
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+
+	// ImagePullSecrets are used to pull the image, if it's in a private registry.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+}
+
+// VirtualMachineImageStatus defines the observed state of VirtualMachineImage
+type VirtualMachineImageStatus struct {
+	// DesiredNodes is the number of nodes that the image should be pulled to.
+	// +optional
+	DesiredNodes int32 `json:"desiredNodes"`
+	// ReadyNodes is the number of nodes that the image has been pulled to.
+	// +optional
+	ReadyNodes int32 `json:"readyNodes"`
+	// ObservedGeneration is the generation of the image that the status was computed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+//+genclient
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:singular=virtualmachineimage,shortName=vmimage
+//+kubebuilder:printcolumn:name="Image",type=string,JSONPath=`.spec.image`
+//+kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.status.desiredNodes`
+//+kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyNodes`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// VirtualMachineImage is the Schema for the virtualmachineimages API
+//
+// A VirtualMachineImage registers a guest rootfs image that should be pre-pulled to nodes, so that
+// the first VM to start on a node with that image isn't delayed by pulling it.
+type VirtualMachineImage struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VirtualMachineImageSpec   `json:"spec,omitempty"`
+	Status VirtualMachineImageStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// VirtualMachineImageList contains a list of VirtualMachineImage
+type VirtualMachineImageList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VirtualMachineImage `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VirtualMachineImage{}, &VirtualMachineImageList{}) //nolint:exhaustruct // just being used to provide the types
+}
@@ -24,19 +24,50 @@ import (
 
 const MigrationPort int32 = 20187
 
+const (
+	// MigrationTriggerLabel is the label on a VirtualMachineMigration identifying why it was
+	// created, for metrics. Migrations without it are treated as MigrationTriggerManual.
+	MigrationTriggerLabel string = "vm.neon.tech/migration-trigger"
+
+	// MigrationTriggerManual is the trigger for migrations created by hand.
+	MigrationTriggerManual string = "manual"
+	// MigrationTriggerDrain is the trigger for migrations moving VMs off of nodes being drained.
+	MigrationTriggerDrain string = "drain"
+	// MigrationTriggerRebalance is the trigger for migrations moving VMs between nodes to balance
+	// their load, e.g. by the scheduler plugin.
+	MigrationTriggerRebalance string = "rebalance"
+)
+
+// MigrationNBDPort is the port that the target runner's QEMU receives disks on, when they're
+// migrated with DiskMigrationModeMirror.
+const MigrationNBDPort int32 = 20188
+
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // VirtualMachineMigrationSpec defines the desired state of VirtualMachineMigration
 type VirtualMachineMigrationSpec struct {
 	VmName string `json:"vmName"`
 
-	// TODO: not implemented
+	// Deprecated: not implemented. Use targetNodeSelector instead.
 	// +optional
 	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
-	// TODO: not implemented
+	// Deprecated: not implemented. Use targetNodeAffinity instead.
 	// +optional
 	NodeAffinity *corev1.NodeAffinity `json:"nodeAffinity,omitempty"`
 
+	// Name of the node to migrate the VM to.
+	//
+	// The target pod still goes through the scheduler, so it only starts once the node has room
+	// for the VM.
+	// +optional
+	TargetNode string `json:"targetNode,omitempty"`
+	// Labels that the target node must have, in addition to the VM's own node selector.
+	// +optional
+	TargetNodeSelector map[string]string `json:"targetNodeSelector,omitempty"`
+	// Node affinity for the target pod, in addition to the VM's own affinity.
+	// +optional
+	TargetNodeAffinity *corev1.NodeAffinity `json:"targetNodeAffinity,omitempty"`
+
 	// +optional
 	// +kubebuilder:default:=true
 	PreventMigrationToSameHost bool `json:"preventMigrationToSameHost"`
@@ -48,10 +79,21 @@ type VirtualMachineMigrationSpec struct {
 	CompletionTimeout int32 `json:"completionTimeout"`
 
 	// Trigger incremental disk copy migration by default, otherwise full disk copy used in migration
+	//
+	// Only used with diskMigration=block.
 	// +optional
 	// +kubebuilder:default:=true
 	Incremental bool `json:"incremental"`
 
+	// How the VM's disks are copied to the target, which all live on the source node.
+	//
+	// "block" uses QEMU's built-in block migration, alongside the memory. "mirror" copies each
+	// writable disk to the target over NBD before the memory, and keeps the copies in sync until
+	// the VM switches over. Newer QEMU versions only support "mirror".
+	// +optional
+	// +kubebuilder:default:=block
+	DiskMigration DiskMigrationMode `json:"diskMigration"`
+
 	// Use PostCopy migration by default
 	// +optional
 	// +kubebuilder:default:=false
@@ -62,12 +104,102 @@ type VirtualMachineMigrationSpec struct {
 	// +kubebuilder:default:=true
 	AutoConverge bool `json:"autoConverge"`
 
-	// Set 1 Gbyte/sec as default for migration bandwidth
+	// Maximum bandwidth for the migration, in bytes per second.
+	//
+	// If not set or zero, the controller's default is used (1Gi, unless configured otherwise).
+	//
+	// This used to default to 1Gi in the CRD itself. Migrations created before that was removed
+	// have 1Gi stored, so they keep using it even if the controller's default is changed.
 	// +optional
-	// +kubebuilder:default:="1Gi"
 	MaxBandwidth resource.Quantity `json:"maxBandwidth"`
+
+	// Maximum time that the VM may be paused for at the end of the migration, in milliseconds.
+	//
+	// Lower values keep the final pause short, but make the migration take longer to converge
+	// (or not converge at all, without auto-converge or post-copy). If not set, the controller's
+	// default is used (300ms, unless configured otherwise).
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=2000000
+	MaxDowntimeMillis *int64 `json:"maxDowntimeMillis,omitempty"`
+
+	// Transfer guest memory over multiple connections in parallel, which is faster on nodes with
+	// high-bandwidth networking. Not compatible with allowPostCopy.
+	//
+	// Both the source and target QEMU must support it, otherwise the migration fails.
+	// +optional
+	Multifd *MultifdSettings `json:"multifd,omitempty"`
+
+	// Number of times to retry the migration on a fresh target pod after it fails, with
+	// exponential backoff between attempts.
+	//
+	// Defaults to 0, so that migrations that don't set it fail on the first error, as they did
+	// before retries were supported. Migrations that switched to post-copy are never retried,
+	// because the source no longer has the guest's full state.
+	// +optional
+	// +kubebuilder:default:=0
+	// +kubebuilder:validation:Minimum=0
+	BackoffLimit int32 `json:"backoffLimit"`
 }
 
+type MultifdSettings struct {
+	// Number of parallel connections to transfer memory over.
+	// +optional
+	// +kubebuilder:default:=2
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=255
+	Channels int32 `json:"channels"`
+
+	// Compression for the memory sent on each connection.
+	// +optional
+	// +kubebuilder:default:=none
+	Compression MultifdCompression `json:"compression"`
+}
+
+// GetChannels returns the number of multifd channels, defaulting to 2 if not set.
+func (s *MultifdSettings) GetChannels() int32 {
+	if s.Channels == 0 {
+		return 2
+	}
+	return s.Channels
+}
+
+// GetCompression returns the multifd compression, defaulting to none if not set.
+func (s *MultifdSettings) GetCompression() MultifdCompression {
+	if s.Compression == "" {
+		return MultifdCompressionNone
+	}
+	return s.Compression
+}
+
+// GetDiskMigration returns how the VM's disks are migrated, defaulting to block if not set.
+func (s *VirtualMachineMigrationSpec) GetDiskMigration() DiskMigrationMode {
+	if s.DiskMigration == "" {
+		return DiskMigrationModeBlock
+	}
+	return s.DiskMigration
+}
+
+// +kubebuilder:validation:Enum=block;mirror
+type DiskMigrationMode string
+
+const (
+	// DiskMigrationModeBlock copies disks with QEMU's block migration, as part of the migration
+	// stream.
+	DiskMigrationModeBlock DiskMigrationMode = "block"
+	// DiskMigrationModeMirror copies disks with drive-mirror, over NBD to the target.
+	DiskMigrationModeMirror DiskMigrationMode = "mirror"
+)
+
+// +kubebuilder:validation:Enum=none;zlib;zstd
+type MultifdCompression string
+
+const (
+	MultifdCompressionNone MultifdCompression = "none"
+	MultifdCompressionZlib MultifdCompression = "zlib"
+	MultifdCompressionZstd MultifdCompression = "zstd"
+)
+
 // VirtualMachineMigrationStatus defines the observed state of VirtualMachineMigration
 type VirtualMachineMigrationStatus struct {
 	// Represents the observations of a VirtualMachineMigration's current state.
@@ -98,6 +230,19 @@ type VirtualMachineMigrationStatus struct {
 	TargetNode string `json:"targetNode,omitempty"`
 	// +optional
 	Info MigrationInfo `json:"info,omitempty"`
+	// Live progress of the migration, updated while it's running.
+	// +optional
+	Progress *MigrationProgress `json:"progress,omitempty"`
+	// Number of times the migration has been retried after failing.
+	// +optional
+	Retries int32 `json:"retries,omitempty"`
+	// When the latest attempt failed. Unset while an attempt is in progress.
+	// +optional
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+	// Whether the latest attempt switched to post-copy. After that, the guest runs on the target
+	// and its memory is split between both pods, so the migration can't be retried if it fails.
+	// +optional
+	PostCopyStarted bool `json:"postCopyStarted,omitempty"`
 }
 
 type MigrationInfo struct {
@@ -115,6 +260,20 @@ type MigrationInfo struct {
 	Compression MigrationInfoCompression `json:"compression,omitempty"`
 }
 
+type MigrationProgress struct {
+	// Bytes of guest RAM transferred so far, including any pages that were sent more than once.
+	RamTransferred int64 `json:"ramTransferred"`
+	// Total bytes of guest RAM.
+	RamTotal int64 `json:"ramTotal"`
+	// Rate at which the guest is dirtying pages, in pages per second. If this is consistently
+	// higher than the migration can send them, the migration won't converge.
+	DirtyPagesRate int64 `json:"dirtyPagesRate"`
+	// Estimated time the VM would be paused for, if the migration switched over now.
+	ExpectedDowntimeMs int64 `json:"expectedDowntimeMs"`
+	// Number of passes over guest RAM so far.
+	Iteration int64 `json:"iteration"`
+}
+
 type MigrationInfoRam struct {
 	// +optional
 	Transferred int64 `json:"transferred,omitempty"`
@@ -158,6 +317,7 @@ const (
 // +kubebuilder:printcolumn:name="Target",type=string,JSONPath=`.status.targetPodName`
 // +kubebuilder:printcolumn:name="TargetIP",type=string,priority=1,JSONPath=`.status.targetPodIP`
 // +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Retries",type=integer,priority=1,JSONPath=`.status.retries`
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 type VirtualMachineMigration struct {
 	metav1.TypeMeta   `json:",inline"`
@@ -17,6 +17,8 @@ limitations under the License.
 package v1
 
 import (
+	"errors"
+
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
@@ -42,8 +44,19 @@ var _ webhook.Validator = &VirtualMachineMigration{}
 //
 // The controller wraps this logic so it can inject extra control in the webhook.
 func (r *VirtualMachineMigration) ValidateCreate() (admission.Warnings, error) {
-	// TODO: implement creation validation webhook (?)
-	return nil, nil
+	// QEMU doesn't support switching to post-copy with multifd
+	if r.Spec.Multifd != nil && r.Spec.AllowPostCopy {
+		return nil, errors.New(".spec.multifd is not compatible with .spec.allowPostCopy")
+	}
+
+	var warnings admission.Warnings
+	if r.Spec.NodeSelector != nil {
+		warnings = append(warnings, ".spec.nodeSelector is not implemented, use .spec.targetNodeSelector instead")
+	}
+	if r.Spec.NodeAffinity != nil {
+		warnings = append(warnings, ".spec.nodeAffinity is not implemented, use .spec.targetNodeAffinity instead")
+	}
+	return warnings, nil
 }
 
 // ValidateUpdate implements webhook.Validator
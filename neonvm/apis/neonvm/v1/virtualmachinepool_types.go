@@ -0,0 +1,132 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// VirtualMachinePoolLabel is the label on VMs that belong to a VirtualMachinePool, giving the
+	// name of the pool. It's removed when the VM is released from the pool after being claimed.
+	//
+	// It's also set on the template pods that create the pool's memory images, if it sets
+	// .spec.resumeImages.
+	VirtualMachinePoolLabel = "vm.neon.tech/pool"
+
+	// VirtualMachinePoolTemplateHashLabel is the label on VMs that belong to a VirtualMachinePool,
+	// identifying the version of the pool's template that the VM was created from.
+	VirtualMachinePoolTemplateHashLabel = "vm.neon.tech/pool-template-hash"
+
+	// VirtualMachinePoolClaimLabel is the label that claims a VM from its VirtualMachinePool. The
+	// value identifies whoever claimed it.
+	//
+	// To claim a VM, set this label on a running VM from the pool with an update that fails if the
+	// VM was modified concurrently, so that each VM is only claimed once. The pool then releases the
+	// VM, removing its pool labels and owner reference, and creates another to replace it.
+	//
+	// Claims on VMs that aren't running yet are rejected. Claimed VMs keep the name that the pool
+	// generated for them (e.g. "<pool>-x7k2p"), because objects can't be renamed.
+	VirtualMachinePoolClaimLabel = "vm.neon.tech/pool-claim"
+
+	// VirtualMachinePoolConfigDiskName is the name of the disk added to VMs in pools that set
+	// .spec.configMountPath.
+	VirtualMachinePoolConfigDiskName = "pool-config"
+)
+
+// VirtualMachinePoolSpec defines the desired state of VirtualMachinePool
+type VirtualMachinePoolSpec struct {
+	// Replicas is the number of unclaimed VMs to keep in the pool.
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+
+	// Template describes the VMs created for the pool.
+	//
+	// Changing the template replaces the pool's unclaimed VMs. VMs that were already claimed are
+	// not affected.
+	Template VirtualMachinePoolTemplate `json:"template"`
+
+	// ConfigMountPath, if not empty, is the path in each VM at which the ConfigMap with the same
+	// name as the VM is mounted, once it exists.
+	//
+	// This allows specializing a VM after it's claimed, by creating the ConfigMap. The disk is
+	// watched, so changes to the ConfigMap are also reflected inside the VM.
+	//
+	// Other disks can't be attached once the VM is claimed, because a VM's disks can't be changed
+	// while it's running. Any other disks must be in the template.
+	// +optional
+	ConfigMountPath string `json:"configMountPath,omitempty"`
+
+	// ResumeImages is the number of memory images of the template to keep ready, so that new VMs
+	// can resume from an image instead of booting from scratch.
+	//
+	// Any VM in the pool's namespace can resume from an image if its spec matches the template in
+	// everything that affects QEMU and the kernel. This includes the pool's own VMs, unless the
+	// pool sets .spec.configMountPath, because each VM's config disk is different. Images are only
+	// kept if the controller has a resume pool directory, and only for amd64 VMs without
+	// .spec.extraNetwork, .spec.sriovNetwork or .spec.tls.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ResumeImages int32 `json:"resumeImages,omitempty"`
+}
+
+type VirtualMachinePoolTemplate struct {
+	// Labels are added to each VM in the pool, in addition to the pool's own labels.
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+	// Annotations are added to each VM in the pool.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	Spec VirtualMachineSpec `json:"spec"`
+}
+
+// VirtualMachinePoolStatus defines the observed state of VirtualMachinePool
+type VirtualMachinePoolStatus struct {
+	// Replicas is the number of unclaimed VMs in the pool that were created from the current
+	// template.
+	// +optional
+	Replicas int32 `json:"replicas"`
+	// ReadyReplicas is the number of those VMs that are running, and so can be claimed.
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// ResumeImages is the number of memory images of the current template that are ready to be
+	// resumed from.
+	// +optional
+	ResumeImages int32 `json:"resumeImages"`
+	// ObservedGeneration is the generation of the pool that the status was computed for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+//+genclient
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:singular=virtualmachinepool,shortName=vmpool
+//+kubebuilder:printcolumn:name="Desired",type=integer,JSONPath=`.spec.replicas`
+//+kubebuilder:printcolumn:name="Current",type=integer,JSONPath=`.status.replicas`
+//+kubebuilder:printcolumn:name="Ready",type=integer,JSONPath=`.status.readyReplicas`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// VirtualMachinePool is the Schema for the virtualmachinepools API
+//
+// A VirtualMachinePool keeps a number of pre-booted VMs with the same spec, so that new VMs can be
+// claimed from the pool instead of waiting for them to boot.
+type VirtualMachinePool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VirtualMachinePoolSpec   `json:"spec,omitempty"`
+	Status VirtualMachinePoolStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VirtualMachinePoolList contains a list of VirtualMachinePool
+type VirtualMachinePoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VirtualMachinePool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VirtualMachinePool{}, &VirtualMachinePoolList{}) //nolint:exhaustruct // just being used to provide the types
+}
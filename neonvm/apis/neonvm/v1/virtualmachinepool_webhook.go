@@ -0,0 +1,87 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+//+kubebuilder:webhook:path=/validate-vm-neon-tech-v1-virtualmachinepool,mutating=false,failurePolicy=fail,sideEffects=None,groups=vm.neon.tech,resources=virtualmachinepools,verbs=create;update,versions=v1,name=vvirtualmachinepool.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &VirtualMachinePool{}
+
+// ValidateCreate implements webhook.Validator
+//
+// The controller wraps this logic so it can inject extra control in the webhook.
+func (r *VirtualMachinePool) ValidateCreate() (admission.Warnings, error) {
+	return r.Spec.validate()
+}
+
+// ValidateUpdate implements webhook.Validator
+//
+// The controller wraps this logic so it can inject extra control in the webhook.
+func (r *VirtualMachinePool) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	// Changes to the template are applied by replacing the pool's unclaimed VMs, so none of the
+	// VM's own immutable fields need to be checked here.
+	return r.Spec.validate()
+}
+
+// ValidateDelete implements webhook.Validator
+//
+// The controller wraps this logic so it can inject extra control in the webhook.
+func (r *VirtualMachinePool) ValidateDelete() (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (s *VirtualMachinePoolSpec) validate() (admission.Warnings, error) {
+	if s.Replicas < 0 {
+		return nil, errors.New(".spec.replicas must not be negative")
+	}
+	if s.ResumeImages < 0 {
+		return nil, errors.New(".spec.resumeImages must not be negative")
+	}
+	if s.ResumeImages > 0 {
+		// Only amd64 runners have a vmgenid device, which makes the guest reseed its random number
+		// generator when it's resumed, so that VMs resumed from the same image don't generate the
+		// same keys. The overlay network is configured by the kernel command line, VFIO devices
+		// can't be saved at all, and TLS certificates are created for each VM.
+		if arch := s.Template.Spec.TargetArchitecture; arch != nil && *arch != CPUArchitectureAMD64 {
+			return nil, fmt.Errorf(".spec.resumeImages is only supported for %s VMs", CPUArchitectureAMD64)
+		}
+		if s.Template.Spec.ExtraNetwork != nil || s.Template.Spec.SRIOVNetwork != nil || s.Template.Spec.TLS != nil {
+			return nil, errors.New(".spec.resumeImages is not supported for VMs with .spec.extraNetwork, .spec.sriovNetwork or .spec.tls")
+		}
+	}
+
+	for _, label := range []string{VirtualMachinePoolLabel, VirtualMachinePoolTemplateHashLabel, VirtualMachinePoolClaimLabel} {
+		if _, ok := s.Template.Labels[label]; ok {
+			return nil, fmt.Errorf(".spec.template.labels: %q is set by the pool", label)
+		}
+	}
+
+	if p := s.ConfigMountPath; p != "" {
+		if !path.IsAbs(p) || strings.Contains(p, ":") {
+			return nil, fmt.Errorf(".spec.configMountPath (%q) must be an absolute path, and must not contain ':'", p)
+		}
+		if slices.ContainsFunc(s.Template.Spec.Disks, func(d Disk) bool { return d.Name == VirtualMachinePoolConfigDiskName }) {
+			return nil, fmt.Errorf(".spec.template.spec.disks: %q is reserved when .spec.configMountPath is set", VirtualMachinePoolConfigDiskName)
+		}
+	}
+
+	// Check the template as if it were a VM, so that errors show up here instead of when the pool
+	// creates VMs.
+	vm := VirtualMachine{} //nolint:exhaustruct // only the spec is validated
+	vm.Spec = s.Template.Spec
+	warnings, err := vm.ValidateCreate()
+	if err != nil {
+		return warnings, fmt.Errorf(".spec.template: %w", err)
+	}
+	return warnings, nil
+}
@@ -0,0 +1,70 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/tychoish/fun/assert"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestVirtualMachinePoolValidate(t *testing.T) {
+	pool := func(modify func(*VirtualMachinePoolSpec)) *VirtualMachinePool {
+		p := &VirtualMachinePool{}
+		p.Spec.Replicas = 2
+		p.Spec.Template.Spec.Guest.CPUs = CPUs{Min: 250, Max: 1000, Use: 250}
+		p.Spec.Template.Spec.Guest.MemorySlots = MemorySlots{Min: 1, Max: 4, Use: 1}
+		p.Spec.Template.Spec.Guest.MemorySlotSize = resource.MustParse("1Gi")
+		modify(&p.Spec)
+		return p
+	}
+
+	_, err := pool(func(*VirtualMachinePoolSpec) {}).ValidateCreate()
+	assert.NotError(t, err)
+
+	_, err = pool(func(s *VirtualMachinePoolSpec) { s.ConfigMountPath = "/neonvm/config" }).ValidateCreate()
+	assert.NotError(t, err)
+
+	_, err = pool(func(s *VirtualMachinePoolSpec) { s.Replicas = -1 }).ValidateCreate()
+	assert.Error(t, err)
+
+	_, err = pool(func(s *VirtualMachinePoolSpec) {
+		s.Template.Labels = map[string]string{VirtualMachinePoolClaimLabel: "foo"}
+	}).ValidateCreate()
+	assert.Error(t, err)
+
+	_, err = pool(func(s *VirtualMachinePoolSpec) { s.ConfigMountPath = "relative/path" }).ValidateCreate()
+	assert.Error(t, err)
+
+	_, err = pool(func(s *VirtualMachinePoolSpec) {
+		s.ConfigMountPath = "/neonvm/config"
+		s.Template.Spec.Disks = []Disk{{Name: VirtualMachinePoolConfigDiskName}}
+	}).ValidateCreate()
+	assert.Error(t, err)
+
+	_, err = pool(func(s *VirtualMachinePoolSpec) { s.ResumeImages = 2 }).ValidateCreate()
+	assert.NotError(t, err)
+
+	_, err = pool(func(s *VirtualMachinePoolSpec) { s.ResumeImages = -1 }).ValidateCreate()
+	assert.Error(t, err)
+
+	// Only amd64 VMs can be resumed from memory images
+	_, err = pool(func(s *VirtualMachinePoolSpec) {
+		s.ResumeImages = 2
+		s.Template.Spec.TargetArchitecture = lo.ToPtr(CPUArchitectureARM64)
+	}).ValidateCreate()
+	assert.Error(t, err)
+
+	_, err = pool(func(s *VirtualMachinePoolSpec) {
+		s.ResumeImages = 2
+		s.Template.Spec.TLS = &TLSProvisioning{}
+	}).ValidateCreate()
+	assert.Error(t, err)
+
+	// Errors in the template itself are reported
+	_, err = pool(func(s *VirtualMachinePoolSpec) {
+		s.Template.Spec.Guest.Settings = &GuestSettings{Swappiness: lo.ToPtr[int32](60)}
+	}).ValidateCreate()
+	assert.Error(t, err)
+}
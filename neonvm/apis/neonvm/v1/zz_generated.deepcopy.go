@@ -26,6 +26,31 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CPUFeatures) DeepCopyInto(out *CPUFeatures) {
+	*out = *in
+	if in.Enable != nil {
+		in, out := &in.Enable, &out.Enable
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Disable != nil {
+		in, out := &in.Disable, &out.Disable
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CPUFeatures.
+func (in *CPUFeatures) DeepCopy() *CPUFeatures {
+	if in == nil {
+		return nil
+	}
+	out := new(CPUFeatures)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CPUs) DeepCopyInto(out *CPUs) {
 	*out = *in
@@ -41,6 +66,26 @@ func (in *CPUs) DeepCopy() *CPUs {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClockSettings) DeepCopyInto(out *ClockSettings) {
+	*out = *in
+	if in.ResyncAfterMigration != nil {
+		in, out := &in.ResyncAfterMigration, &out.ResyncAfterMigration
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClockSettings.
+func (in *ClockSettings) DeepCopy() *ClockSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(ClockSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Disk) DeepCopyInto(out *Disk) {
 	*out = *in
@@ -67,6 +112,22 @@ func (in *Disk) DeepCopy() *Disk {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DiskEncryption) DeepCopyInto(out *DiskEncryption) {
+	*out = *in
+	in.SecretKeyRef.DeepCopyInto(&out.SecretKeyRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DiskEncryption.
+func (in *DiskEncryption) DeepCopy() *DiskEncryption {
+	if in == nil {
+		return nil
+	}
+	out := new(DiskEncryption)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DiskSource) DeepCopyInto(out *DiskSource) {
 	*out = *in
@@ -106,6 +167,21 @@ func (in *DiskSource) DeepCopy() *DiskSource {
 func (in *EmptyDiskSource) DeepCopyInto(out *EmptyDiskSource) {
 	*out = *in
 	out.Size = in.Size.DeepCopy()
+	if in.DetectZeroes != nil {
+		in, out := &in.DetectZeroes, &out.DetectZeroes
+		*out = new(DetectZeroesMode)
+		**out = **in
+	}
+	if in.TrimInterval != nil {
+		in, out := &in.TrimInterval, &out.TrimInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Encryption != nil {
+		in, out := &in.Encryption, &out.Encryption
+		*out = new(DiskEncryption)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EmptyDiskSource.
@@ -118,6 +194,26 @@ func (in *EmptyDiskSource) DeepCopy() *EmptyDiskSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Entropy) DeepCopyInto(out *Entropy) {
+	*out = *in
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Entropy.
+func (in *Entropy) DeepCopy() *Entropy {
+	if in == nil {
+		return nil
+	}
+	out := new(Entropy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EnvVar) DeepCopyInto(out *EnvVar) {
 	*out = *in
@@ -133,6 +229,31 @@ func (in *EnvVar) DeepCopy() *EnvVar {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EphemeralStorage) DeepCopyInto(out *EphemeralStorage) {
+	*out = *in
+	if in.Request != nil {
+		in, out := &in.Request, &out.Request
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Limit != nil {
+		in, out := &in.Limit, &out.Limit
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EphemeralStorage.
+func (in *EphemeralStorage) DeepCopy() *EphemeralStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(EphemeralStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExtraNetwork) DeepCopyInto(out *ExtraNetwork) {
 	*out = *in
@@ -148,6 +269,21 @@ func (in *ExtraNetwork) DeepCopy() *ExtraNetwork {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Firmware) DeepCopyInto(out *Firmware) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Firmware.
+func (in *Firmware) DeepCopy() *Firmware {
+	if in == nil {
+		return nil
+	}
+	out := new(Firmware)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Guest) DeepCopyInto(out *Guest) {
 	*out = *in
@@ -166,8 +302,18 @@ func (in *Guest) DeepCopyInto(out *Guest) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.KernelArgs != nil {
+		in, out := &in.KernelArgs, &out.KernelArgs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	out.CPUs = in.CPUs
 	out.MemorySlotSize = in.MemorySlotSize.DeepCopy()
+	if in.VirtioMemBlockSize != nil {
+		in, out := &in.VirtioMemBlockSize, &out.VirtioMemBlockSize
+		x := (*in).DeepCopy()
+		*out = &x
+	}
 	out.MemorySlots = in.MemorySlots
 	in.RootDisk.DeepCopyInto(&out.RootDisk)
 	if in.Command != nil {
@@ -195,6 +341,26 @@ func (in *Guest) DeepCopyInto(out *Guest) {
 		*out = new(GuestSettings)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.NestedVirtualization != nil {
+		in, out := &in.NestedVirtualization, &out.NestedVirtualization
+		*out = new(bool)
+		**out = **in
+	}
+	if in.CPUFeatures != nil {
+		in, out := &in.CPUFeatures, &out.CPUFeatures
+		*out = new(CPUFeatures)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Firmware != nil {
+		in, out := &in.Firmware, &out.Firmware
+		*out = new(Firmware)
+		**out = **in
+	}
+	if in.ExtraArgs != nil {
+		in, out := &in.ExtraArgs, &out.ExtraArgs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Guest.
@@ -207,6 +373,46 @@ func (in *Guest) DeepCopy() *Guest {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GuestDNSConfig) DeepCopyInto(out *GuestDNSConfig) {
+	*out = *in
+	if in.Nameservers != nil {
+		in, out := &in.Nameservers, &out.Nameservers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Searches != nil {
+		in, out := &in.Searches, &out.Searches
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GuestDNSConfig.
+func (in *GuestDNSConfig) DeepCopy() *GuestDNSConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(GuestDNSConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GuestMetrics) DeepCopyInto(out *GuestMetrics) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GuestMetrics.
+func (in *GuestMetrics) DeepCopy() *GuestMetrics {
+	if in == nil {
+		return nil
+	}
+	out := new(GuestMetrics)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *GuestSettings) DeepCopyInto(out *GuestSettings) {
 	*out = *in
@@ -220,6 +426,21 @@ func (in *GuestSettings) DeepCopyInto(out *GuestSettings) {
 		x := (*in).DeepCopy()
 		*out = &x
 	}
+	if in.Swappiness != nil {
+		in, out := &in.Swappiness, &out.Swappiness
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Zswap != nil {
+		in, out := &in.Zswap, &out.Zswap
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Clock != nil {
+		in, out := &in.Clock, &out.Clock
+		*out = new(ClockSettings)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GuestSettings.
@@ -235,6 +456,9 @@ func (in *GuestSettings) DeepCopy() *GuestSettings {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPAllocation) DeepCopyInto(out *IPAllocation) {
 	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAllocation.
@@ -247,6 +471,61 @@ func (in *IPAllocation) DeepCopy() *IPAllocation {
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IPAllocation) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAllocationList) DeepCopyInto(out *IPAllocationList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]IPAllocation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAllocationList.
+func (in *IPAllocationList) DeepCopy() *IPAllocationList {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAllocationList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IPAllocationList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPAllocationSpec) DeepCopyInto(out *IPAllocationSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPAllocationSpec.
+func (in *IPAllocationSpec) DeepCopy() *IPAllocationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IPAllocationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPPool) DeepCopyInto(out *IPPool) {
 	*out = *in
@@ -273,6 +552,21 @@ func (in *IPPool) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IPPoolAllocation) DeepCopyInto(out *IPPoolAllocation) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IPPoolAllocation.
+func (in *IPPoolAllocation) DeepCopy() *IPPoolAllocation {
+	if in == nil {
+		return nil
+	}
+	out := new(IPPoolAllocation)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *IPPoolList) DeepCopyInto(out *IPPoolList) {
 	*out = *in
@@ -310,7 +604,7 @@ func (in *IPPoolSpec) DeepCopyInto(out *IPPoolSpec) {
 	*out = *in
 	if in.Allocations != nil {
 		in, out := &in.Allocations, &out.Allocations
-		*out = make(map[string]IPAllocation, len(*in))
+		*out = make(map[string]IPPoolAllocation, len(*in))
 		for key, val := range *in {
 			(*out)[key] = val
 		}
@@ -327,6 +621,22 @@ func (in *IPPoolSpec) DeepCopy() *IPPoolSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MemoryBump) DeepCopyInto(out *MemoryBump) {
+	*out = *in
+	in.ExpiresAt.DeepCopyInto(&out.ExpiresAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MemoryBump.
+func (in *MemoryBump) DeepCopy() *MemoryBump {
+	if in == nil {
+		return nil
+	}
+	out := new(MemoryBump)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MemorySlots) DeepCopyInto(out *MemorySlots) {
 	*out = *in
@@ -390,158 +700,726 @@ func (in *MigrationInfoRam) DeepCopy() *MigrationInfoRam {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *OvercommitSettings) DeepCopyInto(out *OvercommitSettings) {
+func (in *MigrationProgress) DeepCopyInto(out *MigrationProgress) {
 	*out = *in
-	if in.CPU != nil {
-		in, out := &in.CPU, &out.CPU
-		x := (*in).DeepCopy()
-		*out = &x
-	}
-	if in.Memory != nil {
-		in, out := &in.Memory, &out.Memory
-		x := (*in).DeepCopy()
-		*out = &x
-	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OvercommitSettings.
-func (in *OvercommitSettings) DeepCopy() *OvercommitSettings {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MigrationProgress.
+func (in *MigrationProgress) DeepCopy() *MigrationProgress {
 	if in == nil {
 		return nil
 	}
-	out := new(OvercommitSettings)
+	out := new(MigrationProgress)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Port) DeepCopyInto(out *Port) {
+func (in *MultifdSettings) DeepCopyInto(out *MultifdSettings) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Port.
-func (in *Port) DeepCopy() *Port {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MultifdSettings.
+func (in *MultifdSettings) DeepCopy() *MultifdSettings {
 	if in == nil {
 		return nil
 	}
-	out := new(Port)
+	out := new(MultifdSettings)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *Revision) DeepCopyInto(out *Revision) {
+func (in *NetworkLimits) DeepCopyInto(out *NetworkLimits) {
 	*out = *in
+	if in.EgressLimit != nil {
+		in, out := &in.EgressLimit, &out.EgressLimit
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.IngressLimit != nil {
+		in, out := &in.IngressLimit, &out.IngressLimit
+		x := (*in).DeepCopy()
+		*out = &x
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Revision.
-func (in *Revision) DeepCopy() *Revision {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkLimits.
+func (in *NetworkLimits) DeepCopy() *NetworkLimits {
 	if in == nil {
 		return nil
 	}
-	out := new(Revision)
+	out := new(NetworkLimits)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *RevisionWithTime) DeepCopyInto(out *RevisionWithTime) {
+func (in *NetworkSettings) DeepCopyInto(out *NetworkSettings) {
 	*out = *in
-	out.Revision = in.Revision
-	in.UpdatedAt.DeepCopyInto(&out.UpdatedAt)
+	in.NetworkLimits.DeepCopyInto(&out.NetworkLimits)
+	if in.DNS != nil {
+		in, out := &in.DNS, &out.DNS
+		*out = new(GuestDNSConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MTU != nil {
+		in, out := &in.MTU, &out.MTU
+		*out = new(int32)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RevisionWithTime.
-func (in *RevisionWithTime) DeepCopy() *RevisionWithTime {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NetworkSettings.
+func (in *NetworkSettings) DeepCopy() *NetworkSettings {
 	if in == nil {
 		return nil
 	}
-	out := new(RevisionWithTime)
+	out := new(NetworkSettings)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *RootDisk) DeepCopyInto(out *RootDisk) {
+func (in *OvercommitSettings) DeepCopyInto(out *OvercommitSettings) {
 	*out = *in
-	out.Size = in.Size.DeepCopy()
-	if in.Execute != nil {
-		in, out := &in.Execute, &out.Execute
-		*out = make([]string, len(*in))
-		copy(*out, *in)
-	}
-}
+	if in.CPU != nil {
+		in, out := &in.CPU, &out.CPU
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OvercommitSettings.
+func (in *OvercommitSettings) DeepCopy() *OvercommitSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(OvercommitSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Port) DeepCopyInto(out *Port) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Port.
+func (in *Port) DeepCopy() *Port {
+	if in == nil {
+		return nil
+	}
+	out := new(Port)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Revision) DeepCopyInto(out *Revision) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Revision.
+func (in *Revision) DeepCopy() *Revision {
+	if in == nil {
+		return nil
+	}
+	out := new(Revision)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RevisionWithTime) DeepCopyInto(out *RevisionWithTime) {
+	*out = *in
+	out.Revision = in.Revision
+	in.UpdatedAt.DeepCopyInto(&out.UpdatedAt)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RevisionWithTime.
+func (in *RevisionWithTime) DeepCopy() *RevisionWithTime {
+	if in == nil {
+		return nil
+	}
+	out := new(RevisionWithTime)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RootDisk) DeepCopyInto(out *RootDisk) {
+	*out = *in
+	if in.FallbackImage != nil {
+		in, out := &in.FallbackImage, &out.FallbackImage
+		*out = new(string)
+		**out = **in
+	}
+	out.Size = in.Size.DeepCopy()
+	if in.Execute != nil {
+		in, out := &in.Execute, &out.Execute
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RootDisk.
+func (in *RootDisk) DeepCopy() *RootDisk {
+	if in == nil {
+		return nil
+	}
+	out := new(RootDisk)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RootDiskStatus) DeepCopyInto(out *RootDiskStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RootDiskStatus.
+func (in *RootDiskStatus) DeepCopy() *RootDiskStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RootDiskStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RunnerTerminationMessage) DeepCopyInto(out *RunnerTerminationMessage) {
+	*out = *in
+	if in.MemoryPeak != nil {
+		in, out := &in.MemoryPeak, &out.MemoryPeak
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.MemoryLimit != nil {
+		in, out := &in.MemoryLimit, &out.MemoryLimit
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RunnerTerminationMessage.
+func (in *RunnerTerminationMessage) DeepCopy() *RunnerTerminationMessage {
+	if in == nil {
+		return nil
+	}
+	out := new(RunnerTerminationMessage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SRIOVNetwork) DeepCopyInto(out *SRIOVNetwork) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SRIOVNetwork.
+func (in *SRIOVNetwork) DeepCopy() *SRIOVNetwork {
+	if in == nil {
+		return nil
+	}
+	out := new(SRIOVNetwork)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScalingPolicy) DeepCopyInto(out *ScalingPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalingPolicy.
+func (in *ScalingPolicy) DeepCopy() *ScalingPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ScalingPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ScalingPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScalingPolicyList) DeepCopyInto(out *ScalingPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ScalingPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalingPolicyList.
+func (in *ScalingPolicyList) DeepCopy() *ScalingPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(ScalingPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ScalingPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScalingPolicySchedule) DeepCopyInto(out *ScalingPolicySchedule) {
+	*out = *in
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]ScheduleDay, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalingPolicySchedule.
+func (in *ScalingPolicySchedule) DeepCopy() *ScalingPolicySchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(ScalingPolicySchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScalingPolicySpec) DeepCopyInto(out *ScalingPolicySpec) {
+	*out = *in
+	if in.TargetUtilization != nil {
+		in, out := &in.TargetUtilization, &out.TargetUtilization
+		*out = new(ScalingPolicyTargetUtilization)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StepLimits != nil {
+		in, out := &in.StepLimits, &out.StepLimits
+		*out = new(ScalingPolicyStepLimits)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Stabilization != nil {
+		in, out := &in.Stabilization, &out.Stabilization
+		*out = new(ScalingPolicyStabilization)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Schedules != nil {
+		in, out := &in.Schedules, &out.Schedules
+		*out = make([]ScalingPolicySchedule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalingPolicySpec.
+func (in *ScalingPolicySpec) DeepCopy() *ScalingPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ScalingPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScalingPolicyStabilization) DeepCopyInto(out *ScalingPolicyStabilization) {
+	*out = *in
+	if in.DownscaleWindowSeconds != nil {
+		in, out := &in.DownscaleWindowSeconds, &out.DownscaleWindowSeconds
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalingPolicyStabilization.
+func (in *ScalingPolicyStabilization) DeepCopy() *ScalingPolicyStabilization {
+	if in == nil {
+		return nil
+	}
+	out := new(ScalingPolicyStabilization)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScalingPolicyStepLimits) DeepCopyInto(out *ScalingPolicyStepLimits) {
+	*out = *in
+	if in.MaxUpscaleCU != nil {
+		in, out := &in.MaxUpscaleCU, &out.MaxUpscaleCU
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxDownscaleCU != nil {
+		in, out := &in.MaxDownscaleCU, &out.MaxDownscaleCU
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalingPolicyStepLimits.
+func (in *ScalingPolicyStepLimits) DeepCopy() *ScalingPolicyStepLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(ScalingPolicyStepLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScalingPolicyTargetUtilization) DeepCopyInto(out *ScalingPolicyTargetUtilization) {
+	*out = *in
+	if in.LoadAveragePercent != nil {
+		in, out := &in.LoadAveragePercent, &out.LoadAveragePercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MemoryUsagePercent != nil {
+		in, out := &in.MemoryUsagePercent, &out.MemoryUsagePercent
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MemoryTotalPercent != nil {
+		in, out := &in.MemoryTotalPercent, &out.MemoryTotalPercent
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScalingPolicyTargetUtilization.
+func (in *ScalingPolicyTargetUtilization) DeepCopy() *ScalingPolicyTargetUtilization {
+	if in == nil {
+		return nil
+	}
+	out := new(ScalingPolicyTargetUtilization)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TLSProvisioning) DeepCopyInto(out *TLSProvisioning) {
+	*out = *in
+	out.ExpireAfter = in.ExpireAfter
+	out.RenewBefore = in.RenewBefore
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TLSProvisioning.
+func (in *TLSProvisioning) DeepCopy() *TLSProvisioning {
+	if in == nil {
+		return nil
+	}
+	out := new(TLSProvisioning)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TmpfsDiskSource) DeepCopyInto(out *TmpfsDiskSource) {
+	*out = *in
+	out.Size = in.Size.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TmpfsDiskSource.
+func (in *TmpfsDiskSource) DeepCopy() *TmpfsDiskSource {
+	if in == nil {
+		return nil
+	}
+	out := new(TmpfsDiskSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualMachine) DeepCopyInto(out *VirtualMachine) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachine.
+func (in *VirtualMachine) DeepCopy() *VirtualMachine {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachine)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtualMachine) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualMachineClass) DeepCopyInto(out *VirtualMachineClass) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineClass.
+func (in *VirtualMachineClass) DeepCopy() *VirtualMachineClass {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachineClass)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtualMachineClass) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualMachineClassBounds) DeepCopyInto(out *VirtualMachineClassBounds) {
+	*out = *in
+	out.MemorySlotSize = in.MemorySlotSize.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineClassBounds.
+func (in *VirtualMachineClassBounds) DeepCopy() *VirtualMachineClassBounds {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachineClassBounds)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualMachineClassList) DeepCopyInto(out *VirtualMachineClassList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VirtualMachineClass, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineClassList.
+func (in *VirtualMachineClassList) DeepCopy() *VirtualMachineClassList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachineClassList)
+	in.DeepCopyInto(out)
+	return out
+}
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RootDisk.
-func (in *RootDisk) DeepCopy() *RootDisk {
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtualMachineClassList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualMachineClassMemory) DeepCopyInto(out *VirtualMachineClassMemory) {
+	*out = *in
+	if in.MemhpAutoMovableRatio != nil {
+		in, out := &in.MemhpAutoMovableRatio, &out.MemhpAutoMovableRatio
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineClassMemory.
+func (in *VirtualMachineClassMemory) DeepCopy() *VirtualMachineClassMemory {
 	if in == nil {
 		return nil
 	}
-	out := new(RootDisk)
+	out := new(VirtualMachineClassMemory)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TLSProvisioning) DeepCopyInto(out *TLSProvisioning) {
+func (in *VirtualMachineClassSpec) DeepCopyInto(out *VirtualMachineClassSpec) {
 	*out = *in
-	out.ExpireAfter = in.ExpireAfter
-	out.RenewBefore = in.RenewBefore
+	if in.Bounds != nil {
+		in, out := &in.Bounds, &out.Bounds
+		*out = new(VirtualMachineClassBounds)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		*out = new(VirtualMachineClassMemory)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DiskCacheSettings != nil {
+		in, out := &in.DiskCacheSettings, &out.DiskCacheSettings
+		*out = new(string)
+		**out = **in
+	}
+	if in.CPUClass != nil {
+		in, out := &in.CPUClass, &out.CPUClass
+		*out = new(CPUClass)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TLSProvisioning.
-func (in *TLSProvisioning) DeepCopy() *TLSProvisioning {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineClassSpec.
+func (in *VirtualMachineClassSpec) DeepCopy() *VirtualMachineClassSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(TLSProvisioning)
+	out := new(VirtualMachineClassSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *TmpfsDiskSource) DeepCopyInto(out *TmpfsDiskSource) {
+func (in *VirtualMachineImage) DeepCopyInto(out *VirtualMachineImage) {
 	*out = *in
-	out.Size = in.Size.DeepCopy()
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TmpfsDiskSource.
-func (in *TmpfsDiskSource) DeepCopy() *TmpfsDiskSource {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineImage.
+func (in *VirtualMachineImage) DeepCopy() *VirtualMachineImage {
 	if in == nil {
 		return nil
 	}
-	out := new(TmpfsDiskSource)
+	out := new(VirtualMachineImage)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtualMachineImage) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *VirtualMachine) DeepCopyInto(out *VirtualMachine) {
+func (in *VirtualMachineImageList) DeepCopyInto(out *VirtualMachineImageList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
-	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	in.Spec.DeepCopyInto(&out.Spec)
-	in.Status.DeepCopyInto(&out.Status)
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VirtualMachineImage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachine.
-func (in *VirtualMachine) DeepCopy() *VirtualMachine {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineImageList.
+func (in *VirtualMachineImageList) DeepCopy() *VirtualMachineImageList {
 	if in == nil {
 		return nil
 	}
-	out := new(VirtualMachine)
+	out := new(VirtualMachineImageList)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *VirtualMachine) DeepCopyObject() runtime.Object {
+func (in *VirtualMachineImageList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualMachineImageSpec) DeepCopyInto(out *VirtualMachineImageSpec) {
+	*out = *in
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ImagePullSecrets != nil {
+		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineImageSpec.
+func (in *VirtualMachineImageSpec) DeepCopy() *VirtualMachineImageSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachineImageSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualMachineImageStatus) DeepCopyInto(out *VirtualMachineImageStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineImageStatus.
+func (in *VirtualMachineImageStatus) DeepCopy() *VirtualMachineImageStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachineImageStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VirtualMachineList) DeepCopyInto(out *VirtualMachineList) {
 	*out = *in
@@ -648,7 +1526,29 @@ func (in *VirtualMachineMigrationSpec) DeepCopyInto(out *VirtualMachineMigration
 		*out = new(corev1.NodeAffinity)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.TargetNodeSelector != nil {
+		in, out := &in.TargetNodeSelector, &out.TargetNodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.TargetNodeAffinity != nil {
+		in, out := &in.TargetNodeAffinity, &out.TargetNodeAffinity
+		*out = new(corev1.NodeAffinity)
+		(*in).DeepCopyInto(*out)
+	}
 	out.MaxBandwidth = in.MaxBandwidth.DeepCopy()
+	if in.MaxDowntimeMillis != nil {
+		in, out := &in.MaxDowntimeMillis, &out.MaxDowntimeMillis
+		*out = new(int64)
+		**out = **in
+	}
+	if in.Multifd != nil {
+		in, out := &in.Multifd, &out.Multifd
+		*out = new(MultifdSettings)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineMigrationSpec.
@@ -672,6 +1572,15 @@ func (in *VirtualMachineMigrationStatus) DeepCopyInto(out *VirtualMachineMigrati
 		}
 	}
 	out.Info = in.Info
+	if in.Progress != nil {
+		in, out := &in.Progress, &out.Progress
+		*out = new(MigrationProgress)
+		**out = **in
+	}
+	if in.LastFailureTime != nil {
+		in, out := &in.LastFailureTime, &out.LastFailureTime
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineMigrationStatus.
@@ -684,6 +1593,126 @@ func (in *VirtualMachineMigrationStatus) DeepCopy() *VirtualMachineMigrationStat
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualMachinePool) DeepCopyInto(out *VirtualMachinePool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachinePool.
+func (in *VirtualMachinePool) DeepCopy() *VirtualMachinePool {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachinePool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtualMachinePool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualMachinePoolList) DeepCopyInto(out *VirtualMachinePoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VirtualMachinePool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachinePoolList.
+func (in *VirtualMachinePoolList) DeepCopy() *VirtualMachinePoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachinePoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VirtualMachinePoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualMachinePoolSpec) DeepCopyInto(out *VirtualMachinePoolSpec) {
+	*out = *in
+	in.Template.DeepCopyInto(&out.Template)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachinePoolSpec.
+func (in *VirtualMachinePoolSpec) DeepCopy() *VirtualMachinePoolSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachinePoolSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualMachinePoolStatus) DeepCopyInto(out *VirtualMachinePoolStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachinePoolStatus.
+func (in *VirtualMachinePoolStatus) DeepCopy() *VirtualMachinePoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachinePoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VirtualMachinePoolTemplate) DeepCopyInto(out *VirtualMachinePoolTemplate) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachinePoolTemplate.
+func (in *VirtualMachinePoolTemplate) DeepCopy() *VirtualMachinePoolTemplate {
+	if in == nil {
+		return nil
+	}
+	out := new(VirtualMachinePoolTemplate)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VirtualMachineResources) DeepCopyInto(out *VirtualMachineResources) {
 	*out = *in
@@ -730,6 +1759,16 @@ func (in *VirtualMachineSpec) DeepCopyInto(out *VirtualMachineSpec) {
 		}
 	}
 	in.PodResources.DeepCopyInto(&out.PodResources)
+	if in.RuntimeClassName != nil {
+		in, out := &in.RuntimeClassName, &out.RuntimeClassName
+		*out = new(string)
+		**out = **in
+	}
+	if in.EphemeralStorage != nil {
+		in, out := &in.EphemeralStorage, &out.EphemeralStorage
+		*out = new(EphemeralStorage)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.ImagePullSecrets != nil {
 		in, out := &in.ImagePullSecrets, &out.ImagePullSecrets
 		*out = make([]corev1.LocalObjectReference, len(*in))
@@ -760,6 +1799,16 @@ func (in *VirtualMachineSpec) DeepCopyInto(out *VirtualMachineSpec) {
 		*out = new(ExtraNetwork)
 		**out = **in
 	}
+	if in.SRIOVNetwork != nil {
+		in, out := &in.SRIOVNetwork, &out.SRIOVNetwork
+		*out = new(SRIOVNetwork)
+		**out = **in
+	}
+	if in.Network != nil {
+		in, out := &in.Network, &out.Network
+		*out = new(NetworkSettings)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.ServiceLinks != nil {
 		in, out := &in.ServiceLinks, &out.ServiceLinks
 		*out = new(bool)
@@ -800,11 +1849,41 @@ func (in *VirtualMachineSpec) DeepCopyInto(out *VirtualMachineSpec) {
 		*out = new(CpuScalingMode)
 		**out = **in
 	}
+	if in.CPUClass != nil {
+		in, out := &in.CPUClass, &out.CPUClass
+		*out = new(CPUClass)
+		**out = **in
+	}
 	if in.EnableNetworkMonitoring != nil {
 		in, out := &in.EnableNetworkMonitoring, &out.EnableNetworkMonitoring
 		*out = new(bool)
 		**out = **in
 	}
+	if in.EnableFreePageReporting != nil {
+		in, out := &in.EnableFreePageReporting, &out.EnableFreePageReporting
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Entropy != nil {
+		in, out := &in.Entropy, &out.Entropy
+		*out = new(Entropy)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.GuestMetrics != nil {
+		in, out := &in.GuestMetrics, &out.GuestMetrics
+		*out = new(GuestMetrics)
+		**out = **in
+	}
+	if in.Watchdog != nil {
+		in, out := &in.Watchdog, &out.Watchdog
+		*out = new(Watchdog)
+		**out = **in
+	}
+	if in.MachineType != nil {
+		in, out := &in.MachineType, &out.MachineType
+		*out = new(MachineType)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VirtualMachineSpec.
@@ -820,6 +1899,11 @@ func (in *VirtualMachineSpec) DeepCopy() *VirtualMachineSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VirtualMachineStatus) DeepCopyInto(out *VirtualMachineStatus) {
 	*out = *in
+	if in.PodIPs != nil {
+		in, out := &in.PodIPs, &out.PodIPs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]metav1.Condition, len(*in))
@@ -837,6 +1921,21 @@ func (in *VirtualMachineStatus) DeepCopyInto(out *VirtualMachineStatus) {
 		x := (*in).DeepCopy()
 		*out = &x
 	}
+	if in.MemoryBump != nil {
+		in, out := &in.MemoryBump, &out.MemoryBump
+		*out = new(MemoryBump)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RootDisk != nil {
+		in, out := &in.RootDisk, &out.RootDisk
+		*out = new(RootDiskStatus)
+		**out = **in
+	}
+	if in.NetworkLimits != nil {
+		in, out := &in.NetworkLimits, &out.NetworkLimits
+		*out = new(NetworkLimits)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.CurrentRevision != nil {
 		in, out := &in.CurrentRevision, &out.CurrentRevision
 		*out = new(RevisionWithTime)
@@ -878,3 +1977,18 @@ func (in *VirtualMachineUsage) DeepCopy() *VirtualMachineUsage {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Watchdog) DeepCopyInto(out *Watchdog) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Watchdog.
+func (in *Watchdog) DeepCopy() *Watchdog {
+	if in == nil {
+		return nil
+	}
+	out := new(Watchdog)
+	in.DeepCopyInto(out)
+	return out
+}
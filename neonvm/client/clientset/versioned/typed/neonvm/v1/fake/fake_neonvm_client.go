@@ -27,18 +27,38 @@ type FakeNeonvmV1 struct {
 	*testing.Fake
 }
 
+func (c *FakeNeonvmV1) IPAllocations(namespace string) v1.IPAllocationInterface {
+	return &FakeIPAllocations{c, namespace}
+}
+
 func (c *FakeNeonvmV1) IPPools(namespace string) v1.IPPoolInterface {
 	return &FakeIPPools{c, namespace}
 }
 
+func (c *FakeNeonvmV1) ScalingPolicies(namespace string) v1.ScalingPolicyInterface {
+	return &FakeScalingPolicies{c, namespace}
+}
+
 func (c *FakeNeonvmV1) VirtualMachines(namespace string) v1.VirtualMachineInterface {
 	return &FakeVirtualMachines{c, namespace}
 }
 
+func (c *FakeNeonvmV1) VirtualMachineClasses() v1.VirtualMachineClassInterface {
+	return &FakeVirtualMachineClasses{c}
+}
+
+func (c *FakeNeonvmV1) VirtualMachineImages(namespace string) v1.VirtualMachineImageInterface {
+	return &FakeVirtualMachineImages{c, namespace}
+}
+
 func (c *FakeNeonvmV1) VirtualMachineMigrations(namespace string) v1.VirtualMachineMigrationInterface {
 	return &FakeVirtualMachineMigrations{c, namespace}
 }
 
+func (c *FakeNeonvmV1) VirtualMachinePools(namespace string) v1.VirtualMachinePoolInterface {
+	return &FakeVirtualMachinePools{c, namespace}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeNeonvmV1) RESTClient() rest.Interface {
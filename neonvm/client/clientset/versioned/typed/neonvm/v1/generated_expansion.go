@@ -17,8 +17,18 @@ limitations under the License.
 
 package v1
 
+type IPAllocationExpansion interface{}
+
 type IPPoolExpansion interface{}
 
+type ScalingPolicyExpansion interface{}
+
 type VirtualMachineExpansion interface{}
 
+type VirtualMachineClassExpansion interface{}
+
+type VirtualMachineImageExpansion interface{}
+
 type VirtualMachineMigrationExpansion interface{}
+
+type VirtualMachinePoolExpansion interface{}
@@ -27,9 +27,14 @@ import (
 
 type NeonvmV1Interface interface {
 	RESTClient() rest.Interface
+	IPAllocationsGetter
 	IPPoolsGetter
+	ScalingPoliciesGetter
 	VirtualMachinesGetter
+	VirtualMachineClassesGetter
+	VirtualMachineImagesGetter
 	VirtualMachineMigrationsGetter
+	VirtualMachinePoolsGetter
 }
 
 // NeonvmV1Client is used to interact with features provided by the neonvm group.
@@ -37,18 +42,38 @@ type NeonvmV1Client struct {
 	restClient rest.Interface
 }
 
+func (c *NeonvmV1Client) IPAllocations(namespace string) IPAllocationInterface {
+	return newIPAllocations(c, namespace)
+}
+
 func (c *NeonvmV1Client) IPPools(namespace string) IPPoolInterface {
 	return newIPPools(c, namespace)
 }
 
+func (c *NeonvmV1Client) ScalingPolicies(namespace string) ScalingPolicyInterface {
+	return newScalingPolicies(c, namespace)
+}
+
 func (c *NeonvmV1Client) VirtualMachines(namespace string) VirtualMachineInterface {
 	return newVirtualMachines(c, namespace)
 }
 
+func (c *NeonvmV1Client) VirtualMachineClasses() VirtualMachineClassInterface {
+	return newVirtualMachineClasses(c)
+}
+
+func (c *NeonvmV1Client) VirtualMachineImages(namespace string) VirtualMachineImageInterface {
+	return newVirtualMachineImages(c, namespace)
+}
+
 func (c *NeonvmV1Client) VirtualMachineMigrations(namespace string) VirtualMachineMigrationInterface {
 	return newVirtualMachineMigrations(c, namespace)
 }
 
+func (c *NeonvmV1Client) VirtualMachinePools(namespace string) VirtualMachinePoolInterface {
+	return newVirtualMachinePools(c, namespace)
+}
+
 // NewForConfig creates a new NeonvmV1Client for the given config.
 // NewForConfig is equivalent to NewForConfigAndClient(c, httpClient),
 // where httpClient was generated with rest.HTTPClientFor(c).
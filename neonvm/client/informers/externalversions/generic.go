@@ -52,12 +52,22 @@ func (f *genericInformer) Lister() cache.GenericLister {
 func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource) (GenericInformer, error) {
 	switch resource {
 	// Group=neonvm, Version=v1
+	case v1.SchemeGroupVersion.WithResource("ipallocations"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Neonvm().V1().IPAllocations().Informer()}, nil
 	case v1.SchemeGroupVersion.WithResource("ippools"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Neonvm().V1().IPPools().Informer()}, nil
+	case v1.SchemeGroupVersion.WithResource("scalingpolicies"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Neonvm().V1().ScalingPolicies().Informer()}, nil
 	case v1.SchemeGroupVersion.WithResource("virtualmachines"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Neonvm().V1().VirtualMachines().Informer()}, nil
+	case v1.SchemeGroupVersion.WithResource("virtualmachineclasses"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Neonvm().V1().VirtualMachineClasses().Informer()}, nil
+	case v1.SchemeGroupVersion.WithResource("virtualmachineimages"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Neonvm().V1().VirtualMachineImages().Informer()}, nil
 	case v1.SchemeGroupVersion.WithResource("virtualmachinemigrations"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Neonvm().V1().VirtualMachineMigrations().Informer()}, nil
+	case v1.SchemeGroupVersion.WithResource("virtualmachinepools"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Neonvm().V1().VirtualMachinePools().Informer()}, nil
 
 	}
 
@@ -23,12 +23,22 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// IPAllocations returns a IPAllocationInformer.
+	IPAllocations() IPAllocationInformer
 	// IPPools returns a IPPoolInformer.
 	IPPools() IPPoolInformer
+	// ScalingPolicies returns a ScalingPolicyInformer.
+	ScalingPolicies() ScalingPolicyInformer
 	// VirtualMachines returns a VirtualMachineInformer.
 	VirtualMachines() VirtualMachineInformer
+	// VirtualMachineClasses returns a VirtualMachineClassInformer.
+	VirtualMachineClasses() VirtualMachineClassInformer
+	// VirtualMachineImages returns a VirtualMachineImageInformer.
+	VirtualMachineImages() VirtualMachineImageInformer
 	// VirtualMachineMigrations returns a VirtualMachineMigrationInformer.
 	VirtualMachineMigrations() VirtualMachineMigrationInformer
+	// VirtualMachinePools returns a VirtualMachinePoolInformer.
+	VirtualMachinePools() VirtualMachinePoolInformer
 }
 
 type version struct {
@@ -42,17 +52,42 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// IPAllocations returns a IPAllocationInformer.
+func (v *version) IPAllocations() IPAllocationInformer {
+	return &iPAllocationInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
 // IPPools returns a IPPoolInformer.
 func (v *version) IPPools() IPPoolInformer {
 	return &iPPoolInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
 
+// ScalingPolicies returns a ScalingPolicyInformer.
+func (v *version) ScalingPolicies() ScalingPolicyInformer {
+	return &scalingPolicyInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
 // VirtualMachines returns a VirtualMachineInformer.
 func (v *version) VirtualMachines() VirtualMachineInformer {
 	return &virtualMachineInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
 
+// VirtualMachineClasses returns a VirtualMachineClassInformer.
+func (v *version) VirtualMachineClasses() VirtualMachineClassInformer {
+	return &virtualMachineClassInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
+// VirtualMachineImages returns a VirtualMachineImageInformer.
+func (v *version) VirtualMachineImages() VirtualMachineImageInformer {
+	return &virtualMachineImageInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
 // VirtualMachineMigrations returns a VirtualMachineMigrationInformer.
 func (v *version) VirtualMachineMigrations() VirtualMachineMigrationInformer {
 	return &virtualMachineMigrationInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
+
+// VirtualMachinePools returns a VirtualMachinePoolInformer.
+func (v *version) VirtualMachinePools() VirtualMachinePoolInformer {
+	return &virtualMachinePoolInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
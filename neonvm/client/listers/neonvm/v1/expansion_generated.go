@@ -17,6 +17,14 @@ limitations under the License.
 
 package v1
 
+// IPAllocationListerExpansion allows custom methods to be added to
+// IPAllocationLister.
+type IPAllocationListerExpansion interface{}
+
+// IPAllocationNamespaceListerExpansion allows custom methods to be added to
+// IPAllocationNamespaceLister.
+type IPAllocationNamespaceListerExpansion interface{}
+
 // IPPoolListerExpansion allows custom methods to be added to
 // IPPoolLister.
 type IPPoolListerExpansion interface{}
@@ -25,6 +33,14 @@ type IPPoolListerExpansion interface{}
 // IPPoolNamespaceLister.
 type IPPoolNamespaceListerExpansion interface{}
 
+// ScalingPolicyListerExpansion allows custom methods to be added to
+// ScalingPolicyLister.
+type ScalingPolicyListerExpansion interface{}
+
+// ScalingPolicyNamespaceListerExpansion allows custom methods to be added to
+// ScalingPolicyNamespaceLister.
+type ScalingPolicyNamespaceListerExpansion interface{}
+
 // VirtualMachineListerExpansion allows custom methods to be added to
 // VirtualMachineLister.
 type VirtualMachineListerExpansion interface{}
@@ -33,6 +49,18 @@ type VirtualMachineListerExpansion interface{}
 // VirtualMachineNamespaceLister.
 type VirtualMachineNamespaceListerExpansion interface{}
 
+// VirtualMachineClassListerExpansion allows custom methods to be added to
+// VirtualMachineClassLister.
+type VirtualMachineClassListerExpansion interface{}
+
+// VirtualMachineImageListerExpansion allows custom methods to be added to
+// VirtualMachineImageLister.
+type VirtualMachineImageListerExpansion interface{}
+
+// VirtualMachineImageNamespaceListerExpansion allows custom methods to be added to
+// VirtualMachineImageNamespaceLister.
+type VirtualMachineImageNamespaceListerExpansion interface{}
+
 // VirtualMachineMigrationListerExpansion allows custom methods to be added to
 // VirtualMachineMigrationLister.
 type VirtualMachineMigrationListerExpansion interface{}
@@ -40,3 +68,11 @@ type VirtualMachineMigrationListerExpansion interface{}
 // VirtualMachineMigrationNamespaceListerExpansion allows custom methods to be added to
 // VirtualMachineMigrationNamespaceLister.
 type VirtualMachineMigrationNamespaceListerExpansion interface{}
+
+// VirtualMachinePoolListerExpansion allows custom methods to be added to
+// VirtualMachinePoolLister.
+type VirtualMachinePoolListerExpansion interface{}
+
+// VirtualMachinePoolNamespaceListerExpansion allows custom methods to be added to
+// VirtualMachinePoolNamespaceLister.
+type VirtualMachinePoolNamespaceListerExpansion interface{}
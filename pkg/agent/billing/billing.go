@@ -14,6 +14,7 @@ import (
 	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
 	"github.com/neondatabase/autoscaling/pkg/api"
 	"github.com/neondatabase/autoscaling/pkg/reporting"
+	"github.com/neondatabase/autoscaling/pkg/util"
 	"github.com/neondatabase/autoscaling/pkg/util/taskgroup"
 )
 
@@ -65,7 +66,7 @@ type vmMetricsSeconds struct {
 }
 
 type MetricsCollector struct {
-	conf    *Config
+	conf    *util.BroadcastValue[*Config]
 	sink    *reporting.EventSink[*IncrementalEvent]
 	metrics PromMetrics
 }
@@ -85,11 +86,20 @@ func NewMetricsCollector(
 
 	sink := reporting.NewEventSink(logger, metrics.reporting, clients...)
 
-	return &MetricsCollector{
-		conf:    conf,
+	mc := &MetricsCollector{
+		conf:    util.NewBroadcastValue(conf),
 		sink:    sink,
 		metrics: metrics,
-	}, nil
+	}
+	return mc, nil
+}
+
+// UpdateConfig replaces the config used by the MetricsCollector.
+//
+// Changes to the metric names and intervals take effect immediately. Changes to the clients are
+// ignored, because they are only created once, by NewMetricsCollector.
+func (mc *MetricsCollector) UpdateConfig(conf *Config) {
+	mc.conf.Store(conf)
 }
 
 func (mc *MetricsCollector) Run(
@@ -124,11 +134,14 @@ func (mc *MetricsCollector) runCollector(
 	logger *zap.Logger,
 	store VMStoreForNode,
 ) error {
-	collectTicker := time.NewTicker(time.Second * time.Duration(mc.conf.CollectEverySeconds))
+	confUpdated := mc.conf.NewReceiver()
+	conf := confUpdated.Awake()
+
+	collectTicker := time.NewTicker(time.Second * time.Duration(conf.CollectEverySeconds))
 	defer collectTicker.Stop()
 	// Offset by half a second, so it's a bit more deterministic.
 	time.Sleep(500 * time.Millisecond)
-	accumulateTicker := time.NewTicker(time.Second * time.Duration(mc.conf.AccumulateEverySeconds))
+	accumulateTicker := time.NewTicker(time.Second * time.Duration(conf.AccumulateEverySeconds))
 	defer accumulateTicker.Stop()
 
 	state := metricsState{
@@ -152,8 +165,22 @@ func (mc *MetricsCollector) runCollector(
 			state.collect(logger, store, mc.metrics)
 		case <-accumulateTicker.C:
 			logger.Info("Creating billing batch")
-			state.drainEnqueue(logger, mc.conf, GetHostname(), mc.sink)
+			state.drainEnqueue(logger, mc.conf.Load(), GetHostname(), mc.sink)
+		case <-confUpdated.Wait():
+			conf = confUpdated.Awake()
+			logger.Info(
+				"Billing config updated",
+				zap.Uint("collectEverySeconds", conf.CollectEverySeconds),
+				zap.Uint("accumulateEverySeconds", conf.AccumulateEverySeconds),
+			)
+			collectTicker.Reset(time.Second * time.Duration(conf.CollectEverySeconds))
+			accumulateTicker.Reset(time.Second * time.Duration(conf.AccumulateEverySeconds))
 		case <-ctx.Done():
+			// Flush everything we've accumulated so far, so that it's sent by the sink before we
+			// exit, instead of being lost.
+			logger.Info("Creating final billing batch before exiting")
+			state.collect(logger, store, mc.metrics)
+			state.drainEnqueue(logger, mc.conf.Load(), GetHostname(), mc.sink)
 			return nil
 		}
 	}
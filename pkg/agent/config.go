@@ -1,20 +1,30 @@
 package agent
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/prometheus/common/model"
+	"github.com/samber/lo"
 	"github.com/tychoish/fun/erc"
 
 	"github.com/neondatabase/autoscaling/pkg/agent/billing"
+	"github.com/neondatabase/autoscaling/pkg/agent/remotewrite"
 	"github.com/neondatabase/autoscaling/pkg/agent/scalingevents"
 	"github.com/neondatabase/autoscaling/pkg/api"
 	"github.com/neondatabase/autoscaling/pkg/reporting"
+	"github.com/neondatabase/autoscaling/pkg/util"
 )
 
 type Config struct {
 	RefreshStateIntervalSeconds uint `json:"refereshStateIntervalSeconds"`
+	// ShutdownDrainTimeoutSeconds gives the maximum duration, in seconds, that we will wait on
+	// shutdown for billing and scaling events to be flushed and for departing notices to be sent
+	// to the scheduler, before exiting regardless.
+	ShutdownDrainTimeoutSeconds uint `json:"shutdownDrainTimeoutSeconds"`
 
 	Billing       billing.Config       `json:"billing"`
 	ScalingEvents scalingevents.Config `json:"scalingEvents"`
@@ -25,6 +35,17 @@ type Config struct {
 	Monitor   MonitorConfig    `json:"monitor"`
 	NeonVM    NeonVMConfig     `json:"neonvm"`
 	DumpState *DumpStateConfig `json:"dumpState"`
+
+	// Profiling, if provided, enables continuously pushing profiles of the autoscaler-agent
+	Profiling *util.ProfilingConfig `json:"profiling,omitempty"`
+
+	// PPROF, if provided, overrides the default configuration of the pprof server, which otherwise
+	// binds to util.DefaultPPROFAddr with no optional profiles or authentication.
+	PPROF *util.PPROFConfig `json:"pprof,omitempty"`
+
+	// RemoteWrite, if provided, enables periodically pushing the per-VM metrics to a Prometheus
+	// remote-write endpoint
+	RemoteWrite *remotewrite.Config `json:"remoteWrite,omitempty"`
 }
 
 type RateThresholdConfig struct {
@@ -34,12 +55,25 @@ type RateThresholdConfig struct {
 
 type MonitorConfig struct {
 	ResponseTimeoutSeconds uint `json:"responseTimeoutSeconds"`
+	// DownscaleTimeoutSeconds gives the timeout duration, in seconds, for downscale requests to
+	// the vm-monitor, which may take longer than other requests.
+	//
+	// This may be overridden per-VM by the scaling config's monitorDownscaleTimeoutSeconds.
+	DownscaleTimeoutSeconds uint `json:"downscaleTimeoutSeconds"`
 	// ConnectionTimeoutSeconds gives how long we may take to connect to the
 	// monitor before cancelling.
 	ConnectionTimeoutSeconds uint `json:"connectionTimeoutSeconds"`
 	// ConnectionRetryMinWaitSeconds gives the minimum amount of time we must wait between attempts
 	// to connect to the vm-monitor, regardless of whether they're successful.
 	ConnectionRetryMinWaitSeconds uint `json:"connectionRetryMinWaitSeconds"`
+	// CircuitBreakerFailureThreshold gives the number of consecutive failed connections to the
+	// vm-monitor after which we stop retrying at the usual rate, and instead only probe the
+	// connection every CircuitBreakerProbeIntervalSeconds. While this is happening, the VM's
+	// runner is marked as "degraded".
+	CircuitBreakerFailureThreshold uint `json:"circuitBreakerFailureThreshold"`
+	// CircuitBreakerProbeIntervalSeconds gives the minimum amount of time we must wait between
+	// attempts to connect to the vm-monitor, once CircuitBreakerFailureThreshold is reached.
+	CircuitBreakerProbeIntervalSeconds uint `json:"circuitBreakerProbeIntervalSeconds"`
 	// ServerPort is the port that the dispatcher serves from
 	ServerPort uint16 `json:"serverPort"`
 	// UnhealthyAfterSilenceDurationSeconds gives the duration, in seconds, after which failing to
@@ -65,6 +99,10 @@ type MonitorConfig struct {
 	// RequestedUpscaleValidSeconds gives the duration, in seconds, that requested upscaling should
 	// be respected for, before allowing re-downscaling.
 	RequestedUpscaleValidSeconds uint `json:"requestedUpscaleValidSeconds"`
+	// StrictMessageValidation, if true, checks all messages received from the vm-monitor against
+	// the published schemas for the protocol (see pkg/api/schemas), treating messages with unknown
+	// or missing fields as invalid instead of decoding them on a best-effort basis.
+	StrictMessageValidation bool `json:"strictMessageValidation"`
 }
 
 // DumpStateConfig configures the endpoint to dump all internal state
@@ -81,15 +119,26 @@ type ScalingConfig struct {
 	// ComputeUnit is the desired ratio between CPU and memory that the autoscaler-agent should
 	// uphold when making changes to a VM
 	ComputeUnit api.Resources `json:"computeUnit"`
+	// ComputeUnitFile, if provided, gives the path to a JSON file with the compute unit, in the
+	// same format as ComputeUnit. This allows sharing a single per-cluster definition with the
+	// scheduler plugin and NeonVM controller. If set, ComputeUnit must be omitted.
+	ComputeUnitFile string `json:"computeUnitFile,omitempty"`
 	// DefaultConfig gives the default scaling config, to be used if there is no configuration
 	// supplied with the "autoscaling.neon.tech/config" annotation.
 	DefaultConfig api.ScalingConfig `json:"defaultConfig"`
+	// ShadowConfig, if provided, gives overrides applied on top of each VM's scaling config to
+	// calculate a "shadow" goal CU, which is exported as metrics alongside the active goal CU but
+	// never acted upon. This allows evaluating changes to the scaling algorithm on real traffic.
+	ShadowConfig *api.ScalingConfig `json:"shadowConfig,omitempty"`
 }
 
 // MetricsConfig defines a few parameters for metrics requests to the VM
 type MetricsConfig struct {
 	System MetricsSourceConfig `json:"system"`
 	LFC    MetricsSourceConfig `json:"lfc"`
+	// Connections configures fetching metrics about Postgres connections, which are typically
+	// provided by the same sql_exporter as the LFC metrics.
+	Connections MetricsSourceConfig `json:"connections"`
 }
 
 type MetricsSourceConfig struct {
@@ -111,7 +160,8 @@ type SchedulerConfig struct {
 	SchedulerName string `json:"schedulerName"`
 	// RequestTimeoutSeconds gives the timeout duration, in seconds, for requests to the scheduler
 	//
-	// If zero, requests will have no timeout.
+	// If zero, requests will have no timeout. This may be overridden per-VM by the scaling config's
+	// schedulerRequestTimeoutSeconds.
 	RequestTimeoutSeconds uint `json:"requestTimeoutSeconds"`
 	// RequestAtLeastEverySeconds gives the maximum duration we should go without attempting a
 	// request to the scheduler, even if nothing's changed.
@@ -127,6 +177,20 @@ type SchedulerConfig struct {
 	// MaxFailedRequestRate defines the maximum rate of failed scheduler requests, above which
 	// a VM is considered stuck.
 	MaxFailedRequestRate RateThresholdConfig `json:"maxFailedRequestRate"`
+	// EnableProtobuf, if true, sends requests to the scheduler encoded as protobuf rather than
+	// JSON, which is cheaper to encode and decode.
+	//
+	// This requires that the scheduler plugin supports protobuf-encoded requests.
+	EnableProtobuf bool `json:"enableProtobuf"`
+	// HandshakeIntervalSeconds gives the duration, in seconds, between handshakes sent to the
+	// scheduler plugin's /agent-handshake endpoint, which the plugin uses to track which
+	// autoscaler-agents are still alive.
+	//
+	// If zero, no handshakes will be sent.
+	HandshakeIntervalSeconds uint `json:"handshakeIntervalSeconds"`
+	// RequestRateLimit, if provided, limits the rate of resource requests to the scheduler plugin
+	// across all VMs on the node. Requests over the limit are delayed, not dropped.
+	RequestRateLimit *util.RateLimitConfig `json:"requestRateLimit,omitempty"`
 }
 
 // NeonVMConfig defines a few parameters for NeonVM requests
@@ -143,26 +207,55 @@ type NeonVMConfig struct {
 }
 
 func ReadConfig(path string) (*Config, error) {
-	file, err := os.Open(path)
+	content, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("Error opening config file %q: %w", path, err)
+		return nil, fmt.Errorf("Error reading config file %q: %w", path, err)
 	}
 
-	defer file.Close()
+	return parseConfig(path, content)
+}
+
+func parseConfig(path string, content []byte) (*Config, error) {
 	var config Config
-	jsonDecoder := json.NewDecoder(file)
+	jsonDecoder := json.NewDecoder(bytes.NewReader(content))
 	jsonDecoder.DisallowUnknownFields()
-	if err = jsonDecoder.Decode(&config); err != nil {
+	if err := jsonDecoder.Decode(&config); err != nil {
 		return nil, fmt.Errorf("Error decoding JSON config in %q: %w", path, err)
 	}
 
-	if err = config.validate(); err != nil {
+	if file := config.Scaling.ComputeUnitFile; file != "" {
+		if config.Scaling.ComputeUnit != (api.Resources{VCPU: 0, Mem: 0}) {
+			return nil, errors.New("Invalid config: fields \".scaling.computeUnit\" and \".scaling.computeUnitFile\" cannot both be set")
+		}
+		cu, err := api.ReadComputeUnitFile(file)
+		if err != nil {
+			return nil, err
+		}
+		config.Scaling.ComputeUnit = cu
+	}
+
+	if err := config.validate(); err != nil {
 		return nil, fmt.Errorf("Invalid config: %w", err)
 	}
 
 	return &config, nil
 }
 
+// Redacted returns a copy of the config with secret values replaced, so that it can be logged.
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	if c.RemoteWrite != nil {
+		remoteWrite := *c.RemoteWrite
+		remoteWrite.Headers = lo.MapValues(remoteWrite.Headers, func(string, string) string {
+			return redactedValue
+		})
+		redacted.RemoteWrite = &remoteWrite
+	}
+	return &redacted
+}
+
+const redactedValue = "<redacted>"
+
 func (c *Config) validate() error {
 	ec := &erc.Collector{}
 
@@ -218,9 +311,35 @@ func (c *Config) validate() error {
 		erc.Whenf(ec, c.ScalingEvents.Clients.S3.PrefixInBucket == "", emptyTmpl, ".scalingEvents.clients.s3.prefixInBucket")
 	}
 
+	erc.Whenf(ec, c.ShutdownDrainTimeoutSeconds == 0, zeroTmpl, ".shutdownDrainTimeoutSeconds")
+
 	erc.Whenf(ec, c.DumpState != nil && c.DumpState.Port == 0, zeroTmpl, ".dumpState.port")
 	erc.Whenf(ec, c.DumpState != nil && c.DumpState.TimeoutSeconds == 0, zeroTmpl, ".dumpState.timeoutSeconds")
 
+	erc.Whenf(ec, c.Profiling != nil && c.Profiling.ServerURL == "", emptyTmpl, ".profiling.serverURL")
+	erc.Whenf(ec, c.Profiling != nil && c.Profiling.ApplicationName == "", emptyTmpl, ".profiling.applicationName")
+	erc.Whenf(ec, c.Profiling != nil && c.Profiling.UploadIntervalSeconds == 0, zeroTmpl, ".profiling.uploadIntervalSeconds")
+
+	if c.PPROF != nil {
+		erc.Whenf(ec, c.PPROF.Addr == "", emptyTmpl, ".pprof.addr")
+		erc.Whenf(ec, c.PPROF.MutexProfileFraction < 0, "field %q must be >= 0", ".pprof.mutexProfileFraction")
+		erc.Whenf(ec, c.PPROF.BlockProfileRate < 0, "field %q must be >= 0", ".pprof.blockProfileRate")
+		erc.Whenf(ec, c.PPROF.BasicAuth != nil && c.PPROF.BasicAuth.Username == "", emptyTmpl, ".pprof.basicAuth.username")
+		erc.Whenf(ec, c.PPROF.BasicAuth != nil && c.PPROF.BasicAuth.PasswordFile == "", emptyTmpl, ".pprof.basicAuth.passwordFile")
+	}
+
+	if c.RemoteWrite != nil {
+		erc.Whenf(ec, c.RemoteWrite.URL == "", emptyTmpl, ".remoteWrite.url")
+		erc.Whenf(ec, c.RemoteWrite.PushIntervalSeconds == 0, zeroTmpl, ".remoteWrite.pushIntervalSeconds")
+		erc.Whenf(ec, c.RemoteWrite.RequestTimeoutSeconds == 0, zeroTmpl, ".remoteWrite.requestTimeoutSeconds")
+		for name := range c.RemoteWrite.ExtraLabels {
+			erc.Whenf(
+				ec, !model.LabelName(name).IsValid() || name == model.MetricNameLabel,
+				"field %q has invalid label name %q", ".remoteWrite.extraLabels", name,
+			)
+		}
+	}
+
 	validateMetricsConfig := func(cfg MetricsSourceConfig, key string) {
 		erc.Whenf(ec, cfg.Port == 0, zeroTmpl, fmt.Sprintf(".metrics.%s.port", key))
 		erc.Whenf(ec, cfg.RequestTimeoutSeconds == 0, zeroTmpl, fmt.Sprintf(".metrics.%s.requestTimeoutSeconds", key))
@@ -228,14 +347,18 @@ func (c *Config) validate() error {
 	}
 	validateMetricsConfig(c.Metrics.System, "system")
 	validateMetricsConfig(c.Metrics.LFC, "lfc")
+	validateMetricsConfig(c.Metrics.Connections, "connections")
 	erc.Whenf(ec, c.Scaling.ComputeUnit.VCPU == 0, zeroTmpl, ".scaling.computeUnit.vCPUs")
 	erc.Whenf(ec, c.Scaling.ComputeUnit.Mem == 0, zeroTmpl, ".scaling.computeUnit.mem")
 	erc.Whenf(ec, c.NeonVM.RequestTimeoutSeconds == 0, zeroTmpl, ".scaling.requestTimeoutSeconds")
 	erc.Whenf(ec, c.NeonVM.RetryFailedRequestSeconds == 0, zeroTmpl, ".scaling.retryFailedRequestSeconds")
 	erc.Whenf(ec, c.NeonVM.MaxFailedRequestRate.IntervalSeconds == 0, zeroTmpl, ".neonvm.maxFailedRequestRate.intervalSeconds")
 	erc.Whenf(ec, c.Monitor.ResponseTimeoutSeconds == 0, zeroTmpl, ".monitor.responseTimeoutSeconds")
+	erc.Whenf(ec, c.Monitor.DownscaleTimeoutSeconds == 0, zeroTmpl, ".monitor.downscaleTimeoutSeconds")
 	erc.Whenf(ec, c.Monitor.ConnectionTimeoutSeconds == 0, zeroTmpl, ".monitor.connectionTimeoutSeconds")
 	erc.Whenf(ec, c.Monitor.ConnectionRetryMinWaitSeconds == 0, zeroTmpl, ".monitor.connectionRetryMinWaitSeconds")
+	erc.Whenf(ec, c.Monitor.CircuitBreakerFailureThreshold == 0, zeroTmpl, ".monitor.circuitBreakerFailureThreshold")
+	erc.Whenf(ec, c.Monitor.CircuitBreakerProbeIntervalSeconds == 0, zeroTmpl, ".monitor.circuitBreakerProbeIntervalSeconds")
 	erc.Whenf(ec, c.Monitor.ServerPort == 0, zeroTmpl, ".monitor.serverPort")
 	erc.Whenf(ec, c.Monitor.UnhealthyAfterSilenceDurationSeconds == 0, zeroTmpl, ".monitor.unhealthyAfterSilenceDurationSeconds")
 	erc.Whenf(ec, c.Monitor.UnhealthyStartupGracePeriodSeconds == 0, zeroTmpl, ".monitor.unhealthyStartupGracePeriodSeconds")
@@ -246,12 +369,16 @@ func (c *Config) validate() error {
 	erc.Whenf(ec, c.Monitor.MaxFailedRequestRate.IntervalSeconds == 0, zeroTmpl, ".monitor.maxFailedRequestRate.intervalSeconds")
 	// add all errors if there are any: https://github.com/neondatabase/autoscaling/pull/195#discussion_r1170893494
 	ec.Add(c.Scaling.DefaultConfig.ValidateDefaults())
+	if c.Scaling.ShadowConfig != nil {
+		ec.Add(c.Scaling.ShadowConfig.ValidateOverrides())
+	}
 	erc.Whenf(ec, c.Scheduler.RequestPort == 0, zeroTmpl, ".scheduler.requestPort")
 	erc.Whenf(ec, c.Scheduler.RequestTimeoutSeconds == 0, zeroTmpl, ".scheduler.requestTimeoutSeconds")
 	erc.Whenf(ec, c.Scheduler.RequestAtLeastEverySeconds == 0, zeroTmpl, ".scheduler.requestAtLeastEverySeconds")
 	erc.Whenf(ec, c.Scheduler.RetryFailedRequestSeconds == 0, zeroTmpl, ".scheduler.retryFailedRequestSeconds")
 	erc.Whenf(ec, c.Scheduler.RetryDeniedUpscaleSeconds == 0, zeroTmpl, ".scheduler.retryDeniedUpscaleSeconds")
 	erc.Whenf(ec, c.Scheduler.SchedulerName == "", emptyTmpl, ".scheduler.schedulerName")
+	erc.Whenf(ec, c.Scheduler.RequestRateLimit != nil && c.Scheduler.RequestRateLimit.Rate < 0, "field %q must be >= 0", ".scheduler.requestRateLimit.rate")
 	erc.Whenf(ec, c.Scheduler.MaxFailedRequestRate.IntervalSeconds == 0, zeroTmpl, ".monitor.maxFailedRequestRate.intervalSeconds")
 
 	return ec.Resolve()
@@ -0,0 +1,184 @@
+package agent
+
+// Reloading the autoscaler-agent config when the file changes, without restarting.
+//
+// The config file is typically mounted from a ConfigMap, which kubernetes updates by atomically
+// swapping a symlink. We don't rely on filesystem notifications for that; we just periodically
+// re-read the file and check whether the contents have changed.
+//
+// Most settings are read from the current config each time they're used, so changes take effect
+// immediately. Settings that are used to set up long-lived components at startup (e.g. the billing
+// clients) cannot be changed this way; changes to those are ignored with a warning, and require
+// restarting the autoscaler-agent.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+)
+
+// configReloadInterval is the period at which we check whether the config file has changed.
+const configReloadInterval = 10 * time.Second
+
+// watchConfigFile periodically re-reads the config file at path, calling onChange with the new
+// config each time its contents change and it's valid, until the context is canceled.
+//
+// Invalid configs are logged and otherwise ignored, so the previous config remains in effect.
+func watchConfigFile(
+	ctx context.Context,
+	logger *zap.Logger,
+	path string,
+	current *Config,
+	onChange func(*Config),
+) {
+	lastContent, err := os.ReadFile(path)
+	if err != nil {
+		// Not fatal -- we'll just treat the next successful read as a change.
+		logger.Warn("Failed to read config file", zap.String("path", path), zap.Error(err))
+	}
+
+	ticker := time.NewTicker(configReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			logger.Warn("Failed to read config file", zap.String("path", path), zap.Error(err))
+			continue
+		} else if bytes.Equal(content, lastContent) {
+			continue
+		}
+		lastContent = content
+
+		logger.Info("Config file changed, reloading", zap.String("path", path))
+		if newConfig := reloadConfig(logger, path, content, current); newConfig != nil {
+			onChange(newConfig)
+			current = newConfig
+		}
+	}
+}
+
+// reloadConfig parses the new contents of the config file, returning the config to apply instead
+// of current, or nil if the new config is invalid.
+//
+// Only the changes from the current config are logged, with secrets redacted.
+func reloadConfig(logger *zap.Logger, path string, content []byte, current *Config) *Config {
+	newConfig, err := parseConfig(path, content)
+	if err != nil {
+		logger.Error("Failed to reload config, keeping previous config", zap.Error(err))
+		return nil
+	}
+
+	if ignored := keepRestartRequiredFields(current, newConfig); len(ignored) != 0 {
+		logger.Warn(
+			"Ignoring changes to config fields that require restarting the autoscaler-agent",
+			zap.Strings("fields", ignored),
+		)
+	}
+
+	changes, err := configDiff(current, newConfig)
+	if err != nil {
+		// Only used for logging, so not worth rejecting the config over.
+		logger.Warn("Failed to compare reloaded config with previous config", zap.Error(err))
+	}
+	logger.Info("Applying reloaded config", zap.Strings("changes", changes))
+	return newConfig
+}
+
+// configDiff returns a description of each field that differs between the configs, in the form
+// "<path>: <old> -> <new>", using the redacted configs so that secrets are not included.
+func configDiff(oldConfig, newConfig *Config) ([]string, error) {
+	oldValue, err := jsonValue(oldConfig.Redacted())
+	if err != nil {
+		return nil, err
+	}
+	newValue, err := jsonValue(newConfig.Redacted())
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []string
+	diffJSONValues(&changes, "", oldValue, newValue)
+	return changes, nil
+}
+
+// jsonValue returns the generic JSON representation of v, as decoded by encoding/json into an
+// 'any'
+func jsonValue(v any) (any, error) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	if err := json.Unmarshal(content, &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func diffJSONValues(changes *[]string, path string, oldValue, newValue any) {
+	oldObj, oldIsObj := oldValue.(map[string]any)
+	newObj, newIsObj := newValue.(map[string]any)
+	if oldIsObj && newIsObj {
+		keys := lo.Union(lo.Keys(oldObj), lo.Keys(newObj))
+		slices.Sort(keys)
+		for _, k := range keys {
+			diffJSONValues(changes, path+"."+k, oldObj[k], newObj[k])
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		// Values were decoded from JSON, so they can always be encoded again.
+		oldJSON, _ := json.Marshal(oldValue)
+		newJSON, _ := json.Marshal(newValue)
+		*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", path, oldJSON, newJSON))
+	}
+}
+
+// keepRestartRequiredFields resets any fields in newConfig that cannot be changed without
+// restarting back to their values in oldConfig, returning the names of the fields that were
+// changed.
+func keepRestartRequiredFields(oldConfig, newConfig *Config) []string {
+	var changed []string
+
+	keepField(&changed, ".billing.clients", oldConfig.Billing.Clients, &newConfig.Billing.Clients)
+	keepField(&changed, ".scalingEvents", oldConfig.ScalingEvents, &newConfig.ScalingEvents)
+	keepField(&changed, ".scaling.computeUnit", oldConfig.Scaling.ComputeUnit, &newConfig.Scaling.ComputeUnit)
+	keepField(&changed, ".scheduler.schedulerName", oldConfig.Scheduler.SchedulerName, &newConfig.Scheduler.SchedulerName)
+	keepField(&changed, ".scheduler.requestPort", oldConfig.Scheduler.RequestPort, &newConfig.Scheduler.RequestPort)
+	keepField(&changed, ".dumpState", oldConfig.DumpState, &newConfig.DumpState)
+	keepField(&changed, ".profiling", oldConfig.Profiling, &newConfig.Profiling)
+	keepField(&changed, ".remoteWrite", oldConfig.RemoteWrite, &newConfig.RemoteWrite)
+	keepField(&changed, ".shutdownDrainTimeoutSeconds", oldConfig.ShutdownDrainTimeoutSeconds, &newConfig.ShutdownDrainTimeoutSeconds)
+
+	return changed
+}
+
+func keepField[T any](changed *[]string, name string, oldValue T, newValue *T) {
+	if !reflect.DeepEqual(oldValue, *newValue) {
+		*changed = append(*changed, name)
+		*newValue = oldValue
+	}
+}
+
+// UpdateConfig replaces the current config, notifying all Runners so that they update their
+// executors with the new settings.
+func (s *agentState) UpdateConfig(config *Config) {
+	s.config.Store(config)
+	s.schedulerRequestLimiter.SetConfig(lo.FromPtr(config.Scheduler.RequestRateLimit))
+}
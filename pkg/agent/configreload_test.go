@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+const secretHeader = "Bearer SECRET"
+
+// testConfigJSON is the config from autoscaler-agent/config_map.yaml, with remote-write enabled.
+const testConfigJSON = `{
+  "refereshStateIntervalSeconds": 5,
+  "shutdownDrainTimeoutSeconds": 20,
+  "scaling": {
+    "computeUnit": {
+      "vCPUs": 0.25,
+      "mem": "1Gi"
+    },
+    "defaultConfig": {
+      "loadAverageFractionTarget": 0.9,
+      "memoryUsageFractionTarget": 0.75,
+      "memoryTotalFractionTarget": 0.9,
+      "enableLFCMetrics": false,
+      "lfcUseLargestWindow": false,
+      "lfcToMemoryRatio": 0.75,
+      "lfcWindowSizeMinutes": 5,
+      "lfcMinWaitBeforeDownscaleMinutes": 5,
+      "enableConnectionMetrics": false,
+      "memoryPerConnection": "10Mi",
+      "goalCombination": "max",
+      "goalWeights": {
+        "cpu": 1,
+        "mem": 1,
+        "lfc": 1,
+        "connections": 1
+      },
+      "cpuStableZoneRatio": 0,
+      "cpuMixedZoneRatio": 0
+    }
+  },
+  "billing": {
+    "cpuMetricName": "effective_compute_seconds",
+    "activeTimeMetricName": "active_time_seconds",
+    "collectEverySeconds": 4,
+    "accumulateEverySeconds": 24,
+    "clients": {}
+  },
+  "scalingEvents": {
+    "cuMultiplier": 0.25,
+    "rereportThreshold": 0.25,
+    "regionName": "replaceme",
+    "clients": {}
+  },
+  "monitor": {
+    "serverPort": 10301,
+    "responseTimeoutSeconds": 5,
+    "downscaleTimeoutSeconds": 5,
+    "connectionTimeoutSeconds": 4,
+    "connectionRetryMinWaitSeconds": 5,
+    "circuitBreakerFailureThreshold": 5,
+    "circuitBreakerProbeIntervalSeconds": 60,
+    "unhealthyAfterSilenceDurationSeconds": 20,
+    "unhealthyStartupGracePeriodSeconds": 20,
+    "maxHealthCheckSequentialFailuresSeconds": 30,
+    "retryDeniedDownscaleSeconds": 5,
+    "requestedUpscaleValidSeconds": 10,
+    "retryFailedRequestSeconds": 3,
+    "strictMessageValidation": false,
+    "maxFailedRequestRate": {
+      "intervalSeconds": 120,
+      "threshold": 2
+    }
+  },
+  "metrics": {
+    "system": {
+      "port": 9100,
+      "requestTimeoutSeconds": 2,
+      "secondsBetweenRequests": 5
+    },
+    "lfc": {
+      "port": 9499,
+      "requestTimeoutSeconds": 5,
+      "secondsBetweenRequests": 15
+    },
+    "connections": {
+      "port": 9499,
+      "requestTimeoutSeconds": 5,
+      "secondsBetweenRequests": 15
+    }
+  },
+  "scheduler": {
+    "schedulerName": "autoscale-scheduler",
+    "requestTimeoutSeconds": 2,
+    "requestAtLeastEverySeconds": 15,
+    "retryFailedRequestSeconds": 3,
+    "retryDeniedUpscaleSeconds": 2,
+    "requestPort": 10299,
+    "enableProtobuf": false,
+    "handshakeIntervalSeconds": 15,
+    "maxFailedRequestRate": {
+      "intervalSeconds": 120,
+      "threshold": 5
+    }
+  },
+  "dumpState": {
+    "port": 10300,
+    "timeoutSeconds": 5
+  },
+  "neonvm": {
+    "requestTimeoutSeconds": 10,
+    "retryFailedRequestSeconds": 5,
+    "maxFailedRequestRate": {
+      "intervalSeconds": 120,
+      "threshold": 2
+    }
+  },
+  "remoteWrite": {
+    "url": "http://localhost:9090/api/v1/write",
+    "pushIntervalSeconds": 15,
+    "requestTimeoutSeconds": 5,
+    "headers": {
+      "Authorization": "Bearer SECRET"
+    }
+  }
+}`
+
+// editTestConfig returns the test config with the changes made by edit applied, as JSON
+func editTestConfig(t *testing.T, edit func(map[string]any)) []byte {
+	var config map[string]any
+	require.NoError(t, json.Unmarshal([]byte(testConfigJSON), &config))
+	edit(config)
+	content, err := json.Marshal(config)
+	require.NoError(t, err)
+	return content
+}
+
+func TestConfigRedacted(t *testing.T) {
+	config, err := parseConfig("config.json", []byte(testConfigJSON))
+	require.NoError(t, err)
+
+	redacted := config.Redacted()
+	assert.Equal(t, map[string]string{"Authorization": redactedValue}, redacted.RemoteWrite.Headers)
+	// the original must not be modified
+	assert.Equal(t, map[string]string{"Authorization": secretHeader}, config.RemoteWrite.Headers)
+
+	content, err := json.Marshal(redacted)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), secretHeader)
+}
+
+func TestConfigDiff(t *testing.T) {
+	oldConfig, err := parseConfig("config.json", []byte(testConfigJSON))
+	require.NoError(t, err)
+	newConfig, err := parseConfig("config.json", editTestConfig(t, func(c map[string]any) {
+		c["billing"].(map[string]any)["collectEverySeconds"] = 8
+		c["scheduler"].(map[string]any)["requestRateLimit"] = map[string]any{"rate": 10, "burst": 20}
+		c["remoteWrite"].(map[string]any)["headers"] = map[string]any{"Authorization": "Bearer OTHER-SECRET"}
+	}))
+	require.NoError(t, err)
+
+	changes, err := configDiff(oldConfig, newConfig)
+	require.NoError(t, err)
+	// Keys are sorted, and the changed header isn't included because both values are redacted.
+	assert.Equal(t, []string{
+		".billing.collectEverySeconds: 4 -> 8",
+		`.scheduler.requestRateLimit: null -> {"burst":20,"rate":10}`,
+	}, changes)
+
+	changes, err = configDiff(oldConfig, oldConfig)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
+
+func TestReloadConfig(t *testing.T) {
+	current, err := parseConfig("config.json", []byte(testConfigJSON))
+	require.NoError(t, err)
+
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zap.New(core)
+
+	t.Run("Invalid", func(t *testing.T) {
+		newConfig := reloadConfig(logger, "config.json", []byte("{"), current)
+		assert.Nil(t, newConfig)
+
+		newConfig = reloadConfig(logger, "config.json", editTestConfig(t, func(c map[string]any) {
+			c["shutdownDrainTimeoutSeconds"] = 0
+		}), current)
+		assert.Nil(t, newConfig)
+	})
+
+	t.Run("Valid", func(t *testing.T) {
+		newConfig := reloadConfig(logger, "config.json", editTestConfig(t, func(c map[string]any) {
+			c["billing"].(map[string]any)["accumulateEverySeconds"] = 48
+			// requires restarting, so should be ignored:
+			c["remoteWrite"].(map[string]any)["url"] = "http://example.com"
+			c["remoteWrite"].(map[string]any)["headers"] = map[string]any{"Authorization": "Bearer OTHER-SECRET"}
+		}), current)
+		require.NotNil(t, newConfig)
+
+		assert.Equal(t, uint(48), newConfig.Billing.AccumulateEverySeconds)
+		assert.Equal(t, current.RemoteWrite, newConfig.RemoteWrite)
+
+		applied := logs.FilterMessage("Applying reloaded config").All()
+		require.Len(t, applied, 1)
+		assert.Equal(t, []any{".billing.accumulateEverySeconds: 24 -> 48"}, applied[0].ContextMap()["changes"])
+	})
+
+	for _, entry := range logs.All() {
+		for _, value := range entry.ContextMap() {
+			content, err := json.Marshal(value)
+			require.NoError(t, err)
+			assert.False(t, strings.Contains(string(content), "SECRET"), "secret in log message %q", entry.Message)
+		}
+	}
+}
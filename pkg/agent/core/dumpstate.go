@@ -4,6 +4,7 @@ package core
 
 import (
 	"encoding/json"
+	"slices"
 	"time"
 
 	"github.com/neondatabase/autoscaling/pkg/api"
@@ -41,6 +42,8 @@ func (s *State) Dump() StateDump {
 			NeonVM:               s.internal.NeonVM.deepCopy(),
 			Metrics:              shallowCopy[SystemMetrics](s.internal.Metrics),
 			LFCMetrics:           shallowCopy[LFCMetrics](s.internal.LFCMetrics),
+			ConnectionMetrics:    shallowCopy[ConnectionMetrics](s.internal.ConnectionMetrics),
+			RecentGoalCUs:        slices.Clone(s.internal.RecentGoalCUs),
 			TargetRevision:       s.internal.TargetRevision,
 			LastDesiredResources: s.internal.LastDesiredResources,
 		},
@@ -52,6 +55,7 @@ func (s *pluginState) deepCopy() pluginState {
 		OngoingRequest:  s.OngoingRequest,
 		LastRequest:     shallowCopy[pluginRequested](s.LastRequest),
 		LastFailureAt:   shallowCopy[time.Time](s.LastFailureAt),
+		RetryAfter:      shallowCopy[time.Time](s.RetryAfter),
 		Permit:          shallowCopy[api.Resources](s.Permit),
 		CurrentRevision: s.CurrentRevision,
 	}
@@ -3,6 +3,7 @@ package core
 // extracted components of how "goal CU" is determined
 
 import (
+	"fmt"
 	"math"
 
 	"github.com/samber/lo"
@@ -22,14 +23,59 @@ type ScalingGoalParts struct {
 	CPU *float64
 	Mem *float64
 	LFC *float64
+
+	Connections *float64
 }
 
-func (g *ScalingGoal) GoalCU() uint32 {
-	return uint32(math.Ceil(max(
-		math.Round(lo.FromPtr(g.Parts.CPU)), // for historical compatibility, use round() instead of ceil()
-		lo.FromPtr(g.Parts.Mem),
-		lo.FromPtr(g.Parts.LFC),
-	)))
+// GoalCU combines the goal CU from each part, according to the config's GoalCombination and
+// GoalWeights.
+//
+// Goals of at least one CU are rounded up to a whole number of CUs. Smaller goals are rounded up
+// to the nearest milli-CU instead, so that VMs with bounds below one CU can scale within them.
+func (g *ScalingGoal) GoalCU(cfg api.ScalingConfig) api.ComputeUnits {
+	cpu := g.Parts.CPU
+	if cpu != nil {
+		cpu = lo.ToPtr(math.Round(*cpu)) // for historical compatibility, use round() instead of ceil()
+	}
+
+	weights := *cfg.GoalWeights
+	parts := []struct {
+		weight float64
+		value  *float64
+	}{
+		{weights.CPU, cpu},
+		{weights.Mem, g.Parts.Mem},
+		{weights.LFC, g.Parts.LFC},
+		{weights.Connections, g.Parts.Connections},
+	}
+
+	var goal float64
+	switch *cfg.GoalCombination {
+	case api.GoalCombinationWeightedAverage:
+		var sum, totalWeight float64
+		for _, p := range parts {
+			if p.value != nil {
+				sum += p.weight * *p.value
+				totalWeight += p.weight
+			}
+		}
+		if totalWeight != 0 {
+			goal = sum / totalWeight
+		}
+	case api.GoalCombinationMax:
+		for _, p := range parts {
+			if p.value != nil {
+				goal = max(goal, p.weight*(*p.value))
+			}
+		}
+	default:
+		panic(fmt.Sprintf("unknown goal combination %q", *cfg.GoalCombination))
+	}
+
+	if goal >= 1 {
+		return api.WholeComputeUnits(uint32(math.Ceil(goal)))
+	}
+	return api.ComputeUnitsFromFloat64(goal)
 }
 
 func calculateGoalCU(
@@ -38,8 +84,11 @@ func calculateGoalCU(
 	computeUnit api.Resources,
 	systemMetrics *SystemMetrics,
 	lfcMetrics *LFCMetrics,
+	connMetrics *ConnectionMetrics,
 ) (ScalingGoal, []zap.Field) {
-	hasAllMetrics := systemMetrics != nil && (!*cfg.EnableLFCMetrics || lfcMetrics != nil)
+	hasAllMetrics := systemMetrics != nil &&
+		(!*cfg.EnableLFCMetrics || lfcMetrics != nil) &&
+		(!*cfg.EnableConnectionMetrics || connMetrics != nil)
 	if !hasAllMetrics {
 		warn("Making scaling decision without all required metrics available")
 	}
@@ -67,6 +116,11 @@ func calculateGoalCU(
 		parts.Mem = lo.ToPtr(memGoalCU)
 	}
 
+	if connMetrics != nil {
+		connGoalCU := calculateConnectionsGoalCU(cfg, computeUnit, *connMetrics)
+		parts.Connections = lo.ToPtr(connGoalCU)
+	}
+
 	if systemMetrics != nil && wss != nil {
 		memTotalGoalCU := calculateMemTotalGoalCU(cfg, computeUnit, *systemMetrics, *wss)
 		parts.Mem = lo.ToPtr(max(*parts.Mem, memTotalGoalCU))
@@ -137,6 +191,24 @@ func calculateMemTotalGoalCU(
 	return totalGoalBytes / float64(computeUnit.Mem)
 }
 
+// For connections:
+// Goal compute unit is the larger of the CU required to fit (connections) × (MemoryPerConnection)
+// into memory, and the CU where (CPUs) × (LoadAverageFractionTarget) == (active backends),
+// similar to load average.
+func calculateConnectionsGoalCU(
+	cfg api.ScalingConfig,
+	computeUnit api.Resources,
+	connMetrics ConnectionMetrics,
+) float64 {
+	memGoalBytes := connMetrics.TotalConnections * cfg.MemoryPerConnection.AsFloat64()
+	memGoalCU := memGoalBytes / computeUnit.Mem.AsFloat64()
+
+	goalCPUs := connMetrics.ActiveBackends / *cfg.LoadAverageFractionTarget
+	cpuGoalCU := goalCPUs / computeUnit.VCPU.AsFloat64()
+
+	return max(memGoalCU, cpuGoalCU)
+}
+
 func calculateLFCGoalCU(
 	warn func(string),
 	cfg api.ScalingConfig,
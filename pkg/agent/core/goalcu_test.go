@@ -22,6 +22,17 @@ func Test_calculateGoalCU(t *testing.T) {
 		LFCToMemoryRatio:                 lo.ToPtr(0.75),
 		LFCWindowSizeMinutes:             lo.ToPtr(5),
 		LFCMinWaitBeforeDownscaleMinutes: lo.ToPtr(5),
+		EnableConnectionMetrics:          lo.ToPtr(false),
+		MemoryPerConnection:              lo.ToPtr(api.Bytes(10 << 20 /* 10 Mi */)),
+		GoalCombination:                  lo.ToPtr(api.GoalCombinationMax),
+		GoalWeights:                      &api.GoalWeights{CPU: 1, Mem: 1, LFC: 1, Connections: 1},
+		MaxUpscaleStepCU:                 nil,
+		MaxDownscaleStepCU:               nil,
+		DownscaleStabilizationSeconds:    nil,
+		Schedules:                        nil,
+		DryRun:                           nil,
+		MonitorDownscaleTimeoutSeconds:   nil,
+		SchedulerRequestTimeoutSeconds:   nil,
 		CPUStableZoneRatio:               lo.ToPtr(0.0),
 		CPUMixedZoneRatio:                lo.ToPtr(0.0),
 	}
@@ -33,6 +44,7 @@ func Test_calculateGoalCU(t *testing.T) {
 		cfgUpdater func(*api.ScalingConfig)
 		sys        *SystemMetrics
 		lfc        *LFCMetrics
+		conns      *ConnectionMetrics
 		want       ScalingGoal
 	}{
 		{
@@ -40,12 +52,15 @@ func Test_calculateGoalCU(t *testing.T) {
 			cfgUpdater: nil,
 			sys:        nil,
 			lfc:        nil,
+			conns:      nil,
 			want: ScalingGoal{
 				HasAllMetrics: false,
 				Parts: ScalingGoalParts{
 					CPU: nil,
 					Mem: nil,
 					LFC: nil,
+
+					Connections: nil,
 				},
 			},
 		},
@@ -56,13 +71,16 @@ func Test_calculateGoalCU(t *testing.T) {
 			sys: &SystemMetrics{
 				LoadAverage1Min: 0.2,
 			},
-			lfc: nil,
+			lfc:   nil,
+			conns: nil,
 			want: ScalingGoal{
 				HasAllMetrics: false,
 				Parts: ScalingGoalParts{
 					CPU: lo.ToPtr(0.8),
 					Mem: lo.ToPtr(0.0),
 					LFC: nil,
+
+					Connections: nil,
 				},
 			},
 		},
@@ -73,13 +91,16 @@ func Test_calculateGoalCU(t *testing.T) {
 			sys: &SystemMetrics{
 				LoadAverage1Min: 1,
 			},
-			lfc: nil,
+			lfc:   nil,
+			conns: nil,
 			want: ScalingGoal{
 				HasAllMetrics: false,
 				Parts: ScalingGoalParts{
 					CPU: lo.ToPtr(4.0),
 					Mem: lo.ToPtr(0.0),
 					LFC: nil,
+
+					Connections: nil,
 				},
 			},
 		},
@@ -93,13 +114,16 @@ func Test_calculateGoalCU(t *testing.T) {
 				LoadAverage1Min: 0.7, // equal to 3 CUs
 				LoadAverage5Min: 0.0,
 			},
-			lfc: nil,
+			lfc:   nil,
+			conns: nil,
 			want: ScalingGoal{
 				HasAllMetrics: false,
 				Parts: ScalingGoalParts{
 					CPU: lo.ToPtr(2.8),
 					Mem: lo.ToPtr(0.0),
 					LFC: nil,
+
+					Connections: nil,
 				},
 			},
 		},
@@ -114,13 +138,16 @@ func Test_calculateGoalCU(t *testing.T) {
 				MemoryUsageBytes:  0,
 				MemoryCachedBytes: 0,
 			},
-			lfc: nil,
+			lfc:   nil,
+			conns: nil,
 			want: ScalingGoal{
 				HasAllMetrics: false,
 				Parts: ScalingGoalParts{
 					CPU: lo.ToPtr(2.8),
 					Mem: lo.ToPtr(0.0),
 					LFC: nil,
+
+					Connections: nil,
 				},
 			},
 		},
@@ -136,13 +163,56 @@ func Test_calculateGoalCU(t *testing.T) {
 				MemoryUsageBytes:  0,
 				MemoryCachedBytes: 0,
 			},
-			lfc: nil,
+			lfc:   nil,
+			conns: nil,
 			want: ScalingGoal{
 				HasAllMetrics: false,
 				Parts: ScalingGoalParts{
 					CPU: lo.ToPtr(5.499997000005999),
 					Mem: lo.ToPtr(0.0),
 					LFC: nil,
+
+					Connections: nil,
+				},
+			},
+		},
+		{
+			name:       "connections-memory",
+			cfgUpdater: nil,
+			sys:        nil,
+			lfc:        nil,
+			conns: &ConnectionMetrics{
+				TotalConnections: 250, // 250 × 10Mi = 2.44 CUs
+				ActiveBackends:   0,
+			},
+			want: ScalingGoal{
+				HasAllMetrics: false,
+				Parts: ScalingGoalParts{
+					CPU: nil,
+					Mem: nil,
+					LFC: nil,
+
+					Connections: lo.ToPtr(2.44140625),
+				},
+			},
+		},
+		{
+			name:       "connections-active",
+			cfgUpdater: nil,
+			sys:        nil,
+			lfc:        nil,
+			conns: &ConnectionMetrics{
+				TotalConnections: 20,
+				ActiveBackends:   3, // 3 CPUs = 12 CUs
+			},
+			want: ScalingGoal{
+				HasAllMetrics: false,
+				Parts: ScalingGoalParts{
+					CPU: nil,
+					Mem: nil,
+					LFC: nil,
+
+					Connections: lo.ToPtr(12.0),
 				},
 			},
 		},
@@ -155,8 +225,92 @@ func Test_calculateGoalCU(t *testing.T) {
 				c.cfgUpdater(&scalingConfig)
 			}
 
-			got, _ := calculateGoalCU(warn, scalingConfig, cu, c.sys, c.lfc)
+			got, _ := calculateGoalCU(warn, scalingConfig, cu, c.sys, c.lfc, c.conns)
 			assert.InDelta(t, lo.FromPtrOr(c.want.Parts.CPU, -1), lo.FromPtrOr(got.Parts.CPU, -1), 0.000001)
+			assert.InDelta(t, lo.FromPtrOr(c.want.Parts.Connections, -1), lo.FromPtrOr(got.Parts.Connections, -1), 0.000001)
 		})
 	}
 }
+
+func Test_ScalingGoal_GoalCU(t *testing.T) {
+	goal := ScalingGoal{
+		HasAllMetrics: true,
+		Parts: ScalingGoalParts{
+			CPU: lo.ToPtr(2.4), // rounded to 2
+			Mem: lo.ToPtr(3.5),
+			LFC: nil,
+
+			Connections: lo.ToPtr(1.0),
+		},
+	}
+
+	cases := []struct {
+		name        string
+		combination api.GoalCombination
+		weights     api.GoalWeights
+		want        api.ComputeUnits
+	}{
+		{
+			name:        "max",
+			combination: api.GoalCombinationMax,
+			weights:     api.GoalWeights{CPU: 1, Mem: 1, LFC: 1, Connections: 1},
+			want:        4000,
+		},
+		{
+			name:        "max-weighted",
+			combination: api.GoalCombinationMax,
+			weights:     api.GoalWeights{CPU: 2, Mem: 0.5, LFC: 1, Connections: 1},
+			want:        4000, // 2 × 2
+		},
+		{
+			name:        "max-excluded",
+			combination: api.GoalCombinationMax,
+			weights:     api.GoalWeights{CPU: 1, Mem: 0, LFC: 1, Connections: 1},
+			want:        2000,
+		},
+		{
+			name:        "weighted-average",
+			combination: api.GoalCombinationWeightedAverage,
+			weights:     api.GoalWeights{CPU: 1, Mem: 2, LFC: 5, Connections: 1},
+			want:        3000, // (2 + 7 + 1) / 4 = 2.5; LFC is missing so its weight is not counted
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			//nolint:exhaustruct // this is a test
+			cfg := api.ScalingConfig{
+				GoalCombination: lo.ToPtr(c.combination),
+				GoalWeights:     lo.ToPtr(c.weights),
+			}
+			assert.Equal(t, c.want, goal.GoalCU(cfg))
+		})
+	}
+}
+
+func Test_ScalingGoal_GoalCU_SubCU(t *testing.T) {
+	//nolint:exhaustruct // this is a test
+	cfg := api.ScalingConfig{
+		GoalCombination: lo.ToPtr(api.GoalCombinationMax),
+		GoalWeights:     &api.GoalWeights{CPU: 1, Mem: 1, LFC: 1, Connections: 1},
+	}
+
+	cases := []struct {
+		mem  float64
+		want api.ComputeUnits
+	}{
+		{0, 0},
+		{0.25, 250},
+		{0.3333, 334}, // rounded up to the nearest milli-CU
+		{0.9999, 1000},
+		{1.25, 2000}, // rounded up to a whole CU
+	}
+
+	for _, c := range cases {
+		goal := ScalingGoal{
+			HasAllMetrics: true,
+			Parts:         ScalingGoalParts{CPU: nil, Mem: lo.ToPtr(c.mem), LFC: nil, Connections: nil},
+		}
+		assert.Equal(t, c.want, goal.GoalCU(cfg), "mem goal %v", c.mem)
+	}
+}
@@ -42,6 +42,13 @@ type LFCMetrics struct {
 	ApproximateworkingSetSizeBuckets []float64
 }
 
+type ConnectionMetrics struct {
+	// TotalConnections is the number of connections to Postgres, in any state
+	TotalConnections float64
+	// ActiveBackends is the number of connections that are currently executing a query
+	ActiveBackends float64
+}
+
 // FromPrometheus represents metric types that can be parsed from prometheus output.
 type FromPrometheus interface {
 	fromPrometheus(map[string]*promtypes.MetricFamily) error
@@ -217,3 +224,34 @@ func extractWorkingSetSizeWindows(mfs map[string]*promtypes.MetricFamily) ([]flo
 	}
 	return values, nil
 }
+
+// fromPrometheus implements FromPrometheus, so ConnectionMetrics can be used with ParseMetrics.
+func (m *ConnectionMetrics) fromPrometheus(mfs map[string]*promtypes.MetricFamily) error {
+	metricName := "connection_counts"
+	mf := mfs[metricName]
+	if mf == nil {
+		return missingMetric(metricName)
+	}
+
+	if mf.GetType() != promtypes.MetricType_GAUGE {
+		return fmt.Errorf("wrong metric type: expected %s, but got %s", promtypes.MetricType_GAUGE, mf.GetType())
+	}
+
+	// The metric has one value per database and connection state, so we sum across all of them.
+	stateLabel := "state"
+	var tmp ConnectionMetrics
+	for _, metric := range mf.Metric {
+		value := metric.GetGauge().GetValue()
+		tmp.TotalConnections += value
+
+		stateIndex := slices.IndexFunc(metric.Label, func(l *promtypes.LabelPair) bool {
+			return l.GetName() == stateLabel
+		})
+		if stateIndex != -1 && metric.Label[stateIndex].GetValue() == "active" {
+			tmp.ActiveBackends += value
+		}
+	}
+
+	*m = tmp
+	return nil
+}
@@ -23,6 +23,7 @@ package core
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
 
@@ -32,6 +33,7 @@ import (
 	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
 	"github.com/neondatabase/autoscaling/pkg/agent/core/revsource"
 	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/util"
 )
 
 type ObservabilityCallbacks struct {
@@ -41,11 +43,13 @@ type ObservabilityCallbacks struct {
 
 	ActualScaling       ReportActualScalingEventCallback
 	HypotheticalScaling ReportHypotheticalScalingEventCallback
+	ShadowScaling       ReportShadowScalingCallback
 }
 
 type (
-	ReportActualScalingEventCallback       func(timestamp time.Time, current uint32, target uint32)
-	ReportHypotheticalScalingEventCallback func(timestamp time.Time, current uint32, target uint32, parts ScalingGoalParts)
+	ReportActualScalingEventCallback       func(timestamp time.Time, current api.ComputeUnits, target api.ComputeUnits)
+	ReportHypotheticalScalingEventCallback func(timestamp time.Time, current api.ComputeUnits, target api.ComputeUnits, parts ScalingGoalParts)
+	ReportShadowScalingCallback            func(timestamp time.Time, current api.ComputeUnits, active api.ComputeUnits, shadow api.ComputeUnits)
 )
 
 type RevisionSource interface {
@@ -63,6 +67,11 @@ type Config struct {
 	// If the VM's ScalingConfig is nil, we use this field instead.
 	DefaultScalingConfig api.ScalingConfig
 
+	// ShadowScalingConfig, if not nil, gives overrides applied on top of the VM's scaling config to
+	// calculate a "shadow" goal CU alongside the active one. The shadow goal is only reported via
+	// ObservabilityCallbacks.ShadowScaling, and never acted upon.
+	ShadowScalingConfig *api.ScalingConfig
+
 	// NeonVMRetryWait gives the amount of time to wait to retry after a failed request
 	NeonVMRetryWait time.Duration
 
@@ -142,6 +151,12 @@ type state struct {
 
 	LFCMetrics *LFCMetrics
 
+	ConnectionMetrics *ConnectionMetrics
+
+	// RecentGoalCUs stores the goal CU from each calculation within the scaling config's downscale
+	// stabilization window, oldest first.
+	RecentGoalCUs []timedGoalCU
+
 	// TargetRevision is the revision agent works towards.
 	TargetRevision vmv1.Revision
 
@@ -149,6 +164,11 @@ type state struct {
 	LastDesiredResources *api.Resources
 }
 
+type timedGoalCU struct {
+	At     time.Time
+	GoalCU api.ComputeUnits
+}
+
 type pluginState struct {
 	// OngoingRequest is true iff there is currently an ongoing request to *this* scheduler plugin.
 	OngoingRequest bool
@@ -157,6 +177,9 @@ type pluginState struct {
 	LastRequest *pluginRequested
 	// LastFailureAt, if not nil, gives the time of the most recent request failure
 	LastFailureAt *time.Time
+	// RetryAfter, if not nil, gives the time before which the scheduler plugin asked us not to make
+	// any more requests -- e.g., because it was overloaded.
+	RetryAfter *time.Time
 	// Permit, if not nil, stores the Permit in the most recent PluginResponse. This field will be
 	// nil if we have not been able to contact *any* scheduler.
 	Permit *api.Resources
@@ -251,6 +274,7 @@ func NewState(vm api.VmInfo, config Config) *State {
 				OngoingRequest:  false,
 				LastRequest:     nil,
 				LastFailureAt:   nil,
+				RetryAfter:      nil,
 				Permit:          nil,
 				CurrentRevision: vmv1.ZeroRevision,
 			},
@@ -272,6 +296,8 @@ func NewState(vm api.VmInfo, config Config) *State {
 			},
 			Metrics:              nil,
 			LFCMetrics:           nil,
+			ConnectionMetrics:    nil,
+			RecentGoalCUs:        nil,
 			LastDesiredResources: nil,
 			TargetRevision:       vmv1.ZeroRevision,
 		},
@@ -447,6 +473,15 @@ func (s *state) calculatePluginAction(
 		}
 	}
 
+	// Can't make a request if the scheduler asked us to back off
+	if s.Plugin.RetryAfter != nil {
+		timeUntilRetryAfter := s.Plugin.RetryAfter.Sub(now)
+		if timeUntilRetryAfter > 0 {
+			logFailureReason("scheduler plugin asked us to back off")
+			return nil, &timeUntilRetryAfter
+		}
+	}
+
 	// At this point, all that's left is either making the request, or saying to wait.
 	// The rest of the complication is just around accurate logging.
 	if timeForRequest || shouldRequestNewResources {
@@ -735,14 +770,14 @@ func (s *state) desiredResourcesFromMetricsOrRequestedUpscaling(now time.Time) (
 	// 2. Cap the goal CU by min/max, etc
 	// 3. that's it!
 
-	reportGoals := func(goalCU uint32, parts ScalingGoalParts) {
-		currentCU, ok := s.VM.Using().DivResources(s.Config.ComputeUnit)
+	reportGoals := func(goalCU api.ComputeUnits, parts ScalingGoalParts) {
+		currentCU, ok := s.VM.Using().DivComputeUnits(s.Config.ComputeUnit)
 		if !ok {
 			return // skip reporting if the current CU is not right.
 		}
 
 		if report := s.Config.ObservabilityCallbacks.HypotheticalScaling; report != nil {
-			report(now, uint32(currentCU), goalCU, parts)
+			report(now, currentCU, goalCU, parts)
 		}
 	}
 
@@ -752,16 +787,20 @@ func (s *state) desiredResourcesFromMetricsOrRequestedUpscaling(now time.Time) (
 		s.Config.ComputeUnit,
 		s.Metrics,
 		s.LFCMetrics,
+		s.ConnectionMetrics,
 	)
-	goalCU := sg.GoalCU()
+	goalCU := sg.GoalCU(s.scalingConfig())
 	// If we don't have all the metrics we need, we'll later prevent downscaling to avoid flushing
 	// the VM's cache on autoscaler-agent restart if we have SystemMetrics but not LFCMetrics.
 	hasAllMetrics := sg.HasAllMetrics
 
 	if hasAllMetrics {
 		reportGoals(goalCU, sg.Parts)
+		s.reportShadowGoal(now, goalCU)
 	}
 
+	goalCU = s.applyScalingLimits(now, goalCU, hasAllMetrics)
+
 	// Copy the initial value of the goal CU so that we can accurately track whether either
 	// requested upscaling or denied downscaling affected the outcome.
 	// Otherwise as written, it'd be possible to update goalCU from requested upscaling and
@@ -797,7 +836,12 @@ func (s *state) desiredResourcesFromMetricsOrRequestedUpscaling(now time.Time) (
 	}
 
 	// resources for the desired "goal" compute units
-	goalResources := s.Config.ComputeUnit.Mul(uint16(goalCU))
+	goalResources := s.Config.ComputeUnit.MulCU(goalCU)
+	// With a fractional goal CU, the memory may not be a whole number of memory slots. Round up, so
+	// that the VM's resources are still representable.
+	if slotSize := s.VM.Mem.SlotSize; slotSize != 0 {
+		goalResources.Mem = util.DivCeil(goalResources.Mem, slotSize) * slotSize
+	}
 
 	// If we don't have all the metrics we need to make a proper decision, make sure that we aren't
 	// going to scale down below the current resources.
@@ -865,6 +909,17 @@ func (s *state) desiredResourcesFromMetricsOrRequestedUpscaling(now time.Time) (
 			return nil
 		}
 	}
+
+	// In dry-run mode, we still calculate (and report) the goal, but never act on it.
+	if cfg := s.scalingConfig(); cfg.DryRun != nil && *cfg.DryRun && result != s.VM.Using() {
+		s.info(
+			"Dry-run mode enabled, not applying desired resources",
+			zap.Object("current", s.VM.Using()),
+			zap.Object("wanted", result),
+		)
+		result = s.VM.Using()
+	}
+
 	s.updateTargetRevision(now, result, s.VM.Using())
 
 	// TODO: we are both saving the result into LastDesiredResources and returning it. This is
@@ -882,6 +937,74 @@ func (s *state) desiredResourcesFromMetricsOrRequestedUpscaling(now time.Time) (
 	return result, calculateWaitTime
 }
 
+// reportShadowGoal calculates the goal CU using the shadow scaling config, if there is one, and
+// reports it alongside the active goal CU.
+func (s *state) reportShadowGoal(now time.Time, activeGoalCU api.ComputeUnits) {
+	report := s.Config.ObservabilityCallbacks.ShadowScaling
+	if s.Config.ShadowScalingConfig == nil || report == nil {
+		return
+	}
+
+	currentCU, ok := s.VM.Using().DivComputeUnits(s.Config.ComputeUnit)
+	if !ok {
+		return // skip reporting if the current CU is not right.
+	}
+
+	cfg := s.scalingConfig().WithOverrides(s.Config.ShadowScalingConfig)
+	sg, _ := calculateGoalCU(
+		func(string) {}, // any warnings would be duplicates of the active calculation
+		cfg,
+		s.Config.ComputeUnit,
+		s.Metrics,
+		s.LFCMetrics,
+		s.ConnectionMetrics,
+	)
+	if !sg.HasAllMetrics {
+		return
+	}
+
+	report(now, currentCU, activeGoalCU, sg.GoalCU(cfg))
+}
+
+// applyScalingLimits adjusts the goal CU from metrics according to the scaling config's schedules,
+// downscale stabilization window, and step limits, in that order.
+func (s *state) applyScalingLimits(now time.Time, goalCU api.ComputeUnits, hasAllMetrics bool) api.ComputeUnits {
+	cfg := s.scalingConfig()
+
+	for _, schedule := range cfg.Schedules {
+		if schedule.ActiveAt(now) {
+			goalCU = max(goalCU, api.WholeComputeUnits(uint32(max(schedule.MinCU, 0))))
+		}
+	}
+
+	window := time.Duration(lo.FromPtr(cfg.DownscaleStabilizationSeconds)) * time.Second
+	if window == 0 {
+		s.RecentGoalCUs = nil
+	} else {
+		s.RecentGoalCUs = slices.DeleteFunc(s.RecentGoalCUs, func(g timedGoalCU) bool {
+			return now.Sub(g.At) >= window
+		})
+		// Only record the goal if it's fully informed, so that we don't hold the VM at a goal that
+		// was calculated without all the metrics.
+		if hasAllMetrics {
+			s.RecentGoalCUs = append(s.RecentGoalCUs, timedGoalCU{At: now, GoalCU: goalCU})
+		}
+		for _, g := range s.RecentGoalCUs {
+			goalCU = max(goalCU, g.GoalCU)
+		}
+	}
+
+	currentCU := s.VM.Using().ComputeUnitsCovering(s.Config.ComputeUnit)
+	if step := cfg.MaxUpscaleStepCU; step != nil && goalCU > currentCU+*step {
+		goalCU = currentCU + *step
+	}
+	if step := cfg.MaxDownscaleStepCU; step != nil && goalCU+*step < currentCU {
+		goalCU = currentCU - *step
+	}
+
+	return goalCU
+}
+
 func (s *state) updateTargetRevision(now time.Time, desired api.Resources, current api.Resources) {
 	if s.LastDesiredResources == nil {
 		s.LastDesiredResources = &current
@@ -931,7 +1054,7 @@ func (s *state) timeUntilRequestedUpscalingExpired(now time.Time) time.Duration
 // NB: we could just use s.plugin.computeUnit or s.monitor.requestedUpscale from inside the
 // function, but those are sometimes nil. This way, it's clear that it's the caller's responsibility
 // to ensure that the values are non-nil.
-func (s *state) requiredCUForRequestedUpscaling(computeUnit api.Resources, requestedUpscale requestedUpscale) uint32 {
+func (s *state) requiredCUForRequestedUpscaling(computeUnit api.Resources, requestedUpscale requestedUpscale) api.ComputeUnits {
 	var required uint32
 	requested := requestedUpscale.Requested
 	base := requestedUpscale.Base
@@ -945,7 +1068,7 @@ func (s *state) requiredCUForRequestedUpscaling(computeUnit api.Resources, reque
 		required = max(required, 1+uint32(base.Mem/computeUnit.Mem))
 	}
 
-	return required
+	return api.WholeComputeUnits(required)
 }
 
 func (s *state) timeUntilDeniedDownscaleExpired(now time.Time) time.Duration {
@@ -958,12 +1081,12 @@ func (s *state) timeUntilDeniedDownscaleExpired(now time.Time) time.Duration {
 
 // NB: like requiredCUForRequestedUpscaling, we make the caller provide the values so that it's
 // more clear that it's the caller's responsibility to ensure the values are non-nil.
-func (s *state) requiredCUForDeniedDownscale(computeUnit, deniedResources api.Resources) uint32 {
+func (s *state) requiredCUForDeniedDownscale(computeUnit, deniedResources api.Resources) api.ComputeUnits {
 	// note: floor(x / M) + 1 gives the minimum integer value greater than x / M.
 	requiredFromCPU := 1 + uint32(deniedResources.VCPU/computeUnit.VCPU)
 	requiredFromMem := 1 + uint32(deniedResources.Mem/computeUnit.Mem)
 
-	return max(requiredFromCPU, requiredFromMem)
+	return api.WholeComputeUnits(max(requiredFromCPU, requiredFromMem))
 }
 
 func (s *state) minRequiredResourcesForDeniedDownscale(computeUnit api.Resources, denied deniedDownscale) api.Resources {
@@ -1044,6 +1167,20 @@ func (s *State) Debug(enabled bool) {
 	s.internal.Debug = enabled
 }
 
+// UpdatedConfig replaces the Config, e.g. when the autoscaler-agent's config has been reloaded.
+func (s *State) UpdatedConfig(config Config) {
+	s.internal.Config = config
+
+	// Same as in UpdatedVM: if LFC or connection metrics have been disabled, make sure we don't
+	// later make decisions based on stale data.
+	if !*s.internal.scalingConfig().EnableLFCMetrics {
+		s.internal.LFCMetrics = nil
+	}
+	if !*s.internal.scalingConfig().EnableConnectionMetrics {
+		s.internal.ConnectionMetrics = nil
+	}
+}
+
 func (s *State) UpdatedVM(vm api.VmInfo) {
 	// FIXME: overriding this is required right now because we trust that a successful request to
 	// NeonVM means the VM was already updated, which... isn't true, and otherwise we could run into
@@ -1064,6 +1201,10 @@ func (s *State) UpdatedVM(vm api.VmInfo) {
 	if !*s.internal.scalingConfig().EnableLFCMetrics {
 		s.internal.LFCMetrics = nil
 	}
+	// ... and the same for connection metrics.
+	if !*s.internal.scalingConfig().EnableConnectionMetrics {
+		s.internal.ConnectionMetrics = nil
+	}
 }
 
 func (s *State) UpdateSystemMetrics(metrics SystemMetrics) {
@@ -1074,6 +1215,20 @@ func (s *State) UpdateLFCMetrics(metrics LFCMetrics) {
 	s.internal.LFCMetrics = &metrics
 }
 
+func (s *State) UpdateConnectionMetrics(metrics ConnectionMetrics) {
+	s.internal.ConnectionMetrics = &metrics
+}
+
+// LastPermit returns the most recent permit received from the scheduler plugin, or nil if there
+// has not yet been a successful request.
+func (s *State) LastPermit() *api.Resources {
+	if s.internal.Plugin.Permit == nil {
+		return nil
+	}
+	permit := *s.internal.Plugin.Permit
+	return &permit
+}
+
 // PluginHandle provides write access to the scheduler plugin pieces of an UpdateState
 type PluginHandle struct {
 	s *state
@@ -1096,6 +1251,15 @@ func (h PluginHandle) RequestFailed(now time.Time) {
 	h.s.Plugin.LastFailureAt = &now
 }
 
+// RequestBackpressured records that the request failed because the scheduler plugin asked us to
+// back off, and that we should not make another request until retryAfter.
+//
+// The usual retry wait after a failed request still applies, if it's longer.
+func (h PluginHandle) RequestBackpressured(now time.Time, retryAfter time.Time) {
+	h.RequestFailed(now)
+	h.s.Plugin.RetryAfter = &retryAfter
+}
+
 func (h PluginHandle) RequestSuccessful(
 	now time.Time,
 	targetRevision vmv1.RevisionWithTime,
@@ -1244,11 +1408,11 @@ func (s *State) NeonVM() NeonVMHandle {
 
 func (h NeonVMHandle) StartingRequest(now time.Time, resources api.Resources) {
 	if report := h.s.Config.ObservabilityCallbacks.ActualScaling; report != nil {
-		currentCU, currentOk := h.s.VM.Using().DivResources(h.s.Config.ComputeUnit)
-		targetCU, targetOk := resources.DivResources(h.s.Config.ComputeUnit)
+		currentCU, currentOk := h.s.VM.Using().DivComputeUnits(h.s.Config.ComputeUnit)
+		targetCU, targetOk := resources.DivComputeUnits(h.s.Config.ComputeUnit)
 
 		if currentOk && targetOk {
-			report(now, uint32(currentCU), uint32(targetCU))
+			report(now, currentCU, targetCU)
 		}
 	}
 
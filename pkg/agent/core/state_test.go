@@ -244,9 +244,21 @@ func Test_DesiredResourcesFromMetricsOrRequestedUpscaling(t *testing.T) {
 					LFCToMemoryRatio:                 lo.ToPtr(0.75),
 					LFCWindowSizeMinutes:             lo.ToPtr(5),
 					LFCMinWaitBeforeDownscaleMinutes: lo.ToPtr(5),
+					EnableConnectionMetrics:          lo.ToPtr(false),
+					MemoryPerConnection:              lo.ToPtr(api.Bytes(10 << 20 /* 10 Mi */)),
+					GoalCombination:                  lo.ToPtr(api.GoalCombinationMax),
+					GoalWeights:                      &api.GoalWeights{CPU: 1, Mem: 1, LFC: 1, Connections: 1},
+					MaxUpscaleStepCU:                 nil,
+					MaxDownscaleStepCU:               nil,
+					DownscaleStabilizationSeconds:    nil,
+					Schedules:                        nil,
+					DryRun:                           nil,
+					MonitorDownscaleTimeoutSeconds:   nil,
+					SchedulerRequestTimeoutSeconds:   nil,
 					CPUStableZoneRatio:               lo.ToPtr(0.0),
 					CPUMixedZoneRatio:                lo.ToPtr(0.0),
 				},
+				ShadowScalingConfig: nil,
 				// these don't really matter, because we're not using (*State).NextActions()
 				NeonVMRetryWait:                    time.Second,
 				PluginRequestTick:                  time.Second,
@@ -268,6 +280,7 @@ func Test_DesiredResourcesFromMetricsOrRequestedUpscaling(t *testing.T) {
 					NeonVMLatency:       nil,
 					ActualScaling:       nil,
 					HypotheticalScaling: nil,
+					ShadowScaling:       nil,
 				},
 			}
 		}
@@ -316,6 +329,146 @@ func Test_DesiredResourcesFromMetricsOrRequestedUpscaling(t *testing.T) {
 	}
 }
 
+func Test_DesiredResourcesWithScalingLimits(t *testing.T) {
+	// 2024-01-01 was a Monday.
+	monday10am := time.Date(2024, time.January, 1, 10, 0, 0, 0, time.UTC)
+
+	lowLoad := core.SystemMetrics{
+		LoadAverage1Min:   0.0,
+		LoadAverage5Min:   0.0,
+		MemoryUsageBytes:  0.0,
+		MemoryCachedBytes: 0.0,
+	}
+	highLoad := lowLoad
+	highLoad.LoadAverage1Min = 2.0
+
+	type step struct {
+		after    time.Duration
+		metrics  core.SystemMetrics
+		expectCU uint16
+	}
+
+	cases := []struct {
+		name   string
+		config func(*api.ScalingConfig)
+		steps  []step
+	}{
+		{
+			name: "MaxUpscaleStep",
+			config: func(c *api.ScalingConfig) {
+				c.MaxUpscaleStepCU = lo.ToPtr(api.WholeComputeUnits(2))
+			},
+			steps: []step{{after: 0, metrics: highLoad, expectCU: 6}},
+		},
+		{
+			name: "MaxDownscaleStep",
+			config: func(c *api.ScalingConfig) {
+				c.MaxDownscaleStepCU = lo.ToPtr(api.WholeComputeUnits(1))
+			},
+			steps: []step{{after: 0, metrics: lowLoad, expectCU: 3}},
+		},
+		{
+			name: "ScheduleActive",
+			config: func(c *api.ScalingConfig) {
+				c.Schedules = []vmv1.ScalingPolicySchedule{{
+					Name:      "business-hours",
+					Days:      []vmv1.ScheduleDay{"Mon", "Tue", "Wed", "Thu", "Fri"},
+					StartTime: "09:00",
+					EndTime:   "17:00",
+					MinCU:     3,
+				}}
+			},
+			steps: []step{{after: 0, metrics: lowLoad, expectCU: 3}},
+		},
+		{
+			name: "ScheduleInactive",
+			config: func(c *api.ScalingConfig) {
+				c.Schedules = []vmv1.ScalingPolicySchedule{{
+					Name:      "weekends",
+					Days:      []vmv1.ScheduleDay{"Sat", "Sun"},
+					StartTime: "09:00",
+					EndTime:   "17:00",
+					MinCU:     3,
+				}}
+			},
+			steps: []step{{after: 0, metrics: lowLoad, expectCU: 1}},
+		},
+		{
+			name: "DownscaleStabilization",
+			config: func(c *api.ScalingConfig) {
+				c.DownscaleStabilizationSeconds = lo.ToPtr[uint32](60)
+			},
+			steps: []step{
+				{after: 0, metrics: highLoad, expectCU: 8},
+				{after: 30 * time.Second, metrics: lowLoad, expectCU: 8},
+				{after: 60 * time.Second, metrics: lowLoad, expectCU: 1},
+			},
+		},
+		{
+			name: "DryRun",
+			config: func(c *api.ScalingConfig) {
+				c.DryRun = lo.ToPtr(true)
+			},
+			steps: []step{
+				{after: 0, metrics: highLoad, expectCU: 4},
+				{after: 30 * time.Second, metrics: lowLoad, expectCU: 4},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			state := helpers.CreateInitialState(
+				DefaultInitialStateConfig,
+				helpers.WithTestingLogfWarnings(t),
+				helpers.WithMinMaxCU(1, 8),
+				helpers.WithCurrentCU(4),
+				helpers.WithConfigSetting(func(cfg *core.Config) {
+					c.config(&cfg.DefaultScalingConfig)
+				}),
+			)
+
+			for _, s := range c.steps {
+				state.UpdateSystemMetrics(s.metrics)
+				actual := getDesiredResources(state, monday10am.Add(s.after))
+				assert.Equal(t, DefaultComputeUnit.Mul(s.expectCU), actual)
+			}
+		})
+	}
+}
+
+func Test_ShadowScaling(t *testing.T) {
+	type report struct {
+		current, active, shadow api.ComputeUnits
+	}
+	var reports []report
+
+	state := helpers.CreateInitialState(
+		DefaultInitialStateConfig,
+		helpers.WithTestingLogfWarnings(t),
+		helpers.WithMinMaxCU(1, 8),
+		helpers.WithCurrentCU(2),
+		helpers.WithConfigSetting(func(cfg *core.Config) {
+			cfg.ShadowScalingConfig = &api.ScalingConfig{LoadAverageFractionTarget: lo.ToPtr(0.25)}
+			cfg.ObservabilityCallbacks.ShadowScaling = func(_ time.Time, current, active, shadow api.ComputeUnits) {
+				reports = append(reports, report{current: current, active: active, shadow: shadow})
+			}
+		}),
+	)
+
+	state.UpdateSystemMetrics(core.SystemMetrics{
+		LoadAverage1Min:   0.5,
+		LoadAverage5Min:   0.5,
+		MemoryUsageBytes:  0.0,
+		MemoryCachedBytes: 0.0,
+	})
+	actual := getDesiredResources(state, time.Now())
+
+	// The shadow goal must be reported, but only the active goal is used.
+	assert.Equal(t, []report{{current: 2000, active: 4000, shadow: 8000}}, reports)
+	assert.Equal(t, DefaultComputeUnit.Mul(4), actual)
+}
+
 var DefaultComputeUnit = api.Resources{VCPU: 250, Mem: 1 << 30 /* 1 Gi */}
 
 var DefaultInitialStateConfig = helpers.InitialStateConfig{
@@ -337,9 +490,21 @@ var DefaultInitialStateConfig = helpers.InitialStateConfig{
 			LFCToMemoryRatio:                 lo.ToPtr(0.75),
 			LFCWindowSizeMinutes:             lo.ToPtr(5),
 			LFCMinWaitBeforeDownscaleMinutes: lo.ToPtr(15),
+			EnableConnectionMetrics:          lo.ToPtr(false),
+			MemoryPerConnection:              lo.ToPtr(api.Bytes(10 << 20 /* 10 Mi */)),
+			GoalCombination:                  lo.ToPtr(api.GoalCombinationMax),
+			GoalWeights:                      &api.GoalWeights{CPU: 1, Mem: 1, LFC: 1, Connections: 1},
+			MaxUpscaleStepCU:                 nil,
+			MaxDownscaleStepCU:               nil,
+			DownscaleStabilizationSeconds:    nil,
+			Schedules:                        nil,
+			DryRun:                           nil,
+			MonitorDownscaleTimeoutSeconds:   nil,
+			SchedulerRequestTimeoutSeconds:   nil,
 			CPUStableZoneRatio:               lo.ToPtr(0.0),
 			CPUMixedZoneRatio:                lo.ToPtr(0.0),
 		},
+		ShadowScalingConfig:                nil,
 		NeonVMRetryWait:                    5 * time.Second,
 		PluginRequestTick:                  5 * time.Second,
 		PluginRetryWait:                    3 * time.Second,
@@ -358,6 +523,7 @@ var DefaultInitialStateConfig = helpers.InitialStateConfig{
 			NeonVMLatency:       nil,
 			ActualScaling:       nil,
 			HypotheticalScaling: nil,
+			ShadowScaling:       nil,
 		},
 	},
 }
@@ -1874,6 +2040,81 @@ func TestFailedRequestRetry(t *testing.T) {
 	})
 }
 
+// Checks that when the scheduler plugin asks us to back off, we wait for the longer of the
+// Retry-After and the usual retry wait.
+func TestPluginBackpressure(t *testing.T) {
+	a := helpers.NewAssert(t)
+	clock := helpers.NewFakeClock(t)
+	clockTick := func() {
+		clock.Inc(100 * time.Millisecond)
+	}
+	expectedRevision := helpers.NewExpectedRevision(clock.Now)
+	resForCU := DefaultComputeUnit.Mul
+
+	state := helpers.CreateInitialState(
+		DefaultInitialStateConfig,
+		helpers.WithStoredWarnings(a.StoredWarnings()),
+		helpers.WithMinMaxCU(1, 2),
+		helpers.WithCurrentCU(1),
+		helpers.WithConfigSetting(func(c *core.Config) {
+			c.PluginRetryWait = duration("2s")
+		}),
+	)
+	nextActions := func() core.ActionSet {
+		return state.NextActions(clock.Now())
+	}
+
+	state.Monitor().Active(true)
+
+	// Send initial scheduler request
+	doInitialPluginRequest(a, state, clock, duration("0.1s"), nil, resForCU(1))
+
+	// Set metrics so that we should be trying to upscale
+	clockTick()
+	metrics := core.SystemMetrics{
+		LoadAverage1Min:   0.3,
+		LoadAverage5Min:   0.0,
+		MemoryUsageBytes:  0.0,
+		MemoryCachedBytes: 0.0,
+	}
+	a.Do(state.UpdateSystemMetrics, metrics)
+
+	upscaleRequest := func() core.ActionSet {
+		return core.ActionSet{
+			PluginRequest: &core.ActionPluginRequest{
+				LastPermit:     lo.ToPtr(resForCU(1)),
+				Target:         resForCU(2),
+				Metrics:        lo.ToPtr(metrics.ToAPI()),
+				TargetRevision: expectedRevision.WithTime(),
+			},
+		}
+	}
+
+	// The request for upscaling is told to back off for longer than the retry wait
+	a.Call(nextActions).Equals(upscaleRequest())
+	a.Do(state.Plugin().StartingRequest, clock.Now(), resForCU(2))
+	clockTick()
+	a.Do(state.Plugin().RequestBackpressured, clock.Now(), clock.Now().Add(duration("5s")))
+
+	// The usual retry wait applies first...
+	a.
+		WithWarnings("Wanted to make a request to the scheduler plugin, but previous request failed too recently").
+		Call(nextActions).
+		Equals(core.ActionSet{
+			Wait: &core.ActionWait{Duration: duration("2s")},
+		})
+	clock.Inc(duration("2s"))
+	// ... and then the remainder of the Retry-After:
+	a.
+		WithWarnings("Wanted to make a request to the scheduler plugin, but scheduler plugin asked us to back off").
+		Call(nextActions).
+		Equals(core.ActionSet{
+			Wait: &core.ActionWait{Duration: duration("3s")},
+		})
+	clock.Inc(duration("3s"))
+	a.Call(nextActions).Equals(upscaleRequest())
+}
+
 // Checks that when metrics are updated during the downscaling process, between the NeonVM request
 // and plugin request, we keep those processes mostly separate, without interference between them.
 //
@@ -1,7 +1,6 @@
 package testhelpers
 
 import (
-	"fmt"
 	"testing"
 
 	"go.uber.org/zap"
@@ -58,12 +57,9 @@ func CreateVmInfo(config InitialVmInfoConfig, opts ...VmInfoOpt) api.VmInfo {
 		o.modifyVmInfoConfig(&config)
 	}
 
-	if config.ComputeUnit.Mem%config.MemorySlotSize != 0 {
-		panic(fmt.Errorf(
-			"compute unit is not divisible by memory slot size: %v is not divisible by %v",
-			config.ComputeUnit.Mem,
-			config.MemorySlotSize,
-		))
+	slotsPerCU, err := config.ComputeUnit.MemSlotsPerCU(config.MemorySlotSize)
+	if err != nil {
+		panic(err)
 	}
 
 	vm := api.VmInfo{
@@ -76,9 +72,9 @@ func CreateVmInfo(config InitialVmInfoConfig, opts ...VmInfoOpt) api.VmInfo {
 		},
 		Mem: api.VmMemInfo{
 			SlotSize: config.MemorySlotSize,
-			Min:      config.MinCU * uint16(config.ComputeUnit.Mem/config.MemorySlotSize),
-			Use:      config.MinCU * uint16(config.ComputeUnit.Mem/config.MemorySlotSize),
-			Max:      config.MaxCU * uint16(config.ComputeUnit.Mem/config.MemorySlotSize),
+			Min:      config.MinCU * slotsPerCU,
+			Use:      config.MinCU * slotsPerCU,
+			Max:      config.MaxCU * slotsPerCU,
 		},
 		Config: api.VmConfig{
 			AutoMigrationEnabled: false,
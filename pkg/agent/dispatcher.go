@@ -95,8 +95,9 @@ func NewDispatcher(
 		}
 	}()
 
-	connectTimeout := time.Second * time.Duration(runner.global.config.Monitor.ConnectionTimeoutSeconds)
-	conn, protoVersion, err := connectToMonitor(ctx, logger, addr, connectTimeout)
+	monitorConfig := runner.global.config.Load().Monitor
+	connectTimeout := time.Second * time.Duration(monitorConfig.ConnectionTimeoutSeconds)
+	conn, protoVersion, err := connectToMonitor(ctx, logger, addr, connectTimeout, monitorConfig.StrictMessageValidation)
 	if err != nil {
 		return nil, err
 	}
@@ -156,14 +157,14 @@ func NewDispatcher(
 		disp.run(c, l, sendUpscaleRequested)
 	})
 	runner.spawnBackgroundWorker(ctx, logger.Named("health-checks"), "vm-monitor health checks", func(ctx context.Context, logger *zap.Logger) {
-		timeout := time.Second * time.Duration(runner.global.config.Monitor.ResponseTimeoutSeconds)
+		timeout := time.Second * time.Duration(runner.global.config.Load().Monitor.ResponseTimeoutSeconds)
 		// FIXME: make this duration configurable
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 
 		// if we've had sequential failures for more than
 		var firstSequentialFailure *time.Time
-		continuedFailureAbortTimeout := time.Second * time.Duration(runner.global.config.Monitor.MaxHealthCheckSequentialFailuresSeconds)
+		continuedFailureAbortTimeout := time.Second * time.Duration(runner.global.config.Load().Monitor.MaxHealthCheckSequentialFailuresSeconds)
 
 		// if we don't have any errors, we will log only every 10th successful health check
 		const logEveryNth = 10
@@ -231,6 +232,7 @@ func connectToMonitor(
 	logger *zap.Logger,
 	addr string,
 	timeout time.Duration,
+	strictValidation bool,
 ) (_ *websocket.Conn, _ *api.MonitorProtoVersion, finalErr error) {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
@@ -268,8 +270,15 @@ func connectToMonitor(
 	}
 
 	logger.Info("Reading monitor version response")
+	var rawResp json.RawMessage
+	err = wsjson.Read(ctx, c, &rawResp)
+	if err == nil && strictValidation {
+		err = api.MonitorProtocolResponseSchema().Validate(rawResp)
+	}
 	var resp api.MonitorProtocolResponse
-	err = wsjson.Read(ctx, c, &resp)
+	if err == nil {
+		err = json.Unmarshal(rawResp, &resp)
+	}
 	if err != nil {
 		logger.Error("Failed to read monitor response", zap.Error(err))
 		failureReason = websocket.StatusProtocolError
@@ -463,6 +472,16 @@ func (disp *Dispatcher) HandleMessage(
 
 	var rootErr error
 
+	if disp.runner.global.config.Load().Monitor.StrictMessageValidation {
+		if err := api.MonitorToAgentMessageSchema().Validate(message); err != nil {
+			rootErr = errors.New("Received message not matching schema")
+			err := fmt.Errorf("Error validating %s: %w", *typeStr, err)
+			logger.Error(rootErr.Error(), zap.Error(err))
+			_ = disp.send(ctx, logger, id, api.InvalidMessage{Error: err.Error()})
+			return err
+		}
+	}
+
 	// now that we have the waiter's ID, make sure that if there's some failure past this point, we
 	// propagate that along to the monitor and remove it
 	defer func() {
@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/tychoish/fun/pubsub"
 	"go.uber.org/zap"
@@ -11,6 +12,7 @@ import (
 
 	vmclient "github.com/neondatabase/autoscaling/neonvm/client/clientset/versioned"
 	"github.com/neondatabase/autoscaling/pkg/agent/billing"
+	"github.com/neondatabase/autoscaling/pkg/agent/remotewrite"
 	"github.com/neondatabase/autoscaling/pkg/agent/scalingevents"
 	"github.com/neondatabase/autoscaling/pkg/agent/schedwatch"
 	"github.com/neondatabase/autoscaling/pkg/util"
@@ -39,8 +41,36 @@ func (r MainRunner) Run(logger *zap.Logger, ctx context.Context) error {
 
 	watchMetrics := watch.NewMetrics("autoscaling_agent_watchers", globalPromReg)
 
+	// Changes to ScalingPolicies are queued, and handled once the VM watcher has started, by
+	// re-submitting events for the VMs that reference them.
+	policyChangeQueue := pubsub.NewUnlimitedQueue[util.NamespacedName]()
+	defer policyChangeQueue.Close()
+	pushPolicyChange := func(name util.NamespacedName) {
+		if err := policyChangeQueue.Add(name); err != nil {
+			logger.Warn("Failed to add ScalingPolicy change to queue", zap.Object("scalingPolicy", name), zap.Error(err))
+		}
+	}
+
+	logger.Info("Starting ScalingPolicy watcher")
+	policyStore, err := startScalingPolicyWatcher(ctx, logger, r.VMClient, watchMetrics, pushPolicyChange)
+	if err != nil {
+		return fmt.Errorf("Error starting ScalingPolicy watcher: %w", err)
+	}
+	defer policyStore.Stop()
+	logger.Info("ScalingPolicy watcher started")
+
 	logger.Info("Starting VM watcher")
-	vmWatchStore, err := startVMWatcher(ctx, logger, r.Config, r.VMClient, watchMetrics, perVMMetrics, r.EnvArgs.K8sNodeName, pushToQueue)
+	vmWatchStore, err := startVMWatcher(
+		ctx,
+		logger,
+		r.Config,
+		r.VMClient,
+		watchMetrics,
+		perVMMetrics,
+		r.EnvArgs.K8sNodeName,
+		policyStore,
+		pushToQueue,
+	)
 	if err != nil {
 		return fmt.Errorf("Error starting VM watcher: %w", err)
 	}
@@ -53,6 +83,16 @@ func (r MainRunner) Run(logger *zap.Logger, ctx context.Context) error {
 	}
 	defer schedTracker.Stop()
 
+	err = startHealthServer(
+		ctx,
+		logger.Named("health"),
+		util.APIServerHealthCheck(r.KubeClient),
+		schedulerHealthCheck(schedTracker, r.Config.Scheduler.RequestPort),
+	)
+	if err != nil {
+		return err
+	}
+
 	scalingEventsMetrics := scalingevents.NewPromMetrics(globalPromReg)
 	scalingReporter, err := scalingevents.NewReporter(ctx, logger, &r.Config.ScalingEvents, scalingEventsMetrics)
 	if err != nil {
@@ -93,13 +133,60 @@ func (r MainRunner) Run(logger *zap.Logger, ctx context.Context) error {
 		return fmt.Errorf("error creating billing metrics collector: %w", err)
 	}
 
+	drainTimeout := time.Second * time.Duration(r.Config.ShutdownDrainTimeoutSeconds)
+
+	// note: the scaling events sink has its own context, so that it is canceled only after the
+	// Runners have stopped -- otherwise the final scaling events from shutting down would be lost.
+	sinkCtx, cancelSink := context.WithCancel(context.Background())
+	defer cancelSink() // make sure resources are cleaned up
+
 	tg := taskgroup.NewGroup(logger, taskgroup.WithParentContext(ctx))
 	tg.Go("scalingevents-run", func(logger *zap.Logger) error {
-		return scalingReporter.Run(tg.Ctx())
+		return scalingReporter.Run(sinkCtx) // note: NOT tg.Ctx(); see more above.
 	})
 	tg.Go("billing", func(logger *zap.Logger) error {
 		return mc.Run(tg.Ctx(), logger, storeForNode)
 	})
+	if r.Config.RemoteWrite != nil {
+		remoteWriteMetrics := remotewrite.NewPromMetrics(globalPromReg)
+		tg.Go("remote-write", func(logger *zap.Logger) error {
+			return remotewrite.Run(tg.Ctx(), logger, r.Config.RemoteWrite, vmPromReg, remoteWriteMetrics)
+		})
+	}
+	tg.Go("scaling-policy-changes", func(logger *zap.Logger) error {
+		for {
+			name, err := policyChangeQueue.Wait(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+			resubmitVMsForPolicy(logger, r.Config, r.EnvArgs.K8sNodeName, policyStore, vmWatchStore, name, pushToQueue)
+		}
+	})
+	tg.Go("config-reload", func(logger *zap.Logger) error {
+		watchConfigFile(tg.Ctx(), logger, r.EnvArgs.ConfigPath, r.Config, func(config *Config) {
+			globalState.UpdateConfig(config)
+			mc.UpdateConfig(&config.Billing)
+		})
+		return nil
+	})
+	tg.Go("scheduler-handshakes", func(logger *zap.Logger) error {
+		globalState.runSchedulerHandshakes(tg.Ctx(), logger, r.EnvArgs.K8sNodeName)
+		return nil
+	})
+	tg.Go("departing-notices", func(logger *zap.Logger) error {
+		defer cancelSink() // cancel scaling event sending *only when the Runners are done*
+		<-tg.Ctx().Done()
+		// Make sure no Runners make any further requests, and then let the scheduler know that
+		// it shouldn't expect any more from us.
+		globalState.Stop()
+		drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		globalState.NotifyDeparting(drainCtx, logger)
+		return nil
+	})
 	tg.Go("main-loop", func(logger *zap.Logger) error {
 		logger.Info("Entering main loop")
 		for {
@@ -117,5 +204,25 @@ func (r MainRunner) Run(logger *zap.Logger, ctx context.Context) error {
 		}
 	})
 
-	return tg.Wait()
+	done := make(chan error, 1)
+	go func() {
+		done <- tg.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	// On shutdown, billing and scaling events are flushed, and departing notices sent to the
+	// scheduler -- but we don't want to wait forever for that to happen.
+	logger.Info("Shutting down, waiting for remaining work to complete", zap.Duration("timeout", drainTimeout))
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(drainTimeout):
+		logger.Warn("Timed out waiting for remaining work to complete, exiting anyways")
+		return nil
+	}
 }
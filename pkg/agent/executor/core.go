@@ -149,6 +149,13 @@ func (c *ExecutorCore) StateDump() StateDump {
 	return c.core.Dump()
 }
 
+// LastPermit returns the most recent permit received from the scheduler plugin, if there is one
+func (c *ExecutorCore) LastPermit() *api.Resources {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.core.LastPermit()
+}
+
 // Updater returns a handle on the object used for making external changes to the ExecutorCore,
 // beyond what's provided by the various client (ish) interfaces
 func (c *ExecutorCore) Updater() ExecutorCoreUpdater {
@@ -178,6 +185,24 @@ func (c ExecutorCoreUpdater) UpdateLFCMetrics(metrics core.LFCMetrics, withLock
 	})
 }
 
+// UpdateConnectionMetrics calls (*core.State).UpdateConnectionMetrics() on the inner core.State and
+// runs withLock while holding the lock.
+func (c ExecutorCoreUpdater) UpdateConnectionMetrics(metrics core.ConnectionMetrics, withLock func()) {
+	c.core.update(func(state *core.State) {
+		state.UpdateConnectionMetrics(metrics)
+		withLock()
+	})
+}
+
+// UpdatedConfig calls (*core.State).UpdatedConfig() on the inner core.State and runs withLock while
+// holding the lock.
+func (c ExecutorCoreUpdater) UpdatedConfig(config core.Config, withLock func()) {
+	c.core.update(func(state *core.State) {
+		state.UpdatedConfig(config)
+		withLock()
+	})
+}
+
 // UpdatedVM calls (*core.State).UpdatedVM() on the inner core.State and runs withLock while
 // holding the lock.
 func (c ExecutorCoreUpdater) UpdatedVM(vm api.VmInfo, withLock func()) {
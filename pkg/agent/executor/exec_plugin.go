@@ -2,6 +2,8 @@ package executor
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"go.uber.org/zap"
@@ -15,6 +17,21 @@ type PluginInterface interface {
 	Request(_ context.Context, _ *zap.Logger, lastPermit *api.Resources, target api.Resources, _ *api.Metrics) (*api.PluginResponse, error)
 }
 
+// PluginBackpressureError may be returned by (PluginInterface).Request when the scheduler plugin
+// asked us to back off, so that no further requests are made until RetryAfter has passed.
+type PluginBackpressureError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *PluginBackpressureError) Error() string {
+	return fmt.Sprintf("%s (retry after %s)", e.Err, e.RetryAfter)
+}
+
+func (e *PluginBackpressureError) Unwrap() error {
+	return e.Err
+}
+
 func (c *ExecutorCoreWithClients) DoPluginRequests(ctx context.Context, logger *zap.Logger) {
 	var (
 		updates     util.BroadcastReceiver = c.updates.NewReceiver()
@@ -57,7 +74,12 @@ func (c *ExecutorCoreWithClients) DoPluginRequests(ctx context.Context, logger *
 
 			if err != nil {
 				logger.Error("Plugin request failed", append(logFields, zap.Error(err))...)
-				state.Plugin().RequestFailed(endTime)
+				var backpressure *PluginBackpressureError
+				if errors.As(err, &backpressure) {
+					state.Plugin().RequestBackpressured(endTime, endTime.Add(backpressure.RetryAfter))
+				} else {
+					state.Plugin().RequestFailed(endTime)
+				}
 			} else {
 				logFields = append(logFields, zap.Any("response", resp))
 				logger.Info("Plugin request successful", logFields...)
@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/samber/lo"
 	"go.uber.org/zap"
 
 	"k8s.io/client-go/kubernetes"
@@ -24,7 +25,7 @@ import (
 
 // agentState is the global state for the autoscaler agent
 //
-// All fields are immutable, except pods.
+// All fields are immutable, except pods and config.
 type agentState struct {
 	// lock guards access to pods
 	lock util.ChanMutex
@@ -34,15 +35,24 @@ type agentState struct {
 	// running the risk of leaking keys.
 	baseLogger *zap.Logger
 
-	podIP        string
-	config       *Config
+	podIP string
+	// config is the current autoscaler-agent config, which may be replaced when the config file
+	// changes. Refer to (*agentState).UpdateConfig for more.
+	//
+	// Runners receive changes to the config so they can update their executors with the new
+	// settings.
+	config       *util.BroadcastValue[*Config]
 	kubeClient   *kubernetes.Clientset
-	vmClient     *vmclient.Clientset
+	vmClient     vmclient.Interface
 	schedTracker *schedwatch.SchedulerTracker
 	metrics      GlobalMetrics
 	vmMetrics    *PerVMMetrics
 
 	scalingReporter *scalingevents.Reporter
+
+	// schedulerRequestLimiter limits the rate of resource requests to the scheduler plugin across
+	// all Runners, according to Scheduler.RequestRateLimit in the config.
+	schedulerRequestLimiter *util.RateLimiter
 }
 
 func (r MainRunner) newAgentState(
@@ -53,11 +63,11 @@ func (r MainRunner) newAgentState(
 	globalMetrics GlobalMetrics,
 	perVMMetrics *PerVMMetrics,
 ) *agentState {
-	return &agentState{
+	s := &agentState{
 		lock:         util.NewChanMutex(),
 		pods:         make(map[util.NamespacedName]*podState),
 		baseLogger:   baseLogger,
-		config:       r.Config,
+		config:       util.NewBroadcastValue(r.Config),
 		kubeClient:   r.KubeClient,
 		vmClient:     r.VMClient,
 		podIP:        podIP,
@@ -66,7 +76,14 @@ func (r MainRunner) newAgentState(
 		vmMetrics:    perVMMetrics,
 
 		scalingReporter: scalingReporter,
+
+		schedulerRequestLimiter: util.NewRateLimiter(
+			lo.FromPtr(r.Config.Scheduler.RequestRateLimit),
+			globalMetrics.rateLimiters,
+			"scheduler_requests",
+		),
 	}
+	return s
 }
 
 func vmIsOurResponsibility(vm *vmv1.VirtualMachine, config *Config, nodeName string) bool {
@@ -86,6 +103,37 @@ func (s *agentState) Stop() {
 	}
 }
 
+// NotifyDeparting sends a departing notice to the scheduler on behalf of every VM that we're
+// currently responsible for, waiting until all requests have completed or ctx is canceled.
+//
+// This should only be called once the agent is shutting down, after the Runners have been stopped.
+func (s *agentState) NotifyDeparting(ctx context.Context, logger *zap.Logger) {
+	if err := s.lock.TryLock(ctx); err != nil {
+		logger.Warn("Context canceled while starting to send departing notices", zap.Error(err))
+		return
+	}
+	var runners []*Runner
+	for _, pod := range s.pods {
+		runners = append(runners, pod.runner)
+	}
+	s.lock.Unlock()
+
+	logger.Info("Sending departing notices to scheduler", zap.Int("count", len(runners)))
+
+	var wg sync.WaitGroup
+	for _, runner := range runners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runnerLogger := logger.With(zap.Object("pod", runner.podName))
+			if err := runner.NotifyDeparting(ctx, runnerLogger); err != nil {
+				runnerLogger.Warn("Failed to send departing notice to scheduler", zap.Error(err))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func (s *agentState) handleEvent(ctx context.Context, logger *zap.Logger, event vmEvent) {
 	logger = logger.With(
 		zap.Object("event", event),
@@ -112,6 +160,14 @@ func (s *agentState) handleEvent(ctx context.Context, logger *zap.Logger, event
 		return
 	}
 
+	if event.kind != vmEventDeleted {
+		computeUnit := s.config.Load().Scaling.ComputeUnit
+		issues := event.vmInfo.ValidateBounds(&computeUnit).Only(api.BoundsNotComputeUnitMultiple)
+		for _, issue := range issues {
+			logger.Warn("VM scaling bounds are not a multiple of the compute unit", zap.Error(issue))
+		}
+	}
+
 	switch event.kind {
 	case vmEventDeleted:
 		state.stop()
@@ -161,9 +217,10 @@ func (s *agentState) handleVMEventAdded(
 
 			startTime:                     now,
 			lastSuccessfulMonitorComm:     nil,
-			failedMonitorRequestCounter:   util.NewRecentCounter(time.Duration(s.config.Monitor.MaxFailedRequestRate.IntervalSeconds) * time.Second),
-			failedNeonVMRequestCounter:    util.NewRecentCounter(time.Duration(s.config.NeonVM.MaxFailedRequestRate.IntervalSeconds) * time.Second),
-			failedSchedulerRequestCounter: util.NewRecentCounter(time.Duration(s.config.Scheduler.MaxFailedRequestRate.IntervalSeconds) * time.Second),
+			monitorCircuitOpen:            false,
+			failedMonitorRequestCounter:   util.NewRecentCounter(time.Duration(s.config.Load().Monitor.MaxFailedRequestRate.IntervalSeconds) * time.Second),
+			failedNeonVMRequestCounter:    util.NewRecentCounter(time.Duration(s.config.Load().NeonVM.MaxFailedRequestRate.IntervalSeconds) * time.Second),
+			failedSchedulerRequestCounter: util.NewRecentCounter(time.Duration(s.config.Load().Scheduler.MaxFailedRequestRate.IntervalSeconds) * time.Second),
 		},
 	}
 
@@ -358,10 +415,17 @@ func (s *agentState) newRunner(vmInfo api.VmInfo, podName util.NamespacedName, p
 		memSlotSize: vmInfo.Mem.SlotSize,
 		lock:        util.NewChanMutex(),
 
-		executorStateDump: nil, // set by (*Runner).Run
+		executorStateDump:  nil, // set by (*Runner).Run
+		executorLastPermit: nil, // set by (*Runner).Run
 
 		monitor: nil,
 
+		schedulerDenial:      nil,
+		schedulerDenialKnown: false,
+
+		schedulerRequestIDs: newRequestIDs[schedulerRequestKey](),
+		monitorRequestIDs:   newRequestIDs[monitorRequestKey](),
+
 		backgroundWorkerCount: atomic.Int64{},
 		backgroundPanic:       make(chan error),
 	}
@@ -416,6 +480,10 @@ type podStatus struct {
 
 	lastSuccessfulMonitorComm *time.Time
 
+	// monitorCircuitOpen is true iff the runner has stopped regularly reconnecting to the
+	// vm-monitor, due to repeated failures.
+	monitorCircuitOpen bool
+
 	failedMonitorRequestCounter   *util.RecentCounter
 	failedNeonVMRequestCounter    *util.RecentCounter
 	failedSchedulerRequestCounter *util.RecentCounter
@@ -443,6 +511,7 @@ type podStatusDump struct {
 	PreviousEndStates []podStatusEndState `json:"previousEndStates"`
 
 	LastSuccessfulMonitorComm     *time.Time `json:"lastSuccessfulMonitorComm"`
+	MonitorCircuitOpen            bool       `json:"monitorCircuitOpen"`
 	FailedMonitorRequestCounter   uint       `json:"failedMonitorRequestCounter"`
 	FailedNeonVMRequestCounter    uint       `json:"failedNeonVMRequestCounter"`
 	FailedSchedulerRequestCounter uint       `json:"failedSchedulerRequestCounter"`
@@ -490,6 +559,8 @@ func (s *lockedPodStatus) update(global *agentState, with func(podStatus) podSta
 		case podStatusExitPanicked:
 			newState = runnerMetricStatePanicked
 		}
+	} else if newStatus.monitorCircuitOpen {
+		newState = runnerMetricStateDegraded
 	} else if isStuck, _ := newStatus.isStuck(global, now); isStuck {
 		newState = runnerMetricStateStuck
 	} else {
@@ -519,16 +590,16 @@ func (s *lockedPodStatus) update(global *agentState, with func(podStatus) podSta
 
 func (s podStatus) isStuck(global *agentState, now time.Time) (bool, []string) {
 	var reasons []string
-	if s.monitorStuckAt(global.config).Before(now) {
+	if s.monitorStuckAt(global.config.Load()).Before(now) {
 		reasons = append(reasons, "monitor health check failed")
 	}
-	if s.failedMonitorRequestCounter.Get() > global.config.Monitor.MaxFailedRequestRate.Threshold {
+	if s.failedMonitorRequestCounter.Get() > global.config.Load().Monitor.MaxFailedRequestRate.Threshold {
 		reasons = append(reasons, "monitor requests failed")
 	}
-	if s.failedSchedulerRequestCounter.Get() > global.config.Scheduler.MaxFailedRequestRate.Threshold {
+	if s.failedSchedulerRequestCounter.Get() > global.config.Load().Scheduler.MaxFailedRequestRate.Threshold {
 		reasons = append(reasons, "scheduler requests failed")
 	}
-	if s.failedNeonVMRequestCounter.Get() > global.config.NeonVM.MaxFailedRequestRate.Threshold {
+	if s.failedNeonVMRequestCounter.Get() > global.config.Load().NeonVM.MaxFailedRequestRate.Threshold {
 		reasons = append(reasons, "neonvm requests failed")
 	}
 	return len(reasons) > 0, reasons
@@ -555,7 +626,7 @@ func (s podStatus) monitorStuckAt(config *Config) time.Time {
 }
 
 func (s *lockedPodStatus) periodicallyRefreshState(ctx context.Context, logger *zap.Logger, global *agentState) {
-	ticker := time.NewTicker(time.Second * time.Duration(global.config.RefreshStateIntervalSeconds))
+	ticker := time.NewTicker(time.Second * time.Duration(global.config.Load().RefreshStateIntervalSeconds))
 	defer ticker.Stop()
 
 	for {
@@ -611,6 +682,7 @@ func (s *lockedPodStatus) dump() podStatusDump {
 		StateUpdatedAt: s.stateUpdatedAt,
 
 		LastSuccessfulMonitorComm:     s.lastSuccessfulMonitorComm,
+		MonitorCircuitOpen:            s.monitorCircuitOpen,
 		FailedMonitorRequestCounter:   s.failedMonitorRequestCounter.Get(),
 		FailedNeonVMRequestCounter:    s.failedNeonVMRequestCounter.Get(),
 		FailedSchedulerRequestCounter: s.failedSchedulerRequestCounter.Get(),
@@ -0,0 +1,193 @@
+package agent
+
+// Periodic handshakes with the scheduler plugin, so that it can keep track of which
+// autoscaler-agents are still alive -- see pkg/plugin/agents.go for the other side.
+//
+// Handshakes are authenticated with the token for our ServiceAccount, which is re-read for each
+// handshake because the kubelet periodically rotates it.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+// serviceAccountTokenPath is where the kubelet mounts the token for the pod's ServiceAccount
+const serviceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// runSchedulerHandshakes sends a handshake to the scheduler plugin immediately, and then every
+// Scheduler.HandshakeIntervalSeconds, until the context is canceled.
+//
+// If the interval is zero, no handshakes are sent until the config is updated with a non-zero
+// interval.
+func (s *agentState) runSchedulerHandshakes(ctx context.Context, logger *zap.Logger, nodeName string) {
+	configUpdated := s.config.NewReceiver()
+
+	for {
+		interval := time.Second * time.Duration(configUpdated.Awake().Scheduler.HandshakeIntervalSeconds)
+
+		var wait <-chan time.Time
+		if interval != 0 {
+			if err := s.sendSchedulerHandshake(ctx, logger, nodeName); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				logger.Warn("Failed to send handshake to scheduler", zap.Error(err))
+			}
+			wait = time.After(interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-configUpdated.Wait():
+			// Wait for the current interval to complete if there is one, so that a config update
+			// doesn't cause extra handshakes.
+			if wait != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-wait:
+				}
+			}
+		case <-wait:
+		}
+	}
+}
+
+func (s *agentState) sendSchedulerHandshake(ctx context.Context, logger *zap.Logger, nodeName string) error {
+	sched := s.schedTracker.Get()
+	if sched == nil {
+		err := errors.New("no known ready scheduler to send handshake to")
+		description := fmt.Sprintf("[error doing request: %s]", err)
+		s.metrics.schedulerHandshakes.WithLabelValues(description).Inc()
+		return err
+	}
+
+	token, err := os.ReadFile(serviceAccountTokenPath)
+	if err != nil {
+		description := "[error reading token]"
+		s.metrics.schedulerHandshakes.WithLabelValues(description).Inc()
+		return fmt.Errorf("Error reading ServiceAccount token: %w", err)
+	}
+
+	return s.doSchedulerHandshake(ctx, logger, sched.IP, string(bytes.TrimSpace(token)), nodeName)
+}
+
+// doSchedulerHandshake sends a single handshake to the scheduler plugin at schedulerIP,
+// authenticated with the token.
+func (s *agentState) doSchedulerHandshake(
+	ctx context.Context,
+	logger *zap.Logger,
+	schedulerIP string,
+	token string,
+	nodeName string,
+) error {
+	config := s.config.Load()
+
+	if err := s.lock.TryLock(ctx); err != nil {
+		return err
+	}
+	var pods []util.NamespacedName
+	for podName := range s.pods {
+		pods = append(pods, podName)
+	}
+	s.lock.Unlock()
+
+	capabilities := []api.ProtocolCapability{api.CapabilityDenialReasons}
+	if config.Scheduler.EnableProtobuf {
+		capabilities = append(capabilities, api.CapabilityProtobuf)
+	}
+
+	reqBody, err := json.Marshal(&api.AgentHandshake{
+		ProtoVersion: PluginProtocolVersion,
+		Node:         nodeName,
+		AgentIP:      s.podIP,
+		Capabilities: capabilities,
+		Pods:         pods,
+	})
+	if err != nil {
+		return fmt.Errorf("Error encoding handshake JSON: %w", err)
+	}
+
+	var reqCtx context.Context
+	var cancel context.CancelFunc
+	if config.Scheduler.RequestTimeoutSeconds != 0 {
+		reqCtx, cancel = context.WithTimeout(ctx, time.Second*time.Duration(config.Scheduler.RequestTimeoutSeconds))
+	} else {
+		reqCtx, cancel = context.WithCancel(ctx) // zero means no timeout
+	}
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s/agent-handshake", net.JoinHostPort(schedulerIP, strconv.Itoa(int(config.Scheduler.RequestPort))))
+
+	request, err := http.NewRequestWithContext(reqCtx, http.MethodPost, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("Error building request to %q: %w", url, err)
+	}
+	request.Header.Set("content-type", "application/json")
+	request.Header.Set("authorization", "Bearer "+token)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		description := fmt.Sprintf("[error doing request: %s]", util.RootError(err))
+		s.metrics.schedulerHandshakes.WithLabelValues(description).Inc()
+		return fmt.Errorf("Error doing request: %w", err)
+	}
+	defer response.Body.Close()
+
+	s.metrics.schedulerHandshakes.WithLabelValues(strconv.Itoa(response.StatusCode)).Inc()
+
+	respBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("Error reading body for response: %w", err)
+	}
+
+	if response.StatusCode != 200 {
+		return fmt.Errorf("Received response status %d body %q", response.StatusCode, string(respBody))
+	}
+
+	var resp api.PluginHandshakeResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return fmt.Errorf("Bad JSON response: %w", err)
+	}
+
+	logger.Debug("Received handshake response from scheduler", zap.Any("response", resp), zap.Int("pods", len(pods)))
+
+	if _, ok := resp.ProtoRange.LatestSharedVersion(api.VersionRange[api.PluginProtoVersion]{
+		Min: PluginProtocolVersion,
+		Max: PluginProtocolVersion,
+	}); !ok {
+		logger.Warn(
+			"Scheduler plugin does not support our protocol version",
+			zap.Stringer("protoVersion", PluginProtocolVersion),
+			zap.Stringer("pluginRange", resp.ProtoRange),
+		)
+	}
+	if config.Scheduler.EnableProtobuf && !slices.Contains(resp.Capabilities, api.CapabilityProtobuf) {
+		logger.Warn("Protobuf is enabled, but the scheduler plugin does not support it")
+	}
+	if resp.TimeoutSeconds != 0 && config.Scheduler.HandshakeIntervalSeconds >= resp.TimeoutSeconds {
+		logger.Warn(
+			"Handshake interval is not less than the scheduler plugin's timeout",
+			zap.Uint("intervalSeconds", config.Scheduler.HandshakeIntervalSeconds),
+			zap.Uint("timeoutSeconds", resp.TimeoutSeconds),
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+type receivedHandshake struct {
+	method string
+	header http.Header
+	body   []byte
+}
+
+// startTestScheduler starts a server for the scheduler plugin's /agent-handshake endpoint that
+// responds with the status and body, returning the address it's listening on and a channel of the
+// requests received.
+func startTestScheduler(t *testing.T, status int, body string) (host string, port uint16, requests <-chan receivedHandshake) {
+	reqs := make(chan receivedHandshake, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/agent-handshake", r.URL.Path)
+		reqBody, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		reqs <- receivedHandshake{method: r.Method, header: r.Header, body: reqBody}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	host, portStr, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	p, err := strconv.ParseUint(portStr, 10, 16)
+	require.NoError(t, err)
+	return host, uint16(p), reqs
+}
+
+func newTestHandshakeState(port uint16) *agentState {
+	metrics, _ := makeGlobalMetrics()
+	//nolint:exhaustruct // only the config used by handshakes
+	config := &Config{Scheduler: SchedulerConfig{
+		RequestTimeoutSeconds:    5,
+		RequestPort:              port,
+		EnableProtobuf:           true,
+		HandshakeIntervalSeconds: 10,
+	}}
+	//nolint:exhaustruct // only the fields used by handshakes
+	return &agentState{
+		lock: util.NewChanMutex(),
+		pods: map[util.NamespacedName]*podState{
+			{Namespace: "default", Name: "pod"}: nil,
+		},
+		podIP:   "10.0.0.1",
+		config:  util.NewBroadcastValue(config),
+		metrics: metrics,
+	}
+}
+
+func TestSchedulerHandshake(t *testing.T) {
+	respBody, err := json.Marshal(api.PluginHandshakeResponse{
+		ProtoRange: api.VersionRange[api.PluginProtoVersion]{
+			Min: api.PluginProtoV5_0,
+			Max: api.PluginProtoV5_1,
+		},
+		Capabilities:   []api.ProtocolCapability{api.CapabilityProtobuf, api.CapabilityDenialReasons},
+		TimeoutSeconds: 60,
+	})
+	require.NoError(t, err)
+	host, port, requests := startTestScheduler(t, 200, string(respBody))
+	s := newTestHandshakeState(port)
+
+	err = s.doSchedulerHandshake(context.Background(), zap.NewNop(), host, "token", "node-1")
+	require.NoError(t, err)
+
+	req := <-requests
+	assert.Equal(t, http.MethodPost, req.method)
+	assert.Equal(t, "Bearer token", req.header.Get("Authorization"))
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+
+	assert.NoError(t, api.AgentHandshakeSchema().Validate(req.body))
+	var handshake api.AgentHandshake
+	require.NoError(t, json.Unmarshal(req.body, &handshake))
+	assert.Equal(t, api.AgentHandshake{
+		ProtoVersion: PluginProtocolVersion,
+		Node:         "node-1",
+		AgentIP:      "10.0.0.1",
+		Capabilities: []api.ProtocolCapability{api.CapabilityDenialReasons, api.CapabilityProtobuf},
+		Pods:         []util.NamespacedName{{Namespace: "default", Name: "pod"}},
+	}, handshake)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.schedulerHandshakes.WithLabelValues("200")))
+}
+
+func TestSchedulerHandshakeErrors(t *testing.T) {
+	t.Run("ErrorStatus", func(t *testing.T) {
+		host, port, requests := startTestScheduler(t, 401, "invalid token")
+		s := newTestHandshakeState(port)
+
+		err := s.doSchedulerHandshake(context.Background(), zap.NewNop(), host, "bad-token", "node-1")
+		<-requests
+		assert.EqualError(t, err, `Received response status 401 body "invalid token"`)
+		assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.schedulerHandshakes.WithLabelValues("401")))
+	})
+
+	t.Run("BadJSON", func(t *testing.T) {
+		host, port, requests := startTestScheduler(t, 200, "not json")
+		s := newTestHandshakeState(port)
+
+		err := s.doSchedulerHandshake(context.Background(), zap.NewNop(), host, "token", "node-1")
+		<-requests
+		assert.ErrorContains(t, err, "Bad JSON response")
+	})
+}
@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tychoish/fun/srv"
+	"go.uber.org/zap"
+
+	"github.com/neondatabase/autoscaling/pkg/agent/schedwatch"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+// healthServerPort is the port serving /healthz and /readyz
+const healthServerPort = 8081
+
+// startHealthServer starts the server for the autoscaler-agent's liveness and readiness probes.
+//
+// /healthz only checks that the agent is running. /readyz additionally runs the checks.
+func startHealthServer(ctx context.Context, logger *zap.Logger, checks ...util.HealthCheck) error {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", util.HealthHandler())
+	mux.Handle("/readyz", util.HealthHandler(checks...))
+
+	logger.Info("Starting health server")
+	hs := srv.HTTP("agent-health", time.Second, &http.Server{
+		Addr:              fmt.Sprintf("0.0.0.0:%d", healthServerPort),
+		Handler:           mux,
+		ReadHeaderTimeout: time.Second,
+	})
+	if err := hs.Start(ctx); err != nil {
+		return fmt.Errorf("Error starting health server: %w", err)
+	}
+	if err := srv.GetOrchestrator(ctx).Add(hs); err != nil {
+		return fmt.Errorf("Error adding health server to orchestrator: %w", err)
+	}
+	return nil
+}
+
+// schedulerHealthCheck returns a HealthCheck that passes if there's a ready scheduler and we can
+// connect to its plugin's request port.
+func schedulerHealthCheck(tracker *schedwatch.SchedulerTracker, port uint16) util.HealthCheck {
+	return util.HealthCheck{
+		Name: "scheduler",
+		Check: func(ctx context.Context) error {
+			sched := tracker.Get()
+			if sched == nil {
+				return errors.New("no ready scheduler")
+			}
+
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(sched.IP, strconv.Itoa(int(port))))
+			if err != nil {
+				return fmt.Errorf("scheduler %v is unreachable: %w", sched.PodName, err)
+			}
+			return conn.Close()
+		},
+	}
+}
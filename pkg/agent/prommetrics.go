@@ -9,13 +9,17 @@ import (
 	"github.com/samber/lo"
 
 	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/agent/core"
 	"github.com/neondatabase/autoscaling/pkg/agent/core/revsource"
 	"github.com/neondatabase/autoscaling/pkg/agent/scalingevents"
+	"github.com/neondatabase/autoscaling/pkg/api"
 	"github.com/neondatabase/autoscaling/pkg/util"
 )
 
 type GlobalMetrics struct {
 	schedulerRequests        *prometheus.CounterVec
+	schedulerDenials         *prometheus.CounterVec
+	schedulerHandshakes      *prometheus.CounterVec
 	schedulerRequestedChange resourceChangePair
 	schedulerApprovedChange  resourceChangePair
 
@@ -30,6 +34,8 @@ type GlobalMetrics struct {
 	neonvmRequestsOutbound *prometheus.CounterVec
 	neonvmRequestedChange  resourceChangePair
 
+	monitorCircuitBreakerTrips prometheus.Counter
+
 	runnersCount       *prometheus.GaugeVec
 	runnerThreadPanics prometheus.Counter
 	runnerStarts       prometheus.Counter
@@ -40,6 +46,8 @@ type GlobalMetrics struct {
 	pluginLatency  prometheus.HistogramVec
 	monitorLatency prometheus.HistogramVec
 	neonvmLatency  prometheus.HistogramVec
+
+	rateLimiters util.RateLimiterMetrics
 }
 
 func (m *GlobalMetrics) PluginLatency() *prometheus.HistogramVec {
@@ -73,6 +81,10 @@ const (
 	runnerMetricStateOk       runnerMetricState = "ok"
 	runnerMetricStateStuck    runnerMetricState = "stuck"
 	runnerMetricStatePanicked runnerMetricState = "panicked"
+	// runnerMetricStateDegraded indicates that the runner has given up on regularly reconnecting
+	// to the vm-monitor, and is only occasionally probing the connection. This takes precedence
+	// over runnerMetricStateStuck, because it's the more specific reason.
+	runnerMetricStateDegraded runnerMetricState = "degraded"
 )
 
 // Copied bucket values from controller runtime latency metric. We can
@@ -104,6 +116,20 @@ func makeGlobalMetrics() (GlobalMetrics, *prometheus.Registry) {
 			},
 			[]string{"code"},
 		)),
+		schedulerDenials: util.RegisterMetric(reg, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "autoscaling_agent_scheduler_plugin_denials_total",
+				Help: "Number of responses from the scheduler plugin that did not grant all requested resources, by reason",
+			},
+			[]string{"reason"},
+		)),
+		schedulerHandshakes: util.RegisterMetric(reg, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "autoscaling_agent_scheduler_plugin_handshakes_total",
+				Help: "Number of attempted handshakes with the scheduler plugin by autoscaler-agents",
+			},
+			[]string{"code"},
+		)),
 		schedulerRequestedChange: resourceChangePair{
 			cpu: util.RegisterMetric(reg, prometheus.NewCounterVec(
 				prometheus.CounterOpts{
@@ -226,13 +252,20 @@ func makeGlobalMetrics() (GlobalMetrics, *prometheus.Registry) {
 			)),
 		},
 
+		monitorCircuitBreakerTrips: util.RegisterMetric(reg, prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "autoscaling_agent_monitor_circuit_breaker_trips_total",
+				Help: "Number of times a runner stopped regularly reconnecting to the vm-monitor after repeated failures",
+			},
+		)),
+
 		// ---- RUNNER LIFECYCLE ----
 		runnersCount: util.RegisterMetric(reg, prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "autoscaling_agent_runners_current",
 				Help: "Number of per-VM runners, with associated metadata",
 			},
-			// NB: is_endpoint ∈ ("true", "false"), state ∈ runnerMetricState = ("ok", "stuck", "errored", "panicked")
+			// NB: is_endpoint ∈ ("true", "false"), state ∈ runnerMetricState = ("ok", "stuck", "degraded", "panicked")
 			[]string{"is_endpoint", "state"},
 		)),
 		runnerThreadPanics: util.RegisterMetric(reg, prometheus.NewCounter(
@@ -292,6 +325,8 @@ func makeGlobalMetrics() (GlobalMetrics, *prometheus.Registry) {
 			},
 			[]string{directionLabel},
 		)),
+
+		rateLimiters: util.NewRateLimiterMetrics("autoscaling_agent_rate_limiter", reg),
 	}
 
 	// Some of of the metrics should have default keys set to zero. Otherwise, these won't be filled
@@ -317,6 +352,7 @@ func makeGlobalMetrics() (GlobalMetrics, *prometheus.Registry) {
 	runnerStates := []runnerMetricState{
 		runnerMetricStateOk,
 		runnerMetricStateStuck,
+		runnerMetricStateDegraded,
 		runnerMetricStatePanicked,
 	}
 	for _, s := range runnerStates {
@@ -359,6 +395,9 @@ type PerVMMetrics struct {
 	restartCount *prometheus.GaugeVec
 	desiredCU    *prometheus.GaugeVec
 	extraIP      *prometheus.GaugeVec
+	loadAverage  *prometheus.GaugeVec
+	memoryUsage  *prometheus.GaugeVec
+	shadowGoalCU *prometheus.GaugeVec
 }
 
 type vmMetadata struct {
@@ -434,6 +473,33 @@ func makePerVMMetrics() (*PerVMMetrics, *prometheus.Registry) {
 			},
 			makeLabels(),
 		)),
+		loadAverage: util.RegisterMetric(reg, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "autoscaling_vm_load_average",
+				Help: "Load average for a VM, as most recently fetched from inside the VM",
+			},
+			makeLabels(
+				"window", // load average window: 1m, 5m
+			),
+		)),
+		memoryUsage: util.RegisterMetric(reg, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "autoscaling_vm_memory_usage_bytes",
+				Help: "Memory usage in bytes for a VM, as most recently fetched from inside the VM",
+			},
+			makeLabels(
+				"kind", // memory usage kind: used, cached
+			),
+		)),
+		shadowGoalCU: util.RegisterMetric(reg, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "autoscaling_vm_shadow_goal_cu",
+				Help: "Goal Compute Units for a VM from the active scaling config and the shadow scaling config, if enabled",
+			},
+			makeLabels(
+				"algorithm", // which scaling config the goal came from: active, shadow
+			),
+		)),
 	}
 
 	return metrics, reg
@@ -468,10 +534,14 @@ func (m *PerVMMetrics) deleteActive(vm *vmv1.VirtualMachine) {
 
 	delete(m.activeVMs, util.GetNamespacedName(vm))
 	// ... and any metrics that were associated with it:
-	m.desiredCU.DeletePartialMatch(prometheus.Labels{
+	vmLabels := prometheus.Labels{
 		"vm_namespace": vm.Namespace,
 		"vm_name":      vm.Name,
-	})
+	}
+	m.desiredCU.DeletePartialMatch(vmLabels)
+	m.loadAverage.DeletePartialMatch(vmLabels)
+	m.memoryUsage.DeletePartialMatch(vmLabels)
+	m.shadowGoalCU.DeletePartialMatch(vmLabels)
 }
 
 // vmMetric is a data object that represents a single metric
@@ -484,7 +554,7 @@ type vmMetric struct {
 func (m *PerVMMetrics) updateDesiredCU(
 	vm util.NamespacedName,
 	cuMultiplier float64,
-	total uint32,
+	total api.ComputeUnits,
 	parts scalingevents.GoalCUComponents,
 ) {
 	m.activeMu.Lock()
@@ -502,10 +572,11 @@ func (m *PerVMMetrics) updateDesiredCU(
 		component string
 		value     *float64
 	}{
-		{"total", lo.ToPtr(float64(total))},
+		{"total", lo.ToPtr(total.AsFloat64())},
 		{"cpu", parts.CPU},
 		{"mem", parts.Mem},
 		{"lfc", parts.LFC},
+		{"connections", parts.Connections},
 	}
 
 	for _, p := range pairs {
@@ -523,3 +594,53 @@ func (m *PerVMMetrics) updateDesiredCU(
 		}
 	}
 }
+
+func (m *PerVMMetrics) updateSystemMetrics(vm util.NamespacedName, metrics core.SystemMetrics) {
+	m.activeMu.Lock()
+	defer m.activeMu.Unlock()
+
+	// Same as updateDesiredCU: don't leak metrics for VMs that are no longer known.
+	info, ok := m.activeVMs[vm]
+	if !ok {
+		return
+	}
+
+	labels := func(name string, value string) prometheus.Labels {
+		return prometheus.Labels{
+			"vm_namespace": vm.Namespace,
+			"vm_name":      vm.Name,
+			"endpoint_id":  info.endpointID,
+			"project_id":   info.projectID,
+			name:           value,
+		}
+	}
+
+	m.loadAverage.With(labels("window", "1m")).Set(metrics.LoadAverage1Min)
+	m.loadAverage.With(labels("window", "5m")).Set(metrics.LoadAverage5Min)
+	m.memoryUsage.With(labels("kind", "used")).Set(metrics.MemoryUsageBytes)
+	m.memoryUsage.With(labels("kind", "cached")).Set(metrics.MemoryCachedBytes)
+}
+
+func (m *PerVMMetrics) updateShadowGoalCU(vm util.NamespacedName, cuMultiplier float64, active, shadow api.ComputeUnits) {
+	m.activeMu.Lock()
+	defer m.activeMu.Unlock()
+
+	// Same as updateDesiredCU: don't leak metrics for VMs that are no longer known.
+	info, ok := m.activeVMs[vm]
+	if !ok {
+		return
+	}
+
+	labels := func(algorithm string) prometheus.Labels {
+		return prometheus.Labels{
+			"vm_namespace": vm.Namespace,
+			"vm_name":      vm.Name,
+			"endpoint_id":  info.endpointID,
+			"project_id":   info.projectID,
+			"algorithm":    algorithm,
+		}
+	}
+
+	m.shadowGoalCU.With(labels("active")).Set(active.AsFloat64() * cuMultiplier)
+	m.shadowGoalCU.With(labels("shadow")).Set(shadow.AsFloat64() * cuMultiplier)
+}
@@ -0,0 +1,32 @@
+package remotewrite
+
+// Prometheus metrics for the agent's remote-write subsystem
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+type PromMetrics struct {
+	pushesTotal *prometheus.CounterVec
+	seriesTotal prometheus.Counter
+}
+
+func NewPromMetrics(reg prometheus.Registerer) PromMetrics {
+	return PromMetrics{
+		pushesTotal: util.RegisterMetric(reg, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "autoscaling_agent_remote_write_pushes_total",
+				Help: "Total number of attempts to push per-VM metrics to the remote-write endpoint",
+			},
+			[]string{"outcome"},
+		)),
+		seriesTotal: util.RegisterMetric(reg, prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "autoscaling_agent_remote_write_series_total",
+				Help: "Total number of series included in pushes to the remote-write endpoint",
+			},
+		)),
+	}
+}
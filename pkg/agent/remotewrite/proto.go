@@ -0,0 +1,74 @@
+package remotewrite
+
+// Minimal protobuf encoding of the Prometheus remote-write WriteRequest message.
+//
+// Refer to prometheus/prompb/remote.proto and types.proto for the message definitions. We only
+// need the subset of fields required to push a single sample per series.
+
+import (
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type timeSeries struct {
+	labels []label
+	sample sample
+}
+
+type label struct {
+	name  string
+	value string
+}
+
+type sample struct {
+	value     float64
+	timestamp int64 // milliseconds since the unix epoch
+}
+
+const (
+	writeRequestTimeseriesField protowire.Number = 1
+
+	timeSeriesLabelsField  protowire.Number = 1
+	timeSeriesSamplesField protowire.Number = 2
+
+	labelNameField  protowire.Number = 1
+	labelValueField protowire.Number = 2
+
+	sampleValueField     protowire.Number = 1
+	sampleTimestampField protowire.Number = 2
+)
+
+func encodeWriteRequest(series []timeSeries) []byte {
+	var buf []byte
+	for _, ts := range series {
+		buf = appendMessage(buf, writeRequestTimeseriesField, encodeTimeSeries(ts))
+	}
+	return buf
+}
+
+func encodeTimeSeries(ts timeSeries) []byte {
+	var buf []byte
+	for _, l := range ts.labels {
+		var lbuf []byte
+		lbuf = protowire.AppendTag(lbuf, labelNameField, protowire.BytesType)
+		lbuf = protowire.AppendString(lbuf, l.name)
+		lbuf = protowire.AppendTag(lbuf, labelValueField, protowire.BytesType)
+		lbuf = protowire.AppendString(lbuf, l.value)
+		buf = appendMessage(buf, timeSeriesLabelsField, lbuf)
+	}
+
+	var sbuf []byte
+	sbuf = protowire.AppendTag(sbuf, sampleValueField, protowire.Fixed64Type)
+	sbuf = protowire.AppendFixed64(sbuf, math.Float64bits(ts.sample.value))
+	sbuf = protowire.AppendTag(sbuf, sampleTimestampField, protowire.VarintType)
+	sbuf = protowire.AppendVarint(sbuf, uint64(ts.sample.timestamp))
+	buf = appendMessage(buf, timeSeriesSamplesField, sbuf)
+
+	return buf
+}
+
+func appendMessage(buf []byte, field protowire.Number, msg []byte) []byte {
+	buf = protowire.AppendTag(buf, field, protowire.BytesType)
+	return protowire.AppendBytes(buf, msg)
+}
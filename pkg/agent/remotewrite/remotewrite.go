@@ -0,0 +1,157 @@
+package remotewrite
+
+// Periodically pushing the contents of a prometheus registry to a remote-write endpoint.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/prometheus/client_golang/prometheus"
+	promclient "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"go.uber.org/zap"
+)
+
+type Config struct {
+	// URL is the remote-write endpoint to push to, e.g. "https://example.com/api/v1/push".
+	URL string `json:"url"`
+	// PushIntervalSeconds gives the duration, in seconds, between pushes of the current metrics.
+	PushIntervalSeconds uint `json:"pushIntervalSeconds"`
+	// RequestTimeoutSeconds gives the maximum duration, in seconds, that we allow for a single push.
+	RequestTimeoutSeconds uint `json:"requestTimeoutSeconds"`
+	// ExtraLabels are added to every series that we push, e.g. to identify the tenant or region.
+	// They take precedence over labels of the same name on the metrics themselves.
+	ExtraLabels map[string]string `json:"extraLabels,omitempty"`
+	// Headers are added to every request, e.g. "X-Scope-OrgID" for multi-tenant backends.
+	//
+	// Header values may contain credentials, so they are redacted when the config is logged.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Run periodically gathers the metrics from source and pushes them to the configured endpoint,
+// until the context is canceled.
+//
+// Failed pushes are logged and not retried; the next push will include the latest values anyways.
+func Run(
+	ctx context.Context,
+	logger *zap.Logger,
+	conf *Config,
+	source prometheus.Gatherer,
+	metrics PromMetrics,
+) error {
+	client := &http.Client{} //nolint:exhaustruct // default values are fine
+	ticker := time.NewTicker(time.Second * time.Duration(conf.PushIntervalSeconds))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if err := push(ctx, client, conf, source, metrics); err != nil {
+			metrics.pushesTotal.WithLabelValues("failure").Inc()
+			logger.Warn("Failed to push metrics", zap.Error(err))
+		} else {
+			metrics.pushesTotal.WithLabelValues("success").Inc()
+		}
+	}
+}
+
+func push(
+	ctx context.Context,
+	client *http.Client,
+	conf *Config,
+	source prometheus.Gatherer,
+	metrics PromMetrics,
+) error {
+	families, err := source.Gather()
+	if err != nil {
+		return fmt.Errorf("could not gather metrics: %w", err)
+	}
+
+	series := toTimeSeries(families, conf.ExtraLabels, time.Now())
+	if len(series) == 0 {
+		return nil
+	}
+	metrics.seriesTotal.Add(float64(len(series)))
+
+	body := s2.EncodeSnappy(nil, encodeWriteRequest(series))
+
+	reqCtx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(conf.RequestTimeoutSeconds))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not build request: %w", err)
+	}
+	for name, value := range conf.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "autoscaler-agent")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// toTimeSeries converts the gauges, counters, and untyped metrics in families to a single sample
+// each at the given time. Histograms and summaries are skipped.
+func toTimeSeries(families []*promclient.MetricFamily, extraLabels map[string]string, now time.Time) []timeSeries {
+	timestamp := now.UnixMilli()
+
+	var series []timeSeries
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			var value float64
+			switch family.GetType() {
+			case promclient.MetricType_GAUGE:
+				value = m.GetGauge().GetValue()
+			case promclient.MetricType_COUNTER:
+				value = m.GetCounter().GetValue()
+			case promclient.MetricType_UNTYPED:
+				value = m.GetUntyped().GetValue()
+			default:
+				continue
+			}
+
+			labels := []label{{name: model.MetricNameLabel, value: family.GetName()}}
+			for _, l := range m.GetLabel() {
+				if _, overridden := extraLabels[l.GetName()]; !overridden {
+					labels = append(labels, label{name: l.GetName(), value: l.GetValue()})
+				}
+			}
+			for name, value := range extraLabels {
+				labels = append(labels, label{name: name, value: value})
+			}
+			// Remote-write requires labels to be sorted by name.
+			slices.SortFunc(labels, func(x, y label) int { return strings.Compare(x.name, y.name) })
+
+			series = append(series, timeSeries{
+				labels: labels,
+				sample: sample{value: value, timestamp: timestamp},
+			})
+		}
+	}
+	return series
+}
@@ -0,0 +1,135 @@
+package remotewrite
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest is the inverse of encodeWriteRequest, for checking what the receiver got.
+func decodeWriteRequest(t *testing.T, buf []byte) []timeSeries {
+	var series []timeSeries
+	forEachField(t, buf, func(num protowire.Number, msg []byte) {
+		require.Equal(t, writeRequestTimeseriesField, num)
+
+		var ts timeSeries
+		forEachField(t, msg, func(num protowire.Number, msg []byte) {
+			switch num {
+			case timeSeriesLabelsField:
+				var l label
+				forEachField(t, msg, func(num protowire.Number, value []byte) {
+					if num == labelNameField {
+						l.name = string(value)
+					} else {
+						l.value = string(value)
+					}
+				})
+				ts.labels = append(ts.labels, l)
+			case timeSeriesSamplesField:
+				tag, n := takeTag(t, msg)
+				require.Equal(t, sampleValueField, tag)
+				bits, m := protowire.ConsumeFixed64(msg[n:])
+				require.GreaterOrEqual(t, m, 0)
+				ts.sample.value = math.Float64frombits(bits)
+
+				msg = msg[n+m:]
+				tag, n = takeTag(t, msg)
+				require.Equal(t, sampleTimestampField, tag)
+				timestamp, m := protowire.ConsumeVarint(msg[n:])
+				require.GreaterOrEqual(t, m, 0)
+				ts.sample.timestamp = int64(timestamp)
+			}
+		})
+		series = append(series, ts)
+	})
+	return series
+}
+
+// forEachField calls f with the contents of each length-delimited field in buf
+func forEachField(t *testing.T, buf []byte, f func(protowire.Number, []byte)) {
+	for len(buf) != 0 {
+		num, n := takeTag(t, buf)
+		msg, m := protowire.ConsumeBytes(buf[n:])
+		require.GreaterOrEqual(t, m, 0)
+		f(num, msg)
+		buf = buf[n+m:]
+	}
+}
+
+func takeTag(t *testing.T, buf []byte) (protowire.Number, int) {
+	num, _, n := protowire.ConsumeTag(buf)
+	require.GreaterOrEqual(t, n, 0)
+	return num, n
+}
+
+func TestPush(t *testing.T) {
+	type received struct {
+		header http.Header
+		series []timeSeries
+	}
+	requests := make(chan received, 1)
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		decoded, err := s2.Decode(nil, body)
+		require.NoError(t, err)
+		requests <- received{header: r.Header, series: decodeWriteRequest(t, decoded)}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer server.Close()
+
+	reg := prometheus.NewRegistry()
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "vm_cpu", Help: "test"}, []string{"vm", "region"})
+	reg.MustRegister(gauge)
+	gauge.WithLabelValues("vm-1", "from-metric").Set(1.5)
+	// histograms can't be represented with a single sample, so they're skipped
+	reg.MustRegister(prometheus.NewHistogram(prometheus.HistogramOpts{Name: "vm_latency", Help: "test"}))
+
+	conf := &Config{
+		URL:                   server.URL,
+		PushIntervalSeconds:   1,
+		RequestTimeoutSeconds: 5,
+		ExtraLabels:           map[string]string{"region": "test-region"},
+		Headers:               map[string]string{"X-Scope-OrgID": "tenant"},
+	}
+	metrics := NewPromMetrics(prometheus.NewRegistry())
+
+	before := time.Now().UnixMilli()
+	err := push(context.Background(), http.DefaultClient, conf, reg, metrics)
+	require.NoError(t, err)
+
+	req := <-requests
+	assert.Equal(t, "snappy", req.header.Get("Content-Encoding"))
+	assert.Equal(t, "application/x-protobuf", req.header.Get("Content-Type"))
+	assert.Equal(t, "0.1.0", req.header.Get("X-Prometheus-Remote-Write-Version"))
+	assert.Equal(t, "tenant", req.header.Get("X-Scope-OrgID"))
+
+	require.Len(t, req.series, 1)
+	// labels are sorted, and extra labels take precedence over the metric's own
+	assert.Equal(t, []label{
+		{name: "__name__", value: "vm_cpu"},
+		{name: "region", value: "test-region"},
+		{name: "vm", value: "vm-1"},
+	}, req.series[0].labels)
+	assert.Equal(t, 1.5, req.series[0].sample.value)
+	assert.GreaterOrEqual(t, req.series[0].sample.timestamp, before)
+
+	// Errors from the receiver are returned, so that the push is counted as failed
+	status.Store(http.StatusBadRequest)
+	err = push(context.Background(), http.DefaultClient, conf, reg, metrics)
+	<-requests
+	assert.ErrorContains(t, err, "400")
+}
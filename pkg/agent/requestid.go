@@ -0,0 +1,95 @@
+package agent
+
+// Idempotency keys for requests to the scheduler plugin and vm-monitor.
+//
+// Each request gets a new ID, except when it's a retry of a failed request -- i.e., the previous
+// request had the same contents and didn't succeed. In that case, the previous ID is reused so
+// that the receiver can recognize that it may have already handled the request (e.g., if our
+// request timed out after the scheduler plugin had already reserved resources for it).
+
+import (
+	"sync"
+
+	"github.com/lithammer/shortuuid"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+// requestIDs tracks the ID of the last request with contents K, so that retries can reuse it.
+type requestIDs[K comparable] struct {
+	mu sync.Mutex
+
+	lastKey K
+	lastID  string
+	// lastFailed is true if the last request (with lastKey and lastID) did not succeed.
+	lastFailed bool
+}
+
+func newRequestIDs[K comparable]() *requestIDs[K] {
+	var zero K
+	return &requestIDs[K]{
+		mu:         sync.Mutex{},
+		lastKey:    zero,
+		lastID:     "",
+		lastFailed: false,
+	}
+}
+
+// next returns the ID to use for a request with the given contents, and whether it's a retry.
+//
+// The result of the request must be reported with finish.
+func (r *requestIDs[K]) next(key K) (id string, retry bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.lastFailed && r.lastID != "" && r.lastKey == key {
+		return r.lastID, true
+	}
+
+	r.lastKey = key
+	r.lastID = shortuuid.New()
+	r.lastFailed = false
+	return r.lastID, false
+}
+
+// finish records the result of the request with the ID, which must have been returned by next.
+func (r *requestIDs[K]) finish(id string, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Ignore results from requests that have since been superseded.
+	if id == r.lastID {
+		r.lastFailed = !ok
+	}
+}
+
+// schedulerRequestKey is the part of an AgentRequest that determines whether a request is a retry
+// of the previous one.
+//
+// Metrics are excluded because they change with every request but don't affect handling.
+type schedulerRequestKey struct {
+	resources     api.Resources
+	lastPermit    api.Resources
+	hasLastPermit bool
+	departing     bool
+}
+
+func schedulerRequestKeyFor(req *api.AgentRequest) schedulerRequestKey {
+	var lastPermit api.Resources
+	if req.LastPermit != nil {
+		lastPermit = *req.LastPermit
+	}
+	return schedulerRequestKey{
+		resources:     req.Resources,
+		lastPermit:    lastPermit,
+		hasLastPermit: req.LastPermit != nil,
+		departing:     req.Departing,
+	}
+}
+
+// monitorRequestKey is the part of a request to the vm-monitor that determines whether a request
+// is a retry of the previous one.
+type monitorRequestKey struct {
+	kind       string
+	allocation api.Allocation
+}
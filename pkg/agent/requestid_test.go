@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+func TestRequestIDs(t *testing.T) {
+	ids := newRequestIDs[string]()
+
+	first, retry := ids.next("a")
+	assert.False(t, retry)
+	assert.NotEmpty(t, first)
+
+	// Until the result is reported, a request with the same contents gets a new ID
+	second, retry := ids.next("a")
+	assert.False(t, retry)
+	assert.NotEqual(t, first, second)
+
+	// Retries of a failed request reuse its ID, until it succeeds
+	ids.finish(second, false)
+	id, retry := ids.next("a")
+	assert.True(t, retry)
+	assert.Equal(t, second, id)
+	id, retry = ids.next("a")
+	assert.True(t, retry)
+	assert.Equal(t, second, id)
+
+	ids.finish(second, true)
+	third, retry := ids.next("a")
+	assert.False(t, retry)
+	assert.NotEqual(t, second, third)
+
+	// A failed request with different contents isn't retried
+	ids.finish(third, false)
+	fourth, retry := ids.next("b")
+	assert.False(t, retry)
+	assert.NotEqual(t, third, fourth)
+
+	// ... and once it's superseded, the old request can't be retried either
+	id, retry = ids.next("a")
+	assert.False(t, retry)
+	assert.NotEqual(t, third, id)
+
+	// Results for superseded requests are ignored
+	ids.finish(fourth, false)
+	_, retry = ids.next("b")
+	assert.False(t, retry)
+}
+
+func TestSchedulerRequestKey(t *testing.T) {
+	req := api.AgentRequest{
+		ProtoVersion: api.PluginProtoV5_1,
+		Pod:          util.NamespacedName{Namespace: "default", Name: "pod"},
+		ComputeUnit:  api.Resources{VCPU: 250, Mem: 1 << 30},
+		Resources:    api.Resources{VCPU: 1000, Mem: 4 << 30},
+		LastPermit:   &api.Resources{VCPU: 500, Mem: 2 << 30},
+		Metrics:      &api.Metrics{LoadAverage1Min: 0.5, LoadAverage5Min: nil, MemoryUsageBytes: nil},
+		Departing:    false,
+		RequestID:    "",
+	}
+	key := schedulerRequestKeyFor(&req)
+
+	// Metrics and the ID don't affect whether it's a retry
+	other := req
+	other.Metrics = &api.Metrics{LoadAverage1Min: 2, LoadAverage5Min: nil, MemoryUsageBytes: nil}
+	other.RequestID = "id"
+	assert.Equal(t, key, schedulerRequestKeyFor(&other))
+
+	other = req
+	other.Resources.VCPU = 2000
+	assert.NotEqual(t, key, schedulerRequestKeyFor(&other))
+
+	// No last permit is different from a zero one
+	other = req
+	other.LastPermit = nil
+	withZero := req
+	withZero.LastPermit = &api.Resources{VCPU: 0, Mem: 0}
+	assert.NotEqual(t, schedulerRequestKeyFor(&withZero), schedulerRequestKeyFor(&other))
+
+	other = req
+	other.Departing = true
+	assert.NotEqual(t, key, schedulerRequestKeyFor(&other))
+}
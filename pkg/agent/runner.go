@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"net"
 	"net/http"
 	"runtime/debug"
 	"strconv"
@@ -28,6 +29,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/samber/lo"
 	"go.uber.org/zap"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -49,7 +51,7 @@ import (
 //
 // Currently, each autoscaler-agent supports only one version at a time. In the future, this may
 // change.
-const PluginProtocolVersion api.PluginProtoVersion = api.PluginProtoV5_0
+const PluginProtocolVersion api.PluginProtoVersion = api.PluginProtoV5_1
 
 // Runner is per-VM Pod god object responsible for handling everything
 //
@@ -78,6 +80,9 @@ type Runner struct {
 	// executorStateDump is set by (*Runner).Run and provides a way to get the state of the
 	// "executor"
 	executorStateDump func() executor.StateDump
+	// executorLastPermit is set by (*Runner).Run and provides a way to get the most recent permit
+	// received from the scheduler plugin, so that it can be included in the departing notice.
+	executorLastPermit func() *api.Resources
 
 	// monitor, if non nil, stores the current Dispatcher in use for communicating with the
 	// vm-monitor, alongside a generation number.
@@ -86,6 +91,19 @@ type Runner struct {
 	// which means that it may be read when EITHER holding lock OR the executor's lock.
 	monitor *monitorInfo
 
+	// schedulerDenial is the DenialReason most recently recorded on the VM object by
+	// recordSchedulerDenial, or nil if there was none. It's only accurate if schedulerDenialKnown
+	// is true, because we don't know what was on the VM before the first time we record it.
+	//
+	// Both fields are guarded by lock.
+	schedulerDenial      *api.DenialReason
+	schedulerDenialKnown bool
+
+	// schedulerRequestIDs and monitorRequestIDs provide the idempotency keys for requests to the
+	// scheduler plugin and vm-monitor, respectively. See requestid.go for more.
+	schedulerRequestIDs *requestIDs[schedulerRequestKey]
+	monitorRequestIDs   *requestIDs[monitorRequestKey]
+
 	// backgroundWorkerCount tracks the current number of background workers. It is exclusively
 	// updated by r.spawnBackgroundWorker
 	backgroundWorkerCount atomic.Int64
@@ -200,18 +218,19 @@ func (r *Runner) Run(ctx context.Context, logger *zap.Logger, vmInfoUpdated util
 	// "dsrl" stands for "desired scaling report limiter" -- helper to avoid spamming events.
 	dsrl := &desiredScalingReportLimiter{lastEvent: nil}
 	revisionSource := revsource.NewRevisionSource(initialRevision, WrapHistogramVec(&r.global.metrics.scalingLatency))
-	executorCore := executor.NewExecutorCore(coreExecLogger, vmInfo, executor.Config{
-		OnNextActions: r.global.metrics.runnerNextActions.Inc,
-		Core: core.Config{
-			ComputeUnit:                        r.global.config.Scaling.ComputeUnit,
-			DefaultScalingConfig:               r.global.config.Scaling.DefaultConfig,
-			NeonVMRetryWait:                    time.Second * time.Duration(r.global.config.NeonVM.RetryFailedRequestSeconds),
-			PluginRequestTick:                  time.Second*time.Duration(r.global.config.Scheduler.RequestAtLeastEverySeconds) - pluginRequestJitter,
-			PluginRetryWait:                    time.Second * time.Duration(r.global.config.Scheduler.RetryFailedRequestSeconds),
-			PluginDeniedRetryWait:              time.Second * time.Duration(r.global.config.Scheduler.RetryDeniedUpscaleSeconds),
-			MonitorDeniedDownscaleCooldown:     time.Second * time.Duration(r.global.config.Monitor.RetryDeniedDownscaleSeconds),
-			MonitorRequestedUpscaleValidPeriod: time.Second * time.Duration(r.global.config.Monitor.RequestedUpscaleValidSeconds),
-			MonitorRetryWait:                   time.Second * time.Duration(r.global.config.Monitor.RetryFailedRequestSeconds),
+	// makeCoreConfig is used both initially and whenever the global config is reloaded.
+	makeCoreConfig := func(config *Config) core.Config {
+		return core.Config{
+			ComputeUnit:                        config.Scaling.ComputeUnit,
+			DefaultScalingConfig:               config.Scaling.DefaultConfig,
+			ShadowScalingConfig:                config.Scaling.ShadowConfig,
+			NeonVMRetryWait:                    time.Second * time.Duration(config.NeonVM.RetryFailedRequestSeconds),
+			PluginRequestTick:                  time.Second*time.Duration(config.Scheduler.RequestAtLeastEverySeconds) - pluginRequestJitter,
+			PluginRetryWait:                    time.Second * time.Duration(config.Scheduler.RetryFailedRequestSeconds),
+			PluginDeniedRetryWait:              time.Second * time.Duration(config.Scheduler.RetryDeniedUpscaleSeconds),
+			MonitorDeniedDownscaleCooldown:     time.Second * time.Duration(config.Monitor.RetryDeniedDownscaleSeconds),
+			MonitorRequestedUpscaleValidPeriod: time.Second * time.Duration(config.Monitor.RequestedUpscaleValidSeconds),
+			MonitorRetryWait:                   time.Second * time.Duration(config.Monitor.RetryFailedRequestSeconds),
 			Log: core.LogConfig{
 				Info: coreExecLogger.Info,
 				Warn: coreExecLogger.Warn,
@@ -222,18 +241,35 @@ func (r *Runner) Run(ctx context.Context, logger *zap.Logger, vmInfoUpdated util
 				MonitorLatency: WrapHistogramVec(&r.global.metrics.monitorLatency),
 				NeonVMLatency:  WrapHistogramVec(&r.global.metrics.neonvmLatency),
 				ActualScaling:  r.reportScalingEvent,
-				HypotheticalScaling: func(ts time.Time, current, target uint32, parts core.ScalingGoalParts) {
+				HypotheticalScaling: func(ts time.Time, current, target api.ComputeUnits, parts core.ScalingGoalParts) {
 					r.reportDesiredScaling(dsrl, ts, current, target, scalingevents.GoalCUComponents{
 						CPU: parts.CPU,
 						Mem: parts.Mem,
 						LFC: parts.LFC,
+
+						Connections: parts.Connections,
 					})
 				},
+				ShadowScaling: func(ts time.Time, current, active, shadow api.ComputeUnits) {
+					r.global.vmMetrics.updateShadowGoalCU(
+						r.vmName,
+						r.global.config.Load().ScalingEvents.CUMultiplier, // have to multiply before exposing as metrics here.
+						active,
+						shadow,
+					)
+				},
 			},
-		},
+		}
+	}
+	// Fetch the initial config from the receiver, so that we can't miss any changes after it.
+	configUpdated := r.global.config.NewReceiver()
+	executorCore := executor.NewExecutorCore(coreExecLogger, vmInfo, executor.Config{
+		OnNextActions: r.global.metrics.runnerNextActions.Inc,
+		Core:          makeCoreConfig(configUpdated.Awake()),
 	})
 
 	r.executorStateDump = executorCore.StateDump
+	r.executorLastPermit = executorCore.LastPermit
 
 	monitorGeneration := executor.NewStoredGenerationNumber()
 
@@ -270,17 +306,31 @@ func (r *Runner) Run(ctx context.Context, logger *zap.Logger, vmInfoUpdated util
 			}
 		}
 	})
+	r.spawnBackgroundWorker(ctx, logger, "config updater", func(ctx2 context.Context, logger2 *zap.Logger) {
+		for {
+			select {
+			case <-ctx2.Done():
+				return
+			case <-configUpdated.Wait():
+				config := configUpdated.Awake()
+				ecwc.Updater().UpdatedConfig(makeCoreConfig(config), func() {
+					logger2.Info("Updated executor with reloaded config")
+				})
+			}
+		}
+	})
 	r.spawnBackgroundWorker(ctx, logger, "get system metrics", func(ctx2 context.Context, logger2 *zap.Logger) {
 		getMetricsLoop(
 			r,
 			ctx2,
 			logger2,
-			r.global.config.Metrics.System,
+			func(c *Config) MetricsSourceConfig { return c.Metrics.System },
 			metricsMgr[*core.SystemMetrics]{
 				kind:         "system",
 				emptyMetrics: func() *core.SystemMetrics { return new(core.SystemMetrics) },
 				isActive:     func() bool { return true },
 				updateMetrics: func(metrics *core.SystemMetrics, withLock func()) {
+					r.global.vmMetrics.updateSystemMetrics(r.vmName, *metrics)
 					ecwc.Updater().UpdateSystemMetrics(*metrics, withLock)
 				},
 			},
@@ -291,12 +341,12 @@ func (r *Runner) Run(ctx context.Context, logger *zap.Logger, vmInfoUpdated util
 			r,
 			ctx2,
 			logger2,
-			r.global.config.Metrics.LFC,
+			func(c *Config) MetricsSourceConfig { return c.Metrics.LFC },
 			metricsMgr[*core.LFCMetrics]{
 				kind:         "LFC",
 				emptyMetrics: func() *core.LFCMetrics { return new(core.LFCMetrics) },
 				isActive: func() bool {
-					scalingConfig := r.global.config.Scaling.DefaultConfig.WithOverrides(getVmInfo().Config.ScalingConfig)
+					scalingConfig := r.global.config.Load().Scaling.DefaultConfig.WithOverrides(getVmInfo().Config.ScalingConfig)
 					return *scalingConfig.EnableLFCMetrics // guaranteed non-nil as a required field.
 				},
 				updateMetrics: func(metrics *core.LFCMetrics, withLock func()) {
@@ -305,6 +355,25 @@ func (r *Runner) Run(ctx context.Context, logger *zap.Logger, vmInfoUpdated util
 			},
 		)
 	})
+	r.spawnBackgroundWorker(ctx, logger, "get connection metrics", func(ctx2 context.Context, logger2 *zap.Logger) {
+		getMetricsLoop(
+			r,
+			ctx2,
+			logger2,
+			func(c *Config) MetricsSourceConfig { return c.Metrics.Connections },
+			metricsMgr[*core.ConnectionMetrics]{
+				kind:         "connections",
+				emptyMetrics: func() *core.ConnectionMetrics { return new(core.ConnectionMetrics) },
+				isActive: func() bool {
+					scalingConfig := r.global.config.Load().Scaling.DefaultConfig.WithOverrides(getVmInfo().Config.ScalingConfig)
+					return *scalingConfig.EnableConnectionMetrics // guaranteed non-nil as a required field.
+				},
+				updateMetrics: func(metrics *core.ConnectionMetrics, withLock func()) {
+					ecwc.Updater().UpdateConnectionMetrics(*metrics, withLock)
+				},
+			},
+		)
+	})
 	r.spawnBackgroundWorker(ctx, logger.Named("vm-monitor"), "vm-monitor reconnection loop", func(ctx2 context.Context, logger2 *zap.Logger) {
 		r.connectToMonitorLoop(ctx2, logger2, monitorGeneration, monitorStateCallbacks{
 			reset: func(withLock func()) {
@@ -334,7 +403,15 @@ func (r *Runner) Run(ctx context.Context, logger *zap.Logger, vmInfoUpdated util
 	}
 }
 
-func (r *Runner) reportScalingEvent(timestamp time.Time, currentCU, targetCU uint32) {
+// scalingConfig returns the scaling config for the VM, with any per-VM overrides applied on top of
+// the global defaults.
+func (r *Runner) scalingConfig() api.ScalingConfig {
+	r.status.mu.Lock()
+	defer r.status.mu.Unlock()
+	return r.global.config.Load().Scaling.DefaultConfig.WithOverrides(r.status.vmInfo.Config.ScalingConfig)
+}
+
+func (r *Runner) reportScalingEvent(timestamp time.Time, currentCU, targetCU api.ComputeUnits) {
 	endpointID := func() string {
 		return r.status.endpointID
 	}()
@@ -351,8 +428,8 @@ func (r *Runner) reportScalingEvent(timestamp time.Time, currentCU, targetCU uin
 func (r *Runner) reportDesiredScaling(
 	rl *desiredScalingReportLimiter,
 	timestamp time.Time,
-	currentCU uint32,
-	targetCU uint32,
+	currentCU api.ComputeUnits,
+	targetCU api.ComputeUnits,
 	parts scalingevents.GoalCUComponents,
 ) {
 	endpointID := func() string {
@@ -361,7 +438,7 @@ func (r *Runner) reportDesiredScaling(
 
 	r.global.vmMetrics.updateDesiredCU(
 		r.vmName,
-		r.global.config.ScalingEvents.CUMultiplier, // have to multiply before exposing as metrics here.
+		r.global.config.Load().ScalingEvents.CUMultiplier, // have to multiply before exposing as metrics here.
 		targetCU,
 		parts,
 	)
@@ -399,7 +476,8 @@ func (rl *desiredScalingReportLimiter) report(
 		skip := rl.lastEvent.TargetMilliCU == event.TargetMilliCU &&
 			closeEnough(rl.lastEvent.GoalComponents.CPU, event.GoalComponents.CPU) &&
 			closeEnough(rl.lastEvent.GoalComponents.Mem, event.GoalComponents.Mem) &&
-			closeEnough(rl.lastEvent.GoalComponents.LFC, event.GoalComponents.LFC)
+			closeEnough(rl.lastEvent.GoalComponents.LFC, event.GoalComponents.LFC) &&
+			closeEnough(rl.lastEvent.GoalComponents.Connections, event.GoalComponents.Connections)
 		if skip {
 			return
 		}
@@ -493,14 +571,17 @@ type metricsMgr[M core.FromPrometheus] struct {
 // getMetricsLoop repeatedly attempts to fetch metrics from the VM
 //
 // Every time metrics are successfully fetched, the value is recorded with mgr.updateMetrics().
+//
+// getConfig is called on each iteration with the current global config, so that changes from
+// config reloading take effect.
 func getMetricsLoop[M core.FromPrometheus](
 	r *Runner,
 	ctx context.Context,
 	logger *zap.Logger,
-	config MetricsSourceConfig,
+	getConfig func(*Config) MetricsSourceConfig,
 	mgr metricsMgr[M],
 ) {
-	waitBetweenDuration := time.Second * time.Duration(config.SecondsBetweenRequests)
+	config := getConfig(r.global.config.Load())
 
 	randomStartWait := util.NewTimeRange(time.Second, 0, int(config.SecondsBetweenRequests)).Random()
 
@@ -524,6 +605,8 @@ func getMetricsLoop[M core.FromPrometheus](
 	}
 
 	for {
+		config = getConfig(r.global.config.Load())
+
 		if !mgr.isActive() {
 			if lastActive {
 				logger.Info(fmt.Sprintf("VM is no longer active for %s metrics requests", mgr.kind))
@@ -551,7 +634,7 @@ func getMetricsLoop[M core.FromPrometheus](
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(waitBetweenDuration):
+		case <-time.After(time.Second * time.Duration(config.SecondsBetweenRequests)):
 		}
 	}
 }
@@ -574,11 +657,42 @@ func (r *Runner) connectToMonitorLoop(
 	generation *executor.StoredGenerationNumber,
 	callbacks monitorStateCallbacks,
 ) {
-	addr := fmt.Sprintf("ws://%s:%d/monitor", r.podIP, r.global.config.Monitor.ServerPort)
+	addr := fmt.Sprintf("ws://%s/monitor", net.JoinHostPort(r.podIP, strconv.Itoa(int(r.global.config.Load().Monitor.ServerPort))))
 
-	minWait := time.Second * time.Duration(r.global.config.Monitor.ConnectionRetryMinWaitSeconds)
+	minWait := time.Second * time.Duration(r.global.config.Load().Monitor.ConnectionRetryMinWaitSeconds)
 	var lastStart time.Time
 
+	// Circuit breaker: after too many consecutive failures, only probe the connection every so
+	// often, so that we aren't constantly trying to reach a vm-monitor that's not there.
+	failureThreshold := r.global.config.Load().Monitor.CircuitBreakerFailureThreshold
+	probeInterval := time.Second * time.Duration(r.global.config.Load().Monitor.CircuitBreakerProbeIntervalSeconds)
+	var consecutiveFailures uint
+	var circuitOpen bool
+	setCircuitOpen := func(open bool) {
+		circuitOpen = open
+		r.status.update(r.global, func(stat podStatus) podStatus {
+			stat.monitorCircuitOpen = open
+			return stat
+		})
+	}
+	recordFailure := func() {
+		consecutiveFailures += 1
+		if consecutiveFailures >= failureThreshold && !circuitOpen {
+			logger.Warn(
+				"Too many consecutive vm-monitor connection failures, only probing the connection from now on",
+				zap.Uint("failures", consecutiveFailures),
+				zap.Duration("probeInterval", probeInterval),
+			)
+			r.global.metrics.monitorCircuitBreakerTrips.Inc()
+			setCircuitOpen(true)
+		}
+	}
+	defer func() {
+		if circuitOpen {
+			setCircuitOpen(false)
+		}
+	}()
+
 	for i := 0; ; i += 1 {
 		// Remove any prior Dispatcher from the Runner
 		if i != 0 {
@@ -611,18 +725,24 @@ func (r *Runner) connectToMonitorLoop(
 			endTime := time.Now()
 			runtime := endTime.Sub(lastStart)
 
-			if runtime > minWait {
+			retryWait := minWait
+			if circuitOpen {
+				retryWait = probeInterval
+			}
+
+			if runtime > retryWait {
 				logger.Info(
 					"Immediately retrying connection to vm-monitor",
 					zap.String("addr", addr),
 					zap.Duration("totalRuntime", runtime),
 				)
 			} else {
-				delay := minWait - runtime
+				delay := retryWait - runtime
 				logger.Info(
 					"Connection to vm-monitor was not live for long, retrying after delay",
 					zap.Duration("delay", delay),
 					zap.Duration("totalRuntime", runtime),
+					zap.Uint("consecutiveFailures", consecutiveFailures),
 				)
 
 				select {
@@ -651,9 +771,17 @@ func (r *Runner) connectToMonitorLoop(
 		dispatcher, err := NewDispatcher(ctx, logger, addr, r, callbacks.upscaleRequested)
 		if err != nil {
 			logger.Error("Failed to connect to vm-monitor", zap.String("addr", addr), zap.Error(err))
+			recordFailure()
 			continue
 		}
 
+		// Close the circuit breaker while connected. If the connection doesn't last, we'll keep
+		// counting from the previous failures.
+		if circuitOpen {
+			logger.Info("Connected to vm-monitor after repeated failures, resuming regular reconnection")
+			setCircuitOpen(false)
+		}
+
 		// Update runner to the new dispatcher
 		func() {
 			r.lock.Lock()
@@ -674,6 +802,14 @@ func (r *Runner) connectToMonitorLoop(
 		if err := dispatcher.ExitError(); err != nil {
 			logger.Error("Dispatcher for vm-monitor connection exited due to error", zap.Error(err))
 		}
+
+		// Connections that end soon after starting count towards the circuit breaker, same as
+		// failing to connect in the first place.
+		if time.Since(lastStart) > minWait {
+			consecutiveFailures = 0
+		} else if ctx.Err() == nil {
+			recordFailure()
+		}
 	}
 }
 
@@ -689,7 +825,7 @@ func doMetricsRequest(
 	metrics core.FromPrometheus,
 	config MetricsSourceConfig,
 ) error {
-	url := fmt.Sprintf("http://%s:%d/metrics", r.podIP, config.Port)
+	url := fmt.Sprintf("http://%s/metrics", net.JoinHostPort(r.podIP, strconv.Itoa(int(config.Port))))
 
 	timeout := time.Second * time.Duration(config.RequestTimeoutSeconds)
 	reqCtx, cancel := context.WithTimeout(ctx, timeout)
@@ -745,7 +881,7 @@ func (r *Runner) doNeonVMRequest(
 		panic(fmt.Errorf("Error marshalling JSON patch: %w", err))
 	}
 
-	timeout := time.Second * time.Duration(r.global.config.NeonVM.RequestTimeoutSeconds)
+	timeout := time.Second * time.Duration(r.global.config.Load().NeonVM.RequestTimeoutSeconds)
 	requestCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
@@ -807,11 +943,20 @@ func doMonitorDownscale(
 	r := dispatcher.runner
 	rawResources := target.ConvertToAllocation()
 
-	timeout := time.Second * time.Duration(r.global.config.Monitor.ResponseTimeoutSeconds)
+	timeoutSeconds := r.global.config.Load().Monitor.DownscaleTimeoutSeconds
+	if override := r.scalingConfig().MonitorDownscaleTimeoutSeconds; override != nil {
+		timeoutSeconds = uint(*override)
+	}
+	timeout := time.Second * time.Duration(timeoutSeconds)
+
+	requestID, retry := r.monitorRequestIDs.next(monitorRequestKey{kind: "DownscaleRequest", allocation: rawResources})
+	logger = logger.With(zap.String("requestID", requestID), zap.Bool("retry", retry))
 
 	res, err := dispatcher.Call(ctx, logger, timeout, "DownscaleRequest", api.DownscaleRequest{
-		Target: rawResources,
+		Target:    rawResources,
+		RequestID: requestID,
 	})
+	r.monitorRequestIDs.finish(requestID, err == nil)
 	if err != nil {
 		return nil, err
 	}
@@ -828,11 +973,16 @@ func doMonitorUpscale(
 	r := dispatcher.runner
 	rawResources := target.ConvertToAllocation()
 
-	timeout := time.Second * time.Duration(r.global.config.Monitor.ResponseTimeoutSeconds)
+	timeout := time.Second * time.Duration(r.global.config.Load().Monitor.ResponseTimeoutSeconds)
+
+	requestID, retry := r.monitorRequestIDs.next(monitorRequestKey{kind: "UpscaleNotification", allocation: rawResources})
+	logger = logger.With(zap.String("requestID", requestID), zap.Bool("retry", retry))
 
 	_, err := dispatcher.Call(ctx, logger, timeout, "UpscaleNotification", api.UpscaleNotification{
-		Granted: rawResources,
+		Granted:   rawResources,
+		RequestID: requestID,
 	})
+	r.monitorRequestIDs.finish(requestID, err == nil)
 	return err
 }
 
@@ -843,18 +993,66 @@ func (r *Runner) DoSchedulerRequest(
 	resources api.Resources,
 	lastPermit *api.Resources,
 	metrics *api.Metrics,
-) (_ *api.PluginResponse, err error) {
-	reqData := &api.AgentRequest{
+) (*api.PluginResponse, error) {
+	return r.doSchedulerRequest(ctx, logger, &api.AgentRequest{
 		ProtoVersion: PluginProtocolVersion,
 		Pod:          r.podName,
-		ComputeUnit:  r.global.config.Scaling.ComputeUnit,
+		ComputeUnit:  r.global.config.Load().Scaling.ComputeUnit,
 		Resources:    resources,
 		LastPermit:   lastPermit,
 		Metrics:      metrics,
+		Departing:    false,
+		RequestID:    "", // set by doSchedulerRequest
+	})
+}
+
+// NotifyDeparting sends a final request to the scheduler, informing it that the autoscaler-agent is
+// shutting down and withdrawing any pending increase beyond the last permit.
+//
+// If we never received a permit from the scheduler, there's nothing to withdraw, so no request is
+// made.
+func (r *Runner) NotifyDeparting(ctx context.Context, logger *zap.Logger) error {
+	if err := r.lock.TryLock(ctx); err != nil {
+		return err
+	}
+	getLastPermit := r.executorLastPermit
+	r.lock.Unlock()
+
+	if getLastPermit == nil /* may be nil if r.Run() hasn't fully started yet */ {
+		return nil
+	}
+	lastPermit := getLastPermit()
+	if lastPermit == nil {
+		return nil
 	}
 
+	_, err := r.doSchedulerRequest(ctx, logger, &api.AgentRequest{
+		ProtoVersion: PluginProtocolVersion,
+		Pod:          r.podName,
+		ComputeUnit:  r.global.config.Load().Scaling.ComputeUnit,
+		Resources:    *lastPermit,
+		LastPermit:   lastPermit,
+		Metrics:      nil,
+		Departing:    true,
+		RequestID:    "", // set by doSchedulerRequest
+	})
+	return err
+}
+
+func (r *Runner) doSchedulerRequest(
+	ctx context.Context,
+	logger *zap.Logger,
+	reqData *api.AgentRequest,
+) (_ *api.PluginResponse, err error) {
+	resources := reqData.Resources
+
+	requestID, retry := r.schedulerRequestIDs.next(schedulerRequestKeyFor(reqData))
+	reqData.RequestID = requestID
+	logger = logger.With(zap.String("requestID", requestID), zap.Bool("retry", retry))
+
 	// make sure we log any error we're returning:
 	defer func() {
+		r.schedulerRequestIDs.finish(requestID, err == nil)
 		if err != nil {
 			logger.Error("Scheduler request failed", zap.Error(err))
 		}
@@ -868,22 +1066,49 @@ func (r *Runner) DoSchedulerRequest(
 		return nil, err
 	}
 
-	reqBody, err := json.Marshal(reqData)
-	if err != nil {
-		return nil, fmt.Errorf("Error encoding request JSON: %w", err)
+	if err := r.global.schedulerRequestLimiter.Wait(ctx); err != nil {
+		return nil, fmt.Errorf("Error waiting for scheduler request rate limit: %w", err)
 	}
 
-	timeout := time.Second * time.Duration(r.global.config.NeonVM.RequestTimeoutSeconds)
-	reqCtx, cancel := context.WithTimeout(ctx, timeout)
+	useProtobuf := r.global.config.Load().Scheduler.EnableProtobuf
+
+	var reqBody []byte
+	if useProtobuf {
+		reqBody, err = reqData.MarshalProto()
+		if err != nil {
+			return nil, fmt.Errorf("Error encoding request protobuf: %w", err)
+		}
+	} else {
+		reqBody, err = json.Marshal(reqData)
+		if err != nil {
+			return nil, fmt.Errorf("Error encoding request JSON: %w", err)
+		}
+	}
+
+	timeoutSeconds := r.global.config.Load().Scheduler.RequestTimeoutSeconds
+	if override := r.scalingConfig().SchedulerRequestTimeoutSeconds; override != nil {
+		timeoutSeconds = uint(*override)
+	}
+	var reqCtx context.Context
+	var cancel context.CancelFunc
+	if timeoutSeconds != 0 {
+		reqCtx, cancel = context.WithTimeout(ctx, time.Second*time.Duration(timeoutSeconds))
+	} else {
+		reqCtx, cancel = context.WithCancel(ctx) // zero means no timeout
+	}
 	defer cancel()
 
-	url := fmt.Sprintf("http://%s:%d/", sched.IP, r.global.config.Scheduler.RequestPort)
+	url := fmt.Sprintf("http://%s/", net.JoinHostPort(sched.IP, strconv.Itoa(int(r.global.config.Load().Scheduler.RequestPort))))
 
 	request, err := http.NewRequestWithContext(reqCtx, http.MethodPost, url, bytes.NewReader(reqBody))
 	if err != nil {
 		return nil, fmt.Errorf("Error building request to %q: %w", url, err)
 	}
-	request.Header.Set("content-type", "application/json")
+	if useProtobuf {
+		request.Header.Set("content-type", api.ContentTypeProtobuf)
+	} else {
+		request.Header.Set("content-type", "application/json")
+	}
 
 	logger.Debug("Sending request to scheduler", zap.Any("request", reqData))
 
@@ -903,13 +1128,33 @@ func (r *Runner) DoSchedulerRequest(
 	}
 
 	if response.StatusCode != 200 {
+		// If the scheduler is overloaded or still starting up, it may ask us to come back later.
+		// Add jitter so that all the agents that were told to back off don't retry at once.
+		if retryAfter, ok := parseRetryAfter(response); ok {
+			return nil, &executor.PluginBackpressureError{
+				RetryAfter: util.Jitter(retryAfter, 0.5),
+				Err:        fmt.Errorf("Received response status %d body %q", response.StatusCode, string(respBody)),
+			}
+		}
+
 		// Fatal because 4XX implies our state doesn't match theirs, 5XX means we can't assume
 		// current contents of the state, and anything other than 200, 4XX, or 5XX shouldn't happen
+		if reason := api.DenialReason(response.Header.Get(api.HeaderDenialReason)); reason != "" {
+			r.global.metrics.schedulerDenials.WithLabelValues(string(reason)).Inc()
+			r.recordSchedulerDenial(ctx, logger, &reason)
+			return nil, fmt.Errorf(
+				"Received response status %d reason %s body %q", response.StatusCode, reason, string(respBody),
+			)
+		}
 		return nil, fmt.Errorf("Received response status %d body %q", response.StatusCode, string(respBody))
 	}
 
 	var respData api.PluginResponse
-	if err := json.Unmarshal(respBody, &respData); err != nil {
+	if useProtobuf {
+		if err := respData.UnmarshalProto(respBody); err != nil {
+			return nil, fmt.Errorf("Bad protobuf response: %w", err)
+		}
+	} else if err := json.Unmarshal(respBody, &respData); err != nil {
 		// Fatal because invalid JSON might also be semantically invalid
 		return nil, fmt.Errorf("Bad JSON response: %w", err)
 	}
@@ -919,5 +1164,77 @@ func (r *Runner) DoSchedulerRequest(
 	}
 	logger.Log(level, "Received response from scheduler", zap.Any("response", respData), zap.Any("requested", resources))
 
+	if respData.Reason != nil {
+		r.global.metrics.schedulerDenials.WithLabelValues(string(*respData.Reason)).Inc()
+	}
+	r.recordSchedulerDenial(ctx, logger, respData.Reason)
+
 	return &respData, nil
 }
+
+// parseRetryAfter returns the duration given by the response's Retry-After header, if it's a 429 or
+// 503 response with a valid header.
+//
+// Only the delay-seconds form of the header is supported, because that's all the scheduler plugin
+// sends.
+func parseRetryAfter(response *http.Response) (time.Duration, bool) {
+	if response.StatusCode != http.StatusServiceUnavailable && response.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	seconds, err := strconv.ParseUint(response.Header.Get("Retry-After"), 10, 32)
+	if err != nil || seconds == 0 {
+		return 0, false
+	}
+	return time.Second * time.Duration(seconds), true
+}
+
+// recordSchedulerDenial sets the VM's InternalAnnotationSchedulerDenial annotation to the reason
+// (or removes it, if reason is nil), if it's changed since it was last recorded.
+//
+// The annotation is used by the neonvm-controller to set the VM's status conditions. Failures are
+// logged and otherwise ignored; we'll retry on the next response from the scheduler.
+func (r *Runner) recordSchedulerDenial(ctx context.Context, logger *zap.Logger, reason *api.DenialReason) {
+	if err := r.lock.TryLock(ctx); err != nil {
+		return
+	}
+	unchanged := r.schedulerDenialKnown && lo.FromPtr(r.schedulerDenial) == lo.FromPtr(reason)
+	r.lock.Unlock()
+
+	if unchanged {
+		return
+	}
+
+	// Use a merge patch so that a nil value removes the annotation, regardless of whether it exists.
+	var value *string
+	if reason != nil {
+		value = lo.ToPtr(string(*reason))
+	}
+	patchPayload, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]*string{
+				api.InternalAnnotationSchedulerDenial: value,
+			},
+		},
+	})
+	if err != nil {
+		panic(fmt.Errorf("Error marshalling JSON merge patch: %w", err))
+	}
+
+	timeout := time.Second * time.Duration(r.global.config.Load().NeonVM.RequestTimeoutSeconds)
+	requestCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err = r.global.vmClient.NeonvmV1().VirtualMachines(r.vmName.Namespace).
+		Patch(requestCtx, r.vmName.Name, ktypes.MergePatchType, patchPayload, metav1.PatchOptions{})
+	if err != nil {
+		logger.Warn("Failed to update scheduler denial annotation on VM", zap.Error(err))
+		return
+	}
+
+	if err := r.lock.TryLock(ctx); err != nil {
+		return
+	}
+	defer r.lock.Unlock()
+	r.schedulerDenial = reason
+	r.schedulerDenialKnown = true
+}
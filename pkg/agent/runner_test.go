@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/neonvm/client/clientset/versioned/fake"
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+func TestRecordSchedulerDenial(t *testing.T) {
+	ctx := context.Background()
+	vmName := util.NamespacedName{Namespace: "default", Name: "vm"}
+
+	vm := &vmv1.VirtualMachine{}
+	vm.Name = vmName.Name
+	vm.Namespace = vmName.Namespace
+	vmClient := fake.NewSimpleClientset(vm)
+
+	//nolint:exhaustruct // only the config used by recordSchedulerDenial
+	config := &Config{NeonVM: NeonVMConfig{RequestTimeoutSeconds: 5}}
+	//nolint:exhaustruct // only the fields used by recordSchedulerDenial
+	runner := &Runner{
+		global: &agentState{ //nolint:exhaustruct // same as above
+			config:   util.NewBroadcastValue(config),
+			vmClient: vmClient,
+		},
+		vmName: vmName,
+		lock:   util.NewChanMutex(),
+	}
+
+	getAnnotation := func() (string, bool) {
+		vm, err := vmClient.NeonvmV1().VirtualMachines(vmName.Namespace).Get(ctx, vmName.Name, metav1.GetOptions{})
+		require.NoError(t, err)
+		value, ok := vm.Annotations[api.InternalAnnotationSchedulerDenial]
+		return value, ok
+	}
+	patchCount := func() int {
+		count := 0
+		for _, action := range vmClient.Actions() {
+			if action.GetVerb() == "patch" {
+				count += 1
+			}
+		}
+		return count
+	}
+
+	runner.recordSchedulerDenial(ctx, zap.NewNop(), lo.ToPtr(api.DenialReasonNodeFull))
+	value, ok := getAnnotation()
+	assert.True(t, ok)
+	assert.Equal(t, string(api.DenialReasonNodeFull), value)
+	assert.Equal(t, 1, patchCount())
+
+	// The same reason again shouldn't make another request
+	runner.recordSchedulerDenial(ctx, zap.NewNop(), lo.ToPtr(api.DenialReasonNodeFull))
+	assert.Equal(t, 1, patchCount())
+
+	runner.recordSchedulerDenial(ctx, zap.NewNop(), lo.ToPtr(api.DenialReasonQuotaExceeded))
+	value, _ = getAnnotation()
+	assert.Equal(t, string(api.DenialReasonQuotaExceeded), value)
+	assert.Equal(t, 2, patchCount())
+
+	// No reason removes the annotation
+	runner.recordSchedulerDenial(ctx, zap.NewNop(), nil)
+	_, ok = getAnnotation()
+	assert.False(t, ok)
+	assert.Equal(t, 3, patchCount())
+
+	runner.recordSchedulerDenial(ctx, zap.NewNop(), nil)
+	assert.Equal(t, 3, patchCount())
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/samber/lo"
 	"go.uber.org/zap"
 
+	"github.com/neondatabase/autoscaling/pkg/api"
 	"github.com/neondatabase/autoscaling/pkg/reporting"
 )
 
@@ -16,8 +17,8 @@ type Config struct {
 	// CUMultiplier sets the ratio between our internal compute unit and the one that should be
 	// reported.
 	//
-	// This exists because Neon allows fractional compute units, while the autoscaler-agent acts on
-	// integer multiples of a smaller compute unit.
+	// This exists because Neon's compute units may differ from the autoscaler-agent's configured
+	// compute unit (which is usually smaller).
 	CUMultiplier float64 `json:"cuMultiplier"`
 
 	// RereportThreshold sets the minimum amount of change in desired compute units required for us to
@@ -50,6 +51,8 @@ type GoalCUComponents struct {
 	CPU *float64 `json:"cpu,omitempty"`
 	Mem *float64 `json:"mem,omitempty"`
 	LFC *float64 `json:"lfc,omitempty"`
+
+	Connections *float64 `json:"connections,omitempty"`
 }
 
 type scalingEventKind string
@@ -98,8 +101,8 @@ func (r *Reporter) Submit(event ScalingEvent) {
 	r.sink.Enqueue(event)
 }
 
-func convertToMilliCU(cu uint32, multiplier float64) uint32 {
-	return uint32(math.Round(1000 * float64(cu) * multiplier))
+func convertToMilliCU(cu api.ComputeUnits, multiplier float64) uint32 {
+	return uint32(math.Round(float64(cu) * multiplier))
 }
 
 // NewActualEvent is a helper function to create a ScalingEvent for actual scaling that has
@@ -109,8 +112,8 @@ func convertToMilliCU(cu uint32, multiplier float64) uint32 {
 func (r *Reporter) NewActualEvent(
 	timestamp time.Time,
 	endpointID string,
-	currentCU uint32,
-	targetCU uint32,
+	currentCU api.ComputeUnits,
+	targetCU api.ComputeUnits,
 ) ScalingEvent {
 	return ScalingEvent{
 		Timestamp:      timestamp,
@@ -126,8 +129,8 @@ func (r *Reporter) NewActualEvent(
 func (r *Reporter) NewHypotheticalEvent(
 	timestamp time.Time,
 	endpointID string,
-	currentCU uint32,
-	targetCU uint32,
+	currentCU api.ComputeUnits,
+	targetCU api.ComputeUnits,
 	goalCUs GoalCUComponents,
 ) ScalingEvent {
 	convertFloat := func(cu *float64) *float64 {
@@ -148,6 +151,8 @@ func (r *Reporter) NewHypotheticalEvent(
 			CPU: convertFloat(goalCUs.CPU),
 			Mem: convertFloat(goalCUs.Mem),
 			LFC: convertFloat(goalCUs.LFC),
+
+			Connections: convertFloat(goalCUs.Connections),
 		},
 	}
 }
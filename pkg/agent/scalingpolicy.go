@@ -0,0 +1,142 @@
+package agent
+
+// Watching ScalingPolicy objects, and applying them to VMs that reference them.
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	vmclient "github.com/neondatabase/autoscaling/neonvm/client/clientset/versioned"
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/util"
+	"github.com/neondatabase/autoscaling/pkg/util/watch"
+)
+
+type scalingPolicyStore = watch.IndexedStore[vmv1.ScalingPolicy, *watch.NameIndex[vmv1.ScalingPolicy]]
+
+// startScalingPolicyWatcher starts watching ScalingPolicies in all namespaces, calling
+// policyChanged with the namespace and name of each policy that's added, updated, or deleted after
+// the initial listing.
+func startScalingPolicyWatcher(
+	ctx context.Context,
+	parentLogger *zap.Logger,
+	vmClient *vmclient.Clientset,
+	metrics watch.Metrics,
+	policyChanged func(util.NamespacedName),
+) (scalingPolicyStore, error) {
+	logger := parentLogger.Named("scaling-policy-watch")
+
+	changed := func(policy *vmv1.ScalingPolicy) {
+		policyChanged(util.NamespacedName{Namespace: policy.Namespace, Name: policy.Name})
+	}
+
+	store, err := watch.Watch(
+		ctx,
+		logger.Named("watch"),
+		vmClient.NeonvmV1().ScalingPolicies(corev1.NamespaceAll),
+		watch.Config{
+			ObjectNameLogField: "scalingpolicy",
+			Metrics: watch.MetricsConfig{
+				Metrics:  metrics,
+				Instance: "ScalingPolicies",
+			},
+			RetryRelistAfter: util.NewTimeRange(time.Millisecond, 500, 1000, util.WithBackoff(2, 30000)),
+			RetryWatchAfter:  util.NewTimeRange(time.Millisecond, 500, 1000, util.WithBackoff(2, 30000)),
+		},
+		watch.Accessors[*vmv1.ScalingPolicyList, vmv1.ScalingPolicy]{
+			Items: func(list *vmv1.ScalingPolicyList) []vmv1.ScalingPolicy { return list.Items },
+		},
+		// Sync, so that the store is populated before we start making events for VMs.
+		watch.InitModeSync,
+		metav1.ListOptions{},
+		watch.HandlerFuncs[*vmv1.ScalingPolicy]{
+			AddFunc: func(policy *vmv1.ScalingPolicy, preexisting bool) {
+				if !preexisting {
+					changed(policy)
+				}
+			},
+			UpdateFunc: func(oldPolicy, newPolicy *vmv1.ScalingPolicy) {
+				changed(newPolicy)
+			},
+			DeleteFunc: func(policy *vmv1.ScalingPolicy, maybeStale bool) {
+				changed(policy)
+			},
+		},
+	)
+	if err != nil {
+		return scalingPolicyStore{}, err
+	}
+
+	return watch.NewIndexedStore(store, watch.NewNameIndex[vmv1.ScalingPolicy]()), nil
+}
+
+// applyScalingPolicy updates the VM's scaling config to use the ScalingPolicy referenced by the VM,
+// if there is one. Settings from the VM's own scaling config annotation take precedence over the
+// policy.
+//
+// If the referenced policy doesn't exist or is invalid, the VM's scaling config is left unchanged
+// and a warning is logged.
+func applyScalingPolicy(logger *zap.Logger, policies scalingPolicyStore, vm *vmv1.VirtualMachine, info *api.VmInfo) {
+	policyName, ok := vm.Annotations[api.AnnotationScalingPolicy]
+	if !ok {
+		return
+	}
+
+	logger = logger.With(util.VMNameFields(vm), zap.String("scalingPolicy", policyName))
+
+	policy, ok := policies.GetIndexed(func(index *watch.NameIndex[vmv1.ScalingPolicy]) (*vmv1.ScalingPolicy, bool) {
+		return index.Get(vm.Namespace, policyName)
+	})
+	if !ok {
+		logger.Warn("VM references ScalingPolicy that does not exist")
+		return
+	}
+
+	policyConfig := api.ScalingConfigFromPolicy(&policy.Spec)
+	if err := policyConfig.ValidateOverrides(); err != nil {
+		logger.Warn("VM references ScalingPolicy with invalid scaling config", zap.Error(err))
+		return
+	}
+
+	config := policyConfig.WithOverrides(info.Config.ScalingConfig)
+	info.Config.ScalingConfig = &config
+}
+
+// resubmitVMsForPolicy submits update events for all VMs that are our responsibility and reference
+// the ScalingPolicy, so that changes to the policy take effect.
+func resubmitVMsForPolicy(
+	logger *zap.Logger,
+	config *Config,
+	nodeName string,
+	policies scalingPolicyStore,
+	vms *watch.Store[vmv1.VirtualMachine],
+	policy util.NamespacedName,
+	submitEvent func(vmEvent),
+) {
+	logger = logger.With(zap.Object("scalingPolicy", policy))
+
+	for _, vm := range vms.Items() {
+		if vm.Namespace != policy.Namespace || vm.Annotations[api.AnnotationScalingPolicy] != policy.Name {
+			continue
+		}
+		if !vmIsOurResponsibility(vm, config, nodeName) {
+			continue
+		}
+
+		event, err := makeVMEvent(logger, policies, vm, vmEventUpdated)
+		if err != nil {
+			logger.Error(
+				"Failed to create vmEvent for VM with changed ScalingPolicy",
+				util.VMNameFields(vm), zap.Error(err),
+			)
+			continue
+		}
+		submitEvent(event)
+	}
+}
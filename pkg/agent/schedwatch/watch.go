@@ -74,8 +74,8 @@ func StartSchedulerWatcher(
 			// We don't need to be super responsive to scheduler changes.
 			//
 			// FIXME: make these configurable.
-			RetryRelistAfter: util.NewTimeRange(time.Second, 4, 5),
-			RetryWatchAfter:  util.NewTimeRange(time.Second, 4, 5),
+			RetryRelistAfter: util.NewTimeRange(time.Second, 4, 5, util.WithBackoff(2, 30)),
+			RetryWatchAfter:  util.NewTimeRange(time.Second, 4, 5, util.WithBackoff(2, 30)),
 		},
 		watch.Accessors[*corev1.PodList, corev1.Pod]{
 			Items: func(list *corev1.PodList) []corev1.Pod { return list.Items },
@@ -66,6 +66,7 @@ func startVMWatcher(
 	metrics watch.Metrics,
 	perVMMetrics *PerVMMetrics,
 	nodeName string,
+	policies scalingPolicyStore,
 	submitEvent func(vmEvent),
 ) (*watch.Store[vmv1.VirtualMachine], error) {
 	logger := parentLogger.Named("vm-watch")
@@ -81,8 +82,8 @@ func startVMWatcher(
 				Instance: "VirtualMachines",
 			},
 			// We want to be relatively snappy; don't wait for too long before retrying.
-			RetryRelistAfter: util.NewTimeRange(time.Millisecond, 500, 1000),
-			RetryWatchAfter:  util.NewTimeRange(time.Millisecond, 500, 1000),
+			RetryRelistAfter: util.NewTimeRange(time.Millisecond, 500, 1000, util.WithBackoff(2, 30000)),
+			RetryWatchAfter:  util.NewTimeRange(time.Millisecond, 500, 1000, util.WithBackoff(2, 30000)),
 		},
 		watch.Accessors[*vmv1.VirtualMachineList, vmv1.VirtualMachine]{
 			Items: func(list *vmv1.VirtualMachineList) []vmv1.VirtualMachine { return list.Items },
@@ -94,7 +95,7 @@ func startVMWatcher(
 				setVMMetrics(perVMMetrics, vm, nodeName)
 
 				if vmIsOurResponsibility(vm, config, nodeName) {
-					event, err := makeVMEvent(logger, vm, vmEventAdded)
+					event, err := makeVMEvent(logger, policies, vm, vmEventAdded)
 					if err != nil {
 						logger.Error(
 							"Failed to create vmEvent for added VM",
@@ -128,7 +129,7 @@ func startVMWatcher(
 					eventKind = vmEventUpdated
 				}
 
-				event, err := makeVMEvent(logger, vmForEvent, eventKind)
+				event, err := makeVMEvent(logger, policies, vmForEvent, eventKind)
 				if err != nil {
 					logger.Error(
 						"Failed to create vmEvent for updated VM",
@@ -143,7 +144,7 @@ func startVMWatcher(
 				deleteVMMetrics(perVMMetrics, vm, nodeName)
 
 				if vmIsOurResponsibility(vm, config, nodeName) {
-					event, err := makeVMEvent(logger, vm, vmEventDeleted)
+					event, err := makeVMEvent(logger, policies, vm, vmEventDeleted)
 					if err != nil {
 						logger.Error(
 							"Failed to create vmEvent for deleted VM",
@@ -158,11 +159,17 @@ func startVMWatcher(
 	)
 }
 
-func makeVMEvent(logger *zap.Logger, vm *vmv1.VirtualMachine, kind vmEventKind) (vmEvent, error) {
+func makeVMEvent(
+	logger *zap.Logger,
+	policies scalingPolicyStore,
+	vm *vmv1.VirtualMachine,
+	kind vmEventKind,
+) (vmEvent, error) {
 	info, err := api.ExtractVmInfo(logger, vm)
 	if err != nil {
 		return vmEvent{}, fmt.Errorf("Error extracting VM info: %w", err)
 	}
+	applyScalingPolicy(logger, policies, vm, info)
 
 	endpointID := ""
 	if vm.Labels != nil {
@@ -251,7 +258,7 @@ func makeVMMemMetrics(vm *vmv1.VirtualMachine) []vmMetric {
 	var metrics []vmMetric
 
 	memorySlotsToBytes := func(m int32) int64 {
-		return vm.Spec.Guest.MemorySlotSize.Value() * int64(m)
+		return int64(api.MemoryForSlots(vm.Spec.Guest.MemorySlotSize, m))
 	}
 
 	// metrics from spec
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// ComputeUnits represents a number of compute units, in thousandths of a CU ("milli-CUs")
+// e.g. 2 CU is 2000, 0.25 is 250
+//
+// In JSON, ComputeUnits is represented as a number of CUs (e.g. 2 or 0.25), so that fields which
+// previously only allowed a whole number of CUs remain compatible.
+type ComputeUnits uint32
+
+// WholeComputeUnits returns the ComputeUnits equal to n whole CUs
+func WholeComputeUnits(n uint32) ComputeUnits {
+	return ComputeUnits(n * 1000)
+}
+
+// ComputeUnitsFromFloat64 returns the smallest ComputeUnits greater than or equal to cu, which is
+// given as a number of CUs.
+//
+// Negative values (and NaN) return zero.
+func ComputeUnitsFromFloat64(cu float64) ComputeUnits {
+	if !(cu > 0) {
+		return 0
+	}
+	// Round before taking the ceiling, so that floating-point error in values that are *meant* to
+	// be exact (e.g. 0.1 + 0.2) doesn't push us up to the next milli-CU.
+	milli := cu * 1000
+	if rounded := math.Round(milli); math.Abs(milli-rounded) < 1e-6 {
+		milli = rounded
+	}
+	return ComputeUnits(min(math.Ceil(milli), math.MaxUint32))
+}
+
+// AsFloat64 converts the ComputeUnits into a float64 number of CUs
+func (c ComputeUnits) AsFloat64() float64 {
+	return float64(c) / 1000
+}
+
+// IsWhole returns whether c is an integer number of CUs
+func (c ComputeUnits) IsWhole() bool {
+	return c%1000 == 0
+}
+
+// Floor returns the largest integer number of CUs less than or equal to c
+func (c ComputeUnits) Floor() uint32 {
+	return uint32(c) / 1000
+}
+
+// Ceil returns the smallest integer number of CUs greater than or equal to c
+func (c ComputeUnits) Ceil() uint32 {
+	r := uint32(c) / 1000
+	if !c.IsWhole() {
+		r += 1
+	}
+	return r
+}
+
+// RoundedUp returns the smallest whole number of CUs greater than or equal to c, as ComputeUnits
+func (c ComputeUnits) RoundedUp() ComputeUnits {
+	return WholeComputeUnits(c.Ceil())
+}
+
+func (c ComputeUnits) MarshalJSON() ([]byte, error) {
+	// Marshal as an integer if we can, for backwards-compatibility with components that wouldn't
+	// be expecting a fractional value here.
+	if c.IsWhole() {
+		return json.Marshal(c.Floor())
+	}
+	return []byte(strconv.FormatFloat(c.AsFloat64(), 'f', -1, 64)), nil
+}
+
+func (c *ComputeUnits) UnmarshalJSON(data []byte) error {
+	var value float64
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	} else if value < 0 {
+		return errors.New("compute units must not be negative")
+	} else if value*1000 > math.MaxUint32 {
+		return fmt.Errorf("compute units value %v is too large", value)
+	}
+
+	// Round to the nearest milli-CU, rather than up, so that values with more precision than we
+	// support are handled predictably.
+	*c = ComputeUnits(math.Round(value * 1000))
+	return nil
+}
+
+func (c ComputeUnits) Format(state fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && state.Flag('#'):
+		//nolint:errcheck // can't do anything about the write error
+		state.Write([]byte(fmt.Sprintf("%v", uint32(c))))
+	default:
+		//nolint:errcheck // can't do anything about the write error
+		state.Write([]byte(fmt.Sprintf("%v", c.AsFloat64())))
+	}
+}
+
+// ParseResources parses Resources given as "CPU,MEM", with each part as a resource.Quantity (e.g.
+// "250m,1Gi" or "0.25,1Gi").
+//
+// This is the format used for compute unit sizes in command-line flags.
+func ParseResources(s string) (Resources, error) {
+	cpuStr, memStr, ok := strings.Cut(s, ",")
+	if !ok {
+		return Resources{}, errors.New("value must be of the form 'cpu,mem'")
+	}
+	cpu, err := resource.ParseQuantity(cpuStr)
+	if err != nil {
+		return Resources{}, fmt.Errorf("invalid cpu: %w", err)
+	}
+	mem, err := resource.ParseQuantity(memStr)
+	if err != nil {
+		return Resources{}, fmt.Errorf("invalid mem: %w", err)
+	}
+	return Resources{
+		VCPU: vmv1.MilliCPUFromResourceQuantity(cpu),
+		Mem:  BytesFromResourceQuantity(mem),
+	}, nil
+}
+
+// ReadComputeUnitFile reads the size of a compute unit from the JSON file at path, in the same
+// format as Resources (e.g. {"vCPUs": 0.25, "mem": "1Gi"}).
+//
+// This allows a single per-cluster compute unit definition (typically a shared ConfigMap) to be
+// used by every component, instead of duplicating it in each component's config.
+func ReadComputeUnitFile(path string) (Resources, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Resources{}, fmt.Errorf("error reading compute unit file %q: %w", path, err)
+	}
+
+	var cu Resources
+	jsonDecoder := json.NewDecoder(bytes.NewReader(content))
+	jsonDecoder.DisallowUnknownFields()
+	if err := jsonDecoder.Decode(&cu); err != nil {
+		return Resources{}, fmt.Errorf("error decoding compute unit in %q: %w", path, err)
+	}
+	if err := cu.ValidateNonZero(); err != nil {
+		return Resources{}, fmt.Errorf("invalid compute unit in %q: %w", path, err)
+	}
+	return cu, nil
+}
+
+// MemSlotsPerCU returns the number of memory slots of size slotSize in a single compute unit of
+// size cu, or an error if the compute unit's memory is not a whole number of slots.
+func (cu Resources) MemSlotsPerCU(slotSize Bytes) (uint16, error) {
+	if slotSize == 0 {
+		return 0, errors.New("memory slot size must be non-zero")
+	} else if cu.Mem%slotSize != 0 {
+		return 0, fmt.Errorf(
+			"compute unit is not divisible by memory slot size: %v is not divisible by %v",
+			cu.Mem, slotSize,
+		)
+	} else if cu.Mem/slotSize > math.MaxUint16 {
+		return 0, fmt.Errorf("compute unit has too many memory slots of size %v", slotSize)
+	}
+	return uint16(cu.Mem / slotSize), nil
+}
+
+// MemoryForSlots returns the total memory in the given number of memory slots of size slotSize.
+func MemoryForSlots(slotSize resource.Quantity, slots int32) Bytes {
+	return BytesFromResourceQuantity(slotSize) * Bytes(slots)
+}
@@ -0,0 +1,175 @@
+package api_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+func TestComputeUnitsFromFloat64(t *testing.T) {
+	cases := []struct {
+		cu       float64
+		expected api.ComputeUnits
+	}{
+		{0, 0},
+		{-1, 0},
+		{math.NaN(), 0},
+		{0.25, 250},
+		{2, 2000},
+		{0.1 + 0.2, 300}, // floating-point error is ignored
+		{0.0001, 1},      // rounds up to the next milli-CU
+		{1.2345, 1235},
+		{math.Inf(1), math.MaxUint32},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprint(c.cu), func(t *testing.T) {
+			assert.Equal(t, c.expected, api.ComputeUnitsFromFloat64(c.cu))
+		})
+	}
+}
+
+func TestComputeUnitsRounding(t *testing.T) {
+	cu := api.ComputeUnits(1250)
+	assert.False(t, cu.IsWhole())
+	assert.Equal(t, uint32(1), cu.Floor())
+	assert.Equal(t, uint32(2), cu.Ceil())
+	assert.Equal(t, api.WholeComputeUnits(2), cu.RoundedUp())
+	assert.Equal(t, 1.25, cu.AsFloat64())
+
+	whole := api.WholeComputeUnits(3)
+	assert.True(t, whole.IsWhole())
+	assert.Equal(t, uint32(3), whole.Floor())
+	assert.Equal(t, uint32(3), whole.Ceil())
+	assert.Equal(t, whole, whole.RoundedUp())
+
+	assert.Equal(t, "1.25", fmt.Sprintf("%v", cu))
+	assert.Equal(t, "1250", fmt.Sprintf("%#v", cu))
+}
+
+func TestComputeUnitsJSON(t *testing.T) {
+	cases := []struct {
+		cu   api.ComputeUnits
+		json string
+	}{
+		{0, "0"},
+		{api.WholeComputeUnits(2), "2"},
+		{250, "0.25"},
+		{1500, "1.5"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.json, func(t *testing.T) {
+			data, err := json.Marshal(c.cu)
+			require.NoError(t, err)
+			assert.Equal(t, c.json, string(data))
+
+			var decoded api.ComputeUnits
+			require.NoError(t, json.Unmarshal(data, &decoded))
+			assert.Equal(t, c.cu, decoded)
+		})
+	}
+
+	var cu api.ComputeUnits
+	require.NoError(t, json.Unmarshal([]byte("0.0004"), &cu))
+	assert.Equal(t, api.ComputeUnits(0), cu, "should round to the nearest milli-CU")
+	assert.ErrorContains(t, json.Unmarshal([]byte("-1"), &cu), "must not be negative")
+	assert.ErrorContains(t, json.Unmarshal([]byte("1e10"), &cu), "too large")
+	assert.Error(t, json.Unmarshal([]byte(`"1"`), &cu))
+}
+
+func TestParseResources(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected api.Resources
+		error    string
+	}{
+		{"250m,1Gi", api.Resources{VCPU: 250, Mem: gib}, ""},
+		{"0.25,1Gi", api.Resources{VCPU: 250, Mem: gib}, ""},
+		{"2,4096Mi", api.Resources{VCPU: 2000, Mem: 4 * gib}, ""},
+		{"250m", api.Resources{}, "value must be of the form 'cpu,mem'"},
+		{"abc,1Gi", api.Resources{}, "invalid cpu"},
+		{"250m,1Gx", api.Resources{}, "invalid mem"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			r, err := api.ParseResources(c.input)
+			if c.error == "" {
+				require.NoError(t, err)
+				assert.Equal(t, c.expected, r)
+			} else {
+				assert.ErrorContains(t, err, c.error)
+			}
+		})
+	}
+}
+
+func TestReadComputeUnitFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	cu, err := api.ReadComputeUnitFile(writeFile("valid.json", `{"vCPUs": 0.25, "mem": "1Gi"}`))
+	require.NoError(t, err)
+	assert.Equal(t, api.Resources{VCPU: 250, Mem: gib}, cu)
+
+	cases := []struct {
+		name    string
+		content string
+		error   string
+	}{
+		{"invalid-json", `{"vCPUs": `, "error decoding compute unit"},
+		{"unknown-field", `{"vCPUs": 0.25, "mem": "1Gi", "other": 1}`, `unknown field "other"`},
+		{"zero-cpu", `{"vCPUs": 0, "mem": "1Gi"}`, "invalid compute unit in"},
+		{"zero-mem", `{"vCPUs": 1, "mem": 0}`, "mem must be non-zero"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := api.ReadComputeUnitFile(writeFile(c.name+".json", c.content))
+			assert.ErrorContains(t, err, c.error)
+		})
+	}
+
+	_, err = api.ReadComputeUnitFile(filepath.Join(dir, "does-not-exist.json"))
+	assert.ErrorContains(t, err, "error reading compute unit file")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestMemSlotsPerCU(t *testing.T) {
+	cu := api.Resources{VCPU: 250, Mem: 4 * gib}
+
+	slots, err := cu.MemSlotsPerCU(gib)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(4), slots)
+
+	slots, err = cu.MemSlotsPerCU(4 * gib)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(1), slots)
+
+	_, err = cu.MemSlotsPerCU(0)
+	assert.ErrorContains(t, err, "must be non-zero")
+	_, err = cu.MemSlotsPerCU(3 * gib)
+	assert.ErrorContains(t, err, "not divisible by memory slot size")
+	_, err = cu.MemSlotsPerCU(1)
+	assert.ErrorContains(t, err, "too many memory slots")
+}
+
+func TestMemoryForSlots(t *testing.T) {
+	assert.Equal(t, 4*gib, api.MemoryForSlots(resource.MustParse("1Gi"), 4))
+	assert.Equal(t, api.Bytes(0), api.MemoryForSlots(resource.MustParse("1Gi"), 0))
+	assert.Equal(t, 3*512*api.Bytes(1<<20), api.MemoryForSlots(resource.MustParse("512Mi"), 3))
+}
@@ -0,0 +1,476 @@
+package api
+
+// Protobuf encoding and decoding of the messages in pkg/api.
+//
+// Refer to api.proto for the message definitions. The Go code for them is generated into
+// pkg/api/apipb by protoc-gen-go; this file converts between those generated types and the types
+// in pkg/api, which remain the ones used everywhere else.
+//
+// The ToProto methods and *FromProto functions are the conversions themselves, so the generated
+// messages can be encoded either in the binary format (with google.golang.org/protobuf/proto, as
+// MarshalProto does) or with the canonical protobuf JSON mapping (with
+// google.golang.org/protobuf/encoding/protojson).
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api/apipb"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+// ContentTypeProtobuf is the HTTP Content-Type used for protobuf-encoded messages.
+const ContentTypeProtobuf = "application/x-protobuf"
+
+///////////////////////////////////////////
+// Autoscaler-agent <-> scheduler plugin //
+///////////////////////////////////////////
+
+// MarshalProto returns the protobuf encoding of the AgentRequest.
+func (r AgentRequest) MarshalProto() ([]byte, error) {
+	data, err := proto.Marshal(r.ToProto())
+	if err != nil {
+		return nil, fmt.Errorf("could not encode AgentRequest: %w", err)
+	}
+	return data, nil
+}
+
+// UnmarshalProto sets r to the AgentRequest decoded from its protobuf encoding.
+func (r *AgentRequest) UnmarshalProto(data []byte) error {
+	var msg apipb.AgentRequest
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("could not decode AgentRequest: %w", err)
+	}
+	*r = AgentRequestFromProto(&msg)
+	return nil
+}
+
+// ToProto returns the generated protobuf message equivalent to the AgentRequest.
+func (r AgentRequest) ToProto() *apipb.AgentRequest {
+	msg := &apipb.AgentRequest{
+		ProtoVersion: uint32(r.ProtoVersion),
+		Pod:          namespacedNameToProto(r.Pod),
+		ComputeUnit:  r.ComputeUnit.toProto(),
+		Resources:    r.Resources.toProto(),
+		LastPermit:   nil,
+		Metrics:      nil,
+		Departing:    r.Departing,
+		RequestId:    r.RequestID,
+	}
+	if r.LastPermit != nil {
+		msg.LastPermit = r.LastPermit.toProto()
+	}
+	if r.Metrics != nil {
+		msg.Metrics = r.Metrics.toProto()
+	}
+	return msg
+}
+
+// AgentRequestFromProto returns the AgentRequest equivalent to the generated protobuf message.
+func AgentRequestFromProto(msg *apipb.AgentRequest) AgentRequest {
+	req := AgentRequest{
+		ProtoVersion: PluginProtoVersion(msg.GetProtoVersion()),
+		Pod:          namespacedNameFromProto(msg.GetPod()),
+		ComputeUnit:  resourcesFromProto(msg.GetComputeUnit()),
+		Resources:    resourcesFromProto(msg.GetResources()),
+		LastPermit:   nil,
+		Metrics:      nil,
+		Departing:    msg.GetDeparting(),
+		RequestID:    msg.GetRequestId(),
+	}
+	if msg.LastPermit != nil {
+		permit := resourcesFromProto(msg.LastPermit)
+		req.LastPermit = &permit
+	}
+	if msg.Metrics != nil {
+		metrics := metricsFromProto(msg.Metrics)
+		req.Metrics = &metrics
+	}
+	return req
+}
+
+// MarshalProto returns the protobuf encoding of the PluginResponse.
+func (r PluginResponse) MarshalProto() ([]byte, error) {
+	data, err := proto.Marshal(r.ToProto())
+	if err != nil {
+		return nil, fmt.Errorf("could not encode PluginResponse: %w", err)
+	}
+	return data, nil
+}
+
+// UnmarshalProto sets r to the PluginResponse decoded from its protobuf encoding.
+func (r *PluginResponse) UnmarshalProto(data []byte) error {
+	var msg apipb.PluginResponse
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("could not decode PluginResponse: %w", err)
+	}
+	*r = PluginResponseFromProto(&msg)
+	return nil
+}
+
+// ToProto returns the generated protobuf message equivalent to the PluginResponse.
+func (r PluginResponse) ToProto() *apipb.PluginResponse {
+	msg := &apipb.PluginResponse{
+		Permit:  r.Permit.toProto(),
+		Migrate: nil,
+		Reason:  nil,
+	}
+	if r.Migrate != nil {
+		msg.Migrate = &apipb.MigrateResponse{}
+	}
+	if r.Reason != nil {
+		reason := string(*r.Reason)
+		msg.Reason = &reason
+	}
+	return msg
+}
+
+// PluginResponseFromProto returns the PluginResponse equivalent to the generated protobuf message.
+func PluginResponseFromProto(msg *apipb.PluginResponse) PluginResponse {
+	resp := PluginResponse{
+		Permit:  resourcesFromProto(msg.GetPermit()),
+		Migrate: nil,
+		Reason:  nil,
+	}
+	if msg.Migrate != nil {
+		resp.Migrate = &MigrateResponse{}
+	}
+	if msg.Reason != nil {
+		reason := DenialReason(*msg.Reason)
+		resp.Reason = &reason
+	}
+	return resp
+}
+
+func namespacedNameToProto(n util.NamespacedName) *apipb.NamespacedName {
+	return &apipb.NamespacedName{
+		Namespace: n.Namespace,
+		Name:      n.Name,
+	}
+}
+
+func namespacedNameFromProto(msg *apipb.NamespacedName) util.NamespacedName {
+	return util.NamespacedName{
+		Namespace: msg.GetNamespace(),
+		Name:      msg.GetName(),
+	}
+}
+
+func (r Resources) toProto() *apipb.Resources {
+	return &apipb.Resources{
+		MilliVcpus: uint32(r.VCPU),
+		Mem:        uint64(r.Mem),
+	}
+}
+
+func resourcesFromProto(msg *apipb.Resources) Resources {
+	return Resources{
+		VCPU: vmv1.MilliCPU(msg.GetMilliVcpus()),
+		Mem:  Bytes(msg.GetMem()),
+	}
+}
+
+func (m Metrics) toProto() *apipb.Metrics {
+	return &apipb.Metrics{
+		LoadAvg_1M:       m.LoadAverage1Min,
+		LoadAvg_5M:       m.LoadAverage5Min,
+		MemoryUsageBytes: m.MemoryUsageBytes,
+	}
+}
+
+func metricsFromProto(msg *apipb.Metrics) Metrics {
+	return Metrics{
+		LoadAverage1Min:  msg.GetLoadAvg_1M(),
+		LoadAverage5Min:  msg.LoadAvg_5M,
+		MemoryUsageBytes: msg.MemoryUsageBytes,
+	}
+}
+
+/////////////
+// VM info //
+/////////////
+
+// MarshalProto returns the protobuf encoding of the VmInfo.
+//
+// This can only fail if the VM's ScalingConfig cannot be encoded as JSON.
+func (vm VmInfo) MarshalProto() ([]byte, error) {
+	msg, err := vm.ToProto()
+	if err != nil {
+		return nil, err
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode VmInfo: %w", err)
+	}
+	return data, nil
+}
+
+// UnmarshalProto sets vm to the VmInfo decoded from its protobuf encoding.
+func (vm *VmInfo) UnmarshalProto(data []byte) error {
+	var msg apipb.VmInfo
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return fmt.Errorf("could not decode VmInfo: %w", err)
+	}
+	info, err := VmInfoFromProto(&msg)
+	if err != nil {
+		return err
+	}
+	*vm = info
+	return nil
+}
+
+// ToProto returns the generated protobuf message equivalent to the VmInfo.
+//
+// This can only fail if the VM's ScalingConfig cannot be encoded as JSON.
+func (vm VmInfo) ToProto() (*apipb.VmInfo, error) {
+	msg := &apipb.VmInfo{
+		Name:      vm.Name,
+		Namespace: vm.Namespace,
+		Cpu: &apipb.VmCpuInfo{
+			Min: uint32(vm.Cpu.Min),
+			Max: uint32(vm.Cpu.Max),
+			Use: uint32(vm.Cpu.Use),
+		},
+		Mem: &apipb.VmMemInfo{
+			Min:      uint32(vm.Mem.Min),
+			Max:      uint32(vm.Mem.Max),
+			Use:      uint32(vm.Mem.Use),
+			SlotSize: uint64(vm.Mem.SlotSize),
+		},
+		Config: &apipb.VmConfig{
+			AutoMigrationEnabled: vm.Config.AutoMigrationEnabled,
+			AlwaysMigrate:        vm.Config.AlwaysMigrate,
+			ScalingEnabled:       vm.Config.ScalingEnabled,
+			ScalingConfigJson:    nil,
+		},
+		CurrentRevision: nil,
+	}
+
+	if vm.Config.ScalingConfig != nil {
+		scalingConfig, err := json.Marshal(vm.Config.ScalingConfig)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode ScalingConfig: %w", err)
+		}
+		msg.Config.ScalingConfigJson = scalingConfig
+	}
+
+	if rev := vm.CurrentRevision; rev != nil {
+		msg.CurrentRevision = &apipb.RevisionWithTime{
+			Value:            rev.Value,
+			Flags:            uint64(rev.Flags),
+			UpdatedAtSeconds: 0,
+			UpdatedAtNanos:   0,
+		}
+		// Leave the zero time as zero, rather than the (very negative) number of seconds since the
+		// unix epoch, so that it round-trips.
+		if !rev.UpdatedAt.IsZero() {
+			msg.CurrentRevision.UpdatedAtSeconds = rev.UpdatedAt.Unix()
+			msg.CurrentRevision.UpdatedAtNanos = int32(rev.UpdatedAt.Nanosecond())
+		}
+	}
+
+	return msg, nil
+}
+
+// VmInfoFromProto returns the VmInfo equivalent to the generated protobuf message.
+//
+// This fails if the message's memory slot counts don't fit in a uint16, or if its ScalingConfig
+// cannot be decoded.
+func VmInfoFromProto(msg *apipb.VmInfo) (VmInfo, error) {
+	slots := func(field string, v uint32) (uint16, error) {
+		if v > math.MaxUint16 {
+			return 0, fmt.Errorf("could not decode VmInfo: mem.%s value %d overflows uint16", field, v)
+		}
+		return uint16(v), nil
+	}
+
+	minSlots, err := slots("min", msg.GetMem().GetMin())
+	if err != nil {
+		return VmInfo{}, err
+	}
+	maxSlots, err := slots("max", msg.GetMem().GetMax())
+	if err != nil {
+		return VmInfo{}, err
+	}
+	useSlots, err := slots("use", msg.GetMem().GetUse())
+	if err != nil {
+		return VmInfo{}, err
+	}
+
+	info := VmInfo{
+		Name:      msg.GetName(),
+		Namespace: msg.GetNamespace(),
+		Cpu: VmCpuInfo{
+			Min: vmv1.MilliCPU(msg.GetCpu().GetMin()),
+			Max: vmv1.MilliCPU(msg.GetCpu().GetMax()),
+			Use: vmv1.MilliCPU(msg.GetCpu().GetUse()),
+		},
+		Mem: VmMemInfo{
+			Min:      minSlots,
+			Max:      maxSlots,
+			Use:      useSlots,
+			SlotSize: Bytes(msg.GetMem().GetSlotSize()),
+		},
+		Config: VmConfig{
+			AutoMigrationEnabled: msg.GetConfig().GetAutoMigrationEnabled(),
+			AlwaysMigrate:        msg.GetConfig().GetAlwaysMigrate(),
+			ScalingEnabled:       msg.GetConfig().GetScalingEnabled(),
+			ScalingConfig:        nil,
+		},
+		CurrentRevision: nil,
+	}
+
+	if data := msg.GetConfig().GetScalingConfigJson(); data != nil {
+		var scalingConfig ScalingConfig
+		if err := json.Unmarshal(data, &scalingConfig); err != nil {
+			return VmInfo{}, fmt.Errorf("could not decode VmInfo: could not decode ScalingConfig: %w", err)
+		}
+		info.Config.ScalingConfig = &scalingConfig
+	}
+
+	if rev := msg.CurrentRevision; rev != nil {
+		var updatedAt metav1.Time
+		if rev.UpdatedAtSeconds != 0 || rev.UpdatedAtNanos != 0 {
+			updatedAt = metav1.NewTime(time.Unix(rev.UpdatedAtSeconds, int64(rev.UpdatedAtNanos)))
+		}
+		info.CurrentRevision = &vmv1.RevisionWithTime{
+			Revision: vmv1.Revision{
+				Value: rev.Value,
+				Flags: vmv1.Flag(rev.Flags),
+			},
+			UpdatedAt: updatedAt,
+		}
+	}
+
+	return info, nil
+}
+
+/////////////////////////////////////
+// Autoscaler-agent <-> vm-monitor //
+/////////////////////////////////////
+
+// SerializeMonitorMessageProto is the protobuf equivalent of SerializeMonitorMessage.
+//
+// Unlike SerializeMonitorMessage, it also accepts the types sent by the vm-monitor, so that it can
+// be used by either side.
+func SerializeMonitorMessageProto(content any, id uint64) ([]byte, error) {
+	msg, err := MonitorMessageToProto(content, id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode monitor message: %w", err)
+	}
+	return data, nil
+}
+
+// DeserializeMonitorMessageProto decodes a message produced by SerializeMonitorMessageProto,
+// returning its content (e.g. a DownscaleRequest) and id.
+func DeserializeMonitorMessageProto(data []byte) (content any, id uint64, _ error) {
+	var msg apipb.MonitorMessage
+	if err := proto.Unmarshal(data, &msg); err != nil {
+		return nil, 0, fmt.Errorf("could not decode monitor message: %w", err)
+	}
+	return MonitorMessageFromProto(&msg)
+}
+
+// MonitorMessageToProto returns the generated protobuf message wrapping content, which must be one
+// of the message types exchanged between the autoscaler-agent and vm-monitor.
+func MonitorMessageToProto(content any, id uint64) (*apipb.MonitorMessage, error) {
+	msg := &apipb.MonitorMessage{Id: id, Content: nil}
+
+	switch c := content.(type) {
+	case UpscaleRequest:
+		msg.Content = &apipb.MonitorMessage_UpscaleRequest{UpscaleRequest: &apipb.UpscaleRequest{}}
+	case UpscaleConfirmation:
+		msg.Content = &apipb.MonitorMessage_UpscaleConfirmation{UpscaleConfirmation: &apipb.UpscaleConfirmation{}}
+	case DownscaleResult:
+		msg.Content = &apipb.MonitorMessage_DownscaleResult{
+			DownscaleResult: &apipb.DownscaleResult{Ok: c.Ok, Status: c.Status},
+		}
+	case UpscaleNotification:
+		msg.Content = &apipb.MonitorMessage_UpscaleNotification{
+			UpscaleNotification: &apipb.UpscaleNotification{
+				Granted:   c.Granted.toProto(),
+				RequestId: c.RequestID,
+			},
+		}
+	case DownscaleRequest:
+		msg.Content = &apipb.MonitorMessage_DownscaleRequest{
+			DownscaleRequest: &apipb.DownscaleRequest{
+				Target:    c.Target.toProto(),
+				RequestId: c.RequestID,
+			},
+		}
+	case InvalidMessage:
+		msg.Content = &apipb.MonitorMessage_InvalidMessage{InvalidMessage: &apipb.InvalidMessage{Error: c.Error}}
+	case InternalError:
+		msg.Content = &apipb.MonitorMessage_InternalError{InternalError: &apipb.InternalError{Error: c.Error}}
+	case HealthCheck:
+		msg.Content = &apipb.MonitorMessage_HealthCheck{HealthCheck: &apipb.HealthCheck{}}
+	default:
+		return nil, fmt.Errorf("unknown message type \"%s\"", reflect.TypeOf(content))
+	}
+
+	return msg, nil
+}
+
+// MonitorMessageFromProto returns the content (e.g. a DownscaleRequest) and id of the generated
+// protobuf message.
+func MonitorMessageFromProto(msg *apipb.MonitorMessage) (content any, id uint64, _ error) {
+	switch c := msg.GetContent().(type) {
+	case *apipb.MonitorMessage_UpscaleRequest:
+		content = UpscaleRequest{}
+	case *apipb.MonitorMessage_UpscaleConfirmation:
+		content = UpscaleConfirmation{}
+	case *apipb.MonitorMessage_DownscaleResult:
+		content = DownscaleResult{
+			Ok:     c.DownscaleResult.GetOk(),
+			Status: c.DownscaleResult.GetStatus(),
+		}
+	case *apipb.MonitorMessage_UpscaleNotification:
+		content = UpscaleNotification{
+			Granted:   allocationFromProto(c.UpscaleNotification.GetGranted()),
+			RequestID: c.UpscaleNotification.GetRequestId(),
+		}
+	case *apipb.MonitorMessage_DownscaleRequest:
+		content = DownscaleRequest{
+			Target:    allocationFromProto(c.DownscaleRequest.GetTarget()),
+			RequestID: c.DownscaleRequest.GetRequestId(),
+		}
+	case *apipb.MonitorMessage_InvalidMessage:
+		content = InvalidMessage{Error: c.InvalidMessage.GetError()}
+	case *apipb.MonitorMessage_InternalError:
+		content = InternalError{Error: c.InternalError.GetError()}
+	case *apipb.MonitorMessage_HealthCheck:
+		content = HealthCheck{}
+	default:
+		return nil, 0, errors.New("could not decode monitor message: missing content")
+	}
+
+	return content, msg.GetId(), nil
+}
+
+func (a Allocation) toProto() *apipb.Allocation {
+	return &apipb.Allocation{
+		Cpu: a.Cpu,
+		Mem: a.Mem,
+	}
+}
+
+func allocationFromProto(msg *apipb.Allocation) Allocation {
+	return Allocation{
+		Cpu: msg.GetCpu(),
+		Mem: msg.GetMem(),
+	}
+}
@@ -0,0 +1,354 @@
+package api_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/api/apipb"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+func TestAgentRequestProtoRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		req  api.AgentRequest
+	}{
+		{
+			name: "Empty",
+			req: api.AgentRequest{
+				ProtoVersion: 0,
+				Pod:          util.NamespacedName{Namespace: "", Name: ""},
+				ComputeUnit:  api.Resources{VCPU: 0, Mem: 0},
+				Resources:    api.Resources{VCPU: 0, Mem: 0},
+				LastPermit:   nil,
+				Metrics:      nil,
+				Departing:    false,
+				RequestID:    "",
+			},
+		},
+		{
+			name: "AllFields",
+			req: api.AgentRequest{
+				ProtoVersion: api.PluginProtoV1_0,
+				Pod:          util.NamespacedName{Namespace: "default", Name: "pod"},
+				ComputeUnit:  api.Resources{VCPU: 250, Mem: 1 << 30},
+				Resources:    api.Resources{VCPU: 1500, Mem: 6 << 30},
+				LastPermit:   &api.Resources{VCPU: 1000, Mem: 4 << 30},
+				Metrics: &api.Metrics{
+					LoadAverage1Min:  1.5,
+					LoadAverage5Min:  lo.ToPtr[float32](0.75),
+					MemoryUsageBytes: lo.ToPtr[float32](1 << 20),
+				},
+				Departing: true,
+				RequestID: "abc-123",
+			},
+		},
+		{
+			// Optional fields that are present but zero must stay present
+			name: "ZeroOptionalFields",
+			req: api.AgentRequest{
+				ProtoVersion: api.PluginProtoV1_0,
+				Pod:          util.NamespacedName{Namespace: "default", Name: "pod"},
+				ComputeUnit:  api.Resources{VCPU: 250, Mem: 1 << 30},
+				Resources:    api.Resources{VCPU: 250, Mem: 1 << 30},
+				LastPermit:   &api.Resources{VCPU: 0, Mem: 0},
+				Metrics: &api.Metrics{
+					LoadAverage1Min:  0,
+					LoadAverage5Min:  lo.ToPtr[float32](0),
+					MemoryUsageBytes: nil,
+				},
+				Departing: false,
+				RequestID: "",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := c.req.MarshalProto()
+			require.NoError(t, err)
+			var decoded api.AgentRequest
+			require.NoError(t, decoded.UnmarshalProto(data))
+			assert.Equal(t, c.req, decoded)
+
+			jsonData, err := protojson.Marshal(c.req.ToProto())
+			require.NoError(t, err)
+			var msg apipb.AgentRequest
+			require.NoError(t, protojson.Unmarshal(jsonData, &msg))
+			assert.Equal(t, c.req, api.AgentRequestFromProto(&msg))
+		})
+	}
+}
+
+func TestPluginResponseProtoRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		resp api.PluginResponse
+	}{
+		{
+			name: "PermitOnly",
+			resp: api.PluginResponse{
+				Permit:  api.Resources{VCPU: 1000, Mem: 4 << 30},
+				Migrate: nil,
+				Reason:  nil,
+			},
+		},
+		{
+			name: "AllFields",
+			resp: api.PluginResponse{
+				Permit:  api.Resources{VCPU: 1000, Mem: 4 << 30},
+				Migrate: &api.MigrateResponse{},
+				Reason:  lo.ToPtr(api.DenialReasonQuotaExceeded),
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := c.resp.MarshalProto()
+			require.NoError(t, err)
+			var decoded api.PluginResponse
+			require.NoError(t, decoded.UnmarshalProto(data))
+			assert.Equal(t, c.resp, decoded)
+
+			jsonData, err := protojson.Marshal(c.resp.ToProto())
+			require.NoError(t, err)
+			var msg apipb.PluginResponse
+			require.NoError(t, protojson.Unmarshal(jsonData, &msg))
+			assert.Equal(t, c.resp, api.PluginResponseFromProto(&msg))
+		})
+	}
+}
+
+func TestVmInfoProtoRoundTrip(t *testing.T) {
+	cases := []struct {
+		name string
+		info api.VmInfo
+	}{
+		{
+			name: "Minimal",
+			info: api.VmInfo{
+				Name:      "vm",
+				Namespace: "default",
+				Cpu:       api.VmCpuInfo{Min: 250, Max: 4000, Use: 1000},
+				Mem:       api.VmMemInfo{Min: 1, Max: 16, Use: 4, SlotSize: 1 << 30},
+				Config: api.VmConfig{
+					AutoMigrationEnabled: false,
+					AlwaysMigrate:        false,
+					ScalingEnabled:       false,
+					ScalingConfig:        nil,
+				},
+				CurrentRevision: nil,
+			},
+		},
+		{
+			name: "AllFields",
+			info: api.VmInfo{
+				Name:      "vm",
+				Namespace: "default",
+				Cpu:       api.VmCpuInfo{Min: 250, Max: 4000, Use: 1000},
+				Mem:       api.VmMemInfo{Min: 1, Max: 16, Use: 4, SlotSize: 1 << 30},
+				Config: api.VmConfig{
+					AutoMigrationEnabled: true,
+					AlwaysMigrate:        true,
+					ScalingEnabled:       true,
+					//nolint:exhaustruct // this is a test
+					ScalingConfig: &api.ScalingConfig{
+						LoadAverageFractionTarget: lo.ToPtr(0.9),
+						EnableLFCMetrics:          lo.ToPtr(true),
+					},
+				},
+				CurrentRevision: &vmv1.RevisionWithTime{
+					Revision:  vmv1.Revision{Value: 42, Flags: 1},
+					UpdatedAt: metav1.NewTime(time.Unix(1700000000, 123456789)),
+				},
+			},
+		},
+		{
+			name: "ZeroRevisionTime",
+			info: api.VmInfo{
+				Name:      "vm",
+				Namespace: "default",
+				Cpu:       api.VmCpuInfo{Min: 250, Max: 250, Use: 250},
+				Mem:       api.VmMemInfo{Min: 1, Max: 1, Use: 1, SlotSize: 1 << 30},
+				Config: api.VmConfig{
+					AutoMigrationEnabled: false,
+					AlwaysMigrate:        false,
+					ScalingEnabled:       true,
+					ScalingConfig:        nil,
+				},
+				CurrentRevision: &vmv1.RevisionWithTime{
+					Revision:  vmv1.ZeroRevision,
+					UpdatedAt: metav1.Time{},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := c.info.MarshalProto()
+			require.NoError(t, err)
+			var decoded api.VmInfo
+			require.NoError(t, decoded.UnmarshalProto(data))
+			assert.Equal(t, c.info, decoded)
+
+			msg, err := c.info.ToProto()
+			require.NoError(t, err)
+			jsonData, err := protojson.Marshal(msg)
+			require.NoError(t, err)
+			var jsonMsg apipb.VmInfo
+			require.NoError(t, protojson.Unmarshal(jsonData, &jsonMsg))
+			fromJSON, err := api.VmInfoFromProto(&jsonMsg)
+			require.NoError(t, err)
+			assert.Equal(t, c.info, fromJSON)
+		})
+	}
+}
+
+func TestMonitorMessageProtoRoundTrip(t *testing.T) {
+	messages := []any{
+		api.UpscaleRequest{},
+		api.UpscaleConfirmation{},
+		api.DownscaleResult{Ok: true, Status: "downscaled"},
+		api.UpscaleNotification{Granted: api.Allocation{Cpu: 1.5, Mem: 6 << 30}, RequestID: "abc-123"},
+		api.DownscaleRequest{Target: api.Allocation{Cpu: 0.25, Mem: 1 << 30}, RequestID: ""},
+		api.InvalidMessage{Error: "invalid"},
+		api.InternalError{Error: "internal"},
+		api.HealthCheck{},
+	}
+
+	for i, content := range messages {
+		id := uint64(i + 1)
+		data, err := api.SerializeMonitorMessageProto(content, id)
+		require.NoError(t, err)
+		decoded, decodedID, err := api.DeserializeMonitorMessageProto(data)
+		require.NoError(t, err)
+		assert.Equal(t, content, decoded)
+		assert.Equal(t, id, decodedID)
+
+		msg, err := api.MonitorMessageToProto(content, id)
+		require.NoError(t, err)
+		jsonData, err := protojson.Marshal(msg)
+		require.NoError(t, err)
+		var jsonMsg apipb.MonitorMessage
+		require.NoError(t, protojson.Unmarshal(jsonData, &jsonMsg))
+		decoded, decodedID, err = api.MonitorMessageFromProto(&jsonMsg)
+		require.NoError(t, err)
+		assert.Equal(t, content, decoded)
+		assert.Equal(t, id, decodedID)
+	}
+
+	_, err := api.SerializeMonitorMessageProto(struct{}{}, 1)
+	assert.ErrorContains(t, err, "unknown message type")
+
+	_, _, err = api.DeserializeMonitorMessageProto(protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 1))
+	assert.ErrorContains(t, err, "missing content")
+}
+
+// The protobuf JSON mapping must use the same field names as the encoding/json format, so that
+// the two only differ in how some values are represented.
+func TestProtoJSONFieldNames(t *testing.T) {
+	req := api.AgentRequest{
+		ProtoVersion: api.PluginProtoV1_0,
+		Pod:          util.NamespacedName{Namespace: "default", Name: "pod"},
+		ComputeUnit:  api.Resources{VCPU: 250, Mem: 1 << 30},
+		Resources:    api.Resources{VCPU: 1500, Mem: 6 << 30},
+		LastPermit:   &api.Resources{VCPU: 1000, Mem: 4 << 30},
+		Metrics: &api.Metrics{
+			LoadAverage1Min:  1.5,
+			LoadAverage5Min:  lo.ToPtr[float32](0.75),
+			MemoryUsageBytes: lo.ToPtr[float32](1 << 20),
+		},
+		Departing: true,
+		RequestID: "abc-123",
+	}
+
+	keys := func(data []byte) map[string]any {
+		var obj map[string]any
+		require.NoError(t, json.Unmarshal(data, &obj))
+		for k := range obj {
+			obj[k] = nil
+		}
+		return obj
+	}
+
+	jsonData, err := json.Marshal(req)
+	require.NoError(t, err)
+	protoJSONData, err := protojson.Marshal(req.ToProto())
+	require.NoError(t, err)
+	assert.Equal(t, keys(jsonData), keys(protoJSONData))
+}
+
+func TestProtoUnknownFieldsIgnored(t *testing.T) {
+	resp := api.PluginResponse{
+		Permit:  api.Resources{VCPU: 500, Mem: 1 << 30},
+		Migrate: nil,
+		Reason:  nil,
+	}
+	data, err := resp.MarshalProto()
+	require.NoError(t, err)
+	// Fields from a newer version of the protocol, of each wire type
+	data = protowire.AppendTag(data, 100, protowire.VarintType)
+	data = protowire.AppendVarint(data, 7)
+	data = protowire.AppendTag(data, 101, protowire.BytesType)
+	data = protowire.AppendString(data, "new field")
+	data = protowire.AppendTag(data, 102, protowire.Fixed32Type)
+	data = protowire.AppendFixed32(data, 1)
+	data = protowire.AppendTag(data, 103, protowire.Fixed64Type)
+	data = protowire.AppendFixed64(data, 1)
+
+	var decoded api.PluginResponse
+	require.NoError(t, decoded.UnmarshalProto(data))
+	assert.Equal(t, resp, decoded)
+}
+
+func TestProtoDecodeErrors(t *testing.T) {
+	cases := []struct {
+		name  string
+		data  []byte
+		error string
+	}{
+		{
+			name:  "Truncated",
+			data:  protowire.AppendTag(nil, 1, protowire.BytesType),
+			error: "invalid wire-format data",
+		},
+		{
+			name: "InvalidUTF8",
+			// request_id is a string, so must be valid UTF-8
+			data:  protowire.AppendBytes(protowire.AppendTag(nil, 8, protowire.BytesType), []byte{0xff}),
+			error: "invalid UTF-8",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var req api.AgentRequest
+			err := req.UnmarshalProto(c.data)
+			assert.ErrorContains(t, err, "could not decode AgentRequest")
+			assert.ErrorContains(t, err, c.error)
+		})
+	}
+
+	var info api.VmInfo
+	data, err := proto.Marshal(&apipb.VmInfo{ //nolint:exhaustruct // this is a test
+		Mem: &apipb.VmMemInfo{Min: 1, Max: 1 << 16, Use: 1, SlotSize: 1 << 30},
+	})
+	require.NoError(t, err)
+	err = info.UnmarshalProto(data)
+	assert.ErrorContains(t, err, "could not decode VmInfo")
+	assert.ErrorContains(t, err, "mem.max value 65536 overflows uint16")
+}
@@ -0,0 +1,231 @@
+package api
+
+// Schemas for the messages of the agent<->scheduler plugin and agent<->monitor protocols.
+
+import (
+	"reflect"
+	"sync"
+)
+
+// AgentRequestSchema returns the JSON schema for AgentRequest, sent by the autoscaler-agent to the
+// scheduler plugin.
+var AgentRequestSchema = sync.OnceValue(func() *Schema {
+	return rootSchema("AgentRequest", func(g *schemaGenerator) *Schema {
+		return g.ref(AgentRequest{})
+	})
+})
+
+// PluginResponseSchema returns the JSON schema for PluginResponse, sent by the scheduler plugin in
+// response to an AgentRequest.
+var PluginResponseSchema = sync.OnceValue(func() *Schema {
+	return rootSchema("PluginResponse", func(g *schemaGenerator) *Schema {
+		return g.ref(PluginResponse{})
+	})
+})
+
+// AgentHandshakeSchema returns the JSON schema for AgentHandshake, sent by the autoscaler-agent to
+// the scheduler plugin.
+var AgentHandshakeSchema = sync.OnceValue(func() *Schema {
+	return rootSchema("AgentHandshake", func(g *schemaGenerator) *Schema {
+		return g.ref(AgentHandshake{})
+	})
+})
+
+// PluginHandshakeResponseSchema returns the JSON schema for PluginHandshakeResponse, sent by the
+// scheduler plugin in response to an AgentHandshake.
+var PluginHandshakeResponseSchema = sync.OnceValue(func() *Schema {
+	return rootSchema("PluginHandshakeResponse", func(g *schemaGenerator) *Schema {
+		return g.ref(PluginHandshakeResponse{})
+	})
+})
+
+// MonitorProtocolRangeSchema returns the JSON schema for the range of protocol versions sent by the
+// autoscaler-agent to the vm-monitor as the first message on a new connection.
+var MonitorProtocolRangeSchema = sync.OnceValue(func() *Schema {
+	return rootSchema("MonitorProtocolRange", func(g *schemaGenerator) *Schema {
+		return g.ref(VersionRange[MonitorProtoVersion]{})
+	})
+})
+
+// MonitorProtocolResponseSchema returns the JSON schema for MonitorProtocolResponse, sent by the
+// vm-monitor in response to the range of protocol versions.
+var MonitorProtocolResponseSchema = sync.OnceValue(func() *Schema {
+	return rootSchema("MonitorProtocolResponse", func(g *schemaGenerator) *Schema {
+		return g.ref(MonitorProtocolResponse{})
+	})
+})
+
+// AgentToMonitorMessageSchema returns the JSON schema for all messages sent by the autoscaler-agent
+// to the vm-monitor after the protocol version is settled, as produced by SerializeMonitorMessage.
+//
+// These messages are of the form {"type": <name>, "id": <id>, "content": <message>}.
+var AgentToMonitorMessageSchema = sync.OnceValue(func() *Schema {
+	return rootSchema("AgentToMonitorMessage", func(g *schemaGenerator) *Schema {
+		messages := []any{
+			DownscaleRequest{},
+			UpscaleNotification{},
+			InvalidMessage{},
+			InternalError{},
+			HealthCheck{},
+		}
+
+		var options []*Schema
+		for _, m := range messages {
+			name := defName(reflect.TypeOf(m))
+			options = append(options, g.define(name+"Message", &Schema{
+				Title: name + "Message",
+				Type:  "object",
+				Properties: map[string]*Schema{
+					"type":    {Type: "string", Const: name},
+					"id":      messageIDSchema(),
+					"content": g.ref(m),
+				},
+				Required:             []string{"type", "id", "content"},
+				AdditionalProperties: false,
+			}))
+		}
+		return &Schema{AnyOf: options}
+	})
+})
+
+// MonitorToAgentMessageSchema returns the JSON schema for all messages sent by the vm-monitor to the
+// autoscaler-agent after the protocol version is settled.
+//
+// Unlike messages sent by the autoscaler-agent, the fields of these messages are alongside the
+// "type" and "id" fields, rather than under "content".
+var MonitorToAgentMessageSchema = sync.OnceValue(func() *Schema {
+	return rootSchema("MonitorToAgentMessage", func(g *schemaGenerator) *Schema {
+		messages := []any{
+			UpscaleRequest{},
+			UpscaleConfirmation{},
+			DownscaleResult{},
+			InternalError{},
+			HealthCheck{},
+			InvalidMessage{},
+		}
+
+		var options []*Schema
+		for _, m := range messages {
+			t := reflect.TypeOf(m)
+			name := defName(t)
+
+			schema := g.structSchema(t)
+			schema.Title = name + "Message"
+			schema.Properties["type"] = &Schema{Type: "string", Const: name}
+			schema.Properties["id"] = messageIDSchema()
+			schema.Required = append([]string{"type", "id"}, schema.Required...)
+
+			options = append(options, g.define(schema.Title, schema))
+		}
+		return &Schema{AnyOf: options}
+	})
+})
+
+func messageIDSchema() *Schema {
+	zero := float64(0)
+	return &Schema{Type: "integer", Minimum: &zero}
+}
+
+// PublishedSchemas returns the schemas and OpenAPI document that are published in pkg/api/schemas,
+// by their file name.
+func PublishedSchemas() map[string]any {
+	return map[string]any{
+		"agent-request.schema.json":             AgentRequestSchema(),
+		"plugin-response.schema.json":           PluginResponseSchema(),
+		"agent-handshake.schema.json":           AgentHandshakeSchema(),
+		"plugin-handshake-response.schema.json": PluginHandshakeResponseSchema(),
+		"plugin.openapi.json":                   PluginOpenAPISpec(),
+		"monitor-protocol-range.schema.json":    MonitorProtocolRangeSchema(),
+		"monitor-protocol-response.schema.json": MonitorProtocolResponseSchema(),
+		"agent-to-monitor.schema.json":          AgentToMonitorMessageSchema(),
+		"monitor-to-agent.schema.json":          MonitorToAgentMessageSchema(),
+	}
+}
+
+// rootSchema builds a standalone schema with the given title, including the definitions of all the
+// types it references.
+func rootSchema(title string, build func(*schemaGenerator) *Schema) *Schema {
+	g := newSchemaGenerator("#/$defs/")
+	schema := build(g)
+	schema.Schema = SchemaDialect
+	schema.Title = title
+	schema.Defs = g.defs
+	return schema
+}
+
+// PluginOpenAPISpec returns an OpenAPI 3.1 document describing the scheduler plugin's HTTP API for
+// requests from the autoscaler-agent.
+func PluginOpenAPISpec() map[string]any {
+	g := newSchemaGenerator("#/components/schemas/")
+	request := g.ref(AgentRequest{})
+	response := g.ref(PluginResponse{})
+	handshake := g.ref(AgentHandshake{})
+	handshakeResponse := g.ref(PluginHandshakeResponse{})
+
+	errorResponse := func(description string) map[string]any {
+		return map[string]any{
+			"description": description,
+			"content": map[string]any{
+				"text/plain": map[string]any{"schema": &Schema{Type: "string"}},
+			},
+		}
+	}
+
+	return map[string]any{
+		"openapi":           "3.1.0",
+		"jsonSchemaDialect": SchemaDialect,
+		"info": map[string]any{
+			"title":   "autoscaler-agent <-> scheduler plugin",
+			"version": latestPluginProtoVersion.String(),
+		},
+		"paths": map[string]any{
+			"/": map[string]any{
+				"post": map[string]any{
+					"summary": "Request or notify a change in resources for a VM's pod",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{"schema": request},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The resources that the VM is permitted to use",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": response},
+							},
+						},
+						"400": errorResponse("The request was malformed or invalid"),
+						"404": errorResponse("The pod or its node is not known to the scheduler"),
+						"500": errorResponse("Internal error while handling the request"),
+						"503": errorResponse("The scheduler is still starting up; retry later"),
+					},
+				},
+			},
+			"/agent-handshake": map[string]any{
+				"post": map[string]any{
+					"summary": "Notify the scheduler that the autoscaler-agent is live, and exchange capabilities",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{"schema": handshake},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The protocol versions and capabilities supported by the scheduler",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": handshakeResponse},
+							},
+						},
+						"400": errorResponse("The handshake was malformed or invalid"),
+						"503": errorResponse("The scheduler is still starting up; retry later"),
+					},
+				},
+			},
+		},
+		"components": map[string]any{
+			"schemas": g.defs,
+		},
+	}
+}
@@ -0,0 +1,444 @@
+package api
+
+// JSON schemas for the messages in this package, and validation of messages against them.
+//
+// The schemas are generated from the Go types via reflection, so that they can't drift from what we
+// actually send and accept. They're published in pkg/api/schemas (see the generator there), so that
+// other implementations - e.g. of the vm-monitor - can be built against them.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// SchemaDialect is the JSON Schema dialect used by Schema.
+const SchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is the subset of JSON Schema that we need to describe the messages in this package.
+type Schema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Ref, if not empty, is a reference to one of the Defs of the root schema, of the form
+	// "#/$defs/<name>" (or "#/components/schemas/<name>" in OpenAPI documents).
+	Ref string `json:"$ref,omitempty"`
+	// AnyOf, if not empty, requires that the value matches at least one of the schemas.
+	AnyOf []*Schema `json:"anyOf,omitempty"`
+
+	Type  string `json:"type,omitempty"`
+	Const any    `json:"const,omitempty"`
+
+	// Format and Pattern apply to strings.
+	Format  string `json:"format,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	// patternRegexp, if not nil, is the precompiled Pattern.
+	patternRegexp *regexp.Regexp
+	// Minimum applies to numbers and integers.
+	Minimum *float64 `json:"minimum,omitempty"`
+
+	// Items applies to arrays.
+	Items *Schema `json:"items,omitempty"`
+
+	// Properties, Required, and AdditionalProperties apply to objects.
+	//
+	// AdditionalProperties is either a *Schema for the values of properties not in Properties, or
+	// false if no other properties are allowed.
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+
+	Defs map[string]*Schema `json:"$defs,omitempty"`
+}
+
+// Validate checks that data is a single JSON value matching the schema, returning an error
+// describing the first mismatch if it does not.
+//
+// References are resolved against the Defs of s.
+func (s *Schema) Validate(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	} else if dec.More() {
+		return fmt.Errorf("invalid JSON: unexpected data after top-level value")
+	}
+
+	return s.validate(s, "$", value)
+}
+
+func (s *Schema) validate(root *Schema, path string, value any) error {
+	if s.Ref != "" {
+		def, err := root.resolve(s.Ref)
+		if err != nil {
+			return err
+		}
+		return def.validate(root, path, value)
+	}
+
+	if len(s.AnyOf) != 0 {
+		return s.validateAnyOf(root, path, value)
+	}
+
+	if s.Const != nil && value != s.Const {
+		return fmt.Errorf("%s: expected %q, got %v", path, s.Const, value)
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "null":
+		if value != nil {
+			return fmt.Errorf("%s: expected null", path)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean", path)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string", path)
+		}
+		if s.Pattern != "" {
+			re := s.patternRegexp
+			if re == nil {
+				var err error
+				if re, err = regexp.Compile(s.Pattern); err != nil {
+					return fmt.Errorf("%s: schema has invalid pattern: %w", path, err)
+				}
+			}
+			if !re.MatchString(str) {
+				return fmt.Errorf("%s: %q does not match pattern %q", path, str, s.Pattern)
+			}
+		}
+	case "integer", "number":
+		num, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected %s", path, s.Type)
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return fmt.Errorf("%s: invalid number %s", path, num)
+		}
+		if s.Type == "integer" {
+			if _, err := strconv.ParseInt(num.String(), 10, 64); err != nil {
+				if _, err := strconv.ParseUint(num.String(), 10, 64); err != nil {
+					return fmt.Errorf("%s: expected integer, got %s", path, num)
+				}
+			}
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			return fmt.Errorf("%s: %s is less than minimum %v", path, num, *s.Minimum)
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array", path)
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				if err := s.Items.validate(root, fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object", path)
+		}
+		return s.validateObject(root, path, obj)
+	default:
+		return fmt.Errorf("%s: schema has unsupported type %q", path, s.Type)
+	}
+
+	return nil
+}
+
+func (s *Schema) validateObject(root *Schema, path string, obj map[string]any) error {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			return fmt.Errorf("%s: missing required field %q", path, name)
+		}
+	}
+
+	// Sort the keys so that the error we return is deterministic
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		fieldPath := fmt.Sprintf("%s.%s", path, k)
+		if prop, ok := s.Properties[k]; ok {
+			if err := prop.validate(root, fieldPath, obj[k]); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch extra := s.AdditionalProperties.(type) {
+		case nil:
+		case bool:
+			if !extra {
+				return fmt.Errorf("%s: unknown field %q", path, k)
+			}
+		case *Schema:
+			if err := extra.validate(root, fieldPath, obj[k]); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%s: schema has unsupported additionalProperties %T", path, extra)
+		}
+	}
+
+	return nil
+}
+
+func (s *Schema) validateAnyOf(root *Schema, path string, value any) error {
+	for _, option := range s.AnyOf {
+		if option.validate(root, path, value) == nil {
+			return nil
+		}
+	}
+
+	// None of the options matched. If this is a tagged union (i.e., exactly one option has constant
+	// properties that all match), then the error from that option is more useful than a generic
+	// error.
+	if obj, ok := value.(map[string]any); ok {
+		var tagged *Schema
+		for _, option := range s.AnyOf {
+			if option.Ref != "" {
+				def, err := root.resolve(option.Ref)
+				if err != nil {
+					return err
+				}
+				option = def
+			}
+			if option.constPropertiesMatch(obj) {
+				if tagged != nil {
+					tagged = nil
+					break
+				}
+				tagged = option
+			}
+		}
+		if tagged != nil {
+			return tagged.validate(root, path, value)
+		}
+	}
+
+	return fmt.Errorf("%s: value does not match any of the %d allowed schemas", path, len(s.AnyOf))
+}
+
+func (s *Schema) constPropertiesMatch(obj map[string]any) bool {
+	found := false
+	for name, prop := range s.Properties {
+		if prop.Const == nil {
+			continue
+		}
+		if obj[name] != prop.Const {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+func (s *Schema) resolve(ref string) (*Schema, error) {
+	for _, prefix := range []string{"#/$defs/", "#/components/schemas/"} {
+		if name, ok := strings.CutPrefix(ref, prefix); ok {
+			if def, ok := s.Defs[name]; ok {
+				return def, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("schema has unresolvable reference %q", ref)
+}
+
+////////////////////////
+// Schema generation  //
+////////////////////////
+
+// quantityPattern matches the string format of resource.Quantity.
+const quantityPattern = `^(\+|-)?(([0-9]+(\.[0-9]*)?)|(\.[0-9]+))(([KMGTPE]i)|[numkMGTPE]|([eE](\+|-)?(([0-9]+(\.[0-9]*)?)|(\.[0-9]+))))?$`
+
+var quantityRegexp = regexp.MustCompile(quantityPattern)
+
+// schemaGenerator builds schemas for Go types, collecting named struct types into defs.
+type schemaGenerator struct {
+	// refPrefix is prepended to the name of each def to make references to it.
+	refPrefix string
+	defs      map[string]*Schema
+}
+
+func newSchemaGenerator(refPrefix string) *schemaGenerator {
+	return &schemaGenerator{
+		refPrefix: refPrefix,
+		defs:      make(map[string]*Schema),
+	}
+}
+
+// ref returns a reference to the def for the (struct) type of v, generating it if necessary.
+func (g *schemaGenerator) ref(v any) *Schema {
+	return g.schemaFor(reflect.TypeOf(v))
+}
+
+// define adds a def with the given name, returning a reference to it.
+func (g *schemaGenerator) define(name string, schema *Schema) *Schema {
+	if _, ok := g.defs[name]; ok {
+		panic(fmt.Sprintf("duplicate schema definition %q", name))
+	}
+	g.defs[name] = schema
+	return &Schema{Ref: g.refPrefix + name}
+}
+
+func (g *schemaGenerator) schemaFor(t reflect.Type) *Schema {
+	var (
+		bytesType    = reflect.TypeOf(Bytes(0))
+		milliCPUType = reflect.TypeOf(vmv1.MilliCPU(0))
+		cuType       = reflect.TypeOf(ComputeUnits(0))
+		marshaler    = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	)
+
+	zero := float64(0)
+
+	switch t {
+	case bytesType, milliCPUType:
+		// Both of these are marshaled as an integer if the value is small enough (or whole,
+		// respectively), and otherwise as a resource.Quantity string.
+		return &Schema{
+			AnyOf: []*Schema{
+				{Type: "number", Minimum: &zero},
+				{Type: "string", Pattern: quantityPattern, patternRegexp: quantityRegexp},
+			},
+		}
+	case cuType:
+		// Marshaled as a (possibly fractional) number of CUs.
+		return &Schema{Type: "number", Minimum: &zero}
+	}
+
+	if t.Implements(marshaler) {
+		panic(fmt.Sprintf("cannot generate schema for type %v with custom JSON marshaling", t))
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: &zero}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Pointer:
+		return g.nullable(g.schemaFor(t.Elem()))
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return g.nullable(&Schema{Type: "string", Format: "byte"})
+		}
+		return g.nullable(&Schema{Type: "array", Items: g.schemaFor(t.Elem())})
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			panic(fmt.Sprintf("cannot generate schema for map type %v with non-string keys", t))
+		}
+		return g.nullable(&Schema{Type: "object", AdditionalProperties: g.schemaFor(t.Elem())})
+	case reflect.Struct:
+		name := defName(t)
+		if _, ok := g.defs[name]; !ok {
+			// reserve the name first, in case of recursive types
+			g.defs[name] = nil
+			g.defs[name] = g.structSchema(t)
+		}
+		return &Schema{Ref: g.refPrefix + name}
+	default:
+		panic(fmt.Sprintf("cannot generate schema for type %v of kind %v", t, t.Kind()))
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{
+		Title:                defName(t),
+		Type:                 "object",
+		Properties:           make(map[string]*Schema),
+		AdditionalProperties: false,
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name := field.Name
+		omitempty := false
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			tagName, opts, _ := strings.Cut(tag, ",")
+			if tagName == "-" && opts == "" {
+				continue
+			} else if tagName != "" {
+				name = tagName
+			}
+			omitempty = slices.Contains(strings.Split(opts, ","), "omitempty")
+		}
+
+		fieldType := field.Type
+		// Fields that are omitted when empty are never null, because nil values are omitted.
+		if omitempty && fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		prop := g.schemaFor(fieldType)
+		if omitempty && prop.isNullable() {
+			prop = prop.AnyOf[0]
+		}
+
+		schema.Properties[name] = prop
+		if !omitempty {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
+
+func (g *schemaGenerator) nullable(s *Schema) *Schema {
+	return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+}
+
+func (s *Schema) isNullable() bool {
+	return len(s.AnyOf) == 2 && s.AnyOf[1].Type == "null"
+}
+
+// defName returns the name to use for the def of the struct type t
+//
+// For generic types, the type parameters are included with only their unqualified name, so e.g.
+// VersionRange[github.com/.../api.MonitorProtoVersion] becomes VersionRangeMonitorProtoVersion.
+func defName(t reflect.Type) string {
+	name := t.Name()
+	if name == "" {
+		panic(fmt.Sprintf("cannot generate schema for anonymous struct type %v", t))
+	}
+
+	base, params, generic := strings.Cut(name, "[")
+	if !generic {
+		return name
+	}
+	for _, param := range strings.Split(strings.TrimSuffix(params, "]"), ",") {
+		base += param[strings.LastIndexByte(param, '.')+1:]
+	}
+	return base
+}
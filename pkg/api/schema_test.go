@@ -0,0 +1,160 @@
+package api_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	zero := float64(0)
+	schema := &api.Schema{
+		Type: "object",
+		Properties: map[string]*api.Schema{
+			"name":  {Type: "string", Pattern: "^[a-z]+$"},
+			"count": {Type: "integer", Minimum: &zero},
+			"ratio": {Type: "number"},
+			"tags":  {Type: "array", Items: &api.Schema{Type: "string"}},
+			"child": {Ref: "#/$defs/Child"},
+			"extra": {Type: "object", AdditionalProperties: &api.Schema{Type: "boolean"}},
+			"maybe": {AnyOf: []*api.Schema{{Type: "string"}, {Type: "null"}}},
+		},
+		Required:             []string{"name"},
+		AdditionalProperties: false,
+		Defs: map[string]*api.Schema{
+			"Child": {
+				Type:                 "object",
+				Properties:           map[string]*api.Schema{"kind": {Type: "string", Const: "child"}},
+				Required:             []string{"kind"},
+				AdditionalProperties: false,
+			},
+		},
+	}
+
+	cases := []struct {
+		name  string
+		data  string
+		error string // empty if valid
+	}{
+		{"Minimal", `{"name": "foo"}`, ""},
+		{
+			"AllFields",
+			`{"name": "foo", "count": 3, "ratio": 0.5, "tags": ["a"], "child": {"kind": "child"}, "extra": {"x": true}, "maybe": null}`,
+			"",
+		},
+		{"LargeUnsignedInteger", `{"name": "foo", "count": 18446744073709551615}`, ""},
+		{"InvalidJSON", `{"name": `, "invalid JSON"},
+		{"TrailingData", `{"name": "foo"} {}`, "invalid JSON: unexpected data after top-level value"},
+		{"NotObject", `[]`, "$: expected object"},
+		{"MissingRequired", `{}`, `$: missing required field "name"`},
+		{"UnknownField", `{"name": "foo", "other": 1}`, `$: unknown field "other"`},
+		{"WrongType", `{"name": 1}`, "$.name: expected string"},
+		{"PatternMismatch", `{"name": "Foo"}`, `$.name: "Foo" does not match pattern "^[a-z]+$"`},
+		{"NotInteger", `{"name": "foo", "count": 1.5}`, "$.count: expected integer, got 1.5"},
+		{"BelowMinimum", `{"name": "foo", "count": -1}`, "$.count: -1 is less than minimum 0"},
+		{"BadArrayItem", `{"name": "foo", "tags": ["a", 2]}`, "$.tags[1]: expected string"},
+		{"BadConst", `{"name": "foo", "child": {"kind": "parent"}}`, `$.child.kind: expected "child", got parent`},
+		{"BadAdditionalProperty", `{"name": "foo", "extra": {"x": 1}}`, "$.extra.x: expected boolean"},
+		{"NoAnyOfMatch", `{"name": "foo", "maybe": 1}`, "$.maybe: value does not match any of the 2 allowed schemas"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := schema.Validate([]byte(c.data))
+			if c.error == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, c.error)
+			}
+		})
+	}
+}
+
+func TestSchemaValidateUnresolvableRef(t *testing.T) {
+	schema := &api.Schema{Ref: "#/$defs/Missing"}
+	assert.ErrorContains(t, schema.Validate([]byte(`{}`)), `unresolvable reference "#/$defs/Missing"`)
+}
+
+func TestAgentRequestSchema(t *testing.T) {
+	lastPermit := api.Resources{VCPU: 250, Mem: 1 << 30}
+	req := api.AgentRequest{
+		ProtoVersion: api.PluginProtoV1_0,
+		Pod:          util.NamespacedName{Namespace: "default", Name: "pod"},
+		ComputeUnit:  api.Resources{VCPU: 250, Mem: 1 << 30},
+		Resources:    api.Resources{VCPU: 500, Mem: 2 << 30},
+		LastPermit:   &lastPermit,
+		Metrics:      nil,
+		Departing:    false,
+		RequestID:    "",
+	}
+	data, err := json.Marshal(req)
+	require.NoError(t, err)
+	assert.NoError(t, api.AgentRequestSchema().Validate(data))
+
+	// Fractional CPU is encoded as a quantity string, which must also be accepted
+	req.Resources.VCPU = 1500
+	data, err = json.Marshal(req)
+	require.NoError(t, err)
+	assert.NoError(t, api.AgentRequestSchema().Validate(data))
+
+	var obj map[string]any
+	require.NoError(t, json.Unmarshal(data, &obj))
+
+	// Fields without omitempty are required
+	delete(obj, "computeUnit")
+	data, err = json.Marshal(obj)
+	require.NoError(t, err)
+	assert.ErrorContains(t, api.AgentRequestSchema().Validate(data), `missing required field "computeUnit"`)
+
+	obj["computeUnit"] = map[string]any{"vCPUs": "1.5x", "mem": 1}
+	data, err = json.Marshal(obj)
+	require.NoError(t, err)
+	assert.ErrorContains(t, api.AgentRequestSchema().Validate(data), "$.computeUnit.vCPUs")
+}
+
+func TestMonitorMessageSchemas(t *testing.T) {
+	t.Run("AgentToMonitor", func(t *testing.T) {
+		data, err := api.SerializeMonitorMessage(api.DownscaleRequest{
+			Target:    api.Allocation{Cpu: 0.5, Mem: 1 << 30},
+			RequestID: "",
+		}, 3)
+		require.NoError(t, err)
+		assert.NoError(t, api.AgentToMonitorMessageSchema().Validate(data))
+
+		// For tagged unions, the error should come from the matching option
+		err = api.AgentToMonitorMessageSchema().Validate([]byte(`{"type": "DownscaleRequest", "id": 1, "content": {}}`))
+		assert.ErrorContains(t, err, `$.content: missing required field "target"`)
+
+		err = api.AgentToMonitorMessageSchema().Validate([]byte(`{"type": "Unknown", "id": 1, "content": {}}`))
+		assert.ErrorContains(t, err, "value does not match any of the 5 allowed schemas")
+	})
+
+	t.Run("MonitorToAgent", func(t *testing.T) {
+		schema := api.MonitorToAgentMessageSchema()
+		assert.NoError(t, schema.Validate([]byte(`{"type": "DownscaleResult", "id": 2, "ok": true, "status": "done"}`)))
+		assert.NoError(t, schema.Validate([]byte(`{"type": "UpscaleRequest", "id": 2}`)))
+		assert.ErrorContains(t, schema.Validate([]byte(`{"type": "DownscaleResult", "id": 2, "ok": true}`)), `missing required field "status"`)
+		assert.ErrorContains(t, schema.Validate([]byte(`{"type": "HealthCheck", "id": -1}`)), "$.id: -1 is less than minimum 0")
+	})
+}
+
+// The published schemas must be kept in sync with the Go types; regenerate them with
+// 'make generate-api-schemas' if this fails.
+func TestPublishedSchemasUpToDate(t *testing.T) {
+	for name, value := range api.PublishedSchemas() {
+		t.Run(name, func(t *testing.T) {
+			published, err := os.ReadFile(filepath.Join("schemas", name))
+			require.NoError(t, err)
+			generated, err := json.MarshalIndent(value, "", "  ")
+			require.NoError(t, err)
+			assert.Equal(t, string(generated)+"\n", string(published))
+		})
+	}
+}
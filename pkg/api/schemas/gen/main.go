@@ -0,0 +1,37 @@
+package main
+
+// Generates the published JSON schemas and OpenAPI document for the agent<->scheduler plugin and
+// agent<->monitor protocols.
+//
+// Usage: go run ./pkg/api/schemas/gen <output directory>
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s <output directory>\n", os.Args[0])
+		os.Exit(1)
+	}
+	dir := os.Args[1]
+
+	for name, value := range api.PublishedSchemas() {
+		content, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to encode %s: %s\n", name, err)
+			os.Exit(1)
+		}
+		content = append(content, '\n')
+
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to write %s: %s\n", name, err)
+			os.Exit(1)
+		}
+	}
+}
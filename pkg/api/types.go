@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
 
 	"go.uber.org/zap/zapcore"
@@ -84,9 +85,16 @@ const (
 	// Changes from v4.0:
 	//
 	// * Removed AgentRequest.metrics fields loadAvg5M and memoryUsageBytes
+	PluginProtoV5_0
+
+	// PluginProtoV5_1 represents v5.1 of the agent<->scheduler plugin protocol.
+	//
+	// Changes from v5.0:
+	//
+	// * Adds PluginResponse.Reason, set when the permit is less than what was requested
 	//
 	// Currently the latest version.
-	PluginProtoV5_0
+	PluginProtoV5_1
 
 	// latestPluginProtoVersion represents the latest version of the agent<->scheduler plugin
 	// protocol
@@ -117,6 +125,8 @@ func (v PluginProtoVersion) String() string {
 		return "v4.0"
 	case PluginProtoV5_0:
 		return "v5.0"
+	case PluginProtoV5_1:
+		return "v5.1"
 	default:
 		diff := v - latestPluginProtoVersion
 		return fmt.Sprintf("<unknown = %v + %d>", latestPluginProtoVersion, diff)
@@ -128,6 +138,11 @@ func (v PluginProtoVersion) IsValid() bool {
 	return uint(v) != 0
 }
 
+// IsKnown returns whether the protocol version is valid and defined in this version of the code.
+func (v PluginProtoVersion) IsKnown() bool {
+	return v.IsValid() && v <= latestPluginProtoVersion
+}
+
 // AllowsNilMetrics returns whether this version of the protocol allows the autoscaler-agent to send
 // a nil metrics field.
 //
@@ -164,6 +179,14 @@ func (v PluginProtoVersion) RepresentsMemoryAsBytes() bool {
 	return v >= PluginProtoV4_0
 }
 
+// SupportsDenialReasons returns whether this version of the protocol allows the scheduler plugin to
+// set PluginResponse.Reason.
+//
+// This is true for version v5.1 and greater.
+func (v PluginProtoVersion) SupportsDenialReasons() bool {
+	return v >= PluginProtoV5_1
+}
+
 // IncludesExtendedMetrics returns whether this version of the protocol includes the AgentRequest's
 // metrics loadAvg5M and memoryUsageBytes.
 //
@@ -207,6 +230,21 @@ type AgentRequest struct {
 	//
 	// In some protocol versions, this field may be nil.
 	Metrics *Metrics `json:"metrics"`
+	// Departing, if true, indicates that the autoscaler-agent is shutting down and will not make
+	// any further requests for this Pod until it restarts.
+	//
+	// Departing requests MUST set Resources equal to LastPermit, so that any pending increase is
+	// withdrawn and the scheduler plugin does not keep resources set aside for it. The scheduler
+	// plugin then stops considering the Pod handled by this autoscaler-agent.
+	Departing bool `json:"departing,omitempty"`
+	// RequestID, if not empty, is an idempotency key for the request, so that retries of a request
+	// can be recognized by the scheduler plugin and logs can be correlated between components.
+	//
+	// The autoscaler-agent uses the same RequestID when retrying a failed request with the same
+	// contents; otherwise each request has a new RequestID. When the scheduler plugin receives a
+	// request with the same RequestID as the last successful one for the Pod, it returns the same
+	// response without handling the request again.
+	RequestID string `json:"requestID,omitempty"`
 }
 
 // Metrics gives the information pulled from vector.dev that the scheduler may use to prioritize
@@ -381,21 +419,41 @@ func (r Resources) Mul(factor uint16) Resources {
 	}
 }
 
-// DivResources divides the resources by the smaller amount, returning the uint16 value such that
-// other.Mul(factor) is equal to the original resources.
+// MulCU returns the resources for n compute units of size r, rounding each field up.
+func (r Resources) MulCU(n ComputeUnits) Resources {
+	return Resources{
+		VCPU: vmv1.MilliCPU(util.DivCeil(uint64(r.VCPU)*uint64(n), 1000)),
+		Mem:  Bytes(util.DivCeil(uint64(r.Mem)*uint64(n), 1000)),
+	}
+}
+
+// DivComputeUnits returns the ComputeUnits n such that cu.MulCU(n) is equal to r.
 //
-// If r is not an integer multiple of other, then (0, false) will be returned.
-func (r Resources) DivResources(other Resources) (uint16, bool) {
-	cpuFactor := uint16(r.VCPU / other.VCPU)
-	cpuOk := r.VCPU%other.VCPU == 0
-	memFactor := uint16(r.Mem / other.Mem)
-	memOk := r.Mem%other.Mem == 0
-
-	if !cpuOk || !memOk || cpuFactor != memFactor {
+// If there is no such value (with milli-CU precision), then (0, false) will be returned.
+func (r Resources) DivComputeUnits(cu Resources) (ComputeUnits, bool) {
+	cpuUnits := ComputeUnits(uint64(r.VCPU) * 1000 / uint64(cu.VCPU))
+	memUnits := ComputeUnits(uint64(r.Mem) * 1000 / uint64(cu.Mem))
+
+	if cpuUnits != memUnits || cu.MulCU(cpuUnits) != r {
 		return 0, false
 	}
+	return cpuUnits, true
+}
 
-	return cpuFactor, true // already known equal to memFactor
+// ComputeUnitsWithin returns the largest number of compute units that fit within r, i.e. the largest
+// N such that cu.MulCU(N) has no field greater than r.
+func (r Resources) ComputeUnitsWithin(cu Resources) ComputeUnits {
+	cpuUnits := uint64(r.VCPU) * 1000 / uint64(cu.VCPU)
+	memUnits := uint64(r.Mem) * 1000 / uint64(cu.Mem)
+	return ComputeUnits(min(cpuUnits, memUnits, math.MaxUint32))
+}
+
+// ComputeUnitsCovering returns the smallest number of compute units that cover r, i.e. the smallest
+// N such that r has no field greater than cu.MulCU(N).
+func (r Resources) ComputeUnitsCovering(cu Resources) ComputeUnits {
+	cpuUnits := util.DivCeil(uint64(r.VCPU)*1000, uint64(cu.VCPU))
+	memUnits := util.DivCeil(uint64(r.Mem)*1000, uint64(cu.Mem))
+	return ComputeUnits(min(max(cpuUnits, memUnits), math.MaxUint32))
 }
 
 // AbsDiff returns a new Resources with each field F as the absolute value of the difference between
@@ -438,8 +496,51 @@ type PluginResponse struct {
 	// Migrate, if present, notifies the autoscaler-agent that its VM will be migrated away,
 	// alongside whatever other information may be useful.
 	Migrate *MigrateResponse `json:"migrate,omitempty"`
+
+	// Reason, if present, gives the reason that the Permit is less than the requested resources.
+	//
+	// Only set for protocol versions v5.1 and greater. See also DenialReason.
+	Reason *DenialReason `json:"reason,omitempty"`
+}
+
+// DenialReason is a machine-readable code for why the scheduler plugin did not grant all of the
+// resources requested by the autoscaler-agent.
+//
+// For successful responses, it's given by PluginResponse.Reason when the Permit is less than what
+// was requested. For error responses, it's given by the HeaderDenialReason header, if known.
+type DenialReason string
+
+const (
+	// DenialReasonNodeFull means that there wasn't enough room on the node to grant the requested
+	// resources.
+	DenialReasonNodeFull DenialReason = "NodeFull"
+	// DenialReasonQuotaExceeded means that the requested resources would exceed a ResourceQuota.
+	DenialReasonQuotaExceeded DenialReason = "QuotaExceeded"
+	// DenialReasonBoundsViolation means that the requested resources were not acceptable for the
+	// VM's scaling bounds -- see VmInfo.ValidateTarget.
+	DenialReasonBoundsViolation DenialReason = "BoundsViolation"
+	// DenialReasonProtocolMismatch means that the scheduler plugin does not support the protocol
+	// version sent in the AgentRequest.
+	DenialReasonProtocolMismatch DenialReason = "ProtocolMismatch"
+)
+
+// IsKnown returns whether the DenialReason is one of the values defined in this version of the code.
+func (r DenialReason) IsKnown() bool {
+	switch r {
+	case DenialReasonNodeFull, DenialReasonQuotaExceeded, DenialReasonBoundsViolation, DenialReasonProtocolMismatch:
+		return true
+	default:
+		return false
+	}
 }
 
+// HeaderDenialReason is the HTTP header used by the scheduler plugin to give the DenialReason for
+// error responses.
+//
+// Because error responses are not versioned, the header may be set regardless of the protocol
+// version, and autoscaler-agents that don't know about it will just ignore it.
+const HeaderDenialReason = "X-Autoscaling-Denial-Reason"
+
 // MigrateResponse, when provided, is a notification to the autsocaler-agent that it will migrate
 //
 // After receiving a MigrateResponse, the autoscaler-agent MUST NOT change its resource allocation.
@@ -447,6 +548,53 @@ type PluginResponse struct {
 // TODO: fill this with more information as required
 type MigrateResponse struct{}
 
+// AgentHandshake is sent by the autoscaler-agent to the scheduler plugin's /agent-handshake
+// endpoint when it starts, and periodically after that, so that the plugin can keep track of which
+// autoscaler-agents are live, and which pods they're handling.
+//
+// Handshakes must have an "Authorization: Bearer <token>" header with the token for the
+// autoscaler-agent's ServiceAccount, and must be sent from AgentIP.
+//
+// All AgentHandshakes expect a PluginHandshakeResponse.
+type AgentHandshake struct {
+	// ProtoVersion is the version of the agent<->scheduler plugin protocol that the
+	// autoscaler-agent uses for its AgentRequests.
+	ProtoVersion PluginProtoVersion `json:"protoVersion"`
+	// Node is the name of the node that the autoscaler-agent is running on.
+	Node string `json:"node"`
+	// AgentIP is the IP address of the autoscaler-agent's pod, to distinguish it from other
+	// autoscaler-agents on the same node (e.g., during a rolling update).
+	AgentIP string `json:"agentIP"`
+	// Capabilities lists the optional features that the autoscaler-agent has enabled.
+	Capabilities []ProtocolCapability `json:"capabilities"`
+	// Pods lists all the pods on the node that the autoscaler-agent is currently handling.
+	Pods []util.NamespacedName `json:"pods"`
+}
+
+// PluginHandshakeResponse is the scheduler plugin's response to an AgentHandshake
+type PluginHandshakeResponse struct {
+	// ProtoRange is the range of agent<->scheduler plugin protocol versions that the scheduler
+	// plugin supports.
+	ProtoRange VersionRange[PluginProtoVersion] `json:"protoRange"`
+	// Capabilities lists the optional features that the scheduler plugin supports.
+	Capabilities []ProtocolCapability `json:"capabilities"`
+	// TimeoutSeconds is the duration, in seconds, after which the scheduler plugin will consider
+	// the autoscaler-agent to be gone if it hasn't received another AgentHandshake.
+	TimeoutSeconds uint `json:"timeoutSeconds"`
+}
+
+// ProtocolCapability names an optional feature of the agent<->scheduler plugin protocol, as
+// exchanged in AgentHandshake and PluginHandshakeResponse
+type ProtocolCapability string
+
+const (
+	// CapabilityProtobuf means that AgentRequests and PluginResponses may be encoded as protobuf.
+	// See ContentTypeProtobuf.
+	CapabilityProtobuf ProtocolCapability = "protobuf"
+	// CapabilityDenialReasons means that responses may include a DenialReason.
+	CapabilityDenialReasons ProtocolCapability = "denialReasons"
+)
+
 // MoreResources holds the data associated with a MoreResourcesRequest
 type MoreResources struct {
 	// Cpu is true if the vm-monitor is requesting more CPU
@@ -471,6 +619,28 @@ func (m MoreResources) And(cmp MoreResources) MoreResources {
 	}
 }
 
+////////////////////////////////////
+// Controller <-> Plugin Messages //
+////////////////////////////////////
+
+// MigrationCapacityRequest is sent by the NeonVM controller to the scheduler plugin's
+// /migration_capacity endpoint before creating a migration's target pod, to check that some node
+// has room for the VM.
+type MigrationCapacityRequest struct {
+	CPU vmv1.MilliCPU `json:"cpu"`
+	Mem Bytes         `json:"mem"`
+	// ExcludeNode, if not empty, is a node that can't be the target, e.g. the VM's current node.
+	ExcludeNode string `json:"excludeNode,omitempty"`
+	// NodeLabels, if not empty, restricts the target to nodes with all of these labels.
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+}
+
+// MigrationCapacityResponse is the scheduler plugin's response to a MigrationCapacityRequest.
+type MigrationCapacityResponse struct {
+	// Nodes are the names of the nodes that currently have room for the VM, sorted by name.
+	Nodes []string `json:"nodes"`
+}
+
 ////////////////////////////////////
 // Controller <-> Runner Messages //
 ////////////////////////////////////
@@ -487,18 +657,94 @@ type VCPUCgroup struct {
 	VCPUs vmv1.MilliCPU
 }
 
+// NetworkLimitsChange is used to notify runner that the VM's network limits have changed.
+// Runner applies them to the VM's default network tap device.
+type NetworkLimitsChange struct {
+	Limits vmv1.NetworkLimits
+}
+
+// RunnerShutdownStatus is the runner's response to requests on /shutdown_stage.
+type RunnerShutdownStatus struct {
+	// Stage is the current stage of shutting down the guest, or empty if shutdown has not started.
+	Stage vmv1.ShutdownStage `json:"stage,omitempty"`
+}
+
+// GuestExecRequest is a request to the runner to run a command in the guest, via the QEMU guest
+// agent. The command is run directly, not through a shell.
+type GuestExecRequest struct {
+	Command []string `json:"command"`
+	// Stdin is the input to the command, if any.
+	Stdin []byte `json:"stdin,omitempty"`
+	// TimeoutSeconds is how long to wait for the command to exit. Defaults to 60, and must be at most
+	// 600.
+	TimeoutSeconds uint `json:"timeoutSeconds,omitempty"`
+}
+
+// GuestExecResult is the runner's response to a GuestExecRequest, once the command has exited.
+type GuestExecResult struct {
+	ExitCode int    `json:"exitCode"`
+	Stdout   []byte `json:"stdout"`
+	Stderr   []byte `json:"stderr"`
+	// Signal is the signal that terminated the command, or zero if it exited normally.
+	Signal int `json:"signal,omitempty"`
+}
+
+// RunnerDebugPort is the port that the runner serves /port_forward on, which forwards connections
+// to ports in the guest.
+//
+// It's only bound to localhost in the runner pod, so it can only be reached through a port-forward
+// to the pod, which requires access to the pods/portforward subresource.
+const RunnerDebugPort = 25184
+
+// RunnerGuestSocket is the unix socket in the runner container that the runner serves the endpoints
+// running commands in the guest on: /exec and /file.
+//
+// These aren't served on RunnerDebugPort, so that they can't be reached with only pods/portforward.
+// Instead, they're reached by running RunnerGuestRequestCommand in the runner container, which
+// requires access to the pods/exec subresource.
+const RunnerGuestSocket = "/run/neonvm-runner/guest.sock"
+
+// RunnerGuestRequestCommand is the runner subcommand that sends a request to RunnerGuestSocket:
+//
+//	runner guest-request METHOD PATH
+//
+// The request body is read from stdin, and the response body is written to stdout. If the response
+// status is not 200 OK, the command instead writes the error to stderr and exits with code 1.
+const RunnerGuestRequestCommand = "guest-request"
+
 // this a similar version type for controller <-> runner communications
 // see PluginProtoVersion comment for details
 type RunnerProtoVersion uint32
 
 const (
 	RunnerProtoV1 RunnerProtoVersion = iota + 1
+
+	// RunnerProtoV2 adds the /network_limits endpoint to the runner.
+	RunnerProtoV2
+
+	// RunnerProtoV3 adds the /shutdown_stage endpoint to the runner.
+	RunnerProtoV3
+
+	// RunnerProtoV4 adds the /clock_sync endpoint to the runner.
+	RunnerProtoV4
 )
 
 func (v RunnerProtoVersion) SupportsCgroupFractionalCPU() bool {
 	return v >= RunnerProtoV1
 }
 
+func (v RunnerProtoVersion) SupportsNetworkLimits() bool {
+	return v >= RunnerProtoV2
+}
+
+func (v RunnerProtoVersion) SupportsShutdownStage() bool {
+	return v >= RunnerProtoV3
+}
+
+func (v RunnerProtoVersion) SupportsClockSync() bool {
+	return v >= RunnerProtoV4
+}
+
 ////////////////////////////////////
 //   Agent <-> Monitor Messages   //
 ////////////////////////////////////
@@ -528,8 +774,8 @@ type UpscaleConfirmation struct{}
 // This type is sent to the agent to indicate if downscaling was successful. The
 // agent does not need to respond.
 type DownscaleResult struct {
-	Ok     bool
-	Status string
+	Ok     bool   `json:"ok"`
+	Status string `json:"status"`
 }
 
 // ** Types sent by agent **
@@ -539,6 +785,9 @@ type DownscaleResult struct {
 // file cache size, cgroup memory limits) it should reply with an UpscaleConfirmation.
 type UpscaleNotification struct {
 	Granted Allocation `json:"granted"`
+	// RequestID, if not empty, is an idempotency key for the notification. It is the same for
+	// retries of a notification that failed, so that the monitor does not need to apply it twice.
+	RequestID string `json:"requestID,omitempty"`
 }
 
 // This type is sent to the monitor as a request to downscale its resource usage.
@@ -546,6 +795,9 @@ type UpscaleNotification struct {
 // DownscaleResult.
 type DownscaleRequest struct {
 	Target Allocation `json:"target"`
+	// RequestID, if not empty, is an idempotency key for the request. It is the same for retries
+	// of a request that failed, so that the monitor does not need to apply it twice.
+	RequestID string `json:"requestID,omitempty"`
 }
 
 // ** Types shared by agent and monitor **
@@ -642,6 +894,11 @@ func (v MonitorProtoVersion) String() string {
 	}
 }
 
+// IsKnown returns whether the protocol version is valid and defined in this version of the code.
+func (v MonitorProtoVersion) IsKnown() bool {
+	return uint(v) != 0 && v <= latestMonitorProtoVersion
+}
+
 // Sent back by the monitor after figuring out what protocol version we should use
 type MonitorProtocolResponse struct {
 	// If `Error` is nil, contains the value of the settled on protocol version.
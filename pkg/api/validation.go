@@ -0,0 +1,240 @@
+package api
+
+// Shared validation for VM scaling bounds, used by the neonvm-controller's webhook, the
+// autoscaler-agent, and the scheduler plugin.
+//
+// Each of these components has different requirements for what's acceptable -- e.g., the agent
+// should still try to handle a VM that is currently using more than its maximum, but the webhook
+// should reject such a spec -- so validation returns all issues found, tagged by kind, and it's up
+// to the caller to decide which ones are fatal.
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// BoundsIssueKind describes the category of a BoundsIssue
+type BoundsIssueKind string
+
+const (
+	// BoundsUnreasonableSize means that the minimum or maximum was outside the range of supported
+	// values -- see Resources.CheckValuesAreReasonablySized.
+	BoundsUnreasonableSize BoundsIssueKind = "UnreasonableSize"
+	// BoundsMinGreaterThanMax means that the minimum was greater than the maximum.
+	BoundsMinGreaterThanMax BoundsIssueKind = "MinGreaterThanMax"
+	// BoundsOutOfRange means that the current (or target) amount was outside the range from
+	// minimum to maximum.
+	BoundsOutOfRange BoundsIssueKind = "OutOfRange"
+	// BoundsNotSlotAligned means that an amount of memory was not a multiple of the memory slot
+	// size, or that the memory slot size was zero.
+	BoundsNotSlotAligned BoundsIssueKind = "NotSlotAligned"
+	// BoundsNotComputeUnitMultiple means that the minimum or maximum was not a multiple of the
+	// compute unit.
+	BoundsNotComputeUnitMultiple BoundsIssueKind = "NotComputeUnitMultiple"
+)
+
+// BoundsIssue is a single problem found by VmInfo.ValidateBounds or VmInfo.ValidateTarget
+type BoundsIssue struct {
+	Kind BoundsIssueKind
+	// Field is the name of the value that the issue is about, e.g. "min.cpu" or "use.mem".
+	Field   string
+	Message string
+}
+
+func (i BoundsIssue) Error() string {
+	return fmt.Sprintf("%s: %s", i.Field, i.Message)
+}
+
+// BoundsErrors is the list of all issues found by VmInfo.ValidateBounds or VmInfo.ValidateTarget
+//
+// An empty BoundsErrors means there were no issues. Use (BoundsErrors).Err to convert to an error
+// that is nil in that case.
+type BoundsErrors []BoundsIssue
+
+func (es BoundsErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap implements the interface used by errors.Is and errors.As for multi-errors
+func (es BoundsErrors) Unwrap() []error {
+	errs := make([]error, len(es))
+	for i, e := range es {
+		errs[i] = e
+	}
+	return errs
+}
+
+// Err returns es as an error, or nil if there are no issues.
+func (es BoundsErrors) Err() error {
+	if len(es) == 0 {
+		return nil
+	}
+	return es
+}
+
+// Only returns the issues with one of the given kinds
+func (es BoundsErrors) Only(kinds ...BoundsIssueKind) BoundsErrors {
+	var result BoundsErrors
+	for _, e := range es {
+		if slices.Contains(kinds, e.Kind) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Except returns the issues that do not have any of the given kinds
+func (es BoundsErrors) Except(kinds ...BoundsIssueKind) BoundsErrors {
+	var result BoundsErrors
+	for _, e := range es {
+		if !slices.Contains(kinds, e.Kind) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// ValidateBounds checks the VM's scaling bounds, returning all issues found:
+//
+//   - The minimum and maximum must be reasonably sized, with min <= max.
+//   - The current usage must be within the bounds, and a whole number of memory slots.
+//   - If computeUnit is not nil, the minimum and maximum must be multiples of it, and its memory
+//     must be a whole number of memory slots.
+func (vm VmInfo) ValidateBounds(computeUnit *Resources) BoundsErrors {
+	var es BoundsErrors
+
+	minResources := vm.Min()
+	maxResources := vm.Max()
+
+	// we can't do validation for resource.Quantity with kubebuilder, so do it here
+	if err := minResources.CheckValuesAreReasonablySized(); err != nil {
+		es.add(BoundsUnreasonableSize, "min", err.Error())
+	}
+	if err := maxResources.CheckValuesAreReasonablySized(); err != nil {
+		es.add(BoundsUnreasonableSize, "max", err.Error())
+	}
+
+	if minResources.VCPU > maxResources.VCPU {
+		es.add(BoundsMinGreaterThanMax, "cpu", fmt.Sprintf("min %v is greater than max %v", minResources.VCPU, maxResources.VCPU))
+	}
+	if minResources.Mem > maxResources.Mem {
+		es.add(BoundsMinGreaterThanMax, "mem", fmt.Sprintf("min %v is greater than max %v", minResources.Mem, maxResources.Mem))
+	}
+
+	if vm.Mem.SlotSize == 0 {
+		es.add(BoundsNotSlotAligned, "mem.slotSize", "must be non-zero")
+	}
+
+	es = append(es, vm.checkWithinBounds("use", vm.Using())...)
+
+	if computeUnit != nil {
+		es = append(es, vm.checkComputeUnit(*computeUnit)...)
+	}
+
+	return es
+}
+
+// ValidateTarget checks that target is an acceptable amount of resources for the VM to scale to,
+// returning all issues found:
+//
+//   - The target must be within the VM's bounds, and a whole number of memory slots.
+//   - If computeUnit is not nil, the VM's minimum and maximum must be multiples of it, and its
+//     memory must be a whole number of memory slots.
+//
+// Note that ValidateTarget does not check the bounds themselves; see ValidateBounds for that.
+func (vm VmInfo) ValidateTarget(target Resources, computeUnit *Resources) BoundsErrors {
+	es := vm.checkWithinBounds("target", target)
+	if computeUnit != nil {
+		es = append(es, vm.checkComputeUnit(*computeUnit)...)
+	}
+	return es
+}
+
+// checkWithinBounds checks that r is within the VM's bounds and is a whole number of memory slots
+func (vm VmInfo) checkWithinBounds(field string, r Resources) BoundsErrors {
+	var es BoundsErrors
+
+	minResources := vm.Min()
+	maxResources := vm.Max()
+
+	if r.VCPU < minResources.VCPU || r.VCPU > maxResources.VCPU {
+		es.add(BoundsOutOfRange, field+".cpu", fmt.Sprintf(
+			"%v is outside of bounds [%v, %v]", r.VCPU, minResources.VCPU, maxResources.VCPU,
+		))
+	}
+	if r.Mem < minResources.Mem || r.Mem > maxResources.Mem {
+		es.add(BoundsOutOfRange, field+".mem", fmt.Sprintf(
+			"%v is outside of bounds [%v, %v]", r.Mem, minResources.Mem, maxResources.Mem,
+		))
+	}
+
+	if vm.Mem.SlotSize != 0 && r.Mem%vm.Mem.SlotSize != 0 {
+		es.add(BoundsNotSlotAligned, field+".mem", fmt.Sprintf(
+			"%v is not a multiple of memory slot size %v", r.Mem, vm.Mem.SlotSize,
+		))
+	}
+
+	return es
+}
+
+// checkComputeUnit checks that the VM's bounds are multiples of the compute unit, and that the
+// compute unit is a whole number of memory slots.
+func (vm VmInfo) checkComputeUnit(cu Resources) BoundsErrors {
+	var es BoundsErrors
+
+	if err := cu.ValidateNonZero(); err != nil {
+		// Can't check anything else if the compute unit is zero, so return early.
+		es.add(BoundsNotComputeUnitMultiple, "computeUnit", err.Error())
+		return es
+	}
+
+	if vm.Mem.SlotSize != 0 && cu.Mem%vm.Mem.SlotSize != 0 {
+		es.add(BoundsNotSlotAligned, "computeUnit.mem", fmt.Sprintf(
+			"%v is not a multiple of memory slot size %v", cu.Mem, vm.Mem.SlotSize,
+		))
+	}
+
+	for _, b := range []struct {
+		field string
+		r     Resources
+	}{
+		{"min", vm.Min()},
+		{"max", vm.Max()},
+	} {
+		if _, ok := b.r.DivComputeUnits(cu); !ok {
+			es.add(BoundsNotComputeUnitMultiple, b.field, fmt.Sprintf(
+				"%v is not a multiple of compute unit %v", b.r, cu,
+			))
+		}
+	}
+
+	return es
+}
+
+func (es *BoundsErrors) add(kind BoundsIssueKind, field string, msg string) {
+	*es = append(*es, BoundsIssue{Kind: kind, Field: field, Message: msg})
+}
+
+// ValidateVirtualMachineResources runs VmInfo.ValidateBounds for the bounds given by the
+// VirtualMachine resources, without any compute unit.
+//
+// This is used by the neonvm-controller's webhook, which doesn't know about the autoscaling
+// annotations.
+func ValidateVirtualMachineResources(resources vmv1.VirtualMachineResources) BoundsErrors {
+	info := VmInfo{
+		Name:            "",
+		Namespace:       "",
+		Cpu:             NewVmCpuInfo(resources.CPUs),
+		Mem:             NewVmMemInfo(resources.MemorySlots, resources.MemorySlotSize),
+		Config:          VmConfig{AutoMigrationEnabled: false, AlwaysMigrate: false, ScalingEnabled: false, ScalingConfig: nil},
+		CurrentRevision: nil,
+	}
+	return info.ValidateBounds(nil)
+}
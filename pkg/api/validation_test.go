@@ -0,0 +1,180 @@
+package api_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+const gib = api.Bytes(1 << 30)
+
+func testVmInfo(cpu api.VmCpuInfo, mem api.VmMemInfo) api.VmInfo {
+	return api.VmInfo{
+		Name:            "vm",
+		Namespace:       "default",
+		Cpu:             cpu,
+		Mem:             mem,
+		Config:          api.VmConfig{AutoMigrationEnabled: false, AlwaysMigrate: false, ScalingEnabled: true, ScalingConfig: nil},
+		CurrentRevision: nil,
+	}
+}
+
+// issueKinds returns the kinds and field names of the issues, for comparison in tests
+func issueKinds(es api.BoundsErrors) []string {
+	return lo.Map(es, func(e api.BoundsIssue, _ int) string {
+		return string(e.Kind) + " " + e.Field
+	})
+}
+
+func TestValidateBounds(t *testing.T) {
+	cu := &api.Resources{VCPU: 250, Mem: gib}
+
+	cases := []struct {
+		name        string
+		cpu         api.VmCpuInfo
+		mem         api.VmMemInfo
+		computeUnit *api.Resources
+		expected    []string
+	}{
+		{
+			name:        "Valid",
+			cpu:         api.VmCpuInfo{Min: 250, Max: 4000, Use: 1000},
+			mem:         api.VmMemInfo{Min: 1, Max: 16, Use: 4, SlotSize: gib},
+			computeUnit: cu,
+			expected:    []string{},
+		},
+		{
+			name:        "UnreasonableSize",
+			cpu:         api.VmCpuInfo{Min: 10, Max: 1000 * 1000, Use: 1000},
+			mem:         api.VmMemInfo{Min: 1, Max: 16, Use: 4, SlotSize: gib},
+			computeUnit: nil,
+			expected:    []string{"UnreasonableSize min", "UnreasonableSize max"},
+		},
+		{
+			name:        "MinGreaterThanMax",
+			cpu:         api.VmCpuInfo{Min: 4000, Max: 1000, Use: 2000},
+			mem:         api.VmMemInfo{Min: 8, Max: 4, Use: 4, SlotSize: gib},
+			computeUnit: nil,
+			expected: []string{
+				"MinGreaterThanMax cpu",
+				"MinGreaterThanMax mem",
+				"OutOfRange use.cpu",
+				"OutOfRange use.mem",
+			},
+		},
+		{
+			name:        "UseOutOfRange",
+			cpu:         api.VmCpuInfo{Min: 1000, Max: 4000, Use: 5000},
+			mem:         api.VmMemInfo{Min: 2, Max: 16, Use: 1, SlotSize: gib},
+			computeUnit: nil,
+			expected:    []string{"OutOfRange use.cpu", "OutOfRange use.mem"},
+		},
+		{
+			name:        "ZeroSlotSize",
+			cpu:         api.VmCpuInfo{Min: 1000, Max: 1000, Use: 1000},
+			mem:         api.VmMemInfo{Min: 0, Max: 0, Use: 0, SlotSize: 0},
+			computeUnit: nil,
+			expected:    []string{"NotSlotAligned mem.slotSize"},
+		},
+		{
+			name:        "NotComputeUnitMultiple",
+			cpu:         api.VmCpuInfo{Min: 300, Max: 4000, Use: 1000},
+			mem:         api.VmMemInfo{Min: 1, Max: 16, Use: 4, SlotSize: gib},
+			computeUnit: cu,
+			expected:    []string{"NotComputeUnitMultiple min"},
+		},
+		{
+			name:        "ComputeUnitNotSlotAligned",
+			cpu:         api.VmCpuInfo{Min: 250, Max: 4000, Use: 1000},
+			mem:         api.VmMemInfo{Min: 1, Max: 16, Use: 4, SlotSize: 2 * gib},
+			computeUnit: cu,
+			expected: []string{
+				"NotSlotAligned computeUnit.mem",
+				"NotComputeUnitMultiple min",
+				"NotComputeUnitMultiple max",
+			},
+		},
+		{
+			name:        "ZeroComputeUnit",
+			cpu:         api.VmCpuInfo{Min: 250, Max: 4000, Use: 1000},
+			mem:         api.VmMemInfo{Min: 1, Max: 16, Use: 4, SlotSize: gib},
+			computeUnit: &api.Resources{VCPU: 0, Mem: gib},
+			expected:    []string{"NotComputeUnitMultiple computeUnit"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			issues := testVmInfo(c.cpu, c.mem).ValidateBounds(c.computeUnit)
+			assert.Equal(t, c.expected, issueKinds(issues))
+		})
+	}
+}
+
+func TestValidateTarget(t *testing.T) {
+	vm := testVmInfo(
+		api.VmCpuInfo{Min: 1000, Max: 4000, Use: 1000},
+		api.VmMemInfo{Min: 4, Max: 16, Use: 4, SlotSize: gib},
+	)
+
+	cases := []struct {
+		name     string
+		target   api.Resources
+		expected []string
+	}{
+		{"Valid", api.Resources{VCPU: 2000, Mem: 8 * gib}, []string{}},
+		{"BelowMin", api.Resources{VCPU: 500, Mem: 2 * gib}, []string{"OutOfRange target.cpu", "OutOfRange target.mem"}},
+		{"AboveMax", api.Resources{VCPU: 5000, Mem: 8 * gib}, []string{"OutOfRange target.cpu"}},
+		{"NotSlotAligned", api.Resources{VCPU: 2000, Mem: 8*gib + 1}, []string{"NotSlotAligned target.mem"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, issueKinds(vm.ValidateTarget(c.target, nil)))
+		})
+	}
+}
+
+func TestBoundsErrors(t *testing.T) {
+	outOfRange := api.BoundsIssue{Kind: api.BoundsOutOfRange, Field: "use.cpu", Message: "out of range"}
+	notAligned := api.BoundsIssue{Kind: api.BoundsNotSlotAligned, Field: "use.mem", Message: "not aligned"}
+	minMax := api.BoundsIssue{Kind: api.BoundsMinGreaterThanMax, Field: "cpu", Message: "min > max"}
+	all := api.BoundsErrors{outOfRange, notAligned, minMax}
+
+	cases := []struct {
+		name     string
+		issues   api.BoundsErrors
+		expected api.BoundsErrors
+	}{
+		{"OnlyOne", all.Only(api.BoundsOutOfRange), api.BoundsErrors{outOfRange}},
+		{"OnlyMultiple", all.Only(api.BoundsOutOfRange, api.BoundsMinGreaterThanMax), api.BoundsErrors{outOfRange, minMax}},
+		{"OnlyNone", all.Only(api.BoundsUnreasonableSize), nil},
+		{"ExceptOne", all.Except(api.BoundsOutOfRange), api.BoundsErrors{notAligned, minMax}},
+		{"ExceptMultiple", all.Except(api.BoundsOutOfRange, api.BoundsNotSlotAligned), api.BoundsErrors{minMax}},
+		{"ExceptAll", all.Except(api.BoundsOutOfRange, api.BoundsNotSlotAligned, api.BoundsMinGreaterThanMax), nil},
+		{"ExceptEmpty", api.BoundsErrors(nil).Except(api.BoundsOutOfRange), nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, c.issues)
+		})
+	}
+
+	t.Run("Err", func(t *testing.T) {
+		assert.NoError(t, api.BoundsErrors(nil).Err())
+		assert.NoError(t, all.Only(api.BoundsUnreasonableSize).Err())
+
+		err := all.Err()
+		assert.EqualError(t, err, "use.cpu: out of range; use.mem: not aligned; cpu: min > max")
+
+		var issue api.BoundsIssue
+		assert.True(t, errors.As(err, &issue))
+		assert.Equal(t, outOfRange, issue)
+		assert.ErrorIs(t, err, notAligned)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/samber/lo"
 	"github.com/tychoish/fun/erc"
@@ -28,9 +29,28 @@ const (
 	AnnotationAutoscalingUnit     = "autoscaling.neon.tech/scaling-unit"
 	AnnotationBillingEndpointID   = "autoscaling.neon.tech/billing-endpoint-id"
 
+	// Set on VMs to use the named vmv1.ScalingPolicy, in the VM's namespace, as the base for the
+	// VM's scaling config:
+	AnnotationScalingPolicy = "autoscaling.neon.tech/scaling-policy"
+
+	// Set by the scheduler plugin (if enabled) on Pods that couldn't be given the resources they
+	// need, with the shape of those resources, for use by node autoscalers:
+	AnnotationScaleUpHint = "autoscaling.neon.tech/scale-up-hint"
+
+	// Set on Nodes to override the scheduler plugin's maximum number of VMs per node:
+	AnnotationNodeMaxVMs = "autoscaling.neon.tech/max-vms"
+
+	// Extended resource advertised on Nodes by the scheduler plugin (if enabled), and requested by
+	// VM runner pods from neonvm-controller (if enabled), measured in compute units:
+	ResourceComputeUnit = "neon.tech/compute-unit"
+
 	// For internal use only, between the autoscaler-agent and scheduler plugin:
 	InternalAnnotationResourcesRequested = "internal.autoscaling.neon.tech/resources-requested"
 	InternalAnnotationResourcesApproved  = "internal.autoscaling.neon.tech/resources-approved"
+
+	// For internal use only, between the autoscaler-agent and neonvm-controller. Set on VMs with
+	// the DenialReason from the scheduler plugin's latest response, if there was one:
+	InternalAnnotationSchedulerDenial = "internal.autoscaling.neon.tech/scheduler-denial"
 )
 
 func hasTrueLabel(obj metav1.ObjectMetaAccessor, labelName string) bool {
@@ -187,6 +207,12 @@ func ExtractVmInfo(logger *zap.Logger, vm *vmv1.VirtualMachine) (*VmInfo, error)
 		return nil, fmt.Errorf("error extracting VM info: %w", err)
 	}
 
+	// While the VM is recovering from an OOM kill, the controller may have temporarily raised its
+	// minimum memory. That takes precedence over the bounds from the spec or annotation.
+	if bump := vm.Status.MemoryBump; bump != nil {
+		info.Mem.Min = min(info.Mem.Max, max(info.Mem.Min, uint16(bump.MinSlots)))
+	}
+
 	info.CurrentRevision = vm.Status.CurrentRevision
 	return info, nil
 }
@@ -203,6 +229,99 @@ func ExtractVmInfoFromPod(logger *zap.Logger, pod *corev1.Pod) (*VmInfo, error)
 	return extractVmInfoGeneric(logger, vmName, pod, *resources)
 }
 
+// IsStandaloneScalingPod returns whether the pod is a standalone (i.e. non-VM) pod that has opted in
+// to autoscaling, with the LabelEnableAutoscaling label and the AnnotationAutoscalingBounds
+// annotation.
+//
+// Such pods have their resources accounted for by the scheduler plugin in the same way as VMs, with
+// the scaling annotations on the pod itself, rather than on a VirtualMachine object.
+func IsStandaloneScalingPod(pod *corev1.Pod) bool {
+	if _, ownedByVM := vmv1.VirtualMachineOwnerForPod(pod); ownedByVM {
+		return false
+	}
+	_, hasBounds := pod.Annotations[AnnotationAutoscalingBounds]
+	return HasAutoscalingEnabled(pod) && hasBounds
+}
+
+// PodRequestedResources returns the sum of the resource requests of the pod's containers.
+func PodRequestedResources(pod *corev1.Pod) Resources {
+	var r Resources
+	for _, container := range pod.Spec.Containers {
+		// NB: .Cpu()/.Memory() return a pointer to a value equal to zero if the resource is not
+		// present. So we can just add it either way.
+		r.VCPU += vmv1.MilliCPUFromResourceQuantity(*container.Resources.Requests.Cpu())
+		r.Mem += BytesFromResourceQuantity(*container.Resources.Requests.Memory())
+	}
+	return r
+}
+
+// PodOverhead returns the pod's fixed resource overhead, from its .spec.overhead
+//
+// The overhead is typically set by the RuntimeClass admission controller, from the pod's
+// RuntimeClass. Like the kube-scheduler, we reserve it in addition to the pod's requests.
+func PodOverhead(pod *corev1.Pod) Resources {
+	return Resources{
+		VCPU: vmv1.MilliCPUFromResourceQuantity(*pod.Spec.Overhead.Cpu()),
+		Mem:  BytesFromResourceQuantity(*pod.Spec.Overhead.Memory()),
+	}
+}
+
+// ExtractPodScalingInfo is the equivalent of ExtractVmInfoFromPod for standalone pods (see
+// IsStandaloneScalingPod).
+//
+// Standalone pods don't have memory slots, so the memory of the AnnotationAutoscalingUnit
+// annotation, which is required, is used as the slot size. The current resources are taken from the
+// pod's container requests.
+func ExtractPodScalingInfo(logger *zap.Logger, pod *corev1.Pod) (*VmInfo, error) {
+	logger = logger.With(util.PodNameFields(pod))
+
+	if !IsStandaloneScalingPod(pod) {
+		return nil, errors.New("pod is not a standalone pod with autoscaling enabled")
+	}
+
+	unit, err := ExtractScalingUnit(pod)
+	if err != nil {
+		return nil, err
+	} else if unit == nil {
+		return nil, fmt.Errorf("missing annotation %q", AnnotationAutoscalingUnit)
+	} else if err := unit.ValidateNonZero(); err != nil {
+		return nil, fmt.Errorf("Bad scaling unit in annotation %q: %w", AnnotationAutoscalingUnit, err)
+	}
+
+	using := PodRequestedResources(pod)
+	if using.Mem%unit.Mem != 0 {
+		logger.Warn(
+			"Pod memory request is not a multiple of the scaling unit, rounding down",
+			zap.Object("using", using), zap.Object("unit", unit),
+		)
+	}
+	memSlots := int32(using.Mem / unit.Mem)
+
+	// The bounds annotation is required, so these min/max values are always replaced.
+	resources := vmv1.VirtualMachineResources{
+		CPUs: vmv1.CPUs{
+			Min: using.VCPU,
+			Max: using.VCPU,
+			Use: using.VCPU,
+		},
+		MemorySlots: vmv1.MemorySlots{
+			Min: memSlots,
+			Max: memSlots,
+			Use: memSlots,
+		},
+		MemorySlotSize: *unit.Mem.ToResourceQuantity(),
+	}
+
+	info, err := extractVmInfoGeneric(logger, pod.Name, pod, resources)
+	if err != nil {
+		return nil, fmt.Errorf("error extracting pod scaling info: %w", err)
+	}
+	// Standalone pods can't be live-migrated.
+	info.Config.AutoMigrationEnabled = false
+	info.Config.AlwaysMigrate = false
+	return info, nil
+}
+
 func extractVmInfoGeneric(
 	logger *zap.Logger,
 	vmName string,
@@ -254,36 +373,14 @@ func extractVmInfoGeneric(
 		info.Config.ScalingConfig = &config
 	}
 
-	minResources := info.Min()
-	using := info.Using()
-	maxResources := info.Max()
-
-	// we can't do validation for resource.Quantity with kubebuilder
-	// so do it here
-	if err := minResources.CheckValuesAreReasonablySized(); err != nil {
-		return nil, fmt.Errorf("min resources are invalid: %w", err)
-	}
-
-	if err := maxResources.CheckValuesAreReasonablySized(); err != nil {
-		return nil, fmt.Errorf("max resources are invalid: %w", err)
+	issues := info.ValidateBounds(nil)
+	if err := issues.Except(BoundsOutOfRange).Err(); err != nil {
+		return nil, fmt.Errorf("invalid scaling bounds: %w", err)
 	}
-
-	// check: min <= max
-	if minResources.HasFieldGreaterThan(maxResources) {
-		return nil, fmt.Errorf("min resources %+v has field greater than maximum %+v", minResources, maxResources)
-	}
-
-	// check: min <= using <= max
-	if using.HasFieldLessThan(minResources) {
-		logger.Warn(
-			"Current usage has field less than minimum",
-			zap.Object("using", using), zap.Object("min", minResources),
-		)
-	} else if using.HasFieldGreaterThan(maxResources) {
-		logger.Warn(
-			"Current usage has field greater than maximum",
-			zap.Object("using", using), zap.Object("max", maxResources),
-		)
+	// We should still handle VMs that are currently outside their bounds -- e.g. because the
+	// bounds were just changed -- so that we can scale them back within the bounds.
+	for _, issue := range issues.Only(BoundsOutOfRange) {
+		logger.Warn("Current usage is outside of scaling bounds", zap.Error(issue))
 	}
 
 	return &info, nil
@@ -406,6 +503,68 @@ type ScalingConfig struct {
 	// of the rate of increase in LFC working set size.
 	LFCWindowSizeMinutes *int `json:"lfcWindowSizeMinutes,omitempty"`
 
+	// EnableConnectionMetrics, if true, enables fetching additional metrics about the number of
+	// Postgres connections and active backends to provide as input to the scaling algorithm.
+	//
+	// When specifying the autoscaler-agent config, this field is required. False is a safe default.
+	// For an individual VM, if this field is left out the settings will fall back on the global
+	// default.
+	EnableConnectionMetrics *bool `json:"enableConnectionMetrics,omitempty"`
+
+	// MemoryPerConnection is the amount of memory to budget for each Postgres connection, when
+	// connection metrics are enabled. We will try to upscale if the total budget for all current
+	// connections would not fit into the VM's memory.
+	//
+	// Active backends are additionally treated like load average, using LoadAverageFractionTarget.
+	MemoryPerConnection *Bytes `json:"memoryPerConnection,omitempty"`
+
+	// GoalCombination sets how the goal CU from each signal (CPU, memory, LFC, connections) is
+	// combined into the overall goal CU.
+	//
+	// When specifying the autoscaler-agent config, this field is required. "max" is a safe default.
+	// For an individual VM, if this field is left out the settings will fall back on the global
+	// default.
+	GoalCombination *GoalCombination `json:"goalCombination,omitempty"`
+
+	// GoalWeights gives the weight for the goal CU of each signal, used according to
+	// GoalCombination. A weight of zero excludes that signal from the overall goal CU.
+	//
+	// When specifying the autoscaler-agent config, this field is required. All weights set to 1 is
+	// a safe default. For an individual VM, if this field is left out the settings will fall back
+	// on the global default.
+	GoalWeights *GoalWeights `json:"goalWeights,omitempty"`
+
+	// MaxUpscaleStepCU, if set, limits the number of compute units that may be added in a single
+	// scaling decision. Fractional values are allowed. If unset, there is no limit.
+	MaxUpscaleStepCU *ComputeUnits `json:"maxUpscaleStepCU,omitempty"`
+
+	// MaxDownscaleStepCU, if set, limits the number of compute units that may be removed in a
+	// single scaling decision. Fractional values are allowed. If unset, there is no limit.
+	MaxDownscaleStepCU *ComputeUnits `json:"maxDownscaleStepCU,omitempty"`
+
+	// DownscaleStabilizationSeconds, if set, is the duration over which we use the highest goal CU
+	// we've seen, so that we only downscale once the goal has stayed lower for the whole window.
+	// If unset or zero, we downscale as soon as the goal decreases.
+	DownscaleStabilizationSeconds *uint32 `json:"downscaleStabilizationSeconds,omitempty"`
+
+	// Schedules gives recurring time windows during which the goal CU is kept at or above the
+	// schedule's minimum. If set, this replaces any schedules from the defaults.
+	Schedules []vmv1.ScalingPolicySchedule `json:"schedules,omitempty"`
+
+	// DryRun, if true, means that the autoscaler-agent calculates, logs, and reports the desired
+	// scaling for the VM, but never actually changes its resources. If unset, this is false.
+	DryRun *bool `json:"dryRun,omitempty"`
+
+	// MonitorDownscaleTimeoutSeconds, if set, gives the timeout in seconds for downscale requests
+	// to the vm-monitor. If unset, this falls back on the autoscaler-agent's
+	// .monitor.downscaleTimeoutSeconds.
+	MonitorDownscaleTimeoutSeconds *uint32 `json:"monitorDownscaleTimeoutSeconds,omitempty"`
+
+	// SchedulerRequestTimeoutSeconds, if set, gives the timeout in seconds for permit requests to
+	// the scheduler plugin. If unset, this falls back on the autoscaler-agent's
+	// .scheduler.requestTimeoutSeconds.
+	SchedulerRequestTimeoutSeconds *uint32 `json:"schedulerRequestTimeoutSeconds,omitempty"`
+
 	// CPUStableZoneRatio is the ratio of the stable load zone size relative to load5.
 	// For example, a value of 0.25 means that stable zone will be load5±25%.
 	CPUStableZoneRatio *float64 `json:"cpuStableZoneRatio,omitempty"`
@@ -417,6 +576,36 @@ type ScalingConfig struct {
 	CPUMixedZoneRatio *float64 `json:"cpuMixedZoneRatio,omitempty"`
 }
 
+// GoalCombination is the policy for combining the goal CU of each scaling signal
+type GoalCombination string
+
+const (
+	// GoalCombinationMax uses the maximum of the weighted goal CU of each signal.
+	GoalCombinationMax GoalCombination = "max"
+	// GoalCombinationWeightedAverage uses the weighted average of the goal CU of each signal, out
+	// of the signals that are available.
+	GoalCombinationWeightedAverage GoalCombination = "weightedAverage"
+)
+
+// GoalWeights gives the weight for the goal CU of each scaling signal
+type GoalWeights struct {
+	CPU         float64 `json:"cpu"`
+	Mem         float64 `json:"mem"`
+	LFC         float64 `json:"lfc"`
+	Connections float64 `json:"connections"`
+}
+
+func (w GoalWeights) validate(ec *erc.Collector) {
+	erc.Whenf(ec, w.CPU < 0, "%s must be set to value >= 0", ".goalWeights.cpu")
+	erc.Whenf(ec, w.Mem < 0, "%s must be set to value >= 0", ".goalWeights.mem")
+	erc.Whenf(ec, w.LFC < 0, "%s must be set to value >= 0", ".goalWeights.lfc")
+	erc.Whenf(ec, w.Connections < 0, "%s must be set to value >= 0", ".goalWeights.connections")
+	erc.Whenf(
+		ec, w.CPU+w.Mem+w.LFC+w.Connections <= 0,
+		"%s must have at least one weight greater than zero", ".goalWeights",
+	)
+}
+
 // WithOverrides returns a new copy of defaults, where fields set in overrides replace the ones in
 // defaults but all others remain the same.
 //
@@ -450,6 +639,42 @@ func (defaults ScalingConfig) WithOverrides(overrides *ScalingConfig) ScalingCon
 	if overrides.LFCMinWaitBeforeDownscaleMinutes != nil {
 		defaults.LFCMinWaitBeforeDownscaleMinutes = lo.ToPtr(*overrides.LFCMinWaitBeforeDownscaleMinutes)
 	}
+	if overrides.EnableConnectionMetrics != nil {
+		defaults.EnableConnectionMetrics = lo.ToPtr(*overrides.EnableConnectionMetrics)
+	}
+	if overrides.MemoryPerConnection != nil {
+		defaults.MemoryPerConnection = lo.ToPtr(*overrides.MemoryPerConnection)
+	}
+
+	if overrides.GoalCombination != nil {
+		defaults.GoalCombination = lo.ToPtr(*overrides.GoalCombination)
+	}
+	if overrides.GoalWeights != nil {
+		defaults.GoalWeights = lo.ToPtr(*overrides.GoalWeights)
+	}
+
+	if overrides.MaxUpscaleStepCU != nil {
+		defaults.MaxUpscaleStepCU = lo.ToPtr(*overrides.MaxUpscaleStepCU)
+	}
+	if overrides.MaxDownscaleStepCU != nil {
+		defaults.MaxDownscaleStepCU = lo.ToPtr(*overrides.MaxDownscaleStepCU)
+	}
+	if overrides.DownscaleStabilizationSeconds != nil {
+		defaults.DownscaleStabilizationSeconds = lo.ToPtr(*overrides.DownscaleStabilizationSeconds)
+	}
+	if overrides.Schedules != nil {
+		defaults.Schedules = slices.Clone(overrides.Schedules)
+	}
+
+	if overrides.DryRun != nil {
+		defaults.DryRun = lo.ToPtr(*overrides.DryRun)
+	}
+	if overrides.MonitorDownscaleTimeoutSeconds != nil {
+		defaults.MonitorDownscaleTimeoutSeconds = lo.ToPtr(*overrides.MonitorDownscaleTimeoutSeconds)
+	}
+	if overrides.SchedulerRequestTimeoutSeconds != nil {
+		defaults.SchedulerRequestTimeoutSeconds = lo.ToPtr(*overrides.SchedulerRequestTimeoutSeconds)
+	}
 
 	if overrides.CPUStableZoneRatio != nil {
 		defaults.CPUStableZoneRatio = lo.ToPtr(*overrides.CPUStableZoneRatio)
@@ -461,6 +686,48 @@ func (defaults ScalingConfig) WithOverrides(overrides *ScalingConfig) ScalingCon
 	return defaults
 }
 
+// ScalingConfigFromPolicy returns the ScalingConfig overrides given by the ScalingPolicy spec.
+//
+// Fields not set in the policy are left unset, so that they fall back on the global defaults.
+func ScalingConfigFromPolicy(spec *vmv1.ScalingPolicySpec) ScalingConfig {
+	percentToFraction := func(p *int32) *float64 {
+		if p == nil {
+			return nil
+		}
+		return lo.ToPtr(float64(*p) / 100)
+	}
+	toUint32 := func(v *int32) *uint32 {
+		if v == nil {
+			return nil
+		}
+		return lo.ToPtr(uint32(max(*v, 0)))
+	}
+	toComputeUnits := func(v *int32) *ComputeUnits {
+		if v == nil {
+			return nil
+		}
+		return lo.ToPtr(WholeComputeUnits(uint32(max(*v, 0))))
+	}
+
+	var config ScalingConfig
+	if t := spec.TargetUtilization; t != nil {
+		config.LoadAverageFractionTarget = percentToFraction(t.LoadAveragePercent)
+		config.MemoryUsageFractionTarget = percentToFraction(t.MemoryUsagePercent)
+		config.MemoryTotalFractionTarget = percentToFraction(t.MemoryTotalPercent)
+	}
+	if l := spec.StepLimits; l != nil {
+		config.MaxUpscaleStepCU = toComputeUnits(l.MaxUpscaleCU)
+		config.MaxDownscaleStepCU = toComputeUnits(l.MaxDownscaleCU)
+	}
+	if st := spec.Stabilization; st != nil {
+		config.DownscaleStabilizationSeconds = toUint32(st.DownscaleWindowSeconds)
+	}
+	if spec.Schedules != nil {
+		config.Schedules = slices.Clone(spec.Schedules)
+	}
+	return config
+}
+
 // ValidateDefaults checks that the ScalingConfig is safe to use as default settings.
 //
 // This is more strict than ValidateOverride, where some fields need not be specified.
@@ -505,11 +772,39 @@ func (c *ScalingConfig) validate(requireAll bool) error {
 		ec.Add(fmt.Errorf("%s is a required field", ".memoryTotalFractionTarget"))
 	}
 
+	if c.GoalCombination != nil {
+		switch *c.GoalCombination {
+		case GoalCombinationMax, GoalCombinationWeightedAverage:
+		default:
+			ec.Add(fmt.Errorf(
+				"%s must be one of %q or %q", ".goalCombination",
+				GoalCombinationMax, GoalCombinationWeightedAverage,
+			))
+		}
+	}
+	if c.GoalWeights != nil {
+		c.GoalWeights.validate(ec)
+	}
+
+	erc.Whenf(ec, c.MaxUpscaleStepCU != nil && *c.MaxUpscaleStepCU == 0, "%s must be set to value > 0", ".maxUpscaleStepCU")
+	erc.Whenf(ec, c.MaxDownscaleStepCU != nil && *c.MaxDownscaleStepCU == 0, "%s must be set to value > 0", ".maxDownscaleStepCU")
+	erc.Whenf(ec, c.MonitorDownscaleTimeoutSeconds != nil && *c.MonitorDownscaleTimeoutSeconds == 0, "%s must be set to value > 0", ".monitorDownscaleTimeoutSeconds")
+	erc.Whenf(ec, c.SchedulerRequestTimeoutSeconds != nil && *c.SchedulerRequestTimeoutSeconds == 0, "%s must be set to value > 0", ".schedulerRequestTimeoutSeconds")
+	for i, schedule := range c.Schedules {
+		if err := schedule.Validate(); err != nil {
+			ec.Add(fmt.Errorf(".schedules[%d]%w", i, err))
+		}
+	}
+
 	if requireAll {
 		erc.Whenf(ec, c.EnableLFCMetrics == nil, "%s is a required field", ".enableLFCMetrics")
 		erc.Whenf(ec, c.LFCToMemoryRatio == nil, "%s is a required field", ".lfcToMemoryRatio")
 		erc.Whenf(ec, c.LFCWindowSizeMinutes == nil, "%s is a required field", ".lfcWindowSizeMinutes")
 		erc.Whenf(ec, c.LFCMinWaitBeforeDownscaleMinutes == nil, "%s is a required field", ".lfcMinWaitBeforeDownscaleMinutes")
+		erc.Whenf(ec, c.EnableConnectionMetrics == nil, "%s is a required field", ".enableConnectionMetrics")
+		erc.Whenf(ec, c.MemoryPerConnection == nil, "%s is a required field", ".memoryPerConnection")
+		erc.Whenf(ec, c.GoalCombination == nil, "%s is a required field", ".goalCombination")
+		erc.Whenf(ec, c.GoalWeights == nil, "%s is a required field", ".goalWeights")
 		erc.Whenf(ec, c.CPUStableZoneRatio == nil, "%s is a required field", ".cpuStableZoneRatio")
 		erc.Whenf(ec, c.CPUMixedZoneRatio == nil, "%s is a required field", ".cpuMixedZoneRatio")
 	}
@@ -1,11 +1,16 @@
 package controllers
 
 import (
+	"fmt"
+	"slices"
 	"time"
 
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/types"
 
 	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/util"
 )
 
 // ReconcilerConfig stores shared configuration for VirtualMachineReconciler and
@@ -47,11 +52,192 @@ type ReconcilerConfig struct {
 	// updates of metrics and logs, related to failing reconciliations
 	FailingRefreshInterval time.Duration
 
+	// SlowReconcileThreshold is the duration above which reconciles are logged with a breakdown of
+	// where the time went. Zero disables this.
+	SlowReconcileThreshold time.Duration
+
+	// QMPRetryRateLimit limits the rate of retrying reconciles that failed because QMP was
+	// unreachable, across all objects handled by each controller. Retries over the limit are
+	// requeued after a delay, instead of with controller-runtime's per-object backoff. A zero rate
+	// disables this.
+	QMPRetryRateLimit util.RateLimitConfig
+
 	// AtMostOnePod is the flag that indicates whether we should only have one pod per VM.
 	AtMostOnePod bool
 	// DefaultCPUScalingMode is the default CPU scaling mode that will be used for VMs with empty spec.cpuScalingMode
 	DefaultCPUScalingMode vmv1.CpuScalingMode
+	// DefaultRuntimeClassName, if not empty, is the RuntimeClass used for runner pods of VMs with
+	// empty spec.runtimeClassName
+	DefaultRuntimeClassName string
+
+	// NodeTuningProfileDir, if not empty, is the directory on each node that may contain the
+	// node's hypervisor tuning profile, as 'profile.json'.
+	//
+	// The directory is mounted read-only into new runner pods, and the profile is passed to
+	// neonvm-runner as the '-node-tuning-profile' flag. Nodes without the file use the defaults.
+	NodeTuningProfileDir string
+
+	// QEMUExtraArgsAllowlist is the set of QEMU flags that VMs may pass in .spec.guest.extraArgs.
+	//
+	// Entries are matched exactly, unless they end with '*', in which case they match any flag with
+	// that prefix (e.g. '-trace*'). New VMs with flags not on the list are rejected by the webhook.
+	QEMUExtraArgsAllowlist []string
+
+	// KernelArgsAllowlist, if not empty, is the set of kernel parameters that VMs may set in
+	// .spec.guest.kernelArgs. If empty, all parameters not on KernelArgsDenylist are allowed.
+	//
+	// Entries in both lists are parameter names, matched against the part of each argument
+	// before '='. As with QEMUExtraArgsAllowlist, entries ending with '*' match by prefix.
+	KernelArgsAllowlist []string
+	// KernelArgsDenylist is the set of kernel parameters that VMs may not set in
+	// .spec.guest.kernelArgs, even if they're on KernelArgsAllowlist -- typically the parameters
+	// that neonvm-runner sets itself.
+	KernelArgsDenylist []string
+
+	// ResumePoolDir, if not empty, is the directory on each node that holds the memory images for
+	// resume pools, which are kept by VirtualMachinePools that set .spec.resumeImages. Pools are
+	// disabled if empty.
+	ResumePoolDir string
+
+	// MigrationMaxBandwidth is the maximum bandwidth for live migrations, in bytes per second, used
+	// for migrations that don't set .spec.maxBandwidth.
+	MigrationMaxBandwidth resource.Quantity
+
+	// MigrationMaxDowntime is the maximum time that a VM may be paused for at the end of a live
+	// migration, used for migrations that don't set .spec.maxDowntimeMillis.
+	MigrationMaxDowntime time.Duration
+
+	// MigrationCPUModelLabel, if not empty, is the node label that identifies the node's CPU model.
+	//
+	// Migration target pods are restricted to nodes with the same CPU model as the source node, if
+	// the source node has the label.
+	MigrationCPUModelLabel string
+
+	// SchedulerPluginAddr, if not empty, is the base URL of the scheduler plugin, which is asked
+	// whether any node has capacity for a VM before its migration target pod is created.
+	SchedulerPluginAddr string
+
+	// ComputeUnitResource, if not nil, gives the size of a compute unit, and enables requesting the
+	// "neon.tech/compute-unit" extended resource for new runner pods, covering the VM's minimum
+	// resources. This should match the scheduler plugin's config, which advertises node capacity.
+	ComputeUnitResource *api.Resources
 
 	// NADConfig is the configuration for the Network Attachment Definitions
 	NADConfig *NADConfig
+
+	// PodDriftPolicy is what to do with running VMs whose runner pod differs from what would be
+	// created for the VM now. Drift is always reported with the VM's Drifted condition.
+	PodDriftPolicy PodDriftPolicy
+
+	// PropagatedLabels, if not nil, restricts which of the VM's labels are copied to its runner
+	// pods and kept in sync, as a list of keys, where entries ending in '*' match by prefix. Labels
+	// in the neon.tech domains are always propagated, because other components rely on them.
+	//
+	// Labels on the runner pod outside of this set are left alone, so that they can be managed by
+	// others. If nil, all labels are propagated, and other labels are removed from the pod.
+	//
+	// The label from HAAntiAffinity is always propagated as well, because the anti-affinity
+	// selects runner pods by it.
+	PropagatedLabels []string
+	// PropagatedAnnotations is like PropagatedLabels, but for annotations.
+	PropagatedAnnotations []string
+
+	// HAAntiAffinity, if not nil, enables automatic anti-affinity between the runner pods of VMs
+	// that have the same value for a label -- e.g., the primary and standby computes of a tenant.
+	HAAntiAffinity *HAAntiAffinityConfig
+
+	// NestedVirtNodeLabel, if not empty, is the node label that marks nodes as
+	// supporting nested virtualization, with the value "true". Runner pods of VMs with
+	// .spec.guest.nestedVirtualization are restricted to these nodes.
+	NestedVirtNodeLabel string
+
+	// CPUFeatureLabelPrefix, if not empty, is the prefix of the node labels that mark nodes as
+	// supporting a CPU feature, with the value "true", followed by the feature's name in upper
+	// case -- like the labels from Node Feature Discovery. Runner pods of VMs with
+	// .spec.guest.cpuFeatures.enable are restricted to nodes with all of the features.
+	CPUFeatureLabelPrefix string
+
+	// VirtioMemBlockSize is the default for .spec.guest.virtioMemBlockSize, set on VMs that don't
+	// specify it before they're first started. It's reduced for VMs whose memory slot size isn't a
+	// multiple of it.
+	VirtioMemBlockSize resource.Quantity
+
+	// OOMMemoryBump, if not nil, enables temporarily raising the minimum memory of VMs that were
+	// OOM-killed, so that they have more room when they're restarted.
+	OOMMemoryBump *OOMMemoryBumpConfig
+
+	// ImageRollback, if not nil, enables rolling VMs back to .spec.guest.rootDisk.fallbackImage
+	// when they don't become ready after their root disk image changes.
+	ImageRollback *ImageRollbackConfig
+}
+
+// ImageRollbackConfig configures the automatic rollback of VMs whose new root disk image doesn't
+// boot.
+type ImageRollbackConfig struct {
+	// Deadline is how long the guest has to become ready after its runner pod with the new image
+	// starts, before the VM is rolled back.
+	Deadline time.Duration
+}
+
+// OOMMemoryBumpConfig configures the temporary increase to the minimum memory of VMs after they
+// were OOM-killed.
+type OOMMemoryBumpConfig struct {
+	// Slots is how far above the VM's memory at the time it was OOM-killed its minimum is raised
+	// to, in memory slots. The minimum is never raised above the VM's maximum.
+	Slots int32
+	// Duration is how long the bump lasts after the VM was OOM-killed. The bump is extended if
+	// the VM is OOM-killed again in the meantime.
+	Duration time.Duration
+}
+
+// propagatedLabels returns the PropagatedLabels to use for runner pods, including the label
+// required by HAAntiAffinity, if enabled.
+func (c *ReconcilerConfig) propagatedLabels() []string {
+	if c.PropagatedLabels == nil || c.HAAntiAffinity == nil {
+		return c.PropagatedLabels
+	}
+	return append(slices.Clip(c.PropagatedLabels), c.HAAntiAffinity.Label)
+}
+
+// HAAntiAffinityConfig configures the anti-affinity that's automatically added to runner pods of
+// VMs that are replicas of each other.
+type HAAntiAffinityConfig struct {
+	// Label is the VM label whose value identifies the group of replicas. VMs without the label
+	// don't get any extra anti-affinity.
+	Label string
+	// TopologyKeys are the node labels that replicas should be spread across, e.g.
+	// "kubernetes.io/hostname" for different nodes and "topology.kubernetes.io/zone" for different
+	// zones.
+	TopologyKeys []string
+	// Required, if true, makes the anti-affinity a hard requirement for scheduling. Otherwise, it's
+	// only preferred, so that replicas can still share a node or zone if there's no other choice.
+	Required bool
+}
+
+// PodDriftPolicy determines what happens to VMs whose runner pod has drifted from what would be
+// created for them now, e.g. after the controller is upgraded.
+type PodDriftPolicy string
+
+const (
+	// PodDriftPolicyReport only reports drift, with the VM's Drifted condition. This is the
+	// default.
+	PodDriftPolicyReport PodDriftPolicy = "report"
+	// PodDriftPolicyRecreate additionally marks drifted VMs as RestartPending, so that their runner
+	// pods are recreated by the restart rollout.
+	PodDriftPolicyRecreate PodDriftPolicy = "recreate"
+)
+
+// FlagFunc is a parsing function to be used with flag.Func
+func (p *PodDriftPolicy) FlagFunc(value string) error {
+	possibleValues := []string{
+		string(PodDriftPolicyReport),
+		string(PodDriftPolicyRecreate),
+	}
+
+	if !slices.Contains(possibleValues, value) {
+		return fmt.Errorf("Unknown PodDriftPolicy %q, must be one of %v", value, possibleValues)
+	}
+
+	*p = PodDriftPolicy(value)
+	return nil
 }
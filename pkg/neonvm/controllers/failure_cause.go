@@ -0,0 +1,82 @@
+package controllers
+
+// Classification of reconcile failures, so that metrics and the debug snapshot can say *why*
+// objects are failing to reconcile, not just how many.
+
+import (
+	"errors"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// FailureCause is the broad reason a reconcile failed. The set of values is fixed, so it's safe to
+// use as a metric label.
+type FailureCause string
+
+const (
+	// FailureCauseQMPUnreachable means that we couldn't connect to QEMU's QMP socket.
+	FailureCauseQMPUnreachable FailureCause = "qmp_unreachable"
+	// FailureCausePodSchedule means that the runner pod couldn't be created.
+	FailureCausePodSchedule FailureCause = "pod_schedule_failure"
+	// FailureCauseWebhookConflict means that the API server rejected an update, either because the
+	// object was modified concurrently, or because an admission webhook denied it.
+	FailureCauseWebhookConflict FailureCause = "webhook_conflict"
+	// FailureCauseAPIThrottling means that the API server asked us to back off.
+	FailureCauseAPIThrottling FailureCause = "api_throttling"
+	// FailureCauseInvalidSpec means that the object itself is invalid, so the reconcile won't
+	// succeed until it's changed.
+	FailureCauseInvalidSpec FailureCause = "invalid_spec"
+	// FailureCauseOther is any failure not covered by the other causes.
+	FailureCauseOther FailureCause = "other"
+)
+
+var allFailureCauses = []FailureCause{
+	FailureCauseQMPUnreachable,
+	FailureCausePodSchedule,
+	FailureCauseWebhookConflict,
+	FailureCauseAPIThrottling,
+	FailureCauseInvalidSpec,
+	FailureCauseOther,
+}
+
+// errRunnerPodCreation is wrapped by errors from creating runner pods (including migration target
+// pods).
+var errRunnerPodCreation = errors.New("failed to create runner pod")
+
+// classifyFailure returns the FailureCause for an error returned by a reconcile.
+//
+// Throttling is checked first, because e.g. throttling while creating the runner pod is better
+// described as throttling than as a pod failure. Otherwise, the cause follows from the error's
+// ErrorKind.
+func classifyFailure(err error) FailureCause {
+	if apierrors.IsTooManyRequests(err) {
+		return FailureCauseAPIThrottling
+	}
+
+	switch ErrorKindOf(err) {
+	case ErrorKindConflict:
+		return FailureCauseWebhookConflict
+	case ErrorKindGuestUnreachable:
+		return FailureCauseQMPUnreachable
+	case ErrorKindInvalidSpec:
+		return FailureCauseInvalidSpec
+	}
+	if errors.Is(err, errRunnerPodCreation) {
+		return FailureCausePodSchedule
+	}
+	return FailureCauseOther
+}
+
+// isWebhookDenial returns whether the error is from an admission webhook rejecting the request.
+//
+// There's no dedicated status reason for this, so we have to go by the message the API server
+// generates. This is only used by ErrorKindOf, as a fallback for errors that weren't marked as
+// conflicts where they happened.
+func isWebhookDenial(err error) bool {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return false
+	}
+	return strings.HasPrefix(status.Status().Message, "admission webhook ")
+}
@@ -27,6 +27,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 
@@ -113,8 +114,17 @@ var _ = Describe("VirtualMachine controller", func() {
 					MemhpAutoMovableRatio:   "301",
 					FailurePendingPeriod:    1 * time.Minute,
 					FailingRefreshInterval:  1 * time.Minute,
+					SlowReconcileThreshold:  0,
 					AtMostOnePod:            false,
 					DefaultCPUScalingMode:   vmv1.CpuScalingModeQMP,
+					NodeTuningProfileDir:    "",
+					QEMUExtraArgsAllowlist:  nil,
+					ResumePoolDir:           "",
+					MigrationMaxBandwidth:   resource.MustParse("1Gi"),
+					MigrationMaxDowntime:    300 * time.Millisecond,
+					MigrationCPUModelLabel:  "",
+					SchedulerPluginAddr:     "",
+					ComputeUnitResource:     nil,
 					NADConfig:               nil,
 				},
 				IPAM: nil,
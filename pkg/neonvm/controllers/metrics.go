@@ -3,18 +3,23 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samber/lo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
-	"k8s.io/apimachinery/pkg/api/errors"
+	corev1 "k8s.io/api/core/v1"
 
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
 	"github.com/neondatabase/autoscaling/pkg/neonvm/controllers/failurelag"
 	"github.com/neondatabase/autoscaling/pkg/util"
 )
@@ -26,9 +31,29 @@ type ReconcilerMetrics struct {
 	vmCreationToVMRunningTime      prometheus.Histogram
 	vmRestartCounts                prometheus.Counter
 	reconcileDuration              prometheus.HistogramVec
+	reconcileSlow                  *prometheus.CounterVec
+	migrationProgress              *prometheus.GaugeVec
+	migrationsStarted              *prometheus.CounterVec
+	migrationsSucceeded            *prometheus.CounterVec
+	migrationsFailed               *prometheus.CounterVec
+	migrationDuration              *prometheus.HistogramVec
+	migrationDowntime              *prometheus.HistogramVec
+	migrationTransferredBytes      *prometheus.CounterVec
+	vmCreationToPodScheduledTime   *prometheus.HistogramVec
+	podScheduledToVMRunningTime    *prometheus.HistogramVec
+	vmScalingDuration              *prometheus.HistogramVec
+	migrationEndToEndDuration      *prometheus.HistogramVec
+
+	// scalingStartedAt stores when each VM entered the Scaling phase, keyed by UID
+	scalingStartedAt *sync.Map
+
+	rateLimiters util.RateLimiterMetrics
 }
 
-const OutcomeLabel = "outcome"
+const (
+	OutcomeLabel = "outcome"
+	CauseLabel   = "cause"
+)
 
 func MakeReconcilerMetrics() ReconcilerMetrics {
 	// Copied bucket values from controller runtime latency metric. We can
@@ -44,7 +69,7 @@ func MakeReconcilerMetrics() ReconcilerMetrics {
 				Name: "reconcile_failing_objects",
 				Help: "Number of objects that are failing to reconcile for each specific controller",
 			},
-			[]string{"controller", OutcomeLabel},
+			[]string{"controller", OutcomeLabel, CauseLabel},
 		)),
 		vmCreationToRunnerCreationTime: util.RegisterMetric(metrics.Registry, prometheus.NewHistogram(
 			prometheus.HistogramOpts{
@@ -80,10 +105,118 @@ func MakeReconcilerMetrics() ReconcilerMetrics {
 				Buckets: buckets,
 			}, []string{OutcomeLabel},
 		)),
+		reconcileSlow: util.RegisterMetric(metrics.Registry, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "reconcile_slow_total",
+				Help: "Number of reconciles that took longer than the slow reconcile threshold",
+			},
+			[]string{"controller"},
+		)),
+		// Migrations are few and short-lived, so it's ok to have a series per migration here.
+		migrationProgress: util.RegisterMetric(metrics.Registry, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "vm_migration_progress_ratio",
+				Help: "Fraction of guest RAM transferred by each running VirtualMachineMigration",
+			},
+			[]string{"namespace", "migration"},
+		)),
+		migrationsStarted: util.RegisterMetric(metrics.Registry, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "vm_migrations_started_total",
+				Help: "Number of VirtualMachineMigration attempts that started transferring the VM",
+			},
+			[]string{TriggerLabel},
+		)),
+		migrationsSucceeded: util.RegisterMetric(metrics.Registry, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "vm_migrations_succeeded_total",
+				Help: "Number of VirtualMachineMigrations that succeeded",
+			},
+			[]string{TriggerLabel},
+		)),
+		migrationsFailed: util.RegisterMetric(metrics.Registry, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "vm_migrations_failed_total",
+				Help: "Number of VirtualMachineMigration attempts that failed, by reason",
+			},
+			[]string{TriggerLabel, "reason"},
+		)),
+		migrationDuration: util.RegisterMetric(metrics.Registry, prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "vm_migration_duration_seconds",
+				Help:    "Time taken by QEMU to complete successful VirtualMachineMigrations",
+				Buckets: []float64{1, 2, 5, 10, 20, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+			},
+			[]string{TriggerLabel},
+		)),
+		migrationDowntime: util.RegisterMetric(metrics.Registry, prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "vm_migration_downtime_seconds",
+				Help:    "Time that VMs were paused for at the end of successful VirtualMachineMigrations",
+				Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.2, 0.3, 0.5, 0.75, 1, 2, 5, 10},
+			},
+			[]string{TriggerLabel},
+		)),
+		migrationTransferredBytes: util.RegisterMetric(metrics.Registry, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "vm_migration_transferred_bytes_total",
+				Help: "Guest RAM transferred by finished VirtualMachineMigration attempts, successful or not",
+			},
+			[]string{TriggerLabel},
+		)),
+		vmCreationToPodScheduledTime: util.RegisterMetric(metrics.Registry, prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "vm_creation_to_pod_scheduled_duration_seconds",
+				Help:    "Time duration from VirtualMachine.CreationTimestamp to the runner Pod being scheduled",
+				Buckets: buckets,
+			},
+			[]string{"namespace"},
+		)),
+		podScheduledToVMRunningTime: util.RegisterMetric(metrics.Registry, prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "vm_pod_scheduled_to_vm_running_duration_seconds",
+				Help:    "Time duration from the runner Pod being scheduled to the moment when VirtualMachine.Status.Phase becomes Running",
+				Buckets: buckets,
+			},
+			[]string{"namespace"},
+		)),
+		vmScalingDuration: util.RegisterMetric(metrics.Registry, prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "vm_scaling_duration_seconds",
+				Help:    "Time duration from VirtualMachine.Status.Phase becoming Scaling to the new resources being applied via QMP",
+				Buckets: buckets,
+			},
+			[]string{"namespace"},
+		)),
+		migrationEndToEndDuration: util.RegisterMetric(metrics.Registry, prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "vm_migration_end_to_end_duration_seconds",
+				Help:    "Time duration from VirtualMachineMigration.CreationTimestamp to the migration succeeding",
+				Buckets: []float64{1, 2, 5, 10, 20, 30, 60, 120, 300, 600, 1200, 1800, 3600},
+			},
+			[]string{"namespace"},
+		)),
+		scalingStartedAt: &sync.Map{},
+
+		rateLimiters: util.NewRateLimiterMetrics("reconcile_rate_limiter", metrics.Registry),
 	}
 	return m
 }
 
+// TriggerLabel is the metrics label for the reason a migration was created, taken from the
+// migration's vmv1.MigrationTriggerLabel label.
+const TriggerLabel = "trigger"
+
+func migrationTrigger(migration *vmv1.VirtualMachineMigration) string {
+	switch trigger := migration.Labels[vmv1.MigrationTriggerLabel]; trigger {
+	case vmv1.MigrationTriggerDrain, vmv1.MigrationTriggerRebalance:
+		return trigger
+	default:
+		// Don't trust arbitrary values, to keep the cardinality bounded.
+		return vmv1.MigrationTriggerManual
+	}
+}
+
 type ReconcileOutcome string
 
 const (
@@ -99,14 +232,103 @@ func (m ReconcilerMetrics) ObserveReconcileDuration(
 	m.reconcileDuration.WithLabelValues(string(outcome)).Observe(duration.Seconds())
 }
 
+// ObserveVMRunning records the startup latencies around the runner pod being scheduled, when the
+// VM becomes Running.
+func (m ReconcilerMetrics) ObserveVMRunning(vm *vmv1.VirtualMachine, pod *corev1.Pod, now time.Time) {
+	var scheduledAt time.Time
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionTrue {
+			scheduledAt = c.LastTransitionTime.Time
+		}
+	}
+	if scheduledAt.IsZero() {
+		return
+	}
+
+	if !vm.HasRestarted() {
+		m.vmCreationToPodScheduledTime.WithLabelValues(vm.Namespace).
+			Observe(scheduledAt.Sub(vm.CreationTimestamp.Time).Seconds())
+	}
+	m.podScheduledToVMRunningTime.WithLabelValues(vm.Namespace).Observe(now.Sub(scheduledAt).Seconds())
+}
+
+// ObserveScalingStarted records that the VM entered the Scaling phase. It's a no-op if the VM is
+// already scaling.
+func (m ReconcilerMetrics) ObserveScalingStarted(vm *vmv1.VirtualMachine) {
+	m.scalingStartedAt.LoadOrStore(vm.UID, time.Now())
+}
+
+// ObserveScalingFinished records the duration of scaling the VM, if it's known when it started.
+func (m ReconcilerMetrics) ObserveScalingFinished(vm *vmv1.VirtualMachine) {
+	if started, ok := m.scalingStartedAt.LoadAndDelete(vm.UID); ok {
+		m.vmScalingDuration.WithLabelValues(vm.Namespace).Observe(time.Since(started.(time.Time)).Seconds())
+	}
+}
+
+// ForgetScaling drops any record of the VM scaling, e.g. because it's being deleted.
+func (m ReconcilerMetrics) ForgetScaling(vm *vmv1.VirtualMachine) {
+	m.scalingStartedAt.Delete(vm.UID)
+}
+
+func (m ReconcilerMetrics) ObserveMigrationProgress(migration *vmv1.VirtualMachineMigration) {
+	progress := migration.Status.Progress
+	if progress == nil || progress.RamTotal == 0 {
+		return
+	}
+	ratio := float64(progress.RamTransferred) / float64(progress.RamTotal)
+	m.migrationProgress.WithLabelValues(migration.Namespace, migration.Name).Set(min(ratio, 1))
+}
+
+func (m ReconcilerMetrics) ForgetMigrationProgress(migration *vmv1.VirtualMachineMigration) {
+	m.migrationProgress.DeleteLabelValues(migration.Namespace, migration.Name)
+}
+
+func (m ReconcilerMetrics) ObserveMigrationStarted(migration *vmv1.VirtualMachineMigration) {
+	m.migrationsStarted.WithLabelValues(migrationTrigger(migration)).Inc()
+}
+
+func (m ReconcilerMetrics) ObserveMigrationSucceeded(migration *vmv1.VirtualMachineMigration, info *MigrationInfo) {
+	trigger := migrationTrigger(migration)
+	m.migrationsSucceeded.WithLabelValues(trigger).Inc()
+	m.migrationEndToEndDuration.WithLabelValues(migration.Namespace).
+		Observe(time.Since(migration.CreationTimestamp.Time).Seconds())
+	m.migrationDuration.WithLabelValues(trigger).Observe(float64(info.TotalTimeMs) / 1000)
+	m.migrationDowntime.WithLabelValues(trigger).Observe(float64(info.DowntimeMs) / 1000)
+	m.migrationTransferredBytes.WithLabelValues(trigger).Add(float64(info.Ram.Transferred))
+}
+
+// ObserveMigrationFailed records a failed migration attempt. info is nil if the failure happened
+// outside of QEMU, e.g. before the transfer started.
+func (m ReconcilerMetrics) ObserveMigrationFailed(
+	migration *vmv1.VirtualMachineMigration,
+	reason string,
+	info *MigrationInfo,
+) {
+	trigger := migrationTrigger(migration)
+	m.migrationsFailed.WithLabelValues(trigger, reason).Inc()
+	if info != nil {
+		m.migrationTransferredBytes.WithLabelValues(trigger).Add(float64(info.Ram.Transferred))
+	}
+}
+
 type wrappedReconciler struct {
 	ControllerName         string
 	Reconciler             reconcile.Reconciler
 	Metrics                ReconcilerMetrics
 	refreshFailingInterval time.Duration
+	slowThreshold          time.Duration
+
+	// qmpRetryLimiter spaces out retries of reconciles that failed because QMP was unreachable
+	qmpRetryLimiter *util.RateLimiter
 
 	failing     *failurelag.Tracker[client.ObjectKey]
 	conflicting *failurelag.Tracker[client.ObjectKey]
+
+	// causes is the cause of the latest failure for each object that's currently failing
+	causes     map[client.ObjectKey]FailureCause
+	causesLock sync.Mutex
+
+	history *reconcileHistory
 }
 
 // ReconcilerWithMetrics is a Reconciler produced by WithMetrics that can return a snapshot of the
@@ -114,7 +336,8 @@ type wrappedReconciler struct {
 type ReconcilerWithMetrics interface {
 	reconcile.Reconciler
 
-	Snapshot() ReconcileSnapshot
+	Snapshot(filter SnapshotFilter) ReconcileSnapshot
+	History(key client.ObjectKey) ObjectHistory
 	FailingRefresher() FailingRefresher
 }
 
@@ -134,18 +357,32 @@ type ReconcileSnapshot struct {
 	// Conflicting is the list of objects currently failing to reconcile
 	// due to a conflict
 	Conflicting []string `json:"conflicting"`
+
+	// Causes is the cause of the latest failure for each object in Failing or Conflicting
+	Causes map[string]FailureCause `json:"causes"`
+
+	// Objects is the latest reconcile of each object matching the filter, sorted by object and
+	// paged according to the filter's Limit and Offset.
+	Objects []ObjectSnapshot `json:"objects"`
+	// TotalObjects is the number of objects matching the filter, before paging
+	TotalObjects int `json:"totalObjects"`
 }
 
 // WithMetrics wraps a given Reconciler with metrics capabilities.
 //
 // The returned reconciler also provides a way to get a snapshot of the state of ongoing reconciles,
 // to see the data backing the metrics.
+//
+// Reconciles that take longer than slowThreshold are logged with a breakdown of where the time went.
+// A slowThreshold of zero disables this.
 func WithMetrics(
 	reconciler reconcile.Reconciler,
 	rm ReconcilerMetrics,
 	cntrlName string,
 	failurePendingPeriod time.Duration,
 	refreshFailingInterval time.Duration,
+	slowThreshold time.Duration,
+	qmpRetryLimit util.RateLimitConfig,
 ) ReconcilerWithMetrics {
 	return &wrappedReconciler{
 		Reconciler:             reconciler,
@@ -154,6 +391,11 @@ func WithMetrics(
 		failing:                failurelag.NewTracker[client.ObjectKey](failurePendingPeriod),
 		conflicting:            failurelag.NewTracker[client.ObjectKey](failurePendingPeriod),
 		refreshFailingInterval: refreshFailingInterval,
+		slowThreshold:          slowThreshold,
+		qmpRetryLimiter:        util.NewRateLimiter(qmpRetryLimit, rm.rateLimiters, fmt.Sprint(cntrlName, "_qmp_retries")),
+		causes:                 make(map[client.ObjectKey]FailureCause),
+		causesLock:             sync.Mutex{},
+		history:                newReconcileHistory(),
 	}
 }
 
@@ -163,8 +405,7 @@ func (d *wrappedReconciler) refreshFailing(
 	tracker *failurelag.Tracker[client.ObjectKey],
 ) {
 	degraded := tracker.Degraded()
-	d.Metrics.failing.WithLabelValues(d.ControllerName, string(outcome)).
-		Set(float64(len(degraded)))
+	d.setFailingMetric(outcome, degraded)
 
 	// Log each object on a separate line (even though we could just put them all on the same line)
 	// so that:
@@ -174,11 +415,48 @@ func (d *wrappedReconciler) refreshFailing(
 		log.Info(
 			fmt.Sprintf("Currently failing to reconcile %v object", d.ControllerName),
 			"outcome", outcome,
+			"cause", d.causeOf(obj),
 			"object", obj,
 		)
 	}
 }
 
+// setFailingMetric sets the number of degraded objects for the outcome, split by the cause of
+// their latest failure.
+func (d *wrappedReconciler) setFailingMetric(outcome ReconcileOutcome, degraded []client.ObjectKey) {
+	counts := make(map[FailureCause]int)
+	for _, obj := range degraded {
+		counts[d.causeOf(obj)]++
+	}
+	// Set every cause, so that ones with no objects left are reset to zero.
+	for _, cause := range allFailureCauses {
+		d.Metrics.failing.WithLabelValues(d.ControllerName, string(outcome), string(cause)).
+			Set(float64(counts[cause]))
+	}
+}
+
+func (d *wrappedReconciler) causeOf(obj client.ObjectKey) FailureCause {
+	d.causesLock.Lock()
+	defer d.causesLock.Unlock()
+
+	if cause, ok := d.causes[obj]; ok {
+		return cause
+	}
+	// Possible if the object succeeded since we got the list of degraded objects.
+	return FailureCauseOther
+}
+
+func (d *wrappedReconciler) setCause(obj client.ObjectKey, cause *FailureCause) {
+	d.causesLock.Lock()
+	defer d.causesLock.Unlock()
+
+	if cause == nil {
+		delete(d.causes, obj)
+	} else {
+		d.causes[obj] = *cause
+	}
+}
+
 func (d *wrappedReconciler) runRefreshFailing(ctx context.Context) {
 	log := log.FromContext(ctx)
 
@@ -189,6 +467,7 @@ func (d *wrappedReconciler) runRefreshFailing(ctx context.Context) {
 		case <-time.After(d.refreshFailingInterval):
 			d.refreshFailing(log, FailureOutcome, d.failing)
 			d.refreshFailing(log, ConflictOutcome, d.conflicting)
+			d.history.prune(time.Now())
 		}
 	}
 }
@@ -210,13 +489,41 @@ func (f FailingRefresher) Start(ctx context.Context) error {
 func (d *wrappedReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 
+	ctx, span := tracer.Start(ctx, fmt.Sprintf("Reconcile %s", d.ControllerName), trace.WithAttributes(
+		attribute.String("k8s.namespace", req.Namespace),
+		attribute.String("k8s.name", req.Name),
+	))
+	ctx, breakdown := withReconcileBreakdown(ctx)
 	now := time.Now()
 	res, err := d.Reconciler.Reconcile(ctx, req)
 	duration := time.Since(now)
+	endSpan(span, err)
+
+	if d.slowThreshold != 0 && duration > d.slowThreshold {
+		d.Metrics.reconcileSlow.WithLabelValues(d.ControllerName).Inc()
+		log.Info("Slow reconcile", append(
+			[]any{"duration", duration.String(), "threshold", d.slowThreshold.String()},
+			breakdown.logFields(duration)...,
+		)...)
+	}
 
 	outcome := SuccessOutcome
+	record := ReconcileRecord{
+		Time:     now,
+		Duration: duration.String(),
+		Outcome:  outcome,
+		Cause:    "",
+		Error:    "",
+	}
+	var kind ErrorKind
 	if err != nil {
-		if errors.IsConflict(err) {
+		kind = ErrorKindOf(err)
+		cause := classifyFailure(err)
+		d.setCause(req.NamespacedName, &cause)
+		record.Cause = cause
+		record.Error = err.Error()
+
+		if kind == ErrorKindConflict {
 			outcome = ConflictOutcome
 			d.conflicting.RecordFailure(req.NamespacedName)
 		} else {
@@ -234,17 +541,36 @@ func (d *wrappedReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		}
 
 		log.Error(err, "Failed to reconcile VirtualMachine",
-			"duration", duration.String(), "outcome", outcome)
+			"duration", duration.String(), "outcome", outcome, "kind", kind, "cause", cause)
 	} else {
 		d.failing.RecordSuccess(req.NamespacedName)
 		d.conflicting.RecordSuccess(req.NamespacedName)
+		d.setCause(req.NamespacedName, nil)
 		log.Info("Successful reconciliation", "duration", duration.String(), "requeueAfter", res.RequeueAfter)
 	}
+	record.Outcome = outcome
+	d.history.record(req.NamespacedName, record)
+
 	d.Metrics.ObserveReconcileDuration(outcome, duration)
-	d.Metrics.failing.WithLabelValues(d.ControllerName,
-		string(FailureOutcome)).Set(float64(d.failing.DegradedCount()))
-	d.Metrics.failing.WithLabelValues(d.ControllerName,
-		string(ConflictOutcome)).Set(float64(d.conflicting.DegradedCount()))
+	d.setFailingMetric(FailureOutcome, d.failing.Degraded())
+	d.setFailingMetric(ConflictOutcome, d.conflicting.Degraded())
+
+	// note: controller-runtime ignores the result if there's an error, so a delayed retry must be
+	// returned without one. The failure has already been recorded above.
+	switch {
+	case err == nil:
+	case kind == ErrorKindInvalidSpec:
+		// Retrying won't help until the object changes, which will trigger a new reconcile anyways.
+		return res, reconcile.TerminalError(err)
+	case kind == ErrorKindGuestUnreachable:
+		// QMP being unreachable usually means trouble with the runner pod, which tends to affect
+		// many VMs at once (e.g. when a node goes down). Space out their retries across all
+		// objects, so that we don't spend all our time on connections that are likely to fail.
+		if delay := d.qmpRetryLimiter.Reserve(); delay > 0 {
+			log.Info("Delaying retry after QMP was unreachable", "delay", delay.String())
+			return ctrl.Result{RequeueAfter: delay}, nil
+		}
+	}
 
 	return res, err
 }
@@ -257,13 +583,55 @@ func toStringSlice(s []client.ObjectKey) []string {
 	return keys
 }
 
-func (r *wrappedReconciler) Snapshot() ReconcileSnapshot {
-	failing := toStringSlice(r.failing.Degraded())
-	conflicting := toStringSlice(r.conflicting.Degraded())
+func (r *wrappedReconciler) Snapshot(filter SnapshotFilter) ReconcileSnapshot {
+	failingKeys := lo.Filter(r.failing.Degraded(), func(k client.ObjectKey, _ int) bool {
+		return filter.matches(k)
+	})
+	conflictingKeys := lo.Filter(r.conflicting.Degraded(), func(k client.ObjectKey, _ int) bool {
+		return filter.matches(k)
+	})
+
+	causes := make(map[string]FailureCause)
+	currentlyFailing := make(map[client.ObjectKey]struct{})
+	for _, k := range append(failingKeys, conflictingKeys...) {
+		causes[k.String()] = r.causeOf(k)
+		currentlyFailing[k] = struct{}{}
+	}
+
+	keys, latest := r.history.latest()
+	objects := []ObjectSnapshot{}
+	for _, k := range keys {
+		_, isFailing := currentlyFailing[k]
+		if !filter.matches(k) || (filter.OnlyFailing && !isFailing) {
+			continue
+		}
+		objects = append(objects, ObjectSnapshot{
+			Object:        k.String(),
+			Failing:       isFailing,
+			LastReconcile: latest[k],
+		})
+	}
+	total := len(objects)
+	limit := filter.Limit
+	if limit == 0 || limit > maxSnapshotLimit {
+		limit = maxSnapshotLimit
+	}
+	objects = objects[min(filter.Offset, total):]
+	objects = objects[:min(limit, len(objects))]
 
 	return ReconcileSnapshot{
 		ControllerName: r.ControllerName,
-		Failing:        failing,
-		Conflicting:    conflicting,
+		Failing:        toStringSlice(failingKeys),
+		Conflicting:    toStringSlice(conflictingKeys),
+		Causes:         causes,
+		Objects:        objects,
+		TotalObjects:   total,
+	}
+}
+
+func (r *wrappedReconciler) History(key client.ObjectKey) ObjectHistory {
+	return ObjectHistory{
+		ControllerName: r.ControllerName,
+		History:        r.history.get(key),
 	}
 }
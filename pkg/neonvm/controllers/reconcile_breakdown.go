@@ -0,0 +1,76 @@
+package controllers
+
+// Tracking of where the time in each reconcile goes, so that slow reconciles can be logged with
+// the dependency that made them slow.
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// reconcileBreakdown is the time spent by a single reconcile waiting on each of its dependencies.
+//
+// Reconciles may make requests concurrently, so the breakdown can add up to more than the total.
+type reconcileBreakdown struct {
+	api    atomic.Int64
+	qmp    atomic.Int64
+	runner atomic.Int64
+}
+
+type reconcileBreakdownKey struct{}
+
+func withReconcileBreakdown(ctx context.Context) (context.Context, *reconcileBreakdown) {
+	b := &reconcileBreakdown{}
+	return context.WithValue(ctx, reconcileBreakdownKey{}, b), b
+}
+
+// getReconcileBreakdown returns the breakdown for the reconcile in ctx, or nil if there isn't one.
+func getReconcileBreakdown(ctx context.Context) *reconcileBreakdown {
+	b, _ := ctx.Value(reconcileBreakdownKey{}).(*reconcileBreakdown)
+	return b
+}
+
+func (b *reconcileBreakdown) addAPI(start time.Time) {
+	if b != nil {
+		b.api.Add(int64(time.Since(start)))
+	}
+}
+
+func (b *reconcileBreakdown) addQMP(start time.Time) {
+	if b != nil {
+		b.qmp.Add(int64(time.Since(start)))
+	}
+}
+
+func (b *reconcileBreakdown) addRunner(start time.Time) {
+	if b != nil {
+		b.runner.Add(int64(time.Since(start)))
+	}
+}
+
+// logFields returns the breakdown as key-value pairs for logging. Time not spent on any of the
+// tracked dependencies is reported as "otherDuration".
+func (b *reconcileBreakdown) logFields(total time.Duration) []any {
+	api := time.Duration(b.api.Load())
+	qmp := time.Duration(b.qmp.Load())
+	runner := time.Duration(b.runner.Load())
+	return []any{
+		"apiDuration", api.String(),
+		"qmpDuration", qmp.String(),
+		"runnerHTTPDuration", runner.String(),
+		"otherDuration", max(0, total-api-qmp-runner).String(),
+	}
+}
+
+// breakdownTransport is an http.RoundTripper that counts the time spent on requests towards the
+// reconcile in the request's context.
+type breakdownTransport struct {
+	next http.RoundTripper
+}
+
+func (t breakdownTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	defer getReconcileBreakdown(req.Context()).addRunner(time.Now())
+	return t.next.RoundTrip(req)
+}
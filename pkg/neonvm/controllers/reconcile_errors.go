@@ -0,0 +1,107 @@
+package controllers
+
+// Typed errors for reconciles, so that how a failure is handled -- whether (and how soon) it's
+// retried, the reason on the event we emit, and the metrics label -- is decided by the kind of
+// failure at the place it happened, rather than by inspecting the error afterwards.
+
+import (
+	"errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ErrorKind is the broad category of a reconcile error, determining how it's handled
+type ErrorKind string
+
+const (
+	// ErrorKindTransient is a failure that may resolve by itself. The reconcile is retried with
+	// the usual backoff.
+	//
+	// This is the default for errors that aren't otherwise classified.
+	ErrorKindTransient ErrorKind = "transient"
+	// ErrorKindConflict is a failure to update an object because it was modified concurrently, or
+	// because the update was rejected by an admission webhook. The reconcile is retried with the
+	// usual backoff, but the failure is tracked separately, because it's usually short-lived.
+	ErrorKindConflict ErrorKind = "conflict"
+	// ErrorKindGuestUnreachable is a failure to connect to the VM's QEMU or guest. Retries are
+	// spaced out across all objects, because this tends to affect many VMs at once.
+	ErrorKindGuestUnreachable ErrorKind = "guest_unreachable"
+	// ErrorKindInvalidSpec is a failure caused by the object itself, which cannot succeed until
+	// the object is changed. The reconcile is not retried.
+	ErrorKindInvalidSpec ErrorKind = "invalid_spec"
+)
+
+// reconcileError is an error of a particular ErrorKind, created by Transient, Conflict,
+// GuestUnreachable, or InvalidSpec.
+type reconcileError struct {
+	kind ErrorKind
+	err  error
+}
+
+func (e *reconcileError) Error() string {
+	return e.err.Error()
+}
+
+func (e *reconcileError) Unwrap() error {
+	return e.err
+}
+
+func withErrorKind(kind ErrorKind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &reconcileError{kind: kind, err: err}
+}
+
+// Transient marks err as ErrorKindTransient. If err is nil, Transient returns nil.
+func Transient(err error) error {
+	return withErrorKind(ErrorKindTransient, err)
+}
+
+// Conflict marks err as ErrorKindConflict. If err is nil, Conflict returns nil.
+func Conflict(err error) error {
+	return withErrorKind(ErrorKindConflict, err)
+}
+
+// GuestUnreachable marks err as ErrorKindGuestUnreachable. If err is nil, GuestUnreachable returns
+// nil.
+func GuestUnreachable(err error) error {
+	return withErrorKind(ErrorKindGuestUnreachable, err)
+}
+
+// InvalidSpec marks err as ErrorKindInvalidSpec. If err is nil, InvalidSpec returns nil.
+func InvalidSpec(err error) error {
+	return withErrorKind(ErrorKindInvalidSpec, err)
+}
+
+// ErrorKindOf returns the ErrorKind of err.
+//
+// If err has been marked more than once, the outermost kind is used. Errors from the API server
+// that weren't marked are classified by their status, so that every call site updating an object
+// doesn't need to mark conflicts itself.
+func ErrorKindOf(err error) ErrorKind {
+	var rerr *reconcileError
+	switch {
+	case errors.As(err, &rerr):
+		return rerr.kind
+	case apierrors.IsConflict(err), isWebhookDenial(err):
+		return ErrorKindConflict
+	default:
+		return ErrorKindTransient
+	}
+}
+
+// EventReason returns the reason to use for events about a failed reconcile with this kind of
+// error.
+func (k ErrorKind) EventReason() string {
+	switch k {
+	case ErrorKindConflict:
+		return "Conflict"
+	case ErrorKindGuestUnreachable:
+		return "GuestUnreachable"
+	case ErrorKindInvalidSpec:
+		return "InvalidSpec"
+	default:
+		return "Failed"
+	}
+}
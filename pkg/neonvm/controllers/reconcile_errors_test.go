@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestErrorKindOf(t *testing.T) {
+	base := errors.New("something went wrong")
+	conflict := apierrors.NewConflict(schema.GroupResource{Group: "vm.neon.tech", Resource: "virtualmachines"}, "vm", base)
+	throttled := apierrors.NewTooManyRequests("slow down", 1)
+
+	cases := []struct {
+		name  string
+		err   error
+		kind  ErrorKind
+		cause FailureCause
+	}{
+		{"unmarked", base, ErrorKindTransient, FailureCauseOther},
+		{"transient", Transient(base), ErrorKindTransient, FailureCauseOther},
+		{"conflict", Conflict(base), ErrorKindConflict, FailureCauseWebhookConflict},
+		{"guest unreachable", GuestUnreachable(base), ErrorKindGuestUnreachable, FailureCauseQMPUnreachable},
+		{"invalid spec", InvalidSpec(base), ErrorKindInvalidSpec, FailureCauseInvalidSpec},
+		{"wrapped", fmt.Errorf("outer: %w", InvalidSpec(base)), ErrorKindInvalidSpec, FailureCauseInvalidSpec},
+		{"outermost wins", Transient(GuestUnreachable(base)), ErrorKindTransient, FailureCauseOther},
+		{"api conflict", fmt.Errorf("update: %w", conflict), ErrorKindConflict, FailureCauseWebhookConflict},
+		{"api throttling", throttled, ErrorKindTransient, FailureCauseAPIThrottling},
+		{"pod creation", fmt.Errorf("%w: %w", errRunnerPodCreation, base), ErrorKindTransient, FailureCausePodSchedule},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.kind, ErrorKindOf(c.err))
+			assert.Equal(t, c.cause, classifyFailure(c.err))
+		})
+	}
+}
+
+func TestErrorKindNil(t *testing.T) {
+	assert.NoError(t, Transient(nil))
+	assert.NoError(t, Conflict(nil))
+	assert.NoError(t, GuestUnreachable(nil))
+	assert.NoError(t, InvalidSpec(nil))
+}
@@ -0,0 +1,182 @@
+package controllers
+
+// Per-object history of recent reconciles, and filtering for the snapshot built from it, for the
+// controller's debug server.
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// reconcileHistoryLength is the number of reconciles kept in each object's history
+	reconcileHistoryLength = 10
+	// reconcileHistoryRetention is how long an object's history is kept after its last reconcile.
+	//
+	// Objects are periodically reconciled even if nothing changed, so this only drops the history
+	// of objects that were deleted.
+	reconcileHistoryRetention = 24 * time.Hour
+
+	// maxSnapshotLimit is the largest page of objects in a ReconcileSnapshot, and the default if the
+	// filter doesn't set a limit, so that snapshots stay small with many objects.
+	maxSnapshotLimit = 500
+)
+
+// ReconcileRecord is a single entry in an object's reconcile history
+type ReconcileRecord struct {
+	Time     time.Time        `json:"time"`
+	Duration string           `json:"duration"`
+	Outcome  ReconcileOutcome `json:"outcome"`
+	// Cause and Error are only set if the reconcile failed
+	Cause FailureCause `json:"cause,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+type reconcileHistory struct {
+	mu      sync.Mutex
+	objects map[client.ObjectKey][]ReconcileRecord
+}
+
+func newReconcileHistory() *reconcileHistory {
+	return &reconcileHistory{
+		mu:      sync.Mutex{},
+		objects: make(map[client.ObjectKey][]ReconcileRecord),
+	}
+}
+
+func (h *reconcileHistory) record(key client.ObjectKey, rec ReconcileRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	records := append(h.objects[key], rec)
+	if len(records) > reconcileHistoryLength {
+		records = slices.Clone(records[len(records)-reconcileHistoryLength:])
+	}
+	h.objects[key] = records
+}
+
+// get returns the object's history, oldest first
+func (h *reconcileHistory) get(key client.ObjectKey) []ReconcileRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return slices.Clone(h.objects[key])
+}
+
+// latest returns the latest reconcile of every object, sorted by object
+func (h *reconcileHistory) latest() ([]client.ObjectKey, map[client.ObjectKey]ReconcileRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]client.ObjectKey, 0, len(h.objects))
+	latest := make(map[client.ObjectKey]ReconcileRecord, len(h.objects))
+	for k, records := range h.objects {
+		keys = append(keys, k)
+		latest[k] = records[len(records)-1]
+	}
+	slices.SortFunc(keys, func(a, b client.ObjectKey) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	return keys, latest
+}
+
+// prune removes the history of objects that haven't been reconciled within the retention period
+func (h *reconcileHistory) prune(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for k, records := range h.objects {
+		if now.Sub(records[len(records)-1].Time) > reconcileHistoryRetention {
+			delete(h.objects, k)
+		}
+	}
+}
+
+// SnapshotFilter selects the objects included in a ReconcileSnapshot
+type SnapshotFilter struct {
+	// Namespace, if not empty, only includes objects in the namespace
+	Namespace string
+	// NamePrefix, if not empty, only includes objects with names starting with it
+	NamePrefix string
+	// OnlyFailing only includes objects that are currently failing or conflicting
+	OnlyFailing bool
+
+	// Limit and Offset page through ReconcileSnapshot.Objects. A Limit of zero means the maximum,
+	// which is 500.
+	Limit  int
+	Offset int
+}
+
+func (f SnapshotFilter) matches(key client.ObjectKey) bool {
+	return (f.Namespace == "" || key.Namespace == f.Namespace) && strings.HasPrefix(key.Name, f.NamePrefix)
+}
+
+// ParseSnapshotFilter parses the filter from the query parameters "namespace", "prefix",
+// "failing", "limit", and "offset".
+func ParseSnapshotFilter(query url.Values) (SnapshotFilter, error) {
+	filter := SnapshotFilter{
+		Namespace:   query.Get("namespace"),
+		NamePrefix:  query.Get("prefix"),
+		OnlyFailing: false,
+		Limit:       0,
+		Offset:      0,
+	}
+
+	if s := query.Get("failing"); s != "" {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return SnapshotFilter{}, fmt.Errorf("invalid failing: %w", err)
+		}
+		filter.OnlyFailing = b
+	}
+	for param, v := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		s := query.Get(param)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return SnapshotFilter{}, fmt.Errorf("invalid %s: %w", param, err)
+		} else if n < 0 {
+			return SnapshotFilter{}, fmt.Errorf("invalid %s: must not be negative", param)
+		}
+		*v = n
+	}
+	if filter.Limit > maxSnapshotLimit {
+		return SnapshotFilter{}, fmt.Errorf("invalid limit: must be at most %d", maxSnapshotLimit)
+	}
+
+	return filter, nil
+}
+
+// ParseObjectKey parses the object from the query parameters "namespace" and "name"
+func ParseObjectKey(query url.Values) (client.ObjectKey, error) {
+	key := client.ObjectKey{Namespace: query.Get("namespace"), Name: query.Get("name")}
+	if key.Namespace == "" || key.Name == "" {
+		return client.ObjectKey{}, errors.New("namespace and name must both be set")
+	}
+	return key, nil
+}
+
+// ObjectSnapshot is the state of a single object in a ReconcileSnapshot
+type ObjectSnapshot struct {
+	Object string `json:"object"`
+	// Failing is whether the object is currently failing or conflicting
+	Failing       bool            `json:"failing"`
+	LastReconcile ReconcileRecord `json:"lastReconcile"`
+}
+
+// ObjectHistory is the recent reconciles of a single object by one controller
+type ObjectHistory struct {
+	ControllerName string `json:"controllerName"`
+	// History is the object's recent reconciles, oldest first
+	History []ReconcileRecord `json:"history"`
+}
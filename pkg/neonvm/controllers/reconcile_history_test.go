@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSnapshotFilter(t *testing.T) {
+	filter, err := ParseSnapshotFilter(url.Values{"namespace": {"ns"}, "limit": {"10"}, "offset": {"20"}})
+	require.NoError(t, err)
+	assert.Equal(t, SnapshotFilter{Namespace: "ns", NamePrefix: "", OnlyFailing: false, Limit: 10, Offset: 20}, filter)
+
+	_, err = ParseSnapshotFilter(url.Values{"limit": {"-1"}})
+	assert.Error(t, err)
+
+	// snapshots are capped at maxSnapshotLimit objects, so larger pages are rejected instead of
+	// silently truncated
+	_, err = ParseSnapshotFilter(url.Values{"limit": {"501"}})
+	assert.Error(t, err)
+}
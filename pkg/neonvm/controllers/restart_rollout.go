@@ -0,0 +1,115 @@
+package controllers
+
+// The restart rollout gradually restarts VMs that are RestartPending (see vm_controller_restart.go),
+// limiting how many are restarting at any time, similar to a Deployment's maxUnavailable.
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/record"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// RestartRollout periodically allows RestartPending VMs to restart, up to MaxUnavailable at a time.
+//
+// RestartRollout implements manager.Runnable. It only runs on the leader.
+type RestartRollout struct {
+	Client   client.Client
+	Recorder record.EventRecorder
+
+	// MaxUnavailable is the maximum number of VMs that may be restarting at once.
+	MaxUnavailable int
+	// Interval is how often to check for VMs that can be restarted.
+	Interval time.Duration
+}
+
+func (r *RestartRollout) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("restart-rollout")
+	ctx = log.IntoContext(ctx, logger)
+
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.rolloutOnce(ctx); err != nil {
+			logger.Error(err, "Failed to roll out VM restarts")
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *RestartRollout) rolloutOnce(ctx context.Context) error {
+	log := log.FromContext(ctx)
+
+	var vms vmv1.VirtualMachineList
+	if err := r.Client.List(ctx, &vms); err != nil {
+		return fmt.Errorf("failed to list VMs: %w", err)
+	}
+
+	restarting := 0
+	var pending []*vmv1.VirtualMachine
+	for i := range vms.Items {
+		vm := &vms.Items[i]
+		if !vm.DeletionTimestamp.IsZero() ||
+			!meta.IsStatusConditionTrue(vm.Status.Conditions, typeRestartPendingVirtualMachine) {
+			continue
+		}
+
+		// VMs stay RestartPending until they're running again with a new pod, so the ones that
+		// were allowed to restart are still unavailable until then -- including while they don't
+		// have a pod at all.
+		_, wasRequested := vm.Annotations[vmv1.VirtualMachineRestartRequestedAnnotation]
+		if restartRequested(vm) || (wasRequested && vm.Status.Phase != vmv1.VmRunning) {
+			restarting += 1
+		} else if vm.Status.Phase == vmv1.VmRunning {
+			pending = append(pending, vm)
+		}
+	}
+
+	budget := r.MaxUnavailable - restarting
+	if budget <= 0 || len(pending) == 0 {
+		return nil
+	}
+
+	// Restart the VMs that have been waiting the longest first.
+	slices.SortFunc(pending, func(a, b *vmv1.VirtualMachine) int {
+		aCond := meta.FindStatusCondition(a.Status.Conditions, typeRestartPendingVirtualMachine)
+		bCond := meta.FindStatusCondition(b.Status.Conditions, typeRestartPendingVirtualMachine)
+		if c := aCond.LastTransitionTime.Compare(bCond.LastTransitionTime.Time); c != 0 {
+			return c
+		}
+		return strings.Compare(client.ObjectKeyFromObject(a).String(), client.ObjectKeyFromObject(b).String())
+	})
+
+	for _, vm := range pending[:min(budget, len(pending))] {
+		log.Info("Allowing VM to restart to apply spec changes", "VirtualMachine", client.ObjectKeyFromObject(vm))
+
+		patch := client.MergeFromWithOptions(vm.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		if vm.Annotations == nil {
+			vm.Annotations = make(map[string]string)
+		}
+		vm.Annotations[vmv1.VirtualMachineRestartRequestedAnnotation] = vm.Status.PodName
+		if err := r.Client.Patch(ctx, vm, patch); err != nil {
+			// The VM may have changed since we listed it; it'll be picked up next time if it's
+			// still pending.
+			return fmt.Errorf("failed to request restart for VM %s: %w", client.ObjectKeyFromObject(vm), err)
+		}
+		r.Recorder.Event(vm, "Normal", "RestartScheduled", "VM is allowed to restart to apply spec changes")
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+func TestHandleRestartPending(t *testing.T) {
+	params := newTestParams(t)
+	vm := params.initVM(defaultVm())
+	vm.Status.PodName = "test-vm-runner"
+
+	runner := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-vm-runner",
+			Namespace:   vm.Namespace,
+			Annotations: map[string]string{vmv1.RunnerPodBootConfigAnnotation: bootConfigHash(vm)},
+		},
+	}
+	require.NoError(t, params.client.Create(params.ctx, runner))
+
+	// Nothing to do while the boot config matches
+	restarting, err := params.r.handleRestartPending(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.False(t, restarting)
+	assert.False(t, meta.IsStatusConditionTrue(vm.Status.Conditions, typeRestartPendingVirtualMachine))
+
+	params.mockRecorder.On("Event", mock.Anything, "Normal", "RestartPending", mock.Anything)
+	params.mockRecorder.On("Event", mock.Anything, "Normal", "Restarting", mock.Anything)
+	params.mockRecorder.On("Event", mock.Anything, "Normal", "Deleted", mock.Anything)
+
+	// Changing the kernel command line marks the VM as RestartPending, but doesn't restart it yet
+	vm.Spec.Guest.AppendKernelCmdline = lo.ToPtr("foo=bar")
+	restarting, err = params.r.handleRestartPending(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.False(t, restarting)
+	assert.True(t, meta.IsStatusConditionTrue(vm.Status.Conditions, typeRestartPendingVirtualMachine))
+
+	// Once the restart is requested, the runner pod is deleted
+	vm.Annotations = map[string]string{vmv1.VirtualMachineRestartRequestedAnnotation: runner.Name}
+	restarting, err = params.r.handleRestartPending(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.True(t, restarting)
+	assert.Equal(t, vmv1.VmSucceeded, vm.Status.Phase)
+	err = params.client.Get(params.ctx, client.ObjectKeyFromObject(runner), &corev1.Pod{})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// Older runners without the annotation are never marked as RestartPending
+	delete(runner.Annotations, vmv1.RunnerPodBootConfigAnnotation)
+	restarting, err = params.r.handleRestartPending(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.False(t, restarting)
+	assert.False(t, meta.IsStatusConditionTrue(vm.Status.Conditions, typeRestartPendingVirtualMachine))
+}
+
+func TestHandleRestartPendingMachineType(t *testing.T) {
+	params := newTestParams(t)
+	vm := params.initVM(defaultVm())
+	vm.Status.PodName = "test-vm-runner"
+
+	runner := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-vm-runner",
+			Namespace:   vm.Namespace,
+			Annotations: map[string]string{vmv1.RunnerPodBootConfigAnnotation: bootConfigHash(vm)},
+		},
+	}
+	require.NoError(t, params.client.Create(params.ctx, runner))
+
+	// Explicitly setting the default machine type is not a change
+	vm.Spec.MachineType = lo.ToPtr(vmv1.MachineTypeStandard)
+	restarting, err := params.r.handleRestartPending(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.False(t, restarting)
+	assert.False(t, meta.IsStatusConditionTrue(vm.Status.Conditions, typeRestartPendingVirtualMachine))
+
+	params.mockRecorder.On("Event", mock.Anything, "Normal", "RestartPending", mock.Anything)
+
+	// Changing the machine type marks the VM as RestartPending
+	vm.Spec.MachineType = lo.ToPtr(vmv1.MachineTypeMicroVM)
+	restarting, err = params.r.handleRestartPending(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.False(t, restarting)
+	cond := meta.FindStatusCondition(vm.Status.Conditions, typeRestartPendingVirtualMachine)
+	require.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, "BootConfigChanged", cond.Reason)
+}
+
+func TestPodMachineType(t *testing.T) {
+	pod := func(spec vmv1.VirtualMachineSpec) *corev1.Pod {
+		specJSON, err := json.Marshal(spec)
+		require.NoError(t, err)
+		return &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{
+					Name:    runnerContainerName,
+					Command: []string{"runner", "-vmspec", base64.StdEncoding.EncodeToString(specJSON), "-vmstatus", ""},
+				}},
+			},
+		}
+	}
+
+	vm := defaultVm()
+	machineType, err := podMachineType(pod(vm.Spec))
+	require.NoError(t, err)
+	assert.Equal(t, vmv1.MachineTypeStandard, machineType)
+
+	vm.Spec.MachineType = lo.ToPtr(vmv1.MachineTypeMicroVM)
+	machineType, err = podMachineType(pod(vm.Spec))
+	require.NoError(t, err)
+	assert.Equal(t, vmv1.MachineTypeMicroVM, machineType)
+
+	_, err = podMachineType(&corev1.Pod{})
+	assert.Error(t, err)
+}
+
+func TestRestartRollout(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, vmv1.AddToScheme(scheme))
+
+	start := time.Now().Add(-time.Hour)
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for i := range 3 {
+		vm := defaultVm()
+		vm.Name = fmt.Sprintf("vm-%d", i)
+		vm.Status.Phase = vmv1.VmRunning
+		vm.Status.PodName = fmt.Sprintf("vm-%d-runner", i)
+		vm.Status.Conditions = []metav1.Condition{{
+			Type:               typeRestartPendingVirtualMachine,
+			Status:             metav1.ConditionTrue,
+			Reason:             "BootConfigChanged",
+			Message:            "",
+			LastTransitionTime: metav1.NewTime(start.Add(time.Duration(i) * time.Minute)),
+			ObservedGeneration: 0,
+		}}
+		builder = builder.WithObjects(vm)
+	}
+	c := builder.Build()
+
+	rollout := &RestartRollout{
+		Client:         c,
+		Recorder:       record.NewFakeRecorder(10),
+		MaxUnavailable: 2,
+		Interval:       time.Second,
+	}
+	ctx := context.Background()
+
+	requested := func() []string {
+		var vms vmv1.VirtualMachineList
+		require.NoError(t, c.List(ctx, &vms))
+		var names []string
+		for _, vm := range vms.Items {
+			if _, ok := vm.Annotations[vmv1.VirtualMachineRestartRequestedAnnotation]; ok {
+				names = append(names, vm.Name)
+			}
+		}
+		return names
+	}
+
+	// The VMs that have been pending the longest are restarted first
+	require.NoError(t, rollout.rolloutOnce(ctx))
+	assert.ElementsMatch(t, []string{"vm-0", "vm-1"}, requested())
+
+	// No more are restarted while those are still restarting
+	require.NoError(t, rollout.rolloutOnce(ctx))
+	assert.ElementsMatch(t, []string{"vm-0", "vm-1"}, requested())
+
+	// Once one has finished restarting, the next one is allowed to restart
+	var vm vmv1.VirtualMachine
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "vm-0"}, &vm))
+	meta.RemoveStatusCondition(&vm.Status.Conditions, typeRestartPendingVirtualMachine)
+	require.NoError(t, c.Update(ctx, &vm))
+
+	require.NoError(t, rollout.rolloutOnce(ctx))
+	assert.ElementsMatch(t, []string{"vm-0", "vm-1", "vm-2"}, requested())
+
+	// A VM that came back with a new pod but still needs restarting is allowed to restart again,
+	// for the new pod
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "vm-1"}, &vm))
+	vm.Status.PodName = "vm-1-runner-new"
+	require.NoError(t, c.Update(ctx, &vm))
+
+	require.NoError(t, rollout.rolloutOnce(ctx))
+	require.NoError(t, c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "vm-1"}, &vm))
+	assert.Equal(t, "vm-1-runner-new", vm.Annotations[vmv1.VirtualMachineRestartRequestedAnnotation])
+}
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// syncRunnerClock asks the VM's runner to set the guest's clock from the host's.
+func syncRunnerClock(ctx context.Context, vm *vmv1.VirtualMachine) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s/clock_sync", runnerAddr(vm))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("syncRunnerClock: unexpected status %s", resp.Status)
+	}
+	return nil
+}
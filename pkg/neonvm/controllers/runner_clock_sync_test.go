@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// fakeRunner starts a fake runner HTTP server that responds to /clock_sync with the status, and
+// points the VM at it. It returns a channel that receives the method of each /clock_sync request.
+func fakeRunner(t *testing.T, vm *vmv1.VirtualMachine, status int) <-chan string {
+	requests := make(chan string, 10)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/clock_sync", func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.Method
+		w.WriteHeader(status)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	host, port, err := net.SplitHostPort(u.Host)
+	require.NoError(t, err)
+	portNum, err := strconv.Atoi(port)
+	require.NoError(t, err)
+
+	vm.Status.PodIP = host
+	vm.Spec.RunnerPort = int32(portNum)
+	return requests
+}
+
+func TestSyncRunnerClock(t *testing.T) {
+	ctx := context.Background()
+
+	vm := defaultVm()
+	requests := fakeRunner(t, vm, http.StatusOK)
+	require.NoError(t, syncRunnerClock(ctx, vm))
+	require.Len(t, requests, 1)
+	assert.Equal(t, "POST", <-requests)
+
+	vm = defaultVm()
+	fakeRunner(t, vm, http.StatusInternalServerError)
+	assert.ErrorContains(t, syncRunnerClock(ctx, vm), "unexpected status 500")
+}
@@ -0,0 +1,167 @@
+package controllers
+
+// Tracing for reconciles, so that it's possible to tell where the time in a slow reconcile went.
+//
+// Each reconcile gets a span (see wrappedReconciler), with child spans for API server requests (see
+// WithTracing), QMP operations (see traceQMP), and HTTP requests to runners (see httpClient).
+//
+// Spans are only exported if a global TracerProvider is set up, which the controller does when
+// given an OTLP endpoint. Otherwise, they're no-ops.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var tracer = otel.Tracer("github.com/neondatabase/autoscaling/pkg/neonvm/controllers")
+
+// httpClient is the client for HTTP requests made while reconciling, e.g. to runners. It creates a
+// span for each request, and counts it towards the reconcile's breakdown.
+var httpClient = &http.Client{
+	Transport: otelhttp.NewTransport(
+		breakdownTransport{next: http.DefaultTransport},
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return fmt.Sprintf("HTTP %s %s", r.Method, r.URL.Path)
+		}),
+	),
+}
+
+// endSpan ends the span, marking it as failed if err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceQMP starts a span for the QMP operation, as a child of the span in ctx.
+//
+// The returned function ends the span, and must be called with the operation's error. It also logs
+// the operation at debug level, under the "qmp" logger.
+func traceQMP(ctx context.Context, op string) func(err error) {
+	start := time.Now()
+	_, span := tracer.Start(ctx, "QMP "+op)
+	return func(err error) {
+		endSpan(span, err)
+		getReconcileBreakdown(ctx).addQMP(start)
+		log.FromContext(ctx).WithName("qmp").V(1).Info("QMP operation finished",
+			"op", op, "duration", time.Since(start).String(), "error", err)
+	}
+}
+
+// WithTracing wraps the client so that each request to the API server creates a span, and is
+// counted towards the reconcile's breakdown.
+func WithTracing(c client.Client) client.Client {
+	return tracingClient{Client: c}
+}
+
+type tracingClient struct {
+	client.Client
+}
+
+type tracingStatusWriter struct {
+	client.SubResourceWriter
+}
+
+// kindOf returns the name of the object's type, e.g. "Pod". The GroupVersionKind isn't used
+// because it's usually not set on typed objects.
+func kindOf(obj runtime.Object) string {
+	t := reflect.TypeOf(obj)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+func startObjectSpan(ctx context.Context, verb string, obj client.Object) (context.Context, trace.Span) {
+	return tracer.Start(ctx, fmt.Sprintf("k8s %s %s", verb, kindOf(obj)), trace.WithAttributes(
+		attribute.String("k8s.namespace", obj.GetNamespace()),
+		attribute.String("k8s.name", obj.GetName()),
+	))
+}
+
+func (c tracingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	defer getReconcileBreakdown(ctx).addAPI(time.Now())
+	ctx, span := tracer.Start(ctx, fmt.Sprintf("k8s get %s", kindOf(obj)), trace.WithAttributes(
+		attribute.String("k8s.namespace", key.Namespace),
+		attribute.String("k8s.name", key.Name),
+	))
+	err := c.Client.Get(ctx, key, obj, opts...)
+	// not found is an expected result, rather than a failure
+	endSpan(span, client.IgnoreNotFound(err))
+	return err
+}
+
+func (c tracingClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	defer getReconcileBreakdown(ctx).addAPI(time.Now())
+	ctx, span := tracer.Start(ctx, fmt.Sprintf("k8s list %s", kindOf(list)))
+	err := c.Client.List(ctx, list, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c tracingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	defer getReconcileBreakdown(ctx).addAPI(time.Now())
+	ctx, span := startObjectSpan(ctx, "create", obj)
+	err := c.Client.Create(ctx, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c tracingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	defer getReconcileBreakdown(ctx).addAPI(time.Now())
+	ctx, span := startObjectSpan(ctx, "delete", obj)
+	err := c.Client.Delete(ctx, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c tracingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	defer getReconcileBreakdown(ctx).addAPI(time.Now())
+	ctx, span := startObjectSpan(ctx, "update", obj)
+	err := c.Client.Update(ctx, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c tracingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	defer getReconcileBreakdown(ctx).addAPI(time.Now())
+	ctx, span := startObjectSpan(ctx, "patch", obj)
+	err := c.Client.Patch(ctx, obj, patch, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (c tracingClient) Status() client.SubResourceWriter {
+	return tracingStatusWriter{SubResourceWriter: c.Client.Status()}
+}
+
+func (w tracingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+	defer getReconcileBreakdown(ctx).addAPI(time.Now())
+	ctx, span := startObjectSpan(ctx, "update status", obj)
+	err := w.SubResourceWriter.Update(ctx, obj, opts...)
+	endSpan(span, err)
+	return err
+}
+
+func (w tracingStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+	defer getReconcileBreakdown(ctx).addAPI(time.Now())
+	ctx, span := startObjectSpan(ctx, "patch status", obj)
+	err := w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+	endSpan(span, err)
+	return err
+}
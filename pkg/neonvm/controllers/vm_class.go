@@ -0,0 +1,61 @@
+package controllers
+
+// Handling for the VirtualMachineClass that a VM may reference with .spec.className
+
+import (
+	"context"
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// getVMClass fetches the VirtualMachineClass referenced by the VM. The VM must have a class.
+func getVMClass(ctx context.Context, c client.Reader, vm *vmv1.VirtualMachine) (*vmv1.VirtualMachineClass, error) {
+	var class vmv1.VirtualMachineClass
+	if err := c.Get(ctx, client.ObjectKey{Name: vm.Spec.ClassName}, &class); err != nil {
+		return nil, fmt.Errorf("failed to get VirtualMachineClass %q: %w", vm.Spec.ClassName, err)
+	}
+	return &class, nil
+}
+
+// runnerConfigForVM returns the config to use for creating a new runner pod for the VM, with the
+// settings from the VM's class applied on top of the controller's, if the VM has a class.
+//
+// The class is read each time a runner pod is created, so that changes to it take effect without
+// needing to update the VMs that reference it.
+//
+// If the class has since been deleted, the controller's config is used as-is, with a warning event
+// on the VM, so that existing VMs can still be restarted or migrated.
+func runnerConfigForVM(
+	ctx context.Context,
+	c client.Reader,
+	recorder record.EventRecorder,
+	config *ReconcilerConfig,
+	vm *vmv1.VirtualMachine,
+) (*ReconcilerConfig, error) {
+	if vm.Spec.ClassName == "" {
+		return config, nil
+	}
+
+	class, err := getVMClass(ctx, c, vm)
+	if apierrors.IsNotFound(err) {
+		log.FromContext(ctx).Info("VirtualMachineClass not found, using default config", "VirtualMachineClass", vm.Spec.ClassName)
+		recorder.Eventf(vm, corev1.EventTypeWarning, "VMClassNotFound",
+			"VirtualMachineClass %q not found, using the controller's default settings", vm.Spec.ClassName)
+		return config, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	withClass := *config
+	withClass.QEMUDiskCacheSettings = class.Spec.GetDiskCacheSettings(config.QEMUDiskCacheSettings)
+	withClass.MemhpAutoMovableRatio = class.Spec.GetMemhpAutoMovableRatio(config.MemhpAutoMovableRatio)
+	return &withClass, nil
+}
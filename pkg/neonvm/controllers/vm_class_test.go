@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+func testVMClass() *vmv1.VirtualMachineClass {
+	return &vmv1.VirtualMachineClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "standard"},
+		Spec: vmv1.VirtualMachineClassSpec{
+			Bounds: &vmv1.VirtualMachineClassBounds{
+				CPUPerCU:         1000,
+				MemorySlotSize:   resource.MustParse("1Gi"),
+				MemorySlotsPerCU: 4,
+				MinCU:            1,
+				MaxCU:            4,
+			},
+			Memory:            &vmv1.VirtualMachineClassMemory{MemhpAutoMovableRatio: lo.ToPtr("801")},
+			DiskCacheSettings: lo.ToPtr("cache=writeback"),
+			CPUClass:          nil,
+		},
+	}
+}
+
+func newVMClassClient(t *testing.T, objs ...*vmv1.VirtualMachineClass) *fake.ClientBuilder {
+	scheme := runtime.NewScheme()
+	require.NoError(t, vmv1.AddToScheme(scheme))
+
+	builder := fake.NewClientBuilder().WithScheme(scheme)
+	for _, obj := range objs {
+		builder = builder.WithObjects(obj)
+	}
+	return builder
+}
+
+func TestVMWebhookDefaultWithClass(t *testing.T) {
+	//nolint:exhaustruct // Only the client is used
+	w := &VMWebhook{Client: newVMClassClient(t, testVMClass()).Build()}
+
+	withOperation := func(op admissionv1.Operation) context.Context {
+		//nolint:exhaustruct // Only the operation is used
+		req := admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{Operation: op}}
+		return admission.NewContextWithRequest(context.Background(), req)
+	}
+
+	vm := defaultVm()
+	vm.Spec.ClassName = "standard"
+	vm.Spec.Guest.CPUs = vmv1.CPUs{Min: 0, Max: 0, Use: 0}
+	vm.Spec.Guest.MemorySlots = vmv1.MemorySlots{Min: 0, Max: 0, Use: 0}
+	vm.Spec.Guest.MemorySlotSize = resource.Quantity{}
+
+	require.NoError(t, w.Default(withOperation(admissionv1.Create), vm))
+	assert.Equal(t, vmv1.CPUs{Min: 1000, Max: 4000, Use: 1000}, vm.Spec.Guest.CPUs)
+	assert.Equal(t, vmv1.MemorySlots{Min: 4, Max: 16, Use: 4}, vm.Spec.Guest.MemorySlots)
+	assert.Equal(t, vmv1.CPUClassShared, *vm.Spec.CPUClass)
+
+	// Missing classes are rejected on creation, but don't block updates to existing VMs
+	vm.Spec.ClassName = "missing"
+	assert.Error(t, w.Default(withOperation(admissionv1.Create), vm))
+	assert.NoError(t, w.Default(withOperation(admissionv1.Update), vm))
+}
+
+func TestRunnerConfigForVM(t *testing.T) {
+	c := newVMClassClient(t, testVMClass()).Build()
+	//nolint:exhaustruct // Only these fields are used
+	config := &ReconcilerConfig{
+		QEMUDiskCacheSettings: "cache=none",
+		MemhpAutoMovableRatio: "301",
+	}
+	recorder := record.NewFakeRecorder(1)
+
+	vm := defaultVm()
+	cfg, err := runnerConfigForVM(context.Background(), c, recorder, config, vm)
+	require.NoError(t, err)
+	assert.Same(t, config, cfg)
+
+	vm.Spec.ClassName = "standard"
+	cfg, err = runnerConfigForVM(context.Background(), c, recorder, config, vm)
+	require.NoError(t, err)
+	assert.Equal(t, "cache=writeback", cfg.QEMUDiskCacheSettings)
+	assert.Equal(t, "801", cfg.MemhpAutoMovableRatio)
+	// The controller's config is left unchanged
+	assert.Equal(t, "cache=none", config.QEMUDiskCacheSettings)
+
+	// Deleted classes fall back to the controller's config, with a warning
+	vm.Spec.ClassName = "missing"
+	cfg, err = runnerConfigForVM(context.Background(), c, recorder, config, vm)
+	require.NoError(t, err)
+	assert.Same(t, config, cfg)
+	assert.Equal(t,
+		`Warning VMClassNotFound VirtualMachineClass "missing" not found, using the controller's default settings`,
+		<-recorder.Events,
+	)
+}
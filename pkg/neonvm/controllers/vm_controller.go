@@ -26,12 +26,15 @@ import (
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	certv1 "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
+	"github.com/go-logr/logr"
 	nadapiv1 "github.com/k8snetworkplumbingwg/network-attachment-definition-client/pkg/apis/k8s.cni.cncf.io/v1"
 	"github.com/samber/lo"
 	"golang.org/x/crypto/ssh"
@@ -69,11 +72,26 @@ const (
 	typeAvailableVirtualMachine = "Available"
 	// typeDegradedVirtualMachine represents the status used when the custom resource is deleted and the finalizer operations are must to occur.
 	typeDegradedVirtualMachine = "Degraded"
+	// typeSchedulerDeniedVirtualMachine represents whether the scheduler plugin denied the
+	// autoscaler-agent's most recent request for the VM, as reported by the agent.
+	typeSchedulerDeniedVirtualMachine = "SchedulerDenied"
+	// typeRestartPendingVirtualMachine represents whether the VM's spec changed in a way that
+	// requires restarting it, which hasn't happened yet.
+	typeRestartPendingVirtualMachine = "RestartPending"
+	// typeDriftedVirtualMachine represents whether the VM's runner pod differs from the one that
+	// would be created for the VM now.
+	typeDriftedVirtualMachine = "Drifted"
+	// typeOOMKilledVirtualMachine represents whether the VM's most recent runner pod was OOM-killed,
+	// and the VM hasn't yet recovered from it.
+	typeOOMKilledVirtualMachine = "OOMKilled"
+	// typeRolledBackVirtualMachine represents whether the VM was rolled back to its fallback root
+	// disk image, because .spec.guest.rootDisk.image didn't become ready in time.
+	typeRolledBackVirtualMachine = "RolledBack"
 )
 
 const (
 	minSupportedRunnerVersion api.RunnerProtoVersion = api.RunnerProtoV1
-	maxSupportedRunnerVersion api.RunnerProtoVersion = api.RunnerProtoV1
+	maxSupportedRunnerVersion api.RunnerProtoVersion = api.RunnerProtoV4
 )
 
 // VMReconciler reconciles a VirtualMachine object
@@ -99,7 +117,9 @@ type VMReconciler struct {
 //+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=pods/status,verbs=get;list;watch
 //+kubebuilder:rbac:groups=vm.neon.tech,resources=ippools,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=vm.neon.tech,resources=ipallocations,verbs=get;list;watch;create;delete
 //+kubebuilder:rbac:groups=vm.neon.tech,resources=ippools/finalizers,verbs=update
+//+kubebuilder:rbac:groups=vm.neon.tech,resources=virtualmachineclasses,verbs=get;list;watch
 //+kubebuilder:rbac:groups=k8s.cni.cncf.io,resources=network-attachment-definitions,verbs=get;list;watch
 //+kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests,verbs=get;list;watch;create;update;patch;delete
 
@@ -149,6 +169,16 @@ func (r *VMReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Re
 	} else {
 		// The object is being deleted
 		if controllerutil.ContainsFinalizer(&vm, virtualmachineFinalizer) {
+			// Wait for the guest to shut down before releasing anything it might still be using.
+			done, err := r.shutdownRunnerPod(ctx, &vm)
+			if err != nil {
+				log.Error(err, "Failed to shut down runner pod for VirtualMachine")
+				return ctrl.Result{}, err
+			}
+			if !done {
+				return ctrl.Result{RequeueAfter: time.Second}, nil
+			}
+
 			// our finalizer is present, so lets handle any external dependency
 			log.Info("Performing Finalizer Operations for VirtualMachine before delete it")
 			if err := r.doFinalizerOperationsForVirtualMachine(ctx, &vm); err != nil {
@@ -174,34 +204,17 @@ func (r *VMReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Re
 	// examine for nil values that should be defaulted
 	// this part is done for values that we want eventually explicitly override in the kube-api storage
 	// to a default value.
-	{
-		changed := false
-		// examine targetArchitecture and set it to the default value if it is not set
-		if vm.Spec.TargetArchitecture == nil {
-			log.Info("Setting default target architecture", "default", vmv1.CPUArchitectureAMD64)
-			vm.Spec.TargetArchitecture = lo.ToPtr(vmv1.CPUArchitectureAMD64)
-			changed = true
-		}
-
-		// examine cpuScalingMode and set it to the default value if it is not set
-		if vm.Spec.CpuScalingMode == nil {
-			log.Info("Setting default CPU scaling mode", "default", r.Config.DefaultCPUScalingMode)
-			vm.Spec.CpuScalingMode = lo.ToPtr(r.Config.DefaultCPUScalingMode)
-			changed = true
-		}
-
-		if changed {
-			if err := r.tryUpdateVM(ctx, &vm); err != nil {
-				log.Error(err, "Failed to set default values for VirtualMachine")
-				return ctrl.Result{}, err
-			}
-			return ctrl.Result{Requeue: true}, nil
+	if changed := setSpecDefaults(log, &vm, r.Config); changed {
+		if err := r.tryUpdateVM(ctx, &vm); err != nil {
+			log.Error(err, "Failed to set default values for VirtualMachine")
+			return ctrl.Result{}, err
 		}
+		return ctrl.Result{Requeue: true}, nil
 	}
 
 	statusBefore := vm.Status.DeepCopy()
 	if err := r.doReconcile(ctx, &vm); err != nil {
-		r.Recorder.Eventf(&vm, corev1.EventTypeWarning, "Failed",
+		r.Recorder.Eventf(&vm, corev1.EventTypeWarning, ErrorKindOf(err).EventReason(),
 			"Failed to reconcile (%s): %s", vm.Name, err)
 		if errors.Is(err, ipam.ErrAgain) {
 			return ctrl.Result{RequeueAfter: time.Second}, nil
@@ -228,6 +241,80 @@ func (r *VMReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Re
 	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
+// setSpecDefaults sets the defaults for any unset fields of the VM's spec that are stored
+// explicitly, returning whether anything changed.
+//
+// Some defaults can only be set before the VM has a runner pod, because they'd break migrating
+// away from a pod that was started without them. Resume pools also use this to define their
+// template VMs the same way as the VMs that resume from them.
+func setSpecDefaults(log logr.Logger, vm *vmv1.VirtualMachine, config *ReconcilerConfig) bool {
+	changed := false
+	// examine targetArchitecture and set it to the default value if it is not set
+	if vm.Spec.TargetArchitecture == nil {
+		log.Info("Setting default target architecture", "default", vmv1.CPUArchitectureAMD64)
+		vm.Spec.TargetArchitecture = lo.ToPtr(vmv1.CPUArchitectureAMD64)
+		changed = true
+	}
+
+	// examine cpuScalingMode and set it to the default value if it is not set
+	if vm.Spec.CpuScalingMode == nil {
+		log.Info("Setting default CPU scaling mode", "default", config.DefaultCPUScalingMode)
+		vm.Spec.CpuScalingMode = lo.ToPtr(config.DefaultCPUScalingMode)
+		changed = true
+	}
+
+	// examine cpuClass and set it to the default value if it is not set
+	if vm.Spec.CPUClass == nil {
+		log.Info("Setting default CPU class", "default", vmv1.CPUClassShared)
+		vm.Spec.CPUClass = lo.ToPtr(vmv1.CPUClassShared)
+		changed = true
+	}
+
+	// examine entropy and set it to the default value if it is not set -- but only before the
+	// VM has a runner pod, because adding the device would break migrating the VM away from
+	// a pod that was started without it.
+	if vm.Spec.Entropy == nil && vm.Status.PodName == "" {
+		log.Info("Setting default entropy source", "default", vmv1.EntropySourceURandom)
+		vm.Spec.Entropy = &vmv1.Entropy{
+			Enabled: lo.ToPtr(true),
+			Source:  vmv1.EntropySourceURandom,
+		}
+		changed = true
+	}
+
+	// examine the virtio-mem block size and set it to the default value if it is not set. As
+	// with entropy, this can't change once there's a runner pod, because the block size is
+	// fixed when QEMU starts.
+	if vm.Spec.Guest.VirtioMemBlockSize == nil && vm.Status.PodName == "" {
+		blockSize := virtioMemBlockSizeFor(config.VirtioMemBlockSize, vm.Spec.Guest.MemorySlotSize)
+		log.Info("Setting default virtio-mem block size", "default", blockSize)
+		vm.Spec.Guest.VirtioMemBlockSize = &blockSize
+		changed = true
+	}
+
+	return changed
+}
+
+// podTerminationGracePeriod returns the termination grace period for the VM's runner pod, which
+// leaves the runner time to escalate the shutdown after the VM's own grace period has run out.
+//
+// If the VM doesn't set a grace period, the escalation time is added to the default for pods.
+func podTerminationGracePeriod(vm *vmv1.VirtualMachine) *int64 {
+	gracePeriod := lo.FromPtrOr(vm.Spec.TerminationGracePeriodSeconds, corev1.DefaultTerminationGracePeriodSeconds)
+	return lo.ToPtr(gracePeriod + vmv1.ShutdownEscalationSeconds)
+}
+
+// virtioMemBlockSizeFor returns the virtio-mem block size to use by default for a VM with the
+// memory slot size, which is the configured default unless that doesn't evenly divide the slot
+// size -- in which case it's the largest power of two that does.
+func virtioMemBlockSizeFor(def resource.Quantity, slotSize resource.Quantity) resource.Quantity {
+	slot := slotSize.Value()
+	if largest := slot & -slot; largest != 0 && largest < def.Value() {
+		return *resource.NewQuantity(largest, resource.BinarySI)
+	}
+	return def.DeepCopy()
+}
+
 // doFinalizerOperationsForVirtualMachine will perform the required operations before delete the CR.
 func (r *VMReconciler) doFinalizerOperationsForVirtualMachine(ctx context.Context, vm *vmv1.VirtualMachine) error {
 	// Note: It is not recommended to use finalizers with the purpose of delete resources which are
@@ -238,6 +325,8 @@ func (r *VMReconciler) doFinalizerOperationsForVirtualMachine(ctx context.Contex
 
 	log := log.FromContext(ctx)
 
+	r.Metrics.ForgetScaling(vm)
+
 	// The following implementation will raise an event
 	r.Recorder.Event(vm, "Warning", "Deleting",
 		fmt.Sprintf("Custom Resource %s is being deleted from the namespace %s",
@@ -257,6 +346,15 @@ func (r *VMReconciler) doFinalizerOperationsForVirtualMachine(ctx context.Contex
 	return nil
 }
 
+// podIPs returns all of the pod's IP addresses, with the primary one first.
+func podIPs(pod *corev1.Pod) []string {
+	var ips []string
+	for _, ip := range pod.Status.PodIPs {
+		ips = append(ips, ip.IP)
+	}
+	return ips
+}
+
 func getRunnerVersion(pod *corev1.Pod) (api.RunnerProtoVersion, error) {
 	val, ok := pod.Labels[vmv1.RunnerPodVersionLabel]
 	if !ok {
@@ -334,7 +432,14 @@ func (r *VMReconciler) acquireOverlayIP(ctx context.Context, vm *vmv1.VirtualMac
 	}
 
 	log := log.FromContext(ctx)
-	ip, err := r.IPAM.AcquireIP(ctx, types.NamespacedName{Name: vm.Name, Namespace: vm.Namespace})
+	vmName := types.NamespacedName{Name: vm.Name, Namespace: vm.Namespace}
+	var ip net.IPNet
+	var err error
+	if staticIP := vm.Spec.ExtraNetwork.StaticIP; staticIP != "" {
+		ip, err = r.IPAM.AcquireStaticIP(ctx, vmName, net.ParseIP(staticIP))
+	} else {
+		ip, err = r.IPAM.AcquireIP(ctx, vmName)
+	}
 	if err != nil {
 		return err
 	}
@@ -346,6 +451,28 @@ func (r *VMReconciler) acquireOverlayIP(ctx context.Context, vm *vmv1.VirtualMac
 	return nil
 }
 
+// setSchedulerDeniedCondition updates the VM's SchedulerDenied condition to match the
+// InternalAnnotationSchedulerDenial annotation set by the autoscaler-agent.
+func setSchedulerDeniedCondition(vm *vmv1.VirtualMachine) {
+	value, ok := vm.Annotations[api.InternalAnnotationSchedulerDenial]
+	if !ok {
+		meta.RemoveStatusCondition(&vm.Status.Conditions, typeSchedulerDeniedVirtualMachine)
+		return
+	}
+
+	reason := api.DenialReason(value)
+	if !reason.IsKnown() {
+		// Condition reasons have a restricted format, so don't use the value directly.
+		reason = "Unknown"
+	}
+	meta.SetStatusCondition(&vm.Status.Conditions, metav1.Condition{
+		Type:    typeSchedulerDeniedVirtualMachine,
+		Status:  metav1.ConditionTrue,
+		Reason:  string(reason),
+		Message: fmt.Sprintf("Scheduler denied the latest request from the autoscaler-agent: %s", value),
+	})
+}
+
 func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine) error {
 	log := log.FromContext(ctx)
 
@@ -355,6 +482,8 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 		meta.SetStatusCondition(&vm.Status.Conditions, metav1.Condition{Type: typeAvailableVirtualMachine, Status: metav1.ConditionUnknown, Reason: "Reconciling", Message: "Starting reconciliation"})
 	}
 
+	setSchedulerDeniedCondition(vm)
+
 	// NB: .Spec.EnableSSH guaranteed non-nil because the k8s API server sets the default for us.
 	enableSSH := *vm.Spec.EnableSSH
 
@@ -444,23 +573,38 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 			}
 
 			// Define a new pod
-			pod, err := r.podForVirtualMachine(vm, sshSecret)
+			pod, err := r.podForVirtualMachine(ctx, vm, sshSecret)
 			if err != nil {
 				log.Error(err, "Failed to define new Pod resource for VirtualMachine")
 				return err
 			}
 
+			resumeFrom, err := r.claimResumePoolImage(ctx, vm)
+			if err != nil {
+				// Not fatal; the VM can still boot as usual.
+				log.Error(err, "Failed to claim resume pool image for VirtualMachine")
+			} else if resumeFrom != nil {
+				log.Info("Resuming from memory image", "Pod.Name", pod.Name, "template", resumeFrom.Name)
+				resumeFromPoolImage(pod, resumeFrom)
+			}
+
 			log.Info("Creating a new Pod", "Pod.Namespace", pod.Namespace, "Pod.Name", pod.Name)
 			if err = r.Create(ctx, pod); err != nil {
 				log.Error(err, "Failed to create new Pod", "Pod.Namespace", pod.Namespace, "Pod.Name", pod.Name)
-				return err
+				return fmt.Errorf("%w: %w", errRunnerPodCreation, err)
 			}
 			log.Info("Runner Pod was created", "Pod.Namespace", pod.Namespace, "Pod.Name", pod.Name)
 
+			// the new runner applies the network limits from its spec on startup
+			vm.Status.NetworkLimits = lo.ToPtr(vm.Spec.Network.GetLimits()).DeepCopy()
+
 			msg := fmt.Sprintf("VirtualMachine %s created, Pod %s", vm.Name, pod.Name)
 			if sshSecret != nil {
 				msg = fmt.Sprintf("%s, SSH Secret %s", msg, sshSecret.Name)
 			}
+			if resumeFrom != nil {
+				msg = fmt.Sprintf("%s, resuming from memory image of Pod %s", msg, resumeFrom.Name)
+			}
 			r.Recorder.Event(vm, "Normal", "Created", msg)
 			if !vm.HasRestarted() {
 				d := pod.CreationTimestamp.Time.Sub(vm.CreationTimestamp.Time)
@@ -473,7 +617,7 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 
 		// Update the metadata (including "usage" annotation) before anything else, so that it
 		// will be correctly set even if the rest of the reconcile operation fails.
-		if err := updatePodMetadataIfNecessary(ctx, r.Client, vm, vmRunner); err != nil {
+		if err := updatePodMetadataIfNecessary(ctx, r.Client, r.Config, vm, vmRunner); err != nil {
 			log.Error(err, "Failed to sync pod labels and annotations", "VirtualMachine", vm.Name)
 		}
 
@@ -481,6 +625,7 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 		switch runnerStatus(vmRunner) {
 		case runnerRunning:
 			vm.Status.PodIP = vmRunner.Status.PodIP
+			vm.Status.PodIPs = podIPs(vmRunner)
 			vm.Status.Phase = vmv1.VmRunning
 			meta.SetStatusCondition(&vm.Status.Conditions,
 				metav1.Condition{
@@ -494,6 +639,7 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 				now := time.Now()
 				d := now.Sub(vmRunner.CreationTimestamp.Time)
 				r.Metrics.runnerCreationToVMRunningTime.Observe(d.Seconds())
+				r.Metrics.ObserveVMRunning(vm, vmRunner, now)
 				if !vm.HasRestarted() {
 					d := now.Sub(vm.CreationTimestamp.Time)
 					r.Metrics.vmCreationToVMRunningTime.Observe(d.Seconds())
@@ -518,6 +664,15 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 					Reason:  "Reconciling",
 					Message: fmt.Sprintf("Pod (%s) for VirtualMachine (%s) failed", vm.Status.PodName, vm.Name),
 				})
+			r.handleOOMKill(vm, vmRunner)
+		case runnerPending:
+			// Runners for a new root disk image only become ready once the guest does, so the
+			// deadline for rolling back has to be checked while they're still pending.
+			if vmRunner.Status.Phase == corev1.PodRunning {
+				if rollingBack, err := r.handleImageRollback(ctx, vm, vmRunner); err != nil || rollingBack {
+					return err
+				}
+			}
 		default:
 			// do nothing
 		}
@@ -545,7 +700,7 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 
 		// Update the metadata (including "usage" annotation) before anything else, so that it
 		// will be correctly set even if the rest of the reconcile operation fails.
-		if err := updatePodMetadataIfNecessary(ctx, r.Client, vm, vmRunner); err != nil {
+		if err := updatePodMetadataIfNecessary(ctx, r.Client, r.Config, vm, vmRunner); err != nil {
 			log.Error(err, "Failed to sync pod labels and annotations", "VirtualMachine", vm.Name)
 		}
 
@@ -554,20 +709,37 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 		case runnerRunning:
 			// update status by IP of runner pod
 			vm.Status.PodIP = vmRunner.Status.PodIP
+			vm.Status.PodIPs = podIPs(vmRunner)
 			// update phase
 			vm.Status.Phase = vmv1.VmRunning
 			// update Node name where runner working
 			vm.Status.Node = vmRunner.Spec.NodeName
 
+			r.expireMemoryBump(vm)
+
+			// Failing to check for drift shouldn't block the rest of the reconcile, so we just
+			// keep the condition as it was.
+			if err := r.updateDriftedCondition(ctx, vm, vmRunner); err != nil {
+				log.Error(err, "Failed to check runner pod for drift", "VirtualMachine", vm.Name)
+			}
+			if rollingBack, err := r.handleImageRollback(ctx, vm, vmRunner); err != nil || rollingBack {
+				return err
+			}
+			if restarting, err := r.handleRestartPending(ctx, vm, vmRunner); err != nil || restarting {
+				return err
+			}
+
 			runnerVersion, err := getRunnerVersion(vmRunner)
 			if err != nil {
 				log.Error(err, "Failed to get runner version of VM runner pod", "VirtualMachine", vm.Name)
 				return err
 			}
 			if !runnerVersionIsSupported(runnerVersion) {
+				// This is a property of the runner pod rather than the VM's spec, and is fixed by
+				// replacing the pod (e.g. by a restart or migration), so keep retrying.
 				err := fmt.Errorf("runner version %v is not supported", runnerVersion)
 				log.Error(err, "VM runner pod has unsupported version", "VirtualMachine", vm.Name)
-				return err
+				return Transient(err)
 			}
 
 			// get cgroups CPU details from runner pod
@@ -581,14 +753,16 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 			if vm.Spec.CpuScalingMode == nil { // should not happen
 				err := fmt.Errorf("CPU scaling mode is not set")
 				log.Error(err, "Unknown CPU scaling mode", "VirtualMachine", vm.Name)
-				return err
+				return InvalidSpec(err)
 			}
 
 			switch *vm.Spec.CpuScalingMode {
-			case vmv1.CpuScalingModeSysfs:
+			case vmv1.CpuScalingModeSysfs, vmv1.CpuScalingModeCgroup:
 				pluggedCPU = cgroupUsage.VCPUs.RoundedUp()
 			case vmv1.CpuScalingModeQMP:
+				endQMP := traceQMP(ctx, "GetCpus")
 				cpuSlotsPlugged, _, err := QmpGetCpus(QmpAddr(vm))
+				endQMP(err)
 				if err != nil {
 					log.Error(err, "Failed to get CPU details from VirtualMachine", "VirtualMachine", vm.Name)
 					return err
@@ -597,14 +771,16 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 			default:
 				err := fmt.Errorf("unsupported CPU scaling mode: %s", *vm.Spec.CpuScalingMode)
 				log.Error(err, "Unknown CPU scaling mode", "VirtualMachine", vm.Name, "CPU scaling mode", *vm.Spec.CpuScalingMode)
-				return err
+				return InvalidSpec(err)
 			}
 
 			// update status by CPUs used in the VM
 			r.updateVMStatusCPU(ctx, vm, vmRunner, pluggedCPU, cgroupUsage)
 
 			// get Memory details from hypervisor and update VM status
+			endQMP := traceQMP(ctx, "GetMemorySize")
 			memorySize, err := QmpGetMemorySize(QmpAddr(vm))
+			endQMP(err)
 			if err != nil {
 				log.Error(err, "Failed to get Memory details from VirtualMachine", "VirtualMachine", vm.Name)
 				return err
@@ -624,6 +800,7 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 					"CPUs on board", pluggedCPU,
 					"CPUs in spec", vm.Spec.Guest.CPUs.Use)
 				vm.Status.Phase = vmv1.VmScaling
+				r.Metrics.ObserveScalingStarted(vm)
 			}
 
 			memorySizeFromSpec := resource.NewQuantity(int64(vm.Spec.Guest.MemorySlots.Use)*vm.Spec.Guest.MemorySlotSize.Value(), resource.BinarySI)
@@ -632,6 +809,12 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 					"Memory on board", memorySize,
 					"Memory in spec", memorySizeFromSpec)
 				vm.Status.Phase = vmv1.VmScaling
+				r.Metrics.ObserveScalingStarted(vm)
+			}
+
+			// network limits are applied directly, without going through the scaling phase.
+			if err := r.handleNetworkLimits(ctx, vm, runnerVersion); err != nil {
+				return err
 			}
 		case runnerSucceeded:
 			vm.Status.Phase = vmv1.VmSucceeded
@@ -651,6 +834,7 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 					Reason:  "Reconciling",
 					Message: fmt.Sprintf("Pod (%s) for VirtualMachine (%s) failed", vm.Status.PodName, vm.Name),
 				})
+			r.handleOOMKill(vm, vmRunner)
 		default:
 			// do nothing
 		}
@@ -679,7 +863,7 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 
 		// Update the metadata (including "usage" annotation) before anything else, so that it
 		// will be correctly set even if the rest of the reconcile operation fails.
-		if err := updatePodMetadataIfNecessary(ctx, r.Client, vm, vmRunner); err != nil {
+		if err := updatePodMetadataIfNecessary(ctx, r.Client, r.Config, vm, vmRunner); err != nil {
 			log.Error(err, "Failed to sync pod labels and annotations", "VirtualMachine", vm.Name)
 		}
 
@@ -704,6 +888,7 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 					Reason:  "Reconciling",
 					Message: fmt.Sprintf("Pod (%s) for VirtualMachine (%s) failed", vm.Status.PodName, vm.Name),
 				})
+			r.handleOOMKill(vm, vmRunner)
 			return nil
 		default:
 			// do nothing
@@ -717,7 +902,7 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 		if !runnerVersionIsSupported(runnerVersion) {
 			err := fmt.Errorf("runner version %v is not supported", runnerVersion)
 			log.Error(err, "VM runner pod has unsupported version", "VirtualMachine", vm.Name)
-			return err
+			return Transient(err)
 		}
 
 		cpuScaled, err := r.handleCPUScaling(ctx, vm, vmRunner)
@@ -728,7 +913,7 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 		ramScaled := false
 
 		// do hotplug/unplug Memory
-		ramScaled, err = r.doVirtioMemScaling(vm)
+		ramScaled, err = r.doVirtioMemScaling(ctx, vm)
 		if err != nil {
 			return err
 		}
@@ -736,6 +921,7 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 		// set VM phase to running if everything scaled
 		if cpuScaled && ramScaled {
 			vm.Status.Phase = vmv1.VmRunning
+			r.Metrics.ObserveScalingFinished(vm)
 		}
 
 	case vmv1.VmSucceeded, vmv1.VmFailed:
@@ -758,6 +944,9 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 		// However, this opens up a possibility for cascading failures where the pods would be constantly
 		// recreated, and then stuck deleting. That's why we have AtMostOnePod.
 		if !r.Config.AtMostOnePod || apierrors.IsNotFound(err) {
+			// Check before cleaning up, because the restart is requested for this particular pod.
+			requested := restartRequested(vm) || rollbackRequested(vm)
+
 			// NB: Cleanup() leaves status .Phase and .RestartCount (+ some others) but unsets other fields.
 			vm.Cleanup()
 
@@ -770,6 +959,9 @@ func (r *VMReconciler) doReconcile(ctx context.Context, vm *vmv1.VirtualMachine)
 			case vmv1.RestartPolicyNever:
 				shouldRestart = false
 			}
+			// restarts for spec changes and rollbacks always come back up, even if the policy
+			// wouldn't restart after the runner exits by itself.
+			shouldRestart = shouldRestart || requested
 
 			if shouldRestart {
 				log.Info("Restarting VM runner pod", "VM.Phase", vm.Status.Phase, "RestartPolicy", vm.Spec.RestartPolicy)
@@ -805,11 +997,13 @@ func propagateRevision(vm *vmv1.VirtualMachine) {
 	vm.Status.CurrentRevision = &rev
 }
 
-func (r *VMReconciler) doVirtioMemScaling(vm *vmv1.VirtualMachine) (done bool, _ error) {
+func (r *VMReconciler) doVirtioMemScaling(ctx context.Context, vm *vmv1.VirtualMachine) (done bool, _ error) {
 	targetSlotCount := int(vm.Spec.Guest.MemorySlots.Use - vm.Spec.Guest.MemorySlots.Min)
 
 	targetVirtioMemSize := int64(targetSlotCount) * vm.Spec.Guest.MemorySlotSize.Value()
+	endQMP := traceQMP(ctx, "SetVirtioMem")
 	previousTarget, err := QmpSetVirtioMem(vm, targetVirtioMemSize)
+	endQMP(err)
 	if err != nil {
 		return false, err
 	}
@@ -831,7 +1025,9 @@ func (r *VMReconciler) doVirtioMemScaling(vm *vmv1.VirtualMachine) (done bool, _
 	// Maybe we're already using the amount we want?
 	// Update the status to reflect the current size - and if it matches goalTotalSize, ram
 	// scaling is done.
+	endQMP = traceQMP(ctx, "GetMemorySize")
 	currentTotalSize, err := QmpGetMemorySize(QmpAddr(vm))
+	endQMP(err)
 	if err != nil {
 		return false, err
 	}
@@ -880,6 +1076,9 @@ func runnerStatus(pod *corev1.Pod) runnerStatusKind {
 
 const (
 	runnerContainerName = "neonvm-runner"
+	// rootDiskContainerName is the name of the init container that copies the root disk out of
+	// the VM's root disk image.
+	rootDiskContainerName = "init"
 )
 
 // runnerContainerStatus returns status of the runner container.
@@ -888,6 +1087,12 @@ func runnerContainerStatus(pod *corev1.Pod) runnerStatusKind {
 	if len(pod.Status.ContainerStatuses) == 0 {
 		return runnerPending
 	}
+	// if the runner container ran out of memory, the VM is gone, even if the rest of the pod is
+	// still running
+	if oom, _ := runnerOOMKilled(pod); oom {
+		return runnerFailed
+	}
+
 	_, role, ownedByMigration := vmv1.MigrationOwnerForPod(pod)
 
 	// if a target pod for a migration, we consider the pod running
@@ -939,7 +1144,13 @@ func (r *VMReconciler) deleteRunnerPodIfEnabled(
 //
 // The reason we also need to delete unrecognized labels/annotations is so that if a
 // label/annotation on the VM itself is deleted, we can accurately reflect that in the pod.
-func updatePodMetadataIfNecessary(ctx context.Context, c client.Client, vm *vmv1.VirtualMachine, runnerPod *corev1.Pod) error {
+func updatePodMetadataIfNecessary(
+	ctx context.Context,
+	c client.Client,
+	config *ReconcilerConfig,
+	vm *vmv1.VirtualMachine,
+	runnerPod *corev1.Pod,
+) error {
 	log := log.FromContext(ctx)
 
 	var patches []patch.Operation
@@ -948,12 +1159,14 @@ func updatePodMetadataIfNecessary(ctx context.Context, c client.Client, vm *vmv1
 		metaField   string
 		expected    map[string]string
 		actual      map[string]string
+		propagated  []string
 		ignoreExtra map[string]bool // use bool here so `if ignoreExtra[key] { ... }` works
 	}{
 		{
-			metaField: "labels",
-			expected:  labelsForVirtualMachine(vm, nil), // don't include runner version
-			actual:    runnerPod.Labels,
+			metaField:  "labels",
+			expected:   labelsForVirtualMachine(vm, nil, config.propagatedLabels()), // don't include runner version
+			actual:     runnerPod.Labels,
+			propagated: config.propagatedLabels(),
 			ignoreExtra: map[string]bool{
 				// Don't override the runner pod version - we need to keep it around without
 				// changing it; otherwise it's not useful!
@@ -961,10 +1174,13 @@ func updatePodMetadataIfNecessary(ctx context.Context, c client.Client, vm *vmv1
 			},
 		},
 		{
-			metaField: "annotations",
-			expected:  annotationsForVirtualMachine(vm),
-			actual:    runnerPod.Annotations,
+			metaField:  "annotations",
+			expected:   annotationsForVirtualMachine(vm, config.PropagatedAnnotations),
+			actual:     runnerPod.Annotations,
+			propagated: config.PropagatedAnnotations,
 			ignoreExtra: map[string]bool{
+				// Like the runner version, this describes the pod and must stay as it was created.
+				vmv1.RunnerPodBootConfigAnnotation:   true,
 				"k8s.v1.cni.cncf.io/networks":        true,
 				"k8s.v1.cni.cncf.io/network-status":  true,
 				"k8s.v1.cni.cncf.io/networks-status": true,
@@ -999,10 +1215,11 @@ func updatePodMetadataIfNecessary(ctx context.Context, c client.Client, vm *vmv1
 			}
 		}
 
-		// Remove the entries we aren't expecting to be there
+		// Remove the entries we aren't expecting to be there, unless they're outside of what we
+		// propagate from the VM, in which case they're managed by someone else.
 		var removed []string
 		for k := range spec.actual {
-			if _, expected := spec.expected[k]; !expected && !spec.ignoreExtra[k] {
+			if _, expected := spec.expected[k]; !expected && !spec.ignoreExtra[k] && isPropagatedKey(spec.propagated, k) {
 				removed = append(removed, k)
 				patches = append(patches, patch.Operation{
 					Op:   patch.OpRemove,
@@ -1096,10 +1313,16 @@ func extractVirtualMachineOvercommitSettingsJSON(spec vmv1.VirtualMachineSpec) *
 
 // podForVirtualMachine returns a VirtualMachine Pod object
 func (r *VMReconciler) podForVirtualMachine(
+	ctx context.Context,
 	vm *vmv1.VirtualMachine,
 	sshSecret *corev1.Secret,
 ) (*corev1.Pod, error) {
-	pod, err := podSpec(vm, sshSecret, r.Config)
+	config, err := runnerConfigForVM(ctx, r.Client, r.Recorder, r.Config, vm)
+	if err != nil {
+		return nil, err
+	}
+
+	pod, err := podSpec(vm, sshSecret, config)
 	if err != nil {
 		return nil, err
 	}
@@ -1208,12 +1431,36 @@ func (r *VMReconciler) certSecretForVirtualMachine(
 	return secret, nil
 }
 
+// isPropagatedKey returns whether the VM's label or annotation with the key should be copied to
+// its runner pods, given the patterns from ReconcilerConfig.PropagatedLabels or
+// PropagatedAnnotations.
+func isPropagatedKey(propagated []string, key string) bool {
+	if propagated == nil {
+		return true
+	}
+	if domain, _, ok := strings.Cut(key, "/"); ok && (domain == "neon.tech" || strings.HasSuffix(domain, ".neon.tech")) {
+		return true
+	}
+	for _, p := range propagated {
+		if prefix, isPrefix := strings.CutSuffix(p, "*"); isPrefix {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == p {
+			return true
+		}
+	}
+	return false
+}
+
 // labelsForVirtualMachine returns the labels for selecting the resources
 // More info: https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/
-func labelsForVirtualMachine(vm *vmv1.VirtualMachine, runnerVersion *api.RunnerProtoVersion) map[string]string {
+func labelsForVirtualMachine(vm *vmv1.VirtualMachine, runnerVersion *api.RunnerProtoVersion, propagated []string) map[string]string {
 	l := make(map[string]string, len(vm.Labels)+3)
 	for k, v := range vm.Labels {
-		l[k] = v
+		if isPropagatedKey(propagated, k) {
+			l[k] = v
+		}
 	}
 
 	l["app.kubernetes.io/name"] = "NeonVM"
@@ -1221,10 +1468,85 @@ func labelsForVirtualMachine(vm *vmv1.VirtualMachine, runnerVersion *api.RunnerP
 	if runnerVersion != nil {
 		l[vmv1.RunnerPodVersionLabel] = fmt.Sprintf("%d", *runnerVersion)
 	}
+	l[vmv1.VirtualMachineCPUClassLabel] = string(lo.FromPtrOr(vm.Spec.CPUClass, vmv1.CPUClassShared))
 	return l
 }
 
-func annotationsForVirtualMachine(vm *vmv1.VirtualMachine) map[string]string {
+// runnerResourcesForVirtualMachine returns the resource requirements for the neonvm-runner
+// container.
+//
+// For VMs with a dedicated CPU class, the CPU requests and limits are both set to the whole number
+// of CPUs in .spec.guest.cpus.max, so that the kubelet's static CPU manager policy can pin the
+// runner to exclusive cores. Note that this requires the pod to have Guaranteed QoS, so memory
+// requests and limits in .spec.podResources must also be equal.
+func runnerResourcesForVirtualMachine(vm *vmv1.VirtualMachine) corev1.ResourceRequirements {
+	resources := *vm.Spec.PodResources.DeepCopy()
+	addEphemeralStorage(&resources, vm)
+	if lo.FromPtrOr(vm.Spec.CPUClass, vmv1.CPUClassShared) != vmv1.CPUClassDedicated {
+		return resources
+	}
+
+	cpus := *resource.NewQuantity(int64(vm.Spec.Guest.CPUs.Max.RoundedUp()), resource.DecimalSI)
+	if resources.Requests == nil {
+		resources.Requests = make(corev1.ResourceList)
+	}
+	if resources.Limits == nil {
+		resources.Limits = make(corev1.ResourceList)
+	}
+	resources.Requests[corev1.ResourceCPU] = cpus
+	resources.Limits[corev1.ResourceCPU] = cpus
+	return resources
+}
+
+// runtimeClassNameForVirtualMachine returns the RuntimeClass for the VM's runner pod, from the VM's
+// spec or the controller's default, or nil if neither is set.
+func runtimeClassNameForVirtualMachine(vm *vmv1.VirtualMachine, config *ReconcilerConfig) *string {
+	if vm.Spec.RuntimeClassName != nil {
+		return vm.Spec.RuntimeClassName
+	}
+	if config.DefaultRuntimeClassName != "" {
+		return lo.ToPtr(config.DefaultRuntimeClassName)
+	}
+	return nil
+}
+
+// addEphemeralStorage sets the ephemeral-storage request and limit from .spec.ephemeralStorage,
+// plus the size of the VM's disks that are stored on the node.
+//
+// The disks are included because their usage counts towards the pod's limit, and the VM shouldn't
+// be evicted for using the space we gave it.
+func addEphemeralStorage(resources *corev1.ResourceRequirements, vm *vmv1.VirtualMachine) {
+	es := vm.Spec.EphemeralStorage
+	if es == nil {
+		return
+	}
+
+	var disks resource.Quantity
+	if settings := vm.Spec.Guest.Settings; settings != nil && settings.Swap != nil {
+		disks.Add(*settings.Swap)
+	}
+	for _, disk := range vm.Spec.Disks {
+		if disk.EmptyDisk != nil {
+			disks.Add(disk.EmptyDisk.Size)
+		}
+	}
+
+	set := func(list *corev1.ResourceList, value *resource.Quantity) {
+		if value == nil {
+			return
+		}
+		if *list == nil {
+			*list = make(corev1.ResourceList)
+		}
+		total := value.DeepCopy()
+		total.Add(disks)
+		(*list)[corev1.ResourceEphemeralStorage] = total
+	}
+	set(&resources.Requests, es.Request)
+	set(&resources.Limits, es.Limit)
+}
+
+func annotationsForVirtualMachine(vm *vmv1.VirtualMachine, propagated []string) map[string]string {
 	// use bool here so `if ignored[key] { ... }` works
 	ignored := map[string]bool{
 		"kubectl.kubernetes.io/last-applied-configuration": true,
@@ -1232,7 +1554,7 @@ func annotationsForVirtualMachine(vm *vmv1.VirtualMachine) map[string]string {
 
 	a := make(map[string]string, len(vm.Annotations)+2)
 	for k, v := range vm.Annotations {
-		if !ignored[k] {
+		if !ignored[k] && isPropagatedKey(propagated, k) {
 			a[k] = v
 		}
 	}
@@ -1243,11 +1565,26 @@ func annotationsForVirtualMachine(vm *vmv1.VirtualMachine) map[string]string {
 	if ann := extractVirtualMachineOvercommitSettingsJSON(vm.Spec); ann != nil {
 		a[vmv1.VirtualMachineOvercommitAnnotation] = *ann
 	}
+	// the runner proxies the guest's metrics on its own HTTP server. Explicit annotations on the VM
+	// take precedence.
+	if vm.Spec.GuestMetrics != nil {
+		prometheusAnnotations := map[string]string{
+			"prometheus.io/scrape": "true",
+			"prometheus.io/port":   strconv.Itoa(int(vm.Spec.RunnerPort)),
+			"prometheus.io/path":   "/guest_metrics",
+		}
+		for k, v := range prometheusAnnotations {
+			if _, ok := a[k]; !ok {
+				a[k] = v
+			}
+		}
+	}
 	return a
 }
 
 func affinityForVirtualMachine(vm *vmv1.VirtualMachine) *corev1.Affinity {
-	a := vm.Spec.Affinity
+	// copy, so that adding the default values doesn't change the VM's spec
+	a := vm.Spec.Affinity.DeepCopy()
 	if a == nil {
 		a = &corev1.Affinity{}
 	}
@@ -1282,6 +1619,88 @@ func affinityForVirtualMachine(vm *vmv1.VirtualMachine) *corev1.Affinity {
 	return a
 }
 
+// addHAAntiAffinity adds anti-affinity against the runner pods of other VMs with the same value
+// for the configured HA label to the affinity, if enabled and the VM has the label.
+func addHAAntiAffinity(a *corev1.Affinity, vm *vmv1.VirtualMachine, config *HAAntiAffinityConfig) {
+	if config == nil {
+		return
+	}
+	group, ok := vm.Labels[config.Label]
+	if !ok {
+		return
+	}
+
+	if a.PodAntiAffinity == nil {
+		a.PodAntiAffinity = &corev1.PodAntiAffinity{}
+	}
+	for _, key := range config.TopologyKeys {
+		term := corev1.PodAffinityTerm{
+			LabelSelector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{config.Label: group},
+				// Exclude the VM's own pods, so that a migration target isn't kept away from its
+				// source.
+				MatchExpressions: []metav1.LabelSelectorRequirement{{
+					Key:      vmv1.VirtualMachineNameLabel,
+					Operator: metav1.LabelSelectorOpNotIn,
+					Values:   []string{vm.Name},
+				}},
+			},
+			TopologyKey: key,
+		}
+
+		if config.Required {
+			a.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(
+				a.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution,
+				term,
+			)
+		} else {
+			a.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+				a.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+				corev1.WeightedPodAffinityTerm{Weight: 100, PodAffinityTerm: term},
+			)
+		}
+	}
+}
+
+// addNestedVirtualizationAffinity restricts the affinity to nodes with the label, if the VM uses
+// nested virtualization and the label is not empty.
+func addNestedVirtualizationAffinity(a *corev1.Affinity, vm *vmv1.VirtualMachine, label string) {
+	if label == "" || vm.Spec.Guest.NestedVirtualization == nil || !*vm.Spec.Guest.NestedVirtualization {
+		return
+	}
+
+	// Node selector terms are ORed, so the requirement must be added to each of them.
+	// affinityForVirtualMachine guarantees that there's at least one.
+	terms := a.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for i := range terms {
+		terms[i].MatchExpressions = append(terms[i].MatchExpressions, corev1.NodeSelectorRequirement{
+			Key:      label,
+			Operator: corev1.NodeSelectorOpIn,
+			Values:   []string{"true"},
+		})
+	}
+}
+
+// addCPUFeaturesAffinity restricts the affinity to nodes labeled as supporting each of the CPU
+// features the VM enables, if the prefix is not empty.
+func addCPUFeaturesAffinity(a *corev1.Affinity, vm *vmv1.VirtualMachine, labelPrefix string) {
+	if labelPrefix == "" || vm.Spec.Guest.CPUFeatures == nil || len(vm.Spec.Guest.CPUFeatures.Enable) == 0 {
+		return
+	}
+
+	// Same as addNestedVirtualizationAffinity, the requirements must be added to each term.
+	terms := a.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for i := range terms {
+		for _, feature := range vm.Spec.Guest.CPUFeatures.Enable {
+			terms[i].MatchExpressions = append(terms[i].MatchExpressions, corev1.NodeSelectorRequirement{
+				Key:      labelPrefix + strings.ToUpper(feature),
+				Operator: corev1.NodeSelectorOpIn,
+				Values:   []string{"true"},
+			})
+		}
+	}
+}
+
 // imageForVirtualMachine gets the Operand image which is managed by this controller
 // from the VM_RUNNER_IMAGE environment variable defined in the config/manager/manager.yaml
 func imageForVmRunner() (string, error) {
@@ -1298,10 +1717,14 @@ func podSpec(
 	sshSecret *corev1.Secret,
 	config *ReconcilerConfig,
 ) (*corev1.Pod, error) {
-	runnerVersion := api.RunnerProtoV1
-	labels := labelsForVirtualMachine(vm, &runnerVersion)
-	annotations := annotationsForVirtualMachine(vm)
+	runnerVersion := api.RunnerProtoV4
+	labels := labelsForVirtualMachine(vm, &runnerVersion, config.propagatedLabels())
+	annotations := annotationsForVirtualMachine(vm, config.PropagatedAnnotations)
+	annotations[vmv1.RunnerPodBootConfigAnnotation] = bootConfigHash(vm)
 	affinity := affinityForVirtualMachine(vm)
+	addHAAntiAffinity(affinity, vm, config.HAAntiAffinity)
+	addNestedVirtualizationAffinity(affinity, vm, config.NestedVirtNodeLabel)
+	addCPUFeaturesAffinity(affinity, vm, config.CPUFeatureLabelPrefix)
 
 	// Get the Operand image
 	image, err := imageForVmRunner()
@@ -1348,17 +1771,18 @@ func podSpec(
 			EnableServiceLinks:            vm.Spec.ServiceLinks,
 			AutomountServiceAccountToken:  lo.ToPtr(false),
 			RestartPolicy:                 corev1.RestartPolicyNever,
-			TerminationGracePeriodSeconds: vm.Spec.TerminationGracePeriodSeconds,
+			TerminationGracePeriodSeconds: podTerminationGracePeriod(vm),
 			NodeSelector:                  vm.Spec.NodeSelector,
 			ImagePullSecrets:              vm.Spec.ImagePullSecrets,
 			Tolerations:                   tolerations,
 			ServiceAccountName:            vm.Spec.ServiceAccountName,
 			SchedulerName:                 vm.Spec.SchedulerName,
+			RuntimeClassName:              runtimeClassNameForVirtualMachine(vm, config),
 			Affinity:                      affinity,
 			InitContainers: []corev1.Container{
 				{
-					Image:           vm.Spec.Guest.RootDisk.Image,
-					Name:            "init",
+					Image:           rootDiskImage(vm),
+					Name:            rootDiskContainerName,
 					ImagePullPolicy: vm.Spec.Guest.RootDisk.ImagePullPolicy,
 					VolumeMounts: []corev1.VolumeMount{{
 						Name:      "virtualmachineimages",
@@ -1369,7 +1793,9 @@ func podSpec(
 						"mv /disk.qcow2 /vm/images/rootdisk.qcow2 && " +
 							/* uid=36(qemu) gid=34(kvm) groups=34(kvm) */
 							"chown 36:34 /vm/images/rootdisk.qcow2 && " +
-							"sysctl -w net.ipv4.ip_forward=1",
+							"sysctl -w net.ipv4.ip_forward=1 && " +
+							// may fail if IPv6 is disabled on the node, which is fine.
+							"(sysctl -w net.ipv6.conf.all.forwarding=1 || true)",
 					},
 					SecurityContext: &corev1.SecurityContext{
 						Privileged: lo.ToPtr(true),
@@ -1413,6 +1839,9 @@ func podSpec(
 						if config.DisableRunnerCgroup {
 							cmd = append(cmd, "-skip-cgroup-management")
 						}
+						if imageRollbackApplies(config, vm, rootDiskImage(vm)) {
+							cmd = append(cmd, "-wait-for-vm-monitor")
+						}
 
 						memhpAutoMovableRatio := config.MemhpAutoMovableRatio
 						if specValue := vm.Spec.Guest.MemhpAutoMovableRatio; specValue != nil {
@@ -1468,7 +1897,7 @@ func podSpec(
 							return []corev1.VolumeMount{images, cgroups}
 						}
 					}(),
-					Resources: vm.Spec.PodResources,
+					Resources: runnerResourcesForVirtualMachine(vm),
 					ReadinessProbe: &corev1.Probe{
 						ProbeHandler: corev1.ProbeHandler{
 							HTTPGet: &corev1.HTTPGetAction{
@@ -1555,6 +1984,52 @@ func podSpec(
 		)
 	}
 
+	// If the node may provide a tuning profile, make it available to the runner:
+	if config.NodeTuningProfileDir != "" {
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts,
+			corev1.VolumeMount{
+				Name:      "node-tuning",
+				MountPath: "/vm/node-tuning",
+				ReadOnly:  true,
+			},
+		)
+		pod.Spec.Volumes = append(pod.Spec.Volumes,
+			corev1.Volume{
+				Name: "node-tuning",
+				VolumeSource: corev1.VolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{
+						Path: config.NodeTuningProfileDir,
+						Type: lo.ToPtr(corev1.HostPathDirectoryOrCreate),
+					},
+				},
+			},
+		)
+		pod.Spec.Containers[0].Args = append(pod.Spec.Containers[0].Args, "-node-tuning-profile=/vm/node-tuning/profile.json")
+	}
+
+	// If the VM can use a resume pool, make the node's memory images available to the runner:
+	if _, ok := resumePoolKey(vm, config); ok {
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts,
+			corev1.VolumeMount{
+				Name:      "resume-pool",
+				MountPath: resumePoolMountPath,
+			},
+		)
+		pod.Spec.Volumes = append(pod.Spec.Volumes,
+			corev1.Volume{
+				Name: "resume-pool",
+				VolumeSource: corev1.VolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{
+						Path: config.ResumePoolDir,
+						Type: lo.ToPtr(corev1.HostPathDirectoryOrCreate),
+					},
+				},
+			},
+		)
+		pod.Spec.Containers[0].Args = append(pod.Spec.Containers[0].Args,
+			fmt.Sprintf("-resume-pool-max-age=%s", resumePoolImageMaxAge))
+	}
+
 	// If a custom neonvm-runner image is requested, use that instead:
 	if vm.Spec.RunnerImage != nil {
 		pod.Spec.Containers[0].Image = *vm.Spec.RunnerImage
@@ -1596,6 +2071,20 @@ func podSpec(
 	if *vm.Spec.EnableAcceleration {
 		pod.Spec.Containers[0].Resources.Limits["neonvm/kvm"] = resource.MustParse("1")
 	}
+	// request a VF from the SR-IOV device plugin, which also gives access to its /dev/vfio device
+	if sriov := vm.Spec.SRIOVNetwork; sriov != nil {
+		pod.Spec.Containers[0].Resources.Limits[corev1.ResourceName(sriov.ResourceName)] = resource.MustParse("1")
+	}
+	// request compute units for the VM's minimum resources, so that quota tooling can see them
+	if cu := config.ComputeUnitResource; cu != nil {
+		minResources := api.Resources{
+			VCPU: vm.Spec.Guest.CPUs.Min,
+			Mem:  api.MemoryForSlots(vm.Spec.Guest.MemorySlotSize, vm.Spec.Guest.MemorySlots.Min),
+		}
+		// Extended resources must be whole numbers, so sub-CU VMs still request a full CU.
+		units := minResources.ComputeUnitsCovering(*cu).Ceil()
+		pod.Spec.Containers[0].Resources.Limits[api.ResourceComputeUnit] = *resource.NewQuantity(int64(units), resource.DecimalSI)
+	}
 
 	for _, port := range vm.Spec.Guest.Ports {
 		cPort := corev1.ContainerPort{
@@ -1648,7 +2137,8 @@ func podSpec(
 						LocalObjectReference: corev1.LocalObjectReference{
 							Name: disk.ConfigMap.Name,
 						},
-						Items: disk.ConfigMap.Items,
+						Items:    disk.ConfigMap.Items,
+						Optional: disk.ConfigMap.Optional,
 					},
 				},
 			})
@@ -1673,6 +2163,26 @@ func podSpec(
 					},
 				},
 			})
+			if enc := disk.EmptyDisk.Encryption; enc != nil {
+				// Not mounted with a subPath, so that the runner sees when the key is rotated.
+				keyVolume := vmv1.EncryptionKeyVolumeName(disk.Name)
+				pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+					Name:      keyVolume,
+					MountPath: fmt.Sprintf("/vm/keys/%s", disk.Name),
+					ReadOnly:  true,
+				})
+				pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+					Name: keyVolume,
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName:  enc.SecretKeyRef.Name,
+							Items:       []corev1.KeyToPath{{Key: enc.SecretKeyRef.Key, Path: "key"}},
+							DefaultMode: lo.ToPtr[int32](0o400),
+							Optional:    enc.SecretKeyRef.Optional,
+						},
+					},
+				})
+			}
 		default:
 			// do nothing
 		}
@@ -1705,6 +2215,13 @@ func podSpec(
 		}
 		pod.ObjectMeta.Annotations[nadapiv1.NetworkAttachmentAnnot] = fmt.Sprintf("%s@%s", nadNetwork, vm.Spec.ExtraNetwork.Interface)
 	}
+	if sriov := vm.Spec.SRIOVNetwork; sriov != nil && len(sriov.MultusNetwork) > 0 {
+		networks := []string{sriov.MultusNetwork}
+		if existing := pod.ObjectMeta.Annotations[nadapiv1.NetworkAttachmentAnnot]; existing != "" {
+			networks = append([]string{existing}, networks...)
+		}
+		pod.ObjectMeta.Annotations[nadapiv1.NetworkAttachmentAnnot] = strings.Join(networks, ",")
+	}
 
 	return pod, nil
 }
@@ -1720,6 +2237,8 @@ func (r *VMReconciler) SetupWithManager(mgr ctrl.Manager) (ReconcilerWithMetrics
 		cntrlName,
 		r.Config.FailurePendingPeriod,
 		r.Config.FailingRefreshInterval,
+		r.Config.SlowReconcileThreshold,
+		r.Config.QMPRetryRateLimit,
 	)
 	err := ctrl.NewControllerManagedBy(mgr).
 		For(&vmv1.VirtualMachine{}).
@@ -13,19 +13,22 @@ import (
 )
 
 // handleCPUScaling encapsulates the logic to handle CPU scaling.
-// If vm scaling mode is set to CpuScalingModeSysfs, the scaling is delegated to neonvm-daemon to scale using sys fs state of the CPU cores.
-// otherwise the scaling is first done by scaling amount of cores in the VM using QMP and then by updating the cgroups through neonvm-daemon.
-// At the moment the cgroup update is not implemented in the daemon, so effectively the scaling is done by QMP or by using sys fs state for the CPU cores.
+// If vm scaling mode is set to CpuScalingModeSysfs, the scaling is delegated to the runner, which
+// offlines/onlines CPU cores inside the guest through neonvm-daemon and adjusts QEMU's cgroup on the
+// host accordingly, without hotplugging any devices.
+// If vm scaling mode is set to CpuScalingModeCgroup, all CPU cores stay online and the runner only
+// adjusts its cgroup, which is handled by the controller in the same way as sysfs scaling.
+// otherwise the scaling is done by scaling amount of cores in the VM using QMP.
 func (r *VMReconciler) handleCPUScaling(ctx context.Context, vm *vmv1.VirtualMachine, vmRunner *corev1.Pod) (bool, error) {
 	log := log.FromContext(ctx)
-	useCpuSysfsStateScaling := *vm.Spec.CpuScalingMode == vmv1.CpuScalingModeSysfs
 
 	var scaled bool
 	var err error
-	if !useCpuSysfsStateScaling {
-		scaled, err = r.handleCPUScalingQMP(ctx, vm, vmRunner)
-	} else {
+	switch *vm.Spec.CpuScalingMode {
+	case vmv1.CpuScalingModeSysfs, vmv1.CpuScalingModeCgroup:
 		scaled, err = r.handleCPUScalingSysfs(ctx, vm, vmRunner)
+	default:
+		scaled, err = r.handleCPUScalingQMP(ctx, vm, vmRunner)
 	}
 
 	if err != nil {
@@ -50,7 +53,9 @@ func (r *VMReconciler) handleCPUScalingQMP(ctx context.Context, vm *vmv1.Virtual
 
 	// get CPU details from QEMU
 	var pluggedCPU uint32
+	endQMP := traceQMP(ctx, "GetCpus")
 	cpuSlotsPlugged, _, err := QmpGetCpus(QmpAddr(vm))
+	endQMP(err)
 	if err != nil {
 		log.Error(err, "Failed to get CPU details from VirtualMachine", "VirtualMachine", vm.Name)
 		return false, err
@@ -63,7 +68,10 @@ func (r *VMReconciler) handleCPUScalingQMP(ctx context.Context, vm *vmv1.Virtual
 	if specCPU.RoundedUp() > pluggedCPU {
 		// going to plug one CPU
 		log.Info("Plug one more CPU into VM")
-		if err := QmpPlugCpu(QmpAddr(vm)); err != nil {
+		endQMP := traceQMP(ctx, "PlugCpu")
+		err := QmpPlugCpu(QmpAddr(vm))
+		endQMP(err)
+		if err != nil {
 			return false, err
 		}
 		r.Recorder.Event(vm, "Normal", "ScaleUp",
@@ -72,7 +80,10 @@ func (r *VMReconciler) handleCPUScalingQMP(ctx context.Context, vm *vmv1.Virtual
 	} else if specCPU.RoundedUp() < pluggedCPU {
 		// going to unplug one CPU
 		log.Info("Unplug one CPU from VM")
-		if err := QmpUnplugCpu(QmpAddr(vm)); err != nil {
+		endQMP := traceQMP(ctx, "UnplugCpu")
+		err := QmpUnplugCpu(QmpAddr(vm))
+		endQMP(err)
+		if err != nil {
 			return false, err
 		}
 		r.Recorder.Event(vm, "Normal", "ScaleDown",
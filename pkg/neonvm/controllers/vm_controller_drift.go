@@ -0,0 +1,137 @@
+package controllers
+
+// Drift detection: changes to how the controller generates runner pods (or to the parts of the VM
+// spec that are only used when the pod is created) don't affect pods that already exist. We check
+// running pods against what would be created now, and report any differences with the VM's
+// Drifted condition -- and if PodDriftPolicyRecreate is set, restart the VM to recreate the pod.
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/samber/lo"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// runnerFlagsWithState are the runner flags that are followed by a value with the VM's current
+// state, which is expected to change after the pod is created.
+var runnerFlagsWithState = []string{"-vmspec", "-vmstatus"}
+
+// runnerArgPrefixesFromPod are the prefixes of runner args that depend on how the pod was created,
+// rather than on the VM.
+var runnerArgPrefixesFromPod = []string{"-resume-memory-image="}
+
+// normalizeRunnerArgs returns the runner container's command or args, minus those that are
+// expected to differ between the existing pod and a new one.
+func normalizeRunnerArgs(args []string) []string {
+	var normalized []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case slices.Contains(runnerFlagsWithState, args[i]):
+			i++ // skip the value as well
+		case slices.ContainsFunc(runnerArgPrefixesFromPod, func(p string) bool { return strings.HasPrefix(args[i], p) }):
+		default:
+			normalized = append(normalized, args[i])
+		}
+	}
+	return normalized
+}
+
+// defaultedResources returns the resources as they would be stored by the API server, which sets
+// missing requests to the limits.
+func defaultedResources(resources corev1.ResourceRequirements) corev1.ResourceRequirements {
+	resources = *resources.DeepCopy()
+	for name, limit := range resources.Limits {
+		if _, ok := resources.Requests[name]; !ok {
+			if resources.Requests == nil {
+				resources.Requests = make(corev1.ResourceList)
+			}
+			resources.Requests[name] = limit
+		}
+	}
+	return resources
+}
+
+// podDrift returns the differences between the actual runner pod and the desired one, as a
+// human-readable list.
+func podDrift(actual, desired *corev1.Pod) []string {
+	var drift []string
+
+	compare := func(kind string, actual, desired []corev1.Container) {
+		for _, d := range desired {
+			idx := slices.IndexFunc(actual, func(c corev1.Container) bool { return c.Name == d.Name })
+			if idx == -1 {
+				drift = append(drift, fmt.Sprintf("%s %s is missing", kind, d.Name))
+				continue
+			}
+			a := actual[idx]
+
+			if a.Image != d.Image {
+				drift = append(drift, fmt.Sprintf("%s %s image", kind, d.Name))
+			}
+			if !slices.Equal(normalizeRunnerArgs(a.Command), normalizeRunnerArgs(d.Command)) {
+				drift = append(drift, fmt.Sprintf("%s %s command", kind, d.Name))
+			}
+			if !slices.Equal(normalizeRunnerArgs(a.Args), normalizeRunnerArgs(d.Args)) {
+				drift = append(drift, fmt.Sprintf("%s %s args", kind, d.Name))
+			}
+			if !equality.Semantic.DeepEqual(defaultedResources(a.Resources), defaultedResources(d.Resources)) {
+				drift = append(drift, fmt.Sprintf("%s %s resources", kind, d.Name))
+			}
+		}
+		for _, a := range actual {
+			if !slices.ContainsFunc(desired, func(c corev1.Container) bool { return c.Name == a.Name }) {
+				drift = append(drift, fmt.Sprintf("%s %s is no longer expected", kind, a.Name))
+			}
+		}
+	}
+
+	if lo.FromPtr(actual.Spec.RuntimeClassName) != lo.FromPtr(desired.Spec.RuntimeClassName) {
+		drift = append(drift, "runtime class")
+	}
+	compare("init container", actual.Spec.InitContainers, desired.Spec.InitContainers)
+	compare("container", actual.Spec.Containers, desired.Spec.Containers)
+	return drift
+}
+
+// updateDriftedCondition sets the VM's Drifted condition by comparing its running runner pod to
+// the one that would be created for the VM now.
+func (r *VMReconciler) updateDriftedCondition(ctx context.Context, vm *vmv1.VirtualMachine, runner *corev1.Pod) error {
+	config, err := runnerConfigForVM(ctx, r.Client, r.Recorder, r.Config, vm)
+	if err != nil {
+		return err
+	}
+
+	// The SSH secret only affects the pod's volumes, which aren't compared, so we don't need to
+	// fetch it.
+	var sshSecret *corev1.Secret
+	if *vm.Spec.EnableSSH {
+		sshSecret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: vm.Status.SSHSecretName}}
+	}
+	desired, err := podSpec(vm, sshSecret, config)
+	if err != nil {
+		return fmt.Errorf("failed to generate runner pod spec to check for drift: %w", err)
+	}
+
+	drift := podDrift(runner, desired)
+	if len(drift) == 0 {
+		meta.RemoveStatusCondition(&vm.Status.Conditions, typeDriftedVirtualMachine)
+		return nil
+	}
+
+	meta.SetStatusCondition(&vm.Status.Conditions, metav1.Condition{
+		Type:    typeDriftedVirtualMachine,
+		Status:  metav1.ConditionTrue,
+		Reason:  "PodSpecChanged",
+		Message: fmt.Sprintf("Pod (%s) differs from what would be created now: %s", runner.Name, strings.Join(drift, ", ")),
+	})
+	return nil
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// runningVM returns a VM with the fields set that the reconciler would set before creating its pod
+func runningVM(params *testParams) *vmv1.VirtualMachine {
+	vm := params.initVM(defaultVm())
+	vm.Spec.TargetArchitecture = lo.ToPtr(vmv1.CPUArchitectureAMD64)
+	vm.Spec.CpuScalingMode = lo.ToPtr(vmv1.CpuScalingModeQMP)
+	vm.Status.PodName = "test-vm-runner"
+	return vm
+}
+
+func TestPodDrift(t *testing.T) {
+	params := newTestParams(t)
+	vm := runningVM(params)
+
+	desired, err := podSpec(vm, nil, params.r.Config)
+	require.NoError(t, err)
+
+	// The VM's state in the runner's args is expected to change after the pod is created
+	actual := desired.DeepCopy()
+	vm.Status.Phase = vmv1.VmRunning
+	updated, err := podSpec(vm, nil, params.r.Config)
+	require.NoError(t, err)
+	assert.Empty(t, podDrift(actual, updated))
+
+	// ... and so are requests defaulted from limits
+	actual.Spec.Containers[0].Resources = defaultedResources(actual.Spec.Containers[0].Resources)
+	assert.Empty(t, podDrift(actual, desired))
+
+	actual.Spec.Containers[0].Image = "runner:old"
+	actual.Spec.Containers[0].Resources.Limits = corev1.ResourceList{
+		corev1.ResourceMemory: resource.MustParse("1Gi"),
+	}
+	assert.Equal(t, []string{
+		"container neonvm-runner image",
+		"container neonvm-runner resources",
+	}, podDrift(actual, desired))
+}
+
+func TestDriftedRestart(t *testing.T) {
+	params := newTestParams(t)
+	vm := runningVM(params)
+
+	runner, err := podSpec(vm, nil, params.r.Config)
+	require.NoError(t, err)
+	require.NoError(t, params.r.updateDriftedCondition(params.ctx, vm, runner))
+	assert.False(t, meta.IsStatusConditionTrue(vm.Status.Conditions, typeDriftedVirtualMachine))
+
+	runner.Spec.Containers[0].Image = "runner:old"
+	require.NoError(t, params.r.updateDriftedCondition(params.ctx, vm, runner))
+	assert.True(t, meta.IsStatusConditionTrue(vm.Status.Conditions, typeDriftedVirtualMachine))
+
+	// By default, drift is only reported
+	restarting, err := params.r.handleRestartPending(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.False(t, restarting)
+	assert.False(t, meta.IsStatusConditionTrue(vm.Status.Conditions, typeRestartPendingVirtualMachine))
+
+	// ... but can also be recreated
+	params.mockRecorder.On("Event", mock.Anything, "Normal", "RestartPending", mock.Anything)
+	params.r.Config.PodDriftPolicy = PodDriftPolicyRecreate
+	restarting, err = params.r.handleRestartPending(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.False(t, restarting)
+	cond := meta.FindStatusCondition(vm.Status.Conditions, typeRestartPendingVirtualMachine)
+	require.NotNil(t, cond)
+	assert.Equal(t, "PodDrifted", cond.Reason)
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/samber/lo"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+// handleNetworkLimits applies the network limits from the VM spec to the runner, if they differ
+// from what was last applied.
+func (r *VMReconciler) handleNetworkLimits(
+	ctx context.Context,
+	vm *vmv1.VirtualMachine,
+	runnerVersion api.RunnerProtoVersion,
+) error {
+	log := log.FromContext(ctx)
+
+	desired := vm.Spec.Network.GetLimits()
+	if equality.Semantic.DeepEqual(desired, lo.FromPtr(vm.Status.NetworkLimits)) {
+		return nil
+	}
+
+	if !runnerVersion.SupportsNetworkLimits() {
+		// Older runners can't change the limits. They'll be applied when the pod is recreated.
+		return nil
+	}
+
+	log.Info("Updating network limits on runner", "VirtualMachine", vm.Name,
+		"egress", desired.EgressLimit, "ingress", desired.IngressLimit)
+	if err := setRunnerNetworkLimits(ctx, vm, desired); err != nil {
+		log.Error(err, "Failed to set network limits on runner", "VirtualMachine", vm.Name)
+		return err
+	}
+
+	vm.Status.NetworkLimits = desired.DeepCopy()
+	return nil
+}
+
+func setRunnerNetworkLimits(ctx context.Context, vm *vmv1.VirtualMachine, limits vmv1.NetworkLimits) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s/network_limits", runnerAddr(vm))
+
+	update := api.NetworkLimitsChange{Limits: limits}
+
+	data, err := json.Marshal(update)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("setRunnerNetworkLimits: unexpected status %s", resp.Status)
+	}
+	return nil
+}
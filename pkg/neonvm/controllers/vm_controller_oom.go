@@ -0,0 +1,129 @@
+package controllers
+
+// Handling for runner pods that were OOM-killed, so that running out of memory is visible on the VM
+// -- rather than looking like any other crash -- and so that the VM has more room once it restarts.
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+// runnerOOMKilled returns whether the runner container in the pod was OOM-killed, along with the
+// termination message written by the runner, if there is one.
+//
+// The kubelet only reports the container as OOMKilled if the runner itself was killed. If it was
+// just QEMU, the runner tells us with its termination message instead.
+func runnerOOMKilled(pod *corev1.Pod) (bool, *vmv1.RunnerTerminationMessage) {
+	for _, c := range pod.Status.ContainerStatuses {
+		if c.Name != runnerContainerName || c.State.Terminated == nil {
+			continue
+		}
+
+		var msg *vmv1.RunnerTerminationMessage
+		if c.State.Terminated.Message != "" {
+			var m vmv1.RunnerTerminationMessage
+			// The message isn't always from us -- e.g. with the FallbackToLogsOnError policy -- so
+			// it's fine if it doesn't parse.
+			if err := json.Unmarshal([]byte(c.State.Terminated.Message), &m); err == nil {
+				msg = &m
+			}
+		}
+
+		oom := c.State.Terminated.Reason == "OOMKilled" ||
+			(msg != nil && msg.Reason == vmv1.RunnerTerminationReasonOOMKilled)
+		return oom, msg
+	}
+
+	return false, nil
+}
+
+// handleOOMKill records on the VM whether its failed runner pod was OOM-killed, along with the
+// memory stats at the time, and raises the VM's minimum memory if that's enabled.
+//
+// It must be called before the VM is cleaned up for restarting, so that its memory size is still
+// known.
+func (r *VMReconciler) handleOOMKill(vm *vmv1.VirtualMachine, pod *corev1.Pod) {
+	oom, msg := runnerOOMKilled(pod)
+	if !oom {
+		return
+	}
+
+	stats := oomMemoryStats(vm, msg)
+	r.Recorder.Eventf(vm, corev1.EventTypeWarning, "OOMKilled",
+		"Runner pod %s was OOM-killed (%s)", pod.Name, stats)
+	meta.SetStatusCondition(&vm.Status.Conditions,
+		metav1.Condition{
+			Type:    typeOOMKilledVirtualMachine,
+			Status:  metav1.ConditionTrue,
+			Reason:  "OOMKilled",
+			Message: fmt.Sprintf("Pod (%s) for VirtualMachine (%s) was OOM-killed: %s", pod.Name, vm.Name, stats),
+		})
+
+	config := r.Config.OOMMemoryBump
+	if config == nil {
+		return
+	}
+
+	slots := vm.Spec.Guest.MemorySlots
+	current := slots.Use
+	if vm.Status.MemorySize != nil {
+		current = int32(vm.Status.MemorySize.Value() / vm.Spec.Guest.MemorySlotSize.Value())
+	}
+	minSlots := min(slots.Max, current+config.Slots)
+	if vm.Status.MemoryBump != nil {
+		minSlots = max(minSlots, vm.Status.MemoryBump.MinSlots)
+	}
+	if minSlots <= slots.Min {
+		return
+	}
+
+	expiresAt := metav1.NewTime(time.Now().Add(config.Duration))
+	vm.Status.MemoryBump = &vmv1.MemoryBump{
+		MinSlots:  minSlots,
+		ExpiresAt: expiresAt,
+	}
+	r.Recorder.Eventf(vm, corev1.EventTypeNormal, "MemoryBumped",
+		"Raised minimum memory to %v until %s, after runner pod %s was OOM-killed",
+		api.MemoryForSlots(vm.Spec.Guest.MemorySlotSize, minSlots), expiresAt.UTC().Format(time.RFC3339), pod.Name)
+}
+
+// oomMemoryStats returns a description of the VM's memory at the time it was OOM-killed.
+func oomMemoryStats(vm *vmv1.VirtualMachine, msg *vmv1.RunnerTerminationMessage) string {
+	slots := vm.Spec.Guest.MemorySlots
+	stats := []string{
+		fmt.Sprintf("memory slots min=%d use=%d max=%d", slots.Min, slots.Use, slots.Max),
+	}
+	if vm.Status.MemorySize != nil {
+		stats = append(stats, fmt.Sprintf("guest memory %s", vm.Status.MemorySize))
+	}
+	if msg != nil && msg.MemoryPeak != nil {
+		stats = append(stats, fmt.Sprintf("runner memory peak %s", msg.MemoryPeak))
+	}
+	if msg != nil && msg.MemoryLimit != nil {
+		stats = append(stats, fmt.Sprintf("runner memory limit %s", msg.MemoryLimit))
+	}
+	return strings.Join(stats, ", ")
+}
+
+// expireMemoryBump removes the VM's memory bump once it has expired, and with it, the OOMKilled
+// condition, now that the VM is running again.
+func (r *VMReconciler) expireMemoryBump(vm *vmv1.VirtualMachine) {
+	if bump := vm.Status.MemoryBump; bump != nil && time.Now().After(bump.ExpiresAt.Time) {
+		vm.Status.MemoryBump = nil
+		r.Recorder.Event(vm, corev1.EventTypeNormal, "MemoryBumpExpired",
+			fmt.Sprintf("Minimum memory returned to %v", api.MemoryForSlots(vm.Spec.Guest.MemorySlotSize, vm.Spec.Guest.MemorySlots.Min)))
+	}
+
+	if vm.Status.MemoryBump == nil {
+		meta.RemoveStatusCondition(&vm.Status.Conditions, typeOOMKilledVirtualMachine)
+	}
+}
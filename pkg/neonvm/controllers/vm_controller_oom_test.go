@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// terminatedRunnerPod returns a runner pod whose runner container has exited, while the rest of
+// the pod is still running
+func terminatedRunnerPod(reason string, message string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-vm-runner",
+			Namespace: "default",
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name: runnerContainerName,
+				State: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{
+						ExitCode: 1,
+						Reason:   reason,
+						Message:  message,
+					},
+				},
+			}},
+		},
+	}
+}
+
+func TestRunnerOOMKilled(t *testing.T) {
+	// The runner itself was killed
+	oom, msg := runnerOOMKilled(terminatedRunnerPod("OOMKilled", ""))
+	assert.True(t, oom)
+	assert.Nil(t, msg)
+	assert.Equal(t, runnerFailed, runnerStatus(terminatedRunnerPod("OOMKilled", "")))
+
+	// QEMU was killed, and the runner told us
+	oom, msg = runnerOOMKilled(terminatedRunnerPod("Error", `{"reason":"OOMKilled","memoryPeak":"4Gi","memoryLimit":"4Gi"}`))
+	assert.True(t, oom)
+	require.NotNil(t, msg)
+	assert.Equal(t, int64(4<<30), msg.MemoryPeak.Value())
+
+	// Other failures aren't OOMs
+	oom, msg = runnerOOMKilled(terminatedRunnerPod("Error", ""))
+	assert.False(t, oom)
+	assert.Nil(t, msg)
+	oom, msg = runnerOOMKilled(terminatedRunnerPod("Error", "panic: something went wrong"))
+	assert.False(t, oom)
+	assert.Nil(t, msg)
+}
+
+func TestOOMMemoryBump(t *testing.T) {
+	params := newTestParams(t)
+	vm := runningVM(params)
+	vm.Status.MemorySize = resource.NewQuantity(4<<30, resource.BinarySI)
+	pod := terminatedRunnerPod("OOMKilled", "")
+
+	params.mockRecorder.On("Eventf", mock.Anything, "Warning", "OOMKilled", mock.Anything, mock.Anything)
+	params.mockRecorder.On("Eventf", mock.Anything, "Normal", "MemoryBumped", mock.Anything, mock.Anything)
+	params.mockRecorder.On("Event", mock.Anything, "Normal", "MemoryBumpExpired", mock.Anything)
+
+	// Without the bump, we only record the OOM
+	params.r.handleOOMKill(vm, pod)
+	cond := meta.FindStatusCondition(vm.Status.Conditions, typeOOMKilledVirtualMachine)
+	require.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Contains(t, cond.Message, "guest memory 4Gi")
+	assert.Nil(t, vm.Status.MemoryBump)
+
+	// With the bump, the minimum is raised above the memory at the time
+	params.r.Config.OOMMemoryBump = &OOMMemoryBumpConfig{
+		Slots:    2,
+		Duration: time.Hour,
+	}
+	params.r.handleOOMKill(vm, pod)
+	require.NotNil(t, vm.Status.MemoryBump)
+	assert.Equal(t, int32(6), vm.Status.MemoryBump.MinSlots)
+
+	// ... but never above the maximum
+	vm.Status.MemorySize = resource.NewQuantity(31<<30, resource.BinarySI)
+	params.r.handleOOMKill(vm, pod)
+	assert.Equal(t, int32(32), vm.Status.MemoryBump.MinSlots)
+
+	// The bump and condition stay until the bump expires
+	params.r.expireMemoryBump(vm)
+	assert.NotNil(t, vm.Status.MemoryBump)
+	assert.True(t, meta.IsStatusConditionTrue(vm.Status.Conditions, typeOOMKilledVirtualMachine))
+
+	vm.Status.MemoryBump.ExpiresAt = metav1.NewTime(time.Now().Add(-time.Second))
+	params.r.expireMemoryBump(vm)
+	assert.Nil(t, vm.Status.MemoryBump)
+	assert.Nil(t, meta.FindStatusCondition(vm.Status.Conditions, typeOOMKilledVirtualMachine))
+}
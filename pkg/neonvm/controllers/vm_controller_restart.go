@@ -0,0 +1,155 @@
+package controllers
+
+// Restarts for spec changes that only take effect when the guest boots, and for runner pods that
+// have drifted if PodDriftPolicyRecreate is set (see vm_controller_drift.go).
+//
+// Changes to these fields are allowed, but can't be applied to a running VM. Instead, the VM is
+// marked RestartPending, and the restart rollout (see restart_rollout.go) picks which of those VMs
+// are restarted and when, so that they aren't all restarted at once.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// bootConfigHash returns a hash of the parts of the VM's spec that only take effect when the guest
+// boots, for vmv1.RunnerPodBootConfigAnnotation.
+func bootConfigHash(vm *vmv1.VirtualMachine) string {
+	// Unset and standard are the same machine, so neither is included.
+	var machineType vmv1.MachineType
+	if t := effectiveMachineType(vm.Spec.MachineType); t != vmv1.MachineTypeStandard {
+		machineType = t
+	}
+
+	data, err := json.Marshal(struct {
+		KernelImage           *string
+		AppendKernelCmdline   *string
+		MemhpAutoMovableRatio *string
+		// omitted when empty, so that the hash is unchanged for VMs that don't use them
+		KernelArgs  []string         `json:",omitempty"`
+		MachineType vmv1.MachineType `json:",omitempty"`
+	}{
+		KernelImage:           vm.Spec.Guest.KernelImage,
+		AppendKernelCmdline:   vm.Spec.Guest.AppendKernelCmdline,
+		MemhpAutoMovableRatio: vm.Spec.Guest.MemhpAutoMovableRatio,
+		KernelArgs:            vm.Spec.Guest.KernelArgs,
+		MachineType:           machineType,
+	})
+	if err != nil {
+		panic(fmt.Errorf("error marshalling JSON: %w", err))
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:8])
+}
+
+// effectiveMachineType returns the machine type, treating unset as standard.
+func effectiveMachineType(machineType *vmv1.MachineType) vmv1.MachineType {
+	if machineType == nil {
+		return vmv1.MachineTypeStandard
+	}
+	return *machineType
+}
+
+// podMachineType returns the machine type that the runner pod was started with, from the VM spec
+// passed to the runner.
+func podMachineType(pod *corev1.Pod) (vmv1.MachineType, error) {
+	for _, c := range pod.Spec.Containers {
+		if c.Name != runnerContainerName {
+			continue
+		}
+		idx := slices.Index(c.Command, "-vmspec")
+		if idx == -1 || idx+1 == len(c.Command) {
+			break
+		}
+		specJSON, err := base64.StdEncoding.DecodeString(c.Command[idx+1])
+		if err != nil {
+			return "", fmt.Errorf("failed to decode runner's VM spec: %w", err)
+		}
+		var spec vmv1.VirtualMachineSpec
+		if err := json.Unmarshal(specJSON, &spec); err != nil {
+			return "", fmt.Errorf("failed to unmarshal runner's VM spec: %w", err)
+		}
+		return effectiveMachineType(spec.MachineType), nil
+	}
+	return "", errors.New("runner container has no -vmspec argument")
+}
+
+// restartRequested returns whether the VM is RestartPending and its current runner pod has been
+// allowed to restart by the restart rollout.
+func restartRequested(vm *vmv1.VirtualMachine) bool {
+	return meta.IsStatusConditionTrue(vm.Status.Conditions, typeRestartPendingVirtualMachine) &&
+		vm.Status.PodName != "" &&
+		vm.Annotations[vmv1.VirtualMachineRestartRequestedAnnotation] == vm.Status.PodName
+}
+
+// handleRestartPending updates the VM's RestartPending condition for its running runner pod, and
+// if the VM has been allowed to restart, starts the restart by deleting the pod.
+//
+// Returns whether the VM is being restarted, in which case nothing else should be done with the
+// runner pod.
+func (r *VMReconciler) handleRestartPending(ctx context.Context, vm *vmv1.VirtualMachine, runner *corev1.Pod) (bool, error) {
+	log := log.FromContext(ctx)
+
+	// Older runners don't have the annotation, so we can't tell whether their boot config is
+	// outdated -- assume it isn't, rather than restarting all of them.
+	podHash, ok := runner.Annotations[vmv1.RunnerPodBootConfigAnnotation]
+	bootConfigChanged := ok && podHash != bootConfigHash(vm)
+	imageChanged := podRootDiskImage(runner) != rootDiskImage(vm)
+	recreateDrifted := r.Config.PodDriftPolicy == PodDriftPolicyRecreate &&
+		meta.IsStatusConditionTrue(vm.Status.Conditions, typeDriftedVirtualMachine)
+
+	var reason, message string
+	switch {
+	case bootConfigChanged:
+		reason = "BootConfigChanged"
+		message = fmt.Sprintf("Pod (%s) for VirtualMachine (%s) was started with an outdated boot config", runner.Name, vm.Name)
+	case imageChanged:
+		reason = "RootDiskImageChanged"
+		message = fmt.Sprintf("Pod (%s) for VirtualMachine (%s) was started with a different root disk image", runner.Name, vm.Name)
+	case recreateDrifted:
+		reason = "PodDrifted"
+		message = fmt.Sprintf("Pod (%s) for VirtualMachine (%s) has drifted and will be recreated", runner.Name, vm.Name)
+	default:
+		meta.RemoveStatusCondition(&vm.Status.Conditions, typeRestartPendingVirtualMachine)
+		return false, nil
+	}
+
+	if !meta.IsStatusConditionTrue(vm.Status.Conditions, typeRestartPendingVirtualMachine) {
+		log.Info("VM requires restarting", "VirtualMachine", vm.Name, "reason", reason)
+		r.Recorder.Event(vm, "Normal", "RestartPending", message)
+	}
+	meta.SetStatusCondition(&vm.Status.Conditions, metav1.Condition{
+		Type:    typeRestartPendingVirtualMachine,
+		Status:  metav1.ConditionTrue,
+		Reason:  reason,
+		Message: message,
+	})
+
+	if !restartRequested(vm) {
+		return false, nil
+	}
+
+	log.Info("Restarting VM to apply spec changes", "VirtualMachine", vm.Name, "Pod.Name", runner.Name)
+	r.Recorder.Event(vm, "Normal", "Restarting", "Restarting VM to apply spec changes")
+	if err := r.deleteRunnerPodIfEnabled(ctx, vm, runner); err != nil {
+		return false, err
+	}
+	// Finish handling the restart as if the runner had exited. The VM is restarted from there,
+	// regardless of its restart policy, because restartRequested is still true.
+	vm.Status.Phase = vmv1.VmSucceeded
+	return true, nil
+}
@@ -0,0 +1,321 @@
+package controllers
+
+// Resume pools: memory images of pre-booted VMs, so that new VMs can resume from an image instead
+// of booting from scratch.
+//
+// Each image is created by a template runner pod, which boots the guest up to the point where it
+// would start reading any per-VM configuration, saves the guest's memory and root disk to a
+// directory on the node, and exits. The runner pod for a new VM then prefers the node with the
+// image, and resumes from it if it's still there - otherwise it boots as usual.
+//
+// An image can only be resumed with exactly the same QEMU devices and kernel command line, so
+// images are keyed by everything in the VM spec that affects them. In practice, this means that a
+// pool is shared by VMs that differ only in what their guest runs.
+//
+// Pools are defined by VirtualMachinePools that set .spec.resumeImages, with the pool's template as
+// the spec of the images. Template pods are controlled by the VirtualMachinePool, so a pool's
+// images are kept ready whether or not any VM is running, and are removed with the pool.
+//
+// Each template pod has its own SSH Secret, owned by the pod. The guest only reads the SSH keys
+// once it has been resumed, so VMs resumed from an image use their own keys, and never the keys of
+// the template.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/samber/lo"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/storage/names"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+const (
+	// resumePoolImageMaxAge is how long a memory image is used for before it's replaced.
+	//
+	// Runners remove images older than this from the node, which also cleans up any images whose
+	// template pods were deleted without the image being used.
+	resumePoolImageMaxAge = 12 * time.Hour
+
+	resumePoolMountPath = "/vm/resume-pool"
+)
+
+// resumePoolKey returns the key of the resume pool that the VM can use, or false if the VM can't be
+// resumed from a memory image.
+func resumePoolKey(vm *vmv1.VirtualMachine, config *ReconcilerConfig) (string, bool) {
+	if config.ResumePoolDir == "" {
+		return "", false
+	}
+	// Only amd64 runners have a vmgenid device, which makes the guest reseed its random number
+	// generator when it's resumed. Without it, every VM resumed from an image has the same random
+	// state.
+	if arch := vm.Spec.TargetArchitecture; arch != nil && *arch != vmv1.CPUArchitectureAMD64 {
+		return "", false
+	}
+	// The overlay network is configured by the kernel command line, and VFIO devices can't be
+	// saved at all. TLS certificates are created for each VM, so template pods wouldn't have one.
+	if vm.Spec.ExtraNetwork != nil || vm.Spec.SRIOVNetwork != nil || vm.Spec.TLS != nil {
+		return "", false
+	}
+
+	runnerImage, err := imageForVmRunner()
+	if err != nil {
+		return "", false
+	}
+
+	// Clear everything that doesn't affect QEMU or the kernel, i.e. that is only read by the guest
+	// once it has been resumed, or only affects the pod's scheduling.
+	spec := vm.Spec.DeepCopy()
+	spec.Guest.Command = nil
+	spec.Guest.Args = nil
+	spec.Guest.Env = nil
+	spec.NodeSelector = nil
+	spec.Affinity = nil
+	spec.Tolerations = nil
+	spec.SchedulerName = ""
+	spec.ServiceAccountName = ""
+	spec.PodResources = corev1.ResourceRequirements{}
+	spec.EphemeralStorage = nil
+	spec.TargetRevision = nil
+	// Resumed VMs must run with the same runtime as the template, including from the default.
+	spec.RuntimeClassName = runtimeClassNameForVirtualMachine(vm, config)
+
+	data, err := json.Marshal(struct {
+		RunnerImage string
+		Spec        *vmv1.VirtualMachineSpec
+	}{RunnerImage: runnerImage, Spec: spec})
+	if err != nil {
+		panic(fmt.Errorf("error marshalling JSON: %w", err))
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:8]), true
+}
+
+// listResumePoolPods returns the template pods matching the labels, oldest first.
+func listResumePoolPods(ctx context.Context, c client.Reader, namespace string, labels client.MatchingLabels) ([]corev1.Pod, error) {
+	var pods corev1.PodList
+	if err := c.List(ctx, &pods, client.InNamespace(namespace), labels); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(pods.Items, func(a, b corev1.Pod) int {
+		return a.CreationTimestamp.Compare(b.CreationTimestamp.Time)
+	})
+	return pods.Items, nil
+}
+
+// resumeImageUsable returns whether the template pod has saved a memory image that can be resumed.
+func resumeImageUsable(pod *corev1.Pod) bool {
+	return pod.DeletionTimestamp == nil &&
+		pod.Status.Phase == corev1.PodSucceeded &&
+		pod.Spec.NodeName != "" &&
+		time.Since(pod.CreationTimestamp.Time) < resumePoolImageMaxAge
+}
+
+// ensureResumeImages creates template pods for the pool until it has .spec.resumeImages of them,
+// replacing any that failed, are too old to use, or were created from an older template.
+//
+// It returns the number of images that are ready, and how long until the oldest of the remaining
+// images needs replacing.
+func (r *VirtualMachinePoolReconciler) ensureResumeImages(
+	ctx context.Context,
+	pool *vmv1.VirtualMachinePool,
+	hash string,
+) (int32, time.Duration, error) {
+	log := log.FromContext(ctx)
+
+	// Define the images the same way as the VMs that would resume from them, so that the keys
+	// match.
+	template, err := r.newPoolVM(pool, hash)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to define template VM: %w", err)
+	}
+	setSpecDefaults(logr.Discard(), template, r.Config)
+
+	size := int(pool.Spec.ResumeImages)
+	key, ok := resumePoolKey(template, r.Config)
+	if !ok {
+		size = 0
+	}
+
+	pods, err := listResumePoolPods(ctx, r.Client, pool.Namespace, client.MatchingLabels{vmv1.VirtualMachinePoolLabel: pool.Name})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list resume pool pods: %w", err)
+	}
+
+	count := 0
+	ready := int32(0)
+	var requeueAfter time.Duration
+	for i := range pods {
+		pod := &pods[i]
+		if !metav1.IsControlledBy(pod, pool) || pod.DeletionTimestamp != nil {
+			continue
+		}
+		age := time.Since(pod.CreationTimestamp.Time)
+		if pod.Labels[vmv1.ResumePoolLabel] != key || pod.Status.Phase == corev1.PodFailed ||
+			age > resumePoolImageMaxAge || count >= size {
+			log.Info("Deleting resume pool pod", "Pod.Name", pod.Name, "Pod.Status.Phase", pod.Status.Phase)
+			if err := r.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+				return 0, 0, fmt.Errorf("failed to delete resume pool pod: %w", err)
+			}
+			continue
+		}
+		count++
+		if resumeImageUsable(pod) {
+			ready++
+		}
+		if requeueAfter == 0 || resumePoolImageMaxAge-age < requeueAfter {
+			requeueAfter = resumePoolImageMaxAge - age
+		}
+	}
+
+	for ; count < size; count++ {
+		pod, sshSecret, err := r.resumePoolPod(ctx, pool, template, key)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to define resume pool pod: %w", err)
+		}
+		log.Info("Creating resume pool pod", "Pod.Name", pod.Name, "pool", key)
+		if err := r.Create(ctx, pod); err != nil {
+			return 0, 0, fmt.Errorf("failed to create resume pool pod: %w", err)
+		}
+		if requeueAfter == 0 {
+			requeueAfter = resumePoolImageMaxAge
+		}
+		if sshSecret == nil {
+			continue
+		}
+		// The Secret is created after the pod so that it can be owned by it. The pod doesn't start
+		// until the Secret exists.
+		if err := controllerutil.SetControllerReference(pod, sshSecret, r.Scheme); err != nil {
+			return 0, 0, fmt.Errorf("failed to set owner of resume pool SSH secret: %w", err)
+		}
+		if err := r.Create(ctx, sshSecret); err != nil {
+			return 0, 0, fmt.Errorf("failed to create resume pool SSH secret: %w", err)
+		}
+	}
+
+	return ready, requeueAfter, nil
+}
+
+// resumePoolPod returns a template pod that saves a memory image of the pool's template VM, and
+// the new SSH Secret for it, if the VM uses SSH.
+//
+// The pod has the same spec as a runner pod for the VM, but isn't labeled as a VM pod, so that it
+// isn't mistaken for one. It's controlled by the pool, so that it's cleaned up with the pool. Any
+// image it saved is then removed by runners on the node once it's too old.
+func (r *VirtualMachinePoolReconciler) resumePoolPod(
+	ctx context.Context,
+	pool *vmv1.VirtualMachinePool,
+	vm *vmv1.VirtualMachine,
+	key string,
+) (*corev1.Pod, *corev1.Secret, error) {
+	template := vm.DeepCopy()
+	template.Status.PodName = names.SimpleNameGenerator.GenerateName(fmt.Sprintf("resume-pool-%s-", key))
+
+	var sshSecret *corev1.Secret
+	if lo.FromPtr(template.Spec.EnableSSH) {
+		template.Status.SSHSecretName = fmt.Sprintf("ssh-%s", template.Status.PodName)
+		var err error
+		sshSecret, err = sshSecretSpec(template)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	config, err := runnerConfigForVM(ctx, r.Client, r.Recorder, r.Config, template)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pod, err := podSpec(template, sshSecret, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pod.Labels = map[string]string{
+		"app.kubernetes.io/name":     "NeonVM",
+		vmv1.ResumePoolLabel:         key,
+		vmv1.VirtualMachinePoolLabel: pool.Name,
+		vmv1.RunnerPodVersionLabel:   pod.Labels[vmv1.RunnerPodVersionLabel],
+	}
+	pod.Annotations = nil
+	pod.Spec.Containers[0].Args = append(pod.Spec.Containers[0].Args,
+		fmt.Sprintf("-save-memory-image=%s/%s", resumePoolMountPath, pod.Name))
+
+	if err := controllerutil.SetControllerReference(pool, pod, r.Scheme); err != nil {
+		return nil, nil, err
+	}
+
+	return pod, sshSecret, nil
+}
+
+// claimResumePoolImage returns the template pod of a memory image in the VM's resume pool, if
+// there is one, removing it from the pool so that no other VM tries to resume from it.
+func (r *VMReconciler) claimResumePoolImage(ctx context.Context, vm *vmv1.VirtualMachine) (*corev1.Pod, error) {
+	key, ok := resumePoolKey(vm, r.Config)
+	if !ok {
+		return nil, nil
+	}
+
+	pods, err := listResumePoolPods(ctx, r.Client, vm.Namespace, client.MatchingLabels{vmv1.ResumePoolLabel: key})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resume pool pods: %w", err)
+	}
+
+	for i := range pods {
+		pod := &pods[i]
+		if !resumeImageUsable(pod) {
+			continue
+		}
+		if err := r.Delete(ctx, pod); err != nil {
+			// Maybe another reconcile claimed it first. Either way, try the next one.
+			continue
+		}
+		return pod, nil
+	}
+
+	return nil, nil
+}
+
+// resumeFromPoolImage sets the runner pod to resume from the memory image created by the template
+// pod, preferring the node that has the image.
+//
+// This is only a preference, so that the pod doesn't get stuck if the node is full. If the pod is
+// placed elsewhere, the runner doesn't find the image and boots the VM as usual.
+func resumeFromPoolImage(pod *corev1.Pod, template *corev1.Pod) {
+	pod.Spec.Containers[0].Args = append(pod.Spec.Containers[0].Args,
+		fmt.Sprintf("-resume-memory-image=%s/%s", resumePoolMountPath, template.Name))
+
+	affinity := pod.Spec.Affinity.DeepCopy()
+	if affinity == nil {
+		affinity = &corev1.Affinity{}
+	}
+	if affinity.NodeAffinity == nil {
+		affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+		affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+		corev1.PreferredSchedulingTerm{
+			Weight: 100,
+			Preference: corev1.NodeSelectorTerm{
+				MatchFields: []corev1.NodeSelectorRequirement{{
+					Key:      "metadata.name",
+					Operator: corev1.NodeSelectorOpIn,
+					Values:   []string{template.Spec.NodeName},
+				}},
+			},
+		},
+	)
+	pod.Spec.Affinity = affinity
+}
@@ -0,0 +1,148 @@
+package controllers
+
+// Automatic rollbacks to .spec.guest.rootDisk.fallbackImage, so that a bad root disk image only
+// takes each VM down for a bounded amount of time, instead of until someone notices.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// rootDiskImage returns the root disk image that new runner pods for the VM are started with,
+// which is the fallback image if the VM was rolled back from its current image.
+func rootDiskImage(vm *vmv1.VirtualMachine) string {
+	rootDisk := vm.Spec.Guest.RootDisk
+	if rootDisk.FallbackImage != nil && vm.Status.RootDisk != nil &&
+		vm.Status.RootDisk.RolledBackFrom == rootDisk.Image {
+		return *rootDisk.FallbackImage
+	}
+	return rootDisk.Image
+}
+
+// podRootDiskImage returns the root disk image that the runner pod was started with.
+func podRootDiskImage(pod *corev1.Pod) string {
+	for _, c := range pod.Spec.InitContainers {
+		if c.Name == rootDiskContainerName {
+			return c.Image
+		}
+	}
+	return ""
+}
+
+// setPodRootDiskImage sets the root disk image that the runner pod will be started with.
+func setPodRootDiskImage(pod *corev1.Pod, image string) {
+	for i := range pod.Spec.InitContainers {
+		if pod.Spec.InitContainers[i].Name == rootDiskContainerName {
+			pod.Spec.InitContainers[i].Image = image
+		}
+	}
+}
+
+// rollbackRequested returns whether the VM's current runner pod must be replaced because the VM
+// was rolled back from its image.
+func rollbackRequested(vm *vmv1.VirtualMachine) bool {
+	status := vm.Status.RootDisk
+	return status != nil && status.RolledBackFrom != "" && status.Image == status.RolledBackFrom
+}
+
+// imageRollbackApplies returns whether a runner pod for the VM with the image is rolled back if the
+// guest doesn't become ready in time -- i.e., whether it's a new image with a fallback.
+//
+// Runner pods that this applies to are started with '-wait-for-vm-monitor', so that the runner
+// container only becomes ready once the guest does.
+func imageRollbackApplies(config *ReconcilerConfig, vm *vmv1.VirtualMachine, image string) bool {
+	rootDisk := vm.Spec.Guest.RootDisk
+	return config.ImageRollback != nil &&
+		rootDisk.FallbackImage != nil &&
+		image == rootDisk.Image &&
+		image != *rootDisk.FallbackImage
+}
+
+// handleImageRollback updates the VM's root disk status for its running runner pod, and if the
+// guest didn't become ready in time with a new image, rolls the VM back to its fallback image by
+// deleting the pod.
+//
+// Returns whether the VM is being rolled back, in which case nothing else should be done with the
+// runner pod.
+func (r *VMReconciler) handleImageRollback(ctx context.Context, vm *vmv1.VirtualMachine, runner *corev1.Pod) (bool, error) {
+	log := log.FromContext(ctx)
+	rootDisk := vm.Spec.Guest.RootDisk
+
+	image := podRootDiskImage(runner)
+	if vm.Status.RootDisk == nil || vm.Status.RootDisk.Image != image {
+		var rolledBackFrom string
+		if vm.Status.RootDisk != nil {
+			rolledBackFrom = vm.Status.RootDisk.RolledBackFrom
+		}
+		// Images that aren't checked from the start are never rolled back, so that adding a
+		// fallback image doesn't roll back VMs that have been running for a while.
+		vm.Status.RootDisk = &vmv1.RootDiskStatus{
+			Image:          image,
+			Ready:          !imageRollbackApplies(r.Config, vm, image),
+			RolledBackFrom: rolledBackFrom,
+		}
+	}
+	status := vm.Status.RootDisk
+
+	// The rollback lasts until the image changes.
+	if status.RolledBackFrom != "" && status.RolledBackFrom != rootDisk.Image {
+		status.RolledBackFrom = ""
+	}
+	if status.RolledBackFrom == "" {
+		meta.RemoveStatusCondition(&vm.Status.Conditions, typeRolledBackVirtualMachine)
+	}
+
+	if status.Ready || !imageRollbackApplies(r.Config, vm, image) {
+		return false, nil
+	}
+
+	config := r.Config.ImageRollback
+	if runnerContainerReady(runner) {
+		log.Info("VM became ready with new root disk image", "VirtualMachine", vm.Name, "image", image)
+		status.Ready = true
+		return false, nil
+	}
+	if runner.Status.StartTime == nil || time.Since(runner.Status.StartTime.Time) < config.Deadline {
+		return false, nil
+	}
+
+	message := fmt.Sprintf("VirtualMachine (%s) did not become ready within %s with root disk image %s, rolling back to %s",
+		vm.Name, config.Deadline, image, *rootDisk.FallbackImage)
+	log.Info("Rolling back VM to fallback root disk image", "VirtualMachine", vm.Name, "Pod.Name", runner.Name,
+		"image", image, "fallbackImage", *rootDisk.FallbackImage)
+	r.Recorder.Event(vm, corev1.EventTypeWarning, "RolledBack", message)
+	status.RolledBackFrom = image
+	meta.SetStatusCondition(&vm.Status.Conditions, metav1.Condition{
+		Type:    typeRolledBackVirtualMachine,
+		Status:  metav1.ConditionTrue,
+		Reason:  "ImageNotReady",
+		Message: message,
+	})
+
+	if err := r.deleteRunnerPodIfEnabled(ctx, vm, runner); err != nil {
+		return false, err
+	}
+	// As with restarts, finish handling the rollback as if the runner had exited. The VM is
+	// restarted from there, regardless of its restart policy, because rollbackRequested is true.
+	vm.Status.Phase = vmv1.VmSucceeded
+	return true, nil
+}
+
+// runnerContainerReady returns whether the runner pod's neonvm-runner container is ready, which for
+// pods started with '-wait-for-vm-monitor' means that vm-monitor in the guest is ready.
+func runnerContainerReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.ContainerStatuses {
+		if c.Name == runnerContainerName {
+			return c.Ready
+		}
+	}
+	return false
+}
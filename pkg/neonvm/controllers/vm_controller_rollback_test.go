@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// rollbackTestRunner creates the runner pod for the VM that was started at the time
+func rollbackTestRunner(t *testing.T, params *testParams, vm *vmv1.VirtualMachine, started time.Time) *corev1.Pod {
+	runner, err := podSpec(vm, nil, params.r.Config)
+	require.NoError(t, err)
+	runner.Name = vm.Status.PodName
+	runner.Status.StartTime = &metav1.Time{Time: started}
+	require.NoError(t, params.client.Create(params.ctx, runner))
+	return runner
+}
+
+func TestImageRollback(t *testing.T) {
+	params := newTestParams(t)
+	params.r.Config.ImageRollback = &ImageRollbackConfig{
+		Deadline: time.Minute,
+	}
+	vm := runningVM(params)
+	vm.Spec.Guest.RootDisk.Image = "vm:new"
+	vm.Spec.Guest.RootDisk.FallbackImage = lo.ToPtr("vm:good")
+	// The runner container never reports ready, so neither does the guest
+	runner := rollbackTestRunner(t, params, vm, time.Now())
+	assert.Equal(t, "vm:new", podRootDiskImage(runner))
+	assert.Contains(t, runner.Spec.Containers[0].Command, "-wait-for-vm-monitor")
+
+	// Within the deadline, the VM is left alone
+	rollingBack, err := params.r.handleImageRollback(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.False(t, rollingBack)
+	require.NotNil(t, vm.Status.RootDisk)
+	assert.Equal(t, vmv1.RootDiskStatus{Image: "vm:new", Ready: false, RolledBackFrom: ""}, *vm.Status.RootDisk)
+
+	// After the deadline, it's rolled back
+	params.mockRecorder.On("Event", mock.Anything, "Warning", "RolledBack", mock.Anything)
+	params.mockRecorder.On("Event", mock.Anything, "Normal", "Deleted", mock.Anything)
+	runner.Status.StartTime = &metav1.Time{Time: time.Now().Add(-2 * time.Minute)}
+	rollingBack, err = params.r.handleImageRollback(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.True(t, rollingBack)
+	assert.Equal(t, vmv1.VmSucceeded, vm.Status.Phase)
+	assert.Equal(t, "vm:new", vm.Status.RootDisk.RolledBackFrom)
+	assert.True(t, meta.IsStatusConditionTrue(vm.Status.Conditions, typeRolledBackVirtualMachine))
+	assert.True(t, rollbackRequested(vm))
+
+	// ... so new pods use the fallback image, which isn't checked
+	assert.Equal(t, "vm:good", rootDiskImage(vm))
+	runner = rollbackTestRunner(t, params, vm, time.Now().Add(-time.Hour))
+	assert.Equal(t, "vm:good", podRootDiskImage(runner))
+	assert.NotContains(t, runner.Spec.Containers[0].Command, "-wait-for-vm-monitor")
+	rollingBack, err = params.r.handleImageRollback(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.False(t, rollingBack)
+	assert.False(t, rollbackRequested(vm))
+	assert.True(t, vm.Status.RootDisk.Ready)
+	assert.True(t, meta.IsStatusConditionTrue(vm.Status.Conditions, typeRolledBackVirtualMachine))
+
+	// Changing the image ends the rollback
+	vm.Spec.Guest.RootDisk.Image = "vm:fixed"
+	rollingBack, err = params.r.handleImageRollback(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.False(t, rollingBack)
+	assert.Empty(t, vm.Status.RootDisk.RolledBackFrom)
+	assert.False(t, meta.IsStatusConditionTrue(vm.Status.Conditions, typeRolledBackVirtualMachine))
+	assert.Equal(t, "vm:fixed", rootDiskImage(vm))
+}
+
+func TestImageRollbackReady(t *testing.T) {
+	params := newTestParams(t)
+	params.r.Config.ImageRollback = &ImageRollbackConfig{
+		Deadline: time.Minute,
+	}
+	vm := runningVM(params)
+	vm.Spec.Guest.RootDisk.Image = "vm:new"
+	vm.Spec.Guest.RootDisk.FallbackImage = lo.ToPtr("vm:good")
+	runner := rollbackTestRunner(t, params, vm, time.Now().Add(-2*time.Minute))
+	//nolint:exhaustruct // only the fields checked by runnerContainerReady
+	runner.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: runnerContainerName, Ready: true}}
+
+	// The guest is ready, so even though the deadline has passed, there's no rollback
+	rollingBack, err := params.r.handleImageRollback(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.False(t, rollingBack)
+	assert.True(t, vm.Status.RootDisk.Ready)
+	assert.Equal(t, "vm:new", rootDiskImage(vm))
+}
+
+func TestImageChangeRestart(t *testing.T) {
+	params := newTestParams(t)
+	vm := runningVM(params)
+	runner, err := podSpec(vm, nil, params.r.Config)
+	require.NoError(t, err)
+
+	restarting, err := params.r.handleRestartPending(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.False(t, restarting)
+	assert.False(t, meta.IsStatusConditionTrue(vm.Status.Conditions, typeRestartPendingVirtualMachine))
+
+	// Changing the image requires a restart
+	params.mockRecorder.On("Event", mock.Anything, "Normal", "RestartPending", mock.Anything)
+	vm.Spec.Guest.RootDisk.Image = "vm:new"
+	restarting, err = params.r.handleRestartPending(params.ctx, vm, runner)
+	require.NoError(t, err)
+	assert.False(t, restarting)
+	cond := meta.FindStatusCondition(vm.Status.Conditions, typeRestartPendingVirtualMachine)
+	require.NotNil(t, cond)
+	assert.Equal(t, "RootDiskImageChanged", cond.Reason)
+}
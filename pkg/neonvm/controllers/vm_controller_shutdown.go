@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+// shutdownRunnerPod deletes the VM's runner pod, if it exists, and returns whether it is gone.
+//
+// While the pod is terminating, the runner's shutdown stage is copied to the VM's status, so that
+// it's visible how far the runner had to escalate to stop the guest.
+func (r *VMReconciler) shutdownRunnerPod(ctx context.Context, vm *vmv1.VirtualMachine) (bool, error) {
+	log := log.FromContext(ctx)
+
+	if vm.Status.PodName == "" {
+		return true, nil
+	}
+
+	var pod corev1.Pod
+	err := r.Get(ctx, types.NamespacedName{Name: vm.Status.PodName, Namespace: vm.Namespace}, &pod)
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	if pod.DeletionTimestamp == nil {
+		log.Info("Deleting runner pod to shut down the guest", "Pod", pod.Name)
+		if err := r.Delete(ctx, &pod); client.IgnoreNotFound(err) != nil {
+			return false, err
+		}
+		r.Recorder.Event(vm, "Normal", "ShuttingDown",
+			fmt.Sprintf("Shutting down runner pod %s", pod.Name))
+		return false, nil
+	}
+
+	runnerVersion, err := getRunnerVersion(&pod)
+	if err != nil || !runnerVersion.SupportsShutdownStage() || vm.Status.PodIP == "" {
+		// Older runners only ask the guest to power off; there's nothing more to report.
+		return false, nil
+	}
+
+	stage, err := getRunnerShutdownStage(ctx, vm)
+	if err != nil {
+		// The runner stops serving requests as soon as QEMU exits, so this is expected.
+		log.Info("Failed to get shutdown stage from runner", "error", err)
+		return false, nil
+	}
+	if stage != vm.Status.ShutdownStage {
+		log.Info("Runner shutdown stage changed", "stage", stage)
+		vm.Status.ShutdownStage = stage
+		if err := r.Status().Update(ctx, vm); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func getRunnerShutdownStage(ctx context.Context, vm *vmv1.VirtualMachine) (vmv1.ShutdownStage, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s/shutdown_stage", runnerAddr(vm))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("getRunnerShutdownStage: unexpected status %s", resp.Status)
+	}
+
+	var status api.RunnerShutdownStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return "", fmt.Errorf("error unmarshaling response: %w", err)
+	}
+	return status.Stage, nil
+}
@@ -20,11 +20,13 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 
 	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
 )
 
 type mockRecorder struct {
@@ -125,9 +127,30 @@ func newTestParams(t *testing.T) *testParams {
 			MemhpAutoMovableRatio:   "301",
 			FailurePendingPeriod:    time.Minute,
 			FailingRefreshInterval:  time.Minute,
+			SlowReconcileThreshold:  0,
 			AtMostOnePod:            false,
 			DefaultCPUScalingMode:   vmv1.CpuScalingModeQMP,
+			DefaultRuntimeClassName: "",
+			NodeTuningProfileDir:    "",
+			QEMUExtraArgsAllowlist:  nil,
+			KernelArgsAllowlist:     nil,
+			KernelArgsDenylist:      nil,
+			ResumePoolDir:           "",
+			MigrationMaxBandwidth:   resource.MustParse("1Gi"),
+			MigrationMaxDowntime:    300 * time.Millisecond,
+			MigrationCPUModelLabel:  "",
+			SchedulerPluginAddr:     "",
+			ComputeUnitResource:     nil,
 			NADConfig:               nil,
+			PodDriftPolicy:          PodDriftPolicyReport,
+			PropagatedLabels:        nil,
+			PropagatedAnnotations:   nil,
+			HAAntiAffinity:          nil,
+			NestedVirtNodeLabel:     "",
+			CPUFeatureLabelPrefix:   "",
+			VirtioMemBlockSize:      resource.MustParse("8Mi"),
+			OOMMemoryBump:           nil,
+			ImageRollback:           nil,
 		},
 		Metrics: testReconcilerMetrics,
 		IPAM:    nil,
@@ -197,11 +220,18 @@ func TestReconcile(t *testing.T) {
 	// We now have a pod
 	vm := params.getVM()
 	assert.NotEmpty(t, vm.Status.PodName)
-	// Spec is unchanged except cpuScalingMode and targetArchitecture
+	// Spec is unchanged except cpuScalingMode, cpuClass, targetArchitecture, entropy, and
+	// virtioMemBlockSize
 	var origWithModifiedFields vmv1.VirtualMachine
 	origVM.DeepCopy().DeepCopyInto(&origWithModifiedFields)
 	origWithModifiedFields.Spec.CpuScalingMode = lo.ToPtr(vmv1.CpuScalingModeQMP)
+	origWithModifiedFields.Spec.CPUClass = lo.ToPtr(vmv1.CPUClassShared)
 	origWithModifiedFields.Spec.TargetArchitecture = lo.ToPtr(vmv1.CPUArchitectureAMD64)
+	origWithModifiedFields.Spec.Entropy = &vmv1.Entropy{
+		Enabled: lo.ToPtr(true),
+		Source:  vmv1.EntropySourceURandom,
+	}
+	origWithModifiedFields.Spec.Guest.VirtioMemBlockSize = lo.ToPtr(resource.MustParse("8Mi"))
 	assert.Equal(t, vm.Spec, origWithModifiedFields.Spec)
 
 	// Round 4
@@ -324,3 +354,398 @@ func TestNodeAffinity(t *testing.T) {
 		assert.Equal(t, "amd64", affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[1].MatchExpressions[1].Values[0])
 	})
 }
+
+func TestHAAntiAffinity(t *testing.T) {
+	config := &HAAntiAffinityConfig{
+		Label:        "neon/tenant-id",
+		TopologyKeys: []string{"kubernetes.io/hostname", "topology.kubernetes.io/zone"},
+		Required:     false,
+	}
+
+	t.Run("no label", func(t *testing.T) {
+		vm := defaultVm()
+		vm.Spec.TargetArchitecture = lo.ToPtr(vmv1.CPUArchitectureAMD64)
+		affinity := affinityForVirtualMachine(vm)
+		addHAAntiAffinity(affinity, vm, config)
+		assert.Nil(t, affinity.PodAntiAffinity)
+	})
+
+	t.Run("preferred", func(t *testing.T) {
+		vm := defaultVm()
+		vm.Spec.TargetArchitecture = lo.ToPtr(vmv1.CPUArchitectureAMD64)
+		vm.Labels = map[string]string{"neon/tenant-id": "tenant-1"}
+		affinity := affinityForVirtualMachine(vm)
+		addHAAntiAffinity(affinity, vm, config)
+
+		terms := affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+		assert.Len(t, terms, 2)
+		assert.Empty(t, affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution)
+		assert.Equal(t, "kubernetes.io/hostname", terms[0].PodAffinityTerm.TopologyKey)
+		assert.Equal(t, "topology.kubernetes.io/zone", terms[1].PodAffinityTerm.TopologyKey)
+		selector := terms[0].PodAffinityTerm.LabelSelector
+		assert.Equal(t, map[string]string{"neon/tenant-id": "tenant-1"}, selector.MatchLabels)
+		assert.Equal(t, []string{vm.Name}, selector.MatchExpressions[0].Values)
+		// The VM's own affinity is left unchanged
+		assert.Nil(t, vm.Spec.Affinity)
+	})
+
+	t.Run("required", func(t *testing.T) {
+		vm := defaultVm()
+		vm.Spec.TargetArchitecture = lo.ToPtr(vmv1.CPUArchitectureAMD64)
+		vm.Labels = map[string]string{"neon/tenant-id": "tenant-1"}
+		affinity := affinityForVirtualMachine(vm)
+		required := *config
+		required.Required = true
+		addHAAntiAffinity(affinity, vm, &required)
+
+		assert.Len(t, affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, 2)
+		assert.Empty(t, affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution)
+	})
+}
+
+func TestNestedVirtualizationAffinity(t *testing.T) {
+	const label = "vm.neon.tech/nested-virtualization"
+
+	t.Run("disabled", func(t *testing.T) {
+		vm := defaultVm()
+		vm.Spec.TargetArchitecture = lo.ToPtr(vmv1.CPUArchitectureAMD64)
+		affinity := affinityForVirtualMachine(vm)
+		addNestedVirtualizationAffinity(affinity, vm, label)
+		terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+		assert.Len(t, terms[0].MatchExpressions, 2)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		vm := defaultVm()
+		vm.Spec.TargetArchitecture = lo.ToPtr(vmv1.CPUArchitectureAMD64)
+		vm.Spec.Guest.NestedVirtualization = lo.ToPtr(true)
+		vm.Spec.Affinity = &corev1.Affinity{
+			NodeAffinity: &corev1.NodeAffinity{
+				RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+					NodeSelectorTerms: []corev1.NodeSelectorTerm{
+						{
+							MatchExpressions: []corev1.NodeSelectorRequirement{
+								{Key: "topology.kubernetes.io/zone", Operator: "In", Values: []string{"zoneid"}},
+							},
+						},
+					},
+				},
+			},
+		}
+		affinity := affinityForVirtualMachine(vm)
+		addNestedVirtualizationAffinity(affinity, vm, label)
+
+		// Every term must require the label, because terms are ORed
+		terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+		assert.Len(t, terms, 2)
+		for _, term := range terms {
+			last := term.MatchExpressions[len(term.MatchExpressions)-1]
+			assert.Equal(t, label, last.Key)
+			assert.Equal(t, corev1.NodeSelectorOpIn, last.Operator)
+			assert.Equal(t, []string{"true"}, last.Values)
+		}
+		// The VM's own affinity is left unchanged
+		assert.Len(t, vm.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions, 1)
+	})
+
+	t.Run("no label", func(t *testing.T) {
+		vm := defaultVm()
+		vm.Spec.TargetArchitecture = lo.ToPtr(vmv1.CPUArchitectureAMD64)
+		vm.Spec.Guest.NestedVirtualization = lo.ToPtr(true)
+		affinity := affinityForVirtualMachine(vm)
+		addNestedVirtualizationAffinity(affinity, vm, "")
+		terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+		assert.Len(t, terms[0].MatchExpressions, 2)
+	})
+}
+
+func TestCPUFeaturesAffinity(t *testing.T) {
+	const prefix = "feature.node.kubernetes.io/cpu-cpuid."
+
+	vm := defaultVm()
+	vm.Spec.TargetArchitecture = lo.ToPtr(vmv1.CPUArchitectureAMD64)
+	vm.Spec.Guest.CPUFeatures = &vmv1.CPUFeatures{
+		BaseModel: "Skylake-Server",
+		Enable:    []string{"avx512f", "avx512vl"},
+		Disable:   []string{"hle"},
+	}
+
+	affinity := affinityForVirtualMachine(vm)
+	addCPUFeaturesAffinity(affinity, vm, prefix)
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	require.Len(t, terms, 1)
+	// Only enabled features need support from the node
+	assert.Equal(t, []corev1.NodeSelectorRequirement{
+		{Key: prefix + "AVX512F", Operator: corev1.NodeSelectorOpIn, Values: []string{"true"}},
+		{Key: prefix + "AVX512VL", Operator: corev1.NodeSelectorOpIn, Values: []string{"true"}},
+	}, terms[0].MatchExpressions[2:])
+
+	// Not checked without a prefix
+	affinity = affinityForVirtualMachine(vm)
+	addCPUFeaturesAffinity(affinity, vm, "")
+	assert.Len(t, affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions, 2)
+}
+
+func TestRunnerEphemeralStorage(t *testing.T) {
+	vm := defaultVm()
+	assert.NotContains(t, runnerResourcesForVirtualMachine(vm).Limits, corev1.ResourceEphemeralStorage)
+
+	vm.Spec.EphemeralStorage = &vmv1.EphemeralStorage{
+		Request: lo.ToPtr(resource.MustParse("1Gi")),
+		Limit:   lo.ToPtr(resource.MustParse("2Gi")),
+	}
+	vm.Spec.Guest.Settings = &vmv1.GuestSettings{Swap: lo.ToPtr(resource.MustParse("1Gi"))}
+	vm.Spec.Disks = []vmv1.Disk{{
+		Name:      "cache",
+		MountPath: "/cache",
+		DiskSource: vmv1.DiskSource{
+			EmptyDisk: &vmv1.EmptyDiskSource{Size: resource.MustParse("512Mi")},
+		},
+	}}
+
+	// The swap and empty disks are added to the configured values
+	resources := runnerResourcesForVirtualMachine(vm)
+	assert.Equal(t, "2560Mi", lo.ToPtr(resources.Requests[corev1.ResourceEphemeralStorage]).String())
+	assert.Equal(t, "3584Mi", lo.ToPtr(resources.Limits[corev1.ResourceEphemeralStorage]).String())
+	// The VM's own resources are left unchanged
+	assert.NotContains(t, vm.Spec.PodResources.Limits, corev1.ResourceEphemeralStorage)
+}
+
+func TestDiskEncryptionKeyVolume(t *testing.T) {
+	params := newTestParams(t)
+	vm := runningVM(params)
+	vm.Spec.Disks = []vmv1.Disk{{
+		Name:      "data",
+		MountPath: "/data",
+		DiskSource: vmv1.DiskSource{
+			EmptyDisk: &vmv1.EmptyDiskSource{
+				Size: resource.MustParse("1Gi"),
+				Encryption: &vmv1.DiskEncryption{
+					SecretKeyRef: corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "data-keys"},
+						Key:                  "current",
+					},
+				},
+			},
+		},
+	}}
+
+	pod, err := podSpec(vm, nil, params.r.Config)
+	require.NoError(t, err)
+
+	// The key is mounted as a whole directory, so that rotations are visible to the runner
+	volume, ok := lo.Find(pod.Spec.Volumes, func(v corev1.Volume) bool { return v.Name == "data-key" })
+	require.True(t, ok)
+	require.NotNil(t, volume.Secret)
+	assert.Equal(t, "data-keys", volume.Secret.SecretName)
+	assert.Equal(t, []corev1.KeyToPath{{Key: "current", Path: "key"}}, volume.Secret.Items)
+
+	mount, ok := lo.Find(pod.Spec.Containers[0].VolumeMounts, func(m corev1.VolumeMount) bool { return m.Name == "data-key" })
+	require.True(t, ok)
+	assert.Equal(t, "/vm/keys/data", mount.MountPath)
+	assert.Empty(t, mount.SubPath)
+	assert.True(t, mount.ReadOnly)
+}
+
+func TestVirtioMemBlockSizeFor(t *testing.T) {
+	cases := []struct {
+		name     string
+		def      string
+		slotSize string
+		expected string
+	}{
+		{"default divides slot size", "8Mi", "1Gi", "8Mi"},
+		{"larger default", "128Mi", "1Gi", "128Mi"},
+		{"default reduced to fit slot size", "128Mi", "40Mi", "8Mi"},
+		{"default equal to slot size", "64Mi", "64Mi", "64Mi"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			blockSize := virtioMemBlockSizeFor(resource.MustParse(c.def), resource.MustParse(c.slotSize))
+			expected := resource.MustParse(c.expected)
+			assert.Equal(t, expected.Value(), blockSize.Value())
+		})
+	}
+}
+
+func TestPodTerminationGracePeriod(t *testing.T) {
+	vm := defaultVm()
+	vm.Spec.TerminationGracePeriodSeconds = lo.ToPtr[int64](5)
+	assert.Equal(t, lo.ToPtr[int64](5+vmv1.ShutdownEscalationSeconds), podTerminationGracePeriod(vm))
+
+	vm.Spec.TerminationGracePeriodSeconds = lo.ToPtr[int64](0)
+	assert.Equal(t, lo.ToPtr(vmv1.ShutdownEscalationSeconds), podTerminationGracePeriod(vm))
+
+	// Without a grace period, the escalation time is still added on top of the pod default
+	vm.Spec.TerminationGracePeriodSeconds = nil
+	assert.Equal(t, lo.ToPtr[int64](30+vmv1.ShutdownEscalationSeconds), podTerminationGracePeriod(vm))
+}
+
+func TestRuntimeClassName(t *testing.T) {
+	//nolint:exhaustruct // Only the default runtime class is used
+	config := &ReconcilerConfig{}
+
+	vm := defaultVm()
+	assert.Nil(t, runtimeClassNameForVirtualMachine(vm, config))
+
+	config.DefaultRuntimeClassName = "kata"
+	assert.Equal(t, lo.ToPtr("kata"), runtimeClassNameForVirtualMachine(vm, config))
+
+	// The VM's own runtime class overrides the default
+	vm.Spec.RuntimeClassName = lo.ToPtr("gvisor")
+	assert.Equal(t, lo.ToPtr("gvisor"), runtimeClassNameForVirtualMachine(vm, config))
+}
+
+func TestGuestMetricsAnnotations(t *testing.T) {
+	t.Run("no guest metrics", func(t *testing.T) {
+		vm := defaultVm()
+		annotations := annotationsForVirtualMachine(vm, nil)
+		assert.NotContains(t, annotations, "prometheus.io/scrape")
+	})
+
+	t.Run("guest metrics", func(t *testing.T) {
+		vm := defaultVm()
+		vm.Spec.RunnerPort = 25183
+		vm.Spec.GuestMetrics = &vmv1.GuestMetrics{Port: 9100, Path: "/metrics"}
+		annotations := annotationsForVirtualMachine(vm, nil)
+		assert.Equal(t, "true", annotations["prometheus.io/scrape"])
+		assert.Equal(t, "25183", annotations["prometheus.io/port"])
+		assert.Equal(t, "/guest_metrics", annotations["prometheus.io/path"])
+	})
+
+	t.Run("explicit annotations take precedence", func(t *testing.T) {
+		vm := defaultVm()
+		vm.Annotations = map[string]string{"prometheus.io/scrape": "false"}
+		vm.Spec.GuestMetrics = &vmv1.GuestMetrics{Port: 9100, Path: "/metrics"}
+		annotations := annotationsForVirtualMachine(vm, nil)
+		assert.Equal(t, "false", annotations["prometheus.io/scrape"])
+	})
+}
+
+func TestPropagatedLabels(t *testing.T) {
+	params := newTestParams(t)
+	params.r.Config.PropagatedLabels = []string{"team", "cost.example.com/*"}
+
+	vm := defaultVm()
+	vm.Labels = map[string]string{
+		"team":                          "a",
+		"cost.example.com/project":      "p1",
+		"unrelated":                     "b",
+		"autoscaling.neon.tech/enabled": "true",
+	}
+	vm = params.initVM(vm)
+
+	runner := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-vm-runner",
+			Namespace:   vm.Namespace,
+			Labels:      map[string]string{"team": "old", "external": "x"},
+			Annotations: map[string]string{"kubectl.kubernetes.io/default-container": "neonvm-runner"},
+		},
+	}
+	require.NoError(t, params.client.Create(params.ctx, runner))
+
+	getLabels := func() map[string]string {
+		var pod corev1.Pod
+		require.NoError(t, params.client.Get(params.ctx, client.ObjectKeyFromObject(runner), &pod))
+		return pod.Labels
+	}
+
+	require.NoError(t, updatePodMetadataIfNecessary(params.ctx, params.client, params.r.Config, vm, runner))
+	labels := getLabels()
+	assert.Equal(t, "a", labels["team"])
+	assert.Equal(t, "p1", labels["cost.example.com/project"])
+	assert.Equal(t, "true", labels["autoscaling.neon.tech/enabled"])
+	assert.NotContains(t, labels, "unrelated")
+	// Labels outside of the propagated set are left alone
+	assert.Equal(t, "x", labels["external"])
+
+	// Labels removed from the VM are removed from the pod
+	delete(vm.Labels, "cost.example.com/project")
+	require.NoError(t, updatePodMetadataIfNecessary(params.ctx, params.client, params.r.Config, vm, runner))
+	labels = getLabels()
+	assert.NotContains(t, labels, "cost.example.com/project")
+	assert.Equal(t, "x", labels["external"])
+
+	// The HA anti-affinity label is always propagated, because the anti-affinity depends on it
+	params.r.Config.HAAntiAffinity = &HAAntiAffinityConfig{Label: "unrelated", TopologyKeys: nil, Required: false}
+	require.NoError(t, updatePodMetadataIfNecessary(params.ctx, params.client, params.r.Config, vm, runner))
+	assert.Equal(t, "b", getLabels()["unrelated"])
+	assert.Equal(t, []string{"team", "cost.example.com/*"}, params.r.Config.PropagatedLabels)
+}
+
+func TestSchedulerDeniedCondition(t *testing.T) {
+	vm := defaultVm()
+
+	vm.Annotations = map[string]string{api.InternalAnnotationSchedulerDenial: string(api.DenialReasonNodeFull)}
+	setSchedulerDeniedCondition(vm)
+	cond := meta.FindStatusCondition(vm.Status.Conditions, typeSchedulerDeniedVirtualMachine)
+	require.NotNil(t, cond)
+	assert.Equal(t, metav1.ConditionTrue, cond.Status)
+	assert.Equal(t, "NodeFull", cond.Reason)
+
+	vm.Annotations[api.InternalAnnotationSchedulerDenial] = "not a valid reason!"
+	setSchedulerDeniedCondition(vm)
+	cond = meta.FindStatusCondition(vm.Status.Conditions, typeSchedulerDeniedVirtualMachine)
+	require.NotNil(t, cond)
+	assert.Equal(t, "Unknown", cond.Reason)
+
+	delete(vm.Annotations, api.InternalAnnotationSchedulerDenial)
+	setSchedulerDeniedCondition(vm)
+	assert.Nil(t, meta.FindStatusCondition(vm.Status.Conditions, typeSchedulerDeniedVirtualMachine))
+}
+
+func TestResumePoolKey(t *testing.T) {
+	t.Setenv("VM_RUNNER_IMAGE", "runner:test")
+	//nolint:exhaustruct // Only the resume pool fields are used
+	config := &ReconcilerConfig{}
+
+	t.Run("no pool directory", func(t *testing.T) {
+		_, ok := resumePoolKey(defaultVm(), config)
+		assert.False(t, ok)
+	})
+
+	config.ResumePoolDir = "/var/lib/neonvm/resume-pool"
+
+	t.Run("guest command and env don't change the key", func(t *testing.T) {
+		vm := defaultVm()
+		key, ok := resumePoolKey(vm, config)
+		assert.True(t, ok)
+
+		other := defaultVm()
+		other.Spec.Guest.Command = []string{"postgres"}
+		other.Spec.Guest.Env = []vmv1.EnvVar{{Name: "FOO", Value: "bar"}}
+		otherKey, ok := resumePoolKey(other, config)
+		assert.True(t, ok)
+		assert.Equal(t, key, otherKey)
+	})
+
+	t.Run("memory size changes the key", func(t *testing.T) {
+		key, _ := resumePoolKey(defaultVm(), config)
+		vm := defaultVm()
+		vm.Spec.Guest.MemorySlots.Max++
+		otherKey, ok := resumePoolKey(vm, config)
+		assert.True(t, ok)
+		assert.NotEqual(t, key, otherKey)
+	})
+
+	t.Run("only amd64 VMs can be resumed", func(t *testing.T) {
+		vm := defaultVm()
+		vm.Spec.TargetArchitecture = lo.ToPtr(vmv1.CPUArchitectureAMD64)
+		_, ok := resumePoolKey(vm, config)
+		assert.True(t, ok)
+
+		vm.Spec.TargetArchitecture = lo.ToPtr(vmv1.CPUArchitectureARM64)
+		_, ok = resumePoolKey(vm, config)
+		assert.False(t, ok)
+	})
+
+	t.Run("VMs with TLS can't be resumed", func(t *testing.T) {
+		vm := defaultVm()
+		//nolint:exhaustruct // this is a test
+		vm.Spec.TLS = &vmv1.TLSProvisioning{}
+		_, ok := resumePoolKey(vm, config)
+		assert.False(t, ok)
+	})
+}
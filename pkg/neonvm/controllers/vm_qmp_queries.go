@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -76,7 +78,9 @@ type MigrationInfo struct {
 	TotalTimeMs int64  `json:"total-time"`
 	SetupTimeMs int64  `json:"setup-time"`
 	DowntimeMs  int64  `json:"downtime"`
-	Ram         struct {
+	// ExpectedDowntimeMs is only set while the migration is active
+	ExpectedDowntimeMs int64 `json:"expected-downtime"`
+	Ram                struct {
 		Transferred    int64 `json:"transferred"`
 		Remaining      int64 `json:"remaining"`
 		Total          int64 `json:"total"`
@@ -84,6 +88,7 @@ type MigrationInfo struct {
 		Normal         int64 `json:"normal"`
 		NormalBytes    int64 `json:"normal-bytes"`
 		DirtySyncCount int64 `json:"dirty-sync-count"`
+		DirtyPagesRate int64 `json:"dirty-pages-rate"`
 	} `json:"ram"`
 	Compression struct {
 		CompressedSize  int64   `json:"compressed-size"`
@@ -95,13 +100,17 @@ func QmpAddr(vm *vmv1.VirtualMachine) (ip string, port int32) {
 	return vm.Status.PodIP, vm.Spec.QMP
 }
 
+// QmpConnect connects to the QMP socket at the address.
+//
+// Connection errors are marked as GuestUnreachable, so they can be told apart from errors returned
+// by QEMU itself.
 func QmpConnect(ip string, port int32) (*qmp.SocketMonitor, error) {
-	mon, err := qmp.NewSocketMonitor("tcp", fmt.Sprintf("%s:%d", ip, port), 2*time.Second)
+	mon, err := qmp.NewSocketMonitor("tcp", net.JoinHostPort(ip, strconv.Itoa(int(port))), 2*time.Second)
 	if err != nil {
-		return nil, err
+		return nil, GuestUnreachable(fmt.Errorf("QMP unreachable: %w", err))
 	}
 	if err := mon.Connect(); err != nil {
-		return nil, err
+		return nil, GuestUnreachable(fmt.Errorf("QMP unreachable: %w", err))
 	}
 
 	return mon, nil
@@ -339,33 +348,51 @@ func QmpGetMemorySize(ip string, port int32) (*resource.Quantity, error) {
 	return resource.NewQuantity(result.Return.BaseMemory+result.Return.PluggedMemory, resource.BinarySI), nil
 }
 
-func QmpStartMigration(virtualmachine *vmv1.VirtualMachine, virtualmachinemigration *vmv1.VirtualMachineMigration) error {
+func QmpStartMigration(
+	virtualmachine *vmv1.VirtualMachine,
+	virtualmachinemigration *vmv1.VirtualMachineMigration,
+	config *ReconcilerConfig,
+) error {
 	// QMP port
 	port := virtualmachine.Spec.QMP
 
 	// connect to source runner QMP
 	s_ip := virtualmachinemigration.Status.SourcePodIP
-	smon, err := qmp.NewSocketMonitor("tcp", fmt.Sprintf("%s:%d", s_ip, port), 2*time.Second)
+	smon, err := QmpConnect(s_ip, port)
 	if err != nil {
 		return err
 	}
-	if err := smon.Connect(); err != nil {
-		return err
-	}
 	defer smon.Disconnect() //nolint:errcheck // nothing to do with error when deferred. TODO: log it?
 
 	// connect to target runner QMP
 	t_ip := virtualmachinemigration.Status.TargetPodIP
-	tmon, err := qmp.NewSocketMonitor("tcp", fmt.Sprintf("%s:%d", t_ip, port), 2*time.Second)
+	tmon, err := QmpConnect(t_ip, port)
 	if err != nil {
 		return err
 	}
-	if err := tmon.Connect(); err != nil {
-		return err
-	}
 	defer tmon.Disconnect() //nolint:errcheck // nothing to do with error when deferred. TODO: log it?
 
 	cache := resource.MustParse("256Mi")
+	maxBandwidth, maxDowntimeMillis := migrationLimits(virtualmachinemigration, config)
+
+	// multifd replaces the single-stream compression and xbzrle, which QEMU doesn't support with it.
+	multifd := virtualmachinemigration.Spec.Multifd
+	multifdChannels := int32(0)
+	multifdCompression := vmv1.MultifdCompressionZstd
+	if multifd != nil {
+		for _, mon := range []*qmp.SocketMonitor{smon, tmon} {
+			supported, err := qmpSupportsMigrationCapability(mon, "multifd")
+			if err != nil {
+				return err
+			}
+			if !supported {
+				return errors.New("multifd migration is not supported by both source and target QEMU")
+			}
+		}
+		multifdChannels = multifd.GetChannels()
+		multifdCompression = multifd.GetCompression()
+	}
+	singleStream := multifd == nil
 	var qmpcmd []byte
 	// setup migration on source runner
 	qmpcmd = []byte(fmt.Sprintf(`{
@@ -374,13 +401,15 @@ func QmpStartMigration(virtualmachine *vmv1.VirtualMachine, virtualmachinemigrat
 		    {
 			"capabilities": [
 			    {"capability": "postcopy-ram",  "state": %t},
-			    {"capability": "xbzrle",        "state": true},
-			    {"capability": "compress",      "state": true},
+			    {"capability": "xbzrle",        "state": %t},
+			    {"capability": "compress",      "state": %t},
 			    {"capability": "auto-converge", "state": %t},
-			    {"capability": "zero-blocks",   "state": true}
+			    {"capability": "zero-blocks",   "state": true},
+			    {"capability": "multifd",       "state": %t}
 			]
 		    }
-		}`, virtualmachinemigration.Spec.AllowPostCopy, virtualmachinemigration.Spec.AutoConverge))
+		}`, virtualmachinemigration.Spec.AllowPostCopy, singleStream, singleStream,
+		virtualmachinemigration.Spec.AutoConverge, !singleStream))
 	_, err = smon.Run(qmpcmd)
 	if err != nil {
 		return err
@@ -391,9 +420,11 @@ func QmpStartMigration(virtualmachine *vmv1.VirtualMachine, virtualmachinemigrat
 		    {
 			"xbzrle-cache-size":   %d,
 			"max-bandwidth":       %d,
-			"multifd-compression": "zstd"
+			"downtime-limit":      %d,
+			%s
+			"multifd-compression": %q
 		    }
-		}`, cache.Value(), virtualmachinemigration.Spec.MaxBandwidth.Value()))
+		}`, cache.Value(), maxBandwidth, maxDowntimeMillis, multifdChannelsParam(multifdChannels), multifdCompression))
 	_, err = smon.Run(qmpcmd)
 	if err != nil {
 		return err
@@ -406,13 +437,15 @@ func QmpStartMigration(virtualmachine *vmv1.VirtualMachine, virtualmachinemigrat
 		    {
 			"capabilities": [
 			    {"capability": "postcopy-ram",  "state": %t},
-			    {"capability": "xbzrle",        "state": true},
-			    {"capability": "compress",      "state": true},
+			    {"capability": "xbzrle",        "state": %t},
+			    {"capability": "compress",      "state": %t},
 			    {"capability": "auto-converge", "state": %t},
-			    {"capability": "zero-blocks",   "state": true}
+			    {"capability": "zero-blocks",   "state": true},
+			    {"capability": "multifd",       "state": %t}
 			]
 		    }
-		}`, virtualmachinemigration.Spec.AllowPostCopy, virtualmachinemigration.Spec.AutoConverge))
+		}`, virtualmachinemigration.Spec.AllowPostCopy, singleStream, singleStream,
+		virtualmachinemigration.Spec.AutoConverge, !singleStream))
 	_, err = tmon.Run(qmpcmd)
 	if err != nil {
 		return err
@@ -423,24 +456,33 @@ func QmpStartMigration(virtualmachine *vmv1.VirtualMachine, virtualmachinemigrat
 		    {
 			"xbzrle-cache-size":   %d,
 			"max-bandwidth":       %d,
-			"multifd-compression": "zstd"
+			"downtime-limit":      %d,
+			%s
+			"multifd-compression": %q
 		    }
-		}`, cache.Value(), virtualmachinemigration.Spec.MaxBandwidth.Value()))
+		}`, cache.Value(), maxBandwidth, maxDowntimeMillis, multifdChannelsParam(multifdChannels), multifdCompression))
 	_, err = tmon.Run(qmpcmd)
 	if err != nil {
 		return err
 	}
 
+	// with mirror, the disks are already being copied separately (see QmpMirrorDisksToTarget)
+	blockInc, blockFull := false, false
+	if virtualmachinemigration.Spec.GetDiskMigration() == vmv1.DiskMigrationModeBlock {
+		blockInc = virtualmachinemigration.Spec.Incremental
+		blockFull = !virtualmachinemigration.Spec.Incremental
+	}
+
 	// trigger migration
 	qmpcmd = []byte(fmt.Sprintf(`{
 		"execute": "migrate",
 		"arguments":
 		    {
-			"uri": "tcp:%s:%d",
+			"uri": "tcp:%s",
 			"inc": %t,
 			"blk": %t
 		    }
-		}`, t_ip, vmv1.MigrationPort, virtualmachinemigration.Spec.Incremental, !virtualmachinemigration.Spec.Incremental))
+		}`, net.JoinHostPort(t_ip, strconv.Itoa(int(vmv1.MigrationPort))), blockInc, blockFull))
 	_, err = smon.Run(qmpcmd)
 	if err != nil {
 		return err
@@ -456,6 +498,53 @@ func QmpStartMigration(virtualmachine *vmv1.VirtualMachine, virtualmachinemigrat
 	return nil
 }
 
+// multifdChannelsParam returns the 'multifd-channels' migration parameter, if multifd is enabled.
+func multifdChannelsParam(channels int32) string {
+	if channels == 0 {
+		return ""
+	}
+	return fmt.Sprintf(`"multifd-channels":    %d,`, channels)
+}
+
+// qmpSupportsMigrationCapability returns whether QEMU has the migration capability, whether or
+// not it's currently enabled.
+func qmpSupportsMigrationCapability(mon *qmp.SocketMonitor, capability string) (bool, error) {
+	raw, err := mon.Run([]byte(`{"execute": "query-migrate-capabilities"}`))
+	if err != nil {
+		return false, err
+	}
+
+	var result struct {
+		Return []struct {
+			Capability string `json:"capability"`
+		} `json:"return"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return false, fmt.Errorf("error unmarshaling json: %w", err)
+	}
+
+	for _, c := range result.Return {
+		if c.Capability == capability {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// migrationLimits returns the migration's maximum bandwidth in bytes per second, and maximum
+// downtime in milliseconds, falling back to the controller's defaults for any that aren't set.
+func migrationLimits(migration *vmv1.VirtualMachineMigration, config *ReconcilerConfig) (int64, int64) {
+	maxBandwidth := migration.Spec.MaxBandwidth.Value()
+	if maxBandwidth == 0 {
+		maxBandwidth = config.MigrationMaxBandwidth.Value()
+	}
+	maxDowntimeMillis := config.MigrationMaxDowntime.Milliseconds()
+	if migration.Spec.MaxDowntimeMillis != nil {
+		maxDowntimeMillis = *migration.Spec.MaxDowntimeMillis
+	}
+	return maxBandwidth, maxDowntimeMillis
+}
+
 func QmpGetMigrationInfo(ip string, port int32) (*MigrationInfo, error) {
 	mon, err := QmpConnect(ip, port)
 	if err != nil {
@@ -490,9 +579,314 @@ func QmpCancelMigration(ip string, port int32) error {
 		return err
 	}
 
+	// also stop copying disks, if they were being mirrored
+	jobs, err := qmpDiskMirrorJobs(mon)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		qmpcmd = []byte(fmt.Sprintf(`{"execute": "block-job-cancel", "arguments": {"device": %q, "force": true}}`, job.Device))
+		if _, err := mon.Run(qmpcmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// diskMirrorJobPrefix is the prefix of the IDs of the block jobs that mirror disks to the target
+// runner during a migration.
+const diskMirrorJobPrefix = "migrate-"
+
+type qmpBlockJob struct {
+	Device string `json:"device"`
+	Ready  bool   `json:"ready"`
+}
+
+// qmpDiskMirrorJobs returns the block jobs that are mirroring disks for a migration.
+func qmpDiskMirrorJobs(mon *qmp.SocketMonitor) ([]qmpBlockJob, error) {
+	raw, err := mon.Run([]byte(`{"execute": "query-block-jobs"}`))
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Return []qmpBlockJob `json:"return"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("error unmarshaling json: %w", err)
+	}
+
+	var jobs []qmpBlockJob
+	for _, job := range result.Return {
+		if strings.HasPrefix(job.Device, diskMirrorJobPrefix) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// qmpBlockDevice is a block device, as returned by 'query-block'.
+type qmpBlockDevice struct {
+	Device    string `json:"device"`
+	Removable bool   `json:"removable"`
+	// Inserted is the disk, or nil if there's none (e.g. an empty CD-ROM drive).
+	Inserted *struct {
+		NodeName string `json:"node-name"`
+		ReadOnly bool   `json:"ro"`
+	} `json:"inserted"`
+}
+
+func qmpBlockDevices(mon *qmp.SocketMonitor) ([]qmpBlockDevice, error) {
+	raw, err := mon.Run([]byte(`{"execute": "query-block"}`))
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Return []qmpBlockDevice `json:"return"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("error unmarshaling json: %w", err)
+	}
+	return result.Return, nil
+}
+
+// qmpWritableDisks returns the names of the VM's writable disks, which hold state that would be
+// lost if they weren't copied to the target. Read-only disks and CD-ROMs are recreated by the
+// target runner instead.
+func qmpWritableDisks(mon *qmp.SocketMonitor) ([]string, error) {
+	devices, err := qmpBlockDevices(mon)
+	if err != nil {
+		return nil, err
+	}
+
+	var disks []string
+	for _, d := range devices {
+		if d.Inserted != nil && !d.Inserted.ReadOnly && !d.Removable {
+			disks = append(disks, d.Device)
+		}
+	}
+	return disks, nil
+}
+
+// qmpDiskNodeNames returns the name of the top block node of each disk, by device name.
+//
+// Unlike device names, node names can differ between the source and target, because QEMU
+// generates them for disks that don't set one.
+func qmpDiskNodeNames(mon *qmp.SocketMonitor) (map[string]string, error) {
+	devices, err := qmpBlockDevices(mon)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeNames := make(map[string]string)
+	for _, d := range devices {
+		if d.Inserted != nil {
+			nodeNames[d.Device] = d.Inserted.NodeName
+		}
+	}
+	return nodeNames, nil
+}
+
+// QmpMirrorDisksToTarget starts copying the VM's writable disks to the target runner over NBD, or
+// checks on the copies if they were already started. It returns whether all disks are in sync,
+// after which the memory migration can start.
+//
+// Once in sync, writes are made to both source and target, so the disks stay in sync until the
+// source is stopped at the end of the migration.
+func QmpMirrorDisksToTarget(
+	virtualmachine *vmv1.VirtualMachine,
+	virtualmachinemigration *vmv1.VirtualMachineMigration,
+) (bool, error) {
+	port := virtualmachine.Spec.QMP
+
+	smon, err := QmpConnect(virtualmachinemigration.Status.SourcePodIP, port)
+	if err != nil {
+		return false, err
+	}
+	defer smon.Disconnect() //nolint:errcheck // nothing to do with error when deferred. TODO: log it?
+
+	jobs, err := qmpDiskMirrorJobs(smon)
+	if err != nil {
+		return false, err
+	}
+	if len(jobs) != 0 {
+		for _, job := range jobs {
+			if !job.Ready {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	disks, err := qmpWritableDisks(smon)
+	if err != nil {
+		return false, err
+	}
+	if len(disks) == 0 {
+		return true, nil
+	}
+
+	t_ip := virtualmachinemigration.Status.TargetPodIP
+	tmon, err := QmpConnect(t_ip, port)
+	if err != nil {
+		return false, err
+	}
+	defer tmon.Disconnect() //nolint:errcheck // nothing to do with error when deferred. TODO: log it?
+
+	nodeNames, err := qmpDiskNodeNames(tmon)
+	if err != nil {
+		return false, err
+	}
+	for _, disk := range disks {
+		if _, ok := nodeNames[disk]; !ok {
+			return false, fmt.Errorf("disk %q not found in target", disk)
+		}
+	}
+
+	// export the target's disks over NBD. Stop the server first, in case an earlier attempt
+	// started it but didn't get as far as starting the mirror jobs. This also removes its exports.
+	_, _ = tmon.Run([]byte(`{"execute": "nbd-server-stop"}`))
+	qmpcmd := []byte(fmt.Sprintf(`{
+		"execute": "nbd-server-start",
+		"arguments": {"addr": {"type": "inet", "data": {"host": %q, "port": "%d"}}}
+	}`, t_ip, vmv1.MigrationNBDPort))
+	if _, err := tmon.Run(qmpcmd); err != nil {
+		return false, err
+	}
+	for _, disk := range disks {
+		// Each disk is exported under its device name, which is the same on the source.
+		qmpcmd = []byte(fmt.Sprintf(`{
+			"execute": "block-export-add",
+			"arguments": {"type": "nbd", "id": %q, "node-name": %q, "name": %q, "writable": true}
+		}`, disk, nodeNames[disk], disk))
+		if _, err := tmon.Run(qmpcmd); err != nil {
+			return false, err
+		}
+	}
+
+	// ... and mirror the source's disks into them. With write-blocking, guest writes only complete
+	// once they've been written to the target too, so the copy can't fall behind once it's ready.
+	for _, disk := range disks {
+		// NB: the target is exported as the disk's contents, without the image format.
+		target := fmt.Sprintf("nbd:%s:exportname=%s", net.JoinHostPort(t_ip, strconv.Itoa(int(vmv1.MigrationNBDPort))), disk)
+		qmpcmd = []byte(fmt.Sprintf(`{
+			"execute": "drive-mirror",
+			"arguments": {
+				"job-id":    %q,
+				"device":    %q,
+				"target":    %q,
+				"format":    "raw",
+				"sync":      "full",
+				"mode":      "existing",
+				"copy-mode": "write-blocking"
+			}
+		}`, diskMirrorJobPrefix+disk, disk, target))
+		if _, err := smon.Run(qmpcmd); err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// QmpFinishDiskMirrors stops mirroring the VM's disks once the migration has completed, leaving
+// the target's copies as they were when the source stopped.
+func QmpFinishDiskMirrors(
+	virtualmachine *vmv1.VirtualMachine,
+	virtualmachinemigration *vmv1.VirtualMachineMigration,
+) error {
+	port := virtualmachine.Spec.QMP
+
+	smon, err := QmpConnect(virtualmachinemigration.Status.SourcePodIP, port)
+	if err != nil {
+		return err
+	}
+	defer smon.Disconnect() //nolint:errcheck // nothing to do with error when deferred. TODO: log it?
+
+	jobs, err := qmpDiskMirrorJobs(smon)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		// Cancelling a mirror job that's ready completes it without switching the source over to
+		// the copy, which is what we want: the source is about to be stopped.
+		qmpcmd := []byte(fmt.Sprintf(`{"execute": "block-job-cancel", "arguments": {"device": %q}}`, job.Device))
+		if _, err := smon.Run(qmpcmd); err != nil {
+			return err
+		}
+	}
+
+	tmon, err := QmpConnect(virtualmachinemigration.Status.TargetPodIP, port)
+	if err != nil {
+		return err
+	}
+	defer tmon.Disconnect() //nolint:errcheck // nothing to do with error when deferred. TODO: log it?
+
+	if _, err := tmon.Run([]byte(`{"execute": "nbd-server-stop"}`)); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// QmpGetVersion returns the version of QEMU running the VM.
+func QmpGetVersion(ip string, port int32) (qemuVersion, error) {
+	mon, err := QmpConnect(ip, port)
+	if err != nil {
+		return qemuVersion{}, err
+	}
+	defer mon.Disconnect() //nolint:errcheck // nothing to do with error when deferred. TODO: log it?
+
+	qmpcmd := []byte(`{"execute": "query-version"}`)
+	raw, err := mon.Run(qmpcmd)
+	if err != nil {
+		return qemuVersion{}, err
+	}
+
+	var result struct {
+		Return struct {
+			Qemu qemuVersion `json:"qemu"`
+		} `json:"return"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return qemuVersion{}, fmt.Errorf("error unmarshaling json: %w", err)
+	}
+
+	return result.Return.Qemu, nil
+}
+
+// QmpGetMemoryDeviceTypes returns the type of each of the VM's memory devices, e.g. "virtio-mem".
+func QmpGetMemoryDeviceTypes(ip string, port int32) ([]string, error) {
+	mon, err := QmpConnect(ip, port)
+	if err != nil {
+		return nil, err
+	}
+	defer mon.Disconnect() //nolint:errcheck // nothing to do with error when deferred. TODO: log it?
+
+	qmpcmd := []byte(`{"execute": "query-memory-devices"}`)
+	raw, err := mon.Run(qmpcmd)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Return []struct {
+			Type string `json:"type"`
+		} `json:"return"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("error unmarshaling json: %w", err)
+	}
+
+	var types []string
+	for _, d := range result.Return {
+		types = append(types, d.Type)
+	}
+	return types, nil
+}
+
 func QmpQuit(ip string, port int32) error {
 	mon, err := QmpConnect(ip, port)
 	if err != nil {
@@ -0,0 +1,204 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// qmpReturn is a successful QMP response with the value.
+func qmpReturn(value any) any {
+	return map[string]any{"return": value}
+}
+
+// qmpArgs returns the command's arguments, as parsed from JSON.
+func qmpArgs(t *testing.T, cmd fakeQMPCommand) map[string]any {
+	var args map[string]any
+	require.NoError(t, json.Unmarshal(cmd.Arguments, &args))
+	return args
+}
+
+func qmpExecuted(commands []fakeQMPCommand) []string {
+	var executed []string
+	for _, cmd := range commands {
+		executed = append(executed, cmd.Execute)
+	}
+	return executed
+}
+
+// diskMirrorTest has the source and target of a migration, each with their own fake QMP server.
+type diskMirrorTest struct {
+	vm        *vmv1.VirtualMachine
+	migration *vmv1.VirtualMachineMigration
+	source    *fakeQMPServer
+	target    *fakeQMPServer
+}
+
+// newDiskMirrorTest starts fake QMP servers for the source and target, answering each command with
+// the value from the maps, or an empty response for commands that aren't in them.
+func newDiskMirrorTest(t *testing.T, sourceReturns, targetReturns map[string]any) *diskMirrorTest {
+	handler := func(returns map[string]any) func(cmd fakeQMPCommand) any {
+		return func(cmd fakeQMPCommand) any {
+			if value, ok := returns[cmd.Execute]; ok {
+				return qmpReturn(value)
+			}
+			return qmpReturn(map[string]any{})
+		}
+	}
+
+	// Both runners' QMP is on the same port, so they're on different loopback addresses.
+	source := startFakeQMP(t, handler(sourceReturns))
+	target := startFakeQMPAt(t, net.JoinHostPort("127.0.0.2", strconv.Itoa(int(source.port))), handler(targetReturns))
+
+	vm := defaultVm()
+	vm.Spec.QMP = source.port
+	//nolint:exhaustruct // only the pod IPs are used
+	migration := &vmv1.VirtualMachineMigration{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-migration", Namespace: vm.Namespace},
+		Status:     vmv1.VirtualMachineMigrationStatus{SourcePodIP: source.ip, TargetPodIP: target.ip},
+	}
+	return &diskMirrorTest{vm: vm, migration: migration, source: source, target: target}
+}
+
+func TestQmpMirrorDisksToTarget(t *testing.T) {
+	disk := func(device string, nodeName string, readOnly, removable bool) map[string]any {
+		return map[string]any{
+			"device":    device,
+			"removable": removable,
+			"inserted":  map[string]any{"node-name": nodeName, "ro": readOnly},
+		}
+	}
+	sourceDisks := []any{
+		disk("rootdisk", "#block100", true, false),
+		disk("cdrom", "#block200", false, true),
+		map[string]any{"device": "empty", "removable": true},
+		disk("data", "#block300", false, false),
+	}
+	// QEMU generates different node names on the target
+	targetDisks := []any{
+		disk("rootdisk", "#block110", true, false),
+		disk("cdrom", "#block210", false, true),
+		disk("data", "#block310", false, false),
+	}
+
+	t.Run("StartsMirrors", func(t *testing.T) {
+		test := newDiskMirrorTest(t,
+			map[string]any{"query-block-jobs": []any{}, "query-block": sourceDisks},
+			map[string]any{"query-block": targetDisks},
+		)
+
+		ready, err := QmpMirrorDisksToTarget(test.vm, test.migration)
+		require.NoError(t, err)
+		assert.False(t, ready)
+
+		// Only the writable disk is exported by the target, by its node name there
+		target := test.target.received()
+		require.Equal(t, []string{"query-block", "nbd-server-stop", "nbd-server-start", "block-export-add"}, qmpExecuted(target))
+		assert.Equal(t, map[string]any{
+			"addr": map[string]any{
+				"type": "inet",
+				"data": map[string]any{"host": "127.0.0.2", "port": strconv.Itoa(int(vmv1.MigrationNBDPort))},
+			},
+		}, qmpArgs(t, target[2]))
+		assert.Equal(t, map[string]any{
+			"type":      "nbd",
+			"id":        "data",
+			"node-name": "#block310",
+			"name":      "data",
+			"writable":  true,
+		}, qmpArgs(t, target[3]))
+
+		// ... and mirrored into by the source, using the export's name
+		source := test.source.received()
+		require.Equal(t, []string{"query-block-jobs", "query-block", "drive-mirror"}, qmpExecuted(source))
+		assert.Equal(t, map[string]any{
+			"job-id":    "migrate-data",
+			"device":    "data",
+			"target":    "nbd:127.0.0.2:20188:exportname=data",
+			"format":    "raw",
+			"sync":      "full",
+			"mode":      "existing",
+			"copy-mode": "write-blocking",
+		}, qmpArgs(t, source[2]))
+	})
+
+	t.Run("MirrorsNotReady", func(t *testing.T) {
+		test := newDiskMirrorTest(t, map[string]any{
+			"query-block-jobs": []any{
+				map[string]any{"device": "migrate-data", "ready": true},
+				map[string]any{"device": "migrate-data2", "ready": false},
+			},
+		}, nil)
+
+		ready, err := QmpMirrorDisksToTarget(test.vm, test.migration)
+		require.NoError(t, err)
+		assert.False(t, ready)
+		assert.Equal(t, []string{"query-block-jobs"}, qmpExecuted(test.source.received()))
+		assert.Empty(t, test.target.received())
+	})
+
+	t.Run("MirrorsReady", func(t *testing.T) {
+		test := newDiskMirrorTest(t, map[string]any{
+			"query-block-jobs": []any{
+				map[string]any{"device": "migrate-data", "ready": true},
+				// other block jobs are ignored
+				map[string]any{"device": "backup-data", "ready": false},
+			},
+		}, nil)
+
+		ready, err := QmpMirrorDisksToTarget(test.vm, test.migration)
+		require.NoError(t, err)
+		assert.True(t, ready)
+		assert.Empty(t, test.target.received())
+	})
+
+	t.Run("NoWritableDisks", func(t *testing.T) {
+		test := newDiskMirrorTest(t,
+			map[string]any{"query-block-jobs": []any{}, "query-block": sourceDisks[:3]},
+			nil,
+		)
+
+		ready, err := QmpMirrorDisksToTarget(test.vm, test.migration)
+		require.NoError(t, err)
+		assert.True(t, ready)
+		assert.Empty(t, test.target.received())
+	})
+
+	t.Run("DiskMissingFromTarget", func(t *testing.T) {
+		test := newDiskMirrorTest(t,
+			map[string]any{"query-block-jobs": []any{}, "query-block": sourceDisks},
+			map[string]any{"query-block": targetDisks[:2]},
+		)
+
+		_, err := QmpMirrorDisksToTarget(test.vm, test.migration)
+		assert.ErrorContains(t, err, `disk "data" not found in target`)
+		assert.Equal(t, []string{"query-block"}, qmpExecuted(test.target.received()))
+	})
+}
+
+func TestQmpFinishDiskMirrors(t *testing.T) {
+	test := newDiskMirrorTest(t, map[string]any{
+		"query-block-jobs": []any{
+			map[string]any{"device": "migrate-data", "ready": true},
+			map[string]any{"device": "backup-data", "ready": true},
+		},
+	}, nil)
+
+	require.NoError(t, QmpFinishDiskMirrors(test.vm, test.migration))
+
+	// Only the mirror jobs are cancelled, which completes them without switching over
+	source := test.source.received()
+	require.Equal(t, []string{"query-block-jobs", "block-job-cancel"}, qmpExecuted(source))
+	assert.Equal(t, map[string]any{"device": "migrate-data"}, qmpArgs(t, source[1]))
+
+	// ... and the target's NBD server is stopped, along with its exports
+	assert.Equal(t, []string{"nbd-server-stop"}, qmpExecuted(test.target.received()))
+}
@@ -0,0 +1,170 @@
+package controllers
+
+// Image pre-pulling: for each VirtualMachineImage, we maintain a DaemonSet that runs a container
+// from the image on each selected node. This makes the kubelet pull the image as soon as it's
+// registered (or a node is added), rather than when the first VM using it starts on the node --
+// and because the image stays in use, it isn't removed by the kubelet's image garbage collection.
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	"github.com/samber/lo"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// VirtualMachineImageReconciler reconciles a VirtualMachineImage object
+type VirtualMachineImageReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	Config   *ReconcilerConfig
+
+	Metrics ReconcilerMetrics
+}
+
+//+kubebuilder:rbac:groups=vm.neon.tech,resources=virtualmachineimages,verbs=get;list;watch
+//+kubebuilder:rbac:groups=vm.neon.tech,resources=virtualmachineimages/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=vm.neon.tech,resources=virtualmachineimages/finalizers,verbs=update
+//+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+func (r *VirtualMachineImageReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	var image vmv1.VirtualMachineImage
+	if err := r.Get(ctx, req.NamespacedName, &image); err != nil {
+		// ignore error and stop reconcile loop if object not found (already deleted?)
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !image.DeletionTimestamp.IsZero() {
+		// The DaemonSet is deleted with the image.
+		return ctrl.Result{}, nil
+	}
+
+	desired := prePullDaemonSet(&image)
+	if err := ctrl.SetControllerReference(&image, desired, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var ds appsv1.DaemonSet
+	err := r.Get(ctx, client.ObjectKeyFromObject(desired), &ds)
+	switch {
+	case apierrors.IsNotFound(err):
+		log.Info("Creating pre-pull DaemonSet", "DaemonSet", desired.Name, "image", image.Spec.Image)
+		if err := r.Create(ctx, desired); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to create pre-pull DaemonSet: %w", err)
+		}
+		r.Recorder.Eventf(&image, "Normal", "Created", "Created DaemonSet %s to pre-pull %s", desired.Name, image.Spec.Image)
+		ds = *desired
+	case err != nil:
+		return ctrl.Result{}, fmt.Errorf("failed to get pre-pull DaemonSet: %w", err)
+	case !metav1.IsControlledBy(&ds, &image):
+		return ctrl.Result{}, InvalidSpec(fmt.Errorf("DaemonSet %s already exists and is not owned by the image", ds.Name))
+	case !equality.Semantic.DeepDerivative(desired.Spec, ds.Spec) || !maps.Equal(desired.Labels, ds.Labels):
+		// DeepDerivative ignores fields that are only set in the existing DaemonSet, so the
+		// defaults filled in by the API server don't cause an update every time.
+		log.Info("Updating pre-pull DaemonSet", "DaemonSet", ds.Name, "image", image.Spec.Image)
+		ds.Labels = desired.Labels
+		ds.Spec = desired.Spec
+		if err := r.Update(ctx, &ds); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update pre-pull DaemonSet: %w", err)
+		}
+	}
+
+	status := vmv1.VirtualMachineImageStatus{
+		DesiredNodes:       ds.Status.DesiredNumberScheduled,
+		ReadyNodes:         ds.Status.NumberReady,
+		ObservedGeneration: image.Generation,
+	}
+	if status != image.Status {
+		image.Status = status
+		if err := r.Status().Update(ctx, &image); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update image status: %w", err)
+		}
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// prePullDaemonSet returns the DaemonSet that pre-pulls the image
+func prePullDaemonSet(image *vmv1.VirtualMachineImage) *appsv1.DaemonSet {
+	labels := map[string]string{vmv1.VirtualMachineImageLabel: image.Name}
+
+	//nolint:exhaustruct // Other fields are left for the API server to default
+	return &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("vmimage-%s", image.Name),
+			Namespace: image.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: maps.Clone(labels)},
+				Spec: corev1.PodSpec{
+					NodeSelector:                 image.Spec.NodeSelector,
+					Tolerations:                  image.Spec.Tolerations,
+					ImagePullSecrets:             image.Spec.ImagePullSecrets,
+					AutomountServiceAccountToken: lo.ToPtr(false),
+					Containers: []corev1.Container{{
+						Name:            "prepull",
+						Image:           image.Spec.Image,
+						ImagePullPolicy: corev1.PullIfNotPresent,
+						// Guest images include a shell (see the runner pod's init container), so
+						// we can just wait there until the pod is deleted.
+						Command: []string{
+							"sh", "-c",
+							"trap 'exit 0' TERM; while true; do sleep 3600 & wait $!; done",
+						},
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU:    resource.MustParse("1m"),
+								corev1.ResourceMemory: resource.MustParse("8Mi"),
+							},
+							Limits: corev1.ResourceList{
+								corev1.ResourceMemory: resource.MustParse("16Mi"),
+							},
+						},
+					}},
+				},
+			},
+		},
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *VirtualMachineImageReconciler) SetupWithManager(mgr ctrl.Manager) (ReconcilerWithMetrics, error) {
+	cntrlName := "virtualmachineimage"
+	reconciler := WithMetrics(
+		withCatchPanic(r),
+		r.Metrics,
+		cntrlName,
+		r.Config.FailurePendingPeriod,
+		r.Config.FailingRefreshInterval,
+		r.Config.SlowReconcileThreshold,
+		r.Config.QMPRetryRateLimit,
+	)
+	err := ctrl.NewControllerManagedBy(mgr).
+		For(&vmv1.VirtualMachineImage{}).
+		Owns(&appsv1.DaemonSet{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.Config.MaxConcurrentReconciles}).
+		Named(cntrlName).
+		Complete(reconciler)
+	return reconciler, err
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+func TestVMImagePrePull(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, vmv1.AddToScheme(scheme))
+	require.NoError(t, appsv1.AddToScheme(scheme))
+
+	image := &vmv1.VirtualMachineImage{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "postgres-16",
+			Namespace: "default",
+			UID:       types.UID("image-uid"),
+		},
+		Spec: vmv1.VirtualMachineImageSpec{
+			Image:            "vm-postgres:16",
+			NodeSelector:     map[string]string{"neon/pool": "compute"},
+			Tolerations:      nil,
+			ImagePullSecrets: nil,
+		},
+		Status: vmv1.VirtualMachineImageStatus{DesiredNodes: 0, ReadyNodes: 0, ObservedGeneration: 0},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(image).WithStatusSubresource(image).Build()
+
+	//nolint:exhaustruct // Only the fields used by the image reconciler
+	r := &VirtualMachineImageReconciler{
+		Client:   c,
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+	}
+	ctx := context.Background()
+	doReconcile := func() {
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(image)})
+		require.NoError(t, err)
+	}
+	getDaemonSet := func() *appsv1.DaemonSet {
+		var ds appsv1.DaemonSet
+		key := client.ObjectKey{Namespace: "default", Name: "vmimage-postgres-16"}
+		require.NoError(t, c.Get(ctx, key, &ds))
+		return &ds
+	}
+
+	doReconcile()
+
+	ds := getDaemonSet()
+	assert.True(t, metav1.IsControlledBy(ds, image))
+	require.Len(t, ds.Spec.Template.Spec.Containers, 1)
+	assert.Equal(t, "vm-postgres:16", ds.Spec.Template.Spec.Containers[0].Image)
+	assert.Equal(t, corev1.PullIfNotPresent, ds.Spec.Template.Spec.Containers[0].ImagePullPolicy)
+	assert.Equal(t, image.Spec.NodeSelector, ds.Spec.Template.Spec.NodeSelector)
+
+	// Changes to the image are applied to the DaemonSet
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(image), image))
+	image.Spec.Image = "vm-postgres:16.1"
+	require.NoError(t, c.Update(ctx, image))
+	doReconcile()
+	assert.Equal(t, "vm-postgres:16.1", getDaemonSet().Spec.Template.Spec.Containers[0].Image)
+
+	// Status reflects the DaemonSet's progress
+	ds = getDaemonSet()
+	ds.Status.DesiredNumberScheduled = 3
+	ds.Status.NumberReady = 2
+	require.NoError(t, c.Status().Update(ctx, ds))
+	doReconcile()
+
+	require.NoError(t, c.Get(ctx, client.ObjectKeyFromObject(image), image))
+	assert.Equal(t, int32(3), image.Status.DesiredNodes)
+	assert.Equal(t, int32(2), image.Status.ReadyNodes)
+}
@@ -20,7 +20,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"math"
+	"slices"
+	"strings"
 	"time"
 
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -40,6 +43,7 @@ import (
 
 	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
 	"github.com/neondatabase/autoscaling/pkg/neonvm/controllers/buildtag"
+	"github.com/neondatabase/autoscaling/pkg/util"
 )
 
 const virtualmachinemigrationFinalizer = "vm.neon.tech/finalizer"
@@ -68,6 +72,23 @@ func (r *VirtualMachineMigrationReconciler) createTargetPod(
 	vm *vmv1.VirtualMachine,
 ) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
+
+	// Check that the migration can succeed before creating the target pod, so that it fails fast
+	// with a clear reason instead of timing out later.
+	sourcePod := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Name: vm.Status.PodName, Namespace: vm.Namespace}, sourcePod); err != nil {
+		logger.Error(err, "Failed to get migration source pod")
+		return ctrl.Result{}, err
+	}
+	precheck, err := r.precheckMigration(ctx, migration, vm, sourcePod)
+	if err != nil {
+		logger.Error(err, "Failed to run migration prechecks")
+		return ctrl.Result{}, err
+	}
+	if precheck.failure != "" {
+		return r.failMigrationPrecheck(ctx, migration, precheck.failure)
+	}
+
 	// NB: .Spec.EnableSSH guaranteed non-nil because the k8s API server sets the default for us.
 	enableSSH := *vm.Spec.EnableSSH
 	var sshSecret *corev1.Secret
@@ -92,15 +113,24 @@ func (r *VirtualMachineMigrationReconciler) createTargetPod(
 	}
 
 	// Define a new target pod
-	tpod, err := r.targetPodForVirtualMachine(vm, migration, sshSecret)
+	tpod, err := r.targetPodForVirtualMachine(ctx, vm, migration, sshSecret, precheck.nodeLabels)
 	if err != nil {
 		logger.Error(err, "Failed to generate Target Pod spec")
 		return ctrl.Result{}, err
 	}
+	// The guest keeps running through the migration, so the target has the same boot config as
+	// the source, even if the VM's spec has changed since.
+	if hash, ok := sourcePod.Annotations[vmv1.RunnerPodBootConfigAnnotation]; ok {
+		tpod.Annotations[vmv1.RunnerPodBootConfigAnnotation] = hash
+	} else {
+		delete(tpod.Annotations, vmv1.RunnerPodBootConfigAnnotation)
+	}
+	// ... and the same root disk.
+	setPodRootDiskImage(tpod, podRootDiskImage(sourcePod))
 	logger.Info("Creating a Target Pod", "Pod.Namespace", tpod.Namespace, "Pod.Name", tpod.Name)
-	if err = r.Create(ctx, tpod); err != nil {
+	if err := r.Create(ctx, tpod); err != nil {
 		logger.Error(err, "Failed to create Target Pod", "Pod.Namespace", tpod.Namespace, "Pod.Name", tpod.Name)
-		return ctrl.Result{}, err
+		return ctrl.Result{}, fmt.Errorf("%w: %w", errRunnerPodCreation, err)
 	}
 	logger.Info("Target runner Pod was created", "Pod.Namespace", tpod.Namespace, "Pod.Name", tpod.Name)
 	// add event with some info
@@ -111,6 +141,27 @@ func (r *VirtualMachineMigrationReconciler) createTargetPod(
 	return ctrl.Result{RequeueAfter: time.Second}, nil
 }
 
+// failMigrationPrecheck marks the migration as failed because one of its prechecks didn't pass.
+func (r *VirtualMachineMigrationReconciler) failMigrationPrecheck(
+	ctx context.Context,
+	migration *vmv1.VirtualMachineMigration,
+	reason string,
+) (ctrl.Result, error) {
+	message := fmt.Sprintf("Migration precheck failed: %s", reason)
+	log.FromContext(ctx).Info(message)
+	r.Recorder.Event(migration, "Warning", "PrecheckFailed", message)
+	r.Metrics.ObserveMigrationFailed(migration, "PrecheckFailed", nil)
+	meta.SetStatusCondition(&migration.Status.Conditions,
+		metav1.Condition{
+			Type:    typeDegradedVirtualMachineMigration,
+			Status:  metav1.ConditionTrue,
+			Reason:  "PrecheckFailed",
+			Message: message,
+		})
+	migration.Status.Phase = vmv1.VmmFailed
+	return r.updateMigrationStatus(ctx, migration)
+}
+
 // The following markers are used to generate the rules permissions (RBAC) on config/rbac using controller-gen
 // when controller-gen (used by 'make generate') is executed.
 // To know more about markers see: https://book.kubebuilder.io/reference/markers.html
@@ -121,6 +172,7 @@ func (r *VirtualMachineMigrationReconciler) createTargetPod(
 //+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 //+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=core,resources=pods/status,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -165,6 +217,7 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 		if controllerutil.ContainsFinalizer(migration, virtualmachinemigrationFinalizer) {
 			// our finalizer is present, so lets handle any external dependency
 			log.Info("Performing Finalizer Operations for Migration")
+			r.Metrics.ForgetMigrationProgress(migration)
 			vm, err := getVM()
 			if err != nil {
 				return ctrl.Result{}, err
@@ -209,6 +262,7 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 			// stop reconcile loop if vm not found (already deleted?)
 			message := fmt.Sprintf("VM (%s) not found", migration.Spec.VmName)
 			r.Recorder.Event(migration, "Warning", "Failed", message)
+			r.Metrics.ObserveMigrationFailed(migration, "VMNotFound", nil)
 			meta.SetStatusCondition(&migration.Status.Conditions,
 				metav1.Condition{
 					Type:    typeDegradedVirtualMachineMigration,
@@ -255,6 +309,22 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 	}
 
 	if migration.Status.Phase == "" {
+		// VFIO devices can't be migrated, so fail early rather than leaving the target pod stuck.
+		if vm.Spec.SRIOVNetwork != nil {
+			message := fmt.Sprintf("VM (%s) has an SR-IOV network and cannot be live-migrated", vm.Name)
+			r.Recorder.Event(migration, "Warning", "Failed", message)
+			r.Metrics.ObserveMigrationFailed(migration, "SRIOVNetwork", nil)
+			meta.SetStatusCondition(&migration.Status.Conditions,
+				metav1.Condition{
+					Type:    typeDegradedVirtualMachineMigration,
+					Status:  metav1.ConditionTrue,
+					Reason:  "Reconciling",
+					Message: message,
+				})
+			migration.Status.Phase = vmv1.VmmFailed
+			return r.updateMigrationStatus(ctx, migration)
+		}
+
 		// need change VM status asap to prevent autoscaler change CPU/RAM in VM
 		// but only if VM running
 		if vm.Status.Phase == vmv1.VmRunning {
@@ -289,7 +359,7 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 
 		// Update the metadata (including "usage" annotation) before anything else, so that it
 		// will be correctly set even if the rest of the reconcile operation fails.
-		if err := updatePodMetadataIfNecessary(ctx, r.Client, vm, targetRunner); err != nil {
+		if err := updatePodMetadataIfNecessary(ctx, r.Client, r.Config, vm, targetRunner); err != nil {
 			log.Error(err, "Failed to sync pod labels and annotations", "TargetPod.Name", targetRunner.Name)
 		}
 
@@ -330,13 +400,40 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 			if *vm.Spec.CpuScalingMode == vmv1.CpuScalingModeQMP {
 				// do hotplugCPU in targetRunner before migration
 				log.Info("Syncing CPUs in Target runner", "TargetPod.Name", migration.Status.TargetPodName)
-				if err := QmpSyncCpuToTarget(vm, migration); err != nil {
+				endQMP := traceQMP(ctx, "SyncCpuToTarget")
+				err := QmpSyncCpuToTarget(vm, migration)
+				endQMP(err)
+				if err != nil {
 					return ctrl.Result{}, err
 				}
 				log.Info("CPUs in Target runner synced", "TargetPod.Name", migration.Status.TargetPodName)
 			}
 			// Migrate only running VMs to target with plugged devices
 			if vm.Status.Phase == vmv1.VmPreMigrating {
+				// QEMU versions are only known once both runners are up, so check them last.
+				reason, err := precheckQEMUVersions(ctx, vm, migration)
+				if err != nil {
+					log.Error(err, "Failed to check QEMU versions")
+					return ctrl.Result{}, err
+				}
+				if reason != "" {
+					return r.failMigrationPrecheck(ctx, migration, reason)
+				}
+				// copy disks before the memory, so that they're in sync by the time the memory is
+				if migration.Spec.GetDiskMigration() == vmv1.DiskMigrationModeMirror {
+					endQMP := traceQMP(ctx, "MirrorDisksToTarget")
+					ready, err := QmpMirrorDisksToTarget(vm, migration)
+					endQMP(err)
+					if err != nil {
+						log.Error(err, "Failed to mirror disks to target runner")
+						r.Recorder.Event(migration, "Warning", "Failed", fmt.Sprintf("Failed to mirror disks to target runner: %v", err))
+						return ctrl.Result{}, err
+					}
+					if !ready {
+						log.Info("Waiting for disks to be mirrored to target runner", "TargetPod.Name", migration.Status.TargetPodName)
+						return ctrl.Result{RequeueAfter: time.Second}, nil
+					}
+				}
 				// update VM status
 				vm.Status.Phase = vmv1.VmMigrating
 				if err := r.Status().Update(ctx, vm); err != nil {
@@ -344,10 +441,15 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 					return ctrl.Result{}, err
 				}
 				// trigger migration
-				if err := QmpStartMigration(vm, migration); err != nil {
+				endQMP := traceQMP(ctx, "StartMigration")
+				err = QmpStartMigration(vm, migration, r.Config)
+				endQMP(err)
+				if err != nil {
 					migration.Status.Phase = vmv1.VmmFailed
 					return ctrl.Result{}, err
 				}
+				// QmpStartMigration switches to post-copy straight away, if it's allowed.
+				migration.Status.PostCopyStarted = migration.Spec.AllowPostCopy
 				message := fmt.Sprintf("Migration was started to target runner (%s)", targetRunner.Name)
 				log.Info(message)
 				r.Recorder.Event(migration, "Normal", "Started", message)
@@ -360,6 +462,7 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 					})
 				// finally update migration phase to Running
 				migration.Status.Phase = vmv1.VmmRunning
+				r.Metrics.ObserveMigrationStarted(migration)
 				return r.updateMigrationStatus(ctx, migration)
 			}
 		case runnerSucceeded:
@@ -367,6 +470,7 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 			message := fmt.Sprintf("Target Pod (%s) completed suddenly", targetRunner.Name)
 			log.Info(message)
 			r.Recorder.Event(migration, "Warning", "Failed", message)
+			r.Metrics.ObserveMigrationFailed(migration, "TargetPodCompleted", nil)
 			meta.SetStatusCondition(&migration.Status.Conditions,
 				metav1.Condition{
 					Type:    typeDegradedVirtualMachineMigration,
@@ -380,6 +484,7 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 			message := fmt.Sprintf("Target Pod (%s) failed", targetRunner.Name)
 			log.Info(message)
 			r.Recorder.Event(migration, "Warning", "Failed", message)
+			r.Metrics.ObserveMigrationFailed(migration, "TargetPodFailed", nil)
 			meta.SetStatusCondition(&migration.Status.Conditions,
 				metav1.Condition{
 					Type:    typeDegradedVirtualMachineMigration,
@@ -402,6 +507,7 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 			// lost target pod for running Migration ?
 			message := fmt.Sprintf("Target Pod (%s) disappeared", migration.Status.TargetPodName)
 			r.Recorder.Event(migration, "Error", "NotFound", message)
+			r.Metrics.ObserveMigrationFailed(migration, "TargetPodDisappeared", nil)
 			meta.SetStatusCondition(&migration.Status.Conditions,
 				metav1.Condition{
 					Type:    typeDegradedVirtualMachineMigration,
@@ -418,12 +524,14 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 
 		// Update the metadata (including "usage" annotation) before anything else, so that it
 		// will be correctly set even if the rest of the reconcile operation fails.
-		if err := updatePodMetadataIfNecessary(ctx, r.Client, vm, targetRunner); err != nil {
+		if err := updatePodMetadataIfNecessary(ctx, r.Client, r.Config, vm, targetRunner); err != nil {
 			log.Error(err, "Failed to sync pod labels and annotations", "TargetPod.Name", targetRunner.Name)
 		}
 
 		// retrieve migration statistics
+		endQMP := traceQMP(ctx, "GetMigrationInfo")
 		migrationInfo, err := QmpGetMigrationInfo(QmpAddr(vm))
+		endQMP(err)
 		if err != nil {
 			log.Error(err, "Failed to get migration info")
 			return ctrl.Result{}, err
@@ -445,6 +553,8 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 			// Redefine runner Pod for VM
 			vm.Status.PodName = migration.Status.TargetPodName
 			vm.Status.PodIP = migration.Status.TargetPodIP
+			// the full list is refreshed from the pod by the VM controller
+			vm.Status.PodIPs = []string{migration.Status.TargetPodIP}
 			vm.Status.Phase = vmv1.VmRunning
 			// update VM status
 			if err := r.Status().Update(ctx, vm); err != nil {
@@ -487,7 +597,18 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 
 			// try to stop hypervisor in source runner if it running still
 			if sourceRunner.Status.Phase == corev1.PodRunning {
-				if err := QmpQuit(migration.Status.SourcePodIP, vm.Spec.QMP); err != nil {
+				if migration.Spec.GetDiskMigration() == vmv1.DiskMigrationModeMirror {
+					endQMP := traceQMP(ctx, "FinishDiskMirrors")
+					err := QmpFinishDiskMirrors(vm, migration)
+					endQMP(err)
+					if err != nil {
+						log.Error(err, "Failed to finish mirroring disks to target runner pod")
+					}
+				}
+				endQMP := traceQMP(ctx, "Quit")
+				err := QmpQuit(migration.Status.SourcePodIP, vm.Spec.QMP)
+				endQMP(err)
+				if err != nil {
 					log.Error(err, "Failed stop hypervisor in source runner pod")
 				} else {
 					log.Info("Hypervisor in source runner pod stopped")
@@ -496,9 +617,25 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 				log.Info("Skip stopping hypervisor in source runner pod", "pod.Status.Phase", sourceRunner.Status.Phase)
 			}
 
+			// The guest's clock can be left behind by the time it was paused, so set it from the
+			// host's. This is best-effort: the guest should still catch up on its own eventually.
+			if vm.Spec.Guest.Settings.ResyncClockAfterMigration() {
+				if runnerVersion, err := getRunnerVersion(targetRunner); err == nil && runnerVersion.SupportsClockSync() {
+					if err := syncRunnerClock(ctx, vm); err != nil {
+						log.Error(err, "Failed to resync guest clock after migration")
+						r.Recorder.Event(migration, "Warning", "ClockSync",
+							fmt.Sprintf("Failed to resync guest clock after migration: %s", err))
+					} else {
+						log.Info("Resynced guest clock after migration")
+					}
+				}
+			}
+
 			// finally update migration phase to Succeeded
 			migration.Status.Phase = vmv1.VmmSucceeded
 			migration.Status.Info.Status = migrationInfo.Status
+			r.Metrics.ForgetMigrationProgress(migration)
+			r.Metrics.ObserveMigrationSucceeded(migration, migrationInfo)
 			return r.updateMigrationStatus(ctx, migration)
 		}
 
@@ -512,7 +649,10 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 
 			// try to stop hypervisor in target runner
 			if targetRunner.Status.Phase == corev1.PodRunning {
-				if err := QmpQuit(migration.Status.TargetPodIP, vm.Spec.QMP); err != nil {
+				endQMP := traceQMP(ctx, "Quit")
+				err := QmpQuit(migration.Status.TargetPodIP, vm.Spec.QMP)
+				endQMP(err)
+				if err != nil {
 					log.Error(err, "Failed stop hypervisor in target runner pod")
 				} else {
 					log.Info("Hypervisor in target runner pod stopped")
@@ -529,12 +669,16 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 			// finally update migration phase to Failed
 			migration.Status.Phase = vmv1.VmmFailed
 			migration.Status.Info.Status = migrationInfo.Status
+			r.Metrics.ForgetMigrationProgress(migration)
+			r.Metrics.ObserveMigrationFailed(migration, "QEMUFailed", migrationInfo)
 			return r.updateMigrationStatus(ctx, migration)
 		}
 		// seems migration still going on, just update status with migration progress once per second
 		time.Sleep(time.Second)
 		// re-retrieve migration statistics
+		endQMP = traceQMP(ctx, "GetMigrationInfo")
 		migrationInfo, err = QmpGetMigrationInfo(QmpAddr(vm))
+		endQMP(err)
 		if err != nil {
 			log.Error(err, "Failed to re-get migration info")
 			return ctrl.Result{}, err
@@ -546,6 +690,9 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 			return ctrl.Result{}, err
 		}
 		migration.Status.Info.Status = migrationInfo.Status
+		if strings.HasPrefix(migrationInfo.Status, "postcopy") {
+			migration.Status.PostCopyStarted = true
+		}
 		migration.Status.Info.TotalTimeMs = migrationInfo.TotalTimeMs
 		migration.Status.Info.SetupTimeMs = migrationInfo.SetupTimeMs
 		migration.Status.Info.DowntimeMs = migrationInfo.DowntimeMs
@@ -554,6 +701,14 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 		migration.Status.Info.Ram.Total = migrationInfo.Ram.Total
 		migration.Status.Info.Compression.CompressedSize = migrationInfo.Compression.CompressedSize
 		migration.Status.Info.Compression.CompressionRate = int64(math.Round(migrationInfo.Compression.CompressionRate))
+		migration.Status.Progress = &vmv1.MigrationProgress{
+			RamTransferred:     migrationInfo.Ram.Transferred,
+			RamTotal:           migrationInfo.Ram.Total,
+			DirtyPagesRate:     migrationInfo.Ram.DirtyPagesRate,
+			ExpectedDowntimeMs: migrationInfo.ExpectedDowntimeMs,
+			Iteration:          migrationInfo.Ram.DirtySyncCount,
+		}
+		r.Metrics.ObserveMigrationProgress(migration)
 		return r.updateMigrationStatus(ctx, migration)
 
 	case vmv1.VmmSucceeded:
@@ -599,7 +754,7 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 
 	case vmv1.VmmFailed:
 		// do additional VM status checks
-		if vm.Status.Phase == vmv1.VmMigrating {
+		if vm.Status.Phase == vmv1.VmMigrating || vm.Status.Phase == vmv1.VmPreMigrating {
 			// migration Failed and VM should back to Running state
 			vm.Status.Phase = vmv1.VmRunning
 			if err := r.Status().Update(ctx, vm); err != nil {
@@ -607,8 +762,34 @@ func (r *VirtualMachineMigrationReconciler) Reconcile(ctx context.Context, req c
 				return ctrl.Result{}, err
 			}
 		}
-		// all done, stop reconciliation
-		return ctrl.Result{}, nil
+		if migration.Status.Retries >= migration.Spec.BackoffLimit {
+			// all done, stop reconciliation
+			return ctrl.Result{}, nil
+		}
+		// VFIO devices can't be migrated, so there's no point retrying. After switching to
+		// post-copy, the source no longer has the guest's full state, so a fresh target can't be
+		// given a consistent copy.
+		if migration.Status.PostCopyStarted || vm.Spec.SRIOVNetwork != nil {
+			reason := "the VM has SR-IOV devices"
+			if migration.Status.PostCopyStarted {
+				reason = "it failed after switching to post-copy"
+			}
+			message := fmt.Sprintf("Migration can't be retried, because %s", reason)
+			changed := meta.SetStatusCondition(&migration.Status.Conditions,
+				metav1.Condition{
+					Type:    typeDegradedVirtualMachineMigration,
+					Status:  metav1.ConditionTrue,
+					Reason:  "NotRetryable",
+					Message: message,
+				})
+			if changed {
+				log.Info(message)
+				r.Recorder.Event(migration, "Warning", "NotRetryable", message)
+				return r.updateMigrationStatus(ctx, migration)
+			}
+			return ctrl.Result{}, nil
+		}
+		return r.retryMigration(ctx, migration, vm)
 
 	default:
 		// not sure what to do, so try rqueue
@@ -629,6 +810,87 @@ func (r *VirtualMachineMigrationReconciler) updateMigrationStatus(ctx context.Co
 	return ctrl.Result{}, nil
 }
 
+// retryMigration starts the migration again with a fresh target pod, once enough time has passed
+// since the latest attempt failed.
+func (r *VirtualMachineMigrationReconciler) retryMigration(
+	ctx context.Context,
+	migration *vmv1.VirtualMachineMigration,
+	vm *vmv1.VirtualMachine,
+) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	if migration.Status.LastFailureTime == nil {
+		now := metav1.Now()
+		migration.Status.LastFailureTime = &now
+		return r.updateMigrationStatus(ctx, migration)
+	}
+	if wait := time.Until(migration.Status.LastFailureTime.Add(migrationRetryBackoff(migration.Status.Retries))); wait > 0 {
+		return ctrl.Result{RequeueAfter: wait}, nil
+	}
+
+	// The source QEMU may still be sending to a target that's gone.
+	if migration.Status.SourcePodIP != "" {
+		endQMP := traceQMP(ctx, "CancelMigration")
+		err := QmpCancelMigration(migration.Status.SourcePodIP, vm.Spec.QMP)
+		endQMP(err)
+		if err != nil {
+			log.Info("Failed to cancel migration in source runner pod before retrying", "error", err)
+		}
+	}
+
+	if len(migration.Status.TargetPodName) > 0 {
+		pod := &corev1.Pod{}
+		err := r.Get(ctx, types.NamespacedName{Name: migration.Status.TargetPodName, Namespace: migration.Namespace}, pod)
+		if err == nil {
+			if err := r.Delete(ctx, pod); client.IgnoreNotFound(err) != nil {
+				log.Error(err, "Failed to delete target runner Pod before retrying")
+				return ctrl.Result{}, err
+			}
+		} else if !apierrors.IsNotFound(err) {
+			log.Error(err, "Failed to get target runner Pod")
+			return ctrl.Result{}, err
+		}
+	}
+
+	migration.Status.Retries++
+	message := fmt.Sprintf("Retrying migration (attempt %d of %d)", migration.Status.Retries, migration.Spec.BackoffLimit)
+	log.Info(message)
+	r.Recorder.Event(migration, "Normal", "Retrying", message)
+	meta.SetStatusCondition(&migration.Status.Conditions,
+		metav1.Condition{
+			Type:    typeDegradedVirtualMachineMigration,
+			Status:  metav1.ConditionFalse,
+			Reason:  "Reconciling",
+			Message: message,
+		})
+
+	// Back to a freshly created migration, apart from the conditions and retries. The next
+	// reconcile generates a new target pod name.
+	migration.Status.Phase = ""
+	migration.Status.SourcePodName = ""
+	migration.Status.SourcePodIP = ""
+	migration.Status.SourceNode = ""
+	migration.Status.TargetPodName = ""
+	migration.Status.TargetPodIP = ""
+	migration.Status.TargetNode = ""
+	migration.Status.Info = vmv1.MigrationInfo{} //nolint:exhaustruct // reset to empty
+	migration.Status.Progress = nil
+	migration.Status.LastFailureTime = nil
+	return r.updateMigrationStatus(ctx, migration)
+}
+
+// migrationRetryBackoff returns how long to wait after a failed attempt before retrying, when the
+// migration has already been retried the given number of times.
+func migrationRetryBackoff(retries int32) time.Duration {
+	backoff := util.Backoff{
+		Initial:    10 * time.Second,
+		Max:        5 * time.Minute,
+		Multiplier: 2,
+		Jitter:     0,
+	}
+	return backoff.Delay(int(retries))
+}
+
 // finalizeVirtualMachineMigration will perform the required operations before delete the CR.
 func (r *VirtualMachineMigrationReconciler) doFinalizerOperationsForVirtualMachineMigration(ctx context.Context, migration *vmv1.VirtualMachineMigration, vm *vmv1.VirtualMachine) error {
 	log := log.FromContext(ctx)
@@ -640,7 +902,10 @@ func (r *VirtualMachineMigrationReconciler) doFinalizerOperationsForVirtualMachi
 
 		// try to cancel migration
 		log.Info("Canceling migration")
-		if err := QmpCancelMigration(QmpAddr(vm)); err != nil {
+		endQMP := traceQMP(ctx, "CancelMigration")
+		err := QmpCancelMigration(QmpAddr(vm))
+		endQMP(err)
+		if err != nil {
 			// inform about error but not return error to avoid stuckness in reconciliation cycle
 			log.Error(err, "Migration canceling failed")
 		}
@@ -694,6 +959,8 @@ func (r *VirtualMachineMigrationReconciler) SetupWithManager(mgr ctrl.Manager) (
 		cntrlName,
 		r.Config.FailurePendingPeriod,
 		r.Config.FailingRefreshInterval,
+		r.Config.SlowReconcileThreshold,
+		r.Config.QMPRetryRateLimit,
 	)
 	err := ctrl.NewControllerManagedBy(mgr).
 		For(&vmv1.VirtualMachineMigration{}).
@@ -706,15 +973,22 @@ func (r *VirtualMachineMigrationReconciler) SetupWithManager(mgr ctrl.Manager) (
 
 // targetPodForVirtualMachine returns a VirtualMachine Pod object
 func (r *VirtualMachineMigrationReconciler) targetPodForVirtualMachine(
+	ctx context.Context,
 	vm *vmv1.VirtualMachine,
 	migration *vmv1.VirtualMachineMigration,
 	sshSecret *corev1.Secret,
+	nodeLabels map[string]string,
 ) (*corev1.Pod, error) {
 	if err := vm.Spec.Guest.ValidateMemorySize(); err != nil {
 		return nil, fmt.Errorf("cannot create target pod because memory is invalid: %w", err)
 	}
 
-	pod, err := podSpec(vm, sshSecret, r.Config)
+	config, err := runnerConfigForVM(ctx, r.Client, r.Recorder, r.Config, vm)
+	if err != nil {
+		return nil, err
+	}
+
+	pod, err := podSpec(vm, sshSecret, config)
 	if err != nil {
 		return nil, err
 	}
@@ -722,6 +996,9 @@ func (r *VirtualMachineMigrationReconciler) targetPodForVirtualMachine(
 	// override pod name
 	pod.Name = migration.Status.TargetPodName
 
+	// copy the affinity before adding to it below, so that the VM's spec isn't modified
+	pod.Spec.Affinity = pod.Spec.Affinity.DeepCopy()
+
 	// add env variable to turn on migration receiver
 	// TODO: make it false or empty after the migration is done to enable correct readiness probe
 	pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "RECEIVE_MIGRATION", Value: "true"})
@@ -747,6 +1024,44 @@ func (r *VirtualMachineMigrationReconciler) targetPodForVirtualMachine(
 		})
 	}
 
+	// restrict target pod to nodes that are compatible with the source, e.g. with the same CPU model
+	addRequiredNodeLabels(pod, nodeLabels)
+
+	// restrict target pod to the nodes requested by the migration, on top of the VM's own constraints
+	if len(migration.Spec.TargetNodeSelector) != 0 {
+		// copy, so that the VM's node selector isn't modified
+		nodeSelector := maps.Clone(pod.Spec.NodeSelector)
+		if nodeSelector == nil {
+			nodeSelector = make(map[string]string)
+		}
+		maps.Copy(nodeSelector, migration.Spec.TargetNodeSelector)
+		pod.Spec.NodeSelector = nodeSelector
+	}
+	if affinity := migration.Spec.TargetNodeAffinity; affinity != nil {
+		if required := affinity.RequiredDuringSchedulingIgnoredDuringExecution; required != nil && len(required.NodeSelectorTerms) != 0 {
+			requireNodeSelectorTerms(pod, required.NodeSelectorTerms)
+		}
+		if len(affinity.PreferredDuringSchedulingIgnoredDuringExecution) != 0 {
+			// NB: .Spec.Affinity.NodeAffinity guaranteed non-nil by affinityForVirtualMachine
+			pod.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(
+				pod.Spec.Affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+				affinity.PreferredDuringSchedulingIgnoredDuringExecution...,
+			)
+		}
+	}
+	if migration.Spec.TargetNode != "" {
+		// Use node affinity rather than setting .spec.nodeName, so that the pod still goes through
+		// the scheduler and its resources are accounted for.
+		requireNodeSelectorTerms(pod, []corev1.NodeSelectorTerm{{
+			MatchExpressions: nil,
+			MatchFields: []corev1.NodeSelectorRequirement{{
+				Key:      "metadata.name",
+				Operator: corev1.NodeSelectorOpIn,
+				Values:   []string{migration.Spec.TargetNode},
+			}},
+		}})
+	}
+
 	// Set the ownerRef for the Pod
 	if err := ctrl.SetControllerReference(migration, pod, r.Scheme); err != nil {
 		return nil, err
@@ -757,3 +1072,35 @@ func (r *VirtualMachineMigrationReconciler) targetPodForVirtualMachine(
 
 	return pod, nil
 }
+
+// requireNodeSelectorTerms restricts the pod to nodes matching any of the terms, in addition to its
+// existing required node affinity.
+func requireNodeSelectorTerms(pod *corev1.Pod, terms []corev1.NodeSelectorTerm) {
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &corev1.Affinity{}
+	}
+	if pod.Spec.Affinity.NodeAffinity == nil {
+		pod.Spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	if pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{}
+	}
+	required := pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+
+	if len(required.NodeSelectorTerms) == 0 {
+		required.NodeSelectorTerms = slices.Clone(terms)
+	} else {
+		// Terms are ORed together, so to AND the new terms with the existing ones, every existing
+		// term is combined with every new term.
+		var combined []corev1.NodeSelectorTerm
+		for _, existing := range required.NodeSelectorTerms {
+			for _, term := range terms {
+				combined = append(combined, corev1.NodeSelectorTerm{
+					MatchExpressions: slices.Concat(existing.MatchExpressions, term.MatchExpressions),
+					MatchFields:      slices.Concat(existing.MatchFields, term.MatchFields),
+				})
+			}
+		}
+		required.NodeSelectorTerms = combined
+	}
+}
@@ -2,10 +2,14 @@ package controllers
 
 import (
 	"context"
+	"net/http"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zapcore"
@@ -16,10 +20,13 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 
 	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
 )
 
 type migrationTestParams struct {
@@ -67,8 +74,17 @@ func newMigrationTestParams(t *testing.T) *migrationTestParams {
 			MemhpAutoMovableRatio:   "301",
 			FailurePendingPeriod:    time.Minute,
 			FailingRefreshInterval:  time.Minute,
+			SlowReconcileThreshold:  0,
 			AtMostOnePod:            false,
 			DefaultCPUScalingMode:   vmv1.CpuScalingModeQMP,
+			NodeTuningProfileDir:    "",
+			QEMUExtraArgsAllowlist:  nil,
+			ResumePoolDir:           "",
+			MigrationMaxBandwidth:   resource.MustParse("1Gi"),
+			MigrationMaxDowntime:    300 * time.Millisecond,
+			MigrationCPUModelLabel:  "",
+			SchedulerPluginAddr:     "",
+			ComputeUnitResource:     nil,
 			NADConfig:               nil,
 		},
 		Metrics: testReconcilerMetrics,
@@ -262,3 +278,266 @@ func Test_VMM_to_Pending_then_removed(t *testing.T) {
 	params.refetchVM(vm)
 	require.Equal(params.t, vm.Status.Phase, vmv1.VmRunning)
 }
+
+func Test_VMM_failed_then_retried(t *testing.T) {
+	params := newMigrationTestParams(t)
+	vm := defaultVm()
+	vm.Status.Phase = vmv1.VmRunning
+	vm.Status.PodIP = "1.2.3.4"
+	params.createVM(vm)
+
+	vmm := &vmv1.VirtualMachineMigration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-migration",
+			Namespace: vm.Namespace,
+		},
+		Spec: vmv1.VirtualMachineMigrationSpec{
+			VmName:       vm.Name,
+			BackoffLimit: 3,
+		},
+	}
+	params.createMigration(vmm)
+	params.migrationToPending(vmm)
+
+	vmm.Status.Phase = vmv1.VmmFailed
+	require.NoError(t, params.client.Status().Update(params.ctx, vmm))
+
+	// First, the VM goes back to running and the failure time is recorded
+	params.reconcileSuccess(vmm)
+	params.refetchVM(vm)
+	require.Equal(t, vmv1.VmRunning, vm.Status.Phase)
+	require.NotNil(t, vmm.Status.LastFailureTime)
+
+	// Then, once the backoff has passed, the migration starts over
+	vmm.Status.LastFailureTime = &metav1.Time{Time: time.Now().Add(-time.Hour)}
+	require.NoError(t, params.client.Status().Update(params.ctx, vmm))
+
+	params.mockRecorder.On("Event", mock.Anything, "Normal", "Retrying", "Retrying migration (attempt 1 of 3)")
+	params.reconcileSuccess(vmm)
+	require.Equal(t, vmv1.VmmPhase(""), vmm.Status.Phase)
+	require.Equal(t, int32(1), vmm.Status.Retries)
+	require.Empty(t, vmm.Status.TargetPodName)
+	require.Nil(t, vmm.Status.LastFailureTime)
+}
+
+func Test_VMM_failed_after_postcopy_not_retried(t *testing.T) {
+	params := newMigrationTestParams(t)
+	vm := defaultVm()
+	vm.Status.Phase = vmv1.VmRunning
+	vm.Status.PodIP = "1.2.3.4"
+	params.createVM(vm)
+
+	vmm := &vmv1.VirtualMachineMigration{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-migration",
+			Namespace: vm.Namespace,
+		},
+		Spec: vmv1.VirtualMachineMigrationSpec{
+			VmName:        vm.Name,
+			AllowPostCopy: true,
+			BackoffLimit:  3,
+		},
+	}
+	params.createMigration(vmm)
+	params.migrationToPending(vmm)
+
+	vmm.Status.Phase = vmv1.VmmFailed
+	vmm.Status.PostCopyStarted = true
+	vmm.Status.LastFailureTime = &metav1.Time{Time: time.Now().Add(-time.Hour)}
+	require.NoError(t, params.client.Status().Update(params.ctx, vmm))
+
+	// The migration fails for good, instead of starting over
+	params.mockRecorder.On("Event", mock.Anything, "Warning", "NotRetryable",
+		"Migration can't be retried, because it failed after switching to post-copy")
+	params.reconcileSuccess(vmm)
+	require.Equal(t, vmv1.VmmFailed, vmm.Status.Phase)
+	require.Equal(t, int32(0), vmm.Status.Retries)
+	require.True(t, meta.IsStatusConditionTrue(vmm.Status.Conditions, typeDegradedVirtualMachineMigration))
+
+	// ... and stays that way
+	params.reconcileSuccess(vmm)
+	require.Equal(t, vmv1.VmmFailed, vmm.Status.Phase)
+	require.Equal(t, int32(0), vmm.Status.Retries)
+	params.mockRecorder.AssertNumberOfCalls(t, "Event", 1)
+}
+
+func Test_VMM_resyncs_clock_after_migration(t *testing.T) {
+	cases := []struct {
+		name          string
+		resync        *bool
+		runnerVersion api.RunnerProtoVersion
+		runnerStatus  int
+		expectSync    bool
+	}{
+		{"Default", nil, api.RunnerProtoV4, http.StatusOK, true},
+		{"Disabled", lo.ToPtr(false), api.RunnerProtoV4, http.StatusOK, false},
+		{"OldRunner", nil, api.RunnerProtoV3, http.StatusOK, false},
+		{"SyncFailed", nil, api.RunnerProtoV4, http.StatusInternalServerError, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			params := newMigrationTestParams(t)
+			vm := defaultVm()
+			vm.Status.Phase = vmv1.VmRunning
+			vm.Spec.Guest.Settings = &vmv1.GuestSettings{
+				Clock: &vmv1.ClockSettings{Sync: "", ResyncAfterMigration: c.resync},
+			}
+			// Both runners are the same fake, on localhost
+			requests := fakeRunner(t, vm, c.runnerStatus)
+			qmp := startFakeQMP(t, func(cmd fakeQMPCommand) any {
+				assert.Equal(t, "query-migrate", cmd.Execute)
+				return map[string]any{"return": map[string]any{"status": "completed"}}
+			})
+			vm.Spec.QMP = qmp.port
+			params.createVM(vm)
+
+			vmm := &vmv1.VirtualMachineMigration{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-migration",
+					Namespace: vm.Namespace,
+				},
+				Spec: vmv1.VirtualMachineMigrationSpec{
+					VmName: vm.Name,
+				},
+			}
+			params.createMigration(vmm)
+			params.migrationPrePending(vmm)
+
+			// Skip ahead to when the memory has been transferred to the target
+			require.NoError(t, params.client.Create(params.ctx, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      vmm.Status.TargetPodName,
+					Namespace: vm.Namespace,
+					Labels:    map[string]string{vmv1.RunnerPodVersionLabel: strconv.Itoa(int(c.runnerVersion))},
+				},
+			}))
+			vmm.Status.Phase = vmv1.VmmRunning
+			vmm.Status.TargetPodIP = vm.Status.PodIP
+			vmm.Status.SourcePodIP = vm.Status.PodIP
+			require.NoError(t, params.client.Status().Update(params.ctx, vmm))
+
+			params.mockRecorder.On("Event", mock.Anything, "Normal", "Finished", mock.Anything)
+			if c.runnerStatus != http.StatusOK {
+				params.mockRecorder.On("Event", mock.Anything, "Warning", "ClockSync",
+					"Failed to resync guest clock after migration: syncRunnerClock: unexpected status 500 Internal Server Error")
+			}
+			params.reconcileSuccess(vmm)
+
+			// Failing to resync the clock doesn't fail the migration
+			require.Equal(t, vmv1.VmmSucceeded, vmm.Status.Phase)
+			if c.expectSync {
+				require.Len(t, requests, 1)
+				require.Equal(t, "POST", <-requests)
+			} else {
+				require.Empty(t, requests)
+			}
+			params.mockRecorder.AssertExpectations(t)
+		})
+	}
+}
+
+func Test_migrationRetryBackoff(t *testing.T) {
+	require.Equal(t, 10*time.Second, migrationRetryBackoff(0))
+	require.Equal(t, 40*time.Second, migrationRetryBackoff(2))
+	require.Equal(t, 5*time.Minute, migrationRetryBackoff(10))
+}
+
+func Test_migrationLimits(t *testing.T) {
+	//nolint:exhaustruct // only the migration limits are used
+	config := &ReconcilerConfig{
+		MigrationMaxBandwidth: resource.MustParse("2Gi"),
+		MigrationMaxDowntime:  500 * time.Millisecond,
+	}
+
+	cases := []struct {
+		name              string
+		maxBandwidth      string
+		maxDowntimeMillis *int64
+		expectedBandwidth int64
+		expectedDowntime  int64
+	}{
+		{"ControllerDefaults", "", nil, 2 << 30, 500},
+		{"ZeroBandwidthUsesDefault", "0", nil, 2 << 30, 500},
+		{"MigrationBandwidth", "256Mi", nil, 256 << 20, 500},
+		{"MigrationDowntime", "", lo.ToPtr[int64](50), 2 << 30, 50},
+		{"Both", "256Mi", lo.ToPtr[int64](2000), 256 << 20, 2000},
+		// Migrations from when the CRD defaulted to 1Gi keep it, instead of the controller's default
+		{"OldCRDDefault", "1Gi", nil, 1 << 30, 500},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			//nolint:exhaustruct // only the limits are used
+			migration := &vmv1.VirtualMachineMigration{
+				Spec: vmv1.VirtualMachineMigrationSpec{MaxDowntimeMillis: c.maxDowntimeMillis},
+			}
+			if c.maxBandwidth != "" {
+				migration.Spec.MaxBandwidth = resource.MustParse(c.maxBandwidth)
+			}
+
+			bandwidth, downtime := migrationLimits(migration, config)
+			require.Equal(t, c.expectedBandwidth, bandwidth)
+			require.Equal(t, c.expectedDowntime, downtime)
+		})
+	}
+}
+
+func Test_addRequiredNodeLabels(t *testing.T) {
+	//nolint:exhaustruct // Only the affinity is used
+	pod := &corev1.Pod{}
+	addRequiredNodeLabels(pod, map[string]string{"cpu-model": "1"})
+
+	required := pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	require.Len(t, required.NodeSelectorTerms, 1)
+	require.Equal(t, []corev1.NodeSelectorRequirement{{
+		Key:      "cpu-model",
+		Operator: corev1.NodeSelectorOpIn,
+		Values:   []string{"1"},
+	}}, required.NodeSelectorTerms[0].MatchExpressions)
+}
+
+func Test_qemuVersion_olderThan(t *testing.T) {
+	v := qemuVersion{Major: 8, Minor: 2, Micro: 1}
+	require.True(t, v.olderThan(qemuVersion{Major: 9, Minor: 0, Micro: 0}))
+	require.True(t, v.olderThan(qemuVersion{Major: 8, Minor: 2, Micro: 2}))
+	require.False(t, v.olderThan(v))
+	require.False(t, v.olderThan(qemuVersion{Major: 8, Minor: 1, Micro: 9}))
+}
+
+func Test_requireNodeSelectorTerms(t *testing.T) {
+	expr := func(key string) corev1.NodeSelectorRequirement {
+		return corev1.NodeSelectorRequirement{Key: key, Operator: corev1.NodeSelectorOpExists, Values: nil}
+	}
+
+	//nolint:exhaustruct // Only the affinity is used
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Affinity: &corev1.Affinity{
+				NodeAffinity: &corev1.NodeAffinity{
+					RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+						NodeSelectorTerms: []corev1.NodeSelectorTerm{
+							{MatchExpressions: []corev1.NodeSelectorRequirement{expr("a")}},
+							{MatchExpressions: []corev1.NodeSelectorRequirement{expr("b")}},
+						},
+					},
+				},
+			},
+		},
+	}
+	requireNodeSelectorTerms(pod, []corev1.NodeSelectorTerm{
+		{MatchExpressions: []corev1.NodeSelectorRequirement{expr("c")}},
+		{MatchExpressions: []corev1.NodeSelectorRequirement{expr("d")}},
+	})
+
+	// (a OR b) AND (c OR d) == (a AND c) OR (a AND d) OR (b AND c) OR (b AND d)
+	var got [][]string
+	for _, term := range pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		var keys []string
+		for _, e := range term.MatchExpressions {
+			keys = append(keys, e.Key)
+		}
+		got = append(got, keys)
+	}
+	require.Equal(t, [][]string{{"a", "c"}, {"a", "d"}, {"b", "c"}, {"b", "d"}}, got)
+}
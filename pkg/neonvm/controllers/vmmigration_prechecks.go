@@ -0,0 +1,233 @@
+package controllers
+
+// Checks made before starting a live migration, so that migrations that can't succeed fail early
+// with a clear reason, rather than after the target pod is stuck pending or the transfer fails.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+// migrationPrecheckResult is the outcome of the checks made before creating the target pod.
+type migrationPrecheckResult struct {
+	// failure is the reason the migration can't succeed, or empty if it might.
+	failure string
+	// nodeLabels are the labels that the target node must have for the migration to succeed.
+	nodeLabels map[string]string
+}
+
+// precheckMigration checks that the migration can succeed, before its target pod is created.
+//
+// Errors are only returned if the checks couldn't be made at all. Checks whose information isn't
+// available (e.g. nodes without a CPU model label) are skipped.
+func (r *VirtualMachineMigrationReconciler) precheckMigration(
+	ctx context.Context,
+	migration *vmv1.VirtualMachineMigration,
+	vm *vmv1.VirtualMachine,
+	sourcePod *corev1.Pod,
+) (migrationPrecheckResult, error) {
+	log := log.FromContext(ctx)
+	result := migrationPrecheckResult{failure: "", nodeLabels: nil}
+
+	// QEMU can't migrate to an older version, so the target runner must not be older than the
+	// source. The runner version is the closest thing we have before the target pod exists.
+	sourceVersion, err := getRunnerVersion(sourcePod)
+	if err != nil {
+		return result, fmt.Errorf("failed to get source runner version: %w", err)
+	}
+	if sourceVersion > maxSupportedRunnerVersion {
+		result.failure = fmt.Sprintf("source runner version %d is newer than target runner version %d",
+			sourceVersion, maxSupportedRunnerVersion)
+		return result, nil
+	}
+
+	// The target pod is created from the VM's current spec, but the guest can only be migrated to
+	// the machine type it booted with. A changed machine type waits for the VM to restart instead.
+	sourceMachineType, err := podMachineType(sourcePod)
+	if err != nil {
+		return result, fmt.Errorf("failed to get source machine type: %w", err)
+	}
+	if targetMachineType := effectiveMachineType(vm.Spec.MachineType); sourceMachineType != targetMachineType {
+		result.failure = fmt.Sprintf("VM's machine type changed from %q to %q, so it must restart instead of migrating",
+			sourceMachineType, targetMachineType)
+		return result, nil
+	}
+
+	// Target runners only support virtio-mem, so VMs with any other memory devices (e.g. DIMM
+	// slots, from older runners) can't be migrated.
+	endQMP := traceQMP(ctx, "GetMemoryDeviceTypes")
+	devices, err := QmpGetMemoryDeviceTypes(QmpAddr(vm))
+	endQMP(err)
+	if err != nil {
+		return result, fmt.Errorf("failed to get source memory devices: %w", err)
+	}
+	for _, t := range devices {
+		if t != "virtio-mem" {
+			result.failure = fmt.Sprintf("source VM has memory device of type %q, but target only supports virtio-mem", t)
+			return result, nil
+		}
+	}
+
+	// Guests see the host's CPU model, so the target node must have the same one.
+	if label := r.Config.MigrationCPUModelLabel; label != "" && sourcePod.Spec.NodeName != "" {
+		var node corev1.Node
+		if err := r.Get(ctx, types.NamespacedName{Name: sourcePod.Spec.NodeName}, &node); err != nil {
+			return result, fmt.Errorf("failed to get source node: %w", err)
+		}
+		if model, ok := node.Labels[label]; ok {
+			result.nodeLabels = map[string]string{label: model}
+		}
+	}
+
+	if r.Config.SchedulerPluginAddr != "" {
+		excludeNode := ""
+		if migration.Spec.PreventMigrationToSameHost {
+			excludeNode = sourcePod.Spec.NodeName
+		}
+		// Only the labels are checked here. Any other constraints on the target node (like its
+		// affinity) are left to the scheduler.
+		nodeLabels := maps.Clone(result.nodeLabels)
+		if len(migration.Spec.TargetNodeSelector) != 0 {
+			if nodeLabels == nil {
+				nodeLabels = make(map[string]string)
+			}
+			maps.Copy(nodeLabels, migration.Spec.TargetNodeSelector)
+		}
+		capacity, err := requestMigrationCapacity(ctx, r.Config.SchedulerPluginAddr, api.MigrationCapacityRequest{
+			CPU:         vm.Spec.Guest.CPUs.Use,
+			Mem:         api.MemoryForSlots(vm.Spec.Guest.MemorySlotSize, vm.Spec.Guest.MemorySlots.Use),
+			ExcludeNode: excludeNode,
+			NodeLabels:  nodeLabels,
+		})
+		if err != nil {
+			// The scheduler makes the final decision anyways, so don't block migrations on this.
+			log.Error(err, "Failed to check migration capacity with scheduler plugin, skipping check")
+		} else if node := migration.Spec.TargetNode; node != "" && !slices.Contains(capacity.Nodes, node) {
+			result.failure = fmt.Sprintf("target node %q doesn't have enough capacity for the VM", node)
+			return result, nil
+		} else if len(capacity.Nodes) == 0 {
+			result.failure = "no node has enough capacity for the VM"
+			if len(nodeLabels) != 0 {
+				result.failure += fmt.Sprintf(" with labels %v", nodeLabels)
+			}
+			return result, nil
+		}
+	}
+
+	return result, nil
+}
+
+// precheckQEMUVersions checks that the target runner's QEMU can receive the migration from the
+// source's, once both are running.
+//
+// It returns the reason the migration can't succeed, or empty if it might.
+func precheckQEMUVersions(ctx context.Context, vm *vmv1.VirtualMachine, migration *vmv1.VirtualMachineMigration) (string, error) {
+	endQMP := traceQMP(ctx, "GetVersion")
+	sourceVersion, err := QmpGetVersion(migration.Status.SourcePodIP, vm.Spec.QMP)
+	endQMP(err)
+	if err != nil {
+		return "", fmt.Errorf("failed to get source QEMU version: %w", err)
+	}
+	endQMP = traceQMP(ctx, "GetVersion")
+	targetVersion, err := QmpGetVersion(migration.Status.TargetPodIP, vm.Spec.QMP)
+	endQMP(err)
+	if err != nil {
+		return "", fmt.Errorf("failed to get target QEMU version: %w", err)
+	}
+	if targetVersion.olderThan(sourceVersion) {
+		return fmt.Sprintf("target QEMU version %s is older than source QEMU version %s", targetVersion, sourceVersion), nil
+	}
+	return "", nil
+}
+
+func requestMigrationCapacity(
+	ctx context.Context,
+	addr string,
+	capacityReq api.MigrationCapacityRequest,
+) (*api.MigrationCapacityResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	body, err := json.Marshal(capacityReq)
+	if err != nil {
+		return nil, err
+	}
+
+	url := fmt.Sprintf("%s/migration_capacity", strings.TrimSuffix(addr, "/"))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("requestMigrationCapacity: unexpected status %s", resp.Status)
+	}
+
+	var result api.MigrationCapacityResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error unmarshaling json: %w", err)
+	}
+	return &result, nil
+}
+
+// addRequiredNodeLabels restricts the pod to nodes with all of the labels.
+func addRequiredNodeLabels(pod *corev1.Pod, labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+
+	var exprs []corev1.NodeSelectorRequirement
+	for _, label := range slices.Sorted(maps.Keys(labels)) {
+		exprs = append(exprs, corev1.NodeSelectorRequirement{
+			Key:      label,
+			Operator: corev1.NodeSelectorOpIn,
+			Values:   []string{labels[label]},
+		})
+	}
+
+	requireNodeSelectorTerms(pod, []corev1.NodeSelectorTerm{{MatchExpressions: exprs, MatchFields: nil}})
+}
+
+// qemuVersion is the version of QEMU, as returned by 'query-version'.
+type qemuVersion struct {
+	Major int `json:"major"`
+	Minor int `json:"minor"`
+	Micro int `json:"micro"`
+}
+
+func (v qemuVersion) String() string {
+	return strconv.Itoa(v.Major) + "." + strconv.Itoa(v.Minor) + "." + strconv.Itoa(v.Micro)
+}
+
+func (v qemuVersion) olderThan(other qemuVersion) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Micro < other.Micro
+}
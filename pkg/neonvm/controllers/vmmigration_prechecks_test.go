@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+// fakeQMPCommand is a command received by the fake QMP server.
+type fakeQMPCommand struct {
+	Execute   string          `json:"execute"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+// fakeQMPServer is a QMP server on localhost that answers commands with handle, and records them.
+type fakeQMPServer struct {
+	ip   string
+	port int32
+
+	mu       sync.Mutex
+	commands []fakeQMPCommand
+}
+
+// startFakeQMP starts a fake QMP server on localhost. The value returned by handle is sent as the
+// response to each command, other than the initial capabilities handshake.
+func startFakeQMP(t *testing.T, handle func(cmd fakeQMPCommand) any) *fakeQMPServer {
+	return startFakeQMPAt(t, "127.0.0.1:0", handle)
+}
+
+// startFakeQMPAt is like startFakeQMP, but listens on the address.
+func startFakeQMPAt(t *testing.T, address string, handle func(cmd fakeQMPCommand) any) *fakeQMPServer {
+	listener, err := net.Listen("tcp", address)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	addr := listener.Addr().(*net.TCPAddr)
+	//nolint:exhaustruct // the rest are set as commands are received
+	server := &fakeQMPServer{ip: addr.IP.String(), port: int32(addr.Port)}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, handle)
+		}
+	}()
+
+	return server
+}
+
+func (s *fakeQMPServer) serve(conn net.Conn, handle func(cmd fakeQMPCommand) any) {
+	defer conn.Close()
+
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+
+	greeting := map[string]any{
+		"QMP": map[string]any{
+			"version":      map[string]any{"qemu": map[string]int{"major": 9, "minor": 0, "micro": 0}, "package": ""},
+			"capabilities": []string{},
+		},
+	}
+	if err := enc.Encode(greeting); err != nil {
+		return
+	}
+
+	for {
+		var cmd fakeQMPCommand
+		if err := dec.Decode(&cmd); err != nil {
+			return
+		}
+
+		var resp any = map[string]any{"return": map[string]any{}}
+		if cmd.Execute != "qmp_capabilities" {
+			s.mu.Lock()
+			s.commands = append(s.commands, cmd)
+			s.mu.Unlock()
+			resp = handle(cmd)
+		}
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// received returns the commands received so far.
+func (s *fakeQMPServer) received() []fakeQMPCommand {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]fakeQMPCommand{}, s.commands...)
+}
+
+// memoryDevicesQMP returns a fake QMP handler that reports memory devices of the given types.
+func memoryDevicesQMP(t *testing.T, types ...string) func(cmd fakeQMPCommand) any {
+	return func(cmd fakeQMPCommand) any {
+		assert.Equal(t, "query-memory-devices", cmd.Execute)
+		var devices []map[string]any
+		for _, typ := range types {
+			devices = append(devices, map[string]any{"type": typ, "data": map[string]any{}})
+		}
+		return map[string]any{"return": devices}
+	}
+}
+
+func TestPrecheckMigration(t *testing.T) {
+	// sourcePod returns a runner pod on node-a for a VM that booted with the spec
+	sourcePod := func(spec vmv1.VirtualMachineSpec, version api.RunnerProtoVersion) *corev1.Pod {
+		specJSON, err := json.Marshal(spec)
+		require.NoError(t, err)
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: map[string]string{vmv1.RunnerPodVersionLabel: strconv.Itoa(int(version))},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "node-a",
+				Containers: []corev1.Container{{
+					Name:    runnerContainerName,
+					Command: []string{"runner", "-vmspec", base64.StdEncoding.EncodeToString(specJSON), "-vmstatus", ""},
+				}},
+			},
+		}
+	}
+
+	migration := func() *vmv1.VirtualMachineMigration {
+		return &vmv1.VirtualMachineMigration{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-migration", Namespace: "default"},
+			//nolint:exhaustruct // only the fields used by the prechecks
+			Spec: vmv1.VirtualMachineMigrationSpec{VmName: "test-vm", PreventMigrationToSameHost: true},
+		}
+	}
+
+	// schedulerPlugin starts a fake scheduler plugin that responds with the nodes, and returns its
+	// address and a channel with the requests it receives.
+	schedulerPlugin := func(t *testing.T, status int, nodes ...string) (string, <-chan api.MigrationCapacityRequest) {
+		requests := make(chan api.MigrationCapacityRequest, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "POST", r.Method)
+			assert.Equal(t, "/migration_capacity", r.URL.Path)
+			var req api.MigrationCapacityRequest
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			requests <- req
+
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(api.MigrationCapacityResponse{Nodes: append([]string{}, nodes...)})
+		}))
+		t.Cleanup(server.Close)
+		return server.URL, requests
+	}
+
+	setup := func(t *testing.T, memoryDevices ...string) (*migrationTestParams, *vmv1.VirtualMachine, *fakeQMPServer) {
+		params := newMigrationTestParams(t)
+		qmp := startFakeQMP(t, memoryDevicesQMP(t, memoryDevices...))
+
+		vm := defaultVm()
+		vm.Status.PodIP = qmp.ip
+		vm.Spec.QMP = qmp.port
+		return params, vm, qmp
+	}
+
+	t.Run("Passes", func(t *testing.T) {
+		params, vm, qmp := setup(t, "virtio-mem")
+
+		result, err := params.r.precheckMigration(params.ctx, migration(), vm, sourcePod(vm.Spec, maxSupportedRunnerVersion))
+		require.NoError(t, err)
+		assert.Equal(t, migrationPrecheckResult{failure: "", nodeLabels: nil}, result)
+		assert.Equal(t, []fakeQMPCommand{{Execute: "query-memory-devices", Arguments: nil}}, qmp.received())
+	})
+
+	t.Run("NewerRunnerVersion", func(t *testing.T) {
+		params, vm, _ := setup(t, "virtio-mem")
+
+		result, err := params.r.precheckMigration(params.ctx, migration(), vm, sourcePod(vm.Spec, maxSupportedRunnerVersion+1))
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("source runner version %d is newer than target runner version %d",
+			maxSupportedRunnerVersion+1, maxSupportedRunnerVersion), result.failure)
+	})
+
+	t.Run("MachineTypeChanged", func(t *testing.T) {
+		params, vm, _ := setup(t, "virtio-mem")
+		pod := sourcePod(vm.Spec, maxSupportedRunnerVersion)
+		vm.Spec.MachineType = lo.ToPtr(vmv1.MachineTypeMicroVM)
+
+		result, err := params.r.precheckMigration(params.ctx, migration(), vm, pod)
+		require.NoError(t, err)
+		assert.Equal(t, `VM's machine type changed from "standard" to "microvm", so it must restart instead of migrating`,
+			result.failure)
+	})
+
+	t.Run("DIMMSlots", func(t *testing.T) {
+		params, vm, _ := setup(t, "virtio-mem", "dimm")
+
+		result, err := params.r.precheckMigration(params.ctx, migration(), vm, sourcePod(vm.Spec, maxSupportedRunnerVersion))
+		require.NoError(t, err)
+		assert.Equal(t, `source VM has memory device of type "dimm", but target only supports virtio-mem`, result.failure)
+	})
+
+	t.Run("QMPUnreachable", func(t *testing.T) {
+		params := newMigrationTestParams(t)
+		vm := defaultVm()
+		vm.Status.PodIP = "127.0.0.1"
+		vm.Spec.QMP = 1 // nothing listens here
+
+		_, err := params.r.precheckMigration(params.ctx, migration(), vm, sourcePod(vm.Spec, maxSupportedRunnerVersion))
+		assert.ErrorContains(t, err, "failed to get source memory devices")
+	})
+
+	t.Run("TargetNodeFull", func(t *testing.T) {
+		params, vm, _ := setup(t, "virtio-mem")
+		params.r.Config.SchedulerPluginAddr, _ = schedulerPlugin(t, http.StatusOK, "node-c")
+
+		vmm := migration()
+		vmm.Spec.TargetNode = "node-b"
+		result, err := params.r.precheckMigration(params.ctx, vmm, vm, sourcePod(vm.Spec, maxSupportedRunnerVersion))
+		require.NoError(t, err)
+		assert.Equal(t, `target node "node-b" doesn't have enough capacity for the VM`, result.failure)
+	})
+
+	t.Run("NoCapacity", func(t *testing.T) {
+		params, vm, _ := setup(t, "virtio-mem")
+		var requests <-chan api.MigrationCapacityRequest
+		params.r.Config.SchedulerPluginAddr, requests = schedulerPlugin(t, http.StatusOK)
+
+		// The source node's CPU model is required, in addition to the migration's node selector
+		params.r.Scheme.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Node{})
+		params.r.Config.MigrationCPUModelLabel = "cpu-model"
+		require.NoError(t, params.client.Create(params.ctx, &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{"cpu-model": "a"}},
+		}))
+
+		vmm := migration()
+		vmm.Spec.TargetNodeSelector = map[string]string{"zone": "z1"}
+		result, err := params.r.precheckMigration(params.ctx, vmm, vm, sourcePod(vm.Spec, maxSupportedRunnerVersion))
+		require.NoError(t, err)
+		assert.Equal(t, "no node has enough capacity for the VM with labels map[cpu-model:a zone:z1]", result.failure)
+		// Only the CPU model is required of the target pod. The node selector is already part of it.
+		assert.Equal(t, map[string]string{"cpu-model": "a"}, result.nodeLabels)
+
+		assert.Equal(t, api.MigrationCapacityRequest{
+			CPU:         vm.Spec.Guest.CPUs.Use,
+			Mem:         api.MemoryForSlots(vm.Spec.Guest.MemorySlotSize, vm.Spec.Guest.MemorySlots.Use),
+			ExcludeNode: "node-a",
+			NodeLabels:  map[string]string{"cpu-model": "a", "zone": "z1"},
+		}, <-requests)
+	})
+
+	t.Run("SchedulerPluginError", func(t *testing.T) {
+		params, vm, _ := setup(t, "virtio-mem")
+		params.r.Config.SchedulerPluginAddr, _ = schedulerPlugin(t, http.StatusInternalServerError)
+
+		// The scheduler makes the final decision, so the migration isn't blocked
+		result, err := params.r.precheckMigration(params.ctx, migration(), vm, sourcePod(vm.Spec, maxSupportedRunnerVersion))
+		require.NoError(t, err)
+		assert.Empty(t, result.failure)
+	})
+}
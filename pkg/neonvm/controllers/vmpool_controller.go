@@ -0,0 +1,373 @@
+package controllers
+
+// Warm pools: VirtualMachinePools keep a number of pre-booted VMs with the same spec, which can be
+// claimed when a new VM is needed, instead of waiting for one to boot.
+//
+// VMs are claimed by setting a label on them (see vmv1.VirtualMachinePoolClaimLabel), which the
+// webhook only allows once they're running. The pool then releases the VM, so that it's no longer
+// owned by the pool, and creates a replacement. Claimed VMs keep their generated names.
+//
+// Claimed VMs can be specialized through the ConfigMap named after the VM, which is mounted into
+// the VM as a watched disk if the pool sets .spec.configMountPath. That's the only specialization
+// of the guest: .spec.disks is immutable, so no other disks can be attached after the VM boots.
+//
+// Pools that set .spec.resumeImages also keep memory images of their template, which any matching
+// VM can resume from (see vm_controller_resume_pool.go).
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/storage/names"
+	"k8s.io/client-go/tools/record"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+// VirtualMachinePoolReconciler reconciles a VirtualMachinePool object
+type VirtualMachinePoolReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	Config   *ReconcilerConfig
+
+	Metrics ReconcilerMetrics
+
+	expectations poolExpectations
+}
+
+// poolExpectationsTimeout is how long to wait for VMs that a pool created or deleted to show up in
+// the cache before assuming the events were missed, and scaling the pool again anyways.
+const poolExpectationsTimeout = 5 * time.Minute
+
+// poolExpectations tracks the VMs that were created or deleted for each pool, until the changes
+// are visible in the cache.
+//
+// Until then, the VMs listed from the cache are out of date, so scaling the pool based on them
+// would create or delete more VMs than needed. This is the same as what ReplicaSets do.
+type poolExpectations struct {
+	mu    sync.Mutex
+	pools map[types.NamespacedName]*poolExpectation
+}
+
+type poolExpectation struct {
+	creates map[string]struct{}
+	deletes map[string]struct{}
+	// deadline is when to stop waiting for the changes, reset with each new change
+	deadline time.Time
+}
+
+// expect records that the VMs were created or deleted for the pool.
+func (e *poolExpectations) expect(pool types.NamespacedName, created []string, deleted []string) {
+	if len(created) == 0 && len(deleted) == 0 {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.pools == nil {
+		e.pools = make(map[types.NamespacedName]*poolExpectation)
+	}
+	exp, ok := e.pools[pool]
+	if !ok {
+		exp = &poolExpectation{
+			creates:  make(map[string]struct{}),
+			deletes:  make(map[string]struct{}),
+			deadline: time.Time{},
+		}
+		e.pools[pool] = exp
+	}
+	for _, name := range created {
+		exp.creates[name] = struct{}{}
+	}
+	for _, name := range deleted {
+		exp.deletes[name] = struct{}{}
+	}
+	exp.deadline = time.Now().Add(poolExpectationsTimeout)
+}
+
+// satisfied returns whether all of the VMs created or deleted for the pool are reflected in vms,
+// which were listed from the cache. Changes that are reflected are no longer tracked.
+func (e *poolExpectations) satisfied(pool types.NamespacedName, vms []vmv1.VirtualMachine) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	exp, ok := e.pools[pool]
+	if !ok {
+		return true
+	}
+
+	listed := make(map[string]*vmv1.VirtualMachine, len(vms))
+	for i := range vms {
+		listed[vms[i].Name] = &vms[i]
+	}
+	for name := range exp.creates {
+		if _, ok := listed[name]; ok {
+			delete(exp.creates, name)
+		}
+	}
+	for name := range exp.deletes {
+		if vm, ok := listed[name]; !ok || !vm.DeletionTimestamp.IsZero() {
+			delete(exp.deletes, name)
+		}
+	}
+
+	if (len(exp.creates) == 0 && len(exp.deletes) == 0) || time.Now().After(exp.deadline) {
+		delete(e.pools, pool)
+		return true
+	}
+	return false
+}
+
+// forget stops tracking changes for the pool, e.g. because it was deleted.
+func (e *poolExpectations) forget(pool types.NamespacedName) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.pools, pool)
+}
+
+//+kubebuilder:rbac:groups=vm.neon.tech,resources=virtualmachinepools,verbs=get;list;watch
+//+kubebuilder:rbac:groups=vm.neon.tech,resources=virtualmachinepools/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=vm.neon.tech,resources=virtualmachinepools/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;delete
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=create
+
+func (r *VirtualMachinePoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+
+	var pool vmv1.VirtualMachinePool
+	if err := r.Get(ctx, req.NamespacedName, &pool); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.expectations.forget(req.NamespacedName)
+		}
+		// ignore error and stop reconcile loop if object not found (already deleted?)
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	var vms vmv1.VirtualMachineList
+	err := r.List(ctx, &vms, client.InNamespace(pool.Namespace), client.MatchingLabels{vmv1.VirtualMachinePoolLabel: pool.Name})
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to list VMs in pool: %w", err)
+	}
+
+	hash := poolTemplateHash(&pool)
+
+	var current []*vmv1.VirtualMachine
+	for i := range vms.Items {
+		vm := &vms.Items[i]
+		if !metav1.IsControlledBy(vm, &pool) {
+			// Not ours; someone else set the label.
+			continue
+		}
+
+		_, claimed := vm.Labels[vmv1.VirtualMachinePoolClaimLabel]
+		switch {
+		case claimed:
+			// Release claimed VMs even if the pool is being deleted, so that they aren't deleted
+			// with it.
+			if err := r.releaseVM(ctx, &pool, vm); err != nil {
+				return ctrl.Result{}, err
+			}
+		case !vm.DeletionTimestamp.IsZero():
+			// Already on its way out.
+		case vm.Labels[vmv1.VirtualMachinePoolTemplateHashLabel] != hash,
+			vm.Status.Phase == vmv1.VmFailed,
+			vm.Status.Phase == vmv1.VmSucceeded:
+			log.Info("Deleting outdated or stopped VM from pool", "VirtualMachine", vm.Name, "phase", vm.Status.Phase)
+			if err := r.Delete(ctx, vm); client.IgnoreNotFound(err) != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to delete VM %s from pool: %w", vm.Name, err)
+			}
+		default:
+			current = append(current, vm)
+		}
+	}
+
+	if !pool.DeletionTimestamp.IsZero() {
+		// Nothing more to do. The remaining VMs are deleted with the pool.
+		return ctrl.Result{}, nil
+	}
+
+	if !r.expectations.satisfied(req.NamespacedName, vms.Items) {
+		// We'll be reconciled again once the cache is updated, because we own the VMs.
+		log.Info("Waiting for VMs created or deleted by the pool to be reflected in the cache")
+	} else if missing := int(pool.Spec.Replicas) - len(current); missing > 0 {
+		for range missing {
+			vm, err := r.newPoolVM(&pool, hash)
+			if err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to define VM for pool: %w", err)
+			}
+			log.Info("Creating VM for pool", "VirtualMachine", vm.Name)
+			if err := r.Create(ctx, vm); err != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to create VM for pool: %w", err)
+			}
+			r.expectations.expect(req.NamespacedName, []string{vm.Name}, nil)
+			current = append(current, vm)
+		}
+	} else if missing < 0 {
+		// Keep the VMs that are already running, and of those, the oldest - they're the most
+		// likely to be claimed soonest.
+		slices.SortStableFunc(current, func(a, b *vmv1.VirtualMachine) int {
+			aRunning, bRunning := a.Status.Phase == vmv1.VmRunning, b.Status.Phase == vmv1.VmRunning
+			if aRunning != bRunning {
+				return lo.Ternary(aRunning, -1, 1)
+			}
+			return a.CreationTimestamp.Compare(b.CreationTimestamp.Time)
+		})
+		for _, vm := range current[pool.Spec.Replicas:] {
+			log.Info("Deleting excess VM from pool", "VirtualMachine", vm.Name)
+			if err := r.Delete(ctx, vm); client.IgnoreNotFound(err) != nil {
+				return ctrl.Result{}, fmt.Errorf("failed to delete VM %s from pool: %w", vm.Name, err)
+			}
+			r.expectations.expect(req.NamespacedName, nil, []string{vm.Name})
+		}
+		current = current[:pool.Spec.Replicas]
+	}
+
+	resumeImages, requeueAfter, err := r.ensureResumeImages(ctx, &pool, hash)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	status := vmv1.VirtualMachinePoolStatus{
+		Replicas: int32(len(current)),
+		ReadyReplicas: int32(lo.CountBy(current, func(vm *vmv1.VirtualMachine) bool {
+			return vm.Status.Phase == vmv1.VmRunning
+		})),
+		ResumeImages:       resumeImages,
+		ObservedGeneration: pool.Generation,
+	}
+	if status != pool.Status {
+		pool.Status = status
+		if err := r.Status().Update(ctx, &pool); err != nil {
+			return ctrl.Result{}, fmt.Errorf("failed to update pool status: %w", err)
+		}
+	}
+
+	// Requeue to replace the oldest memory image once it's too old to use.
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// releaseVM removes a claimed VM from the pool, so that it's no longer managed by it.
+func (r *VirtualMachinePoolReconciler) releaseVM(ctx context.Context, pool *vmv1.VirtualMachinePool, vm *vmv1.VirtualMachine) error {
+	released := vm.DeepCopy()
+	delete(released.Labels, vmv1.VirtualMachinePoolLabel)
+	delete(released.Labels, vmv1.VirtualMachinePoolTemplateHashLabel)
+	released.OwnerReferences = slices.DeleteFunc(released.OwnerReferences, func(ref metav1.OwnerReference) bool {
+		return ref.UID == pool.UID
+	})
+
+	patch := client.MergeFromWithOptions(vm, client.MergeFromWithOptimisticLock{})
+	if err := r.Patch(ctx, released, patch); err != nil {
+		return fmt.Errorf("failed to release claimed VM %s from pool: %w", vm.Name, err)
+	}
+
+	claim := vm.Labels[vmv1.VirtualMachinePoolClaimLabel]
+	log.FromContext(ctx).Info("Released claimed VM from pool", "VirtualMachine", vm.Name, "claim", claim)
+	r.Recorder.Eventf(pool, "Normal", "Claimed", "VM %s was claimed by %q", vm.Name, claim)
+	return nil
+}
+
+// newPoolVM returns a new VM for the pool, created from its template.
+func (r *VirtualMachinePoolReconciler) newPoolVM(pool *vmv1.VirtualMachinePool, hash string) (*vmv1.VirtualMachine, error) {
+	template := pool.Spec.Template.DeepCopy()
+
+	labels := maps.Clone(template.Labels)
+	if labels == nil {
+		labels = make(map[string]string)
+	}
+	labels[vmv1.VirtualMachinePoolLabel] = pool.Name
+	labels[vmv1.VirtualMachinePoolTemplateHashLabel] = hash
+
+	vm := &vmv1.VirtualMachine{
+		TypeMeta: metav1.TypeMeta{},
+		ObjectMeta: metav1.ObjectMeta{
+			// Generate the name ourselves, because the config disk depends on it.
+			Name:        names.SimpleNameGenerator.GenerateName(fmt.Sprintf("%s-", pool.Name)),
+			Namespace:   pool.Namespace,
+			Labels:      labels,
+			Annotations: template.Annotations,
+		},
+		Spec:   template.Spec,
+		Status: vmv1.VirtualMachineStatus{},
+	}
+
+	if pool.Spec.ConfigMountPath != "" {
+		vm.Spec.Disks = append(vm.Spec.Disks, vmv1.Disk{
+			Name:      vmv1.VirtualMachinePoolConfigDiskName,
+			ReadOnly:  lo.ToPtr(true),
+			MountPath: pool.Spec.ConfigMountPath,
+			Watch:     lo.ToPtr(true),
+			DiskSource: vmv1.DiskSource{
+				EmptyDisk: nil,
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: vm.Name},
+					// The VM boots before it's claimed, so the ConfigMap won't exist yet.
+					Optional: lo.ToPtr(true),
+				},
+				Secret: nil,
+				Tmpfs:  nil,
+			},
+		})
+	}
+
+	if err := ctrl.SetControllerReference(pool, vm, r.Scheme); err != nil {
+		return nil, err
+	}
+	return vm, nil
+}
+
+// poolTemplateHash returns a hash of everything in the pool's spec that affects its VMs, so that
+// VMs created from an older version of the pool can be replaced.
+func poolTemplateHash(pool *vmv1.VirtualMachinePool) string {
+	data, err := json.Marshal(struct {
+		Template        vmv1.VirtualMachinePoolTemplate
+		ConfigMountPath string
+	}{Template: pool.Spec.Template, ConfigMountPath: pool.Spec.ConfigMountPath})
+	if err != nil {
+		panic(fmt.Errorf("error marshalling JSON: %w", err))
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:8])
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *VirtualMachinePoolReconciler) SetupWithManager(mgr ctrl.Manager) (ReconcilerWithMetrics, error) {
+	cntrlName := "virtualmachinepool"
+	reconciler := WithMetrics(
+		withCatchPanic(r),
+		r.Metrics,
+		cntrlName,
+		r.Config.FailurePendingPeriod,
+		r.Config.FailingRefreshInterval,
+		r.Config.SlowReconcileThreshold,
+		r.Config.QMPRetryRateLimit,
+	)
+	err := ctrl.NewControllerManagedBy(mgr).
+		For(&vmv1.VirtualMachinePool{}).
+		Owns(&vmv1.VirtualMachine{}).
+		Owns(&corev1.Pod{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.Config.MaxConcurrentReconciles}).
+		Named(cntrlName).
+		Complete(reconciler)
+	return reconciler, err
+}
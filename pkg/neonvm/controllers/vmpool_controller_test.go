@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+func testVMPool() *vmv1.VirtualMachinePool {
+	return &vmv1.VirtualMachinePool{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pool",
+			Namespace: "default",
+			UID:       types.UID("pool-uid"),
+		},
+		Spec: vmv1.VirtualMachinePoolSpec{
+			Replicas: 3,
+			Template: vmv1.VirtualMachinePoolTemplate{
+				Labels:      map[string]string{"foo": "bar"},
+				Annotations: nil,
+				Spec:        defaultVm().Spec,
+			},
+			ConfigMountPath: "/neonvm/config",
+			ResumeImages:    0,
+		},
+		Status: vmv1.VirtualMachinePoolStatus{Replicas: 0, ReadyReplicas: 0, ResumeImages: 0, ObservedGeneration: 0},
+	}
+}
+
+type poolTestParams struct {
+	t      *testing.T
+	ctx    context.Context
+	r      *VirtualMachinePoolReconciler
+	client client.Client
+	pool   *vmv1.VirtualMachinePool
+}
+
+func newPoolTestParams(t *testing.T) *poolTestParams {
+	scheme := runtime.NewScheme()
+	require.NoError(t, vmv1.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	pool := testVMPool()
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(pool).
+		WithStatusSubresource(pool).
+		Build()
+
+	//nolint:exhaustruct // Only the fields used by the pool reconciler
+	r := &VirtualMachinePoolReconciler{
+		Client:   c,
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+		Config:   &ReconcilerConfig{},
+	}
+
+	return &poolTestParams{t: t, ctx: context.Background(), r: r, client: c, pool: pool}
+}
+
+func (p *poolTestParams) reconcile() {
+	_, err := p.r.Reconcile(p.ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(p.pool)})
+	require.NoError(p.t, err)
+}
+
+func (p *poolTestParams) poolVMs() []vmv1.VirtualMachine {
+	var vms vmv1.VirtualMachineList
+	err := p.client.List(p.ctx, &vms, client.MatchingLabels{vmv1.VirtualMachinePoolLabel: p.pool.Name})
+	require.NoError(p.t, err)
+	return vms.Items
+}
+
+func TestVMPoolScaleUp(t *testing.T) {
+	params := newPoolTestParams(t)
+	params.reconcile()
+
+	vms := params.poolVMs()
+	require.Len(t, vms, 3)
+	for _, vm := range vms {
+		assert.Equal(t, "bar", vm.Labels["foo"])
+		assert.NotEmpty(t, vm.Labels[vmv1.VirtualMachinePoolTemplateHashLabel])
+		assert.True(t, metav1.IsControlledBy(&vm, params.pool))
+
+		disk := vm.Spec.Disks[len(vm.Spec.Disks)-1]
+		assert.Equal(t, vmv1.VirtualMachinePoolConfigDiskName, disk.Name)
+		assert.Equal(t, "/neonvm/config", disk.MountPath)
+		assert.Equal(t, vm.Name, disk.ConfigMap.Name)
+	}
+
+	var pool vmv1.VirtualMachinePool
+	require.NoError(t, params.client.Get(params.ctx, client.ObjectKeyFromObject(params.pool), &pool))
+	assert.Equal(t, int32(3), pool.Status.Replicas)
+	assert.Equal(t, int32(0), pool.Status.ReadyReplicas)
+
+	// Reconciling again doesn't create more
+	params.reconcile()
+	assert.Len(t, params.poolVMs(), 3)
+}
+
+func TestVMPoolWaitsForCache(t *testing.T) {
+	params := newPoolTestParams(t)
+	params.reconcile()
+	require.Len(t, params.poolVMs(), 3)
+
+	// If the cache hasn't caught up with the VMs we created, don't create more
+	c := params.r.Client
+	params.r.Client = interceptor.NewClient(c.(client.WithWatch), interceptor.Funcs{
+		List: func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if _, ok := list.(*vmv1.VirtualMachineList); ok {
+				return nil
+			}
+			return c.List(ctx, list, opts...)
+		},
+	})
+	params.reconcile()
+	assert.Len(t, params.poolVMs(), 3)
+
+	// Once the cache has caught up, scaling continues as normal
+	params.r.Client = c
+	require.NoError(t, params.client.Get(params.ctx, client.ObjectKeyFromObject(params.pool), params.pool))
+	params.pool.Spec.Replicas = 1
+	require.NoError(t, params.client.Update(params.ctx, params.pool))
+	params.reconcile()
+	assert.Len(t, params.poolVMs(), 1)
+}
+
+func TestVMPoolReleasesClaimedVM(t *testing.T) {
+	params := newPoolTestParams(t)
+	params.reconcile()
+
+	vms := params.poolVMs()
+	claimed := vms[0]
+	claimed.Labels[vmv1.VirtualMachinePoolClaimLabel] = "someone"
+	require.NoError(t, params.client.Update(params.ctx, &claimed))
+
+	params.reconcile()
+
+	var vm vmv1.VirtualMachine
+	require.NoError(t, params.client.Get(params.ctx, client.ObjectKeyFromObject(&claimed), &vm))
+	assert.NotContains(t, vm.Labels, vmv1.VirtualMachinePoolLabel)
+	assert.NotContains(t, vm.Labels, vmv1.VirtualMachinePoolTemplateHashLabel)
+	assert.Equal(t, "someone", vm.Labels[vmv1.VirtualMachinePoolClaimLabel])
+	assert.Empty(t, vm.OwnerReferences)
+
+	// The claimed VM was replaced
+	vms = params.poolVMs()
+	require.Len(t, vms, 3)
+	for _, v := range vms {
+		assert.NotEqual(t, claimed.Name, v.Name)
+	}
+}
+
+func TestVMPoolReplacesOutdatedVMs(t *testing.T) {
+	params := newPoolTestParams(t)
+	params.reconcile()
+	oldVMs := params.poolVMs()
+
+	require.NoError(t, params.client.Get(params.ctx, client.ObjectKeyFromObject(params.pool), params.pool))
+	params.pool.Spec.Template.Labels["foo"] = "baz"
+	params.pool.Spec.Replicas = 2
+	require.NoError(t, params.client.Update(params.ctx, params.pool))
+
+	params.reconcile()
+
+	vms := params.poolVMs()
+	require.Len(t, vms, 2)
+	for _, vm := range vms {
+		assert.Equal(t, "baz", vm.Labels["foo"])
+		for _, old := range oldVMs {
+			assert.NotEqual(t, old.Name, vm.Name)
+		}
+	}
+}
+
+func TestVMPoolResumeImages(t *testing.T) {
+	t.Setenv("VM_RUNNER_IMAGE", "runner:test")
+	params := newPoolTestParams(t)
+	params.r.Config = newTestParams(t).r.Config
+	params.r.Config.ResumePoolDir = "/var/lib/neonvm/resume-pool"
+	// The fake client doesn't set creation timestamps, which the image's age is based on
+	params.r.Client = interceptor.NewClient(params.client.(client.WithWatch), interceptor.Funcs{
+		Create: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.CreateOption) error {
+			obj.SetCreationTimestamp(metav1.Now())
+			return c.Create(ctx, obj, opts...)
+		},
+	})
+
+	require.NoError(t, params.client.Get(params.ctx, client.ObjectKeyFromObject(params.pool), params.pool))
+	params.pool.Spec.Replicas = 1
+	params.pool.Spec.ResumeImages = 2
+	params.pool.Spec.ConfigMountPath = ""
+	params.pool.Spec.Template.Spec.EnableSSH = lo.ToPtr(true)
+	require.NoError(t, params.client.Update(params.ctx, params.pool))
+
+	templatePods := func() []corev1.Pod {
+		var pods corev1.PodList
+		err := params.client.List(params.ctx, &pods, client.MatchingLabels{vmv1.VirtualMachinePoolLabel: params.pool.Name})
+		require.NoError(t, err)
+		return pods.Items
+	}
+
+	params.reconcile()
+	pods := templatePods()
+	require.Len(t, pods, 2)
+
+	// The images are kept by the pool, and are usable by VMs with a matching spec, including the
+	// pool's own VMs once they're defaulted
+	vms := params.poolVMs()
+	require.Len(t, vms, 1)
+	setSpecDefaults(logr.Discard(), &vms[0], params.r.Config)
+	key, ok := resumePoolKey(&vms[0], params.r.Config)
+	require.True(t, ok)
+	for _, pod := range pods {
+		assert.Equal(t, key, pod.Labels[vmv1.ResumePoolLabel])
+		assert.True(t, metav1.IsControlledBy(&pod, params.pool))
+		assert.NotContains(t, pod.Labels, vmv1.VirtualMachineNameLabel)
+
+		// Each template has its own SSH key
+		var sshSecret corev1.Secret
+		require.NoError(t, params.client.Get(params.ctx, client.ObjectKey{Namespace: pod.Namespace, Name: "ssh-" + pod.Name}, &sshSecret))
+		assert.True(t, metav1.IsControlledBy(&sshSecret, &pod))
+		for _, vol := range pod.Spec.Volumes {
+			if vol.Secret != nil && strings.HasPrefix(vol.Name, "ssh-") {
+				assert.Equal(t, sshSecret.Name, vol.Secret.SecretName)
+			}
+		}
+	}
+
+	// Images are counted as ready once they've been saved
+	pods[0].Spec.NodeName = "node-1"
+	require.NoError(t, params.client.Update(params.ctx, &pods[0]))
+	pods[0].Status.Phase = corev1.PodSucceeded
+	require.NoError(t, params.client.Status().Update(params.ctx, &pods[0]))
+	params.reconcile()
+	require.NoError(t, params.client.Get(params.ctx, client.ObjectKeyFromObject(params.pool), params.pool))
+	assert.Equal(t, int32(1), params.pool.Status.ResumeImages)
+	assert.Len(t, templatePods(), 2)
+
+	// Images are kept even if there are no VMs at all
+	params.pool.Spec.Replicas = 0
+	require.NoError(t, params.client.Update(params.ctx, params.pool))
+	params.reconcile()
+	assert.Empty(t, params.poolVMs())
+	assert.Len(t, templatePods(), 2)
+
+	// Failed images are replaced
+	pods = templatePods()
+	pods[1].Status.Phase = corev1.PodFailed
+	require.NoError(t, params.client.Status().Update(params.ctx, &pods[1]))
+	params.reconcile()
+	newPods := templatePods()
+	require.Len(t, newPods, 2)
+	assert.NotContains(t, lo.Map(newPods, func(p corev1.Pod, _ int) string { return p.Name }), pods[1].Name)
+
+	// Changing the template replaces all of the images
+	require.NoError(t, params.client.Get(params.ctx, client.ObjectKeyFromObject(params.pool), params.pool))
+	params.pool.Spec.Template.Spec.Guest.MemorySlots.Max++
+	require.NoError(t, params.client.Update(params.ctx, params.pool))
+	params.reconcile()
+	pods = templatePods()
+	require.Len(t, pods, 2)
+	for _, pod := range pods {
+		assert.NotEqual(t, key, pod.Labels[vmv1.ResumePoolLabel])
+	}
+
+	// ... and none are kept for arm64 VMs
+	require.NoError(t, params.client.Get(params.ctx, client.ObjectKeyFromObject(params.pool), params.pool))
+	params.pool.Spec.Template.Spec.TargetArchitecture = lo.ToPtr(vmv1.CPUArchitectureARM64)
+	require.NoError(t, params.client.Update(params.ctx, params.pool))
+	params.reconcile()
+	assert.Empty(t, templatePods())
+}
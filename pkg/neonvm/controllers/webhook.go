@@ -1,12 +1,14 @@
 package controllers
 
-// Wrapper around the default VirtualMachine/VirtualMachineMigration webhook interfaces so that the
-// controller has a bit more control over them, without needing to actually implement that control
-// inside of the apis package.
+// Wrapper around the default VirtualMachine/VirtualMachineMigration/ScalingPolicy/VirtualMachineClass
+// webhook interfaces so that the controller has a bit more control over them, without needing to
+// actually implement that control inside of the apis package.
 
 import (
 	"context"
 	"fmt"
+	"slices"
+	"strings"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -14,11 +16,13 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
+	admissionv1 "k8s.io/api/admission/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
 
 	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
 	"github.com/neondatabase/autoscaling/pkg/util/stack"
 )
 
@@ -31,6 +35,7 @@ func validateUpdate(
 		webhook.Validator
 		metav1.Object
 	},
+	extraValidation func() error,
 ) (admission.Warnings, error) {
 	log := log.FromContext(ctx)
 
@@ -49,7 +54,11 @@ func validateUpdate(
 			}()
 		}
 
-		return newObj.ValidateUpdate(oldObj)
+		warnings, err := newObj.ValidateUpdate(oldObj)
+		if err == nil && extraValidation != nil {
+			err = extraValidation()
+		}
+		return warnings, err
 	}()
 
 	if err != nil && skipValidation {
@@ -69,6 +78,8 @@ func validateUpdate(
 type VMWebhook struct {
 	Recorder record.EventRecorder
 	Config   *ReconcilerConfig
+	// Client is used to fetch the VirtualMachineClass referenced by new VMs
+	Client client.Reader
 }
 
 func (w *VMWebhook) SetupWithManager(mgr ctrl.Manager) error {
@@ -84,6 +95,18 @@ var _ webhook.CustomDefaulter = (*VMWebhook)(nil)
 // Default implements webhook.CustomDefaulter
 func (w *VMWebhook) Default(ctx context.Context, obj runtime.Object) error {
 	vm := obj.(*vmv1.VirtualMachine)
+
+	// Only apply the class on creation, so that existing VMs can still be updated if their class
+	// is deleted. The class can't be changed afterwards anyways.
+	req, err := admission.RequestFromContext(ctx)
+	if err == nil && req.Operation == admissionv1.Create && vm.Spec.ClassName != "" {
+		class, err := getVMClass(ctx, w.Client, vm)
+		if err != nil {
+			return err
+		}
+		class.Spec.ApplyDefaults(&vm.Spec)
+	}
+
 	vm.Default()
 	return nil
 }
@@ -93,13 +116,99 @@ var _ webhook.CustomValidator = (*VMWebhook)(nil)
 // ValidateCreate implements webhook.CustomValidator
 func (w *VMWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
 	vm := obj.(*vmv1.VirtualMachine)
-	return vm.ValidateCreate()
+	warnings, err := vm.ValidateCreate()
+	if err != nil {
+		return warnings, err
+	}
+
+	if err := validateVMBounds(vm); err != nil {
+		return warnings, err
+	}
+
+	if err := validateQEMUExtraArgs(vm.Spec.Guest.ExtraArgs, w.Config.QEMUExtraArgsAllowlist); err != nil {
+		return warnings, fmt.Errorf(".spec.guest.extraArgs: %w", err)
+	}
+
+	if err := validateKernelArgs(vm.Spec.Guest.KernelArgs, w.Config); err != nil {
+		return warnings, fmt.Errorf(".spec.guest.kernelArgs: %w", err)
+	}
+	return warnings, nil
+}
+
+// validateQEMUExtraArgs checks that every flag in args is on the allowlist. QEMU flags take at
+// most one value, so each value must directly follow a flag; otherwise QEMU would treat it as a
+// disk image.
+func validateQEMUExtraArgs(args []string, allowlist []string) error {
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			if i == 0 || !strings.HasPrefix(args[i-1], "-") {
+				return fmt.Errorf("value %q is not preceded by a flag", arg)
+			}
+			continue
+		}
+
+		if !matchesArgList(allowlist, arg) {
+			return fmt.Errorf("flag %q is not allowed by the controller", arg)
+		}
+	}
+	return nil
+}
+
+// validateKernelArgs checks that the parameter set by every argument in args is allowed by the
+// controller's kernel argument allowlist and denylist.
+func validateKernelArgs(args []string, cfg *ReconcilerConfig) error {
+	for _, arg := range args {
+		name, _, _ := strings.Cut(arg, "=")
+		if len(cfg.KernelArgsAllowlist) != 0 && !matchesArgList(cfg.KernelArgsAllowlist, name) {
+			return fmt.Errorf("parameter %q is not allowed by the controller", name)
+		}
+		if matchesArgList(cfg.KernelArgsDenylist, name) {
+			return fmt.Errorf("parameter %q is denied by the controller", name)
+		}
+	}
+	return nil
+}
+
+// matchesArgList returns whether arg is in list, where entries ending with '*' match by prefix.
+func matchesArgList(list []string, arg string) bool {
+	return slices.ContainsFunc(list, func(entry string) bool {
+		if prefix, ok := strings.CutSuffix(entry, "*"); ok {
+			return strings.HasPrefix(arg, prefix)
+		}
+		return arg == entry
+	})
 }
 
 // ValidateUpdate implements webhook.CustomValidator
 func (w *VMWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldVM := oldObj.(*vmv1.VirtualMachine)
 	newVM := newObj.(*vmv1.VirtualMachine)
-	return validateUpdate(ctx, w.Config, w.Recorder, oldObj, newVM)
+	return validateUpdate(ctx, w.Config, w.Recorder, oldObj, newVM, func() error {
+		if err := validateVMBounds(newVM); err != nil {
+			return err
+		}
+		// Only check kernel arguments if they changed, so that changing the controller's lists
+		// doesn't block unrelated updates to existing VMs.
+		if !slices.Equal(oldVM.Spec.Guest.KernelArgs, newVM.Spec.Guest.KernelArgs) {
+			if err := validateKernelArgs(newVM.Spec.Guest.KernelArgs, w.Config); err != nil {
+				return fmt.Errorf(".spec.guest.kernelArgs: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// validateVMBounds checks the VM's CPU and memory bounds with the validation shared with the
+// autoscaler-agent and scheduler plugin.
+//
+// Bounds that are not reasonably sized are left to the autoscaling components to handle, because
+// that depends on whether autoscaling is enabled.
+func validateVMBounds(vm *vmv1.VirtualMachine) error {
+	issues := api.ValidateVirtualMachineResources(vm.Spec.Resources())
+	if err := issues.Except(api.BoundsUnreasonableSize).Err(); err != nil {
+		return fmt.Errorf(".spec.guest: %w", err)
+	}
+	return nil
 }
 
 // ValidateDelete implements webhook.CustomValidator
@@ -141,7 +250,7 @@ func (w *VMMigrationWebhook) ValidateCreate(ctx context.Context, obj runtime.Obj
 // ValidateUpdate implements webhook.CustomValidator
 func (w *VMMigrationWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
 	newVMM := newObj.(*vmv1.VirtualMachineMigration)
-	return validateUpdate(ctx, w.Config, w.Recorder, oldObj, newVMM)
+	return validateUpdate(ctx, w.Config, w.Recorder, oldObj, newVMM, nil)
 }
 
 // ValidateDelete implements webhook.CustomValidator
@@ -149,3 +258,125 @@ func (w *VMMigrationWebhook) ValidateDelete(ctx context.Context, obj runtime.Obj
 	vmm := obj.(*vmv1.VirtualMachineMigration)
 	return vmm.ValidateDelete()
 }
+
+type ScalingPolicyWebhook struct {
+	Recorder record.EventRecorder
+	Config   *ReconcilerConfig
+}
+
+func (w *ScalingPolicyWebhook) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&vmv1.ScalingPolicy{}).
+		WithValidator(w).
+		Complete()
+}
+
+var _ webhook.CustomValidator = (*ScalingPolicyWebhook)(nil)
+
+// ValidateCreate implements webhook.CustomValidator
+func (w *ScalingPolicyWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	policy := obj.(*vmv1.ScalingPolicy)
+	return policy.ValidateCreate()
+}
+
+// ValidateUpdate implements webhook.CustomValidator
+func (w *ScalingPolicyWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	newPolicy := newObj.(*vmv1.ScalingPolicy)
+	return validateUpdate(ctx, w.Config, w.Recorder, oldObj, newPolicy, nil)
+}
+
+// ValidateDelete implements webhook.CustomValidator
+func (w *ScalingPolicyWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	policy := obj.(*vmv1.ScalingPolicy)
+	return policy.ValidateDelete()
+}
+
+type VMClassWebhook struct {
+	Recorder record.EventRecorder
+	Config   *ReconcilerConfig
+}
+
+func (w *VMClassWebhook) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&vmv1.VirtualMachineClass{}).
+		WithValidator(w).
+		Complete()
+}
+
+var _ webhook.CustomValidator = (*VMClassWebhook)(nil)
+
+// ValidateCreate implements webhook.CustomValidator
+func (w *VMClassWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	class := obj.(*vmv1.VirtualMachineClass)
+	return class.ValidateCreate()
+}
+
+// ValidateUpdate implements webhook.CustomValidator
+func (w *VMClassWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	newClass := newObj.(*vmv1.VirtualMachineClass)
+	return validateUpdate(ctx, w.Config, w.Recorder, oldObj, newClass, nil)
+}
+
+// ValidateDelete implements webhook.CustomValidator
+func (w *VMClassWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	class := obj.(*vmv1.VirtualMachineClass)
+	return class.ValidateDelete()
+}
+
+type VMPoolWebhook struct {
+	Recorder record.EventRecorder
+	Config   *ReconcilerConfig
+}
+
+func (w *VMPoolWebhook) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&vmv1.VirtualMachinePool{}).
+		WithValidator(w).
+		Complete()
+}
+
+var _ webhook.CustomValidator = (*VMPoolWebhook)(nil)
+
+// ValidateCreate implements webhook.CustomValidator
+func (w *VMPoolWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	pool := obj.(*vmv1.VirtualMachinePool)
+	warnings, err := pool.ValidateCreate()
+	if err != nil {
+		return warnings, err
+	}
+	return warnings, validatePoolTemplate(pool, w.Config)
+}
+
+// ValidateUpdate implements webhook.CustomValidator
+func (w *VMPoolWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	newPool := newObj.(*vmv1.VirtualMachinePool)
+	return validateUpdate(ctx, w.Config, w.Recorder, oldObj, newPool, func() error {
+		return validatePoolTemplate(newPool, w.Config)
+	})
+}
+
+// validatePoolTemplate checks the pool's VM template in the same way as VMWebhook.ValidateCreate
+// does for VMs, so that invalid templates are rejected here instead of when the pool creates VMs.
+//
+// Unlike for VMs, the template's arguments are checked on every update, because the pool keeps
+// creating new VMs from it.
+func validatePoolTemplate(pool *vmv1.VirtualMachinePool, cfg *ReconcilerConfig) error {
+	vm := &vmv1.VirtualMachine{} //nolint:exhaustruct // only the spec is validated
+	vm.Spec = pool.Spec.Template.Spec
+	if err := validateVMBounds(vm); err != nil {
+		return fmt.Errorf(".spec.template: %w", err)
+	}
+	if err := validateQEMUExtraArgs(vm.Spec.Guest.ExtraArgs, cfg.QEMUExtraArgsAllowlist); err != nil {
+		return fmt.Errorf(".spec.template.spec.guest.extraArgs: %w", err)
+	}
+	if err := validateKernelArgs(vm.Spec.Guest.KernelArgs, cfg); err != nil {
+		return fmt.Errorf(".spec.template.spec.guest.kernelArgs: %w", err)
+	}
+	return nil
+}
+
+// ValidateDelete implements webhook.CustomValidator
+func (w *VMPoolWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	pool := obj.(*vmv1.VirtualMachinePool)
+	return pool.ValidateDelete()
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+)
+
+func TestValidateQEMUExtraArgs(t *testing.T) {
+	allowlist := []string{"-d", "-trace*"}
+
+	cases := []struct {
+		name  string
+		args  []string
+		valid bool
+	}{
+		{"empty", nil, true},
+		{"exact match", []string{"-d", "guest_errors"}, true},
+		{"prefix match", []string{"-trace", "enable=virtio_*"}, true},
+		{"multiple flags", []string{"-d", "guest_errors", "-trace", "pattern=qmp_*"}, true},
+		{"flag not allowed", []string{"-device", "foo"}, false},
+		{"leading value", []string{"guest_errors"}, false},
+		{"value after value", []string{"-d", "guest_errors", "/disk.img"}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateQEMUExtraArgs(c.args, allowlist)
+			if c.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateKernelArgs(t *testing.T) {
+	cases := []struct {
+		name      string
+		allowlist []string
+		args      []string
+		valid     bool
+	}{
+		{"empty", nil, nil, true},
+		{"no allowlist", nil, []string{"transparent_hugepage=never", "nokaslr"}, true},
+		{"denied", nil, []string{"init=/bin/sh"}, false},
+		{"denied by prefix", nil, []string{"memory_hotplug.online_policy=online"}, false},
+		{"allowed", []string{"transparent_hugepage", "mitigations*"}, []string{"transparent_hugepage=never", "mitigations=off"}, true},
+		{"not on allowlist", []string{"transparent_hugepage"}, []string{"nokaslr"}, false},
+		{"allowed but denied", []string{"init"}, []string{"init=/bin/sh"}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			//nolint:exhaustruct // Only the kernel argument lists are used
+			cfg := &ReconcilerConfig{
+				KernelArgsAllowlist: c.allowlist,
+				KernelArgsDenylist:  []string{"init", "memory_hotplug.*"},
+			}
+			err := validateKernelArgs(c.args, cfg)
+			if c.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateVMBounds(t *testing.T) {
+	cases := []struct {
+		name  string
+		cpus  vmv1.CPUs
+		mem   vmv1.MemorySlots
+		valid bool
+	}{
+		{"within bounds", vmv1.CPUs{Min: 250, Max: 4000, Use: 1000}, vmv1.MemorySlots{Min: 1, Max: 16, Use: 4}, true},
+		{"fixed size", vmv1.CPUs{Min: 1000, Max: 1000, Use: 1000}, vmv1.MemorySlots{Min: 4, Max: 4, Use: 4}, true},
+		// Unreasonable sizes are left to the autoscaling components
+		{"tiny cpu", vmv1.CPUs{Min: 10, Max: 10, Use: 10}, vmv1.MemorySlots{Min: 1, Max: 1, Use: 1}, true},
+		{"cpu use below min", vmv1.CPUs{Min: 1000, Max: 4000, Use: 500}, vmv1.MemorySlots{Min: 1, Max: 16, Use: 4}, false},
+		{"cpu use above max", vmv1.CPUs{Min: 1000, Max: 4000, Use: 5000}, vmv1.MemorySlots{Min: 1, Max: 16, Use: 4}, false},
+		{"mem use below min", vmv1.CPUs{Min: 1000, Max: 4000, Use: 1000}, vmv1.MemorySlots{Min: 2, Max: 16, Use: 1}, false},
+		{"mem use above max", vmv1.CPUs{Min: 1000, Max: 4000, Use: 1000}, vmv1.MemorySlots{Min: 1, Max: 16, Use: 17}, false},
+		{"min greater than max", vmv1.CPUs{Min: 4000, Max: 1000, Use: 2000}, vmv1.MemorySlots{Min: 1, Max: 16, Use: 4}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			vm := &vmv1.VirtualMachine{}
+			vm.Spec.Guest.CPUs = c.cpus
+			vm.Spec.Guest.MemorySlots = c.mem
+			vm.Spec.Guest.MemorySlotSize = resource.MustParse("1Gi")
+
+			err := validateVMBounds(vm)
+			if c.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidatePoolTemplate(t *testing.T) {
+	//nolint:exhaustruct // Only the argument lists are used
+	cfg := &ReconcilerConfig{
+		QEMUExtraArgsAllowlist: []string{"-smbios"},
+		KernelArgsDenylist:     []string{"init"},
+	}
+
+	pool := &vmv1.VirtualMachinePool{}
+	pool.Spec.Template.Spec.Guest.CPUs = vmv1.CPUs{Min: 1000, Max: 4000, Use: 1000}
+	pool.Spec.Template.Spec.Guest.MemorySlots = vmv1.MemorySlots{Min: 1, Max: 16, Use: 4}
+	pool.Spec.Template.Spec.Guest.MemorySlotSize = resource.MustParse("1Gi")
+	pool.Spec.Template.Spec.Guest.ExtraArgs = []string{"-smbios", "type=1"}
+	pool.Spec.Template.Spec.Guest.KernelArgs = []string{"nokaslr"}
+	assert.NoError(t, validatePoolTemplate(pool, cfg))
+
+	pool.Spec.Template.Spec.Guest.CPUs.Use = 5000
+	assert.ErrorContains(t, validatePoolTemplate(pool, cfg), ".spec.template: .spec.guest: use.cpu")
+	pool.Spec.Template.Spec.Guest.CPUs.Use = 1000
+
+	pool.Spec.Template.Spec.Guest.ExtraArgs = []string{"-device", "foo"}
+	assert.ErrorContains(t, validatePoolTemplate(pool, cfg), ".spec.template.spec.guest.extraArgs: flag \"-device\"")
+	pool.Spec.Template.Spec.Guest.ExtraArgs = nil
+
+	pool.Spec.Template.Spec.Guest.KernelArgs = []string{"init=/bin/sh"}
+	assert.ErrorContains(t, validatePoolTemplate(pool, cfg), ".spec.template.spec.guest.kernelArgs: parameter \"init\"")
+}
@@ -2,6 +2,7 @@ package ipam
 
 import (
 	"context"
+	"fmt"
 	"net"
 
 	whereaboutsallocate "github.com/k8snetworkplumbingwg/whereabouts/pkg/allocate"
@@ -24,6 +25,14 @@ func makeAcquireAction(ctx context.Context, vmName types.NamespacedName) ipamAct
 	}
 }
 
+// makeAcquireStaticAction creates a callback which changes IPPool state to include a reservation of
+// the specific IP for the VM.
+func makeAcquireStaticAction(ctx context.Context, vmName types.NamespacedName, ip net.IP) ipamAction {
+	return func(ipRange RangeConfiguration, reservation []whereaboutstypes.IPReservation) (net.IPNet, []whereaboutstypes.IPReservation, error) {
+		return doAcquireStatic(ctx, ipRange, reservation, vmName, ip)
+	}
+}
+
 // makeReleaseAction creates a callback which changes IPPool state to deallocate an IP reservation.
 func makeReleaseAction(ctx context.Context, vmName types.NamespacedName) ipamAction {
 	return func(ipRange RangeConfiguration, reservation []whereaboutstypes.IPReservation) (net.IPNet, []whereaboutstypes.IPReservation, error) {
@@ -59,6 +68,45 @@ func doAcquire(
 	return net.IPNet{IP: ip, Mask: ipnet.Mask}, newReservation, nil
 }
 
+func doAcquireStatic(
+	_ context.Context,
+	ipRange RangeConfiguration,
+	reservation []whereaboutstypes.IPReservation,
+	vmName types.NamespacedName,
+	ip net.IP,
+) (net.IPNet, []whereaboutstypes.IPReservation, error) {
+	_, ipnet, _ := net.ParseCIDR(ipRange.Range)
+
+	// Static IPs may be outside of range_start/range_end, so that operators can leave part of the
+	// range for them, but they must be within the range itself.
+	if !ipnet.Contains(ip) {
+		return net.IPNet{}, nil, fmt.Errorf("IP %s is not in IP range %s", ip, ipRange.Range)
+	}
+
+	// check if IP reserved for VM already
+	foundidx := getMatchingIPReservationIndex(reservation, vmName.String())
+	if foundidx >= 0 {
+		if !reservation[foundidx].IP.Equal(ip) {
+			return net.IPNet{}, nil, fmt.Errorf("VM already has a different IP %s reserved", reservation[foundidx].IP)
+		}
+		return net.IPNet{IP: reservation[foundidx].IP, Mask: ipnet.Mask}, reservation, nil
+	}
+
+	for _, r := range reservation {
+		if r.IP.Equal(ip) {
+			return net.IPNet{}, nil, fmt.Errorf("IP %s is already reserved by %s", ip, r.ContainerID)
+		}
+	}
+
+	newReservation := append(reservation, whereaboutstypes.IPReservation{
+		IP:          ip,
+		ContainerID: vmName.String(),
+		PodRef:      "",
+		IsAllocated: false,
+	})
+	return net.IPNet{IP: ip, Mask: ipnet.Mask}, newReservation, nil
+}
+
 func doRelease(
 	ctx context.Context,
 	ipRange RangeConfiguration,
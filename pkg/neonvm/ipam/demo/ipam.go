@@ -48,10 +48,11 @@ func main() {
 
 	// Create IPAM object
 	ipam, err := ipam.New(ipam.IPAMParams{
-		NadName:          *nadName,
-		NadNamespace:     *nadNs,
-		ConcurrencyLimit: 1,
-		MetricsReg:       prometheus.NewRegistry(),
+		NadName:                  *nadName,
+		NadNamespace:             *nadNs,
+		ConcurrencyLimit:         1,
+		MigrateLegacyAllocations: false,
+		MetricsReg:               prometheus.NewRegistry(),
 	})
 	if err != nil {
 		logger.Error(err, "failed to create IPAM")
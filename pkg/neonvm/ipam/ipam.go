@@ -20,10 +20,12 @@ import (
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 
 	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
 	neonvm "github.com/neondatabase/autoscaling/neonvm/client/clientset/versioned"
+	"github.com/neondatabase/autoscaling/pkg/util"
 )
 
 const (
@@ -55,13 +57,23 @@ type IPAM struct {
 
 	mu                 sync.Mutex
 	concurrencyLimiter *semaphore.Weighted
+
+	migrateLegacyAllocations bool
 }
 
 type IPAMParams struct {
 	NadName          string
 	NadNamespace     string
 	ConcurrencyLimit int
-	MetricsReg       prometheus.Registerer
+
+	// MigrateLegacyAllocations enables converting the allocations stored in IPPools by older
+	// versions into IPAllocation objects. If false, IPAM fails for pools that still have them.
+	//
+	// The migration is one-way: older versions only look at the allocations in the IPPool, so
+	// rolling back to them after the migration would allocate IPs that are already in use.
+	MigrateLegacyAllocations bool
+
+	MetricsReg prometheus.Registerer
 }
 
 func (i *IPAM) AcquireIP(ctx context.Context, vmName types.NamespacedName) (net.IPNet, error) {
@@ -72,6 +84,16 @@ func (i *IPAM) AcquireIP(ctx context.Context, vmName types.NamespacedName) (net.
 	return ip, nil
 }
 
+// AcquireStaticIP reserves the specific IP for the VM, returning an error if it's not in any of
+// the IP ranges or is already reserved by another VM.
+func (i *IPAM) AcquireStaticIP(ctx context.Context, vmName types.NamespacedName, ip net.IP) (net.IPNet, error) {
+	result, err := i.runIPAMWithMetrics(ctx, makeAcquireStaticAction(ctx, vmName, ip), IPAMAcquire)
+	if err != nil {
+		return net.IPNet{}, fmt.Errorf("failed to acquire static IP %s: %w", ip, err)
+	}
+	return result, nil
+}
+
 func (i *IPAM) ReleaseIP(ctx context.Context, vmName types.NamespacedName) (net.IPNet, error) {
 	ip, err := i.runIPAMWithMetrics(ctx, makeReleaseAction(ctx, vmName), IPAMRelease)
 	if err != nil {
@@ -126,6 +148,8 @@ func NewWithClient(kClient *Client, params IPAMParams) (*IPAM, error) {
 		metrics:            NewIPAMMetrics(params.MetricsReg),
 		mu:                 sync.Mutex{},
 		concurrencyLimiter: semaphore.NewWeighted(int64(params.ConcurrencyLimit)),
+
+		migrateLegacyAllocations: params.MigrateLegacyAllocations,
 	}, nil
 }
 
@@ -248,30 +272,30 @@ func (i *IPAM) runIPAM(ctx context.Context, action ipamAction) (net.IPNet, error
 
 func (i *IPAM) runIPAMRange(ctx context.Context, ipRange RangeConfiguration, action ipamAction) (net.IPNet, error) {
 	var ip net.IPNet
-	for retry := 0; retry < DatastoreRetries; retry++ {
-		select {
-		case <-ctx.Done():
-			return net.IPNet{}, ctx.Err()
-		default:
-			// live in retry loop until context not cancelled
-		}
-
+	err := util.Retry(ctx, util.RetryConfig{
+		Backoff:     util.Backoff{Initial: DatastoreRetriesDelay, Max: 0, Multiplier: 0, Jitter: 0},
+		MaxAttempts: DatastoreRetries,
+		ShouldRetry: func(err error) bool {
+			e, ok := err.(Temporary)
+			return ok && e.Temporary()
+		},
+		OnRetry: nil,
+	}, func() error {
 		// read IPPool from ipppols.vm.neon.tech custom resource
 		pool, err := i.getNeonvmIPPool(ctx, ipRange.Range)
 		if err != nil {
 			if e, ok := err.(Temporary); ok && e.Temporary() {
 				// retry attempt to read IPPool
-				time.Sleep(DatastoreRetriesDelay)
-				continue
+				return err
 			}
-			return net.IPNet{}, fmt.Errorf("error reading IP pool: %w", err)
+			return fmt.Errorf("error reading IP pool: %w", err)
 		}
 
 		currentReservation := pool.Allocations(ctx)
 		var newReservation []whereaboutstypes.IPReservation
 		ip, newReservation, err = action(ipRange, currentReservation)
 		if err != nil {
-			return net.IPNet{}, err
+			return permanentError{err}
 		}
 
 		// update IPPool with newReservation
@@ -279,14 +303,22 @@ func (i *IPAM) runIPAMRange(ctx context.Context, ipRange RangeConfiguration, act
 		if err != nil {
 			if e, ok := err.(Temporary); ok && e.Temporary() {
 				// retry attempt to update IPPool
-				time.Sleep(DatastoreRetriesDelay)
-				continue
+				return err
 			}
-			return net.IPNet{}, fmt.Errorf("error updating IP pool: %w", err)
+			return fmt.Errorf("error updating IP pool: %w", err)
 		}
-		return ip, nil
+		return nil
+	})
+	if errors.Is(err, util.ErrRetriesExhausted) {
+		return ip, errors.New("IPAMretries limit reached")
+	} else if err != nil {
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return net.IPNet{}, perm.err
+		}
+		return net.IPNet{}, err
 	}
-	return ip, errors.New("IPAMretries limit reached")
+	return ip, nil
 }
 
 // Status do List() request to check NeonVM client connectivity
@@ -300,16 +332,35 @@ func (i *IPAM) Close() error {
 	return nil
 }
 
-// NeonvmIPPool represents an IPPool resource and its parsed set of allocations
+// NeonvmIPPool represents an IPPool resource and its set of allocations, each stored as a separate
+// IPAllocation object
 type NeonvmIPPool struct {
-	vmClient neonvm.Interface
-	pool     *vmv1.IPPool
-	firstip  net.IP
+	vmClient    neonvm.Interface
+	pool        *vmv1.IPPool
+	firstip     net.IP
+	allocations []vmv1.IPAllocation
 }
 
 // Allocations returns the initially retrieved set of allocations for this pool
 func (p *NeonvmIPPool) Allocations(ctx context.Context) []whereaboutstypes.IPReservation {
-	return toIPReservation(ctx, p.pool.Spec.Allocations, p.firstip)
+	log := log.FromContext(ctx)
+	reservelist := []whereaboutstypes.IPReservation{}
+	for _, a := range p.allocations {
+		ip := net.ParseIP(a.Spec.IP)
+		if ip == nil {
+			// The IP is still protected by the allocation's name, so it can't be allocated
+			// again. We just can't release it.
+			log.Error(fmt.Errorf("invalid IP %q", a.Spec.IP), "error decoding IPAllocation", "IPAllocation", a.Name)
+			continue
+		}
+		reservelist = append(reservelist, whereaboutstypes.IPReservation{
+			IP:          ip,
+			ContainerID: a.Spec.Owner,
+			PodRef:      a.Spec.PodRef,
+			IsAllocated: false,
+		})
+	}
+	return reservelist
 }
 
 // getNeonvmIPPool returns a NeonVM IPPool for the given IP range
@@ -334,7 +385,7 @@ func (i *IPAM) getNeonvmIPPool(ctx context.Context, ipRange string) (*NeonvmIPPo
 			},
 			Spec: vmv1.IPPoolSpec{
 				Range:       ipRange,
-				Allocations: make(map[string]vmv1.IPAllocation),
+				Allocations: nil,
 			},
 		}
 		_, err = i.VMClient.NeonvmV1().IPPools(i.Config.NetworkNamespace).Create(ctx, newPool, metav1.CreateOptions{})
@@ -356,28 +407,163 @@ func (i *IPAM) getNeonvmIPPool(ctx context.Context, ipRange string) (*NeonvmIPPo
 		return nil, err
 	}
 
-	return &NeonvmIPPool{
-		vmClient: i.Client.VMClient,
-		pool:     pool,
-		firstip:  ip,
-	}, nil
+	p := &NeonvmIPPool{
+		vmClient:    i.Client.VMClient,
+		pool:        pool,
+		firstip:     ip,
+		allocations: nil,
+	}
+
+	if len(pool.Spec.Allocations) != 0 {
+		if !i.migrateLegacyAllocations {
+			return nil, fmt.Errorf(
+				"IPPool %s has %d allocations from an older version, but migrating them is not enabled",
+				pool.Name, len(pool.Spec.Allocations),
+			)
+		}
+		if err := p.migrateLegacyAllocations(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	allocations, err := i.VMClient.NeonvmV1().IPAllocations(pool.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.Set{vmv1.IPAllocationPoolLabel: pool.Name}.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.allocations = allocations.Items
+
+	return p, nil
 }
 
-// Update NeonvmIPPool with new IP reservation
-func (p *NeonvmIPPool) Update(ctx context.Context, reservation []whereaboutstypes.IPReservation) error {
-	p.pool.Spec.Allocations = toAllocations(reservation, p.firstip)
-	_, err := p.vmClient.NeonvmV1().IPPools(p.pool.Namespace).Update(ctx, p.pool, metav1.UpdateOptions{})
+// migrateLegacyAllocations converts allocations stored in the IPPool itself (from before they were
+// separate IPAllocation objects) into IPAllocations, removing them from the pool.
+//
+// This is one-way. See IPAMParams.MigrateLegacyAllocations.
+func (p *NeonvmIPPool) migrateLegacyAllocations(ctx context.Context) error {
+	log := log.FromContext(ctx)
+
+	for _, r := range legacyReservations(ctx, p.pool.Spec.Allocations, p.firstip) {
+		err := p.createAllocation(ctx, r)
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("error migrating allocation of %s to IPAllocation: %w", r.IP, err)
+		}
+	}
+
+	log.Info("Migrated IPPool allocations to IPAllocations", "IPPool", p.pool.Name, "count", len(p.pool.Spec.Allocations))
+	p.pool.Spec.Allocations = nil
+	pool, err := p.vmClient.NeonvmV1().IPPools(p.pool.Namespace).Update(ctx, p.pool, metav1.UpdateOptions{})
 	if err != nil {
 		if apierrors.IsConflict(err) {
 			return &temporaryError{err}
 		}
 		return err
 	}
+	p.pool = pool
 	return nil
 }
 
+// Update NeonvmIPPool with new IP reservation, creating, updating, and deleting IPAllocations to
+// match
+//
+// Each allocation is changed with a single request, and new allocations are created before any are
+// deleted, so that if one of the requests fails, no IP is left both released and not reacquired.
+func (p *NeonvmIPPool) Update(ctx context.Context, reservation []whereaboutstypes.IPReservation) error {
+	current := make(map[string]vmv1.IPAllocation)
+	for _, a := range p.allocations {
+		current[a.Name] = a
+	}
+	desired := make(map[string]whereaboutstypes.IPReservation)
+	for _, r := range reservation {
+		desired[p.allocationName(r.IP)] = r
+	}
+
+	for name, r := range desired {
+		a, ok := current[name]
+		if !ok {
+			if err := p.createAllocation(ctx, r); err != nil {
+				if apierrors.IsAlreadyExists(err) {
+					// Someone else allocated the IP since we listed allocations -- retry with the
+					// updated list.
+					return &temporaryError{err}
+				}
+				return err
+			}
+			continue
+		}
+		if a.Spec.Owner == r.ContainerID && a.Spec.PodRef == r.PodRef {
+			continue
+		}
+		// The IP changed hands. Update the existing allocation rather than deleting and recreating
+		// it, so there's no point where the IP is unallocated.
+		a.Spec.Owner = r.ContainerID
+		a.Spec.PodRef = r.PodRef
+		_, err := p.vmClient.NeonvmV1().IPAllocations(p.pool.Namespace).Update(ctx, &a, metav1.UpdateOptions{})
+		if err != nil {
+			if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+				return &temporaryError{err}
+			}
+			return err
+		}
+	}
+	for name, a := range current {
+		if _, ok := desired[name]; ok {
+			continue
+		} else if net.ParseIP(a.Spec.IP) == nil {
+			// Not included by Allocations(), so it can't have been released.
+			continue
+		}
+		err := p.vmClient.NeonvmV1().IPAllocations(p.pool.Namespace).Delete(ctx, name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &a.UID, ResourceVersion: &a.ResourceVersion},
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			if apierrors.IsConflict(err) {
+				return &temporaryError{err}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// allocationName returns the name of the IPAllocation for the IP in this pool.
+//
+// The name is based on the IP's offset in the pool, rather than the IP itself, so that it's always
+// a valid object name (IPv6 addresses are not).
+func (p *NeonvmIPPool) allocationName(ip net.IP) string {
+	return fmt.Sprintf("%s-%d", p.pool.Name, whereaboutsallocate.IPGetOffset(ip, p.firstip))
+}
+
+func (p *NeonvmIPPool) createAllocation(ctx context.Context, r whereaboutstypes.IPReservation) error {
+	allocation := &vmv1.IPAllocation{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "",
+			APIVersion: "",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      p.allocationName(r.IP),
+			Namespace: p.pool.Namespace,
+			Labels: map[string]string{
+				vmv1.IPAllocationPoolLabel: p.pool.Name,
+			},
+		},
+		Spec: vmv1.IPAllocationSpec{
+			Pool:   p.pool.Name,
+			IP:     r.IP.String(),
+			Owner:  r.ContainerID,
+			PodRef: r.PodRef,
+		},
+	}
+	_, err := p.vmClient.NeonvmV1().IPAllocations(p.pool.Namespace).Create(ctx, allocation, metav1.CreateOptions{})
+	return err
+}
+
+// legacyReservations converts the allocations stored in an IPPool from before they were separate
+// IPAllocation objects.
+//
 // taken from whereabouts code as it not exported
-func toIPReservation(ctx context.Context, allocations map[string]vmv1.IPAllocation, firstip net.IP) []whereaboutstypes.IPReservation {
+func legacyReservations(ctx context.Context, allocations map[string]vmv1.IPPoolAllocation, firstip net.IP) []whereaboutstypes.IPReservation {
 	log := log.FromContext(ctx)
 	reservelist := []whereaboutstypes.IPReservation{}
 	for offset, a := range allocations {
@@ -398,13 +584,3 @@ func toIPReservation(ctx context.Context, allocations map[string]vmv1.IPAllocati
 	}
 	return reservelist
 }
-
-// taken from whereabouts code as it not exported
-func toAllocations(reservelist []whereaboutstypes.IPReservation, firstip net.IP) map[string]vmv1.IPAllocation {
-	allocations := make(map[string]vmv1.IPAllocation)
-	for _, r := range reservelist {
-		index := whereaboutsallocate.IPGetOffset(r.IP, firstip)
-		allocations[fmt.Sprintf("%d", index)] = vmv1.IPAllocation{ContainerID: r.ContainerID, PodRef: r.PodRef}
-	}
-	return allocations
-}
@@ -16,6 +16,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	kfake "k8s.io/client-go/kubernetes/fake"
 
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
 	nfake "github.com/neondatabase/autoscaling/neonvm/client/clientset/versioned/fake"
 	"github.com/neondatabase/autoscaling/pkg/neonvm/ipam"
 )
@@ -26,6 +27,10 @@ type testParams struct {
 }
 
 func makeIPAM(t *testing.T, cfg string) *testParams {
+	return makeIPAMWithMigration(t, cfg, false)
+}
+
+func makeIPAMWithMigration(t *testing.T, cfg string, migrateLegacyAllocations bool) *testParams {
 	client := ipam.Client{
 		KubeClient: kfake.NewSimpleClientset(),
 		VMClient:   nfake.NewSimpleClientset(),
@@ -47,10 +52,11 @@ func makeIPAM(t *testing.T, cfg string) *testParams {
 
 	prom := prometheus.NewRegistry()
 	ipam, err := ipam.NewWithClient(&client, ipam.IPAMParams{
-		NadName:          "nad",
-		NadNamespace:     "default",
-		ConcurrencyLimit: 1,
-		MetricsReg:       prom,
+		NadName:                  "nad",
+		NadNamespace:             "default",
+		ConcurrencyLimit:         1,
+		MigrateLegacyAllocations: migrateLegacyAllocations,
+		MetricsReg:               prom,
 	})
 
 	require.NoError(t, err)
@@ -241,3 +247,192 @@ func TestIPAMReleaseTwice(t *testing.T) {
 		Mask: ip.Mask,
 	}, ipResult)
 }
+
+func TestIPAMStaticIP(t *testing.T) {
+	params := makeIPAM(t,
+		`{
+			"ipRanges": [
+				{
+					"range":"10.100.123.0/24",
+					"range_start":"10.100.123.1",
+					"range_end":"10.100.123.127"
+				}
+			]
+		}`,
+	)
+	ipam := params.ipam
+	defer ipam.Close()
+
+	name := types.NamespacedName{
+		Namespace: "default",
+		Name:      "vm",
+	}
+
+	// Static IPs are allowed outside of range_start/range_end
+	ip, err := ipam.AcquireStaticIP(context.Background(), name, net.ParseIP("10.100.123.200"))
+	require.NoError(t, err)
+	assert.Equal(t, "10.100.123.200/24", ip.String())
+
+	// Same VM, same IP
+	ipResult, err := ipam.AcquireStaticIP(context.Background(), name, net.ParseIP("10.100.123.200"))
+	require.NoError(t, err)
+	assert.Equal(t, ip, ipResult)
+
+	// Same VM, different IP
+	_, err = ipam.AcquireStaticIP(context.Background(), name, net.ParseIP("10.100.123.201"))
+	require.Error(t, err)
+
+	// Different VM, same IP
+	name2 := types.NamespacedName{
+		Namespace: "default",
+		Name:      "vm2",
+	}
+	_, err = ipam.AcquireStaticIP(context.Background(), name2, net.ParseIP("10.100.123.200"))
+	require.Error(t, err)
+
+	// IP outside of the range
+	_, err = ipam.AcquireStaticIP(context.Background(), name2, net.ParseIP("10.100.124.1"))
+	require.Error(t, err)
+
+	// Released static IPs can be reused
+	_, err = ipam.ReleaseIP(context.Background(), name)
+	require.NoError(t, err)
+	ip2, err := ipam.AcquireStaticIP(context.Background(), name2, net.ParseIP("10.100.123.200"))
+	require.NoError(t, err)
+	assert.Equal(t, ip, ip2)
+}
+
+func TestIPAMAllocationObjects(t *testing.T) {
+	params := makeIPAM(t,
+		`{
+			"ipRanges": [
+				{
+					"range":"10.100.123.0/24",
+					"range_start":"10.100.123.1",
+					"range_end":"10.100.123.254"
+				}
+			]
+		}`,
+	)
+	ipam := params.ipam
+	defer ipam.Close()
+
+	name := types.NamespacedName{
+		Namespace: "default",
+		Name:      "vm",
+	}
+
+	ip, err := ipam.AcquireIP(context.Background(), name)
+	require.NoError(t, err)
+
+	// The allocation is recorded as its own object
+	allocations, err := ipam.VMClient.NeonvmV1().IPAllocations("default").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, allocations.Items, 1)
+	a := allocations.Items[0]
+	assert.Equal(t, "10.100.123.0-24-1", a.Name)
+	assert.Equal(t, "10.100.123.0-24", a.Labels[vmv1.IPAllocationPoolLabel])
+	assert.Equal(t, vmv1.IPAllocationSpec{Pool: "10.100.123.0-24", IP: ip.IP.String(), Owner: "default/vm"}, a.Spec)
+
+	// ... and removed on release
+	_, err = ipam.ReleaseIP(context.Background(), name)
+	require.NoError(t, err)
+	allocations, err = ipam.VMClient.NeonvmV1().IPAllocations("default").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, allocations.Items)
+}
+
+// createLegacyPool creates an IPPool with allocations from before IPAllocations existed
+func createLegacyPool(t *testing.T, ipam *ipam.IPAM, allocations map[string]vmv1.IPPoolAllocation) {
+	_, err := ipam.VMClient.NeonvmV1().IPPools("default").Create(context.Background(), &vmv1.IPPool{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "",
+			APIVersion: "",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "10.100.123.0-24",
+			Namespace: "default",
+		},
+		Spec: vmv1.IPPoolSpec{
+			Range:       "10.100.123.0/24",
+			Allocations: allocations,
+		},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+}
+
+func TestIPAMMigrateLegacyAllocations(t *testing.T) {
+	params := makeIPAMWithMigration(t,
+		`{
+			"ipRanges": [
+				{
+					"range":"10.100.123.0/24",
+					"range_start":"10.100.123.1",
+					"range_end":"10.100.123.254"
+				}
+			]
+		}`,
+		true,
+	)
+	ipam := params.ipam
+	defer ipam.Close()
+
+	createLegacyPool(t, ipam, map[string]vmv1.IPPoolAllocation{
+		"1": {ContainerID: "default/old-vm", PodRef: "default/old-pod"},
+	})
+
+	// New VMs don't get the IP that was already allocated
+	ip, err := ipam.AcquireIP(context.Background(), types.NamespacedName{Namespace: "default", Name: "vm"})
+	require.NoError(t, err)
+	assert.Equal(t, "10.100.123.2/24", ip.String())
+
+	pool, err := ipam.VMClient.NeonvmV1().IPPools("default").Get(context.Background(), "10.100.123.0-24", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, pool.Spec.Allocations)
+
+	// The migrated allocation keeps its PodRef
+	a, err := ipam.VMClient.NeonvmV1().IPAllocations("default").Get(context.Background(), "10.100.123.0-24-1", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, vmv1.IPAllocationSpec{
+		Pool:   "10.100.123.0-24",
+		IP:     "10.100.123.1",
+		Owner:  "default/old-vm",
+		PodRef: "default/old-pod",
+	}, a.Spec)
+
+	// The old VM can still release its IP
+	ip, err = ipam.ReleaseIP(context.Background(), types.NamespacedName{Namespace: "default", Name: "old-vm"})
+	require.NoError(t, err)
+	assert.Equal(t, "10.100.123.1/24", ip.String())
+}
+
+func TestIPAMLegacyAllocationsWithoutMigration(t *testing.T) {
+	params := makeIPAM(t,
+		`{
+			"ipRanges": [
+				{
+					"range":"10.100.123.0/24",
+					"range_start":"10.100.123.1",
+					"range_end":"10.100.123.254"
+				}
+			]
+		}`,
+	)
+	ipam := params.ipam
+	defer ipam.Close()
+
+	createLegacyPool(t, ipam, map[string]vmv1.IPPoolAllocation{
+		"1": {ContainerID: "default/old-vm", PodRef: ""},
+	})
+
+	_, err := ipam.AcquireIP(context.Background(), types.NamespacedName{Namespace: "default", Name: "vm"})
+	assert.ErrorContains(t, err, "migrating them is not enabled")
+
+	// The pool is left as-is, so older versions can still use it
+	pool, err := ipam.VMClient.NeonvmV1().IPPools("default").Get(context.Background(), "10.100.123.0-24", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Len(t, pool.Spec.Allocations, 1)
+	allocations, err := ipam.VMClient.NeonvmV1().IPAllocations("default").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, allocations.Items)
+}
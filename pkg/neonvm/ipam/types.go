@@ -14,6 +14,15 @@ func (t *temporaryError) Temporary() bool {
 	return true
 }
 
+// permanentError wraps an error that must not be retried, even if it is Temporary
+type permanentError struct {
+	err error
+}
+
+func (p permanentError) Error() string {
+	return p.err.Error()
+}
+
 type RangeConfiguration struct {
 	OmitRanges []string `json:"exclude,omitempty"`
 	Range      string   `json:"range"`
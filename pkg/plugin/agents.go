@@ -0,0 +1,328 @@
+package plugin
+
+// Tracking for live autoscaler-agents, via the handshakes they send to the /agent-handshake
+// endpoint.
+//
+// Each autoscaler-agent sends a handshake when it starts, and periodically after that, listing the
+// pods on its node that it's handling. We use that to report the number of live agents per node,
+// and to find "orphaned" pods -- pods that an autoscaler-agent has requested resources for, but
+// that no live autoscaler-agent is handling anymore. Without the handshakes, the only sign of this
+// would be the absence of requests for those pods.
+//
+// When an autoscaler-agent shuts down, it sends a "departing" request for each of its pods, after
+// which we stop considering those pods handled by it, so that they're reported as orphaned until
+// a replacement autoscaler-agent includes them in its handshake.
+//
+// Orphaned pods are only reported in logs and metrics; their reserved resources are left as-is,
+// because a replacement autoscaler-agent will pick them up again.
+//
+// Because handshakes determine which pods are reported as orphaned, they are authenticated: each
+// one must have a bearer token for the autoscaler-agent's ServiceAccount (checked with a
+// TokenReview), and must come from the IP address it claims to be from.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+// nodeAgents stores the autoscaler-agents on a single node that have sent handshakes
+type nodeAgents struct {
+	// agents is keyed by the autoscaler-agent's pod IP
+	agents map[string]liveAgent
+
+	// orphaned is the set of pods found to be orphaned in the latest scan, so that we only log
+	// about each one once.
+	orphaned map[types.UID]struct{}
+}
+
+type liveAgent struct {
+	lastSeen time.Time
+	pods     map[util.NamespacedName]struct{}
+}
+
+func (s *PluginState) agentHandshakeTimeout() time.Duration {
+	return time.Second * time.Duration(s.config.AgentHandshakeTimeoutSeconds)
+}
+
+// pluginCapabilities returns the optional protocol features supported by the scheduler plugin
+func pluginCapabilities() []api.ProtocolCapability {
+	return []api.ProtocolCapability{
+		api.CapabilityProtobuf,
+		api.CapabilityDenialReasons,
+	}
+}
+
+// handleAgentHandshake serves the /agent-handshake endpoint.
+func (s *PluginState) handleAgentHandshake(logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(400)
+			_, _ = w.Write([]byte("must be POST"))
+			return
+		}
+
+		if !s.isStartupDone() {
+			w.Header().Add("Content-Type", ContentTypeError)
+			w.Header().Add("Retry-After", s.retryAfter())
+			w.WriteHeader(503)
+			_, _ = w.Write([]byte(errStartupNotDone.Error()))
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Add("Content-Type", ContentTypeError)
+			w.WriteHeader(401)
+			_, _ = w.Write([]byte("missing bearer token"))
+			return
+		}
+
+		defer r.Body.Close()
+		var handshake api.AgentHandshake
+		// Handshakes include the list of all pods on the node, so they may be much larger than
+		// AgentRequests.
+		jsonDecoder := json.NewDecoder(io.LimitReader(r.Body, MaxHTTPBodySize<<8))
+		if err := jsonDecoder.Decode(&handshake); err != nil {
+			logger.Warn("Received bad JSON in agent handshake", zap.Error(err))
+			w.Header().Add("Content-Type", ContentTypeError)
+			w.WriteHeader(400)
+			_, _ = w.Write([]byte("bad JSON"))
+			return
+		}
+		if handshake.Node == "" || handshake.AgentIP == "" {
+			w.Header().Add("Content-Type", ContentTypeError)
+			w.WriteHeader(400)
+			_, _ = w.Write([]byte("node and agentIP must be non-empty"))
+			return
+		}
+
+		if status, err := s.authenticateAgent(r, token, handshake); err != nil {
+			logger.Warn(
+				"Rejecting unauthenticated agent handshake",
+				logFieldForNodeName(handshake.Node),
+				zap.String("agentIP", handshake.AgentIP),
+				zap.String("client", r.RemoteAddr),
+				zap.Error(err),
+			)
+			w.Header().Add("Content-Type", ContentTypeError)
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		s.recordAgentHandshake(logger, handshake)
+
+		resp := api.PluginHandshakeResponse{
+			ProtoRange: api.VersionRange[api.PluginProtoVersion]{
+				Min: MinPluginProtocolVersion,
+				Max: MaxPluginProtocolVersion,
+			},
+			Capabilities:   pluginCapabilities(),
+			TimeoutSeconds: uint(s.config.AgentHandshakeTimeoutSeconds),
+		}
+		responseBody, err := json.Marshal(&resp)
+		if err != nil {
+			logger.Panic("Failed to encode response JSON", zap.Error(err))
+		}
+
+		w.Header().Add("Content-Type", ContentTypeJSON)
+		w.WriteHeader(200)
+		_, _ = w.Write(responseBody)
+	}
+}
+
+// nodeNameExtraKey is the key in a TokenReview's user info for the node that the pod with the
+// token is running on. It is only set on newer versions of Kubernetes.
+const nodeNameExtraKey = "authentication.kubernetes.io/node-name"
+
+// authenticateAgent checks that the handshake is from an autoscaler-agent, returning the HTTP
+// status to respond with if it isn't.
+func (s *PluginState) authenticateAgent(r *http.Request, token string, handshake api.AgentHandshake) (int, error) {
+	review, err := s.reviewToken(token)
+	if err != nil {
+		return 500, fmt.Errorf("could not review token: %w", err)
+	}
+	if !review.Authenticated {
+		return 401, errors.New("invalid token")
+	}
+
+	sa := s.config.AgentServiceAccount
+	expectedUser := fmt.Sprintf("system:serviceaccount:%s:%s", sa.Namespace, sa.Name)
+	if review.User.Username != expectedUser {
+		return 403, fmt.Errorf("user %q is not the autoscaler-agent ServiceAccount", review.User.Username)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return 400, fmt.Errorf("could not parse client address %q: %w", r.RemoteAddr, err)
+	}
+	if clientIP, agentIP := net.ParseIP(host), net.ParseIP(handshake.AgentIP); !clientIP.Equal(agentIP) {
+		return 403, fmt.Errorf("agentIP %q does not match client address %q", handshake.AgentIP, host)
+	}
+
+	if nodes, ok := review.User.Extra[nodeNameExtraKey]; ok && !(len(nodes) == 1 && nodes[0] == handshake.Node) {
+		return 403, fmt.Errorf("node %q does not match token's node %v", handshake.Node, nodes)
+	}
+
+	return 0, nil
+}
+
+func (s *PluginState) recordAgentHandshake(logger *zap.Logger, handshake api.AgentHandshake) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	na, ok := s.agents[handshake.Node]
+	if !ok {
+		na = &nodeAgents{
+			agents:   make(map[string]liveAgent),
+			orphaned: make(map[types.UID]struct{}),
+		}
+		s.agents[handshake.Node] = na
+	}
+
+	if _, ok := na.agents[handshake.AgentIP]; !ok {
+		logger.Info(
+			"Received handshake from new autoscaler-agent",
+			logFieldForNodeName(handshake.Node),
+			zap.String("agentIP", handshake.AgentIP),
+			zap.Stringer("protoVersion", handshake.ProtoVersion),
+			zap.Any("capabilities", handshake.Capabilities),
+		)
+	}
+
+	pods := make(map[util.NamespacedName]struct{})
+	for _, p := range handshake.Pods {
+		pods[p] = struct{}{}
+	}
+	na.agents[handshake.AgentIP] = liveAgent{
+		lastSeen: time.Now(),
+		pods:     pods,
+	}
+	s.metrics.LiveAgents.WithLabelValues(handshake.Node).Set(float64(len(na.agents)))
+}
+
+// recordAgentDeparted updates the state after a departing request for the pod, so that no
+// autoscaler-agent is considered to be handling it until it's included in a new handshake.
+func (s *PluginState) recordAgentDeparted(logger *zap.Logger, pod *corev1.Pod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.agentResponses, pod.UID)
+
+	na, ok := s.agents[pod.Spec.NodeName]
+	if !ok {
+		return
+	}
+	podName := util.GetNamespacedName(pod)
+	for ip, agent := range na.agents {
+		if _, ok := agent.pods[podName]; ok {
+			logger.Info("Autoscaler-agent departed, no longer considering it to be handling the Pod", zap.String("agentIP", ip))
+			delete(agent.pods, podName)
+		}
+	}
+}
+
+// runAgentScanner periodically removes autoscaler-agents that haven't sent a handshake within the
+// timeout, and checks for orphaned pods, until the context is canceled.
+func (s *PluginState) runAgentScanner(
+	ctx context.Context,
+	logger *zap.Logger,
+	getPod func(util.NamespacedName) (*corev1.Pod, bool),
+) {
+	ticker := time.NewTicker(s.agentHandshakeTimeout() / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.scanAgents(logger, getPod)
+		}
+	}
+}
+
+func (s *PluginState) scanAgents(logger *zap.Logger, getPod func(util.NamespacedName) (*corev1.Pod, bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	timeout := s.agentHandshakeTimeout()
+
+	for nodeName, na := range s.agents {
+		logger := logger.With(logFieldForNodeName(nodeName))
+
+		ns, ok := s.nodes[nodeName]
+		if !ok {
+			// Node was removed; stop tracking its agents.
+			delete(s.agents, nodeName)
+			s.metrics.LiveAgents.DeleteLabelValues(nodeName)
+			s.metrics.OrphanedPods.DeleteLabelValues(nodeName)
+			continue
+		}
+
+		for ip, agent := range na.agents {
+			if time.Since(agent.lastSeen) >= timeout {
+				logger.Warn(
+					"Autoscaler-agent has not sent a handshake within timeout, considering it gone",
+					zap.String("agentIP", ip),
+					zap.Time("lastSeen", agent.lastSeen),
+				)
+				delete(na.agents, ip)
+			}
+		}
+		s.metrics.LiveAgents.WithLabelValues(nodeName).Set(float64(len(na.agents)))
+
+		orphaned := make(map[types.UID]struct{})
+		for uid, pod := range ns.node.Pods() {
+			if pod.VirtualMachine == (util.NamespacedName{}) && !pod.Standalone {
+				continue
+			}
+
+			handled := false
+			for _, agent := range na.agents {
+				if _, ok := agent.pods[pod.NamespacedName]; ok {
+					handled = true
+					break
+				}
+			}
+			if handled {
+				continue
+			}
+
+			// Only pods that an autoscaler-agent has previously requested resources for can be
+			// orphaned; otherwise, autoscaling may just be disabled for the pod.
+			podObj, ok := getPod(pod.NamespacedName)
+			if !ok {
+				continue
+			}
+			if _, ok := podObj.Annotations[api.InternalAnnotationResourcesRequested]; !ok {
+				continue
+			}
+
+			orphaned[uid] = struct{}{}
+			if _, ok := na.orphaned[uid]; !ok {
+				logger.Warn(
+					"Found orphaned Pod with reserved resources that no live autoscaler-agent is handling",
+					zap.Object("Pod", pod),
+				)
+			}
+		}
+		na.orphaned = orphaned
+		s.metrics.OrphanedPods.WithLabelValues(nodeName).Set(float64(len(orphaned)))
+	}
+}
@@ -0,0 +1,261 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	authv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/plugin/metrics"
+	"github.com/neondatabase/autoscaling/pkg/plugin/state"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+const (
+	testAgentToken    = "agent-token"
+	testAgentUsername = "system:serviceaccount:kube-system:autoscaler-agent"
+)
+
+// newTestAgentsState returns a PluginState with just enough set for tracking autoscaler-agents.
+//
+// Tokens are valid if they are testAgentToken, for the autoscaler-agent ServiceAccount, or any
+// string starting with "user:" for the user named by the rest of the token.
+func newTestAgentsState() *PluginState {
+	//nolint:exhaustruct // only the fields used by agents.go
+	return &PluginState{
+		config: Config{ //nolint:exhaustruct // same as above
+			AgentHandshakeTimeoutSeconds: 1,
+			AgentServiceAccount:          util.NamespacedName{Namespace: "kube-system", Name: "autoscaler-agent"},
+		},
+		nodes:          make(map[string]*nodeState),
+		agents:         make(map[string]*nodeAgents),
+		agentResponses: make(map[types.UID]agentResponse),
+		startupDone:    true,
+		metrics:        metrics.BuildPluginMetrics(nil, prometheus.NewRegistry()),
+		reviewToken: func(token string) (authv1.TokenReviewStatus, error) {
+			//nolint:exhaustruct // only the fields checked by authenticateAgent
+			status := authv1.TokenReviewStatus{}
+			if token == testAgentToken {
+				status.Authenticated = true
+				status.User.Username = testAgentUsername
+			} else if user, ok := strings.CutPrefix(token, "user:"); ok {
+				status.Authenticated = true
+				status.User.Username = user
+			}
+			return status, nil
+		},
+	}
+}
+
+func sendTestHandshake(t *testing.T, s *PluginState, token string, handshake api.AgentHandshake) *httptest.ResponseRecorder {
+	body, err := json.Marshal(handshake)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, "/agent-handshake", bytes.NewReader(body))
+	req.RemoteAddr = "10.0.0.1:45678"
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.handleAgentHandshake(zap.NewNop())(w, req)
+	return w
+}
+
+func testHandshake(node string, pods ...util.NamespacedName) api.AgentHandshake {
+	return api.AgentHandshake{
+		ProtoVersion: api.PluginProtoV5_1,
+		Node:         node,
+		AgentIP:      "10.0.0.1",
+		Capabilities: []api.ProtocolCapability{api.CapabilityDenialReasons},
+		Pods:         pods,
+	}
+}
+
+func TestAgentHandshake(t *testing.T) {
+	s := newTestAgentsState()
+	pod := util.NamespacedName{Namespace: "default", Name: "pod"}
+
+	w := sendTestHandshake(t, s, testAgentToken, testHandshake("node-1", pod))
+	require.Equal(t, 200, w.Code, w.Body.String())
+
+	var resp api.PluginHandshakeResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, api.PluginHandshakeResponse{
+		ProtoRange: api.VersionRange[api.PluginProtoVersion]{
+			Min: MinPluginProtocolVersion,
+			Max: MaxPluginProtocolVersion,
+		},
+		Capabilities:   pluginCapabilities(),
+		TimeoutSeconds: 1,
+	}, resp)
+
+	require.Contains(t, s.agents, "node-1")
+	require.Contains(t, s.agents["node-1"].agents, "10.0.0.1")
+	assert.Equal(t, map[util.NamespacedName]struct{}{pod: {}}, s.agents["node-1"].agents["10.0.0.1"].pods)
+	assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.LiveAgents.WithLabelValues("node-1")))
+
+	// A later handshake replaces the set of pods
+	w = sendTestHandshake(t, s, testAgentToken, testHandshake("node-1"))
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.Empty(t, s.agents["node-1"].agents["10.0.0.1"].pods)
+	assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.LiveAgents.WithLabelValues("node-1")))
+}
+
+func TestAgentHandshakeRejected(t *testing.T) {
+	otherIP := testHandshake("node-1")
+	otherIP.AgentIP = "10.0.0.2"
+
+	cases := []struct {
+		name      string
+		token     string
+		handshake api.AgentHandshake
+		status    int
+	}{
+		{"NoToken", "", testHandshake("node-1"), 401},
+		{"InvalidToken", "bad-token", testHandshake("node-1"), 401},
+		{"OtherUser", "user:system:serviceaccount:default:other", testHandshake("node-1"), 403},
+		{"OtherIP", testAgentToken, otherIP, 403},
+		{"MissingNode", testAgentToken, testHandshake(""), 400},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newTestAgentsState()
+			w := sendTestHandshake(t, s, c.token, c.handshake)
+			assert.Equal(t, c.status, w.Code, w.Body.String())
+			assert.Empty(t, s.agents)
+		})
+	}
+
+	t.Run("WrongNode", func(t *testing.T) {
+		s := newTestAgentsState()
+		review := s.reviewToken
+		s.reviewToken = func(token string) (authv1.TokenReviewStatus, error) {
+			status, err := review(token)
+			status.User.Extra = map[string]authv1.ExtraValue{nodeNameExtraKey: {"node-2"}}
+			return status, err
+		}
+		w := sendTestHandshake(t, s, testAgentToken, testHandshake("node-1"))
+		assert.Equal(t, 403, w.Code, w.Body.String())
+		assert.Empty(t, s.agents)
+
+		w = sendTestHandshake(t, s, testAgentToken, testHandshake("node-2"))
+		assert.Equal(t, 200, w.Code, w.Body.String())
+	})
+
+	t.Run("StartupNotDone", func(t *testing.T) {
+		s := newTestAgentsState()
+		s.startupDone = false
+		s.config.BackpressureRetryAfterSeconds = 2
+		w := sendTestHandshake(t, s, testAgentToken, testHandshake("node-1"))
+		assert.Equal(t, 503, w.Code)
+		assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	})
+}
+
+func TestScanAgents(t *testing.T) {
+	s := newTestAgentsState()
+
+	handled := util.NamespacedName{Namespace: "default", Name: "handled"}
+	orphaned := util.NamespacedName{Namespace: "default", Name: "orphaned"}
+	notRequested := util.NamespacedName{Namespace: "default", Name: "not-requested"}
+
+	noOvercommit := resource.MustParse("1")
+	node := state.NodeStateFromParams("node-1", 10000, 1<<40, 0.8, nil)
+	for i, name := range []util.NamespacedName{handled, orphaned, notRequested} {
+		//nolint:exhaustruct // only the fields used by scanAgents
+		node.AddPod(state.Pod{
+			NamespacedName: name,
+			UID:            types.UID(name.Name),
+			VirtualMachine: util.NamespacedName{Namespace: "default", Name: "vm-" + string(rune('a'+i))},
+			CPU:            state.PodResources[vmv1.MilliCPU]{Overcommit: &noOvercommit}, //nolint:exhaustruct // see above
+			Mem:            state.PodResources[api.Bytes]{Overcommit: &noOvercommit},     //nolint:exhaustruct // see above
+		})
+	}
+	s.nodes["node-1"] = &nodeState{node: node, requestedMigrations: nil, podsVMPatchedAt: nil}
+
+	getPod := func(name util.NamespacedName) (*corev1.Pod, bool) {
+		pod := &corev1.Pod{}
+		pod.Name = name.Name
+		pod.Namespace = name.Namespace
+		if name != notRequested {
+			pod.Annotations = map[string]string{api.InternalAnnotationResourcesRequested: "{}"}
+		}
+		return pod, true
+	}
+
+	s.recordAgentHandshake(zap.NewNop(), testHandshake("node-1", handled))
+	s.scanAgents(zap.NewNop(), getPod)
+
+	assert.Equal(t, map[types.UID]struct{}{"orphaned": {}}, s.agents["node-1"].orphaned)
+	assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.OrphanedPods.WithLabelValues("node-1")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.LiveAgents.WithLabelValues("node-1")))
+
+	// When the agent departs from a pod, it's orphaned as well
+	departed := &corev1.Pod{}
+	departed.Name = handled.Name
+	departed.Namespace = handled.Namespace
+	departed.UID = "handled"
+	departed.Spec.NodeName = "node-1"
+	s.recordAgentDeparted(zap.NewNop(), departed)
+	s.scanAgents(zap.NewNop(), getPod)
+	assert.Equal(t, map[types.UID]struct{}{"orphaned": {}, "handled": {}}, s.agents["node-1"].orphaned)
+
+	// Agents that haven't sent a handshake within the timeout are removed
+	agent := s.agents["node-1"].agents["10.0.0.1"]
+	agent.lastSeen = time.Now().Add(-time.Minute)
+	s.agents["node-1"].agents["10.0.0.1"] = agent
+	s.scanAgents(zap.NewNop(), getPod)
+	assert.Empty(t, s.agents["node-1"].agents)
+	assert.Equal(t, 0.0, testutil.ToFloat64(s.metrics.LiveAgents.WithLabelValues("node-1")))
+
+	// Agents on removed nodes are no longer tracked
+	delete(s.nodes, "node-1")
+	s.scanAgents(zap.NewNop(), getPod)
+	assert.Empty(t, s.agents)
+}
+
+func TestRunAgentScanner(t *testing.T) {
+	s := newTestAgentsState()
+	s.nodes["node-1"] = &nodeState{
+		node:                state.NodeStateFromParams("node-1", 10000, 1<<40, 0.8, nil),
+		requestedMigrations: nil,
+		podsVMPatchedAt:     nil,
+	}
+	s.recordAgentHandshake(zap.NewNop(), testHandshake("node-1"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.runAgentScanner(ctx, zap.NewNop(), func(util.NamespacedName) (*corev1.Pod, bool) { return nil, false })
+	}()
+
+	// With a timeout of 1s, the agent should be removed without another handshake
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.agents["node-1"].agents) == 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	cancel()
+	wg.Wait()
+}
@@ -0,0 +1,44 @@
+package plugin
+
+// Advertising node capacity as the compute unit extended resource, if enabled.
+//
+// This works like a device plugin that only advertises capacity: the extended resource is set in
+// the Node's status, so that standard tooling (e.g. ResourceQuotas) can see compute units requested
+// by VM runner pods. The actual CPU and memory limits are still enforced by this plugin.
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/plugin/state"
+)
+
+// advertiseComputeUnits updates the compute unit extended resource in the node's status to match
+// the total resources we have for the node, if enabled and not already up-to-date.
+func (s *PluginState) advertiseComputeUnits(logger *zap.Logger, node *corev1.Node, n *state.Node) error {
+	cu := s.config.ComputeUnitResource
+	if cu == nil {
+		return nil
+	}
+
+	// Extended resources can only be advertised in whole units, so any fraction is dropped.
+	total := api.Resources{VCPU: n.CPU.Total, Mem: n.Mem.Total}.ComputeUnitsWithin(*cu).Floor()
+	value := *resource.NewQuantity(int64(total), resource.DecimalSI)
+
+	current, ok := node.Status.Capacity[api.ResourceComputeUnit]
+	if ok && current.Equal(value) {
+		return nil
+	}
+
+	if err := s.setNodeExtendedResource(node.Name, api.ResourceComputeUnit, value); err != nil {
+		return fmt.Errorf("could not patch Node status: %w", err)
+	}
+
+	logger.Info("Advertised compute units for Node", zap.Uint32("computeUnits", total))
+	return nil
+}
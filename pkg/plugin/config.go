@@ -6,6 +6,12 @@ import (
 	"fmt"
 	"os"
 	"slices"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/util"
 )
 
 //////////////////
@@ -17,6 +23,9 @@ import (
 // It is parsed from a JSON file in a separate ConfigMap.
 type Config struct {
 	// Scoring defines our policies around how to weight where Pods should be scheduled.
+	//
+	// This applies to pods using SchedulerName. Pods using any of the additional Profiles use the
+	// scoring config for that profile instead.
 	Scoring ScoringConfig `json:"scoring"`
 
 	// Watermark is the fraction of total resources allocated above which we should be migrating VMs
@@ -27,6 +36,14 @@ type Config struct {
 	// version handled.
 	SchedulerName string `json:"schedulerName"`
 
+	// Profiles, if provided, gives the settings for additional scheduler profiles that the plugin is
+	// enabled under, keyed by their schedulerName.
+	//
+	// This allows a single scheduler deployment to give different placement behavior to different
+	// workloads, selected by the VM's schedulerName. All profiles share the same view of the
+	// cluster, so resources reserved under one profile are counted by the others.
+	Profiles map[string]ProfileConfig `json:"profiles,omitempty"`
+
 	// ReconcileWorkers sets the number of parallel workers to use for the global reconcile queue.
 	ReconcileWorkers int `json:"reconcileWorkers"`
 
@@ -49,6 +66,42 @@ type Config struct {
 	// kubernetes objects.
 	K8sCRUDTimeoutSeconds int `json:"k8sCRUDTimeoutSeconds"`
 
+	// ReservationTimeoutSeconds sets the maximum duration, in seconds, that resources reserved for
+	// a pod by the Reserve method are held before the pod is bound. After this, the reservation is
+	// considered stuck, and released (unless DisableReservationExpiry is true).
+	//
+	// This is a safeguard against leaking reserved resources; normally the reservation is released
+	// by Unreserve if binding fails.
+	ReservationTimeoutSeconds int `json:"reservationTimeoutSeconds"`
+
+	// DisableReservationExpiry, if true, stops stuck reservations from being automatically
+	// released. They are still reported in metrics, and can be cleared manually.
+	DisableReservationExpiry bool `json:"disableReservationExpiry"`
+
+	// AgentHandshakeTimeoutSeconds sets the duration, in seconds, after which an autoscaler-agent
+	// that hasn't sent a handshake is considered gone, and the pods it was handling are reported
+	// as orphaned.
+	AgentHandshakeTimeoutSeconds int `json:"agentHandshakeTimeoutSeconds"`
+
+	// AgentServiceAccount is the ServiceAccount that autoscaler-agents run as.
+	//
+	// Handshakes must be authenticated with a token for this ServiceAccount, which the plugin
+	// checks with a TokenReview.
+	AgentServiceAccount util.NamespacedName `json:"agentServiceAccount"`
+
+	// MaxInFlightAgentRequests, if non-zero, gives the maximum number of autoscaler-agent requests
+	// that may be handled at once. Requests above this limit are rejected with a 503 and a
+	// Retry-After header, so that agents back off rather than piling more requests onto an
+	// overloaded scheduler.
+	MaxInFlightAgentRequests int `json:"maxInFlightAgentRequests"`
+
+	// BackpressureRetryAfterSeconds sets the duration, in seconds, given in the Retry-After header
+	// when autoscaler-agent requests are rejected due to MaxInFlightAgentRequests or because the
+	// plugin is still handling the initial cluster state.
+	//
+	// Agents add jitter on top of this, so that they don't all retry at the same time.
+	BackpressureRetryAfterSeconds int `json:"backpressureRetryAfterSeconds"`
+
 	// PatchRetryWaitSeconds sets the minimum duration, in seconds, that we must wait between
 	// successive patch operations on a VirtualMachine object.
 	PatchRetryWaitSeconds int `json:"patchRetryWaitSeconds"`
@@ -75,6 +128,112 @@ type Config struct {
 	// resources from such pods. The reason to do that is so that these overprovisioning pods can be
 	// evicted, which will allow cluster-autoscaler to trigger scale-up.
 	IgnoredNamespaces []string `json:"ignoredNamespaces"`
+
+	// ExcludedNamespaces, if provided, gives a list of namespaces whose pods the plugin should not
+	// account for at all -- *including* during Filter method calls, unlike IgnoredNamespaces.
+	//
+	// Pods in these namespaces are also excluded from the plugin's watch, which reduces the memory
+	// and processing required for large namespaces that the plugin doesn't care about (e.g. system
+	// or CI namespaces), or pods whose resources are managed by some other mechanism.
+	ExcludedNamespaces []string `json:"excludedNamespaces"`
+
+	// IncludedNamespaces, if provided, gives the list of namespaces whose pods the plugin should
+	// account for. Pods in all other namespaces are treated as if they were in ExcludedNamespaces.
+	//
+	// Unlike ExcludedNamespaces, pods outside these namespaces are only filtered out after being
+	// received from the watch.
+	IncludedNamespaces []string `json:"includedNamespaces"`
+
+	// NodeMemoryOvercommit, if provided, gives factors by which to scale the schedulable memory of
+	// matching nodes, e.g. to make use of the savings from returning free guest memory to the host.
+	//
+	// For each node, the first entry with a matching NodeSelector is used. Nodes without a match
+	// are not overcommitted.
+	//
+	// As a safeguard, overcommit is never applied to nodes reporting the MemoryPressure condition.
+	NodeMemoryOvercommit []NodeOvercommitConfig `json:"nodeMemoryOvercommit"`
+
+	// MaxVMsPerNode, if non-zero, gives the maximum number of VM pods that may be placed on each
+	// node, regardless of available resources. This is because per-VM overheads (e.g. tap devices,
+	// QMP sockets, IRQs) can become the limiting factor before CPU or memory.
+	//
+	// The limit applies when scheduling new VM pods and picking migration targets. Pods already on
+	// the node are never removed for being over the limit.
+	//
+	// The limit for an individual node can be overridden with the "autoscaling.neon.tech/max-vms"
+	// annotation on the Node, where zero means no limit. Invalid annotation values are ignored, with
+	// a warning.
+	MaxVMsPerNode int `json:"maxVMsPerNode"`
+
+	// DisableMemoryOvercommit, if true, ignores NodeMemoryOvercommit entirely. This is intended as
+	// a kill-switch, without needing to remove the per-node-group settings.
+	DisableMemoryOvercommit bool `json:"disableMemoryOvercommit"`
+
+	// Profiling, if provided, enables continuously pushing profiles of the scheduler
+	Profiling *util.ProfilingConfig `json:"profiling,omitempty"`
+
+	// PPROF, if provided, overrides the default configuration of the pprof server, which otherwise
+	// binds to util.DefaultPPROFAddr with no optional profiles or authentication.
+	PPROF *util.PPROFConfig `json:"pprof,omitempty"`
+
+	// ScaleUpHintAnnotation, if true, sets the scale-up hint annotation on Pods that we can't give
+	// the resources they need due to lack of capacity -- either because the VM can't be placed on
+	// any node, or because an upscale was denied. The annotation gives the resources required, so
+	// that node autoscalers can provision appropriately sized nodes.
+	ScaleUpHintAnnotation bool `json:"scaleUpHintAnnotation"`
+
+	// EventRateLimit, if provided, limits the rate at which we emit events on pods (e.g., for
+	// denied upscales). Events over the limit are dropped.
+	EventRateLimit *util.RateLimitConfig `json:"eventRateLimit,omitempty"`
+
+	// Preemption, if provided, enables evicting lower-priority non-VM pods to make room for VM pods
+	// that could not otherwise be scheduled.
+	Preemption *PreemptionConfig `json:"preemption,omitempty"`
+
+	// ComputeUnitResource, if provided, gives the size of a compute unit, and enables advertising
+	// each node's capacity as the "neon.tech/compute-unit" extended resource.
+	//
+	// This allows standard tooling (e.g. ResourceQuotas) to see compute unit usage, if VM runner
+	// pods request the resource. The plugin still enforces the actual CPU and memory limits.
+	ComputeUnitResource *api.Resources `json:"computeUnitResource,omitempty"`
+	// ComputeUnitResourceFile, if provided, gives the path to a JSON file with the value for
+	// ComputeUnitResource, so that a single per-cluster compute unit definition can be shared with
+	// the autoscaler-agent and NeonVM controller. If set, ComputeUnitResource must be omitted.
+	ComputeUnitResourceFile string `json:"computeUnitResourceFile,omitempty"`
+
+	// StrictAgentRequestValidation, if true, rejects requests from the autoscaler-agent that do not
+	// exactly match the published AgentRequest schema (see pkg/api/schemas) - e.g. because they have
+	// unknown or missing fields - instead of decoding them on a best-effort basis.
+	StrictAgentRequestValidation bool `json:"strictAgentRequestValidation"`
+}
+
+type PreemptionConfig struct {
+	// MaxVictimsPerNode is the maximum number of pods that may be evicted from a single node in
+	// order to make room for a VM pod.
+	MaxVictimsPerNode int `json:"maxVictimsPerNode"`
+}
+
+type ProfileConfig struct {
+	// Scoring defines the policies around how to weight where Pods using this profile should be
+	// scheduled.
+	Scoring ScoringConfig `json:"scoring"`
+
+	// Watermark, if non-zero, is the fraction of a node's total resources above which Pods using
+	// this profile will not be placed onto it.
+	//
+	// Unlike the top-level Watermark, this does not trigger migrations, because nodes are shared
+	// between profiles.
+	Watermark float64 `json:"watermark"`
+}
+
+type NodeOvercommitConfig struct {
+	// NodeSelector gives the set of labels that a node must have, all with the same values, for
+	// this entry to apply to it.
+	NodeSelector map[string]string `json:"nodeSelector"`
+
+	// Factor is the fraction of the node's allocatable memory that we allow to be reserved, e.g.
+	// 1.2 to allow scheduling up to 120% of the node's memory.
+	Factor float64 `json:"factor"`
 }
 
 type ScoringConfig struct {
@@ -119,6 +278,17 @@ func (c *Config) validate() (string, error) {
 		return "schedulerName", errors.New("string cannot be empty")
 	}
 
+	for name, p := range c.Profiles {
+		if name == "" {
+			return "profiles", errors.New("profile name cannot be empty")
+		} else if name == c.SchedulerName {
+			return fmt.Sprintf("profiles.%s", name), errors.New("profile name cannot be the same as schedulerName")
+		}
+		if path, err := p.validate(); err != nil {
+			return fmt.Sprintf("profiles.%s.%s", name, path), err
+		}
+	}
+
 	if c.ReconcileWorkers <= 0 {
 		return "reconcileWorkers", errors.New("value must be > 0")
 	}
@@ -135,6 +305,26 @@ func (c *Config) validate() (string, error) {
 		return "k8sCRUDTimeoutSeconds", errors.New("value must be > 0")
 	}
 
+	if c.ReservationTimeoutSeconds <= 0 {
+		return "reservationTimeoutSeconds", errors.New("value must be > 0")
+	}
+
+	if c.AgentHandshakeTimeoutSeconds <= 0 {
+		return "agentHandshakeTimeoutSeconds", errors.New("value must be > 0")
+	}
+
+	if c.AgentServiceAccount.Namespace == "" || c.AgentServiceAccount.Name == "" {
+		return "agentServiceAccount", errors.New("namespace and name must be non-empty")
+	}
+
+	if c.MaxInFlightAgentRequests < 0 {
+		return "maxInFlightAgentRequests", errors.New("value must be >= 0")
+	}
+
+	if c.BackpressureRetryAfterSeconds <= 0 {
+		return "backpressureRetryAfterSeconds", errors.New("value must be > 0")
+	}
+
 	if c.PatchRetryWaitSeconds <= 0 {
 		return "patchRetryWaitSeconds", errors.New("value must be > 0")
 	}
@@ -145,6 +335,105 @@ func (c *Config) validate() (string, error) {
 		return "watermark", errors.New("value must be <= 1")
 	}
 
+	if c.MaxVMsPerNode < 0 {
+		return "maxVMsPerNode", errors.New("value must be >= 0")
+	}
+
+	for i, ns := range c.ExcludedNamespaces {
+		if ns == "" {
+			return fmt.Sprintf("excludedNamespaces[%d]", i), errors.New("string cannot be empty")
+		} else if slices.Contains(c.IncludedNamespaces, ns) {
+			return fmt.Sprintf("excludedNamespaces[%d]", i), errors.New("namespace cannot be both included and excluded")
+		}
+	}
+	for i, ns := range c.IncludedNamespaces {
+		if ns == "" {
+			return fmt.Sprintf("includedNamespaces[%d]", i), errors.New("string cannot be empty")
+		}
+	}
+
+	for i, o := range c.NodeMemoryOvercommit {
+		if path, err := o.validate(); err != nil {
+			return fmt.Sprintf("nodeMemoryOvercommit[%d].%s", i, path), err
+		}
+	}
+
+	if c.Profiling != nil {
+		if c.Profiling.ServerURL == "" {
+			return "profiling.serverURL", errors.New("string cannot be empty")
+		} else if c.Profiling.ApplicationName == "" {
+			return "profiling.applicationName", errors.New("string cannot be empty")
+		} else if c.Profiling.UploadIntervalSeconds == 0 {
+			return "profiling.uploadIntervalSeconds", errors.New("value must be > 0")
+		}
+	}
+
+	if c.PPROF != nil {
+		if c.PPROF.Addr == "" {
+			return "pprof.addr", errors.New("string cannot be empty")
+		} else if c.PPROF.MutexProfileFraction < 0 {
+			return "pprof.mutexProfileFraction", errors.New("value must be >= 0")
+		} else if c.PPROF.BlockProfileRate < 0 {
+			return "pprof.blockProfileRate", errors.New("value must be >= 0")
+		} else if c.PPROF.BasicAuth != nil && c.PPROF.BasicAuth.Username == "" {
+			return "pprof.basicAuth.username", errors.New("string cannot be empty")
+		} else if c.PPROF.BasicAuth != nil && c.PPROF.BasicAuth.PasswordFile == "" {
+			return "pprof.basicAuth.passwordFile", errors.New("string cannot be empty")
+		}
+	}
+
+	if c.EventRateLimit != nil && c.EventRateLimit.Rate < 0 {
+		return "eventRateLimit.rate", errors.New("value must be >= 0")
+	}
+
+	if c.Preemption != nil {
+		if path, err := c.Preemption.validate(); err != nil {
+			return fmt.Sprintf("preemption.%s", path), err
+		}
+	}
+
+	if c.ComputeUnitResource != nil {
+		if err := c.ComputeUnitResource.ValidateNonZero(); err != nil {
+			return "computeUnitResource", err
+		}
+	}
+
+	return "", nil
+}
+
+// maxNodeOvercommitFactor is the upper bound for NodeOvercommitConfig.Factor, to guard against
+// configuration mistakes.
+const maxNodeOvercommitFactor = 2.0
+
+func (c *NodeOvercommitConfig) validate() (string, error) {
+	if c.Factor < 1.0 {
+		return "factor", errors.New("value must be >= 1")
+	} else if c.Factor > maxNodeOvercommitFactor {
+		return "factor", fmt.Errorf("value must be <= %v", maxNodeOvercommitFactor)
+	}
+
+	return "", nil
+}
+
+func (c *ProfileConfig) validate() (string, error) {
+	if path, err := c.Scoring.validate(); err != nil {
+		return fmt.Sprintf("scoring.%s", path), err
+	}
+
+	if c.Watermark < 0.0 {
+		return "watermark", errors.New("value must be >= 0")
+	} else if c.Watermark > 1.0 {
+		return "watermark", errors.New("value must be <= 1")
+	}
+
+	return "", nil
+}
+
+func (c *PreemptionConfig) validate() (string, error) {
+	if c.MaxVictimsPerNode <= 0 {
+		return "maxVictimsPerNode", errors.New("value must be > 0")
+	}
+
 	return "", nil
 }
 
@@ -180,6 +469,17 @@ func ReadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("Error decoding JSON config in %q: %w", path, err)
 	}
 
+	if file := config.ComputeUnitResourceFile; file != "" {
+		if config.ComputeUnitResource != nil {
+			return nil, errors.New("Invalid config: computeUnitResource and computeUnitResourceFile cannot both be set")
+		}
+		cu, err := api.ReadComputeUnitFile(file)
+		if err != nil {
+			return nil, err
+		}
+		config.ComputeUnitResource = &cu
+	}
+
 	if path, err = config.validate(); err != nil {
 		return nil, fmt.Errorf("Invalid config at %s: %w", path, err)
 	}
@@ -191,6 +491,103 @@ func ReadConfig(path string) (*Config, error) {
 // HELPER METHODS FOR USING CONFIGS //
 //////////////////////////////////////
 
+// ignoredNamespace returns whether pods in the namespace should be ignored, outside of Filter.
+//
+// This includes namespaces that are not accounted for at all.
 func (c Config) ignoredNamespace(namespace string) bool {
-	return slices.Contains(c.IgnoredNamespaces, namespace)
+	return slices.Contains(c.IgnoredNamespaces, namespace) || !c.accountedNamespace(namespace)
+}
+
+// accountedNamespace returns whether pods in the namespace should be counted towards node usage, at
+// least during Filter method calls.
+func (c Config) accountedNamespace(namespace string) bool {
+	if slices.Contains(c.ExcludedNamespaces, namespace) {
+		return false
+	}
+	return len(c.IncludedNamespaces) == 0 || slices.Contains(c.IncludedNamespaces, namespace)
+}
+
+// isOurScheduler returns whether pods with the given schedulerName are handled by the plugin,
+// under any of its profiles.
+func (c Config) isOurScheduler(schedulerName string) bool {
+	if schedulerName == c.SchedulerName {
+		return true
+	}
+	_, ok := c.Profiles[schedulerName]
+	return ok
+}
+
+// profileFor returns the settings to use for pods with the given schedulerName.
+//
+// The top-level settings are used if there is no matching profile.
+func (c Config) profileFor(schedulerName string) ProfileConfig {
+	if p, ok := c.Profiles[schedulerName]; ok {
+		return p
+	}
+	return ProfileConfig{
+		Scoring:   c.Scoring,
+		Watermark: 0, // no limit; the top-level watermark triggers migrations instead.
+	}
+}
+
+// anyRandomizedScoring returns whether Scoring.Randomize is set for any profile.
+func (c Config) anyRandomizedScoring() bool {
+	if c.Scoring.Randomize {
+		return true
+	}
+	for _, p := range c.Profiles {
+		if p.Scoring.Randomize {
+			return true
+		}
+	}
+	return false
+}
+
+// maxVMsForNode returns the maximum number of VM pods allowed on the node, or zero if there's no
+// limit.
+//
+// If the node has an invalid value for the override annotation, the configured default is returned
+// alongside the error.
+func (c Config) maxVMsForNode(node *corev1.Node) (int, error) {
+	value, ok := node.Annotations[api.AnnotationNodeMaxVMs]
+	if !ok {
+		return c.MaxVMsPerNode, nil
+	}
+
+	maxVMs, err := strconv.Atoi(value)
+	if err != nil {
+		return c.MaxVMsPerNode, fmt.Errorf("could not parse %q annotation: %w", api.AnnotationNodeMaxVMs, err)
+	} else if maxVMs < 0 {
+		return c.MaxVMsPerNode, fmt.Errorf("%q annotation must be >= 0, got %d", api.AnnotationNodeMaxVMs, maxVMs)
+	}
+	return maxVMs, nil
+}
+
+// memoryOvercommitFactor returns the factor by which to scale the node's allocatable memory, or 1
+// if it should not be overcommitted.
+func (c Config) memoryOvercommitFactor(node *corev1.Node) float64 {
+	if c.DisableMemoryOvercommit {
+		return 1.0
+	}
+
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == corev1.NodeMemoryPressure && cond.Status == corev1.ConditionTrue {
+			return 1.0
+		}
+	}
+
+	for _, o := range c.NodeMemoryOvercommit {
+		matches := true
+		for label, value := range o.NodeSelector {
+			if v, ok := node.Labels[label]; !ok || v != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return o.Factor
+		}
+	}
+
+	return 1.0
 }
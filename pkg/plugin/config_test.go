@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestMemoryOvercommitFactor(t *testing.T) {
+	overcommit := []NodeOvercommitConfig{
+		{NodeSelector: map[string]string{"pool": "big", "zone": "a"}, Factor: 1.5},
+		{NodeSelector: map[string]string{"pool": "big"}, Factor: 1.2},
+		{NodeSelector: map[string]string{}, Factor: 1.1},
+	}
+
+	node := func(labels map[string]string, memoryPressure bool) *corev1.Node {
+		n := &corev1.Node{}
+		n.Labels = labels
+		if memoryPressure {
+			n.Status.Conditions = []corev1.NodeCondition{
+				{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionTrue},
+			}
+		}
+		return n
+	}
+
+	cases := []struct {
+		name       string
+		overcommit []NodeOvercommitConfig
+		disable    bool
+		node       *corev1.Node
+		expected   float64
+	}{
+		{"AllLabelsMatch", overcommit, false, node(map[string]string{"pool": "big", "zone": "a"}, false), 1.5},
+		{"FirstMatchWins", overcommit, false, node(map[string]string{"pool": "big", "zone": "b"}, false), 1.2},
+		{"EmptySelectorMatchesAll", overcommit, false, node(map[string]string{"pool": "small"}, false), 1.1},
+		{"NoLabels", overcommit, false, node(nil, false), 1.1},
+		{"NoMatch", overcommit[:2], false, node(map[string]string{"pool": "small"}, false), 1.0},
+		{"NoConfig", nil, false, node(map[string]string{"pool": "big"}, false), 1.0},
+		{"MemoryPressure", overcommit, false, node(map[string]string{"pool": "big", "zone": "a"}, true), 1.0},
+		{"Disabled", overcommit, true, node(map[string]string{"pool": "big", "zone": "a"}, false), 1.0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			//nolint:exhaustruct // only the fields used by memoryOvercommitFactor
+			config := Config{NodeMemoryOvercommit: c.overcommit, DisableMemoryOvercommit: c.disable}
+			assert.Equal(t, c.expected, config.memoryOvercommitFactor(c.node))
+		})
+	}
+}
+
+func TestNodeOvercommitConfigValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		factor float64
+		valid  bool
+	}{
+		{"NoOvercommit", 1.0, true},
+		{"Overcommit", 1.5, true},
+		{"Max", maxNodeOvercommitFactor, true},
+		{"Undercommit", 0.9, false},
+		{"Zero", 0, false},
+		{"Negative", -1.2, false},
+		{"OverMax", maxNodeOvercommitFactor + 0.1, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			config := NodeOvercommitConfig{NodeSelector: map[string]string{"pool": "big"}, Factor: c.factor}
+			path, err := config.validate()
+			if c.valid {
+				assert.NoError(t, err)
+				assert.Empty(t, path)
+			} else {
+				assert.Error(t, err)
+				assert.Equal(t, "factor", path)
+			}
+		})
+	}
+}
@@ -111,7 +111,7 @@ func NewAutoscaleEnforcerPlugin(
 	}
 
 	podHandlers := watchHandlers[*corev1.Pod](reconcileQueue, initEvents)
-	podStore, err := watchPodEvents(ctx, logger, handle.ClientSet(), watchMetrics, podHandlers)
+	podStore, err := watchPodEvents(ctx, logger, handle.ClientSet(), watchMetrics, config.ExcludedNamespaces, podHandlers)
 	if err != nil {
 		return nil, fmt.Errorf("could not start watch on Pod events: %w", err)
 	}
@@ -123,7 +123,7 @@ func NewAutoscaleEnforcerPlugin(
 		return nil, fmt.Errorf("could not start watch on VirtualMachineMigration events: %w", err)
 	}
 
-	pluginState = NewPluginState(*config, vmClient, promReg, podStore, nodeStore)
+	pluginState = NewPluginState(*config, vmClient, handle.ClientSet(), handle.EventRecorder(), promReg, podStore, nodeStore)
 
 	// Start the workers for the queue. We can't do these earlier because our handlers depend on the
 	// PluginState that only exists now.
@@ -132,6 +132,8 @@ func NewAutoscaleEnforcerPlugin(
 		go reconcileWorker(ctx, reconcileLogger, reconcileQueue)
 	}
 
+	go pluginState.runReservationScanner(ctx, logger.Named("reservations"))
+
 	err = util.StartPrometheusMetricsServer(ctx, logger.Named("prometheus"), 9100, promReg)
 	if err != nil {
 		return nil, fmt.Errorf("could not start prometheus server: %w", err)
@@ -143,7 +145,15 @@ func NewAutoscaleEnforcerPlugin(
 			return index.Get(p.Namespace, p.Name)
 		})
 	}
-	err = pluginState.startPermitHandler(ctx, logger.Named("agent-handler"), getPod, podStore.Listen)
+	go pluginState.runAgentScanner(ctx, logger.Named("agents"), getPod)
+
+	readyChecks := []util.HealthCheck{
+		util.APIServerHealthCheck(handle.ClientSet()),
+		watchStoreHealthCheck("pod-watch", podStore),
+		watchStoreHealthCheck("node-watch", nodeStore),
+		pluginState.startupHealthCheck(),
+	}
+	err = pluginState.startPermitHandler(ctx, logger.Named("agent-handler"), getPod, podStore.Listen, readyChecks)
 	if err != nil {
 		return nil, fmt.Errorf("could not start agent request handler: %w", err)
 	}
@@ -183,6 +193,7 @@ func NewAutoscaleEnforcerPlugin(
 
 	return &AutoscaleEnforcer{
 		logger:  logger.Named("plugin"),
+		handle:  handle,
 		state:   pluginState,
 		metrics: &pluginState.metrics.Framework,
 	}, nil
@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"time"
 
+	"github.com/samber/lo"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
@@ -15,6 +17,7 @@ import (
 	"github.com/neondatabase/autoscaling/pkg/plugin/metrics"
 	"github.com/neondatabase/autoscaling/pkg/plugin/reconcile"
 	"github.com/neondatabase/autoscaling/pkg/plugin/state"
+	"github.com/neondatabase/autoscaling/pkg/util"
 )
 
 const PluginName = "AutoscaleEnforcer"
@@ -26,6 +29,7 @@ const PluginName = "AutoscaleEnforcer"
 // https://kubernetes.io/docs/concepts/scheduling-eviction/scheduling-framework/
 type AutoscaleEnforcer struct {
 	logger  *zap.Logger
+	handle  framework.Handle
 	state   *PluginState
 	metrics *metrics.Framework
 }
@@ -46,6 +50,21 @@ func (e *AutoscaleEnforcer) Name() string {
 	return PluginName
 }
 
+// ForProfile returns an AutoscaleEnforcer for an additional scheduler profile, sharing all of its
+// state with e.
+//
+// The plugin is constructed once per profile, but there must only be one copy of the state for
+// the cluster, so the constructor for later profiles should use this instead of
+// NewAutoscaleEnforcerPlugin.
+func (e *AutoscaleEnforcer) ForProfile(handle framework.Handle) *AutoscaleEnforcer {
+	return &AutoscaleEnforcer{
+		logger:  e.logger,
+		handle:  handle,
+		state:   e.state,
+		metrics: e.metrics,
+	}
+}
+
 func logFieldForNodeName(nodeName string) zap.Field {
 	return zap.Object("Node", zapcore.ObjectMarshalerFunc(
 		func(enc zapcore.ObjectEncoder) error {
@@ -56,10 +75,10 @@ func logFieldForNodeName(nodeName string) zap.Field {
 }
 
 func (e *AutoscaleEnforcer) checkSchedulerName(logger *zap.Logger, pod *corev1.Pod) *framework.Status {
-	if e.state.config.SchedulerName != pod.Spec.SchedulerName {
+	if !e.state.config.isOurScheduler(pod.Spec.SchedulerName) {
 		err := fmt.Errorf(
-			"mismatched SchedulerName for pod: our config has %q, but the pod has %q",
-			e.state.config.SchedulerName, pod.Spec.SchedulerName,
+			"mismatched SchedulerName for pod: our config has %q (with profiles %v), but the pod has %q",
+			e.state.config.SchedulerName, lo.Keys(e.state.config.Profiles), pod.Spec.SchedulerName,
 		)
 		logger.Error("Pod has unexpected SchedulerName", zap.Error(err))
 		return framework.NewStatus(framework.Error, err.Error())
@@ -68,7 +87,8 @@ func (e *AutoscaleEnforcer) checkSchedulerName(logger *zap.Logger, pod *corev1.P
 }
 
 // PostFilter is used by us for metrics on filter cycles that reject a Pod by filtering out all
-// applicable nodes.
+// applicable nodes, and -- if enabled -- to preempt lower-priority non-VM pods to make room for VM
+// pods (see preemption.go).
 //
 // Quoting the docs for PostFilter:
 //
@@ -95,7 +115,25 @@ func (e *AutoscaleEnforcer) PostFilter(
 	)
 	logger.Error("Pod rejected by all Filter method calls")
 
-	return nil, nil // PostFilterResult is optional, nil Status is success.
+	if ignored {
+		return nil, nil
+	}
+
+	var result *framework.PostFilterResult
+	if e.state.config.Preemption != nil {
+		result, status = e.preempt(ctx, logger, pod, filteredNodeStatusMap)
+		if status.IsSuccess() {
+			return result, status
+		}
+	}
+
+	// We won't be able to place the pod without more capacity. Let node autoscalers know what's
+	// needed.
+	if rejectedOnlyForCapacity(filteredNodeStatusMap) {
+		e.setPlacementScaleUpHint(logger, pod)
+	}
+
+	return result, status // PostFilterResult is optional, nil Status is success.
 }
 
 // Filter gives our plugin a chance to signal that a pod shouldn't be put onto a particular node
@@ -138,6 +176,8 @@ func (e *AutoscaleEnforcer) Filter(
 		)
 	}
 
+	profile := e.state.config.profileFor(pod.Spec.SchedulerName)
+
 	// precreate a map for the pods that are proposed to exist on this node, so that we're not doing
 	// this with the lock acquired.
 	proposedPods := make(map[types.UID]*framework.PodInfo)
@@ -157,7 +197,7 @@ func (e *AutoscaleEnforcer) Filter(
 
 	var approve bool
 	ns.node.Speculatively(func(n *state.Node) (commit bool) {
-		approve = e.filterCheck(logger, ns.node, n, podState, proposedPods)
+		approve = e.filterCheck(logger, ns.node, n, podState, proposedPods, profile.Watermark)
 		return false // never commit these changes; we're just using this for a temp node.
 	})
 
@@ -174,6 +214,7 @@ func (e *AutoscaleEnforcer) filterCheck(
 	tmpNode *state.Node,
 	filterPod state.Pod,
 	otherPods map[types.UID]*framework.PodInfo,
+	watermark float64,
 ) (ok bool) {
 	type podInfo struct {
 		Namespace string
@@ -211,6 +252,10 @@ func (e *AutoscaleEnforcer) filterCheck(
 	// tmpNode's pods.
 	var proposedNotInLocalState []podInfo
 	for _, p := range otherPods {
+		if !e.state.config.accountedNamespace(p.Pod.Namespace) {
+			continue // we don't count these pods at all.
+		}
+
 		proposedNotInLocalState = append(proposedNotInLocalState, podInfo{
 			Namespace: p.Pod.Namespace,
 			Name:      p.Pod.Name,
@@ -241,7 +286,7 @@ func (e *AutoscaleEnforcer) filterCheck(
 	var canAddToNode bool
 	tmpNode.Speculatively(func(n *state.Node) (commit bool) {
 		n.AddPod(filterPod)
-		canAddToNode = !n.OverBudget()
+		canAddToNode = !n.OverBudget() && !n.OverVMLimit() && !aboveWatermark(n, watermark)
 
 		var msg string
 		if canAddToNode {
@@ -264,6 +309,16 @@ func (e *AutoscaleEnforcer) filterCheck(
 	return canAddToNode
 }
 
+// aboveWatermark returns whether the node has more resources reserved than the fraction of its
+// total given by watermark, treating a watermark of zero as no limit.
+func aboveWatermark(n *state.Node, watermark float64) bool {
+	if watermark == 0 {
+		return false
+	}
+	return float64(n.CPU.Reserved) > watermark*float64(n.CPU.Total) ||
+		float64(n.Mem.Reserved) > watermark*float64(n.Mem.Total)
+}
+
 // Score allows our plugin to express which nodes should be preferred for scheduling new pods onto
 //
 // Even though this function is given (pod, node) pairs, our scoring is only really dependent on
@@ -326,7 +381,7 @@ func (e *AutoscaleEnforcer) Score(
 	ns.node.Speculatively(func(tmp *state.Node) (commit bool) {
 		tmp.AddPod(podState)
 
-		overBudget := tmp.OverBudget()
+		overBudget := tmp.OverBudget() || tmp.OverVMLimit()
 		if overBudget {
 			score = framework.MinNodeScore
 			logger.Warn(
@@ -335,7 +390,7 @@ func (e *AutoscaleEnforcer) Score(
 				zap.Object("NodeWithPod", tmp),
 			)
 		} else {
-			cfg := e.state.config.Scoring
+			cfg := e.state.config.profileFor(pod.Spec.SchedulerName).Scoring
 			cpuScore := calculateScore(cfg, tmp.CPU.Reserved, tmp.CPU.Total, e.state.maxNodeCPU)
 			memScore := calculateScore(cfg, tmp.Mem.Reserved, tmp.Mem.Total, e.state.maxNodeMem)
 			scoreFraction := min(cpuScore, memScore)
@@ -408,6 +463,12 @@ func (e *AutoscaleEnforcer) NormalizeScore(
 		reconcile.ObjectMetaLogField("Pod", pod),
 	)
 
+	// ScoreExtensions is shared between profiles, so it's enabled if *any* profile has randomized
+	// scoring. Check that this pod's profile does.
+	if !e.state.config.profileFor(pod.Spec.SchedulerName).Scoring.Randomize {
+		return nil
+	}
+
 	type scoring struct {
 		Node     string
 		OldScore int64
@@ -452,7 +513,7 @@ func (e *AutoscaleEnforcer) NormalizeScore(
 // ScoreExtensions is required for framework.ScorePlugin, and can return nil if it's not used.
 // However, we do use it, to randomize scores (when enabled).
 func (e *AutoscaleEnforcer) ScoreExtensions() framework.ScoreExtensions {
-	if e.state.config.Scoring.Randomize {
+	if e.state.config.anyRandomizedScoring() {
 		return e
 	} else {
 		return nil
@@ -506,10 +567,14 @@ func (e *AutoscaleEnforcer) Reserve(
 	e.state.mu.Lock()
 	defer e.state.mu.Unlock()
 
-	if _, ok := e.state.tentativelyScheduled[pod.UID]; ok {
-		msg := "Pod already exists in set of tentatively scheduled pods"
-		logger.Error(msg)
-		return framework.NewStatus(framework.UnschedulableAndUnresolvable, msg)
+	if reservation, ok := e.state.tentativelyScheduled[pod.UID]; ok {
+		// This can happen if a previous scheduling attempt failed without a call to Unreserve. The
+		// old reservation is no longer valid, so we should release it before making a new one.
+		logger.Warn(
+			"Pod already exists in set of tentatively scheduled pods, releasing previous reservation",
+			zap.String("PreviousNode", reservation.nodeName),
+		)
+		e.state.releaseReservation(logger, pod.UID)
 	}
 
 	ns, ok := e.state.nodes[nodeName]
@@ -519,6 +584,13 @@ func (e *AutoscaleEnforcer) Reserve(
 		return framework.NewStatus(framework.Error, msg)
 	}
 
+	if _, ok := ns.node.GetPod(pod.UID); ok {
+		// We've already seen the pod on this node (i.e., it's been bound), so its resources are
+		// already accounted for.
+		logger.Warn("Pod already exists on Node, nothing to reserve", logFieldForNodeName(nodeName))
+		return nil
+	}
+
 	// use Speculatively() to compare before/after
 	//
 	// Note that we always allow the change to go through, even though we *could* deny the Reserve()
@@ -526,7 +598,11 @@ func (e *AutoscaleEnforcer) Reserve(
 	// For more, see https://github.com/neondatabase/autoscaling/issues/869
 	ns.node.Speculatively(func(n *state.Node) (commit bool) {
 		n.AddPod(podState)
-		e.state.tentativelyScheduled[pod.UID] = nodeName
+		e.state.tentativelyScheduled[pod.UID] = tentativeReservation{
+			pod:        util.GetNamespacedName(pod),
+			nodeName:   nodeName,
+			reservedAt: time.Now(),
+		}
 
 		logger.Info(
 			"Reserved tentatively scheduled Pod on Node",
@@ -572,40 +648,19 @@ func (e *AutoscaleEnforcer) Unreserve(
 	e.state.mu.Lock()
 	defer e.state.mu.Unlock()
 
-	nn, ok := e.state.tentativelyScheduled[pod.UID]
+	reservation, ok := e.state.tentativelyScheduled[pod.UID]
 	if !ok {
 		logger.Warn("Cannot unreserve Pod, it isn't in the set of tentatively scheduled pods")
 		return
-	} else if nn != nodeName {
-		logger.Panic(
-			"Pod is tentatively scheduled on an unexpected node",
+	} else if reservation.nodeName != nodeName {
+		// Release it anyways -- the reservation can't be used, and keeping it around would leak the
+		// resources on the other node.
+		logger.Error(
+			"Pod is tentatively scheduled on an unexpected node, releasing it from there instead",
 			zap.String("ExpectedNode", nodeName),
-			zap.String("ActualNode", nn),
+			zap.String("ActualNode", reservation.nodeName),
 		)
-		return
-	}
-
-	ns, ok := e.state.nodes[nodeName]
-	if !ok {
-		logger.Error("Node not found in local state", logFieldForNodeName(nodeName))
-		return
 	}
 
-	ns.node.Speculatively(func(n *state.Node) (commit bool) {
-		p, ok := n.GetPod(pod.UID)
-		if !ok {
-			logger.Panic("Pod unexpectedly doesn't exist on Node", logFieldForNodeName(nodeName))
-			return
-		}
-		n.RemovePod(pod.UID)
-		delete(e.state.tentativelyScheduled, pod.UID)
-
-		logger.Info(
-			"Unreserved tentatively scheduled Pod",
-			zap.Object("Pod", p),
-			zap.Object("OldNode", ns.node),
-			zap.Object("Node", n),
-		)
-		return true // yes, commit these changes.
-	})
+	e.state.releaseReservation(logger, pod.UID)
 }
@@ -8,15 +8,22 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/samber/lo"
 	"go.uber.org/zap"
 
+	authv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/events"
 
 	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
 	vmclient "github.com/neondatabase/autoscaling/neonvm/client/clientset/versioned"
@@ -40,8 +47,21 @@ type PluginState struct {
 	// with the Reserve plugin method, but haven't yet been processed internally as finally being
 	// assigned to those nodes.
 	//
-	// the string associated with each pod is the name of the node.
-	tentativelyScheduled map[types.UID]string
+	// See reservations.go for more.
+	tentativelyScheduled map[types.UID]tentativeReservation
+
+	// agents stores the autoscaler-agents that have sent a handshake, keyed by node name.
+	//
+	// See agents.go for more.
+	agents map[string]*nodeAgents
+
+	// agentResponses stores the last successful response to an autoscaler-agent request for each
+	// pod, keyed by pod UID, so that retries of the same request can be given the same response.
+	agentResponses map[types.UID]agentResponse
+
+	// inFlightAgentRequests is the number of autoscaler-agent requests currently being handled,
+	// for enforcing Config.MaxInFlightAgentRequests. It is not guarded by mu.
+	inFlightAgentRequests atomic.Int64
 
 	startupDone         bool
 	requeueAfterStartup map[types.UID]struct{}
@@ -60,6 +80,27 @@ type PluginState struct {
 	createMigration func(*zap.Logger, *vmv1.VirtualMachineMigration) error
 	deleteMigration func(*zap.Logger, *vmv1.VirtualMachineMigration) error
 	patchVM         func(util.NamespacedName, []patch.Operation) error
+	// patchPod applies a JSON patch to the pod, for standalone pods with autoscaling enabled.
+	patchPod func(util.NamespacedName, []patch.Operation) error
+	evictPod func(*zap.Logger, *corev1.Pod) error
+	// patchPodAnnotation sets the annotation on the pod, or removes it if the value is nil.
+	patchPodAnnotation func(pod util.NamespacedName, key string, value *string) error
+	// setNodeExtendedResource sets the capacity and allocatable amounts of the extended resource
+	// in the node's status.
+	setNodeExtendedResource func(nodeName string, name corev1.ResourceName, value resource.Quantity) error
+	// reviewToken returns the status of a TokenReview for the bearer token, to authenticate
+	// autoscaler-agents.
+	reviewToken func(token string) (authv1.TokenReviewStatus, error)
+
+	eventRecorder events.EventRecorder
+	// eventLimiter limits the rate of events emitted with eventRecorder, according to
+	// Config.EventRateLimit.
+	eventLimiter *util.RateLimiter
+}
+
+type agentResponse struct {
+	requestID string
+	resp      api.PluginResponse
 }
 
 type nodeState struct {
@@ -81,6 +122,8 @@ type nodeState struct {
 func NewPluginState(
 	config Config,
 	vmClient vmclient.Interface,
+	kubeClient kubernetes.Interface,
+	eventRecorder events.EventRecorder,
 	reg prometheus.Registerer,
 	podWatchStore *watch.Store[corev1.Pod],
 	nodeWatchStore *watch.Store[corev1.Node],
@@ -97,7 +140,11 @@ func NewPluginState(
 		config: config,
 
 		nodes:                make(map[string]*nodeState),
-		tentativelyScheduled: make(map[types.UID]string),
+		tentativelyScheduled: make(map[types.UID]tentativeReservation),
+		agents:               make(map[string]*nodeAgents),
+		agentResponses:       make(map[types.UID]agentResponse),
+
+		inFlightAgentRequests: atomic.Int64{},
 
 		startupDone:         false,
 		requeueAfterStartup: make(map[types.UID]struct{}),
@@ -172,5 +219,109 @@ func NewPluginState(
 			metrics.RecordK8sOp("Patch", "VirtualMachine", vm.Name, err)
 			return err
 		},
+		patchPod: func(pod util.NamespacedName, patches []patch.Operation) error {
+			patchPayload, err := json.Marshal(patches)
+			if err != nil {
+				panic(fmt.Errorf("could not marshal JSON patch: %w", err))
+			}
+
+			ctx, cancel := context.WithTimeout(context.TODO(), crudTimeout)
+			defer cancel()
+
+			_, err = kubeClient.CoreV1().Pods(pod.Namespace).
+				Patch(ctx, pod.Name, types.JSONPatchType, patchPayload, metav1.PatchOptions{})
+			metrics.RecordK8sOp("Patch", "Pod", pod.Name, err)
+			return err
+		},
+		evictPod: func(logger *zap.Logger, pod *corev1.Pod) error {
+			ctx, cancel := context.WithTimeout(context.TODO(), crudTimeout)
+			defer cancel()
+
+			// Use the Eviction API (rather than deleting the pod directly) so that the API server
+			// enforces any PodDisruptionBudgets that apply to the pod.
+			eviction := &policyv1.Eviction{
+				TypeMeta: metav1.TypeMeta{},
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: pod.Namespace,
+					Name:      pod.Name,
+				},
+				DeleteOptions: &metav1.DeleteOptions{
+					Preconditions: &metav1.Preconditions{
+						UID:             &pod.UID,
+						ResourceVersion: nil,
+					},
+				},
+			}
+
+			err := kubeClient.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+			metrics.RecordK8sOp("Evict", "Pod", pod.Name, err)
+			if err != nil && apierrors.IsNotFound(err) {
+				logger.Warn("Pod to evict was already deleted")
+				return nil
+			}
+			return err
+		},
+		patchPodAnnotation: func(pod util.NamespacedName, key string, value *string) error {
+			// Use a merge patch, so that it works even if the pod has no annotations, and null
+			// removes the annotation.
+			patchPayload, err := json.Marshal(map[string]any{
+				"metadata": map[string]any{
+					"annotations": map[string]*string{key: value},
+				},
+			})
+			if err != nil {
+				panic(fmt.Errorf("could not marshal merge patch: %w", err))
+			}
+
+			ctx, cancel := context.WithTimeout(context.TODO(), crudTimeout)
+			defer cancel()
+
+			_, err = kubeClient.CoreV1().Pods(pod.Namespace).
+				Patch(ctx, pod.Name, types.MergePatchType, patchPayload, metav1.PatchOptions{})
+			metrics.RecordK8sOp("Patch", "Pod", pod.Name, err)
+			return err
+		},
+		setNodeExtendedResource: func(nodeName string, name corev1.ResourceName, value resource.Quantity) error {
+			patchPayload, err := json.Marshal(map[string]any{
+				"status": map[string]any{
+					"capacity":    corev1.ResourceList{name: value},
+					"allocatable": corev1.ResourceList{name: value},
+				},
+			})
+			if err != nil {
+				panic(fmt.Errorf("could not marshal merge patch: %w", err))
+			}
+
+			ctx, cancel := context.WithTimeout(context.TODO(), crudTimeout)
+			defer cancel()
+
+			_, err = kubeClient.CoreV1().Nodes().
+				Patch(ctx, nodeName, types.MergePatchType, patchPayload, metav1.PatchOptions{}, "status")
+			metrics.RecordK8sOp("PatchStatus", "Node", nodeName, err)
+			return err
+		},
+		reviewToken: func(token string) (authv1.TokenReviewStatus, error) {
+			ctx, cancel := context.WithTimeout(context.TODO(), crudTimeout)
+			defer cancel()
+
+			//nolint:exhaustruct // status is set by the API server
+			review := &authv1.TokenReview{
+				TypeMeta:   metav1.TypeMeta{},
+				ObjectMeta: metav1.ObjectMeta{},
+				Spec: authv1.TokenReviewSpec{
+					Token:     token,
+					Audiences: nil,
+				},
+			}
+			result, err := kubeClient.AuthenticationV1().TokenReviews().Create(ctx, review, metav1.CreateOptions{})
+			metrics.RecordK8sOp("Create", "TokenReview", "", err)
+			if err != nil {
+				return authv1.TokenReviewStatus{}, err
+			}
+			return result.Status, nil
+		},
+
+		eventRecorder: eventRecorder,
+		eventLimiter:  util.NewRateLimiter(lo.FromPtr(config.EventRateLimit), metrics.RateLimiters, "events"),
 	}
 }
@@ -29,11 +29,26 @@ func (s *PluginState) HandleNodeEvent(logger *zap.Logger, kind reconcile.EventKi
 }
 
 func (s *PluginState) updateNode(logger *zap.Logger, node *corev1.Node, expectExists bool) error {
-	newNode, err := state.NodeStateFromK8sObj(node, s.config.Watermark, s.metrics.Nodes.InheritedLabels)
+	maxVMs, err := s.config.maxVMsForNode(node)
+	if err != nil {
+		logger.Warn("Invalid max VMs override for Node, using default", zap.Int("maxVMs", maxVMs), zap.Error(err))
+	}
+
+	newNode, err := state.NodeStateFromK8sObj(
+		node,
+		s.config.Watermark,
+		s.config.memoryOvercommitFactor(node),
+		maxVMs,
+		s.metrics.Nodes.InheritedLabels,
+	)
 	if err != nil {
 		return fmt.Errorf("could not get state from Node object: %w", err)
 	}
 
+	if err := s.advertiseComputeUnits(logger, node, newNode); err != nil {
+		logger.Error("Failed to advertise compute units for Node", zap.Error(err))
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -156,8 +171,8 @@ func (s *PluginState) balanceNode(logger *zap.Logger, ns *nodeState) error {
 // NOTE: this function expects that the caller has acquired s.mu.
 func (s *PluginState) cleanupNode(logger *zap.Logger, ns *nodeState) {
 	// remove any tentatively scheduled pods that are on this node
-	for uid, nodeName := range s.tentativelyScheduled {
-		if nodeName == ns.node.Name {
+	for uid, reservation := range s.tentativelyScheduled {
+		if reservation.nodeName == ns.node.Name {
 			delete(s.tentativelyScheduled, uid)
 		}
 	}
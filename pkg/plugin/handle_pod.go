@@ -47,6 +47,18 @@ func (s *PluginState) HandlePodEvent(
 			return reconcileResult, err
 		}
 
+		// Once the pod is placed, the scale-up hint (if any) should only reflect denied upscales.
+		// Skip this during startup, because we don't yet have a full picture of each node.
+		if pod.Spec.NodeName != "" && s.isStartupDone() {
+			var hint *api.Resources
+			if updateResult != nil {
+				hint = updateResult.scaleUpHint
+			}
+			if err := s.reconcileScaleUpHint(logger, pod, hint); err != nil {
+				return reconcileResult, err
+			}
+		}
+
 		var retryAfter time.Duration
 		if updateResult != nil {
 			if updateResult.afterUnlock != nil {
@@ -56,6 +68,7 @@ func (s *PluginState) HandlePodEvent(
 			}
 
 			if updateResult.needsMoreResources {
+				s.recordUpscaleDenied(pod, *updateResult.scaleUpHint)
 				// mark this as failing; don't try again sooner than 5 seconds later.
 				return &reconcile.Result{RetryAfter: 5 * time.Second}, errors.New("not enough resources to grant request for pod")
 			}
@@ -74,8 +87,10 @@ func (s *PluginState) HandlePodEvent(
 
 type podUpdateResult struct {
 	needsMoreResources bool
-	afterUnlock        func() error
-	retryAfter         *time.Duration
+	// scaleUpHint, if needsMoreResources, gives the total resources that the pod requires.
+	scaleUpHint *api.Resources
+	afterUnlock func() error
+	retryAfter  *time.Duration
 }
 
 func (s *PluginState) updatePod(
@@ -98,7 +113,8 @@ func (s *PluginState) updatePod(
 		}
 	}()
 
-	tentativeNode, scheduled := s.tentativelyScheduled[pod.UID]
+	reservation, scheduled := s.tentativelyScheduled[pod.UID]
+	tentativeNode := reservation.nodeName
 	if scheduled {
 		if pod.Spec.NodeName == tentativeNode {
 			// oh hey, this pod has been properly scheduled now! Let's remove it from the
@@ -111,6 +127,17 @@ func (s *PluginState) updatePod(
 				zap.String("OriginalNodeName", tentativeNode),
 				zap.String("NewNodeName", pod.Spec.NodeName),
 			)
+		} else if !s.config.DisableReservationExpiry && time.Since(reservation.reservedAt) >= s.reservationTimeout() {
+			// The scheduler never told us that binding failed, but it's been long enough that it
+			// probably did. Release the resources, so they aren't leaked.
+			logger.Warn(
+				"Releasing expired reservation for Pod that still hasn't been bound",
+				logFieldForNodeName(tentativeNode),
+				zap.Duration("reservedFor", time.Since(reservation.reservedAt)),
+			)
+			s.releaseReservation(logger, pod.UID)
+			s.metrics.ExpiredReservations.WithLabelValues(stuckReasonPending).Inc()
+			return nil, nil
 		}
 	}
 
@@ -171,8 +198,9 @@ func (s *PluginState) updatePod(
 
 	// At this point, our local state has been updated according to the Pod object from k8s.
 	//
-	// All that's left is to handle VMs that are the responsibility of *this* scheduler.
-	if lo.IsEmpty(newPod.VirtualMachine) || pod.Spec.SchedulerName != s.config.SchedulerName {
+	// All that's left is to handle VMs (and standalone autoscaling pods) that are the
+	// responsibility of *this* scheduler.
+	if (lo.IsEmpty(newPod.VirtualMachine) && !newPod.Standalone) || !s.config.isOurScheduler(pod.Spec.SchedulerName) {
 		return nil, nil
 	}
 
@@ -188,6 +216,7 @@ func (s *PluginState) updatePod(
 			logger.Info("Creating migration for Pod")
 			return &podUpdateResult{
 				needsMoreResources: false,
+				scaleUpHint:        nil,
 				// we need to release the lock to trigger the migration, otherwise we may slow down
 				// processing due to API delays.
 				afterUnlock: func() error {
@@ -220,9 +249,15 @@ func (s *PluginState) createMigrationForPod(logger *zap.Logger, pod state.Pod) e
 			PreventMigrationToSameHost: true,
 			CompletionTimeout:          3600,
 			Incremental:                true,
+			DiskMigration:              vmv1.DiskMigrationModeBlock,
 			AutoConverge:               true,
-			MaxBandwidth:               resource.MustParse("1Gi"),
 			AllowPostCopy:              false,
+			BackoffLimit:               3,
+
+			// Use the NeonVM controller's defaults
+			MaxBandwidth:      resource.Quantity{},
+			MaxDowntimeMillis: nil,
+			Multifd:           nil,
 		},
 	}
 
@@ -254,6 +289,11 @@ func (s *PluginState) reconcilePodResources(
 		return false
 	})
 
+	var scaleUpHint *api.Resources
+	if needsMoreResources {
+		scaleUpHint = &api.Resources{VCPU: desiredPod.CPU.Requested, Mem: desiredPod.Mem.Requested}
+	}
+
 	_, hasApprovedAnnotation := oldPodObj.Annotations[api.InternalAnnotationResourcesApproved]
 
 	// At this point, desiredPod has the updated state of the pod that *would* be the case if we
@@ -297,6 +337,7 @@ func (s *PluginState) reconcilePodResources(
 		}
 		return &podUpdateResult{
 			needsMoreResources: needsMoreResources,
+			scaleUpHint:        scaleUpHint,
 			afterUnlock:        nil,
 			retryAfter:         nil,
 		}
@@ -324,6 +365,7 @@ func (s *PluginState) reconcilePodResources(
 		)
 		return &podUpdateResult{
 			needsMoreResources: needsMoreResources,
+			scaleUpHint:        scaleUpHint,
 			afterUnlock:        nil,
 			retryAfter:         &retryAfter,
 		}
@@ -367,6 +409,7 @@ func (s *PluginState) reconcilePodResources(
 
 	return &podUpdateResult{
 		needsMoreResources: needsMoreResources,
+		scaleUpHint:        scaleUpHint,
 		afterUnlock: func() error {
 			return s.patchReservedResourcesForPod(logger, oldPodObj, desiredPod)
 		},
@@ -455,7 +498,7 @@ func (s *PluginState) patchReservedResourcesForPod(
 			},
 			patches[0],
 		}
-		err := s.patchVM(newPod.VirtualMachine, addPatches)
+		err := s.patchScalingObject(newPod, addPatches)
 		if err != nil {
 			if apierrors.IsInvalid(err) {
 				logger.Warn(
@@ -475,7 +518,7 @@ func (s *PluginState) patchReservedResourcesForPod(
 		}
 	}
 
-	err := s.patchVM(newPod.VirtualMachine, patches)
+	err := s.patchScalingObject(newPod, patches)
 	// When a JSON patch "test" fails, the API server returns 422 which is internally represented in
 	// the k8s error types as a "StatusReasonInvalid".
 	// We'll special-case that here -- it's still an error but we want to be more clear about it.
@@ -492,17 +535,29 @@ func (s *PluginState) patchReservedResourcesForPod(
 	return nil
 }
 
+// patchScalingObject applies the patches to the object that the pod's scaling annotations are set
+// on: its VirtualMachine, or the pod itself if it's a standalone pod.
+func (s *PluginState) patchScalingObject(pod state.Pod, patches []patch.Operation) error {
+	if pod.Standalone {
+		return s.patchPod(pod.NamespacedName, patches)
+	}
+	return s.patchVM(pod.VirtualMachine, patches)
+}
+
 func (s *PluginState) deletePod(logger *zap.Logger, pod *corev1.Pod, expectExists bool) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	delete(s.agentResponses, pod.UID)
+
 	nodeName := pod.Spec.NodeName
 	if nodeName == "" {
-		var ok bool
-		if nodeName, ok = s.tentativelyScheduled[pod.UID]; !ok {
+		reservation, ok := s.tentativelyScheduled[pod.UID]
+		if !ok {
 			logger.Info("Nothing to do for Pod deletion as it has no Node")
 			return nil
 		}
+		nodeName = reservation.nodeName
 	}
 
 	logger = logger.With(logFieldForNodeName(nodeName))
@@ -553,11 +608,11 @@ func (s *PluginState) deletePod(logger *zap.Logger, pod *corev1.Pod, expectExist
 	// Remove from tentatively scheduled, if it's there.
 	// We need to do this last because earlier stages depend on this, and we might end up with
 	// incomplete deletions if we clear this first, and hit an error later.
-	if tentativeNode, ok := s.tentativelyScheduled[pod.UID]; ok {
-		if pod.Spec.NodeName != "" && tentativeNode != pod.Spec.NodeName {
+	if reservation, ok := s.tentativelyScheduled[pod.UID]; ok {
+		if pod.Spec.NodeName != "" && reservation.nodeName != pod.Spec.NodeName {
 			logger.Panic(
 				"Pod was scheduled onto a different Node than tentatively recorded",
-				zap.String("OriginalNodeName", tentativeNode),
+				zap.String("OriginalNodeName", reservation.nodeName),
 				zap.String("NewNodeName", pod.Spec.NodeName),
 			)
 		}
@@ -49,6 +49,7 @@ func metadataForNewMigration(pod state.Pod) metav1.ObjectMeta {
 		Namespace: pod.Namespace,
 		Labels: map[string]string{
 			LabelPluginCreatedMigration: "true",
+			vmv1.MigrationTriggerLabel:  vmv1.MigrationTriggerRebalance,
 		},
 	}
 }
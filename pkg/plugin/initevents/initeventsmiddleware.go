@@ -4,11 +4,11 @@ package initevents
 
 import (
 	"sync"
-	"sync/atomic"
 
 	"go.uber.org/zap"
 
 	"github.com/neondatabase/autoscaling/pkg/plugin/reconcile"
+	"github.com/neondatabase/autoscaling/pkg/util"
 )
 
 // compile-time check that InitEventsMiddleware implements reconcile.Middleware
@@ -20,8 +20,10 @@ var _ reconcile.Middleware = (*InitEventsMiddleware)(nil)
 // The initial setup of the scheduler plugin uses this to ensure that we don't make any decisions on
 // partial state.
 type InitEventsMiddleware struct {
-	done       atomic.Bool
-	notifyDone chan struct{}
+	// done is set to true once all of the required objects have been reconciled. doneRcvr is
+	// created before that, so its Wait() channel is closed once done is set.
+	done     *util.BroadcastValue[bool]
+	doneRcvr util.ValueReceiver[bool]
 
 	mu         sync.Mutex
 	doneAdding bool
@@ -29,9 +31,10 @@ type InitEventsMiddleware struct {
 }
 
 func NewInitEventsMiddleware() *InitEventsMiddleware {
+	done := util.NewBroadcastValue(false)
 	return &InitEventsMiddleware{
-		done:       atomic.Bool{},
-		notifyDone: make(chan struct{}),
+		done:       done,
+		doneRcvr:   done.NewReceiver(),
 		mu:         sync.Mutex{},
 		doneAdding: false,
 		remaining:  make(map[reconcile.Key]struct{}),
@@ -81,7 +84,7 @@ func (m *InitEventsMiddleware) Done() <-chan struct{} {
 	m.doneAdding = true
 	m.checkDone()
 
-	return m.notifyDone
+	return m.doneRcvr.Wait()
 }
 
 // Remaining returns the set of objects that we're waiting on to be successfully reconciled.
@@ -112,13 +115,12 @@ func (m *InitEventsMiddleware) success(k reconcile.Key) {
 
 // NOTE: this method expects that the caller has acquired m.mu.
 func (m *InitEventsMiddleware) checkDone() {
-	// we've already signaled that we're done. Avoid double-closing the channel.
+	// we've already signaled that we're done. Avoid notifying again.
 	if m.done.Load() {
 		return
 	}
 
 	if m.doneAdding && len(m.remaining) == 0 {
-		close(m.notifyDone)
 		m.done.Store(true)
 	}
 }
@@ -23,10 +23,19 @@ type Plugin struct {
 	Nodes     *Node
 	Reconcile Reconcile
 
-	ResourceRequests      *prometheus.CounterVec
-	ValidResourceRequests *prometheus.CounterVec
+	ResourceRequests         *prometheus.CounterVec
+	ValidResourceRequests    *prometheus.CounterVec
+	InFlightResourceRequests prometheus.Gauge
 
 	K8sOps *prometheus.CounterVec
+
+	StuckReservations   *prometheus.GaugeVec
+	ExpiredReservations *prometheus.CounterVec
+
+	LiveAgents   *prometheus.GaugeVec
+	OrphanedPods *prometheus.GaugeVec
+
+	RateLimiters util.RateLimiterMetrics
 }
 
 func BuildPluginMetrics(nodeMetricLabels map[string]string, reg prometheus.Registerer) Plugin {
@@ -52,6 +61,12 @@ func BuildPluginMetrics(nodeMetricLabels map[string]string, reg prometheus.Regis
 			},
 			[]string{"code", "node"},
 		)),
+		InFlightResourceRequests: util.RegisterMetric(reg, prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "autoscaling_plugin_resource_requests_in_flight",
+				Help: "Number of resource requests currently being handled by the scheduler plugin",
+			},
+		)),
 
 		K8sOps: util.RegisterMetric(reg, prometheus.NewCounterVec(
 			prometheus.CounterOpts{
@@ -60,6 +75,38 @@ func BuildPluginMetrics(nodeMetricLabels map[string]string, reg prometheus.Regis
 			},
 			[]string{"op", "kind", "outcome"},
 		)),
+
+		StuckReservations: util.RegisterMetric(reg, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "autoscaling_plugin_stuck_reservations",
+				Help: "Number of reservations held for longer than the timeout, as of the latest scan",
+			},
+			[]string{"reason"},
+		)),
+		ExpiredReservations: util.RegisterMetric(reg, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "autoscaling_plugin_reservations_expired_total",
+				Help: "Number of reservations released because they were stuck",
+			},
+			[]string{"reason"},
+		)),
+
+		LiveAgents: util.RegisterMetric(reg, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "autoscaling_plugin_live_agents",
+				Help: "Number of autoscaler-agents on each node that have recently sent a handshake",
+			},
+			[]string{"node"},
+		)),
+		OrphanedPods: util.RegisterMetric(reg, prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "autoscaling_plugin_orphaned_pods",
+				Help: "Number of autoscaling pods with reserved resources that no live autoscaler-agent is handling, as of the latest scan",
+			},
+			[]string{"node"},
+		)),
+
+		RateLimiters: util.NewRateLimiterMetrics("autoscaling_plugin_rate_limiter", reg),
 	}
 }
 
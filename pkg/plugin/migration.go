@@ -11,6 +11,7 @@ import (
 
 	"k8s.io/apimachinery/pkg/types"
 
+	"github.com/neondatabase/autoscaling/pkg/api"
 	"github.com/neondatabase/autoscaling/pkg/plugin/state"
 )
 
@@ -125,3 +126,38 @@ func triggerMigrationsIfNecessary(
 
 	return nil
 }
+
+// nodesWithMigrationCapacity returns the nodes that could currently fit a VM migrating with the
+// requested resources.
+//
+// This is only a best-effort check for the NeonVM controller, so that migrations fail early if
+// there's definitely nowhere to go. The target pod is still scheduled as usual.
+func (s *PluginState) nodesWithMigrationCapacity(req api.MigrationCapacityRequest) api.MigrationCapacityResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nodes := []string{}
+	for name, ns := range s.nodes {
+		if name == req.ExcludeNode {
+			continue
+		}
+		labelsMatch := true
+		for label, value := range req.NodeLabels {
+			if v, ok := ns.node.Labels.Get(label); !ok || v != value {
+				labelsMatch = false
+				break
+			}
+		}
+		if !labelsMatch {
+			continue
+		}
+		n := ns.node
+		underVMLimit := n.MaxVMs == 0 || n.VMs < n.MaxVMs
+		if n.CPU.Reserved+req.CPU <= n.CPU.Total && n.Mem.Reserved+req.Mem <= n.Mem.Total && underVMLimit {
+			nodes = append(nodes, name)
+		}
+	}
+	slices.Sort(nodes)
+
+	return api.MigrationCapacityResponse{Nodes: nodes}
+}
@@ -0,0 +1,76 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/plugin/state"
+)
+
+func TestNodesWithMigrationCapacity(t *testing.T) {
+	//nolint:exhaustruct // only the fields used by nodesWithMigrationCapacity
+	s := &PluginState{nodes: make(map[string]*nodeState)}
+	addNode := func(name string, reservedCPU vmv1.MilliCPU, reservedMem api.Bytes, labels map[string]string) *state.Node {
+		node := state.NodeStateFromParams(name, 4000, 16<<30, 0.8, labels)
+		node.CPU.Reserved = reservedCPU
+		node.Mem.Reserved = reservedMem
+		s.nodes[name] = &nodeState{node: node, requestedMigrations: nil, podsVMPatchedAt: nil}
+		return node
+	}
+
+	addNode("empty", 0, 0, map[string]string{"cpu-model": "a"})
+	addNode("exactly-fits", 3000, 12<<30, map[string]string{"cpu-model": "a"})
+	addNode("cpu-full", 3500, 0, map[string]string{"cpu-model": "a"})
+	addNode("mem-full", 0, 13<<30, map[string]string{"cpu-model": "a"})
+	addNode("other-model", 0, 0, map[string]string{"cpu-model": "b"})
+	// MaxVMs = 0 means there's no limit
+	addNode("no-vm-limit", 0, 0, map[string]string{"cpu-model": "a"}).VMs = 100
+	full := addNode("vm-limit-reached", 0, 0, map[string]string{"cpu-model": "a"})
+	full.MaxVMs = 2
+	full.VMs = 2
+
+	cases := []struct {
+		name     string
+		req      api.MigrationCapacityRequest
+		expected []string
+	}{
+		{
+			name:     "AllNodes",
+			req:      api.MigrationCapacityRequest{CPU: 1000, Mem: 4 << 30, ExcludeNode: "", NodeLabels: nil},
+			expected: []string{"empty", "exactly-fits", "no-vm-limit", "other-model"},
+		},
+		{
+			name:     "ExcludeNode",
+			req:      api.MigrationCapacityRequest{CPU: 1000, Mem: 4 << 30, ExcludeNode: "empty", NodeLabels: nil},
+			expected: []string{"exactly-fits", "no-vm-limit", "other-model"},
+		},
+		{
+			name: "NodeLabels",
+			req: api.MigrationCapacityRequest{
+				CPU: 1000, Mem: 4 << 30, ExcludeNode: "", NodeLabels: map[string]string{"cpu-model": "b"},
+			},
+			expected: []string{"other-model"},
+		},
+		{
+			name: "MissingLabel",
+			req: api.MigrationCapacityRequest{
+				CPU: 1000, Mem: 4 << 30, ExcludeNode: "", NodeLabels: map[string]string{"zone": "a"},
+			},
+			expected: []string{},
+		},
+		{
+			name:     "TooBig",
+			req:      api.MigrationCapacityRequest{CPU: 5000, Mem: 4 << 30, ExcludeNode: "", NodeLabels: nil},
+			expected: []string{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, api.MigrationCapacityResponse{Nodes: c.expected}, s.nodesWithMigrationCapacity(c.req))
+		})
+	}
+}
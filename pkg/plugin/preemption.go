@@ -0,0 +1,186 @@
+package plugin
+
+// Opt-in preemption of burstable non-VM pods, to make room for VM pods that can't otherwise be
+// scheduled.
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/plugin/reconcile"
+	"github.com/neondatabase/autoscaling/pkg/plugin/state"
+)
+
+// preemptionCandidate is a set of pods that, if evicted, would allow the preemptor to fit on the
+// node.
+type preemptionCandidate struct {
+	nodeName string
+	victims  []*corev1.Pod
+}
+
+// maxPriority returns the highest priority of any of the victims
+func (c preemptionCandidate) maxPriority() int32 {
+	return lo.Max(lo.Map(c.victims, func(p *corev1.Pod, _ int) int32 {
+		return podPriority(p)
+	}))
+}
+
+func podPriority(pod *corev1.Pod) int32 {
+	return lo.FromPtr(pod.Spec.Priority)
+}
+
+// preempt attempts to find a node where evicting lower-priority burstable non-VM pods would allow
+// the VM pod to fit, and evicts them if so.
+//
+// Returning an Unschedulable status allows other PostFilter plugins (e.g. the default preemption)
+// to have a go.
+func (e *AutoscaleEnforcer) preempt(
+	ctx context.Context,
+	logger *zap.Logger,
+	pod *corev1.Pod,
+	filteredNodeStatusMap framework.NodeToStatusMap,
+) (*framework.PostFilterResult, *framework.Status) {
+	if _, ok := vmv1.VirtualMachineOwnerForPod(pod); !ok {
+		return nil, framework.NewStatus(framework.Unschedulable, "Preemption is only enabled for VM pods")
+	}
+	if lo.FromPtr(pod.Spec.PreemptionPolicy) == corev1.PreemptNever {
+		return nil, framework.NewStatus(framework.Unschedulable, "Pod has preemption disabled")
+	}
+
+	podState, err := state.PodStateFromK8sObj(pod)
+	if err != nil {
+		msg := "Error extracting local information for Pod"
+		logger.Error(msg, zap.Error(err))
+		return nil, framework.NewStatus(framework.Error, fmt.Sprintf("%s: %s", msg, err.Error()))
+	}
+
+	nodeInfos := e.handle.SnapshotSharedLister().NodeInfos()
+
+	var candidates []preemptionCandidate
+	for nodeName, status := range filteredNodeStatusMap {
+		// If the node was rejected for a reason that can't be resolved by removing pods, there's
+		// no use evicting anything from it.
+		if status.Code() == framework.UnschedulableAndUnresolvable {
+			continue
+		}
+
+		nodeInfo, err := nodeInfos.Get(nodeName)
+		if err != nil {
+			logger.Warn("Could not get NodeInfo for preemption", logFieldForNodeName(nodeName), zap.Error(err))
+			continue
+		}
+
+		if c, ok := e.findVictims(pod, podState, nodeInfo); ok {
+			candidates = append(candidates, c)
+		}
+	}
+
+	if len(candidates) == 0 {
+		logger.Info("No node found where preemption would allow Pod to be scheduled")
+		return nil, framework.NewStatus(framework.Unschedulable, "No preemption victims found")
+	}
+
+	// Prefer evicting the fewest pods, then the lowest priority pods. Tie-break on the node name so
+	// that the choice is deterministic.
+	chosen := slices.MinFunc(candidates, func(x, y preemptionCandidate) int {
+		return cmp.Or(
+			cmp.Compare(len(x.victims), len(y.victims)),
+			cmp.Compare(x.maxPriority(), y.maxPriority()),
+			cmp.Compare(x.nodeName, y.nodeName),
+		)
+	})
+
+	logger = logger.With(logFieldForNodeName(chosen.nodeName))
+	logger.Info(
+		"Evicting pods to make room for VM pod",
+		zap.Int("victims", len(chosen.victims)),
+		zap.Int("candidateNodes", len(candidates)),
+	)
+
+	for _, victim := range chosen.victims {
+		victimLogger := logger.With(reconcile.ObjectMetaLogField("Victim", victim))
+		if err := e.state.evictPod(victimLogger, victim); err != nil {
+			// Most likely, this is due to a PodDisruptionBudget. We'll try again on the next
+			// scheduling attempt, which may pick a different set of victims.
+			victimLogger.Warn("Failed to evict Pod for preemption", zap.Error(err))
+			return nil, framework.NewStatus(
+				framework.Unschedulable,
+				fmt.Sprintf("Could not evict Pod %s/%s: %s", victim.Namespace, victim.Name, err.Error()),
+			)
+		}
+		victimLogger.Info("Evicted Pod for preemption")
+	}
+
+	return framework.NewPostFilterResultWithNominatedNode(chosen.nodeName), framework.NewStatus(framework.Success)
+}
+
+// findVictims returns the smallest set of pods on the node, evicting lowest priority first, that
+// would allow the preemptor to fit, if there is one.
+func (e *AutoscaleEnforcer) findVictims(
+	preemptor *corev1.Pod,
+	preemptorState state.Pod,
+	nodeInfo *framework.NodeInfo,
+) (_ preemptionCandidate, ok bool) {
+	nodeName := nodeInfo.Node().Name
+	maxVictims := e.state.config.Preemption.MaxVictimsPerNode
+	watermark := e.state.config.profileFor(preemptor.Spec.SchedulerName).Watermark
+	fits := func(n *state.Node) bool {
+		return !n.OverBudget() && !n.OverVMLimit() && !aboveWatermark(n, watermark)
+	}
+
+	var possibleVictims []*corev1.Pod
+	for _, p := range nodeInfo.Pods {
+		if isPreemptible(p.Pod, preemptor) && !e.state.config.ignoredNamespace(p.Pod.Namespace) {
+			possibleVictims = append(possibleVictims, p.Pod)
+		}
+	}
+	// Evict the lowest priority pods first, and of those, the most recently created.
+	slices.SortFunc(possibleVictims, func(x, y *corev1.Pod) int {
+		return cmp.Or(
+			cmp.Compare(podPriority(x), podPriority(y)),
+			y.CreationTimestamp.Compare(x.CreationTimestamp.Time),
+		)
+	})
+
+	e.state.mu.Lock()
+	defer e.state.mu.Unlock()
+
+	ns, ok := e.state.nodes[nodeName]
+	if !ok {
+		return lo.Empty[preemptionCandidate](), false
+	}
+
+	candidates := lo.Map(possibleVictims, func(p *corev1.Pod, _ int) types.UID { return p.UID })
+	victimUIDs, ok := ns.node.PreemptionVictims(preemptorState, candidates, maxVictims, fits)
+	if !ok {
+		return lo.Empty[preemptionCandidate](), false
+	}
+
+	victims := lo.Filter(possibleVictims, func(p *corev1.Pod, _ int) bool {
+		return slices.Contains(victimUIDs, p.UID)
+	})
+	return preemptionCandidate{nodeName: nodeName, victims: victims}, true
+}
+
+// isPreemptible returns whether the pod may be evicted to make room for the preemptor.
+//
+// Only burstable non-VM pods with a strictly lower priority than the preemptor are eligible.
+func isPreemptible(pod *corev1.Pod, preemptor *corev1.Pod) bool {
+	if _, isVM := vmv1.VirtualMachineOwnerForPod(pod); isVM {
+		return false
+	}
+	if pod.DeletionTimestamp != nil {
+		return false // already on its way out
+	}
+	return pod.Status.QOSClass == corev1.PodQOSBurstable && podPriority(pod) < podPriority(preemptor)
+}
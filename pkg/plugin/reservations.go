@@ -0,0 +1,228 @@
+package plugin
+
+// Tracking for resources reserved by the Reserve framework method, before the pod is bound.
+//
+// A reservation normally ends in one of three ways:
+//
+// 1. The pod is bound to the node, and we see it in a pod event (see updatePod);
+// 2. Binding fails or the pod is rejected by another plugin, and the scheduler calls Unreserve; or
+// 3. The pod is deleted (see deletePod).
+//
+// If none of those happens -- e.g. because of a missed event -- the reservation would otherwise
+// leak. So we periodically scan for reservations that have been held for longer than the
+// configured timeout, report them in metrics, and release them (unless disabled) if the pod is
+// still Pending or no longer exists.
+//
+// Reservations can also be listed and manually released via the /reservations endpoint. It's only
+// served on localhost (port 10298), so it must be reached through e.g. 'kubectl port-forward'.
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/neondatabase/autoscaling/pkg/plugin/state"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+type tentativeReservation struct {
+	pod        util.NamespacedName
+	nodeName   string
+	reservedAt time.Time
+}
+
+// Values for the "reason" label in the stuck and expired reservation metrics
+const (
+	stuckReasonPending = "pending"
+	stuckReasonMissing = "missing"
+	stuckReasonManual  = "manual"
+)
+
+func (s *PluginState) reservationTimeout() time.Duration {
+	return time.Second * time.Duration(s.config.ReservationTimeoutSeconds)
+}
+
+// releaseReservation removes the tentatively scheduled pod from the node it was reserved on, if it
+// is still there.
+//
+// NOTE: this function expects that the caller has acquired s.mu.
+func (s *PluginState) releaseReservation(logger *zap.Logger, uid types.UID) {
+	reservation, ok := s.tentativelyScheduled[uid]
+	if !ok {
+		return
+	}
+	delete(s.tentativelyScheduled, uid)
+
+	logger = logger.With(logFieldForNodeName(reservation.nodeName))
+
+	ns, ok := s.nodes[reservation.nodeName]
+	if !ok {
+		logger.Warn("Node for tentatively scheduled Pod not found in local state")
+		return
+	}
+
+	ns.node.Speculatively(func(n *state.Node) (commit bool) {
+		p, ok := n.GetPod(uid)
+		if !ok {
+			logger.Warn("Tentatively scheduled Pod unexpectedly doesn't exist on Node")
+			return false
+		}
+		n.RemovePod(uid)
+
+		logger.Info(
+			"Released reservation for tentatively scheduled Pod",
+			zap.Object("Pod", p),
+			zap.Object("OldNode", ns.node),
+			zap.Object("Node", n),
+		)
+		return true // yes, commit these changes.
+	})
+
+	s.updateNodeMetricsAndRequeue(logger, ns)
+}
+
+// runReservationScanner periodically checks for reservations that have been held for too long,
+// until the context is canceled.
+func (s *PluginState) runReservationScanner(ctx context.Context, logger *zap.Logger) {
+	ticker := time.NewTicker(s.reservationTimeout() / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.scanReservations(logger)
+		}
+	}
+}
+
+func (s *PluginState) scanReservations(logger *zap.Logger) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expire := !s.config.DisableReservationExpiry
+	timeout := s.reservationTimeout()
+
+	var pending, missing int
+	for uid, reservation := range s.tentativelyScheduled {
+		if time.Since(reservation.reservedAt) < timeout {
+			continue
+		}
+
+		logger := logger.With(
+			zap.Object("Pod", reservation.pod),
+			zap.String("UID", string(uid)),
+			logFieldForNodeName(reservation.nodeName),
+			zap.Duration("reservedFor", time.Since(reservation.reservedAt)),
+		)
+
+		// Requeue the pod so that its handler can check whether it's been bound yet, releasing the
+		// reservation if not. If the pod doesn't exist anymore, we missed its deletion.
+		if err := s.requeuePod(uid); err != nil {
+			missing += 1
+			if expire {
+				logger.Warn("Releasing stuck reservation for Pod that no longer exists", zap.Error(err))
+				s.releaseReservation(logger, uid)
+				s.metrics.ExpiredReservations.WithLabelValues(stuckReasonMissing).Inc()
+			} else {
+				logger.Warn("Found stuck reservation for Pod that no longer exists", zap.Error(err))
+			}
+		} else {
+			pending += 1
+			logger.Warn("Found stuck reservation for Pod that hasn't been bound")
+		}
+	}
+
+	s.metrics.StuckReservations.WithLabelValues(stuckReasonPending).Set(float64(pending))
+	s.metrics.StuckReservations.WithLabelValues(stuckReasonMissing).Set(float64(missing))
+}
+
+// ReservationInfo is the information about a tentatively scheduled pod, as returned by the
+// /reservations endpoint.
+type ReservationInfo struct {
+	UID        types.UID           `json:"uid"`
+	Pod        util.NamespacedName `json:"pod"`
+	Node       string              `json:"node"`
+	ReservedAt time.Time           `json:"reservedAt"`
+	Stuck      bool                `json:"stuck"`
+}
+
+// handleReservations serves the /reservations endpoint.
+//
+// GET lists all current reservations. DELETE, with a 'uid' query parameter, manually releases the
+// reservation for that pod.
+func (s *PluginState) handleReservations(logger *zap.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.mu.Lock()
+			timeout := s.reservationTimeout()
+			infos := []ReservationInfo{}
+			for uid, reservation := range s.tentativelyScheduled {
+				infos = append(infos, ReservationInfo{
+					UID:        uid,
+					Pod:        reservation.pod,
+					Node:       reservation.nodeName,
+					ReservedAt: reservation.reservedAt,
+					Stuck:      time.Since(reservation.reservedAt) >= timeout,
+				})
+			}
+			s.mu.Unlock()
+
+			// oldest first, so that stuck reservations are at the top
+			slices.SortFunc(infos, func(x, y ReservationInfo) int {
+				return x.ReservedAt.Compare(y.ReservedAt)
+			})
+
+			responseBody, err := json.Marshal(infos)
+			if err != nil {
+				logger.Panic("Failed to encode response JSON", zap.Error(err))
+			}
+
+			w.Header().Add("Content-Type", ContentTypeJSON)
+			w.WriteHeader(200)
+			_, _ = w.Write(responseBody)
+
+		case http.MethodDelete:
+			uid := types.UID(r.URL.Query().Get("uid"))
+			if uid == "" {
+				w.Header().Add("Content-Type", ContentTypeError)
+				w.WriteHeader(400)
+				_, _ = w.Write([]byte("missing 'uid' query parameter"))
+				return
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			reservation, ok := s.tentativelyScheduled[uid]
+			if !ok {
+				w.Header().Add("Content-Type", ContentTypeError)
+				w.WriteHeader(404)
+				_, _ = w.Write([]byte("no reservation for pod with that UID"))
+				return
+			}
+
+			logger.Warn(
+				"Manually releasing reservation",
+				zap.Object("Pod", reservation.pod),
+				zap.String("UID", string(uid)),
+			)
+			s.releaseReservation(logger, uid)
+			s.metrics.ExpiredReservations.WithLabelValues(stuckReasonManual).Inc()
+
+			w.WriteHeader(200)
+
+		default:
+			w.WriteHeader(400)
+			_, _ = w.Write([]byte("must be GET or DELETE"))
+		}
+	}
+}
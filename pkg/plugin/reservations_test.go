@@ -0,0 +1,302 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/plugin/metrics"
+	"github.com/neondatabase/autoscaling/pkg/plugin/state"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+const testSchedulerName = "autoscale-scheduler"
+
+// newTestReservationsState returns a PluginState with just enough set for reserving pods on
+// node-1 and node-2.
+func newTestReservationsState() *PluginState {
+	//nolint:exhaustruct // only the fields used for reservations
+	s := &PluginState{
+		config: Config{ //nolint:exhaustruct // same as above
+			SchedulerName:             testSchedulerName,
+			ReservationTimeoutSeconds: 60,
+		},
+		nodes:                make(map[string]*nodeState),
+		tentativelyScheduled: make(map[types.UID]tentativeReservation),
+		metrics:              metrics.BuildPluginMetrics(nil, prometheus.NewRegistry()),
+		requeuePod:           func(types.UID) error { return nil },
+		requeueNode:          func(string) error { return nil },
+	}
+	for _, name := range []string{"node-1", "node-2"} {
+		node := state.NodeStateFromParams(name, 10000, 1<<40, 0.8, nil)
+		s.nodes[name] = &nodeState{node: node, requestedMigrations: nil, podsVMPatchedAt: nil}
+	}
+	return s
+}
+
+func newTestEnforcer(s *PluginState) *AutoscaleEnforcer {
+	return &AutoscaleEnforcer{logger: zap.NewNop(), handle: nil, state: s, metrics: &s.metrics.Framework}
+}
+
+// testReservationPod returns a pending non-VM pod that requests 1 CPU.
+func testReservationPod(name string) *corev1.Pod {
+	pod := &corev1.Pod{}
+	pod.Name = name
+	pod.Namespace = "default"
+	pod.UID = types.UID(name + "-uid")
+	pod.Spec.SchedulerName = testSchedulerName
+	pod.Spec.Containers = []corev1.Container{{
+		Name: "main",
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+		},
+	}}
+	return pod
+}
+
+func reservedCPU(s *PluginState, node string) vmv1.MilliCPU {
+	return s.nodes[node].node.CPU.Reserved
+}
+
+func TestReserveReleasesStaleReservation(t *testing.T) {
+	s := newTestReservationsState()
+	e := newTestEnforcer(s)
+	pod := testReservationPod("pod")
+
+	status := e.Reserve(context.Background(), nil, pod, "node-1")
+	require.True(t, status.IsSuccess(), status.Message())
+	assert.Equal(t, vmv1.MilliCPU(1000), reservedCPU(s, "node-1"))
+	require.Contains(t, s.tentativelyScheduled, pod.UID)
+	assert.Equal(t, "node-1", s.tentativelyScheduled[pod.UID].nodeName)
+
+	// A later scheduling attempt without an Unreserve in between moves the reservation, instead of
+	// leaking the old one
+	status = e.Reserve(context.Background(), nil, pod, "node-2")
+	require.True(t, status.IsSuccess(), status.Message())
+	assert.Equal(t, vmv1.MilliCPU(0), reservedCPU(s, "node-1"))
+	assert.Equal(t, vmv1.MilliCPU(1000), reservedCPU(s, "node-2"))
+	assert.Equal(t, "node-2", s.tentativelyScheduled[pod.UID].nodeName)
+	_, ok := s.nodes["node-1"].node.GetPod(pod.UID)
+	assert.False(t, ok)
+}
+
+func TestUnreserve(t *testing.T) {
+	s := newTestReservationsState()
+	e := newTestEnforcer(s)
+	pod := testReservationPod("pod")
+
+	require.True(t, e.Reserve(context.Background(), nil, pod, "node-1").IsSuccess())
+
+	e.Unreserve(context.Background(), nil, pod, "node-1")
+	assert.Empty(t, s.tentativelyScheduled)
+	assert.Equal(t, vmv1.MilliCPU(0), reservedCPU(s, "node-1"))
+
+	// Unreserve is idempotent
+	e.Unreserve(context.Background(), nil, pod, "node-1")
+	assert.Empty(t, s.tentativelyScheduled)
+	assert.Equal(t, vmv1.MilliCPU(0), reservedCPU(s, "node-1"))
+}
+
+func TestUnreserveMismatchedNode(t *testing.T) {
+	s := newTestReservationsState()
+	e := newTestEnforcer(s)
+	pod := testReservationPod("pod")
+
+	require.True(t, e.Reserve(context.Background(), nil, pod, "node-1").IsSuccess())
+
+	// The reservation is released from the node it's actually on, and nothing changes on the
+	// node that was given
+	e.Unreserve(context.Background(), nil, pod, "node-2")
+	assert.Empty(t, s.tentativelyScheduled)
+	assert.Equal(t, vmv1.MilliCPU(0), reservedCPU(s, "node-1"))
+	assert.Equal(t, vmv1.MilliCPU(0), reservedCPU(s, "node-2"))
+}
+
+func TestUpdatePodExpiresReservation(t *testing.T) {
+	s := newTestReservationsState()
+	e := newTestEnforcer(s)
+	pod := testReservationPod("pod")
+
+	require.True(t, e.Reserve(context.Background(), nil, pod, "node-1").IsSuccess())
+
+	// Before the timeout, the reservation is kept while the pod is pending
+	_, err := s.updatePod(zap.NewNop(), pod, false)
+	require.NoError(t, err)
+	require.Contains(t, s.tentativelyScheduled, pod.UID)
+	assert.Equal(t, vmv1.MilliCPU(1000), reservedCPU(s, "node-1"))
+
+	// ... and released once it's older than ReservationTimeoutSeconds
+	reservation := s.tentativelyScheduled[pod.UID]
+	reservation.reservedAt = time.Now().Add(-61 * time.Second)
+	s.tentativelyScheduled[pod.UID] = reservation
+
+	result, err := s.updatePod(zap.NewNop(), pod, false)
+	require.NoError(t, err)
+	assert.Nil(t, result)
+	assert.Empty(t, s.tentativelyScheduled)
+	assert.Equal(t, vmv1.MilliCPU(0), reservedCPU(s, "node-1"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.ExpiredReservations.WithLabelValues(stuckReasonPending)))
+}
+
+func TestUpdatePodKeepsBoundReservation(t *testing.T) {
+	s := newTestReservationsState()
+	e := newTestEnforcer(s)
+	pod := testReservationPod("pod")
+
+	require.True(t, e.Reserve(context.Background(), nil, pod, "node-1").IsSuccess())
+	reservation := s.tentativelyScheduled[pod.UID]
+	reservation.reservedAt = time.Now().Add(-time.Hour)
+	s.tentativelyScheduled[pod.UID] = reservation
+
+	// Once the pod is bound, its resources stay on the node however long the reservation was held
+	pod.Spec.NodeName = "node-1"
+	_, err := s.updatePod(zap.NewNop(), pod, false)
+	require.NoError(t, err)
+	assert.Empty(t, s.tentativelyScheduled)
+	assert.Equal(t, vmv1.MilliCPU(1000), reservedCPU(s, "node-1"))
+}
+
+func TestReleaseReservationMissingNode(t *testing.T) {
+	s := newTestReservationsState()
+	pod := util.NamespacedName{Namespace: "default", Name: "pod"}
+	s.tentativelyScheduled["pod-uid"] = tentativeReservation{
+		pod:        pod,
+		nodeName:   "deleted-node",
+		reservedAt: time.Now(),
+	}
+
+	// The reservation is still removed, even though there's nothing to release it from
+	s.releaseReservation(zap.NewNop(), "pod-uid")
+	assert.Empty(t, s.tentativelyScheduled)
+	assert.Equal(t, vmv1.MilliCPU(0), reservedCPU(s, "node-1"))
+
+	// Releasing a reservation that doesn't exist does nothing
+	s.releaseReservation(zap.NewNop(), "other-uid")
+	assert.Empty(t, s.tentativelyScheduled)
+}
+
+// reserveTestPod reserves the pod on the node, as if it was reserved the given time ago.
+func reserveTestPod(t *testing.T, s *PluginState, name string, node string, age time.Duration) *corev1.Pod {
+	pod := testReservationPod(name)
+	require.True(t, newTestEnforcer(s).Reserve(context.Background(), nil, pod, node).IsSuccess())
+	reservation := s.tentativelyScheduled[pod.UID]
+	reservation.reservedAt = time.Now().Add(-age)
+	s.tentativelyScheduled[pod.UID] = reservation
+	return pod
+}
+
+func TestScanReservations(t *testing.T) {
+	for _, disableExpiry := range []bool{false, true} {
+		name := "Expire"
+		if disableExpiry {
+			name = "DisableReservationExpiry"
+		}
+		t.Run(name, func(t *testing.T) {
+			s := newTestReservationsState()
+			s.config.DisableReservationExpiry = disableExpiry
+
+			fresh := reserveTestPod(t, s, "fresh", "node-1", 0)
+			pending := reserveTestPod(t, s, "pending", "node-1", time.Hour)
+			missing := reserveTestPod(t, s, "missing", "node-1", time.Hour)
+
+			var requeued []types.UID
+			s.requeuePod = func(uid types.UID) error {
+				if uid == missing.UID {
+					return errors.New("pod not found")
+				}
+				requeued = append(requeued, uid)
+				return nil
+			}
+
+			s.scanReservations(zap.NewNop())
+
+			// Only stuck reservations are checked. Pending pods are requeued, so that their
+			// handler can release the reservation.
+			assert.Equal(t, []types.UID{pending.UID}, requeued)
+			assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.StuckReservations.WithLabelValues(stuckReasonPending)))
+			assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.StuckReservations.WithLabelValues(stuckReasonMissing)))
+			assert.Contains(t, s.tentativelyScheduled, fresh.UID)
+			assert.Contains(t, s.tentativelyScheduled, pending.UID)
+
+			// Reservations for pods that no longer exist are released, unless expiry is disabled
+			if disableExpiry {
+				assert.Contains(t, s.tentativelyScheduled, missing.UID)
+				assert.Equal(t, vmv1.MilliCPU(3000), reservedCPU(s, "node-1"))
+				assert.Equal(t, 0.0, testutil.ToFloat64(s.metrics.ExpiredReservations.WithLabelValues(stuckReasonMissing)))
+			} else {
+				assert.NotContains(t, s.tentativelyScheduled, missing.UID)
+				assert.Equal(t, vmv1.MilliCPU(2000), reservedCPU(s, "node-1"))
+				assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.ExpiredReservations.WithLabelValues(stuckReasonMissing)))
+			}
+		})
+	}
+}
+
+func TestUpdatePodDisableReservationExpiry(t *testing.T) {
+	s := newTestReservationsState()
+	s.config.DisableReservationExpiry = true
+	pod := reserveTestPod(t, s, "pod", "node-1", time.Hour)
+
+	_, err := s.updatePod(zap.NewNop(), pod, false)
+	require.NoError(t, err)
+	assert.Contains(t, s.tentativelyScheduled, pod.UID)
+	assert.Equal(t, vmv1.MilliCPU(1000), reservedCPU(s, "node-1"))
+}
+
+func TestHandleReservations(t *testing.T) {
+	s := newTestReservationsState()
+	stuck := reserveTestPod(t, s, "stuck", "node-1", time.Hour)
+	fresh := reserveTestPod(t, s, "fresh", "node-2", 0)
+
+	serve := func(method string, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.handleReservations(zap.NewNop())(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	// Reservations are listed oldest first
+	w := serve(http.MethodGet, "/reservations")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var infos []ReservationInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &infos))
+	require.Len(t, infos, 2)
+	assert.Equal(t, stuck.UID, infos[0].UID)
+	assert.Equal(t, "node-1", infos[0].Node)
+	assert.True(t, infos[0].Stuck)
+	assert.Equal(t, fresh.UID, infos[1].UID)
+	assert.False(t, infos[1].Stuck)
+
+	w = serve(http.MethodDelete, "/reservations")
+	assert.Equal(t, 400, w.Code, w.Body.String())
+
+	w = serve(http.MethodDelete, "/reservations?uid=unknown-uid")
+	assert.Equal(t, 404, w.Code, w.Body.String())
+	assert.Len(t, s.tentativelyScheduled, 2)
+
+	// Releasing the reservation frees the node's resources
+	w = serve(http.MethodDelete, "/reservations?uid="+string(stuck.UID))
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.NotContains(t, s.tentativelyScheduled, stuck.UID)
+	assert.Contains(t, s.tentativelyScheduled, fresh.UID)
+	assert.Equal(t, vmv1.MilliCPU(0), reservedCPU(s, "node-1"))
+	assert.Equal(t, vmv1.MilliCPU(1000), reservedCPU(s, "node-2"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(s.metrics.ExpiredReservations.WithLabelValues(stuckReasonManual)))
+
+	w = serve(http.MethodPost, "/reservations")
+	assert.Equal(t, 400, w.Code, w.Body.String())
+}
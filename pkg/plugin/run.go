@@ -8,12 +8,16 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/samber/lo"
 	"github.com/tychoish/fun/srv"
 	"go.uber.org/zap"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 
 	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
@@ -21,6 +25,7 @@ import (
 	"github.com/neondatabase/autoscaling/pkg/plugin/state"
 	"github.com/neondatabase/autoscaling/pkg/util"
 	"github.com/neondatabase/autoscaling/pkg/util/patch"
+	"github.com/neondatabase/autoscaling/pkg/util/watch"
 )
 
 const (
@@ -31,17 +36,26 @@ const (
 
 const (
 	MinPluginProtocolVersion api.PluginProtoVersion = api.PluginProtoV5_0
-	MaxPluginProtocolVersion api.PluginProtoVersion = api.PluginProtoV5_0
+	MaxPluginProtocolVersion api.PluginProtoVersion = api.PluginProtoV5_1
 )
 
-// startPermitHandler runs the server for handling each resourceRequest from a pod
+// startPermitHandler runs the server for handling each resourceRequest from a pod, and the NeonVM
+// controller's migration capacity checks
+//
+// The server also serves /healthz and /readyz, the latter running readyChecks, and /agent-handshake
+// (see agents.go). /reservations (see reservations.go) is served separately, only on localhost,
+// because it allows changing the scheduler's state.
 func (s *PluginState) startPermitHandler(
 	ctx context.Context,
 	logger *zap.Logger,
 	getPod func(util.NamespacedName) (*corev1.Pod, bool),
 	listenerForPod func(types.UID) (util.BroadcastReceiver, bool),
+	readyChecks []util.HealthCheck,
 ) error {
 	mux := http.NewServeMux()
+	mux.Handle("/healthz", util.HealthHandler())
+	mux.Handle("/readyz", util.HealthHandler(readyChecks...))
+	mux.Handle("/agent-handshake", s.handleAgentHandshake(logger.Named("agent-handshake")))
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		logger := logger // copy locally, so that we can add fields and refer to it in defers
 
@@ -69,18 +83,72 @@ func (s *PluginState) startPermitHandler(
 			return
 		}
 
+		// Until startup is done, our view of the cluster may be incomplete, so any decision we'd
+		// make could be wrong. The agent retries failed requests, so just ask it to come back later.
+		if !s.isStartupDone() {
+			finalStatus = 503
+			w.Header().Add("Content-Type", ContentTypeError)
+			w.Header().Add("Retry-After", s.retryAfter())
+			w.WriteHeader(finalStatus)
+			_, _ = w.Write([]byte(errStartupNotDone.Error()))
+			return
+		}
+
+		// If we're overloaded, tell the agent to back off instead of adding to the queue. Agents
+		// add jitter to the Retry-After, so they won't all come back at once.
+		inFlight := s.inFlightAgentRequests.Add(1)
+		s.metrics.InFlightResourceRequests.Set(float64(inFlight))
+		defer func() {
+			s.metrics.InFlightResourceRequests.Set(float64(s.inFlightAgentRequests.Add(-1)))
+		}()
+		if limit := s.config.MaxInFlightAgentRequests; limit != 0 && inFlight > int64(limit) {
+			finalStatus = 503
+			w.Header().Add("Content-Type", ContentTypeError)
+			w.Header().Add("Retry-After", s.retryAfter())
+			w.WriteHeader(finalStatus)
+			_, _ = w.Write([]byte(errTooManyRequests.Error()))
+			return
+		}
+
 		defer r.Body.Close()
+		// Requests may be sent as protobuf instead of JSON, in which case we respond with the same.
+		useProtobuf := r.Header.Get("Content-Type") == api.ContentTypeProtobuf
+
 		var req api.AgentRequest
-		jsonDecoder := json.NewDecoder(io.LimitReader(r.Body, MaxHTTPBodySize))
-		if err := jsonDecoder.Decode(&req); err != nil {
-			logger.Warn("Received bad JSON in request", zap.Error(err))
+		body, err := io.ReadAll(io.LimitReader(r.Body, MaxHTTPBodySize))
+		if err == nil {
+			if useProtobuf {
+				err = req.UnmarshalProto(body)
+			} else {
+				err = json.Unmarshal(body, &req)
+			}
+		}
+		if err != nil {
+			logger.Warn("Received bad request body", zap.Bool("protobuf", useProtobuf), zap.Error(err))
 			w.Header().Add("Content-Type", ContentTypeError)
 			finalStatus = 400
 			w.WriteHeader(400)
-			_, _ = w.Write([]byte("bad JSON"))
+			if useProtobuf {
+				_, _ = w.Write([]byte("bad protobuf"))
+			} else {
+				_, _ = w.Write([]byte("bad JSON"))
+			}
 			return
 		}
 
+		// The schema only describes the JSON encoding. Protobuf requests are already checked for
+		// malformed fields while decoding.
+		if s.config.StrictAgentRequestValidation && !useProtobuf {
+			if err := api.AgentRequestSchema().Validate(body); err != nil {
+				logger.Warn("Received request not matching the AgentRequest schema", zap.Error(err))
+				w.Header().Add("Content-Type", ContentTypeError)
+				finalStatus = 400
+				w.WriteHeader(400)
+				_, _ = w.Write([]byte(fmt.Sprintf("invalid request: %s", err)))
+				return
+			}
+		}
+
 		logger = logger.With(zap.Object("pod", req.Pod), zap.Any("request", req))
 
 		resp, statusCode, err := s.handleAgentRequest(logger, req, getPod, listenerForPod)
@@ -99,11 +167,26 @@ func (s *PluginState) startPermitHandler(
 			)
 
 			w.Header().Add("Content-Type", ContentTypeError)
+			var denial denialError
+			if errors.As(err, &denial) {
+				w.Header().Add(api.HeaderDenialReason, string(denial.reason))
+			}
 			w.WriteHeader(statusCode)
 			_, _ = w.Write([]byte(err.Error()))
 			return
 		}
 
+		if useProtobuf {
+			responseBody, err := resp.MarshalProto()
+			if err != nil {
+				logger.Panic("Failed to encode response protobuf", zap.Error(err))
+			}
+			w.Header().Add("Content-Type", api.ContentTypeProtobuf)
+			w.WriteHeader(statusCode)
+			_, _ = w.Write(responseBody)
+			return
+		}
+
 		responseBody, err := json.Marshal(&resp)
 		if err != nil {
 			logger.Panic("Failed to encode response JSON", zap.Error(err))
@@ -114,6 +197,42 @@ func (s *PluginState) startPermitHandler(
 		_, _ = w.Write(responseBody)
 	})
 
+	mux.HandleFunc("/migration_capacity", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(400)
+			_, _ = w.Write([]byte("must be POST"))
+			return
+		}
+
+		if !s.isStartupDone() {
+			w.Header().Add("Content-Type", ContentTypeError)
+			w.Header().Add("Retry-After", s.retryAfter())
+			w.WriteHeader(503)
+			_, _ = w.Write([]byte(errStartupNotDone.Error()))
+			return
+		}
+
+		defer r.Body.Close()
+		var req api.MigrationCapacityRequest
+		jsonDecoder := json.NewDecoder(io.LimitReader(r.Body, MaxHTTPBodySize))
+		if err := jsonDecoder.Decode(&req); err != nil {
+			logger.Warn("Received bad JSON in migration capacity request", zap.Error(err))
+			w.Header().Add("Content-Type", ContentTypeError)
+			w.WriteHeader(400)
+			_, _ = w.Write([]byte("bad JSON"))
+			return
+		}
+
+		responseBody, err := json.Marshal(s.nodesWithMigrationCapacity(req))
+		if err != nil {
+			logger.Panic("Failed to encode response JSON", zap.Error(err))
+		}
+
+		w.Header().Add("Content-Type", ContentTypeJSON)
+		w.WriteHeader(200)
+		_, _ = w.Write(responseBody)
+	})
+
 	orca := srv.GetOrchestrator(ctx)
 
 	logger.Info("Starting resource request server")
@@ -125,16 +244,128 @@ func (s *PluginState) startPermitHandler(
 	if err := orca.Add(hs); err != nil {
 		return fmt.Errorf("Error adding resource request server to orchestrator: %w", err)
 	}
+
+	debugMux := http.NewServeMux()
+	debugMux.Handle("/reservations", s.handleReservations(logger.Named("reservations")))
+
+	logger.Info("Starting debug server")
+	debugServer := srv.HTTP("debug", 5*time.Second, &http.Server{Addr: "127.0.0.1:10298", Handler: debugMux})
+	if err := debugServer.Start(ctx); err != nil {
+		return fmt.Errorf("Error starting debug server: %w", err)
+	}
+
+	if err := orca.Add(debugServer); err != nil {
+		return fmt.Errorf("Error adding debug server to orchestrator: %w", err)
+	}
 	return nil
 }
 
+var (
+	errStartupNotDone  = errors.New("plugin is still handling initial cluster state, try again later")
+	errTooManyRequests = errors.New("plugin is handling too many requests, try again later")
+)
+
+// retryAfter returns the value of the Retry-After header to use when asking autoscaler-agents to
+// back off.
+func (s *PluginState) retryAfter() string {
+	return strconv.Itoa(s.config.BackpressureRetryAfterSeconds)
+}
+
+func (s *PluginState) isStartupDone() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.startupDone
+}
+
+// startupHealthCheck returns a HealthCheck that passes once startup is done, i.e. all of the
+// initial events from the watch stores have been handled.
+func (s *PluginState) startupHealthCheck() util.HealthCheck {
+	return util.HealthCheck{
+		Name: "startup",
+		Check: func(context.Context) error {
+			if !s.isStartupDone() {
+				return errStartupNotDone
+			}
+			return nil
+		},
+	}
+}
+
+// watchStoreHealthCheck returns a HealthCheck that passes while the store is running and
+// successfully watching.
+func watchStoreHealthCheck[T any](name string, store *watch.Store[T]) util.HealthCheck {
+	return util.HealthCheck{
+		Name: name,
+		Check: func(context.Context) error {
+			if store.Stopped() {
+				return errors.New("watch store is stopped")
+			} else if store.Failing() {
+				return errors.New("watch store is failing to list or watch")
+			}
+			return nil
+		},
+	}
+}
+
+// denialError is an error from handleAgentRequest with a known reason, which is sent to the
+// autoscaler-agent in the api.HeaderDenialReason header.
+type denialError struct {
+	reason api.DenialReason
+	err    error
+}
+
+func denied(reason api.DenialReason, err error) denialError {
+	return denialError{reason: reason, err: err}
+}
+
+func (e denialError) Error() string {
+	return e.err.Error()
+}
+
+func (e denialError) Unwrap() error {
+	return e.err
+}
+
+// validateAgentRequestBounds checks the requested resources against the scaling bounds from the
+// pod, returning the status code and error if the request should be rejected.
+//
+// Only requests that aren't a whole number of memory slots are rejected. Requests outside the
+// bounds are expected from time to time (e.g., the agent may still be at the previous maximum
+// after it was decreased), so we just log those.
+func validateAgentRequestBounds(logger *zap.Logger, pod *corev1.Pod, req api.AgentRequest) (int, error) {
+	var vmInfo *api.VmInfo
+	var err error
+	if api.IsStandaloneScalingPod(pod) {
+		vmInfo, err = api.ExtractPodScalingInfo(logger, pod)
+	} else {
+		vmInfo, err = api.ExtractVmInfoFromPod(logger, pod)
+	}
+	if err != nil {
+		// The pod's annotations may be lagging behind the VM, so this isn't enough to reject the
+		// request.
+		logger.Warn("Failed to extract scaling bounds from Pod for agent request", zap.Error(err))
+		return 0, nil
+	}
+
+	// The autoscaler-agent already warns about bounds that aren't a multiple of the compute unit, so
+	// we don't need to check that here.
+	issues := vmInfo.ValidateTarget(req.Resources, nil)
+	if err := issues.Only(api.BoundsNotSlotAligned).Err(); err != nil {
+		return 400, denied(api.DenialReasonBoundsViolation, fmt.Errorf("invalid resources: %w", err))
+	}
+	for _, issue := range issues.Only(api.BoundsOutOfRange) {
+		logger.Warn("Agent request has unexpected resources", zap.Error(issue))
+	}
+	return 0, nil
+}
+
 // Returns body (if successful), status code, error (if unsuccessful)
 func (s *PluginState) handleAgentRequest(
 	logger *zap.Logger,
 	req api.AgentRequest,
 	getPod func(util.NamespacedName) (*corev1.Pod, bool),
 	listenerForPod func(types.UID) (util.BroadcastReceiver, bool),
-) (_ *api.PluginResponse, status int, _ error) {
+) (finalResp *api.PluginResponse, status int, _ error) {
 	nodeName := "<none>" // override this later if we have a node name
 
 	defer func() {
@@ -150,13 +381,24 @@ func (s *PluginState) handleAgentRequest(
 	}
 
 	if !req.ProtoVersion.IsValid() {
-		return nil, 400, fmt.Errorf("Invalid protocol version %v", req.ProtoVersion)
+		return nil, 400, denied(
+			api.DenialReasonProtocolMismatch,
+			fmt.Errorf("Invalid protocol version %v", req.ProtoVersion),
+		)
 	}
 	reqProtoRange := req.ProtocolRange()
-	if _, ok := expectedProtoRange.LatestSharedVersion(reqProtoRange); !ok {
-		return nil, 400, fmt.Errorf(
+	protoVersion, ok := expectedProtoRange.LatestSharedVersion(reqProtoRange)
+	if !ok {
+		return nil, 400, denied(api.DenialReasonProtocolMismatch, fmt.Errorf(
 			"Protocol version mismatch: Need %v but got %v", expectedProtoRange, reqProtoRange,
-		)
+		))
+	}
+
+	if req.Departing {
+		if req.LastPermit == nil || req.Resources != *req.LastPermit {
+			return nil, 400, errors.New("departing request must have resources equal to lastPermit")
+		}
+		logger.Info("Received departing notice from autoscaler-agent")
 	}
 
 	// check that req.ComputeUnit has no zeros
@@ -175,20 +417,48 @@ func (s *PluginState) handleAgentRequest(
 
 	nodeName = podObj.Spec.NodeName // set nodeName for deferred metrics
 
-	vmRef, ok := vmv1.VirtualMachineOwnerForPod(podObj)
-	if !ok {
+	if resp, ok := s.previousAgentResponse(podObj.UID, req.RequestID); ok {
+		logger.Info("Received retry of already handled agent request, returning previous response", zap.Any("response", resp))
+		return resp, 200, nil
+	}
+	// Record successful responses so that retries of this request get the same response.
+	defer func() {
+		if status == 200 && finalResp != nil {
+			if req.Departing {
+				// No more requests are coming from this autoscaler-agent, so there's nothing to
+				// match retries against.
+				s.recordAgentDeparted(logger, podObj)
+			} else {
+				s.recordAgentResponse(podObj, req.RequestID, *finalResp)
+			}
+		}
+	}()
+
+	// Standalone pods have their scaling annotations set directly, rather than via a VM.
+	patchScalingObject := func(patches []patch.Operation) error {
+		return s.patchPod(req.Pod, patches)
+	}
+	if vmRef, ok := vmv1.VirtualMachineOwnerForPod(podObj); ok {
+		vmName := util.NamespacedName{
+			Namespace: podObj.Namespace,
+			Name:      vmRef.Name,
+		}
+		patchScalingObject = func(patches []patch.Operation) error {
+			return s.patchVM(vmName, patches)
+		}
+	} else if !api.IsStandaloneScalingPod(podObj) {
 		logger.Error("Received request for non-VM Pod")
 		return nil, 400, errors.New("pod is not associated with a VM")
 	}
-	vmName := util.NamespacedName{
-		Namespace: podObj.Namespace,
-		Name:      vmRef.Name,
+
+	if status, err := validateAgentRequestBounds(logger, podObj, req); err != nil {
+		return nil, status, err
 	}
 
 	// From this point, we'll:
 	//
-	// 1. Update the annotations on the VirtualMachine object, if this request should change them;
-	//    and
+	// 1. Update the annotations on the VirtualMachine object (or the Pod itself, for standalone
+	//    pods), if this request should change them; and
 	//
 	// 2. Wait for the annotations on the Pod object to change so that the approved resources are
 	//    increased towards what was requested -- only if the amount requested was greater than what
@@ -201,8 +471,11 @@ func (s *PluginState) handleAgentRequest(
 
 	// Only patch the VM object if it changed:
 	if changed {
-		if err := s.patchVM(vmName, patches); err != nil {
+		if err := patchScalingObject(patches); err != nil {
 			logger.Error("Failed to patch VM object", zap.Error(err))
+			if isQuotaExceeded(err) {
+				return nil, 403, denied(api.DenialReasonQuotaExceeded, errors.New("failed to patch VM object: quota exceeded"))
+			}
 			return nil, 500, errors.New("failed to patch VM object")
 		}
 		logger.Info("Patched VirtualMachine for agent request", zap.Any("patches", patches))
@@ -213,6 +486,7 @@ func (s *PluginState) handleAgentRequest(
 		resp := api.PluginResponse{
 			Permit:  req.Resources,
 			Migrate: nil,
+			Reason:  nil,
 		}
 		status = 200
 		logger.Info("Handled agent request", zap.Int("status", status), zap.Any("response", resp))
@@ -287,6 +561,12 @@ func (s *PluginState) handleAgentRequest(
 			resp := api.PluginResponse{
 				Permit:  approved,
 				Migrate: nil,
+				Reason:  nil,
+			}
+			// The only reason we'd give less than what was requested is because there wasn't
+			// enough room on the node.
+			if approved.HasFieldLessThan(req.Resources) && protoVersion.SupportsDenialReasons() {
+				resp.Reason = lo.ToPtr(api.DenialReasonNodeFull)
 			}
 			status = 200
 			logger.Info("Handled agent request", zap.Int("status", status), zap.Any("response", resp))
@@ -305,6 +585,61 @@ func (s *PluginState) handleAgentRequest(
 	}
 }
 
+// previousAgentResponse returns the last successful response for the pod, if it was for the request
+// with the given ID.
+func (s *PluginState) previousAgentResponse(uid types.UID, requestID string) (*api.PluginResponse, bool) {
+	if requestID == "" {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.agentResponses[uid]
+	if !ok || prev.requestID != requestID {
+		return nil, false
+	}
+	resp := prev.resp
+	return &resp, true
+}
+
+func (s *PluginState) recordAgentResponse(pod *corev1.Pod, requestID string, resp api.PluginResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if requestID == "" {
+		// Without an ID there's nothing to match retries against, so just clear the old response.
+		delete(s.agentResponses, pod.UID)
+		return
+	}
+
+	// Don't record anything if the pod was deleted while we were handling the request; otherwise
+	// the entry would never be cleaned up.
+	ns, ok := s.nodes[pod.Spec.NodeName]
+	if !ok {
+		return
+	} else if _, ok := ns.node.GetPod(pod.UID); !ok {
+		return
+	}
+
+	s.agentResponses[pod.UID] = agentResponse{requestID: requestID, resp: resp}
+}
+
+// isQuotaExceeded returns whether the error from patching an object was because it would exceed a
+// ResourceQuota
+//
+// The ResourceQuota admission plugin doesn't have its own status reason, so we check for a Forbidden
+// status with the message it uses. Only the message from the API server is checked, so that
+// wrapping the error doesn't change the result.
+func isQuotaExceeded(err error) bool {
+	var apiStatus apierrors.APIStatus
+	if !errors.As(err, &apiStatus) {
+		return false
+	}
+	status := apiStatus.Status()
+	return status.Reason == metav1.StatusReasonForbidden && strings.Contains(status.Message, "exceeded quota")
+}
+
 func vmPatchForAgentRequest(pod *corev1.Pod, req api.AgentRequest) (_ []patch.Operation, changed bool) {
 	marshalJSON := func(value any) string {
 		bs, err := json.Marshal(value)
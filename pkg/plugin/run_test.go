@@ -0,0 +1,117 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/plugin/state"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+func TestIsQuotaExceeded(t *testing.T) {
+	resource := schema.GroupResource{Group: "", Resource: "pods"}
+	quotaErr := apierrors.NewForbidden(resource, "pod", errors.New("exceeded quota: compute, requested: cpu=2, used: cpu=7, limited: cpu=8"))
+
+	cases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"QuotaExceeded", quotaErr, true},
+		{"Wrapped", fmt.Errorf("failed to patch pod: %w", quotaErr), true},
+		{"OtherForbidden", apierrors.NewForbidden(resource, "pod", errors.New("not allowed")), false},
+		{"OtherReason", apierrors.NewBadRequest("exceeded quota"), false},
+		{"NotAPIError", errors.New("exceeded quota"), false},
+		{"Nil", nil, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expected, isQuotaExceeded(c.err))
+		})
+	}
+}
+
+func TestAgentResponseReplay(t *testing.T) {
+	s := newTestAgentsState()
+
+	pod := &corev1.Pod{}
+	pod.Name = "pod"
+	pod.Namespace = "default"
+	pod.UID = "pod-uid"
+	pod.Spec.NodeName = "node-1"
+
+	noOvercommit := resource.MustParse("1")
+	node := state.NodeStateFromParams("node-1", 10000, 1<<40, 0.8, nil)
+	//nolint:exhaustruct // only the fields used for recording responses
+	node.AddPod(state.Pod{
+		NamespacedName: util.GetNamespacedName(pod),
+		UID:            pod.UID,
+		CPU:            state.PodResources[vmv1.MilliCPU]{Overcommit: &noOvercommit}, //nolint:exhaustruct // see above
+		Mem:            state.PodResources[api.Bytes]{Overcommit: &noOvercommit},     //nolint:exhaustruct // see above
+	})
+	s.nodes["node-1"] = &nodeState{node: node, requestedMigrations: nil, podsVMPatchedAt: nil}
+
+	first := api.PluginResponse{Permit: api.Resources{VCPU: 1000, Mem: 4 << 30}, Migrate: nil, Reason: nil}
+	s.recordAgentResponse(pod, "id-1", first)
+
+	resp, ok := s.previousAgentResponse(pod.UID, "id-1")
+	require.True(t, ok)
+	assert.Equal(t, first, *resp)
+
+	// The returned response is a copy
+	resp.Permit.VCPU = 0
+	resp, _ = s.previousAgentResponse(pod.UID, "id-1")
+	assert.Equal(t, first, *resp)
+
+	// Only retries of the same request get the previous response
+	_, ok = s.previousAgentResponse(pod.UID, "id-2")
+	assert.False(t, ok)
+	_, ok = s.previousAgentResponse(pod.UID, "")
+	assert.False(t, ok)
+	_, ok = s.previousAgentResponse("other-uid", "id-1")
+	assert.False(t, ok)
+
+	// A newer request replaces the previous response
+	second := api.PluginResponse{
+		Permit:  api.Resources{VCPU: 500, Mem: 2 << 30},
+		Migrate: nil,
+		Reason:  lo.ToPtr(api.DenialReasonNodeFull),
+	}
+	s.recordAgentResponse(pod, "id-2", second)
+	_, ok = s.previousAgentResponse(pod.UID, "id-1")
+	assert.False(t, ok)
+	resp, ok = s.previousAgentResponse(pod.UID, "id-2")
+	require.True(t, ok)
+	assert.Equal(t, second, *resp)
+
+	// Requests without an ID clear the previous response
+	s.recordAgentResponse(pod, "", first)
+	_, ok = s.previousAgentResponse(pod.UID, "id-2")
+	assert.False(t, ok)
+	assert.Empty(t, s.agentResponses)
+
+	// ... as do departing requests
+	s.recordAgentResponse(pod, "id-3", first)
+	s.recordAgentDeparted(zap.NewNop(), pod)
+	_, ok = s.previousAgentResponse(pod.UID, "id-3")
+	assert.False(t, ok)
+
+	// Responses aren't recorded for pods that were removed while the request was handled
+	node.RemovePod(pod.UID)
+	s.recordAgentResponse(pod, "id-4", first)
+	assert.Empty(t, s.agentResponses)
+}
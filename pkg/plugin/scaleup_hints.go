@@ -0,0 +1,110 @@
+package plugin
+
+// Signals for node autoscalers (e.g. cluster-autoscaler or Karpenter) when VMs can't get the
+// resources they need due to lack of capacity.
+//
+// When a VM can't be placed on any node, the scheduler itself records the PodScheduled=False
+// condition and a FailedScheduling event, which node autoscalers already act on. Denied upscales
+// have no equivalent, so we emit an event for those ourselves.
+//
+// In both cases, the scale-up hint annotation (if enabled) gives the shape of the resources that
+// were required, because the pod's own resource requests don't reflect what the VM needs.
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+
+	vmv1 "github.com/neondatabase/autoscaling/neonvm/apis/neonvm/v1"
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/plugin/state"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+// rejectedOnlyForCapacity returns whether every node was filtered out by our plugin -- which, for
+// Filter, only happens when there isn't enough room for the pod.
+func rejectedOnlyForCapacity(filteredNodeStatusMap framework.NodeToStatusMap) bool {
+	if len(filteredNodeStatusMap) == 0 {
+		return false
+	}
+	for _, status := range filteredNodeStatusMap {
+		if status.Code() != framework.Unschedulable || status.Plugin() != PluginName {
+			return false
+		}
+	}
+	return true
+}
+
+// recordUpscaleDenied emits an event on the pod, to signal that we could not grant the resources
+// requested for it.
+//
+// The event is dropped if we're over Config.EventRateLimit.
+func (s *PluginState) recordUpscaleDenied(pod *corev1.Pod, requested api.Resources) {
+	if !s.eventLimiter.Allow() {
+		return
+	}
+	s.eventRecorder.Eventf(
+		pod, nil, corev1.EventTypeWarning, "UpscaleDenied", "Reserve",
+		"%s: Not enough capacity on node %s to grant requested resources of %v vCPU and %v memory",
+		api.DenialReasonNodeFull, pod.Spec.NodeName, requested.VCPU, requested.Mem,
+	)
+}
+
+// reconcileScaleUpHint sets the scale-up hint annotation on the pod to the given resources, or
+// removes it if hint is nil. It does nothing if the annotation is already up-to-date, or if scale-up
+// hints are not enabled.
+func (s *PluginState) reconcileScaleUpHint(logger *zap.Logger, pod *corev1.Pod, hint *api.Resources) error {
+	if !s.config.ScaleUpHintAnnotation {
+		return nil
+	}
+
+	var value *string
+	if hint != nil {
+		bs, err := json.Marshal(*hint)
+		if err != nil {
+			panic(fmt.Sprintf("failed to marshal value: %s", err))
+		}
+		value = lo.ToPtr(string(bs))
+	}
+
+	current, hasHint := pod.Annotations[api.AnnotationScaleUpHint]
+	if value == nil && !hasHint || value != nil && hasHint && current == *value {
+		return nil
+	}
+
+	err := s.patchPodAnnotation(util.GetNamespacedName(pod), api.AnnotationScaleUpHint, value)
+	if err != nil {
+		return fmt.Errorf("could not patch scale-up hint annotation: %w", err)
+	}
+
+	if value != nil {
+		logger.Info("Set scale-up hint annotation on Pod", zap.String("hint", *value))
+	} else {
+		logger.Info("Removed scale-up hint annotation from Pod")
+	}
+	return nil
+}
+
+// setPlacementScaleUpHint sets the scale-up hint annotation on a VM pod that couldn't be placed
+// onto any node, logging on failure.
+func (e *AutoscaleEnforcer) setPlacementScaleUpHint(logger *zap.Logger, pod *corev1.Pod) {
+	if _, ok := vmv1.VirtualMachineOwnerForPod(pod); !ok {
+		return // the resource requests of non-VM pods are already enough for node autoscalers.
+	}
+
+	podState, err := state.PodStateFromK8sObj(pod)
+	if err != nil {
+		logger.Error("Error extracting local information for Pod to set scale-up hint", zap.Error(err))
+		return
+	}
+
+	hint := api.Resources{VCPU: podState.CPU.Reserved, Mem: podState.Mem.Reserved}
+	if err := e.state.reconcileScaleUpHint(logger, pod, &hint); err != nil {
+		logger.Error("Failed to set scale-up hint for Pod", zap.Error(err))
+	}
+}
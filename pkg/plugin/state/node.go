@@ -35,6 +35,19 @@ type Node struct {
 
 	CPU NodeResources[vmv1.MilliCPU]
 	Mem NodeResources[api.Bytes]
+
+	// VMs is the number of VM pods on the node, including pods that are only reserved and the
+	// source and target pods of ongoing migrations.
+	VMs int
+	// MaxVMs, if non-zero, is the maximum number of VM pods allowed on the node, regardless of
+	// resources. It's from the node's "autoscaling.neon.tech/max-vms" annotation if set, or the
+	// plugin's maxVMsPerNode otherwise.
+	//
+	// Lowering the limit below VMs doesn't remove any pods, it only stops new ones from being
+	// placed on the node.
+	//
+	// Like Total, this value is only changed by (*Node).Update.
+	MaxVMs int
 }
 
 // MarshalLogObject implements zapcore.ObjectMarshaler so that Node can be used with zap.Object
@@ -56,17 +69,25 @@ func (n Node) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 	if err := enc.AddReflected("Mem", n.Mem); err != nil {
 		return err
 	}
+	enc.AddInt("VMs", n.VMs)
+	enc.AddInt("MaxVMs", n.MaxVMs)
 	return nil
 }
 
 type NodeResources[T constraints.Unsigned] struct {
-	// Total is the total amount of T available on the node.
+	// Total is the amount of T that can be reserved on the node, taken from the Node's
+	// status.allocatable.
+	//
+	// For memory, this is scaled by the factor from the first matching entry in the scheduler's
+	// nodeMemoryOvercommit config, unless the node has the MemoryPressure condition or overcommit
+	// is disabled.
 	//
-	// This value does not change.
+	// This value is only changed by (*Node).Update, when the Node object or its overcommit factor
+	// changes.
 	Total T
 
-	// Reserved is the sum of all Pods' <resource>.Reserved values, after applying overcommit
-	// factors.
+	// Reserved is the sum of all Pods' <resource>.Reserved values, after dividing by each pod's
+	// own overcommit factor, plus each pod's <resource>.Overhead, which is never overcommitted.
 	//
 	// It SHOULD be less than or equal to Total, and - when live migration is enabled - we take
 	// active measures to reduce it once it is above Watermark.
@@ -80,10 +101,16 @@ type NodeResources[T constraints.Unsigned] struct {
 	// Migrating is the amount of T that we expect will be removed by ongoing live migration.
 	Migrating T
 
+	// Dedicated is the amount of T reserved by pods with a dedicated CPU class, which is included
+	// in Reserved.
+	//
+	// The amount reserved by pods with a shared CPU class is Reserved - Dedicated.
+	Dedicated T
+
 	// Watermark is the amount of T reserved to pods above which we attempt to reduce usage via
 	// migration.
 	//
-	// This value does not change.
+	// Like Total, this value is only changed by (*Node).Update.
 	Watermark T
 }
 
@@ -97,6 +124,7 @@ func (r NodeResources[T]) Fields() []NodeResourceField[T] {
 		{"Total", r.Total},
 		{"Reserved", r.Reserved},
 		{"Migrating", r.Migrating},
+		{"Dedicated", r.Dedicated},
 		{"Watermark", r.Watermark},
 	}
 }
@@ -104,6 +132,8 @@ func (r NodeResources[T]) Fields() []NodeResourceField[T] {
 func NodeStateFromK8sObj(
 	node *corev1.Node,
 	watermarkFraction float64,
+	memOvercommitFactor float64,
+	maxVMs int,
 	keepLabels []string,
 ) (*Node, error) {
 	// Note that node.Status.Allocatable has the following docs:
@@ -124,14 +154,17 @@ func NodeStateFromK8sObj(
 	if memQ == nil {
 		return nil, errors.New("Node has no Allocatable Memory limit")
 	}
-	totalMem := api.BytesFromResourceQuantity(*memQ)
+	// Overcommit is applied to the total, so that it's also reflected in the watermark.
+	totalMem := api.Bytes(float64(api.BytesFromResourceQuantity(*memQ)) * memOvercommitFactor)
 
 	labels := make(map[string]string)
 	for _, lbl := range keepLabels {
 		labels[lbl] = node.Labels[lbl]
 	}
 
-	return NodeStateFromParams(node.Name, totalCPU, totalMem, watermarkFraction, labels), nil
+	n := NodeStateFromParams(node.Name, totalCPU, totalMem, watermarkFraction, labels)
+	n.MaxVMs = maxVMs
+	return n, nil
 }
 
 // NodeStateFromParams is a helper to construct a *Node, primarily for use in tests.
@@ -159,14 +192,18 @@ func NodeStateFromParams(
 			Total:     totalCPU,
 			Reserved:  0,
 			Migrating: 0,
+			Dedicated: 0,
 			Watermark: vmv1.MilliCPU(float64(totalCPU) * watermarkFraction),
 		},
 		Mem: NodeResources[api.Bytes]{
 			Total:     totalMem,
 			Reserved:  0,
 			Migrating: 0,
+			Dedicated: 0,
 			Watermark: api.Bytes(float64(totalMem) * watermarkFraction),
 		},
+		VMs:    0,
+		MaxVMs: 0,
 	}
 }
 
@@ -175,6 +212,11 @@ func (n *Node) OverBudget() bool {
 	return n.CPU.Reserved > n.CPU.Total || n.Mem.Reserved > n.Mem.Total
 }
 
+// OverVMLimit returns whether this node has more VM pods than allowed by MaxVMs
+func (n *Node) OverVMLimit() bool {
+	return n.MaxVMs != 0 && n.VMs > n.MaxVMs
+}
+
 // Speculatively allows attempting a modification to the node before deciding whether to actually
 // commit that change.
 //
@@ -187,6 +229,8 @@ func (n *Node) Speculatively(modify func(n *Node) (commit bool)) (committed bool
 		migratablePods: n.migratablePods.NewTransaction(),
 		CPU:            n.CPU,
 		Mem:            n.Mem,
+		VMs:            n.VMs,
+		MaxVMs:         n.MaxVMs,
 	}
 	commit := modify(tmp)
 	if commit {
@@ -195,10 +239,53 @@ func (n *Node) Speculatively(modify func(n *Node) (commit bool)) (committed bool
 		tmp.migratablePods.Commit()
 		n.CPU = tmp.CPU
 		n.Mem = tmp.Mem
+		n.VMs = tmp.VMs
 	}
 	return commit
 }
 
+// PreemptionVictims returns the pods to remove from the node, taken in order from candidates, so
+// that the preemptor would fit on the node according to fits. At most maxVictims are removed
+// (zero means no limit), and candidates that aren't on the node are skipped.
+//
+// If the preemptor already fits without removing anything, or it would still not fit after
+// removing as many pods as allowed, ok is false. The node itself is never changed.
+func (n *Node) PreemptionVictims(
+	preemptor Pod,
+	candidates []types.UID,
+	maxVictims int,
+	fits func(*Node) bool,
+) (victims []types.UID, ok bool) {
+	n.Speculatively(func(n *Node) (commit bool) {
+		n.AddPod(preemptor)
+		if fits(n) {
+			// We aren't the reason the pod doesn't fit on this node, so removing pods based on our
+			// accounting won't help.
+			return false
+		}
+
+		for _, uid := range candidates {
+			if maxVictims != 0 && len(victims) == maxVictims {
+				break
+			}
+			if !n.RemovePod(uid) {
+				continue // not on this node, so it isn't using any resources we know of.
+			}
+			victims = append(victims, uid)
+			if fits(n) {
+				ok = true
+				break
+			}
+		}
+		return false // never commit these changes; we're just using this for a temp node.
+	})
+
+	if !ok {
+		return nil, false
+	}
+	return victims, true
+}
+
 // Update sets the resource state of the node, corresponding to the changes in the totals present as
 // part of newState.
 //
@@ -210,7 +297,8 @@ func (n *Node) Update(newState *Node) (changed bool) {
 	}
 
 	changed = newState.CPU.Total != n.CPU.Total || newState.Mem.Total != n.Mem.Total ||
-		newState.CPU.Watermark != n.CPU.Watermark || newState.Mem.Watermark != n.Mem.Watermark
+		newState.CPU.Watermark != n.CPU.Watermark || newState.Mem.Watermark != n.Mem.Watermark ||
+		newState.MaxVMs != n.MaxVMs
 
 	// Propagate changes to labels:
 	for label, value := range newState.Labels.Entries() {
@@ -241,14 +329,18 @@ func (n *Node) Update(newState *Node) (changed bool) {
 			Total:     newState.CPU.Total,
 			Reserved:  n.CPU.Reserved,
 			Migrating: n.CPU.Migrating,
+			Dedicated: n.CPU.Dedicated,
 			Watermark: newState.CPU.Watermark,
 		},
 		Mem: NodeResources[api.Bytes]{
 			Total:     newState.Mem.Total,
 			Reserved:  n.Mem.Reserved,
 			Migrating: n.Mem.Migrating,
+			Dedicated: n.Mem.Dedicated,
 			Watermark: newState.Mem.Watermark,
 		},
+		VMs:    n.VMs,
+		MaxVMs: newState.MaxVMs,
 	}
 
 	return
@@ -290,12 +382,15 @@ func (n *Node) AddPod(pod Pod) {
 		panic("cannot add Pod that already exists")
 	}
 
-	n.CPU.add(&pod.CPU, pod.Migrating)
-	n.Mem.add(&pod.Mem, pod.Migrating)
+	n.CPU.add(&pod.CPU, pod.Migrating, pod.DedicatedCPU)
+	n.Mem.add(&pod.Mem, pod.Migrating, pod.DedicatedCPU)
 	n.pods.Set(pod.UID, pod)
 	if pod.Migratable {
 		n.migratablePods.Set(pod.UID, struct{}{})
 	}
+	if pod.VirtualMachine != (util.NamespacedName{}) {
+		n.VMs += 1
+	}
 }
 
 // UpdatePod updates the node based on the change in the pod from old to new.
@@ -336,8 +431,8 @@ func (n *Node) ReconcilePodReserved(pod *Pod) (done bool) {
 		panic("cannot reconcile reserved resources for Pod that doesn't exist in the node state")
 	}
 
-	cpuDone := n.CPU.reconcilePod(&pod.CPU, pod.Migrating)
-	memDone := n.Mem.reconcilePod(&pod.Mem, pod.Migrating)
+	cpuDone := n.CPU.reconcilePod(&pod.CPU, pod.Migrating, pod.DedicatedCPU)
+	memDone := n.Mem.reconcilePod(&pod.Mem, pod.Migrating, pod.DedicatedCPU)
 	n.pods.Set(pod.UID, *pod)
 
 	return cpuDone && memDone
@@ -355,8 +450,11 @@ func (n *Node) RemovePod(uid types.UID) (exists bool) {
 
 	n.pods.Delete(uid)
 	n.migratablePods.Delete(uid)
-	n.CPU.remove(pod.CPU, pod.Migrating)
-	n.Mem.remove(pod.Mem, pod.Migrating)
+	n.CPU.remove(pod.CPU, pod.Migrating, pod.DedicatedCPU)
+	n.Mem.remove(pod.Mem, pod.Migrating, pod.DedicatedCPU)
+	if pod.VirtualMachine != (util.NamespacedName{}) {
+		n.VMs -= 1
+	}
 	return true
 }
 
@@ -365,34 +463,40 @@ func applyOvercommit[T constraints.Integer](value T, overcommit *resource.Quanti
 	return T(int64(value) * 1000 / overcommit.MilliValue())
 }
 
-func (r *NodeResources[T]) add(p *PodResources[T], migrating bool) {
-	actualReserved := applyOvercommit(p.Reserved, p.Overcommit)
+func (r *NodeResources[T]) add(p *PodResources[T], migrating, dedicated bool) {
+	actualReserved := applyOvercommit(p.Reserved, p.Overcommit) + p.Overhead
 
 	r.Reserved += actualReserved
 	if migrating {
 		r.Migrating += actualReserved
 	}
+	if dedicated {
+		r.Dedicated += actualReserved
+	}
 }
 
-func (r *NodeResources[T]) remove(p PodResources[T], migrating bool) {
-	actualReserved := applyOvercommit(p.Reserved, p.Overcommit)
+func (r *NodeResources[T]) remove(p PodResources[T], migrating, dedicated bool) {
+	actualReserved := applyOvercommit(p.Reserved, p.Overcommit) + p.Overhead
 
 	r.Reserved -= actualReserved
 	if migrating {
 		r.Migrating -= actualReserved
 	}
+	if dedicated {
+		r.Dedicated -= actualReserved
+	}
 }
 
-func (r *NodeResources[T]) reconcilePod(p *PodResources[T], migrating bool) (done bool) {
+func (r *NodeResources[T]) reconcilePod(p *PodResources[T], migrating, dedicated bool) (done bool) {
 	if p.Requested == p.Reserved {
 		return true // nothing to do!
 	}
 
 	if p.Requested < p.Reserved {
 		// Easy enough - we can just make the reduction.
-		r.remove(*p, migrating)
+		r.remove(*p, migrating, dedicated)
 		p.Reserved = p.Requested
-		r.add(p, migrating)
+		r.add(p, migrating, dedicated)
 		return true // nothing to do!
 	}
 
@@ -409,9 +513,9 @@ func (r *NodeResources[T]) reconcilePod(p *PodResources[T], migrating bool) (don
 
 	actualIncrease := min(maxIncrease, desiredIncrease)
 	if actualIncrease != 0 {
-		r.remove(*p, migrating)
+		r.remove(*p, migrating, dedicated)
 		p.Reserved += actualIncrease
-		r.add(p, migrating)
+		r.add(p, migrating, dedicated)
 	}
 	// We're done iff everything that was asked for has been granted
 	return p.Reserved == p.Requested
@@ -40,17 +40,20 @@ func fixedPod(id int, cpu vmv1.MilliCPU, mem api.Bytes) state.Pod {
 		Migratable:     false,
 		AlwaysMigrate:  false,
 		Migrating:      false,
+		DedicatedCPU:   false,
 		CPU: state.PodResources[vmv1.MilliCPU]{
 			Reserved:   cpu,
 			Requested:  cpu,
 			Factor:     0,
 			Overcommit: lo.ToPtr(resource.MustParse("1000m")), // 1000m = 1.0 = "no overcommit"
+			Overhead:   0,
 		},
 		Mem: state.PodResources[api.Bytes]{
 			Reserved:   mem,
 			Requested:  mem,
 			Factor:     0,
 			Overcommit: lo.ToPtr(resource.MustParse("1000m")), // 1000m = 1.0 = "no overcommit"
+			Overhead:   0,
 		},
 	}
 }
@@ -74,12 +77,14 @@ func TestBasicNodeOperations(t *testing.T) {
 		Reserved:  3 * cpu,
 		Watermark: 8 * cpu,
 		Migrating: 0,
+		Dedicated: 0,
 	}, node.CPU)
 	assert.Equal(t, state.NodeResources[api.Bytes]{
 		Total:     40 * gib,
 		Reserved:  12 * gib,
 		Watermark: 32 * gib,
 		Migrating: 0,
+		Dedicated: 0,
 	}, node.Mem)
 
 	node.RemovePod(podUID(2))
@@ -89,15 +94,123 @@ func TestBasicNodeOperations(t *testing.T) {
 		Reserved:  2 * cpu,
 		Watermark: 8 * cpu,
 		Migrating: 0,
+		Dedicated: 0,
 	}, node.CPU)
 	assert.Equal(t, state.NodeResources[api.Bytes]{
 		Total:     40 * gib,
 		Reserved:  8 * gib,
 		Watermark: 32 * gib,
 		Migrating: 0,
+		Dedicated: 0,
 	}, node.Mem)
 }
 
+func TestDedicatedCPUAccounting(t *testing.T) {
+	cpu := vmv1.MilliCPU(1000)
+	gib := api.Bytes(1024 * 1024 * 1024)
+
+	node := state.NodeStateFromParams(
+		"node-1",
+		10*cpu,
+		40*gib,
+		defaultWatermarkFraction,
+		map[string]string{},
+	)
+
+	dedicated := fixedPod(1, 2*cpu, 8*gib)
+	dedicated.DedicatedCPU = true
+	node.AddPod(dedicated)
+	node.AddPod(fixedPod(2, 1*cpu, 4*gib))
+	assert.Equal(t, state.NodeResources[vmv1.MilliCPU]{
+		Total:     10 * cpu,
+		Reserved:  3 * cpu,
+		Watermark: 8 * cpu,
+		Migrating: 0,
+		Dedicated: 2 * cpu,
+	}, node.CPU)
+	assert.Equal(t, state.NodeResources[api.Bytes]{
+		Total:     40 * gib,
+		Reserved:  12 * gib,
+		Watermark: 32 * gib,
+		Migrating: 0,
+		Dedicated: 8 * gib,
+	}, node.Mem)
+
+	node.RemovePod(podUID(1))
+
+	assert.Equal(t, vmv1.MilliCPU(0), node.CPU.Dedicated)
+	assert.Equal(t, api.Bytes(0), node.Mem.Dedicated)
+}
+
+func TestPodOverheadAccounting(t *testing.T) {
+	cpu := vmv1.MilliCPU(1000)
+	gib := api.Bytes(1024 * 1024 * 1024)
+
+	node := state.NodeStateFromParams(
+		"node-1",
+		10*cpu,
+		40*gib,
+		defaultWatermarkFraction,
+		map[string]string{},
+	)
+
+	// Overhead is reserved in addition to the pod's resources, and isn't affected by overcommit.
+	pod := fixedPod(1, 2*cpu, 8*gib)
+	pod.CPU.Overhead = cpu / 4
+	pod.Mem.Overhead = gib / 2
+	pod.CPU.Overcommit = lo.ToPtr(resource.MustParse("2"))
+	node.AddPod(pod)
+	assert.Equal(t, cpu+cpu/4, node.CPU.Reserved)
+	assert.Equal(t, 8*gib+gib/2, node.Mem.Reserved)
+
+	// Scaling the pod doesn't change the overhead
+	pod.CPU.Requested = 4 * cpu
+	pod.CPU.Factor = cpu / 4
+	assert.True(t, node.ReconcilePodReserved(&pod))
+	assert.Equal(t, 2*cpu+cpu/4, node.CPU.Reserved)
+
+	node.RemovePod(podUID(1))
+	assert.Equal(t, vmv1.MilliCPU(0), node.CPU.Reserved)
+	assert.Equal(t, api.Bytes(0), node.Mem.Reserved)
+}
+
+func TestVMCountLimit(t *testing.T) {
+	cpu := vmv1.MilliCPU(1000)
+	gib := api.Bytes(1024 * 1024 * 1024)
+
+	node := state.NodeStateFromParams(
+		"node-1",
+		10*cpu,
+		40*gib,
+		defaultWatermarkFraction,
+		map[string]string{},
+	)
+	node.MaxVMs = 2
+
+	vmPod := func(id int) state.Pod {
+		p := fixedPod(id, 1*cpu, 4*gib)
+		p.VirtualMachine = util.NamespacedName{Namespace: p.Namespace, Name: fmt.Sprintf("vm-%d", id)}
+		return p
+	}
+
+	node.AddPod(vmPod(1))
+	node.AddPod(vmPod(2))
+	node.AddPod(fixedPod(3, 1*cpu, 4*gib)) // not a VM, so doesn't count towards the limit
+	assert.Equal(t, 2, node.VMs)
+	assert.False(t, node.OverVMLimit())
+
+	// Changes made speculatively should only be visible if committed
+	node.Speculatively(func(n *state.Node) (commit bool) {
+		n.AddPod(vmPod(4))
+		assert.True(t, n.OverVMLimit())
+		return false
+	})
+	assert.Equal(t, 2, node.VMs)
+
+	node.RemovePod(podUID(1))
+	assert.Equal(t, 1, node.VMs)
+}
+
 func TestSpeculativeNodeOperations(t *testing.T) {
 	cpu := vmv1.MilliCPU(1000)
 	gib := api.Bytes(1024 * 1024 * 1024)
@@ -117,12 +230,14 @@ func TestSpeculativeNodeOperations(t *testing.T) {
 		Reserved:  2 * cpu,
 		Watermark: 8 * cpu,
 		Migrating: 0,
+		Dedicated: 0,
 	}, node.CPU)
 	assert.Equal(t, state.NodeResources[api.Bytes]{
 		Total:     40 * gib,
 		Reserved:  8 * gib,
 		Watermark: 32 * gib,
 		Migrating: 0,
+		Dedicated: 0,
 	}, node.Mem)
 
 	// try out removing a pod + adding a new one, but don't go through with it
@@ -142,12 +257,14 @@ func TestSpeculativeNodeOperations(t *testing.T) {
 		Reserved:  2 * cpu,
 		Watermark: 8 * cpu,
 		Migrating: 0,
+		Dedicated: 0,
 	}, node.CPU)
 	assert.Equal(t, state.NodeResources[api.Bytes]{
 		Total:     40 * gib,
 		Reserved:  8 * gib,
 		Watermark: 32 * gib,
 		Migrating: 0,
+		Dedicated: 0,
 	}, node.Mem)
 
 	// same as before, but actually do it
@@ -163,15 +280,135 @@ func TestSpeculativeNodeOperations(t *testing.T) {
 		Reserved:  3 * cpu,
 		Watermark: 8 * cpu,
 		Migrating: 0,
+		Dedicated: 0,
 	}, node.CPU)
 	assert.Equal(t, state.NodeResources[api.Bytes]{
 		Total:     40 * gib,
 		Reserved:  12 * gib,
 		Watermark: 32 * gib,
 		Migrating: 0,
+		Dedicated: 0,
 	}, node.Mem)
 }
 
+func TestPreemptionVictims(t *testing.T) {
+	cpu := vmv1.MilliCPU(1000)
+	gib := api.Bytes(1024 * 1024 * 1024)
+
+	newNode := func() *state.Node {
+		node := state.NodeStateFromParams(
+			"node-1",
+			10*cpu,
+			40*gib,
+			defaultWatermarkFraction,
+			map[string]string{},
+		)
+		node.AddPod(fixedPod(1, 4*cpu, 4*gib))
+		node.AddPod(fixedPod(2, 2*cpu, 4*gib))
+		node.AddPod(fixedPod(3, 2*cpu, 4*gib))
+		return node
+	}
+	fits := func(n *state.Node) bool {
+		return !n.OverBudget() && !n.OverVMLimit()
+	}
+	// in the order that they'd be evicted
+	allCandidates := []types.UID{podUID(3), podUID(2), podUID(1)}
+
+	cases := []struct {
+		name          string
+		preemptorCPU  vmv1.MilliCPU
+		candidates    []types.UID
+		maxVictims    int
+		expectedOK    bool
+		expectedPicks []types.UID
+	}{
+		{
+			name:          "already fits",
+			preemptorCPU:  1 * cpu,
+			candidates:    allCandidates,
+			maxVictims:    0,
+			expectedOK:    false,
+			expectedPicks: nil,
+		},
+		{
+			name:          "fewest pods in order",
+			preemptorCPU:  4 * cpu,
+			candidates:    allCandidates,
+			maxVictims:    0,
+			expectedOK:    true,
+			expectedPicks: []types.UID{podUID(3)},
+		},
+		{
+			name:          "candidates not on the node are skipped",
+			preemptorCPU:  4 * cpu,
+			candidates:    []types.UID{podUID(99), podUID(2)},
+			maxVictims:    0,
+			expectedOK:    true,
+			expectedPicks: []types.UID{podUID(2)},
+		},
+		{
+			name:          "too many victims needed",
+			preemptorCPU:  7 * cpu,
+			candidates:    allCandidates,
+			maxVictims:    2,
+			expectedOK:    false,
+			expectedPicks: nil,
+		},
+		{
+			name:          "enough victims allowed",
+			preemptorCPU:  7 * cpu,
+			candidates:    allCandidates,
+			maxVictims:    3,
+			expectedOK:    true,
+			expectedPicks: []types.UID{podUID(3), podUID(2), podUID(1)},
+		},
+		{
+			name:          "doesn't fit even with all candidates removed",
+			preemptorCPU:  11 * cpu,
+			candidates:    allCandidates,
+			maxVictims:    0,
+			expectedOK:    false,
+			expectedPicks: nil,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			node := newNode()
+			before := *node
+
+			victims, found := node.PreemptionVictims(fixedPod(4, c.preemptorCPU, 4*gib), c.candidates, c.maxVictims, fits)
+			assert.Equal(t, c.expectedOK, found)
+			assert.Equal(t, c.expectedPicks, victims)
+
+			// the node must be left as it was
+			assert.Equal(t, before.CPU, node.CPU)
+			assert.Equal(t, before.Mem, node.Mem)
+			for _, uid := range allCandidates {
+				assert.True(t, ok(node.GetPod(uid)))
+			}
+			assert.False(t, ok(node.GetPod(podUID(4))))
+		})
+	}
+
+	t.Run("VM limit", func(t *testing.T) {
+		node := newNode()
+		node.MaxVMs = 1
+		vmPod := func(id int) state.Pod {
+			p := fixedPod(id, 1*cpu, 1*gib)
+			p.VirtualMachine = util.NamespacedName{Namespace: p.Namespace, Name: fmt.Sprintf("vm-%d", id)}
+			return p
+		}
+		node.AddPod(vmPod(5))
+
+		// Removing non-VM pods doesn't help with the VM limit, so victims are picked until the
+		// other VM is one of them.
+		victims, found := node.PreemptionVictims(vmPod(4), []types.UID{podUID(3), podUID(5)}, 0, fits)
+		assert.True(t, found)
+		assert.Equal(t, []types.UID{podUID(3), podUID(5)}, victims)
+	})
+}
+
 func TestPodReconciling(t *testing.T) {
 	type node struct {
 		cpu vmv1.MilliCPU
@@ -222,17 +459,20 @@ func TestPodReconciling(t *testing.T) {
 			Migratable:    false,
 			AlwaysMigrate: false,
 			Migrating:     false,
+			DedicatedCPU:  false,
 			CPU: state.PodResources[vmv1.MilliCPU]{
 				Reserved:   p.cpu.reserved,
 				Requested:  p.cpu.requested,
 				Factor:     factorCPU,
 				Overcommit: overcommitFactors.cpu,
+				Overhead:   0,
 			},
 			Mem: state.PodResources[api.Bytes]{
 				Reserved:   p.mem.reserved,
 				Requested:  p.mem.requested,
 				Factor:     factorMem,
 				Overcommit: overcommitFactors.mem,
+				Overhead:   0,
 			},
 		}
 	}
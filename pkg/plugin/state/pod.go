@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/samber/lo"
+	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"golang.org/x/exp/constraints"
 
@@ -40,6 +41,15 @@ type Pod struct {
 	// Migrating is true iff there is a VirtualMachineMigration with this pod as the source.
 	Migrating bool
 
+	// DedicatedCPU is true if this Pod is owned by a VirtualMachine with a dedicated CPU class, in
+	// which case its resources are tracked separately from shared VMs on the node.
+	DedicatedCPU bool
+
+	// Standalone is true if this Pod is not owned by a VirtualMachine, but has opted in to
+	// autoscaling (see api.IsStandaloneScalingPod). Its scaling annotations are kept on the Pod
+	// itself, instead of being propagated from a VirtualMachine.
+	Standalone bool
+
 	CPU PodResources[vmv1.MilliCPU]
 	Mem PodResources[api.Bytes]
 }
@@ -57,6 +67,10 @@ func (p Pod) MarshalLogObject(enc zapcore.ObjectEncoder) error {
 		enc.AddBool("Migratable", p.Migratable)
 		enc.AddBool("AlwaysMigrate", p.AlwaysMigrate)
 		enc.AddBool("Migrating", p.Migrating)
+		enc.AddBool("DedicatedCPU", p.DedicatedCPU)
+	}
+	if p.Standalone {
+		enc.AddBool("Standalone", p.Standalone)
 	}
 	if err := enc.AddReflected("CPU", p.CPU); err != nil {
 		return err
@@ -102,11 +116,19 @@ type PodResources[T constraints.Unsigned] struct {
 	//
 	// For pods that aren't VMs, this should be set to 1.
 	Overcommit *resource.Quantity
+
+	// Overhead is the fixed amount of T reserved for the pod in addition to Reserved, from the
+	// pod's .spec.overhead (which is typically set from its RuntimeClass).
+	//
+	// Overhead is not scaled, and overcommit is not applied to it.
+	Overhead T
 }
 
 func PodStateFromK8sObj(pod *corev1.Pod) (Pod, error) {
 	if vmRef, ok := vmv1.VirtualMachineOwnerForPod(pod); ok {
 		return podStateForVMRunner(pod, vmRef)
+	} else if api.IsStandaloneScalingPod(pod) {
+		return podStateForStandalonePod(pod)
 	} else {
 		return podStateForNormalPod(pod), nil
 	}
@@ -114,17 +136,9 @@ func PodStateFromK8sObj(pod *corev1.Pod) (Pod, error) {
 
 func podStateForNormalPod(pod *corev1.Pod) Pod {
 	// this pod is *not* a VM runner pod -- we should use the standard kubernetes resources.
-
-	var cpu vmv1.MilliCPU
-	var mem api.Bytes
-	for _, container := range pod.Spec.Containers {
-		// For each resource, add the requests, if they're provided.
-		//
-		// NB: .Cpu()/.Memory() return a pointer to a value equal to zero if the resource is not
-		// present. So we can just add it either way.
-		cpu += vmv1.MilliCPUFromResourceQuantity(*container.Resources.Requests.Cpu())
-		mem += api.BytesFromResourceQuantity(*container.Resources.Requests.Memory())
-	}
+	requests := api.PodRequestedResources(pod)
+	cpu, mem := requests.VCPU, requests.Mem
+	overhead := api.PodOverhead(pod)
 
 	return Pod{
 		NamespacedName: util.GetNamespacedName(pod),
@@ -135,18 +149,22 @@ func podStateForNormalPod(pod *corev1.Pod) Pod {
 		Migratable:     false,
 		AlwaysMigrate:  false,
 		Migrating:      false,
+		DedicatedCPU:   false,
+		Standalone:     false,
 
 		CPU: PodResources[vmv1.MilliCPU]{
 			Reserved:   cpu,
 			Requested:  cpu,
 			Factor:     0,
 			Overcommit: resource.NewMilliQuantity(1000, resource.DecimalSI), // 1000m = 1.0 = "no overcommit"
+			Overhead:   overhead.VCPU,
 		},
 		Mem: PodResources[api.Bytes]{
 			Reserved:   mem,
 			Requested:  mem,
 			Factor:     0,
 			Overcommit: resource.NewMilliQuantity(1000, resource.DecimalSI), // 1000m = 1.0 = "no overcommit"
+			Overhead:   overhead.Mem,
 		},
 	}
 }
@@ -175,7 +193,7 @@ func podStateForVMRunner(pod *corev1.Pod, vmRef metav1.OwnerReference) (Pod, err
 
 	actualResources := &api.Resources{
 		VCPU: res.CPUs.Use,
-		Mem:  api.BytesFromResourceQuantity(res.MemorySlotSize) * api.Bytes(res.MemorySlots.Use),
+		Mem:  api.MemoryForSlots(res.MemorySlotSize, res.MemorySlots.Use),
 	}
 
 	overcommit, err := vmv1.VirtualMachineOvercommitFromPod(pod)
@@ -183,43 +201,37 @@ func podStateForVMRunner(pod *corev1.Pod, vmRef metav1.OwnerReference) (Pod, err
 		return lo.Empty[Pod](), err
 	}
 
-	var scalingUnit, requested, approved *api.Resources
-
-	if !autoscalable {
-		approved = actualResources
-		requested = actualResources
-	} else {
-		scalingUnit, err = api.ExtractScalingUnit(pod)
-		if err != nil {
-			return lo.Empty[Pod](), err
-		}
+	cpuClass, err := vmv1.VirtualMachineCPUClassFromPod(pod)
+	if err != nil {
+		return lo.Empty[Pod](), err
+	}
 
-		requested, err = api.ExtractRequestedScaling(pod)
-		if err != nil {
-			return lo.Empty[Pod](), err
-		} else if requested == nil {
-			requested = actualResources
-		} else {
-			// We cannot have requested scaling but no scaling unit -- disallow that here.
-			if scalingUnit == nil {
-				return lo.Empty[Pod](), errors.New("Pod has requested scaling but no scaling unit annotation")
-			}
-		}
+	overhead := api.PodOverhead(pod)
 
-		approved, err = api.ExtractApprovedScaling(pod)
+	scalingUnit, requested, approved := &api.Resources{VCPU: 0, Mem: 0}, actualResources, actualResources
+	if autoscalable {
+		scalingUnit, requested, approved, err = extractScalingAnnotations(pod, actualResources)
 		if err != nil {
 			return lo.Empty[Pod](), err
-		} else if approved == nil {
-			approved = actualResources
 		}
 	}
 
-	if scalingUnit == nil {
-		// default the scaling unit to zero; if we got here, it's not needed.
-		scalingUnit = &api.Resources{
-			VCPU: 0,
-			Mem:  0,
-		}
+	cpu := PodResources[vmv1.MilliCPU]{
+		Reserved:   approved.VCPU,
+		Requested:  requested.VCPU,
+		Factor:     scalingUnit.VCPU,
+		Overcommit: overcommitFromOptionalQuantity(lo.FromPtr(overcommit).CPU),
+		Overhead:   overhead.VCPU,
+	}
+	dedicated := cpuClass == vmv1.CPUClassDedicated
+	if dedicated {
+		// Runner pods for dedicated VMs request whole cores for .spec.guest.cpus.max, regardless
+		// of how many the VM is using, and pinned cores can't be overcommitted.
+		maxCPU := vmv1.MilliCPU(res.CPUs.Max.RoundedUp() * 1000)
+		cpu.Reserved = maxCPU
+		cpu.Requested = maxCPU
+		cpu.Factor = 0
+		cpu.Overcommit = overcommitFromOptionalQuantity(nil)
 	}
 
 	return Pod{
@@ -231,18 +243,16 @@ func podStateForVMRunner(pod *corev1.Pod, vmRef metav1.OwnerReference) (Pod, err
 		Migratable:     migratable,
 		AlwaysMigrate:  alwaysMigrate,
 		Migrating:      migrating,
+		DedicatedCPU:   dedicated,
+		Standalone:     false,
 
-		CPU: PodResources[vmv1.MilliCPU]{
-			Reserved:   approved.VCPU,
-			Requested:  requested.VCPU,
-			Factor:     scalingUnit.VCPU,
-			Overcommit: overcommitFromOptionalQuantity(lo.FromPtr(overcommit).CPU),
-		},
+		CPU: cpu,
 		Mem: PodResources[api.Bytes]{
 			Reserved:   approved.Mem,
 			Requested:  requested.Mem,
 			Factor:     scalingUnit.Mem,
 			Overcommit: overcommitFromOptionalQuantity(lo.FromPtr(overcommit).Memory),
+			Overhead:   overhead.Mem,
 		},
 	}, nil
 }
@@ -264,3 +274,93 @@ func (p Pod) BetterMigrationTargetThan(other Pod) int {
 	// re-migrating the same VMs.
 	return p.CreatedAt.Compare(other.CreatedAt)
 }
+
+func podStateForStandalonePod(pod *corev1.Pod) (Pod, error) {
+	// this pod is a standalone pod with autoscaling enabled -- the current resources are given by
+	// the standard kubernetes resources, but we otherwise handle it like an autoscaling VM.
+	//
+	// Unlike VMs, there's no webhook validating the scaling bounds and unit of standalone pods, so
+	// we check them here, to avoid reserving resources for a pod that can't be scaled.
+	// The logger is only used to warn about memory that isn't a multiple of the scaling unit,
+	// which the autoscaler-agent handling the pod already reports.
+	if _, err := api.ExtractPodScalingInfo(zap.NewNop(), pod); err != nil {
+		return lo.Empty[Pod](), err
+	}
+
+	actualResources := lo.ToPtr(api.PodRequestedResources(pod))
+	overhead := api.PodOverhead(pod)
+
+	scalingUnit, requested, approved, err := extractScalingAnnotations(pod, actualResources)
+	if err != nil {
+		return lo.Empty[Pod](), err
+	}
+
+	return Pod{
+		NamespacedName: util.GetNamespacedName(pod),
+		UID:            pod.UID,
+		CreatedAt:      pod.CreationTimestamp.Time,
+
+		VirtualMachine: lo.Empty[util.NamespacedName](),
+		Migratable:     false,
+		AlwaysMigrate:  false,
+		Migrating:      false,
+		DedicatedCPU:   false,
+		Standalone:     true,
+
+		CPU: PodResources[vmv1.MilliCPU]{
+			Reserved:   approved.VCPU,
+			Requested:  requested.VCPU,
+			Factor:     scalingUnit.VCPU,
+			Overcommit: resource.NewMilliQuantity(1000, resource.DecimalSI), // 1000m = 1.0 = "no overcommit"
+			Overhead:   overhead.VCPU,
+		},
+		Mem: PodResources[api.Bytes]{
+			Reserved:   approved.Mem,
+			Requested:  requested.Mem,
+			Factor:     scalingUnit.Mem,
+			Overcommit: resource.NewMilliQuantity(1000, resource.DecimalSI), // 1000m = 1.0 = "no overcommit"
+			Overhead:   overhead.Mem,
+		},
+	}, nil
+}
+
+// extractScalingAnnotations returns the scaling unit, requested, and approved resources for a pod
+// with autoscaling enabled, defaulting to the pod's actual resources if they haven't been set.
+func extractScalingAnnotations(
+	pod *corev1.Pod,
+	actualResources *api.Resources,
+) (scalingUnit, requested, approved *api.Resources, _ error) {
+	scalingUnit, err := api.ExtractScalingUnit(pod)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	requested, err = api.ExtractRequestedScaling(pod)
+	if err != nil {
+		return nil, nil, nil, err
+	} else if requested == nil {
+		requested = actualResources
+	} else {
+		// We cannot have requested scaling but no scaling unit -- disallow that here.
+		if scalingUnit == nil {
+			return nil, nil, nil, errors.New("Pod has requested scaling but no scaling unit annotation")
+		}
+	}
+
+	approved, err = api.ExtractApprovedScaling(pod)
+	if err != nil {
+		return nil, nil, nil, err
+	} else if approved == nil {
+		approved = actualResources
+	}
+
+	if scalingUnit == nil {
+		// default the scaling unit to zero; if we got here, it's not needed.
+		scalingUnit = &api.Resources{
+			VCPU: 0,
+			Mem:  0,
+		}
+	}
+
+	return scalingUnit, requested, approved, nil
+}
@@ -35,6 +35,8 @@ func TestPodStateExtraction(t *testing.T) {
 		migratable    bool
 		alwaysMigrate bool
 		migrating     bool
+		dedicatedCPU  bool
+		standalone    bool
 	}
 
 	type overcommitFactors struct {
@@ -95,6 +97,50 @@ func TestPodStateExtraction(t *testing.T) {
 				overcommit: defaultOvercommit,
 			},
 		},
+		{
+			name: "standalone-pod",
+			obj: podObj{
+				labels: map[string]string{
+					"autoscaling.neon.tech/enabled": "true",
+				},
+				annotations: map[string]string{
+					"autoscaling.neon.tech/bounds":                       `{"min":{"cpu":"250m","mem":"256Mi"},"max":{"cpu":2,"mem":"2Gi"}}`,
+					"autoscaling.neon.tech/scaling-unit":                 `{"vCPUs":"250m","mem":"256Mi"}`,
+					"internal.autoscaling.neon.tech/resources-requested": `{"vCPUs":1,"mem":"1Gi"}`,
+					"internal.autoscaling.neon.tech/resources-approved":  `{"vCPUs":"750m","mem":"768Mi"}`,
+				},
+				ownerRefs: nil,
+				containers: []resources{
+					{
+						cpu: vmv1.MilliCPU(500),
+						mem: api.Bytes(512 * mib),
+					},
+				},
+			},
+			extracted: extractedPod{
+				vm: nil,
+				flags: &flags{
+					migratable:    false,
+					alwaysMigrate: false,
+					migrating:     false,
+					dedicatedCPU:  false,
+					standalone:    true,
+				},
+				reserved: resources{
+					cpu: vmv1.MilliCPU(750),
+					mem: api.Bytes(768 * mib),
+				},
+				requested: &resources{
+					cpu: vmv1.MilliCPU(1000),
+					mem: api.Bytes(1024 * mib),
+				},
+				factor: &resources{
+					cpu: vmv1.MilliCPU(250),
+					mem: api.Bytes(256 * mib),
+				},
+				overcommit: defaultOvercommit,
+			},
+		},
 		{
 			name: "external-vm",
 			obj: podObj{
@@ -612,6 +658,109 @@ func TestPodStateExtraction(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "shared-cpu-class",
+			obj: podObj{
+				labels: map[string]string{
+					"autoscaling.neon.tech/enabled": "true",
+					"vm.neon.tech/cpu-class":        "shared",
+				},
+				annotations: map[string]string{
+					"vm.neon.tech/resources": `{
+						"cpus": { "min": "500m", "use": "1000m", "max": "1500m" },
+						"memorySlots": { "min": 1, "use": 2, "max": 3 },
+						"memorySlotSize": "1Gi"
+					}`,
+					"autoscaling.neon.tech/scaling-unit":                 `{"vCPUs":"250m","mem":"256Mi"}`,
+					"internal.autoscaling.neon.tech/resources-requested": `{"vCPUs":"750m","mem":"2Gi"}`,
+					"internal.autoscaling.neon.tech/resources-approved":  `{"vCPUs":"750m","mem":"2Gi"}`,
+				},
+				ownerRefs: []metav1.OwnerReference{{
+					APIVersion:         "vm.neon.tech/v1",
+					Kind:               "VirtualMachine",
+					Name:               "vm-name",
+					UID:                "vm-uid",
+					Controller:         lo.ToPtr(true),
+					BlockOwnerDeletion: nil,
+				}},
+				containers: nil,
+			},
+			extracted: extractedPod{
+				vm: &util.NamespacedName{
+					Name:      "vm-name",
+					Namespace: "test-namespace",
+				},
+				flags: &flags{
+					migratable:    false,
+					alwaysMigrate: false,
+					migrating:     false,
+					dedicatedCPU:  false,
+					standalone:    false,
+				},
+				reserved: resources{
+					cpu: vmv1.MilliCPU(750),
+					mem: api.Bytes(2048 * mib),
+				},
+				requested: nil,
+				factor: &resources{
+					cpu: vmv1.MilliCPU(250),
+					mem: api.Bytes(256 * mib),
+				},
+				overcommit: defaultOvercommit,
+			},
+		},
+		{
+			name: "dedicated-cpu-class",
+			obj: podObj{
+				labels: map[string]string{
+					"autoscaling.neon.tech/enabled": "true",
+					"vm.neon.tech/cpu-class":        "dedicated",
+				},
+				annotations: map[string]string{
+					"vm.neon.tech/resources": `{
+						"cpus": { "min": "500m", "use": "1000m", "max": "1500m" },
+						"memorySlots": { "min": 1, "use": 2, "max": 3 },
+						"memorySlotSize": "1Gi"
+					}`,
+					"autoscaling.neon.tech/scaling-unit":                 `{"vCPUs":"250m","mem":"256Mi"}`,
+					"internal.autoscaling.neon.tech/resources-requested": `{"vCPUs":"750m","mem":"2Gi"}`,
+					"internal.autoscaling.neon.tech/resources-approved":  `{"vCPUs":"750m","mem":"2Gi"}`,
+				},
+				ownerRefs: []metav1.OwnerReference{{
+					APIVersion:         "vm.neon.tech/v1",
+					Kind:               "VirtualMachine",
+					Name:               "vm-name",
+					UID:                "vm-uid",
+					Controller:         lo.ToPtr(true),
+					BlockOwnerDeletion: nil,
+				}},
+				containers: nil,
+			},
+			extracted: extractedPod{
+				vm: &util.NamespacedName{
+					Name:      "vm-name",
+					Namespace: "test-namespace",
+				},
+				flags: &flags{
+					migratable:    false,
+					alwaysMigrate: false,
+					migrating:     false,
+					dedicatedCPU:  true,
+					standalone:    false,
+				},
+				reserved: resources{
+					// whole cores for cpus.max, like the runner pod requests
+					cpu: vmv1.MilliCPU(2000),
+					mem: api.Bytes(2048 * mib),
+				},
+				requested: nil,
+				factor: &resources{
+					cpu: vmv1.MilliCPU(0),
+					mem: api.Bytes(256 * mib),
+				},
+				overcommit: defaultOvercommit,
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -657,17 +806,21 @@ func TestPodStateExtraction(t *testing.T) {
 				Migratable:     lo.FromPtr(c.extracted.flags).migratable,
 				AlwaysMigrate:  lo.FromPtr(c.extracted.flags).alwaysMigrate,
 				Migrating:      lo.FromPtr(c.extracted.flags).migrating,
+				DedicatedCPU:   lo.FromPtr(c.extracted.flags).dedicatedCPU,
+				Standalone:     lo.FromPtr(c.extracted.flags).standalone,
 				CPU: state.PodResources[vmv1.MilliCPU]{
 					Reserved:   c.extracted.reserved.cpu,
 					Requested:  lo.FromPtrOr(c.extracted.requested, c.extracted.reserved).cpu,
 					Factor:     lo.FromPtr(c.extracted.factor).cpu,
 					Overcommit: c.extracted.overcommit.cpu,
+					Overhead:   0,
 				},
 				Mem: state.PodResources[api.Bytes]{
 					Reserved:   c.extracted.reserved.mem,
 					Requested:  lo.FromPtrOr(c.extracted.requested, c.extracted.reserved).mem,
 					Factor:     lo.FromPtr(c.extracted.factor).mem,
 					Overcommit: c.extracted.overcommit.mem,
+					Overhead:   0,
 				},
 			}
 
@@ -688,3 +841,90 @@ func TestPodStateExtraction(t *testing.T) {
 		})
 	}
 }
+
+func TestPodOverheadExtraction(t *testing.T) {
+	vmPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod-name",
+			Namespace: "test-namespace",
+			UID:       "pod-uid",
+			Annotations: map[string]string{
+				"vm.neon.tech/resources": `{
+					"cpus": { "min": "500m", "use": "1000m", "max": "1500m" },
+					"memorySlots": { "min": 1, "use": 2, "max": 3 },
+					"memorySlotSize": "1Gi"
+				}`,
+			},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion:         "vm.neon.tech/v1",
+				Kind:               "VirtualMachine",
+				Name:               "vm-name",
+				UID:                "vm-uid",
+				Controller:         lo.ToPtr(true),
+				BlockOwnerDeletion: nil,
+			}},
+		},
+		Spec: corev1.PodSpec{
+			Overhead: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("250m"),
+				corev1.ResourceMemory: resource.MustParse("128Mi"),
+			},
+		},
+	}
+	normalPod := vmPod.DeepCopy()
+	normalPod.Annotations = nil
+	normalPod.OwnerReferences = nil
+
+	for _, obj := range []*corev1.Pod{vmPod, normalPod} {
+		pod, err := state.PodStateFromK8sObj(obj)
+		if err != nil {
+			t.Error("failed to extract pod state: ", err.Error())
+			return
+		}
+		assert.Equal(t, vmv1.MilliCPU(250), pod.CPU.Overhead)
+		assert.Equal(t, api.Bytes(128*1024*1024), pod.Mem.Overhead)
+	}
+
+	// VM resources don't include the overhead
+	pod, err := state.PodStateFromK8sObj(vmPod)
+	assert.NoError(t, err)
+	assert.Equal(t, vmv1.MilliCPU(1000), pod.CPU.Reserved)
+}
+
+func TestStandalonePodInvalidScalingInfo(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod-name",
+			Namespace: "test-namespace",
+			Labels: map[string]string{
+				"autoscaling.neon.tech/enabled": "true",
+			},
+			Annotations: map[string]string{
+				"autoscaling.neon.tech/bounds": `{"min":{"cpu":"250m","mem":"256Mi"},"max":{"cpu":2,"mem":"2Gi"}}`,
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: "container-0",
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("500m"),
+						corev1.ResourceMemory: resource.MustParse("512Mi"),
+					},
+				},
+			}},
+		},
+	}
+
+	// The scaling unit is required for standalone pods
+	_, err := state.PodStateFromK8sObj(pod)
+	assert.ErrorContains(t, err, `missing annotation "autoscaling.neon.tech/scaling-unit"`)
+
+	pod.Annotations["autoscaling.neon.tech/scaling-unit"] = `{"vCPUs":"250m","mem":"256Mi"}`
+	_, err = state.PodStateFromK8sObj(pod)
+	assert.NoError(t, err)
+
+	pod.Annotations["autoscaling.neon.tech/bounds"] = `{"min":{"cpu":2,"mem":"256Mi"},"max":{"cpu":1,"mem":"2Gi"}}`
+	_, err = state.PodStateFromK8sObj(pod)
+	assert.Error(t, err)
+}
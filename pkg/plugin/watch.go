@@ -11,6 +11,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	coreclient "k8s.io/client-go/kubernetes"
 
@@ -64,8 +65,8 @@ func watchConfig[T any](metrics watch.Metrics) watch.Config {
 			Instance: fmt.Sprint(kind, "s"),
 		},
 		// FIXME: make these configurable.
-		RetryRelistAfter: util.NewTimeRange(time.Second, 3, 5),
-		RetryWatchAfter:  util.NewTimeRange(time.Second, 3, 5),
+		RetryRelistAfter: util.NewTimeRange(time.Second, 3, 5, util.WithBackoff(2, 60)),
+		RetryWatchAfter:  util.NewTimeRange(time.Second, 3, 5, util.WithBackoff(2, 60)),
 	}
 }
 
@@ -95,8 +96,16 @@ func watchPodEvents(
 	parentLogger *zap.Logger,
 	client coreclient.Interface,
 	metrics watch.Metrics,
+	excludedNamespaces []string,
 	callbacks watch.HandlerFuncs[*corev1.Pod],
 ) (*watch.Store[corev1.Pod], error) {
+	// Filter out excluded namespaces on the server side, so that we don't need to store them.
+	var selectors []fields.Selector
+	for _, ns := range excludedNamespaces {
+		selectors = append(selectors, fields.OneTermNotEqualSelector("metadata.namespace", ns))
+	}
+	fieldSelector := fields.AndSelectors(selectors...).String()
+
 	return watch.Watch(
 		ctx,
 		parentLogger.Named("watch-pods"),
@@ -106,7 +115,7 @@ func watchPodEvents(
 			Items: func(list *corev1.PodList) []corev1.Pod { return list.Items },
 		},
 		watch.InitModeSync,
-		metav1.ListOptions{},
+		metav1.ListOptions{FieldSelector: fieldSelector},
 		callbacks,
 	)
 }
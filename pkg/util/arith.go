@@ -25,6 +25,11 @@ func AbsDiff[T constraints.Unsigned](x, y T) T {
 	}
 }
 
+// DivCeil returns x / y, rounded up. y must be non-zero.
+func DivCeil[T constraints.Unsigned](x, y T) T {
+	return (x + y - 1) / y
+}
+
 // AtomicInt represents the shared interface provided by various atomic.<NAME> integers
 //
 // This interface type is primarily used by AtomicMax.
@@ -2,53 +2,94 @@ package util
 
 // A channel-based sync.Cond-like interface, with support for broadcast operations (but some
 // additional restrictions). Refer to the documentation of Wait for detailed usage.
+//
+// BroadcastValue[T] extends this to a versioned value, so that receivers can fetch the latest value
+// at the same time as marking the change as received. Broadcaster is the special case with no
+// value.
 
 import (
+	"context"
 	"sync"
 )
 
-func NewBroadcaster() *Broadcaster {
-	return &Broadcaster{
-		mu:   sync.Mutex{},
-		ch:   make(chan struct{}),
-		sent: 0,
-	}
-}
-
-type Broadcaster struct {
+// BroadcastValue is a value that can be watched for changes by any number of receivers.
+//
+// Each call to Store or Update replaces the value and notifies all receivers. Receivers that
+// haven't yet observed a change will only be notified once, no matter how many changes are made in
+// the meantime -- they are expected to fetch the latest value instead.
+type BroadcastValue[T any] struct {
 	mu sync.Mutex
 	ch chan struct{}
 
-	sent uint64
+	value   T
+	version uint64
 }
 
-type BroadcastReceiver struct {
-	b *Broadcaster
+// ValueReceiver tracks which version of a BroadcastValue has been observed, so that it can wait
+// for changes after that.
+type ValueReceiver[T any] struct {
+	b *BroadcastValue[T]
 
 	viewed uint64
 }
 
-// Broadcast sends a signal to all receivers
-func (b *Broadcaster) Broadcast() {
+// NewBroadcastValue creates a new BroadcastValue with the initial value
+func NewBroadcastValue[T any](initial T) *BroadcastValue[T] {
+	return &BroadcastValue[T]{
+		mu:      sync.Mutex{},
+		ch:      make(chan struct{}),
+		value:   initial,
+		version: 0,
+	}
+}
+
+// Load returns the current value
+func (b *BroadcastValue[T]) Load() T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.value
+}
+
+// Store replaces the value, notifying all receivers
+func (b *BroadcastValue[T]) Store(value T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.storeLocked(value)
+}
+
+// Update atomically replaces the value with the result of calling modify on the current value,
+// notifying all receivers. It returns the new value.
+//
+// modify is called while holding the BroadcastValue's lock, so it must not call any other methods
+// on the BroadcastValue or its receivers.
+func (b *BroadcastValue[T]) Update(modify func(T) T) T {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	b.storeLocked(modify(b.value))
+	return b.value
+}
+
+func (b *BroadcastValue[T]) storeLocked(value T) {
+	b.value = value
 	close(b.ch)
 	b.ch = make(chan struct{})
-	b.sent += 1
+	b.version += 1
 }
 
-// NewReceiver creates a new BroadcastReceiver that will receive only future broadcasted events.
+// NewReceiver creates a new ValueReceiver that will receive only future changes to the value.
 //
-// It's generally not recommended to call (*BroadcastReceiver).Wait() on a single BroadcastReceiver
-// from more than one thread at a time, although it *is* thread-safe.
-func (b *Broadcaster) NewReceiver() BroadcastReceiver {
+// It's generally not recommended to call (*ValueReceiver).Wait() on a single ValueReceiver from
+// more than one thread at a time, although it *is* thread-safe.
+func (b *BroadcastValue[T]) NewReceiver() ValueReceiver[T] {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	return BroadcastReceiver{
+	return ValueReceiver[T]{
 		b:      b,
-		viewed: b.sent,
+		viewed: b.version,
 	}
 }
 
@@ -58,8 +99,8 @@ var closedChannel = func() <-chan struct{} {
 	return ch
 }()
 
-// Wait returns a channel that will be closed once there has been an event broadcasted since
-// the BroadcastReceiver was created, or the last call to Awake().
+// Wait returns a channel that will be closed once the value has changed since the ValueReceiver
+// was created, or the last call to Awake().
 //
 // Typical usage of Wait will involve selecting on the channel returned and calling Awake
 // immediately in the branch handling the event, for example:
@@ -68,25 +109,107 @@ var closedChannel = func() <-chan struct{} {
 //	case <-ctx.Done():
 //	    return
 //	case <-receiver.Wait():
-//	    receiver.Awake()
+//	    value := receiver.Awake()
 //	    ...
 //	}
-func (r *BroadcastReceiver) Wait() <-chan struct{} {
+func (r *ValueReceiver[T]) Wait() <-chan struct{} {
 	r.b.mu.Lock()
 	defer r.b.mu.Unlock()
 
-	if r.b.sent == r.viewed {
+	if r.b.version == r.viewed {
 		return r.b.ch
 	} else {
 		return closedChannel
 	}
 }
 
-// Awake marks the most recent broadcast event as received, so that the next call to Wait returns a
-// channel that will only be closed once there's been a new event after this call to Awake.
-func (r *BroadcastReceiver) Awake() {
+// Awake marks the current value as received, so that the next call to Wait returns a channel that
+// will only be closed once the value changes after this call to Awake.
+//
+// Awake returns the current value. Because this is done atomically with marking it as received,
+// there is no chance of missing a change that happens between the two.
+func (r *ValueReceiver[T]) Awake() T {
 	r.b.mu.Lock()
 	defer r.b.mu.Unlock()
 
-	r.viewed = r.b.sent
+	r.viewed = r.b.version
+	return r.b.value
+}
+
+// WaitFor waits until the value satisfies cond, returning that value and marking it as received.
+//
+// cond is first called with the current value, and then again after each change, until it returns
+// true or the context is canceled. If the context is canceled first, WaitFor returns the context's
+// error.
+//
+// Like with Update, cond is called while holding the BroadcastValue's lock, so it must not call
+// any other methods on the BroadcastValue or its receivers.
+func (r *ValueReceiver[T]) WaitFor(ctx context.Context, cond func(T) bool) (T, error) {
+	for {
+		// Check the value and fetch the channel for the next change together, so that a change in
+		// between can't be missed.
+		r.b.mu.Lock()
+		value := r.b.value
+		ok := cond(value)
+		ch := r.b.ch
+		r.viewed = r.b.version
+		r.b.mu.Unlock()
+
+		if ok {
+			return value, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		case <-ch:
+		}
+	}
+}
+
+// Broadcaster is a BroadcastValue with no value, so it only notifies receivers that *something*
+// has happened.
+type Broadcaster struct {
+	b *BroadcastValue[struct{}]
+}
+
+// BroadcastReceiver is the ValueReceiver for a Broadcaster
+type BroadcastReceiver struct {
+	r ValueReceiver[struct{}]
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		b: NewBroadcastValue(struct{}{}),
+	}
+}
+
+// Broadcast sends a signal to all receivers
+func (b *Broadcaster) Broadcast() {
+	b.b.Store(struct{}{})
+}
+
+// NewReceiver creates a new BroadcastReceiver that will receive only future broadcasted events.
+//
+// It's generally not recommended to call (*BroadcastReceiver).Wait() on a single BroadcastReceiver
+// from more than one thread at a time, although it *is* thread-safe.
+func (b *Broadcaster) NewReceiver() BroadcastReceiver {
+	return BroadcastReceiver{
+		r: b.b.NewReceiver(),
+	}
+}
+
+// Wait returns a channel that will be closed once there has been an event broadcasted since
+// the BroadcastReceiver was created, or the last call to Awake().
+//
+// Usage is the same as (*ValueReceiver).Wait.
+func (r *BroadcastReceiver) Wait() <-chan struct{} {
+	return r.r.Wait()
+}
+
+// Awake marks the most recent broadcast event as received, so that the next call to Wait returns a
+// channel that will only be closed once there's been a new event after this call to Awake.
+func (r *BroadcastReceiver) Awake() {
+	r.r.Awake()
 }
@@ -1,7 +1,9 @@
 package util_test
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -57,3 +59,48 @@ func TestBroadcast(t *testing.T) {
 	receiver.Awake()
 	require.False(t, closed(receiver.Wait()))
 }
+
+func TestBroadcastValue(t *testing.T) {
+	value := util.NewBroadcastValue(1)
+
+	receiver := value.NewReceiver()
+	require.False(t, closed(receiver.Wait()))
+	require.Equal(t, 1, receiver.Awake())
+
+	// Multiple changes should be collapsed into one, with Awake returning the latest value
+	value.Store(2)
+	require.Equal(t, 3, value.Update(func(x int) int { return x + 1 }))
+	require.True(t, closed(receiver.Wait()))
+	require.Equal(t, 3, receiver.Awake())
+	require.False(t, closed(receiver.Wait()))
+	require.Equal(t, 3, value.Load())
+}
+
+func TestBroadcastValueWaitFor(t *testing.T) {
+	value := util.NewBroadcastValue(0)
+	receiver := value.NewReceiver()
+
+	// Already satisfied: returns immediately
+	got, err := receiver.WaitFor(context.Background(), func(x int) bool { return x == 0 })
+	require.NoError(t, err)
+	require.Equal(t, 0, got)
+
+	// Satisfied only after several changes
+	go func() {
+		for i := 1; i <= 5; i++ {
+			time.Sleep(time.Millisecond)
+			value.Store(i)
+		}
+	}()
+	got, err = receiver.WaitFor(context.Background(), func(x int) bool { return x >= 5 })
+	require.NoError(t, err)
+	require.Equal(t, 5, got)
+	// ... and WaitFor marks the value as received
+	require.False(t, closed(receiver.Wait()))
+
+	// Never satisfied: returns the context's error
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = receiver.WaitFor(ctx, func(x int) bool { return x < 0 })
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,74 @@
+package util
+
+// Wall-clock profiling with github.com/felixge/fgprof, which periodically samples the stacks of all
+// goroutines, regardless of whether they're running, so that time spent waiting on I/O, locks, or
+// channels is visible alongside time spent on-CPU.
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/felixge/fgprof"
+)
+
+const (
+	// defaultWallClockProfileSeconds is the duration of the profile if not given in the request,
+	// matching the default for /debug/pprof/profile.
+	defaultWallClockProfileSeconds = 30
+)
+
+// wallClockProfileHandler returns the handler for /debug/fgprof.
+//
+// This is like fgprof.Handler, but with stricter checks on the parameters, and it stops the
+// profile early if the request is canceled.
+//
+// The handler accepts the query parameters 'seconds' (default 30) and 'format', which may be
+// 'pprof' (the default) or 'folded' for folded stacks, as used by flame graph tools.
+func wallClockProfileHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seconds := defaultWallClockProfileSeconds
+		if s := r.URL.Query().Get("seconds"); s != "" {
+			var err error
+			seconds, err = strconv.Atoi(s)
+			if err != nil || seconds <= 0 {
+				http.Error(w, fmt.Sprintf("invalid 'seconds' %q", s), http.StatusBadRequest)
+				return
+			}
+		}
+		// Like net/http/pprof, reject profiles that would outlive the server's write timeout.
+		if srv, ok := r.Context().Value(http.ServerContextKey).(*http.Server); ok && srv.WriteTimeout != 0 {
+			if time.Duration(seconds)*time.Second >= srv.WriteTimeout {
+				http.Error(w, "profile duration exceeds server's WriteTimeout", http.StatusBadRequest)
+				return
+			}
+		}
+
+		format := fgprof.Format(r.URL.Query().Get("format"))
+		if format == "" {
+			format = fgprof.FormatPprof
+		}
+		if format != fgprof.FormatPprof && format != fgprof.FormatFolded {
+			http.Error(w, fmt.Sprintf("unknown 'format' %q", format), http.StatusBadRequest)
+			return
+		}
+
+		switch format {
+		case fgprof.FormatPprof:
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", `attachment; filename="fgprof"`)
+		case fgprof.FormatFolded:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+
+		stop := fgprof.Start(w, format)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Duration(seconds) * time.Second):
+		}
+		if err := stop(); err != nil {
+			http.Error(w, fmt.Sprintf("failed to write profile: %s", err), http.StatusInternalServerError)
+		}
+	})
+}
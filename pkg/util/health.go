@@ -0,0 +1,66 @@
+package util
+
+// Helpers for health check endpoints that check more than just whether the process is running.
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// HealthCheck is a single named check for a health endpoint
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// healthCheckTimeout is the maximum duration for each check, so that a hanging dependency causes
+// the check to fail rather than the probe to time out with no information.
+const healthCheckTimeout = 5 * time.Second
+
+// HealthHandler returns an HTTP handler that runs all the checks, responding with 200 if all of
+// them pass and 503 otherwise.
+//
+// Like the Kubernetes API server's own health endpoints, the response body lists each check as
+// "[+]name ok" or "[-]name failed: reason".
+func HealthHandler(checks ...HealthCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body strings.Builder
+		failed := false
+		for _, c := range checks {
+			ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+			err := c.Check(ctx)
+			cancel()
+
+			if err != nil {
+				failed = true
+				fmt.Fprintf(&body, "[-]%s failed: %s\n", c.Name, err)
+			} else {
+				fmt.Fprintf(&body, "[+]%s ok\n", c.Name)
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		if failed {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		_, _ = w.Write([]byte(body.String()))
+	})
+}
+
+// APIServerHealthCheck returns a HealthCheck that passes if the Kubernetes API server is reachable
+// and reports itself as ready.
+func APIServerHealthCheck(client kubernetes.Interface) HealthCheck {
+	return HealthCheck{
+		Name: "api-server",
+		Check: func(ctx context.Context) error {
+			return client.Discovery().RESTClient().Get().AbsPath("/readyz").Do(ctx).Error()
+		},
+	}
+}
@@ -1,22 +1,111 @@
 package util
 
 import (
+	"crypto/subtle"
+	"fmt"
 	"net/http"
 	"net/http/pprof"
+	"os"
+	"runtime"
+	"strings"
 	"time"
 )
 
-func MakePPROF(addr string) *http.Server {
+// DefaultPPROFAddr is the address that the pprof server binds to if not otherwise configured
+const DefaultPPROFAddr = "0.0.0.0:7777"
+
+// PPROFConfig configures the pprof server created by MakePPROF
+type PPROFConfig struct {
+	// Addr is the address that the server binds to, e.g. "0.0.0.0:7777".
+	Addr string `json:"addr"`
+	// MutexProfileFraction sets the fraction of mutex contention events reported in the mutex
+	// profile, as in runtime.SetMutexProfileFraction. Zero disables the mutex profile.
+	MutexProfileFraction int `json:"mutexProfileFraction"`
+	// BlockProfileRate sets the rate of blocking events reported in the block profile, as in
+	// runtime.SetBlockProfileRate. Zero disables the block profile.
+	BlockProfileRate int `json:"blockProfileRate"`
+	// EnableWallClockProfile, if true, serves /debug/fgprof, which samples the stacks of all
+	// goroutines -- whether on- or off-CPU -- for a wall-clock view of where time is spent.
+	//
+	// Sampling all goroutines has a cost proportional to their number, so this is disabled by
+	// default.
+	EnableWallClockProfile bool `json:"enableWallClockProfile"`
+	// BasicAuth, if provided, requires HTTP basic auth for all requests to the server.
+	BasicAuth *PPROFBasicAuth `json:"basicAuth,omitempty"`
+}
+
+// PPROFBasicAuth gives the credentials required to access the pprof server
+type PPROFBasicAuth struct {
+	Username string `json:"username"`
+	// PasswordFile is the path to a file containing the password. Surrounding whitespace is
+	// ignored.
+	PasswordFile string `json:"passwordFile"`
+}
+
+// DefaultPPROFConfig returns the PPROFConfig to use if none is provided: binding to
+// DefaultPPROFAddr, with no optional profiles and no authentication.
+func DefaultPPROFConfig() PPROFConfig {
+	return PPROFConfig{
+		Addr:                   DefaultPPROFAddr,
+		MutexProfileFraction:   0,
+		BlockProfileRate:       0,
+		EnableWallClockProfile: false,
+		BasicAuth:              nil,
+	}
+}
+
+// MakePPROF returns an HTTP server for the pprof endpoints, according to the config.
+//
+// This also sets the process-wide mutex and block profile rates from the config, so it should only
+// be called once.
+func MakePPROF(config PPROFConfig) (*http.Server, error) {
+	runtime.SetMutexProfileFraction(config.MutexProfileFraction)
+	runtime.SetBlockProfileRate(config.BlockProfileRate)
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/debug/pprof/", pprof.Index)
 	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
 	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
 	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	if config.EnableWallClockProfile {
+		mux.Handle("/debug/fgprof", wallClockProfileHandler())
+	}
+
+	var handler http.Handler = mux
+	if config.BasicAuth != nil {
+		if config.BasicAuth.PasswordFile == "" {
+			return nil, fmt.Errorf("pprof basic auth for user %q has no password file", config.BasicAuth.Username)
+		}
+		content, err := os.ReadFile(config.BasicAuth.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pprof basic auth password file: %w", err)
+		}
+		password := strings.TrimSpace(string(content))
+		if password == "" {
+			return nil, fmt.Errorf("pprof basic auth password file %q is empty", config.BasicAuth.PasswordFile)
+		}
+		handler = requireBasicAuth(config.BasicAuth.Username, password, handler)
+	}
 
 	return &http.Server{
-		Addr:              addr,
-		Handler:           mux,
+		Addr:              config.Addr,
+		Handler:           handler,
 		ReadHeaderTimeout: time.Second,
-	}
+	}, nil
+}
+
+func requireBasicAuth(username, password string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, gotPassword, ok := r.BasicAuth()
+		// Compare both, so that timing doesn't reveal which one was wrong.
+		userOk := subtle.ConstantTimeCompare([]byte(gotUser), []byte(username)) == 1
+		passwordOk := subtle.ConstantTimeCompare([]byte(gotPassword), []byte(password)) == 1
+		if !ok || !userOk || !passwordOk {
+			w.Header().Set("WWW-Authenticate", `Basic realm="pprof"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
@@ -0,0 +1,99 @@
+package util
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPPROFBasicAuth(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("hunter2\n"), 0o600))
+
+	config := DefaultPPROFConfig()
+	config.BasicAuth = &PPROFBasicAuth{Username: "admin", PasswordFile: passwordFile}
+	server, err := MakePPROF(config)
+	require.NoError(t, err)
+
+	cases := []struct {
+		name       string
+		user       string
+		password   string
+		noAuth     bool
+		wantStatus int
+	}{
+		{name: "no auth", user: "", password: "", noAuth: true, wantStatus: http.StatusUnauthorized},
+		{name: "wrong user", user: "root", password: "hunter2", noAuth: false, wantStatus: http.StatusUnauthorized},
+		{name: "wrong password", user: "admin", password: "hunter3", noAuth: false, wantStatus: http.StatusUnauthorized},
+		{name: "correct", user: "admin", password: "hunter2", noAuth: false, wantStatus: http.StatusOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/debug/pprof/cmdline", nil)
+			if !c.noAuth {
+				req.SetBasicAuth(c.user, c.password)
+			}
+			rec := httptest.NewRecorder()
+			server.Handler.ServeHTTP(rec, req)
+			assert.Equal(t, c.wantStatus, rec.Code)
+		})
+	}
+
+	// Missing password file should fail at setup, not on each request.
+	config.BasicAuth.PasswordFile = filepath.Join(t.TempDir(), "does-not-exist")
+	_, err = MakePPROF(config)
+	assert.Error(t, err)
+}
+
+func TestWallClockProfile(t *testing.T) {
+	disabled, err := MakePPROF(DefaultPPROFConfig())
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	disabled.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/fgprof?seconds=1", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	config := DefaultPPROFConfig()
+	config.EnableWallClockProfile = true
+	server, err := MakePPROF(config)
+	require.NoError(t, err)
+
+	// Run a goroutine that's blocked for the whole profile, which should show up even though it's
+	// not using CPU.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() { <-stop }()
+
+	t.Run("pprof", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/fgprof?seconds=1", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		prof, err := profile.Parse(bytes.NewReader(rec.Body.Bytes()))
+		require.NoError(t, err)
+		assert.NotEmpty(t, prof.Sample)
+		assert.Equal(t, "wallclock", prof.PeriodType.Type)
+	})
+
+	t.Run("folded", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/fgprof?seconds=1&format=folded", nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.True(t, strings.Contains(rec.Body.String(), "TestWallClockProfile"))
+	})
+
+	t.Run("bad params", func(t *testing.T) {
+		for _, query := range []string{"seconds=0", "seconds=abc", "format=json"} {
+			rec := httptest.NewRecorder()
+			server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/fgprof?"+query, nil))
+			assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		}
+	})
+}
@@ -0,0 +1,213 @@
+package util
+
+// Continuous profiling, by periodically pushing CPU and heap profiles to a Pyroscope-compatible
+// server.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tychoish/fun/srv"
+	"go.uber.org/zap"
+)
+
+// ProfilingConfig configures continuously pushing profiles to a server that implements
+// Pyroscope's /ingest API. Profiles are sent in pprof format.
+type ProfilingConfig struct {
+	// ServerURL is the base URL of the server, e.g. "http://pyroscope:4040".
+	ServerURL string `json:"serverURL"`
+	// ApplicationName is the name that profiles are stored under. The profile type is appended,
+	// e.g. "autoscaler-agent.cpu".
+	ApplicationName string `json:"applicationName"`
+	// Tags are labels added to every profile. A "hostname" tag is always added.
+	Tags map[string]string `json:"tags"`
+	// UploadIntervalSeconds is the duration, in seconds, covered by each CPU profile, and so also
+	// how often profiles are pushed.
+	UploadIntervalSeconds uint `json:"uploadIntervalSeconds"`
+	// CPUSampleRate is the frequency, in Hz, at which CPU samples are taken. If zero, Go's default
+	// of 100 is used.
+	CPUSampleRate int `json:"cpuSampleRate"`
+}
+
+// defaultCPUSampleRate is the rate used by pprof.StartCPUProfile
+const defaultCPUSampleRate = 100
+
+// ProfilePusher returns a service that pushes profiles according to the config until its context
+// is canceled.
+//
+// Only one CPU profile can be collected at a time, so while the pusher is running, requests to
+// the pprof endpoint for CPU profiles will fail (and vice versa: intervals where the pprof endpoint
+// is in use will be skipped).
+func ProfilePusher(logger *zap.Logger, cfg ProfilingConfig) *srv.Service {
+	logger = logger.Named("profile-pusher")
+
+	return &srv.Service{
+		Name: "profile-pusher",
+		Run: func(ctx context.Context) error {
+			p, err := newProfilePusher(cfg)
+			if err != nil {
+				return err
+			}
+			logger.Info("Starting profile pusher", zap.String("server", cfg.ServerURL))
+			p.run(ctx, logger)
+			return nil
+		},
+		Shutdown: nil,
+		Cleanup:  nil,
+	}
+}
+
+type profilePusher struct {
+	cfg      ProfilingConfig
+	interval time.Duration
+	ingest   *url.URL
+	tags     string
+	client   *http.Client
+}
+
+func newProfilePusher(cfg ProfilingConfig) (*profilePusher, error) {
+	if cfg.UploadIntervalSeconds == 0 {
+		return nil, fmt.Errorf("profiling upload interval cannot be zero")
+	}
+	ingest, err := url.Parse(cfg.ServerURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profiling server URL: %w", err)
+	}
+	ingest = ingest.JoinPath("ingest")
+
+	tags := maps.Clone(cfg.Tags)
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		tags["hostname"] = hostname
+	}
+	var tagPairs []string
+	for _, k := range slices.Sorted(maps.Keys(tags)) {
+		tagPairs = append(tagPairs, fmt.Sprintf("%s=%s", k, tags[k]))
+	}
+
+	return &profilePusher{
+		cfg:      cfg,
+		interval: time.Second * time.Duration(cfg.UploadIntervalSeconds),
+		ingest:   ingest,
+		tags:     "{" + strings.Join(tagPairs, ",") + "}",
+		client:   &http.Client{Timeout: 10 * time.Second}, //nolint:exhaustruct // only the timeout is set
+	}, nil
+}
+
+func (p *profilePusher) run(ctx context.Context, logger *zap.Logger) {
+	for ctx.Err() == nil {
+		from := time.Now()
+
+		var cpu bytes.Buffer
+		cpuErr := p.startCPUProfile(&cpu)
+		if cpuErr != nil {
+			logger.Warn("Failed to start CPU profile, skipping it for this interval", zap.Error(cpuErr))
+		}
+
+		select {
+		case <-ctx.Done():
+			// We're shutting down, so there's no point trying to push the partial profile.
+			if cpuErr == nil {
+				pprof.StopCPUProfile()
+			}
+			return
+		case <-time.After(p.interval):
+		}
+
+		until := time.Now()
+		if cpuErr == nil {
+			pprof.StopCPUProfile()
+			if err := p.push(ctx, "cpu", &cpu, from, until, p.sampleRate()); err != nil {
+				logger.Warn("Failed to push CPU profile", zap.Error(err))
+			}
+		}
+
+		// Heap profiles are sampled on allocation, so there's no sample rate to report.
+		var heap bytes.Buffer
+		if err := pprof.Lookup("heap").WriteTo(&heap, 0); err != nil {
+			logger.Warn("Failed to collect heap profile", zap.Error(err))
+		} else if err := p.push(ctx, "heap", &heap, from, until, 0); err != nil {
+			logger.Warn("Failed to push heap profile", zap.Error(err))
+		}
+	}
+}
+
+func (p *profilePusher) sampleRate() int {
+	if p.cfg.CPUSampleRate == 0 {
+		return defaultCPUSampleRate
+	}
+	return p.cfg.CPUSampleRate
+}
+
+func (p *profilePusher) startCPUProfile(buf *bytes.Buffer) error {
+	// pprof.StartCPUProfile always tries to set the rate to 100Hz, but keeps the rate if it was
+	// already set (printing a warning to stderr). So to use a different rate, it must be set first.
+	if rate := p.sampleRate(); rate != defaultCPUSampleRate {
+		runtime.SetCPUProfileRate(rate)
+	}
+	return pprof.StartCPUProfile(buf)
+}
+
+func (p *profilePusher) push(
+	ctx context.Context,
+	profileType string,
+	profile *bytes.Buffer,
+	from, until time.Time,
+	sampleRate int,
+) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("profile", "profile.pprof")
+	if err != nil {
+		return fmt.Errorf("failed to create multipart body: %w", err)
+	}
+	if _, err := part.Write(profile.Bytes()); err != nil {
+		return fmt.Errorf("failed to write multipart body: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to finish multipart body: %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("name", fmt.Sprintf("%s.%s%s", p.cfg.ApplicationName, profileType, p.tags))
+	query.Set("from", strconv.FormatInt(from.Unix(), 10))
+	query.Set("until", strconv.FormatInt(until.Unix(), 10))
+	query.Set("format", "pprof")
+	query.Set("spyName", "gospy")
+	if sampleRate != 0 {
+		query.Set("sampleRate", strconv.Itoa(sampleRate))
+	}
+	u := *p.ingest
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), &body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
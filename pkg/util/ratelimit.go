@@ -0,0 +1,189 @@
+package util
+
+// A leaky-bucket rate limiter, with metrics for how often operations are throttled.
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RateLimitConfig gives the limits for a RateLimiter
+type RateLimitConfig struct {
+	// Rate is the sustained number of operations per second that are allowed. Zero disables rate
+	// limiting.
+	Rate float64 `json:"rate"`
+	// Burst is the number of operations that can happen at once before subsequent ones are
+	// throttled. Zero is treated as one.
+	Burst uint `json:"burst"`
+}
+
+// RateLimiterMetrics holds the prometheus collectors shared by RateLimiters within the same
+// service.
+//
+// The metrics used are:
+//
+//   - operations_total (number of operations, labeled by result: "allowed", "delayed", or "rejected")
+//   - delay_seconds_total (total time that delayed operations were told to wait)
+//
+// Prefixes are typically of the form "COMPONENT_rate_limiter". Each RateLimiter's metrics are
+// additionally labeled by its instance, with the "limiter" label.
+type RateLimiterMetrics struct {
+	operationsTotal   *prometheus.CounterVec
+	delaySecondsTotal *prometheus.CounterVec
+}
+
+const metricLimiterLabel = "limiter"
+
+// NewRateLimiterMetrics creates a new set of metrics for RateLimiters, registering them with reg.
+func NewRateLimiterMetrics(prefix string, reg prometheus.Registerer) RateLimiterMetrics {
+	return RateLimiterMetrics{
+		operationsTotal: RegisterMetric(reg, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: fmt.Sprint(prefix, "_operations_total"),
+				Help: "Number of operations checked against the rate limiter, by whether they were throttled",
+			},
+			[]string{metricLimiterLabel, "result"},
+		)),
+		delaySecondsTotal: RegisterMetric(reg, prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: fmt.Sprint(prefix, "_delay_seconds_total"),
+				Help: "Total time that operations were delayed by the rate limiter",
+			},
+			[]string{metricLimiterLabel},
+		)),
+	}
+}
+
+// RateLimiter is a leaky-bucket rate limiter: each operation adds to the bucket, which drains at
+// the configured rate. Operations that would overflow the bucket are throttled.
+//
+// RateLimiter is safe for concurrent use.
+type RateLimiter struct {
+	mu sync.Mutex
+
+	config RateLimitConfig
+	// level is the amount currently in the bucket, as of lastLeak. It may exceed the burst if
+	// operations were delayed with Reserve or Wait.
+	level    float64
+	lastLeak time.Time
+
+	instance string
+	metrics  RateLimiterMetrics
+}
+
+// NewRateLimiter creates a new RateLimiter with the config, reporting to metrics with instance as
+// the value of the "limiter" label.
+func NewRateLimiter(config RateLimitConfig, metrics RateLimiterMetrics, instance string) *RateLimiter {
+	return &RateLimiter{
+		mu:       sync.Mutex{},
+		config:   config,
+		level:    0,
+		lastLeak: time.Now(),
+		instance: instance,
+		metrics:  metrics,
+	}
+}
+
+// SetConfig replaces the limits used by the RateLimiter. Operations that are already delayed are
+// not affected.
+func (l *RateLimiter) SetConfig(config RateLimitConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.leak(time.Now())
+	l.config = config
+}
+
+// leak drains the bucket according to the time elapsed since it was last drained.
+//
+// Must be called with l.mu held.
+func (l *RateLimiter) leak(now time.Time) {
+	if elapsed := now.Sub(l.lastLeak); elapsed > 0 {
+		l.level = max(0, l.level-elapsed.Seconds()*l.config.Rate)
+	}
+	l.lastLeak = now
+}
+
+func (l *RateLimiter) burst() float64 {
+	return float64(max(1, l.config.Burst))
+}
+
+// Allow returns whether an operation can happen now, recording it if so. If not, the operation is
+// rejected and should be skipped.
+func (l *RateLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.config.Rate == 0 {
+		l.record("allowed", 0)
+		return true
+	}
+
+	l.leak(time.Now())
+	if l.level+1 > l.burst() {
+		l.record("rejected", 0)
+		return false
+	}
+	l.level += 1
+	l.record("allowed", 0)
+	return true
+}
+
+// Reserve records an operation, returning how long the caller must wait before it can happen.
+//
+// Unlike Allow, the operation is never rejected -- only delayed.
+func (l *RateLimiter) Reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.reserve()
+}
+
+// Must be called with l.mu held.
+func (l *RateLimiter) reserve() time.Duration {
+	if l.config.Rate == 0 {
+		l.record("allowed", 0)
+		return 0
+	}
+
+	l.leak(time.Now())
+	l.level += 1
+	if l.level <= l.burst() {
+		l.record("allowed", 0)
+		return 0
+	}
+
+	delay := time.Duration((l.level - l.burst()) / l.config.Rate * float64(time.Second))
+	l.record("delayed", delay)
+	return delay
+}
+
+// Wait blocks until an operation can happen, or the context is canceled.
+//
+// If the context is canceled first, the operation is not counted towards the limit, and the
+// context's error is returned.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	delay := l.reserve()
+	l.mu.Unlock()
+
+	if err := SleepContext(ctx, delay); err != nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.level = max(0, l.level-1)
+		return err
+	}
+	return nil
+}
+
+// Must be called with l.mu held.
+func (l *RateLimiter) record(result string, delay time.Duration) {
+	l.metrics.operationsTotal.WithLabelValues(l.instance, result).Inc()
+	if delay != 0 {
+		l.metrics.delaySecondsTotal.WithLabelValues(l.instance).Add(delay.Seconds())
+	}
+}
@@ -0,0 +1,70 @@
+package util_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics := util.NewRateLimiterMetrics("test_rate_limiter", reg)
+	limiter := util.NewRateLimiter(util.RateLimitConfig{Rate: 1, Burst: 3}, metrics, "test")
+
+	// The burst is allowed immediately, and then we're throttled
+	for range 3 {
+		assert.True(t, limiter.Allow())
+	}
+	assert.False(t, limiter.Allow())
+	assert.False(t, limiter.Allow())
+
+	count, err := testutil.GatherAndCount(reg, "test_rate_limiter_operations_total")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count) // one series each for allowed and rejected
+
+	// Disabling the limit allows everything
+	limiter.SetConfig(util.RateLimitConfig{Rate: 0, Burst: 0})
+	for range 100 {
+		assert.True(t, limiter.Allow())
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	metrics := util.NewRateLimiterMetrics("test_rate_limiter", prometheus.NewRegistry())
+	limiter := util.NewRateLimiter(util.RateLimitConfig{Rate: 10, Burst: 1}, metrics, "test")
+
+	assert.Equal(t, time.Duration(0), limiter.Reserve())
+
+	// Each subsequent operation should be delayed by another 1/rate
+	for i := 1; i <= 3; i++ {
+		delay := limiter.Reserve()
+		expected := time.Duration(i) * 100 * time.Millisecond
+		assert.InDelta(t, expected, delay, float64(10*time.Millisecond))
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	metrics := util.NewRateLimiterMetrics("test_rate_limiter", prometheus.NewRegistry())
+	limiter := util.NewRateLimiter(util.RateLimitConfig{Rate: 100, Burst: 1}, metrics, "test")
+
+	start := time.Now()
+	for range 3 {
+		require.NoError(t, limiter.Wait(context.Background()))
+	}
+	// First is immediate, then 10ms each
+	assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+
+	// Canceled waits return the context's error
+	limiter.SetConfig(util.RateLimitConfig{Rate: 0.001, Burst: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := limiter.Wait(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
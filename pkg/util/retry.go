@@ -0,0 +1,131 @@
+package util
+
+// Helpers for retrying operations with exponential backoff and jitter.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff describes the delays between successive attempts of an operation
+type Backoff struct {
+	// Initial is the delay before the first retry.
+	Initial time.Duration
+	// Max, if non-zero, gives the maximum delay before jitter is added.
+	Max time.Duration
+	// Multiplier is the factor by which the delay increases after each retry. Values less than or
+	// equal to 1 give a constant delay.
+	Multiplier float64
+	// Jitter, if non-zero, gives the maximum fraction of the delay to randomly add to it -- see
+	// Jitter.
+	Jitter float64
+}
+
+// Delay returns the delay to use after the given number of retries have already been made (i.e.,
+// zero for the delay before the first retry).
+func (b Backoff) Delay(retries int) time.Duration {
+	d := float64(b.Initial)
+	if b.Multiplier > 1 && retries > 0 {
+		d *= math.Pow(b.Multiplier, float64(retries))
+	}
+
+	limit := time.Duration(math.MaxInt64)
+	if b.Max != 0 {
+		limit = b.Max
+	}
+	// note: this also handles d = +Inf from overflow.
+	if d >= float64(limit) {
+		return Jitter(limit, b.Jitter)
+	}
+
+	return Jitter(time.Duration(d), b.Jitter)
+}
+
+// Jitter returns a random duration between d and d * (1 + fraction), so that many clients
+// retrying after the same delay don't all retry at the same time.
+func Jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 || d <= 0 {
+		return d
+	}
+	extra := float64(d) * fraction * rand.Float64()
+	if extra >= float64(math.MaxInt64-d) {
+		return math.MaxInt64
+	}
+	return d + time.Duration(extra)
+}
+
+// SleepContext waits for the duration, returning early with the context's error if it is canceled
+// first.
+func SleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// ErrRetriesExhausted is returned (wrapped) by Retry when the operation failed on every one of
+// RetryConfig.MaxAttempts.
+var ErrRetriesExhausted = errors.New("retries exhausted")
+
+// RetryConfig configures the behavior of Retry
+type RetryConfig struct {
+	// Backoff gives the delays between attempts.
+	Backoff Backoff
+	// MaxAttempts, if non-zero, gives the maximum number of attempts, including the first.
+	MaxAttempts int
+	// ShouldRetry, if not nil, is called with each error to check whether the operation should be
+	// retried. If it returns false, Retry returns the error immediately.
+	//
+	// If ShouldRetry is nil, all errors are retried.
+	ShouldRetry func(error) bool
+	// OnRetry, if not nil, is called after each failed attempt that will be retried, with the
+	// number of the attempt that failed (starting from 1), its error, and the delay before the next
+	// attempt.
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// Retry calls fn until it succeeds, waiting between attempts as given by the config.
+//
+// Retry returns nil once fn succeeds. Otherwise, it returns:
+//
+//   - The error from fn, if ShouldRetry returned false for it;
+//   - An error wrapping both ErrRetriesExhausted and the last error, if there were MaxAttempts
+//     failed attempts; or
+//   - An error wrapping both the context's error and the last error, if the context was canceled.
+func Retry(ctx context.Context, config RetryConfig, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		if config.ShouldRetry != nil && !config.ShouldRetry(err) {
+			return err
+		}
+		if config.MaxAttempts != 0 && attempt >= config.MaxAttempts {
+			return fmt.Errorf("%w after %d attempts: %w", ErrRetriesExhausted, attempt, err)
+		}
+
+		delay := config.Backoff.Delay(attempt - 1)
+		if config.OnRetry != nil {
+			config.OnRetry(attempt, err, delay)
+		}
+
+		if ctxErr := SleepContext(ctx, delay); ctxErr != nil {
+			return fmt.Errorf("%w while waiting to retry: %w", ctxErr, err)
+		}
+	}
+}
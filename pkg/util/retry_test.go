@@ -0,0 +1,122 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{
+		Initial:    time.Second,
+		Max:        10 * time.Second,
+		Multiplier: 2,
+		Jitter:     0,
+	}
+
+	assert.Equal(t, time.Second, b.Delay(0))
+	assert.Equal(t, 2*time.Second, b.Delay(1))
+	assert.Equal(t, 8*time.Second, b.Delay(3))
+	assert.Equal(t, 10*time.Second, b.Delay(4))
+	assert.Equal(t, 10*time.Second, b.Delay(1000))
+
+	// Constant backoff
+	b.Multiplier = 0
+	assert.Equal(t, time.Second, b.Delay(5))
+
+	// No maximum shouldn't overflow
+	b = Backoff{Initial: time.Second, Max: 0, Multiplier: 2, Jitter: 0}
+	assert.Equal(t, time.Duration(math.MaxInt64), b.Delay(1000))
+}
+
+func TestJitter(t *testing.T) {
+	for range 100 {
+		d := Jitter(time.Second, 0.5)
+		assert.GreaterOrEqual(t, d, time.Second)
+		assert.LessOrEqual(t, d, 1500*time.Millisecond)
+	}
+
+	assert.Equal(t, time.Second, Jitter(time.Second, 0))
+	assert.Equal(t, time.Duration(math.MaxInt64), Jitter(math.MaxInt64, 1))
+}
+
+func TestRetry(t *testing.T) {
+	backoff := Backoff{Initial: time.Millisecond, Max: 0, Multiplier: 0, Jitter: 0}
+	errFailed := errors.New("failed")
+
+	t.Run("succeeds after retries", func(t *testing.T) {
+		calls := 0
+		var retried []int
+		err := Retry(context.Background(), RetryConfig{
+			Backoff:     backoff,
+			MaxAttempts: 5,
+			ShouldRetry: nil,
+			OnRetry: func(attempt int, err error, delay time.Duration) {
+				assert.ErrorIs(t, err, errFailed)
+				assert.Equal(t, time.Millisecond, delay)
+				retried = append(retried, attempt)
+			},
+		}, func() error {
+			calls += 1
+			if calls < 3 {
+				return errFailed
+			}
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, []int{1, 2}, retried)
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		calls := 0
+		err := Retry(context.Background(), RetryConfig{
+			Backoff:     backoff,
+			MaxAttempts: 3,
+			ShouldRetry: nil,
+			OnRetry:     nil,
+		}, func() error {
+			calls += 1
+			return errFailed
+		})
+		assert.ErrorIs(t, err, ErrRetriesExhausted)
+		assert.ErrorIs(t, err, errFailed)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		calls := 0
+		err := Retry(context.Background(), RetryConfig{
+			Backoff:     backoff,
+			MaxAttempts: 0,
+			ShouldRetry: func(error) bool { return false },
+			OnRetry:     nil,
+		}, func() error {
+			calls += 1
+			return errFailed
+		})
+		assert.Equal(t, errFailed, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		calls := 0
+		err := Retry(ctx, RetryConfig{
+			Backoff:     Backoff{Initial: time.Hour, Max: 0, Multiplier: 0, Jitter: 0},
+			MaxAttempts: 0,
+			ShouldRetry: nil,
+			OnRetry:     func(int, error, time.Duration) { cancel() },
+		}, func() error {
+			calls += 1
+			return errFailed
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.ErrorIs(t, err, errFailed)
+		assert.Equal(t, 1, calls)
+	})
+}
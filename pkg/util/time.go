@@ -10,9 +10,33 @@ type TimeRange struct {
 	min   int
 	max   int
 	units time.Duration
+
+	// backoff, if not nil, gives how delays from RetryDelays grow after the first one.
+	backoff *Backoff
+}
+
+// TimeRangeOption configures how delays from a TimeRange's RetryDelays grow with each retry. By
+// default, every delay is picked independently within the range.
+type TimeRangeOption func(*TimeRange)
+
+// WithBackoff makes successive delays from RetryDelays grow exponentially by the multiplier,
+// starting from the top of the range and capped at maxTime units.
+//
+// Each delay after the first is picked randomly between half and all of the backoff delay (see
+// Backoff and Jitter), so that clients that started retrying at the same time don't stay in
+// lockstep, even once they reach the cap.
+func WithBackoff(multiplier float64, maxTime int) TimeRangeOption {
+	return func(r *TimeRange) {
+		r.backoff = &Backoff{
+			Initial:    time.Duration(r.max) * r.units / 2,
+			Max:        time.Duration(maxTime) * r.units / 2,
+			Multiplier: multiplier,
+			Jitter:     1,
+		}
+	}
 }
 
-func NewTimeRange(units time.Duration, minTime, maxTime int) *TimeRange {
+func NewTimeRange(units time.Duration, minTime, maxTime int, opts ...TimeRangeOption) *TimeRange {
 	if minTime < 0 {
 		panic(errors.New("bad time range: min < 0"))
 	} else if minTime == 0 && maxTime == 0 {
@@ -21,7 +45,20 @@ func NewTimeRange(units time.Duration, minTime, maxTime int) *TimeRange {
 		panic(errors.New("bad time range: max < min"))
 	}
 
-	return &TimeRange{min: minTime, max: maxTime, units: units}
+	r := &TimeRange{min: minTime, max: maxTime, units: units, backoff: nil}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.backoff != nil {
+		if r.backoff.Multiplier <= 1 {
+			panic(errors.New("bad time range: backoff multiplier <= 1"))
+		} else if r.backoff.Max < r.backoff.Initial {
+			panic(errors.New("bad time range: backoff cap < max"))
+		}
+	}
+
+	return r
 }
 
 // Random returns a random time.Duration within the range
@@ -33,3 +70,38 @@ func (r TimeRange) Random() time.Duration {
 	count := rand.Intn(r.max-r.min) + r.min
 	return time.Duration(count) * r.units
 }
+
+// RetryDelays returns a new sequence of delays between retries, growing according to the
+// TimeRange's options.
+//
+// The first delay is always picked by Random. The RetryDelays should be discarded (or Reset) once
+// the operation succeeds.
+func (r *TimeRange) RetryDelays() *RetryDelays {
+	return &RetryDelays{r: r, retries: 0}
+}
+
+// RetryDelays is a sequence of delays between retries of a single operation, created by
+// (*TimeRange).RetryDelays(). It is not safe for concurrent use.
+type RetryDelays struct {
+	r *TimeRange
+
+	retries int
+}
+
+// Next returns the delay before the next retry
+func (d *RetryDelays) Next() time.Duration {
+	var delay time.Duration
+	if d.r.backoff == nil || d.retries == 0 {
+		delay = d.r.Random()
+	} else {
+		delay = d.r.backoff.Delay(d.retries - 1)
+	}
+
+	d.retries += 1
+	return delay
+}
+
+// Reset restarts the sequence, so that the next delay is as if there were no previous retries
+func (d *RetryDelays) Reset() {
+	d.retries = 0
+}
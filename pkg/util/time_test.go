@@ -0,0 +1,66 @@
+package util_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+func TestRetryDelaysFixed(t *testing.T) {
+	delays := util.NewTimeRange(time.Second, 1, 3).RetryDelays()
+	for range 100 {
+		d := delays.Next()
+		assert.GreaterOrEqual(t, d, time.Second)
+		assert.Less(t, d, 3*time.Second)
+	}
+}
+
+func TestRetryDelaysBackoff(t *testing.T) {
+	delays := util.NewTimeRange(time.Second, 1, 2, util.WithBackoff(2, 10)).RetryDelays()
+
+	expectedRanges := [][2]time.Duration{
+		{1 * time.Second, 2 * time.Second},
+		{1 * time.Second, 2 * time.Second},
+		{2 * time.Second, 4 * time.Second},
+		{4 * time.Second, 8 * time.Second},
+		{5 * time.Second, 10 * time.Second},
+		{5 * time.Second, 10 * time.Second},
+	}
+	for i, r := range expectedRanges {
+		d := delays.Next()
+		assert.GreaterOrEqual(t, d, r[0], "retry %d", i)
+		assert.LessOrEqual(t, d, r[1], "retry %d", i)
+	}
+
+	// After reset, we should be back to the original range
+	delays.Reset()
+	d := delays.Next()
+	assert.GreaterOrEqual(t, d, time.Second)
+	assert.Less(t, d, 2*time.Second)
+}
+
+func TestRetryDelaysBackoffSpread(t *testing.T) {
+	// Even once the cap is reached, delays should be spread out
+	seen := make(map[time.Duration]struct{})
+	for range 100 {
+		delays := util.NewTimeRange(time.Millisecond, 0, 100, util.WithBackoff(2, 1000)).RetryDelays()
+		for i := range 20 {
+			d := delays.Next()
+			assert.GreaterOrEqual(t, d, time.Duration(0))
+			assert.LessOrEqual(t, d, time.Second)
+			if i == 19 {
+				assert.GreaterOrEqual(t, d, 500*time.Millisecond)
+				seen[d] = struct{}{}
+			}
+		}
+	}
+	assert.Greater(t, len(seen), 1)
+}
+
+func TestTimeRangeBadBackoff(t *testing.T) {
+	assert.Panics(t, func() { util.NewTimeRange(time.Second, 1, 5, util.WithBackoff(2, 4)) })
+	assert.Panics(t, func() { util.NewTimeRange(time.Second, 1, 5, util.WithBackoff(1, 10)) })
+}
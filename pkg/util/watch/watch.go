@@ -46,6 +46,9 @@ type Config struct {
 
 	// RetryRelistAfter gives a retry interval when a re-list fails. If left nil, then Watch will
 	// not retry.
+	//
+	// Successive retries are spaced according to (*util.TimeRange).RetryDelays(), so they will
+	// back off if the TimeRange was created with a backoff option.
 	RetryRelistAfter *util.TimeRange
 	// RetryWatchAfter gives a retry interval when a non-initial watch fails. If left nil, then
 	// Watch will not retry.
@@ -283,6 +286,10 @@ func Watch[C Client[L], L metav1.ListMetaAccessor, T any, P Object[T]](
 
 		logger.Info("All setup complete, entering event loop")
 
+		// Delays between retries of relisting and re-watching, created on the first failure and
+		// cleared on success, so that retries back off for as long as the failures continue.
+		var relistDelays, watchDelays *util.RetryDelays
+
 		for {
 			// this is used exclusively for relisting, but must be defined up here so that our gotos
 			// don't jump over variables.
@@ -414,7 +421,10 @@ func Watch[C Client[L], L metav1.ListMetaAccessor, T any, P Object[T]](
 						logger.Info("Ending: because relist failed and RetryWatchAfter is nil")
 						return
 					}
-					retryAfter := config.RetryRelistAfter.Random()
+					if relistDelays == nil {
+						relistDelays = config.RetryRelistAfter.RetryDelays()
+					}
+					retryAfter := relistDelays.Next()
 					logger.Info("Retrying relist after delay", zap.Duration("delay", retryAfter))
 
 					store.failing.Store(true)
@@ -435,6 +445,7 @@ func Watch[C Client[L], L metav1.ListMetaAccessor, T any, P Object[T]](
 
 				store.failing.Store(false)
 				config.Metrics.unfailing()
+				relistDelays = nil
 
 				// err == nil, process relistList
 				relistItems := accessors.Items(relistList)
@@ -525,7 +536,10 @@ func Watch[C Client[L], L metav1.ListMetaAccessor, T any, P Object[T]](
 						logger.Info("Ending: because re-watch failed and RetryWatchAfter is nil")
 						return
 					}
-					retryAfter := config.RetryWatchAfter.Random()
+					if watchDelays == nil {
+						watchDelays = config.RetryWatchAfter.RetryDelays()
+					}
+					retryAfter := watchDelays.Next()
 					logger.Info("Retrying re-watch after delay", zap.Duration("delay", retryAfter))
 
 					store.failing.Store(true)
@@ -547,6 +561,7 @@ func Watch[C Client[L], L metav1.ListMetaAccessor, T any, P Object[T]](
 				// err == nil
 				store.failing.Store(false)
 				config.Metrics.unfailing()
+				watchDelays = nil
 				break
 			}
 		}
@@ -0,0 +1,130 @@
+// protocol-check exercises the protocols spoken by a running scheduler plugin or vm-monitor, across
+// all protocol versions known to this build, and reports any incompatibilities:
+//
+//	protocol-check plugin [-pod NAMESPACE/NAME -resources CPU,MEM] HOST:PORT
+//	protocol-check monitor [-resources CPU,MEM] HOST:PORT
+//
+// It's intended for validating mixed-version rollouts, e.g. checking that a new scheduler plugin
+// still accepts requests from the autoscaler-agents that are already running.
+//
+// By default, the checks do not change any state on the other side. Passing -resources (and, for
+// the scheduler plugin, -pod) additionally sends real requests for those resources, so it should
+// only be used with the resources the VM currently has, or on a VM that's safe to experiment on.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, r *report, args []string) error
+}
+
+var commands = map[string]command{
+	"monitor": {
+		usage: "monitor [-resources CPU,MEM] [-timeout DURATION] HOST:PORT | ws://HOST:PORT/PATH",
+		run:   runMonitorCheck,
+	},
+	"plugin": {
+		usage: "plugin [-pod NAMESPACE/NAME -resources CPU,MEM] [-timeout DURATION] HOST:PORT | http://HOST:PORT/PATH",
+		run:   runPluginCheck,
+	},
+}
+
+var errUsage = errors.New("usage error")
+
+func main() {
+	flags := flag.NewFlagSet("protocol-check", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: protocol-check COMMAND ARGS...\n\nCommands:\n")
+		var names []string
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(flags.Output(), "  %s\n", commands[name].usage)
+		}
+	}
+	_ = flags.Parse(os.Args[1:]) // ExitOnError
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flags.Arg(0))
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	r := &report{failures: 0}
+	if err := cmd.run(ctx, r, flags.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "usage: protocol-check %s\n", cmd.usage)
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+
+	if r.failures != 0 {
+		fmt.Printf("\n%d check(s) failed\n", r.failures)
+		os.Exit(1)
+	}
+	fmt.Printf("\nall checks passed\n")
+}
+
+// report collects the results of individual checks, printing them as they happen.
+type report struct {
+	failures int
+}
+
+func (r *report) pass(format string, args ...any) {
+	fmt.Printf("ok    %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *report) fail(format string, args ...any) {
+	r.failures += 1
+	fmt.Printf("FAIL  %s\n", fmt.Sprintf(format, args...))
+}
+
+// note records something worth knowing about that isn't necessarily an incompatibility.
+func (r *report) note(format string, args ...any) {
+	fmt.Printf("note  %s\n", fmt.Sprintf(format, args...))
+}
+
+// resourcesFlag is a flag.Value for api.Resources, given as "CPU,MEM" (e.g. "0.5,2Gi").
+type resourcesFlag struct {
+	value *api.Resources
+}
+
+func (f *resourcesFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v,%v", f.value.VCPU, f.value.Mem)
+}
+
+func (f *resourcesFlag) Set(s string) error {
+	r, err := api.ParseResources(s)
+	if err != nil {
+		return err
+	}
+	f.value = &r
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+// 'protocol-check monitor' checks the autoscaler-agent <-> vm-monitor protocol.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+
+	"github.com/neondatabase/autoscaling/pkg/agent"
+	"github.com/neondatabase/autoscaling/pkg/api"
+)
+
+func runMonitorCheck(ctx context.Context, r *report, args []string) error {
+	flags := flag.NewFlagSet("monitor", flag.ContinueOnError)
+	resources := &resourcesFlag{value: nil}
+	flags.Var(resources, "resources", "CPU,MEM currently allocated to the VM, to send upscale and downscale messages for")
+	timeout := flags.Duration("timeout", 5*time.Second, "Timeout for connecting and for each message")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%w: expected vm-monitor address", errUsage)
+	}
+
+	addr := flags.Arg(0)
+	if !strings.Contains(addr, "://") {
+		addr = fmt.Sprintf("ws://%s/monitor", addr)
+	}
+
+	fmt.Printf("Checking vm-monitor at %s\n\n", addr)
+
+	// First, check each version individually during the handshake.
+	var accepted []api.MonitorProtoVersion
+	for v := api.MonitorProtoVersion(api.MonitorProtoV1_0); v.IsKnown(); v++ {
+		desc := fmt.Sprintf("protocol %v", v)
+		versionRange := api.VersionRange[api.MonitorProtoVersion]{Min: v, Max: v}
+		conn, resp, err := monitorHandshake(ctx, addr, *timeout, versionRange)
+		switch {
+		case err != nil:
+			r.fail("%s: %s", desc, err)
+		case resp.Error != nil:
+			r.note("%s: rejected: %s", desc, *resp.Error)
+		case resp.Version != v:
+			r.fail("%s: vm-monitor picked version %v outside of requested range", desc, resp.Version)
+		default:
+			r.pass("%s: accepted", desc)
+			accepted = append(accepted, v)
+		}
+		if conn != nil {
+			conn.Close(websocket.StatusNormalClosure, "protocol check done")
+		}
+	}
+
+	fmt.Println()
+
+	agentRange := api.VersionRange[api.MonitorProtoVersion]{
+		Min: agent.MinMonitorProtocolVersion,
+		Max: agent.MaxMonitorProtocolVersion,
+	}
+	conn, resp, err := monitorHandshake(ctx, addr, *timeout, agentRange)
+	if err != nil {
+		r.fail("handshake with autoscaler-agent range %v: %s", agentRange, err)
+		return nil
+	} else if resp.Error != nil {
+		r.fail("autoscaler-agent in this build (protocols %v) would be rejected: %s", agentRange, *resp.Error)
+		conn.Close(websocket.StatusNormalClosure, "protocol check done")
+		return nil
+	}
+	defer conn.Close(websocket.StatusNormalClosure, "protocol check done")
+	r.pass("autoscaler-agent in this build (protocols %v) negotiates %v", agentRange, resp.Version)
+
+	// Then, exercise each of the message types, using the version the agent would use.
+	mc := &monitorConn{conn: conn, timeout: *timeout, lastID: 0}
+
+	checkMessage := func(desc string, send any, expectedType string) {
+		got, err := mc.call(ctx, send)
+		if err != nil {
+			r.fail("%s: %s", desc, err)
+		} else if got.typ != expectedType {
+			r.fail("%s: expected %s response, got %s: %s", desc, expectedType, got.typ, got.raw)
+		} else {
+			r.pass("%s: got %s", desc, got.raw)
+		}
+	}
+
+	checkMessage("HealthCheck", api.HealthCheck{}, "HealthCheck")
+	checkMessage("unknown message type", unknownMonitorMessage{}, "InvalidMessage")
+	if resources.value != nil {
+		alloc := resources.value.ConvertToAllocation()
+		checkMessage("UpscaleNotification", api.UpscaleNotification{Granted: alloc, RequestID: ""}, "UpscaleConfirmation")
+		checkMessage("DownscaleRequest", api.DownscaleRequest{Target: alloc, RequestID: ""}, "DownscaleResult")
+	} else {
+		r.note("skipping UpscaleNotification and DownscaleRequest, because -resources was not given")
+	}
+
+	return nil
+}
+
+// monitorHandshake connects to the vm-monitor and negotiates the protocol version.
+//
+// The connection is non-nil iff the error is nil.
+func monitorHandshake(
+	ctx context.Context,
+	addr string,
+	timeout time.Duration,
+	versionRange api.VersionRange[api.MonitorProtoVersion],
+) (*websocket.Conn, *api.MonitorProtocolResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// We do not need to close the response body according to docs.
+	// Doing so causes memory bugs.
+	c, _, err := websocket.Dial(ctx, addr, nil) //nolint:bodyclose // see comment above
+	if err != nil {
+		return nil, nil, fmt.Errorf("error establishing websocket connection: %w", err)
+	}
+
+	if err := wsjson.Write(ctx, c, versionRange); err != nil {
+		c.Close(websocket.StatusInternalError, "failed to send protocol range")
+		return nil, nil, fmt.Errorf("error sending protocol range: %w", err)
+	}
+
+	var rawResp json.RawMessage
+	err = wsjson.Read(ctx, c, &rawResp)
+	if err == nil {
+		err = api.MonitorProtocolResponseSchema().Validate(rawResp)
+	}
+	var resp api.MonitorProtocolResponse
+	if err == nil {
+		err = json.Unmarshal(rawResp, &resp)
+	}
+	if err != nil {
+		c.Close(websocket.StatusProtocolError, "bad protocol response")
+		return nil, nil, fmt.Errorf("error reading protocol response: %w", err)
+	}
+
+	return c, &resp, nil
+}
+
+// unknownMonitorMessage is sent to check that the vm-monitor responds to messages it doesn't
+// understand with an InvalidMessage.
+type unknownMonitorMessage struct{}
+
+type monitorConn struct {
+	conn    *websocket.Conn
+	timeout time.Duration
+	lastID  uint64
+}
+
+type monitorMessage struct {
+	typ string
+	raw json.RawMessage
+}
+
+// call sends the message to the vm-monitor and waits for the message in response to it.
+//
+// Unrelated messages from the vm-monitor (e.g. UpscaleRequests) are validated, but otherwise
+// ignored.
+func (mc *monitorConn) call(ctx context.Context, message any) (*monitorMessage, error) {
+	ctx, cancel := context.WithTimeout(ctx, mc.timeout)
+	defer cancel()
+
+	// Like the autoscaler-agent, we only use even IDs.
+	mc.lastID += 2
+	id := mc.lastID
+
+	var data []byte
+	if _, ok := message.(unknownMonitorMessage); ok {
+		data = []byte(fmt.Sprintf(`{"type":"ProtocolCheckUnknownMessage","id":%d,"content":{}}`, id))
+	} else {
+		var err error
+		data, err = api.SerializeMonitorMessage(message, id)
+		if err != nil {
+			return nil, fmt.Errorf("error serializing message: %w", err)
+		}
+	}
+
+	raw := json.RawMessage(data)
+	if err := wsjson.Write(ctx, mc.conn, &raw); err != nil {
+		return nil, fmt.Errorf("error sending message: %w", err)
+	}
+
+	for {
+		var msg json.RawMessage
+		if err := wsjson.Read(ctx, mc.conn, &msg); err != nil {
+			return nil, fmt.Errorf("error receiving message: %w", err)
+		}
+
+		var header struct {
+			Type *string `json:"type"`
+			ID   *uint64 `json:"id"`
+		}
+		if err := json.Unmarshal(msg, &header); err != nil {
+			return nil, fmt.Errorf("error deserializing message %q: %w", string(msg), err)
+		} else if header.Type == nil || header.ID == nil {
+			return nil, fmt.Errorf("message %q is missing 'type' or 'id'", string(msg))
+		}
+
+		if err := api.MonitorToAgentMessageSchema().Validate(msg); err != nil {
+			return nil, fmt.Errorf("%s message %q does not match schema: %w", *header.Type, string(msg), err)
+		}
+
+		if *header.ID != id {
+			if *header.ID%2 == 0 {
+				return nil, errors.New("got message with unexpected even id, which should be reserved for the autoscaler-agent")
+			}
+			continue
+		}
+
+		return &monitorMessage{typ: *header.Type, raw: msg}, nil
+	}
+}
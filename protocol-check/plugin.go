@@ -0,0 +1,236 @@
+package main
+
+// 'protocol-check plugin' checks the autoscaler-agent <-> scheduler plugin protocol.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/samber/lo"
+
+	"github.com/neondatabase/autoscaling/pkg/agent"
+	"github.com/neondatabase/autoscaling/pkg/api"
+	"github.com/neondatabase/autoscaling/pkg/plugin"
+	"github.com/neondatabase/autoscaling/pkg/util"
+)
+
+// probePod is the pod we make requests for when no pod is given. The scheduler plugin checks the
+// protocol version before looking up the pod, so a 404 for it means the version was accepted.
+var probePod = util.NamespacedName{Namespace: "default", Name: "protocol-check-nonexistent-pod"}
+
+type pluginEncoding struct {
+	name        string
+	contentType string
+	encode      func(api.AgentRequest) ([]byte, error)
+	decode      func([]byte) (*api.PluginResponse, error)
+}
+
+var pluginEncodings = []pluginEncoding{
+	{
+		name:        "json",
+		contentType: plugin.ContentTypeJSON,
+		encode: func(req api.AgentRequest) ([]byte, error) {
+			return json.Marshal(req)
+		},
+		decode: func(body []byte) (*api.PluginResponse, error) {
+			if err := api.PluginResponseSchema().Validate(body); err != nil {
+				return nil, fmt.Errorf("response does not match schema: %w", err)
+			}
+			var resp api.PluginResponse
+			if err := json.Unmarshal(body, &resp); err != nil {
+				return nil, err
+			}
+			return &resp, nil
+		},
+	},
+	{
+		name:        "protobuf",
+		contentType: api.ContentTypeProtobuf,
+		encode: func(req api.AgentRequest) ([]byte, error) {
+			return req.MarshalProto()
+		},
+		decode: func(body []byte) (*api.PluginResponse, error) {
+			var resp api.PluginResponse
+			if err := resp.UnmarshalProto(body); err != nil {
+				return nil, err
+			}
+			return &resp, nil
+		},
+	},
+}
+
+func runPluginCheck(ctx context.Context, r *report, args []string) error {
+	flags := flag.NewFlagSet("plugin", flag.ContinueOnError)
+	podName := flags.String("pod", "", "NAMESPACE/NAME of a pod to make real requests for. Requires -resources")
+	resources := &resourcesFlag{value: nil}
+	flags.Var(resources, "resources", "CPU,MEM to request for the pod given by -pod")
+	computeUnit := &resourcesFlag{value: &api.Resources{VCPU: 250, Mem: 1 << 30}}
+	flags.Var(computeUnit, "compute-unit", "CPU,MEM of the compute unit to send in requests")
+	timeout := flags.Duration("timeout", 5*time.Second, "Timeout for each request")
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("%w: expected scheduler plugin address", errUsage)
+	}
+
+	url := flags.Arg(0)
+	if !strings.Contains(url, "://") {
+		url = fmt.Sprintf("http://%s/", url)
+	}
+
+	pod := probePod
+	var reqResources api.Resources
+	if *podName != "" {
+		namespace, name, ok := strings.Cut(*podName, "/")
+		if !ok {
+			return fmt.Errorf("%w: -pod must be NAMESPACE/NAME", errUsage)
+		}
+		if resources.value == nil {
+			return fmt.Errorf("%w: -pod requires -resources", errUsage)
+		}
+		pod = util.NamespacedName{Namespace: namespace, Name: name}
+		reqResources = *resources.value
+	} else {
+		if resources.value != nil {
+			return fmt.Errorf("%w: -resources requires -pod", errUsage)
+		}
+		reqResources = *computeUnit.value
+	}
+
+	fmt.Printf("Checking scheduler plugin at %s, for pod %v\n\n", url, pod)
+
+	accepted := make(map[string][]api.PluginProtoVersion)
+	var lastPermit *api.Resources
+
+	for v := api.PluginProtoV1_0; v.IsKnown(); v++ {
+		for _, enc := range pluginEncodings {
+			req := api.AgentRequest{
+				ProtoVersion: v,
+				Pod:          pod,
+				ComputeUnit:  *computeUnit.value,
+				Resources:    reqResources,
+				LastPermit:   lastPermit,
+				Metrics:      &api.Metrics{LoadAverage1Min: 0, LoadAverage5Min: nil, MemoryUsageBytes: nil},
+				Departing:    false,
+				RequestID:    "",
+			}
+
+			res, err := doPluginRequest(ctx, url, *timeout, enc, req)
+			desc := fmt.Sprintf("protocol %v (%s)", v, enc.name)
+			switch {
+			case err != nil:
+				r.fail("%s: %s", desc, err)
+			case res.status == 200:
+				r.pass("%s: accepted, got permit %v", desc, res.resp.Permit)
+				accepted[enc.name] = append(accepted[enc.name], v)
+				lastPermit = lo.ToPtr(res.resp.Permit)
+			case res.status == 404 && pod == probePod:
+				r.pass("%s: accepted", desc)
+				accepted[enc.name] = append(accepted[enc.name], v)
+			case res.status == 400:
+				r.note("%s: rejected: %s", desc, res.errorBody)
+			default:
+				r.fail("%s: unexpected status %d: %s", desc, res.status, res.errorBody)
+			}
+		}
+	}
+
+	fmt.Println()
+
+	// The scheduler plugin in this build accepts exactly one range. Anything different means the
+	// remote is a different version; that's fine, as long as the agents can still talk to it.
+	ownRange := api.VersionRange[api.PluginProtoVersion]{
+		Min: plugin.MinPluginProtocolVersion,
+		Max: plugin.MaxPluginProtocolVersion,
+	}
+	jsonVersions := accepted["json"]
+	if len(jsonVersions) == 0 {
+		r.fail("scheduler plugin does not accept any protocol version known to this build")
+	} else {
+		remoteRange := api.VersionRange[api.PluginProtoVersion]{
+			Min: jsonVersions[0],
+			Max: jsonVersions[len(jsonVersions)-1],
+		}
+		if remoteRange != ownRange {
+			r.note("scheduler plugin accepts %v, but the scheduler plugin in this build accepts %v", remoteRange, ownRange)
+		}
+	}
+
+	if lo.Contains(jsonVersions, agent.PluginProtocolVersion) {
+		r.pass("autoscaler-agent in this build (protocol %v) is compatible", agent.PluginProtocolVersion)
+	} else {
+		r.fail("autoscaler-agent in this build (protocol %v) would be rejected", agent.PluginProtocolVersion)
+	}
+
+	if len(jsonVersions) != 0 && len(accepted["protobuf"]) == 0 {
+		r.note("scheduler plugin does not support protobuf requests; agents must not set scheduler.enableProtobuf")
+	}
+
+	return nil
+}
+
+type pluginResult struct {
+	status int
+	// resp is the decoded response, iff status is 200.
+	resp *api.PluginResponse
+	// errorBody is the body of the response, iff status is not 200.
+	errorBody string
+}
+
+// doPluginRequest sends the request to the scheduler plugin.
+//
+// Only unexpected failures are returned as errors; non-200 statuses are not.
+func doPluginRequest(
+	ctx context.Context,
+	url string,
+	timeout time.Duration,
+	enc pluginEncoding,
+	req api.AgentRequest,
+) (*pluginResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	reqBody, err := enc.encode(req)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding request: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("error building request: %w", err)
+	}
+	request.Header.Set("content-type", enc.contentType)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error doing request: %w", err)
+	}
+	defer response.Body.Close()
+
+	respBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if response.StatusCode != 200 {
+		return &pluginResult{status: response.StatusCode, resp: nil, errorBody: string(respBody)}, nil
+	}
+
+	if contentType := response.Header.Get("content-type"); contentType != enc.contentType {
+		return nil, fmt.Errorf("expected response content-type %q, got %q", enc.contentType, contentType)
+	}
+
+	resp, err := enc.decode(respBody)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	return &pluginResult{status: 200, resp: resp, errorBody: ""}, nil
+}
@@ -0,0 +1,12 @@
+#!/neonvm/bin/sh
+
+# Runs chronyd to discipline the clock via the ptp_kvm device, unless the VM is configured to rely
+# on the kvm-clock clocksource alone (.spec.guest.settings.clock.sync), in which case we just idle
+# so that init doesn't keep respawning this.
+
+if /neonvm/bin/grep -qw 'neonvm.clock_sync=kvm-clock' /proc/cmdline; then
+    echo "kvm-clock only, not starting chronyd"
+    exec /neonvm/bin/sleep 2147483647
+fi
+
+exec /neonvm/bin/chronyd -n -f /neonvm/config/chrony.conf -l /var/log/chrony/chrony.log
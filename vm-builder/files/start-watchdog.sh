@@ -0,0 +1,13 @@
+#!/neonvm/bin/sh
+
+# Keeps the VM's watchdog device alive (.spec.watchdog), so that QEMU only takes the watchdog's
+# action if the guest stops responding. VMs without a watchdog don't have neonvm.watchdog set, in
+# which case we just idle so that init doesn't keep respawning this.
+
+if ! /neonvm/bin/grep -qw 'neonvm.watchdog=on' /proc/cmdline; then
+    echo "no watchdog, not starting it"
+    exec /neonvm/bin/sleep 2147483647
+fi
+
+# Pet every 10s, with a 60s timeout, so that brief stalls (e.g. while migrating) don't trigger it.
+exec /neonvm/bin/watchdog -F -T 60 -t 10 /dev/watchdog
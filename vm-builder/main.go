@@ -50,6 +50,10 @@ var (
 	scriptResizeSwap string
 	//go:embed files/set-disk-quota.sh
 	scriptSetDiskQuota string
+	//go:embed files/start-chronyd.sh
+	scriptStartChronyd string
+	//go:embed files/start-watchdog.sh
+	scriptStartWatchdog string
 	//go:embed files/vector.yaml
 	configVector string
 	//go:embed files/chrony.conf
@@ -373,6 +377,8 @@ func main() {
 		{"udev-init.sh", scriptUdevInit},
 		{"resize-swap.sh", scriptResizeSwap},
 		{"set-disk-quota.sh", scriptSetDiskQuota},
+		{"start-chronyd.sh", scriptStartChronyd},
+		{"start-watchdog.sh", scriptStartWatchdog},
 	}
 
 	for _, f := range files {